@@ -16,40 +16,133 @@ package filesystem
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
+	"github.com/achetronic/adk-utils-go/artifact/filesystem/internal/lockedfile"
 	"google.golang.org/adk/artifact"
 	"google.golang.org/genai"
 )
 
 const userScopedArtifactKey = "user"
 
+// objectsDirName is the subdirectory (directly under BasePath) that holds
+// content-addressed blobs when ContentAddressed is enabled.
+const objectsDirName = "objects"
+
 // FilesystemService implements artifact.Service using the local filesystem.
 //
 // Artifacts are stored as JSON files under:
 //
 //	{BasePath}/{appName}/{userID}/{sessionID}/{fileName}/{version}.json
 //
+// Versions at or above FilesystemServiceConfig.InlineThresholdBytes, and
+// every version SaveStream writes, use a "{version}.bin" payload plus a
+// "{version}.meta.json" sidecar instead, so Save/SaveStream never has to
+// buffer or compress a copy of a large artifact in memory.
+//
 // User-scoped artifacts (filenames prefixed with "user:") are stored under
 // the "user" session key, making them accessible across all sessions for a
 // given (appName, userID) pair.
+//
+// Access is synchronized with OS-level advisory file locks (see the
+// internal lockedfile package) rather than an in-process mutex, so multiple
+// processes pointed at the same BasePath — not just multiple goroutines in
+// one — can Save/Load/Delete concurrently without corrupting versions.
 type FilesystemService struct {
-	basePath string
-	mu       sync.RWMutex
+	basePath             string
+	compression          Compression
+	contentAddressed     bool
+	signingKey           []byte
+	inlineThresholdBytes int64
+	maxBytesPerSession   int64
+	maxBytesPerUser      int64
+	globalMaxBytes       int64
+	maxVersionsPerFile   int
+
+	compactionCancel context.CancelFunc
+	compactionDone   chan struct{}
 }
 
 // FilesystemServiceConfig holds configuration for FilesystemService.
 type FilesystemServiceConfig struct {
 	// BasePath is the root directory for artifact storage.
 	BasePath string
+
+	// Compression compresses InlineData and text parts on Save and
+	// decompresses them on Load. The algorithm is recorded in a sidecar
+	// envelope alongside each blob, so blobs saved before this option was
+	// set (or with a different algorithm) keep loading correctly. Defaults
+	// to None.
+	Compression Compression
+
+	// ContentAddressed hashes the part payload (SHA-256) and stores the
+	// blob once under "<BasePath>/objects/<hash[:2]>/<hash[2:]>" (sharded so a
+	// single directory never holds one entry per blob in the whole store),
+	// writing only a small version manifest under the per-session directory
+	// that points at the hash. Repeated saves of identical bytes — across
+	// versions, sessions, or users — then share a single on-disk object.
+	// Each object carries a ".refcount" sidecar so Delete can tell when the
+	// last manifest referencing it is gone without rescanning the store,
+	// and Load recomputes an object's digest and returns ErrChecksumMismatch
+	// if it no longer matches the manifest. Use MigrateObjectsToSharded to
+	// upgrade a store written before sharding/refcounts existed.
+	ContentAddressed bool
+
+	// SigningKey enables Presign and the presign-validating HTTP handler
+	// returned by NewHTTPHandler. Presign returns an error if this is
+	// unset; callers that never presign URLs can leave it empty.
+	SigningKey []byte
+
+	// InlineThresholdBytes is the payload size at or above which Save
+	// stores a version as "{version}.bin" plus a "{version}.meta.json"
+	// sidecar (mime type, size, digest) instead of embedding it in a JSON
+	// envelope, matching the layout SaveStream always uses. Defaults to
+	// DefaultInlineThresholdBytes if zero. Compression and ContentAddressed
+	// only apply to versions under the threshold; large payloads are
+	// written to disk as-is so Save never has to buffer a compressed or
+	// hashed copy of a multi-gigabyte part in memory.
+	InlineThresholdBytes int64
+
+	// MaxBytesPerSession, MaxBytesPerUser, and GlobalMaxBytes cap the total
+	// size of stored artifact versions within, respectively, a single
+	// (appName, userID, sessionID), a single (appName, userID) across all
+	// its sessions, and the entire store. Zero means unlimited. When a
+	// Save would exceed one of these, FilesystemService first evicts whole
+	// artifacts (every version of a fileName) within the exceeded scope in
+	// least-recently-loaded order — see Usage — and only returns
+	// ErrQuotaExceeded if that still isn't enough to make the write fit.
+	MaxBytesPerSession int64
+	MaxBytesPerUser    int64
+	GlobalMaxBytes     int64
+
+	// MaxVersionsPerFile caps how many versions of a single artifact Save
+	// keeps; once a write pushes a fileName past this count, the oldest
+	// version(s) are pruned immediately afterward. Zero means unlimited.
+	MaxVersionsPerFile int
+
+	// CompactionInterval, if nonzero, starts a background goroutine that
+	// re-checks every configured quota scope (MaxBytesPerSession,
+	// MaxBytesPerUser, GlobalMaxBytes) on this interval and evicts
+	// least-recently-loaded artifacts in any scope that's over its limit,
+	// the same way Save does inline. This lets a store that's already over
+	// a newly lowered limit (or one that only ever receives SaveStream
+	// calls for scopes a caller never Saves into directly) get reclaimed
+	// without waiting for the next write to trigger it. Zero disables
+	// background compaction; quota enforcement still happens inline on
+	// every Save/SaveStream. Call Close to stop it.
+	CompactionInterval time.Duration
 }
 
 // NewFilesystemService creates a new filesystem-backed artifact service.
@@ -63,9 +156,44 @@ func NewFilesystemService(cfg FilesystemServiceConfig) (*FilesystemService, erro
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 
-	return &FilesystemService{
-		basePath: cfg.BasePath,
-	}, nil
+	s := &FilesystemService{
+		basePath:             cfg.BasePath,
+		compression:          cfg.Compression,
+		contentAddressed:     cfg.ContentAddressed,
+		signingKey:           cfg.SigningKey,
+		inlineThresholdBytes: cfg.InlineThresholdBytes,
+		maxBytesPerSession:   cfg.MaxBytesPerSession,
+		maxBytesPerUser:      cfg.MaxBytesPerUser,
+		globalMaxBytes:       cfg.GlobalMaxBytes,
+		maxVersionsPerFile:   cfg.MaxVersionsPerFile,
+	}
+
+	if cfg.CompactionInterval > 0 {
+		s.startCompaction(cfg.CompactionInterval)
+	}
+
+	return s, nil
+}
+
+// Close stops the background compaction goroutine started by a nonzero
+// CompactionInterval, if one is running. It's a no-op otherwise.
+func (s *FilesystemService) Close() error {
+	if s.compactionCancel != nil {
+		s.compactionCancel()
+		<-s.compactionDone
+	}
+	return nil
+}
+
+// DefaultInlineThresholdBytes is the InlineThresholdBytes Save applies when
+// FilesystemServiceConfig.InlineThresholdBytes is zero.
+const DefaultInlineThresholdBytes = 1 << 20 // 1 MiB
+
+func (s *FilesystemService) inlineThreshold() int64 {
+	if s.inlineThresholdBytes > 0 {
+		return s.inlineThresholdBytes
+	}
+	return DefaultInlineThresholdBytes
 }
 
 func (s *FilesystemService) artifactDir(appName, userID, sessionID, fileName string) string {
@@ -83,76 +211,587 @@ func (s *FilesystemService) sessionDir(appName, userID, sessionID string) string
 	return filepath.Join(s.basePath, appName, userID, sessionID)
 }
 
+// binPath is the streamed payload for a version saved at or above the inline
+// threshold, whether by Save or SaveStream.
+func (s *FilesystemService) binPath(dir string, version int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.bin", version))
+}
+
+// metaPath is the sidecar recording a .bin version's mime type, size, and
+// digest, since that metadata isn't embedded in the raw payload the way the
+// JSON envelope carries it inline.
+func (s *FilesystemService) metaPath(dir string, version int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.meta.json", version))
+}
+
+// streamMeta is the on-disk shape of a .meta.json sidecar.
+type streamMeta struct {
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"`
+}
+
+func (s *FilesystemService) writeStreamMeta(dir string, version int64, mimeType string, size int64, digest string) error {
+	data, err := json.Marshal(streamMeta{MimeType: mimeType, Size: size, Digest: digest})
+	if err != nil {
+		return fmt.Errorf("failed to marshal artifact metadata: %w", err)
+	}
+	if err := writeFileAtomic(s.metaPath(dir, version), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write artifact metadata: %w", err)
+	}
+	return nil
+}
+
+func (s *FilesystemService) readStreamMeta(dir string, version int64) (*streamMeta, error) {
+	data, err := os.ReadFile(s.metaPath(dir, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact metadata: %w", err)
+	}
+	var meta streamMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal artifact metadata: %w", err)
+	}
+	return &meta, nil
+}
+
 func fileHasUserNamespace(filename string) bool {
 	return strings.HasPrefix(filename, "user:")
 }
 
+// lockFileName is the advisory lock file kept inside each artifact directory
+// (and, for content-addressed objects, alongside each blob) to serialize
+// access across processes. It is a permanent fixture of the directory it
+// protects, not something callers clean up.
+const lockFileName = ".lock"
+
+func (s *FilesystemService) lockPath(dir string) string {
+	return filepath.Join(dir, lockFileName)
+}
+
+// withDirLock runs fn while holding an advisory lock on dir's lock file,
+// shared for readers or exclusive for writers. If dir doesn't exist yet,
+// fn runs unlocked so callers see the same "not found" errors they would
+// without locking, instead of a lock file conjuring the directory into
+// existence.
+func (s *FilesystemService) withDirLock(dir string, exclusive bool, fn func() error) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fn()
+	}
+
+	open := lockedfile.OpenShared
+	if exclusive {
+		open = lockedfile.OpenExclusive
+	}
+
+	lf, err := open(s.lockPath(dir))
+	if err != nil {
+		return fmt.Errorf("failed to lock artifact directory: %w", err)
+	}
+	defer lf.Close()
+
+	return fn()
+}
+
+func (s *FilesystemService) objectLockPath(hash string) string {
+	return s.objectPath(hash) + ".lock"
+}
+
+// withObjectLock serializes access to a single content-addressed object
+// (its blob and refcount sidecar) across every artifact directory that may
+// reference it, since that pair lives outside any one artifact directory
+// and so isn't covered by withDirLock.
+func (s *FilesystemService) withObjectLock(hash string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(s.objectPath(hash)), 0o755); err != nil {
+		return fmt.Errorf("failed to create objects directory: %w", err)
+	}
+
+	lf, err := lockedfile.OpenExclusive(s.objectLockPath(hash))
+	if err != nil {
+		return fmt.Errorf("failed to lock object %s: %w", hash, err)
+	}
+	defer lf.Close()
+
+	return fn()
+}
+
+// writeFileAtomic writes data to path via a temporary file and rename, so a
+// reader never observes a partially written file at path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
 // Save implements artifact.Service.
 func (s *FilesystemService) Save(_ context.Context, req *artifact.SaveRequest) (*artifact.SaveResponse, error) {
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
 	}
 
+	lf, err := lockedfile.OpenExclusive(s.lockPath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock artifact directory: %w", err)
+	}
+	defer lf.Close()
+
 	nextVersion := int64(1)
 	if latest, err := s.latestVersion(dir); err == nil {
 		nextVersion = latest + 1
 	}
 
-	data, err := json.Marshal(req.Part)
+	payload, mimeType := partBytes(req.Part)
+
+	if int64(len(payload)) >= s.inlineThreshold() {
+		if err := s.enforceQuotas(req.AppName, req.UserID, req.SessionID, req.FileName, dir, int64(len(payload))); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(s.binPath(dir, nextVersion), payload, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write artifact: %w", err)
+		}
+		sum := sha256.Sum256(payload)
+		if err := s.writeStreamMeta(dir, nextVersion, mimeType, int64(len(payload)), hex.EncodeToString(sum[:])); err != nil {
+			return nil, err
+		}
+		if s.maxVersionsPerFile > 0 {
+			if err := s.pruneOldVersions(dir, s.maxVersionsPerFile); err != nil {
+				return nil, err
+			}
+		}
+		return &artifact.SaveResponse{Version: nextVersion}, nil
+	}
+
+	partData, err := json.Marshal(req.Part)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal artifact: %w", err)
 	}
 
+	// buildEnvelope is called before enforceQuotas so the quota check can
+	// compare against the envelope's true on-disk size rather than the raw
+	// (pre-JSON, pre-compression) payload size. In ContentAddressed mode
+	// this means the blob may already be written and its refcount bumped
+	// by the time enforceQuotas rejects the save; the object is then
+	// orphaned rather than cleaned up, a known tradeoff of checking quotas
+	// against an exact size instead of an estimate.
+	envelope, err := s.buildEnvelope(partData, partMimeType(req.Part))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode artifact: %w", err)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	if err := s.enforceQuotas(req.AppName, req.UserID, req.SessionID, req.FileName, dir, int64(len(data))); err != nil {
+		return nil, err
+	}
+
 	path := s.versionPath(req.AppName, req.UserID, req.SessionID, req.FileName, nextVersion)
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
 		return nil, fmt.Errorf("failed to write artifact: %w", err)
 	}
 
+	if s.maxVersionsPerFile > 0 {
+		if err := s.pruneOldVersions(dir, s.maxVersionsPerFile); err != nil {
+			return nil, err
+		}
+	}
+
 	return &artifact.SaveResponse{Version: nextVersion}, nil
 }
 
+// buildEnvelope compresses partData (if configured) and, in content-addressed
+// mode, writes it under objects/<hash[:2]>/<hash[2:]> instead of embedding it
+// inline.
+func (s *FilesystemService) buildEnvelope(partData []byte, mimeType string) (*artifactEnvelope, error) {
+	compressed, err := compress(s.compression, partData)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &artifactEnvelope{
+		Format:       envelopeFormat,
+		Compression:  s.compression,
+		OriginalSize: len(partData),
+	}
+
+	if !s.contentAddressed {
+		envelope.Data = compressed
+		return envelope, nil
+	}
+
+	hash := sha256.Sum256(partData)
+	hexHash := hex.EncodeToString(hash[:])
+	if err := s.writeObject(hexHash, compressed); err != nil {
+		return nil, err
+	}
+	envelope.ContentHash = hexHash
+	envelope.MimeType = mimeType
+	envelope.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	return envelope, nil
+}
+
+// partMimeType returns the MIME type of part's inline data, or "" for parts
+// (e.g. plain text) that don't carry one.
+func partMimeType(part *genai.Part) string {
+	if part == nil || part.InlineData == nil {
+		return ""
+	}
+	return part.InlineData.MIMEType
+}
+
+// objectShardLen is the number of leading hex digits of a content hash used
+// as the first-level shard directory (e.g. "ab/cdef..."), keeping any single
+// objects directory from accumulating one entry per distinct blob in the
+// whole store.
+const objectShardLen = 2
+
+func (s *FilesystemService) objectPath(hash string) string {
+	if len(hash) <= objectShardLen {
+		return filepath.Join(s.basePath, objectsDirName, hash)
+	}
+	return filepath.Join(s.basePath, objectsDirName, hash[:objectShardLen], hash[objectShardLen:])
+}
+
+// refcountPath is the reference-count sidecar for a content-addressed blob,
+// tracking how many manifests currently point at it so gcObjects can tell
+// when the last one has been removed without rescanning the whole store.
+func (s *FilesystemService) refcountPath(hash string) string {
+	return s.objectPath(hash) + ".refcount"
+}
+
+func (s *FilesystemService) readRefcount(hash string) int {
+	data, err := os.ReadFile(s.refcountPath(hash))
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func (s *FilesystemService) writeRefcount(hash string, n int) error {
+	if err := writeFileAtomic(s.refcountPath(hash), []byte(strconv.Itoa(n)), 0o644); err != nil {
+		return fmt.Errorf("failed to write refcount for object %s: %w", hash, err)
+	}
+	return nil
+}
+
+// writeObject stores a content-addressed blob and bumps its refcount.
+// Identical bytes hash identically, so an existing object's data is already
+// correct and is left untouched; only the refcount moves. The object lock
+// serializes this against concurrent writers and gcObjects, since the same
+// hash can be referenced from many different artifact directories at once.
+func (s *FilesystemService) writeObject(hash string, data []byte) error {
+	return s.withObjectLock(hash, func() error {
+		path := s.objectPath(hash)
+		if _, err := os.Stat(path); err == nil {
+			return s.writeRefcount(hash, s.readRefcount(hash)+1)
+		}
+		if err := writeFileAtomic(path, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write object: %w", err)
+		}
+		return s.writeRefcount(hash, 1)
+	})
+}
+
 // Load implements artifact.Service.
 func (s *FilesystemService) Load(_ context.Context, req *artifact.LoadRequest) (*artifact.LoadResponse, error) {
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
 
-	version := req.Version
-	if version <= 0 {
-		dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
-		latest, err := s.latestVersion(dir)
+	var part genai.Part
+	err := s.withDirLock(dir, false, func() error {
+		version := req.Version
+		if version <= 0 {
+			latest, err := s.latestVersion(dir)
+			if err != nil {
+				return fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			}
+			version = latest
+		}
+
+		path := s.versionPath(req.AppName, req.UserID, req.SessionID, req.FileName, version)
+		data, err := os.ReadFile(path)
 		if err != nil {
-			return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			if os.IsNotExist(err) {
+				return s.loadBinaryVersion(dir, version, &part)
+			}
+			return fmt.Errorf("failed to read artifact: %w", err)
 		}
-		version = latest
+
+		partData, err := s.decodeEnvelope(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode artifact: %w", err)
+		}
+
+		if err := json.Unmarshal(partData, &part); err != nil {
+			return fmt.Errorf("failed to unmarshal artifact: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	path := s.versionPath(req.AppName, req.UserID, req.SessionID, req.FileName, version)
-	data, err := os.ReadFile(path)
+	s.touchAccess(req.AppName, req.UserID, req.SessionID, req.FileName)
+
+	return &artifact.LoadResponse{Part: &part}, nil
+}
+
+// touchAccess records fileName as just-loaded in its session directory's
+// index.json, for evictLRU to consult later. Best-effort: a failure here
+// (e.g. the directory was removed concurrently) doesn't fail the Load it's
+// tracking.
+func (s *FilesystemService) touchAccess(appName, userID, sessionID, fileName string) {
+	sessionDir := s.sessionDir(appName, userID, effectiveSessionID(sessionID, fileName))
+	_ = s.withDirLock(sessionDir, true, func() error {
+		return s.touchSessionIndex(sessionDir, fileName)
+	})
+}
+
+// ErrChecksumMismatch is returned by Load when a content-addressed blob's
+// bytes no longer hash to the digest recorded in its manifest — the object
+// on disk was corrupted or tampered with after Save wrote it.
+var ErrChecksumMismatch = errors.New("filesystem: content hash mismatch, object is corrupted")
+
+// decodeEnvelope returns the marshaled genai.Part JSON for a stored blob.
+// It supports both the structured envelope (compression / content
+// addressing) and the legacy format where the file held a bare marshaled
+// genai.Part, so blobs saved before either feature existed still load. In
+// content-addressed mode, the blob's digest is recomputed and checked
+// against the manifest's ContentHash before it's returned.
+func (s *FilesystemService) decodeEnvelope(data []byte) ([]byte, error) {
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Format != envelopeFormat {
+		return data, nil
+	}
+
+	if envelope.ContentHash == "" {
+		return decompress(envelope.Compression, envelope.Data)
+	}
+
+	objData, err := os.ReadFile(s.objectPath(envelope.ContentHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", envelope.ContentHash, err)
+	}
+
+	partData, err := decompress(envelope.Compression, objData)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(partData)
+	if hex.EncodeToString(sum[:]) != envelope.ContentHash {
+		return nil, fmt.Errorf("%w: object %s", ErrChecksumMismatch, envelope.ContentHash)
+	}
+
+	return partData, nil
+}
+
+// loadBinaryVersion fills part from the ".bin"/".meta.json" form Save (above
+// the inline threshold) and SaveStream write, for the versionPath ".json"
+// file Load tries first doesn't exist.
+func (s *FilesystemService) loadBinaryVersion(dir string, version int64, part *genai.Part) error {
+	data, err := os.ReadFile(s.binPath(dir, version))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			return fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
 		}
-		return nil, fmt.Errorf("failed to read artifact: %w", err)
+		return fmt.Errorf("failed to read artifact: %w", err)
 	}
 
-	var part genai.Part
-	if err := json.Unmarshal(data, &part); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal artifact: %w", err)
+	meta, err := s.readStreamMeta(dir, version)
+	if err != nil {
+		return err
 	}
 
-	return &artifact.LoadResponse{Part: &part}, nil
+	*part = genai.Part{InlineData: &genai.Blob{MIMEType: meta.MimeType, Data: data}}
+	return nil
+}
+
+// StreamSaveRequest identifies the artifact SaveStream writes to. It mirrors
+// artifact.SaveRequest but carries a MimeType instead of a genai.Part, since
+// SaveStream takes its payload as an io.Reader so neither the caller nor
+// FilesystemService ever has to hold the whole artifact in memory at once.
+type StreamSaveRequest struct {
+	AppName, UserID, SessionID, FileName string
+
+	// MimeType is recorded in the version's metadata sidecar and returned
+	// by a later LoadStream; it isn't inspected or validated here.
+	MimeType string
+}
+
+func (req *StreamSaveRequest) validate() error {
+	if req.AppName == "" || req.UserID == "" || req.SessionID == "" || req.FileName == "" {
+		return fmt.Errorf("AppName, UserID, SessionID, and FileName are required")
+	}
+	return nil
+}
+
+// StreamMetadata is the sidecar information LoadStream returns alongside an
+// artifact version's payload reader.
+type StreamMetadata struct {
+	MimeType string
+	Size     int64
+	Digest   string
+}
+
+// SaveStream is a streaming counterpart to Save for large payloads: it
+// copies directly from r to "{version}.bin" (plus a "{version}.meta.json"
+// sidecar recording mime type, size, and digest) without ever buffering the
+// full payload in memory, unlike Save's genai.Part/JSON path. It isn't part
+// of artifact.Service, which has no streaming equivalent of SaveRequest;
+// callers that need it use the concrete *FilesystemService, the same way
+// Presign is reached.
+func (s *FilesystemService) SaveStream(_ context.Context, req *StreamSaveRequest, r io.Reader) (*artifact.SaveResponse, error) {
+	if err := req.validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	lf, err := lockedfile.OpenExclusive(s.lockPath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock artifact directory: %w", err)
+	}
+	defer lf.Close()
+
+	nextVersion := int64(1)
+	if latest, err := s.latestVersion(dir); err == nil {
+		nextVersion = latest + 1
+	}
+
+	size, digest, err := s.writeBinaryStream(dir, nextVersion, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeStreamMeta(dir, nextVersion, req.MimeType, size, digest); err != nil {
+		return nil, err
+	}
+
+	// Unlike Save, the payload size here isn't known until the whole stream
+	// has been written, so quotas are enforced after the fact instead of
+	// before: the new version is already on disk and counted in current
+	// usage, so enforceQuotas is asked for zero additional bytes. If it
+	// still doesn't fit once LRU eviction has run, it's removed again
+	// rather than left in place over quota.
+	if err := s.enforceQuotas(req.AppName, req.UserID, req.SessionID, req.FileName, dir, 0); err != nil {
+		os.Remove(s.binPath(dir, nextVersion))
+		os.Remove(s.metaPath(dir, nextVersion))
+		return nil, err
+	}
+
+	if s.maxVersionsPerFile > 0 {
+		if err := s.pruneOldVersions(dir, s.maxVersionsPerFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return &artifact.SaveResponse{Version: nextVersion}, nil
+}
+
+// writeBinaryStream copies r to "{version}.bin" via a temporary file and
+// rename, returning the payload's size and SHA-256 digest computed in the
+// same pass so the caller never has to re-read the file to learn them.
+func (s *FilesystemService) writeBinaryStream(dir string, version int64, r io.Reader) (size int64, digest string, err error) {
+	path := s.binPath(dir, version)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create artifact file: %w", err)
+	}
+
+	hasher := sha256.New()
+	n, copyErr := io.Copy(f, io.TeeReader(r, hasher))
+	closeErr := f.Close()
+	if copyErr != nil {
+		os.Remove(tmp)
+		return 0, "", fmt.Errorf("failed to write artifact: %w", copyErr)
+	}
+	if closeErr != nil {
+		os.Remove(tmp)
+		return 0, "", fmt.Errorf("failed to write artifact: %w", closeErr)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, "", fmt.Errorf("failed to write artifact: %w", err)
+	}
+
+	return n, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// LoadStream is a streaming counterpart to Load for large payloads: it
+// returns an io.ReadCloser over "{version}.bin" directly instead of
+// buffering the whole payload into a genai.Part the way Load does. The
+// directory lock is held only long enough to open the file and read its
+// metadata sidecar, not for the lifetime of the returned reader — the same
+// Windows-friendly tradeoff Delete makes elsewhere in this file.
+func (s *FilesystemService) LoadStream(_ context.Context, req *artifact.LoadRequest) (io.ReadCloser, *StreamMetadata, error) {
+	if err := req.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+
+	var (
+		f    *os.File
+		meta *streamMeta
+	)
+	err := s.withDirLock(dir, false, func() error {
+		version := req.Version
+		if version <= 0 {
+			latest, err := s.latestVersion(dir)
+			if err != nil {
+				return fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			}
+			version = latest
+		}
+
+		var openErr error
+		f, openErr = os.Open(s.binPath(dir, version))
+		if openErr != nil {
+			if os.IsNotExist(openErr) {
+				return fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			}
+			return fmt.Errorf("failed to open artifact: %w", openErr)
+		}
+
+		var metaErr error
+		meta, metaErr = s.readStreamMeta(dir, version)
+		if metaErr != nil {
+			f.Close()
+			return metaErr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.touchAccess(req.AppName, req.UserID, req.SessionID, req.FileName)
+
+	return f, &StreamMetadata{MimeType: meta.MimeType, Size: meta.Size, Digest: meta.Digest}, nil
 }
 
 // Delete implements artifact.Service.
@@ -161,35 +800,110 @@ func (s *FilesystemService) Delete(_ context.Context, req *artifact.DeleteReques
 		return fmt.Errorf("request validation failed: %w", err)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+
+	// A single version's files are removed while the directory lock is
+	// held. For a whole-artifact delete, the lock is released before the
+	// RemoveAll below (rather than held across it) because Windows generally
+	// refuses to delete a file that's still open/locked, and the lock file
+	// itself goes with the directory; the brief unlocked window this leaves
+	// is an accepted tradeoff.
 
 	if req.Version != 0 {
 		path := s.versionPath(req.AppName, req.UserID, req.SessionID, req.FileName, req.Version)
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to delete artifact version: %w", err)
+		binPath := s.binPath(dir, req.Version)
+		metaPath := s.metaPath(dir, req.Version)
+		var hashes []string
+		removeErr := s.withDirLock(dir, true, func() error {
+			hashes = s.manifestHashes(path)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete artifact version: %w", err)
+			}
+			if err := os.Remove(binPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete artifact version: %w", err)
+			}
+			if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete artifact version: %w", err)
+			}
+			return nil
+		})
+		if removeErr != nil {
+			return removeErr
 		}
-		s.cleanEmptyDirs(s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName))
+		s.cleanEmptyDirs(dir)
+		s.gcObjects(hashes)
 		return nil
 	}
 
-	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	var hashes []string
+	if err := s.withDirLock(dir, true, func() error {
+		hashes = s.collectDirHashes(dir)
+		return nil
+	}); err != nil {
+		return err
+	}
 	if err := os.RemoveAll(dir); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete artifact: %w", err)
 	}
+	s.gcObjects(hashes)
 
 	return nil
 }
 
+// manifestHashes returns the content hash referenced by a single version
+// manifest, or nil if the file doesn't exist, isn't an envelope, or isn't
+// content-addressed.
+func (s *FilesystemService) manifestHashes(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.ContentHash == "" {
+		return nil
+	}
+	return []string{envelope.ContentHash}
+}
+
+// collectDirHashes walks a directory of version manifests and returns every
+// content hash they reference, before the directory is removed.
+func (s *FilesystemService) collectDirHashes(dir string) []string {
+	var hashes []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		hashes = append(hashes, s.manifestHashes(path)...)
+		return nil
+	})
+	return hashes
+}
+
+// gcObjects decrements the refcount of every hash a just-removed manifest
+// referenced, deleting an object (and its refcount sidecar) once its count
+// reaches zero. Using the persisted refcount instead of rescanning the
+// store for remaining references keeps Delete's cost proportional to the
+// manifest being removed, not to the store's total size.
+func (s *FilesystemService) gcObjects(hashes []string) {
+	for _, hash := range hashes {
+		s.withObjectLock(hash, func() error {
+			remaining := s.readRefcount(hash) - 1
+			if remaining <= 0 {
+				os.Remove(s.objectPath(hash))
+				os.Remove(s.refcountPath(hash))
+				return nil
+			}
+			return s.writeRefcount(hash, remaining)
+		})
+	}
+}
+
 // List implements artifact.Service.
 func (s *FilesystemService) List(_ context.Context, req *artifact.ListRequest) (*artifact.ListResponse, error) {
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	files := make(map[string]bool)
 
 	s.collectArtifactNames(s.sessionDir(req.AppName, req.UserID, req.SessionID), files)
@@ -211,13 +925,19 @@ func (s *FilesystemService) Versions(_ context.Context, req *artifact.VersionsRe
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
-	versions, err := s.listVersions(dir)
-	if err != nil || len(versions) == 0 {
-		return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+
+	var versions []int64
+	err := s.withDirLock(dir, false, func() error {
+		var err error
+		versions, err = s.listVersions(dir)
+		if err != nil || len(versions) == 0 {
+			return fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &artifact.VersionsResponse{Versions: versions}, nil
@@ -237,20 +957,27 @@ func (s *FilesystemService) listVersions(dir string) ([]int64, error) {
 		return nil, err
 	}
 
+	seen := make(map[int64]bool)
 	var versions []int64
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 		name := entry.Name()
-		if !strings.HasSuffix(name, ".json") {
+		var numStr string
+		switch {
+		case strings.HasSuffix(name, ".json"):
+			numStr = strings.TrimSuffix(name, ".json")
+		case strings.HasSuffix(name, ".bin"):
+			numStr = strings.TrimSuffix(name, ".bin")
+		default:
 			continue
 		}
-		numStr := strings.TrimSuffix(name, ".json")
 		v, err := strconv.ParseInt(numStr, 10, 64)
-		if err != nil {
+		if err != nil || seen[v] {
 			continue
 		}
+		seen[v] = true
 		versions = append(versions, v)
 	}
 
@@ -271,27 +998,39 @@ func (s *FilesystemService) collectArtifactNames(sessionDir string, files map[st
 			continue
 		}
 		versionDir := filepath.Join(sessionDir, entry.Name())
-		vEntries, err := os.ReadDir(versionDir)
-		if err != nil {
-			continue
-		}
-		for _, ve := range vEntries {
-			if !ve.IsDir() && strings.HasSuffix(ve.Name(), ".json") {
-				files[entry.Name()] = true
-				break
+		_ = s.withDirLock(versionDir, false, func() error {
+			vEntries, err := os.ReadDir(versionDir)
+			if err != nil {
+				return nil
 			}
-		}
+			for _, ve := range vEntries {
+				if ve.IsDir() {
+					continue
+				}
+				if strings.HasSuffix(ve.Name(), ".json") || strings.HasSuffix(ve.Name(), ".bin") {
+					files[entry.Name()] = true
+					break
+				}
+			}
+			return nil
+		})
 	}
 }
 
+// cleanEmptyDirs removes dir once it holds nothing but versions that have
+// all been deleted. The directory's own lock file doesn't count as content:
+// it's a bookkeeping fixture, not an artifact.
 func (s *FilesystemService) cleanEmptyDirs(dir string) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return
 	}
-	if len(entries) == 0 {
-		os.Remove(dir)
+	for _, entry := range entries {
+		if entry.Name() != lockFileName {
+			return
+		}
 	}
+	os.RemoveAll(dir)
 }
 
 var _ artifact.Service = (*FilesystemService)(nil)
@@ -0,0 +1,111 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MigrateObjectsToSharded rewrites a content-addressed store created before
+// sharded object directories and refcount sidecars existed: every blob
+// previously written flat at "<basePath>/objects/<hash>" is moved to
+// "<basePath>/objects/<hash[:2]>/<hash[2:]>", and a ".refcount" sidecar is
+// (re)computed for every object by counting how many manifests under
+// basePath still reference it.
+//
+// Safe to run more than once and against a store that's already sharded —
+// entries already under a shard directory are left alone, and refcounts are
+// always recomputed from the manifests on disk rather than incremented.
+func MigrateObjectsToSharded(basePath string) error {
+	objectsDir := filepath.Join(basePath, objectsDirName)
+	entries, err := os.ReadDir(objectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read objects directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || len(entry.Name()) <= objectShardLen {
+			continue
+		}
+		hash := entry.Name()
+		shardDir := filepath.Join(objectsDir, hash[:objectShardLen])
+		if err := os.MkdirAll(shardDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create shard directory for object %s: %w", hash, err)
+		}
+		if err := os.Rename(filepath.Join(objectsDir, hash), filepath.Join(shardDir, hash[objectShardLen:])); err != nil {
+			return fmt.Errorf("failed to move object %s into its shard: %w", hash, err)
+		}
+	}
+
+	refcounts, err := countManifestReferences(basePath)
+	if err != nil {
+		return fmt.Errorf("failed to count manifest references: %w", err)
+	}
+
+	svc := &FilesystemService{basePath: basePath}
+	for hash, count := range refcounts {
+		if err := svc.writeRefcount(hash, count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countManifestReferences walks every version manifest under basePath
+// (skipping the objects directory itself) and tallies how many times each
+// content hash is referenced.
+func countManifestReferences(basePath string) (map[string]int, error) {
+	objectsDir := filepath.Join(basePath, objectsDirName)
+	counts := make(map[string]int)
+
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == objectsDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var envelope artifactEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil || envelope.ContentHash == "" {
+			return nil
+		}
+		counts[envelope.ContentHash]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
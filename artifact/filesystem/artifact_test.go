@@ -16,6 +16,14 @@ package filesystem
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"google.golang.org/adk/artifact"
@@ -430,3 +438,393 @@ func TestSessionIsolation(t *testing.T) {
 		}
 	}
 }
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, algo := range []Compression{None, Gzip, Zstd} {
+		dir := t.TempDir()
+		svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, Compression: algo})
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+		ctx := context.Background()
+
+		_, err = svc.Save(ctx, &artifact.SaveRequest{
+			AppName:   "app1",
+			UserID:    "user1",
+			SessionID: "sess1",
+			FileName:  "big.txt",
+			Part:      genai.NewPartFromText(strings.Repeat("hello world ", 200)),
+		})
+		if err != nil {
+			t.Fatalf("save failed for %q: %v", algo, err)
+		}
+
+		loadResp, err := svc.Load(ctx, &artifact.LoadRequest{
+			AppName:   "app1",
+			UserID:    "user1",
+			SessionID: "sess1",
+			FileName:  "big.txt",
+		})
+		if err != nil {
+			t.Fatalf("load failed for %q: %v", algo, err)
+		}
+		if loadResp.Part.Text != strings.Repeat("hello world ", 200) {
+			t.Fatalf("round-tripped content mismatch for %q", algo)
+		}
+	}
+}
+
+func TestLoadLegacyUncompressedBlob(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	_, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName:   "app1",
+		UserID:    "user1",
+		SessionID: "sess1",
+		FileName:  "legacy.txt",
+		Part:      genai.NewPartFromText("pre-envelope blob"),
+	})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// Overwrite the stored version with the pre-envelope format (a bare
+	// marshaled genai.Part) to simulate a blob saved before this feature.
+	path := svc.versionPath("app1", "user1", "sess1", "legacy.txt", 1)
+	legacy, err := json.Marshal(genai.NewPartFromText("pre-envelope blob"))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if err := os.WriteFile(path, legacy, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{
+		AppName:   "app1",
+		UserID:    "user1",
+		SessionID: "sess1",
+		FileName:  "legacy.txt",
+	})
+	if err != nil {
+		t.Fatalf("load of legacy blob failed: %v", err)
+	}
+	if loadResp.Part.Text != "pre-envelope blob" {
+		t.Fatalf("unexpected content: %q", loadResp.Part.Text)
+	}
+}
+
+// countObjectBlobs walks the sharded objects directory and counts the blob
+// files themselves, excluding their ".refcount" and ".lock" sidecars.
+func countObjectBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	objectsDir := filepath.Join(dir, objectsDirName)
+	n := 0
+	err := filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && !strings.HasSuffix(path, ".refcount") && !strings.HasSuffix(path, ".lock") {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk objects dir: %v", err)
+	}
+	return n
+}
+
+func TestContentAddressedDedupAndRefcount(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	save := func(sessionID, fileName string) {
+		t.Helper()
+		_, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName:   "app1",
+			UserID:    "user1",
+			SessionID: sessionID,
+			FileName:  fileName,
+			Part:      genai.NewPartFromText("shared payload"),
+		})
+		if err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	save("sess1", "a.txt")
+	save("sess1", "a.txt") // second version, identical bytes
+	save("sess2", "b.txt")
+
+	if n := countObjectBlobs(t, dir); n != 1 {
+		t.Fatalf("expected exactly 1 shared object, got %d", n)
+	}
+
+	// Deleting one reference must not remove the shared object.
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess2", FileName: "b.txt",
+	}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if n := countObjectBlobs(t, dir); n != 1 {
+		t.Fatalf("object should survive while sess1 still references it, got %d entries", n)
+	}
+
+	// Deleting the last reference must garbage-collect the object.
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "a.txt",
+	}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if n := countObjectBlobs(t, dir); n != 0 {
+		t.Fatalf("expected object to be garbage-collected, got %d entries", n)
+	}
+}
+
+func TestContentAddressedObjectPathIsSharded(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "a.txt",
+		Part: genai.NewPartFromText("sharded payload"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	manifestData, err := os.ReadFile(svc.versionPath("app1", "user1", "sess1", "a.txt", 1))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(manifestData, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	if envelope.ContentHash == "" {
+		t.Fatal("expected a content hash in the manifest")
+	}
+
+	shardDir := filepath.Join(dir, objectsDirName, envelope.ContentHash[:objectShardLen])
+	entries, err := os.ReadDir(shardDir)
+	if err != nil {
+		t.Fatalf("expected a two-level shard directory, got error reading it: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("expected the shard directory to contain the blob and its refcount sidecar")
+	}
+}
+
+func TestContentAddressedLoadDetectsChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "a.txt",
+		Part: genai.NewPartFromText("trustworthy payload"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	manifestData, err := os.ReadFile(svc.versionPath("app1", "user1", "sess1", "a.txt", 1))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(manifestData, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+
+	if err := os.WriteFile(svc.objectPath(envelope.ContentHash), []byte("corrupted bytes"), 0o644); err != nil {
+		t.Fatalf("failed to corrupt object: %v", err)
+	}
+
+	_, err = svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "a.txt"})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Load error = %v, want errors.Is(err, ErrChecksumMismatch)", err)
+	}
+}
+
+func TestMigrateObjectsToSharded(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	save := func(sessionID, fileName string) {
+		t.Helper()
+		_, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: sessionID, FileName: fileName,
+			Part: genai.NewPartFromText("payload predating sharding"),
+		})
+		if err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	save("sess1", "a.txt")
+	save("sess2", "b.txt") // identical bytes, second reference
+
+	manifestData, err := os.ReadFile(svc.versionPath("app1", "user1", "sess1", "a.txt", 1))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(manifestData, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+
+	// Simulate a pre-sharding store: flatten the blob back to
+	// "objects/<hash>" and drop its refcount sidecar.
+	shardedPath := svc.objectPath(envelope.ContentHash)
+	flatPath := filepath.Join(dir, objectsDirName, envelope.ContentHash)
+	blob, err := os.ReadFile(shardedPath)
+	if err != nil {
+		t.Fatalf("failed to read sharded object: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Dir(shardedPath)); err != nil {
+		t.Fatalf("failed to remove shard directory: %v", err)
+	}
+	if err := os.WriteFile(flatPath, blob, 0o644); err != nil {
+		t.Fatalf("failed to write flat object: %v", err)
+	}
+
+	if err := MigrateObjectsToSharded(dir); err != nil {
+		t.Fatalf("MigrateObjectsToSharded error: %v", err)
+	}
+
+	if _, err := os.Stat(flatPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the flat object to be moved, stat err = %v", err)
+	}
+	if n := countObjectBlobs(t, dir); n != 1 {
+		t.Fatalf("expected exactly 1 object after migration, got %d", n)
+	}
+	if got := svc.readRefcount(envelope.ContentHash); got != 2 {
+		t.Errorf("refcount after migration = %d, want 2 (a.txt and b.txt both reference it)", got)
+	}
+
+	// Load must still resolve the object (and verify its checksum) through
+	// its new sharded path after migration.
+	if _, err := svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "a.txt"}); err != nil {
+		t.Fatalf("Load after migration failed: %v", err)
+	}
+}
+
+// TestConcurrentSavesProduceSequentialVersions exercises the directory lock
+// Save takes around its read-latest-then-write critical section: without
+// it, two concurrent Saves can both observe the same "latest version" and
+// clobber each other.
+func TestConcurrentSavesProduceSequentialVersions(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.Save(ctx, &artifact.SaveRequest{
+				AppName:   "app1",
+				UserID:    "user1",
+				SessionID: "sess1",
+				FileName:  "concurrent.txt",
+				Part:      genai.NewPartFromText("revision"),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+	}
+
+	versionsResp, err := svc.Versions(ctx, &artifact.VersionsRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "concurrent.txt",
+	})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(versionsResp.Versions) != n {
+		t.Fatalf("expected %d distinct versions, got %d: %v", n, len(versionsResp.Versions), versionsResp.Versions)
+	}
+	seen := make(map[int64]bool)
+	for _, v := range versionsResp.Versions {
+		if seen[v] {
+			t.Fatalf("version %d was written more than once", v)
+		}
+		seen[v] = true
+	}
+}
+
+// TestConcurrentContentAddressedSavesKeepRefcountAccurate exercises the
+// object lock writeObject/gcObjects take: concurrent Saves of identical
+// bytes must converge on exactly one blob with a refcount matching the
+// number of manifests that reference it.
+func TestConcurrentContentAddressedSavesKeepRefcountAccurate(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.Save(ctx, &artifact.SaveRequest{
+				AppName:   "app1",
+				UserID:    "user1",
+				SessionID: fmt.Sprintf("sess%d", i),
+				FileName:  "shared.txt",
+				Part:      genai.NewPartFromText("identical payload"),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+	}
+
+	if got := countObjectBlobs(t, dir); got != 1 {
+		t.Fatalf("expected exactly 1 shared object, got %d", got)
+	}
+
+	manifestData, err := os.ReadFile(svc.versionPath("app1", "user1", "sess0", "shared.txt", 1))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var envelope artifactEnvelope
+	if err := json.Unmarshal(manifestData, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	if got := svc.readRefcount(envelope.ContentHash); got != n {
+		t.Fatalf("refcount = %d, want %d", got, n)
+	}
+}
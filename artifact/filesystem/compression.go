@@ -0,0 +1,124 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the algorithm used to compress artifact payloads
+// before they are written to disk.
+type Compression string
+
+const (
+	// None disables compression. Payloads are stored as-is.
+	None Compression = ""
+	// Gzip compresses payloads with compress/gzip.
+	Gzip Compression = "gzip"
+	// Zstd compresses payloads with zstandard, which trades a larger
+	// dependency for a better ratio/speed tradeoff than gzip.
+	Zstd Compression = "zstd"
+)
+
+// envelopeFormat marks a version file as using the structured envelope
+// introduced alongside compression/content-addressing, as opposed to the
+// legacy format where the file held a bare marshaled genai.Part.
+const envelopeFormat = "adk-artifact-v1"
+
+// artifactEnvelope is the on-disk representation of a saved artifact version
+// once compression or content-addressing is in play. Legacy blobs (saved
+// before this envelope existed) are plain marshaled genai.Part JSON and have
+// no "format" field, so Load distinguishes the two by checking Format.
+type artifactEnvelope struct {
+	Format       string      `json:"format"`
+	Compression  Compression `json:"compression,omitempty"`
+	OriginalSize int         `json:"original_size,omitempty"`
+	// ContentHash is set in content-addressed mode: Data is empty and the
+	// real payload lives under "<basepath>/objects/<ContentHash[:2]>/<ContentHash[2:]>".
+	ContentHash string `json:"content_hash,omitempty"`
+	// MimeType and CreatedAt are recorded alongside ContentHash so the
+	// manifest alone (without reading the referenced blob) answers basic
+	// questions about a content-addressed artifact.
+	MimeType  string `json:"mime_type,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	// Data holds the (possibly compressed) marshaled genai.Part when the
+	// artifact is not content-addressed.
+	Data []byte `json:"data,omitempty"`
+}
+
+// compress compresses data with the given algorithm. None returns data
+// unchanged.
+func compress(algo Compression, data []byte) ([]byte, error) {
+	switch algo {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip compress: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("gzip compress: %w", err)
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd compress: %w", err)
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %q", algo)
+	}
+}
+
+// decompress reverses compress. None returns data unchanged.
+func decompress(algo Compression, data []byte) ([]byte, error) {
+	switch algo {
+	case None, "":
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip decompress: %w", err)
+		}
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip decompress: %w", err)
+		}
+		return out, nil
+	case Zstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decompress: %w", err)
+		}
+		defer dec.Close()
+		out, err := dec.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decompress: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %q", algo)
+	}
+}
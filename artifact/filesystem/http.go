@@ -0,0 +1,154 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+
+	"github.com/achetronic/adk-utils-go/artifact/filesystem/presign"
+)
+
+// HTTPHandlerConfig configures NewHTTPHandler.
+type HTTPHandlerConfig struct {
+	// MaxBodyBytes caps the size of an uploaded payload. Zero means
+	// unlimited.
+	MaxBodyBytes int64
+}
+
+// NewHTTPHandler returns an http.Handler serving the download/upload side
+// of presigned URLs minted by svc.Presign: GET validates a Download token
+// and streams the artifact version's payload back; PUT validates an Upload
+// token, reads the request body (capped at cfg.MaxBodyBytes), and saves it
+// as the artifact's next version. Both sides go through svc.Load/svc.Save,
+// so compression, content-addressing, and locking all apply exactly as
+// they do to direct Load/Save callers — only the genai.Part JSON
+// round-trip is skipped.
+func NewHTTPHandler(svc *FilesystemService, cfg HTTPHandlerConfig) http.Handler {
+	return &presignHandler{svc: svc, maxBodyBytes: cfg.MaxBodyBytes}
+}
+
+type presignHandler struct {
+	svc          *FilesystemService
+	maxBodyBytes int64
+}
+
+func (h *presignHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var op presign.Operation
+	switch r.Method {
+	case http.MethodGet:
+		op = presign.Download
+	case http.MethodPut:
+		op = presign.Upload
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	resource := query.Get("resource")
+	token := query.Get("token")
+	expUnix, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid exp", http.StatusBadRequest)
+		return
+	}
+	exp := time.Unix(expUnix, 0)
+
+	if err := presign.Verify(h.svc.signingKey, resource, op, exp, token, time.Now()); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, presign.ErrExpired) {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	switch op {
+	case presign.Download:
+		h.serveDownload(w, r.Context(), resource)
+	case presign.Upload:
+		h.serveUpload(w, r, resource)
+	}
+}
+
+func (h *presignHandler) serveDownload(w http.ResponseWriter, ctx context.Context, resource string) {
+	appName, userID, sessionID, fileName, version, ok := parseVersionResource(resource)
+	if !ok {
+		http.Error(w, "invalid resource", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.svc.Load(ctx, &artifact.LoadRequest{
+		AppName: appName, UserID: userID, SessionID: sessionID, FileName: fileName, Version: version,
+	})
+	if err != nil {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+
+	data, mimeType := partBytes(resp.Part)
+	if mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Write(data)
+}
+
+func (h *presignHandler) serveUpload(w http.ResponseWriter, r *http.Request, resource string) {
+	appName, userID, sessionID, fileName, ok := parseArtifactResource(resource)
+	if !ok {
+		http.Error(w, "invalid resource", http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	if h.maxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, body, h.maxBodyBytes)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp, err := h.svc.Save(r.Context(), &artifact.SaveRequest{
+		AppName: appName, UserID: userID, SessionID: sessionID, FileName: fileName,
+		Part: &genai.Part{InlineData: &genai.Blob{MIMEType: r.Header.Get("Content-Type"), Data: data}},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to save artifact: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Artifact-Version", strconv.FormatInt(resp.Version, 10))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// partBytes returns a part's raw payload and MIME type, for streaming over
+// HTTP without the genai.Part JSON envelope Load/Save otherwise use.
+func partBytes(part *genai.Part) (data []byte, mimeType string) {
+	if part.InlineData != nil {
+		return part.InlineData.Data, part.InlineData.MIMEType
+	}
+	return []byte(part.Text), "text/plain; charset=utf-8"
+}
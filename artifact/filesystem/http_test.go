@@ -0,0 +1,210 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+
+	"github.com/achetronic/adk-utils-go/artifact/filesystem/presign"
+)
+
+func newSigningTestService(t *testing.T) *FilesystemService {
+	t.Helper()
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, SigningKey: []byte("test-signing-key")})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return svc
+}
+
+func presignedURL(resp *PresignResponse) string {
+	return fmt.Sprintf("http://presigned?resource=%s&exp=%d&token=%s", resp.Resource, resp.Expires.Unix(), resp.Token)
+}
+
+func TestPresignRequiresSigningKey(t *testing.T) {
+	svc := newTestService(t) // no SigningKey configured
+	_, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Operation: presign.Download,
+	})
+	if err == nil {
+		t.Fatal("expected error without a configured SigningKey")
+	}
+}
+
+func TestHTTPHandlerDownload(t *testing.T) {
+	svc := newSigningTestService(t)
+	ctx := context.Background()
+
+	binaryData := []byte{0x89, 0x50, 0x4E, 0x47}
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "image.png",
+		Part: &genai.Part{InlineData: &genai.Blob{MIMEType: "image/png", Data: binaryData}},
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "image.png", Operation: presign.Download,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{})
+	req := httptest.NewRequest(http.MethodGet, presignedURL(presignResp), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("expected image/png, got %q", got)
+	}
+	if rec.Body.String() != string(binaryData) {
+		t.Fatalf("unexpected body: %v", rec.Body.Bytes())
+	}
+}
+
+func TestHTTPHandlerUpload(t *testing.T) {
+	svc := newSigningTestService(t)
+	ctx := context.Background()
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "note.txt", Operation: presign.Upload,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{})
+	req := httptest.NewRequest(http.MethodPut, presignedURL(presignResp), strings.NewReader("uploaded via presign"))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Artifact-Version") != "1" {
+		t.Fatalf("expected version 1, got %q", rec.Header().Get("X-Artifact-Version"))
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "note.txt"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loadResp.Part.InlineData == nil || string(loadResp.Part.InlineData.Data) != "uploaded via presign" {
+		t.Fatalf("unexpected loaded part: %+v", loadResp.Part)
+	}
+}
+
+func TestHTTPHandlerUploadTooLarge(t *testing.T) {
+	svc := newSigningTestService(t)
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "note.txt", Operation: presign.Upload,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{MaxBodyBytes: 4})
+	req := httptest.NewRequest(http.MethodPut, presignedURL(presignResp), strings.NewReader("this body is far too long"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHTTPHandlerRejectsTamperedToken(t *testing.T) {
+	svc := newSigningTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+		Part: genai.NewPartFromText("secret"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Operation: presign.Download,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+	presignResp.Token = "tampered-token"
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{})
+	req := httptest.NewRequest(http.MethodGet, presignedURL(presignResp), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestHTTPHandlerRejectsUploadTokenForDownload(t *testing.T) {
+	svc := newSigningTestService(t)
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Operation: presign.Upload,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{})
+	req := httptest.NewRequest(http.MethodGet, presignedURL(presignResp), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestHTTPHandlerRejectsUnsupportedMethod(t *testing.T) {
+	svc := newSigningTestService(t)
+
+	presignResp, err := svc.Presign(&PresignRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Operation: presign.Download,
+	})
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	handler := NewHTTPHandler(svc, HTTPHandlerConfig{})
+	req := httptest.NewRequest(http.MethodDelete, presignedURL(presignResp), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
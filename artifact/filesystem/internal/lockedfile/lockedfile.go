@@ -0,0 +1,74 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lockedfile provides advisory, OS-level file locks, modeled on the
+// approach the Go toolchain's module cache (cmd/go/internal/lockedfile)
+// uses so multiple processes can share one on-disk cache directory safely:
+// a small lock file per critical section, held shared by readers and
+// exclusive by writers. Unlike a sync.RWMutex, the lock is visible to (and
+// honored by) every process on the machine, not just goroutines within one,
+// which is what lets several agent workers or sidecars mount the same
+// artifact store concurrently.
+package lockedfile
+
+import (
+	"fmt"
+	"os"
+)
+
+// File is an *os.File held under an advisory lock for its lifetime.
+type File struct {
+	f *os.File
+}
+
+// OpenShared opens (creating if necessary) the file at name and takes a
+// shared lock on it, blocking until acquired. Any number of callers —
+// across processes — may hold a shared lock on the same file at once; it
+// excludes only exclusive lockers.
+func OpenShared(name string) (*File, error) {
+	return open(name, false)
+}
+
+// OpenExclusive opens (creating if necessary) the file at name and takes an
+// exclusive lock on it, blocking until acquired. At most one caller, in one
+// process, may hold an exclusive lock on a given file at a time, and it
+// excludes shared lockers too.
+func OpenExclusive(name string) (*File, error) {
+	return open(name, true)
+}
+
+func open(name string, exclusive bool) (*File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("lockedfile: open %s: %w", name, err)
+	}
+	if err := lock(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lockedfile: lock %s: %w", name, err)
+	}
+	return &File{f: f}, nil
+}
+
+// Close releases the lock and closes the underlying file. The lock file
+// itself is left on disk — like the rest of this package's locks, it's a
+// permanent fixture of the directory it protects, not something callers
+// clean up after each use.
+func (lf *File) Close() error {
+	unlockErr := unlock(lf.f)
+	closeErr := lf.f.Close()
+	if unlockErr != nil {
+		return unlockErr
+	}
+	return closeErr
+}
@@ -0,0 +1,37 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build plan9
+
+package lockedfile
+
+import "os"
+
+// lock sets the exclusive-use bit on f for exclusive locks. Plan 9 has no
+// separate primitive for shared locks, so shared requests are a no-op: they
+// rely on exclusive lockers to exclude them instead.
+func lock(f *os.File, exclusive bool) error {
+	if !exclusive {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return f.Chmod(info.Mode() | os.ModeExclusive)
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package lockedfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockfileExclusiveLock is LOCKFILE_EXCLUSIVE_LOCK from the Win32 API: set
+// to request an exclusive lock from LockFileEx, unset for a shared lock.
+const lockfileExclusiveLock = 0x2
+
+// lock takes a LockFileEx advisory lock on f, blocking until it's available.
+func lock(f *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+	return syscall.LockFileEx(syscall.Handle(f.Fd()), flags, 0, 1, 0, new(syscall.Overlapped))
+}
+
+func unlock(f *os.File) error {
+	return syscall.UnlockFileEx(syscall.Handle(f.Fd()), 0, 1, 0, new(syscall.Overlapped))
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/achetronic/adk-utils-go/artifact/filesystem/presign"
+)
+
+// DefaultPresignTTL is the TTL Presign applies when PresignRequest.TTL is
+// zero.
+const DefaultPresignTTL = 15 * time.Minute
+
+// PresignRequest identifies the artifact version a presigned URL should
+// authorize an Operation against.
+type PresignRequest struct {
+	AppName, UserID, SessionID, FileName string
+
+	// Version is the version to presign a download for, or 0 for
+	// whichever is latest at presign time. Ignored for Upload, which
+	// always targets the next version at request time instead.
+	Version int64
+
+	Operation presign.Operation
+
+	// TTL is how long the presigned URL stays valid. Defaults to
+	// DefaultPresignTTL if zero.
+	TTL time.Duration
+}
+
+// PresignResponse carries the pieces a caller assembles into a presigned
+// URL against wherever NewHTTPHandler is mounted: FilesystemService itself
+// has no notion of its own public address, so it hands back the resource
+// identifier, signature, and expiry as separate query-parameter values
+// rather than a complete URL.
+type PresignResponse struct {
+	// Resource identifies the artifact (Upload) or artifact version
+	// (Download) the token authorizes; pass it back verbatim as the
+	// "resource" query parameter.
+	Resource string
+	// Token is the HMAC signature; pass it back as the "token" query
+	// parameter.
+	Token string
+	// Expires is when the token stops validating; pass its Unix timestamp
+	// back as the "exp" query parameter.
+	Expires time.Time
+}
+
+// Presign mints a presigned download or upload URL's resource/token/expiry
+// for an artifact. Requires FilesystemServiceConfig.SigningKey to be set.
+func (s *FilesystemService) Presign(req *PresignRequest) (*PresignResponse, error) {
+	if len(s.signingKey) == 0 {
+		return nil, fmt.Errorf("filesystem: Presign requires FilesystemServiceConfig.SigningKey")
+	}
+
+	var resource string
+	switch req.Operation {
+	case presign.Download:
+		version := req.Version
+		if version <= 0 {
+			dir := s.artifactDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+			latest, err := s.latestVersion(dir)
+			if err != nil {
+				return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+			}
+			version = latest
+		}
+		resource = s.versionResource(req.AppName, req.UserID, req.SessionID, req.FileName, version)
+	case presign.Upload:
+		resource = s.artifactResource(req.AppName, req.UserID, req.SessionID, req.FileName)
+	default:
+		return nil, fmt.Errorf("filesystem: unknown presign operation %q", req.Operation)
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = DefaultPresignTTL
+	}
+	exp := time.Now().Add(ttl)
+
+	token, err := presign.Sign(s.signingKey, resource, req.Operation, exp)
+	if err != nil {
+		return nil, fmt.Errorf("filesystem: failed to sign presigned url: %w", err)
+	}
+
+	return &PresignResponse{Resource: resource, Token: token, Expires: exp}, nil
+}
+
+// artifactResource identifies an artifact (all versions) for an Upload
+// presign, which always writes the next version rather than a fixed one.
+// It encodes the caller's original SessionID, not the "user" session key
+// fileHasUserNamespace artifacts are actually stored under — artifactDir
+// re-derives that redirection itself from FileName on every Save/Load, so
+// encoding it twice here would be redundant, not more correct.
+func (s *FilesystemService) artifactResource(appName, userID, sessionID, fileName string) string {
+	return strings.Join([]string{appName, userID, sessionID, fileName}, "/")
+}
+
+// versionResource identifies a single artifact version for a Download
+// presign.
+func (s *FilesystemService) versionResource(appName, userID, sessionID, fileName string, version int64) string {
+	return s.artifactResource(appName, userID, sessionID, fileName) + "/" + strconv.FormatInt(version, 10)
+}
+
+// parseArtifactResource splits a resource string produced by
+// artifactResource back into its components.
+func parseArtifactResource(resource string) (appName, userID, sessionID, fileName string, ok bool) {
+	parts := strings.SplitN(resource, "/", 4)
+	if len(parts) != 4 {
+		return "", "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], parts[3], true
+}
+
+// parseVersionResource splits a resource string produced by
+// versionResource back into its components.
+func parseVersionResource(resource string) (appName, userID, sessionID, fileName string, version int64, ok bool) {
+	idx := strings.LastIndex(resource, "/")
+	if idx < 0 {
+		return "", "", "", "", 0, false
+	}
+	version, err := strconv.ParseInt(resource[idx+1:], 10, 64)
+	if err != nil {
+		return "", "", "", "", 0, false
+	}
+	appName, userID, sessionID, fileName, ok = parseArtifactResource(resource[:idx])
+	return appName, userID, sessionID, fileName, version, ok
+}
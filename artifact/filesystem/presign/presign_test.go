@@ -0,0 +1,143 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package presign
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("test-signing-key")
+
+func TestSignAndVerifyRoundTrip(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify(testKey, "app1/user1/sess1/file.txt/1", Download, exp, token, now); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(-time.Second)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify(testKey, "app1/user1/sess1/file.txt/1", Download, exp, token, now); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+}
+
+func TestVerifyTamperedResource(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify(testKey, "app1/user1/sess1/file.txt/2", Download, exp, token, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerifyTamperedOperation(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify(testKey, "app1/user1/sess1/file.txt/1", Upload, exp, token, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerifyTamperedExpiry(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	laterExp := exp.Add(time.Hour)
+	if err := Verify(testKey, "app1/user1/sess1/file.txt/1", Download, laterExp, token, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify([]byte("a different key"), "app1/user1/sess1/file.txt/1", Download, exp, token, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestSignRejectsPathTraversal(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	cases := []string{
+		"",
+		"/app1/user1/sess1/file.txt/1",
+		"app1/../../../etc/passwd",
+		"app1/user1/../../sess1/file.txt/1",
+		"app1//user1/sess1/file.txt/1",
+	}
+	for _, resource := range cases {
+		if _, err := Sign(testKey, resource, Download, exp); !errors.Is(err, ErrInvalidResource) {
+			t.Errorf("Sign(%q): expected ErrInvalidResource, got %v", resource, err)
+		}
+	}
+}
+
+func TestVerifyRejectsPathTraversal(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	exp := now.Add(15 * time.Minute)
+
+	// A token signed for a legitimate resource must not validate a request
+	// that substitutes a traversal attempt for that resource, even before
+	// the signature comparison runs.
+	token, err := Sign(testKey, "app1/user1/sess1/file.txt/1", Download, exp)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if err := Verify(testKey, "../../../etc/passwd", Download, exp, token, now); !errors.Is(err, ErrInvalidResource) {
+		t.Fatalf("expected ErrInvalidResource, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by Save when writing a version would push a
+// configured quota scope (session, user, or global) over its limit and
+// evicting least-recently-loaded artifacts in that scope still can't make
+// the write fit. It isn't a field of artifact.SaveResponse, since extending
+// that type would mean modifying the external artifact.Service dependency;
+// callers check for it with errors.Is the same way they already check for
+// ErrChecksumMismatch.
+var ErrQuotaExceeded = errors.New("filesystem: quota exceeded")
+
+// indexFileName is the per-session access-time index quota eviction uses to
+// pick the least-recently-loaded artifact. Like lockFileName, it's a
+// permanent bookkeeping fixture of the directory it lives in.
+const indexFileName = "index.json"
+
+func (s *FilesystemService) indexPath(sessionDir string) string {
+	return filepath.Join(sessionDir, indexFileName)
+}
+
+// sessionIndex is the on-disk shape of a session directory's index.json: the
+// last time each fileName under it was Load'd or LoadStream'd, keyed by
+// fileName.
+type sessionIndex struct {
+	LastAccess map[string]time.Time `json:"lastAccess"`
+}
+
+func (s *FilesystemService) readSessionIndex(sessionDir string) *sessionIndex {
+	idx := &sessionIndex{LastAccess: map[string]time.Time{}}
+	data, err := os.ReadFile(s.indexPath(sessionDir))
+	if err != nil {
+		return idx
+	}
+	if err := json.Unmarshal(data, idx); err != nil || idx.LastAccess == nil {
+		return &sessionIndex{LastAccess: map[string]time.Time{}}
+	}
+	return idx
+}
+
+// touchSessionIndex records fileName as accessed now in sessionDir's
+// index.json. Called from Load/LoadStream while sessionDir's lock is held,
+// best-effort: a failure here shouldn't fail the read it's tracking.
+func (s *FilesystemService) touchSessionIndex(sessionDir, fileName string) error {
+	idx := s.readSessionIndex(sessionDir)
+	idx.LastAccess[fileName] = time.Now().UTC()
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.indexPath(sessionDir), data, 0o644)
+}
+
+// effectiveSessionID is the directory segment an artifact named fileName is
+// actually stored under, accounting for the "user:" namespace redirection
+// artifactDir applies. Quota/index bookkeeping needs this to find the right
+// session directory independent of an artifactDir call.
+func effectiveSessionID(sessionID, fileName string) string {
+	if fileHasUserNamespace(fileName) {
+		return userScopedArtifactKey
+	}
+	return sessionID
+}
+
+// UsageScope identifies the directory Usage reports on: the narrowest of
+// SessionID, UserID, or AppName that's set, or the whole store if none are.
+type UsageScope struct {
+	AppName, UserID, SessionID string
+}
+
+// Usage reports the total size, in bytes, of every artifact version stored
+// under scope. It isn't part of artifact.Service, which has no notion of
+// quota scopes; callers reach it through the concrete *FilesystemService.
+func (s *FilesystemService) Usage(_ context.Context, scope UsageScope) (*Usage, error) {
+	bytes, err := sizeOfDir(s.scopeDir(scope))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to compute usage: %w", err)
+	}
+	return &Usage{Bytes: bytes}, nil
+}
+
+// Usage is the result of a Usage call.
+type Usage struct {
+	Bytes int64
+}
+
+func (s *FilesystemService) scopeDir(scope UsageScope) string {
+	switch {
+	case scope.SessionID != "":
+		return s.sessionDir(scope.AppName, scope.UserID, scope.SessionID)
+	case scope.UserID != "":
+		return filepath.Join(s.basePath, scope.AppName, scope.UserID)
+	case scope.AppName != "":
+		return filepath.Join(s.basePath, scope.AppName)
+	default:
+		return s.basePath
+	}
+}
+
+// sizeOfDir sums the on-disk size of every version file (".json" or ".bin")
+// under dir, ignoring lock files, index/refcount sidecars, and ".meta.json"
+// sidecars (whose size is accounted for by the ".bin" they describe).
+func sizeOfDir(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isVersionFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+func isVersionFile(name string) bool {
+	if name == indexFileName || strings.HasSuffix(name, ".meta.json") {
+		return false
+	}
+	return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".bin")
+}
+
+// enforceQuotas checks every configured quota scope (session, then user,
+// then global) that a write of incomingSize bytes for (appName, userID,
+// sessionID, fileName) would affect, evicting least-recently-loaded
+// artifacts within whichever scope it would otherwise exceed. excludeDir
+// (the artifact directory Save is about to write into) is never itself
+// evicted, so a multi-version artifact can't be deleted out from under the
+// very Save call that's adding to it.
+func (s *FilesystemService) enforceQuotas(appName, userID, sessionID, fileName, excludeDir string, incomingSize int64) error {
+	sid := effectiveSessionID(sessionID, fileName)
+
+	scopes := []struct {
+		dir   string
+		limit int64
+	}{
+		{s.sessionDir(appName, userID, sid), s.maxBytesPerSession},
+		{filepath.Join(s.basePath, appName, userID), s.maxBytesPerUser},
+		{s.basePath, s.globalMaxBytes},
+	}
+
+	for _, scope := range scopes {
+		if scope.limit <= 0 {
+			continue
+		}
+
+		used, err := sizeOfDir(scope.dir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to compute quota usage: %w", err)
+		}
+		if used+incomingSize <= scope.limit {
+			continue
+		}
+
+		need := used + incomingSize - scope.limit
+		freed, err := s.evictLRU(scope.dir, excludeDir, need)
+		if err != nil {
+			return err
+		}
+		if used+incomingSize-freed > scope.limit {
+			return fmt.Errorf("%w: %s", ErrQuotaExceeded, scope.dir)
+		}
+	}
+
+	return nil
+}
+
+// artifactCandidate is one fileName directory (i.e. every version of one
+// artifact) considered for LRU eviction.
+type artifactCandidate struct {
+	dir        string
+	lastAccess time.Time
+	size       int64
+}
+
+// collectArtifactCandidates walks everything under scopeDir and returns one
+// candidate per fileName directory (a directory directly containing ".json"
+// or ".bin" version files), with its total size and last-Load time — read
+// from its parent session directory's index.json, defaulting to the zero
+// time for an artifact that's never been loaded, so never-loaded artifacts
+// are evicted first.
+func (s *FilesystemService) collectArtifactCandidates(scopeDir, excludeDir string) []artifactCandidate {
+	var candidates []artifactCandidate
+	filepath.WalkDir(scopeDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == excludeDir {
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil
+		}
+
+		var size int64
+		hasVersions := false
+		for _, e := range entries {
+			if e.IsDir() || !isVersionFile(e.Name()) {
+				continue
+			}
+			hasVersions = true
+			if info, err := e.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		if !hasVersions {
+			return nil
+		}
+
+		sessionDir := filepath.Dir(path)
+		fileName := filepath.Base(path)
+		idx := s.readSessionIndex(sessionDir)
+		candidates = append(candidates, artifactCandidate{
+			dir:        path,
+			lastAccess: idx.LastAccess[fileName],
+			size:       size,
+		})
+		return nil
+	})
+	return candidates
+}
+
+// evictLRU deletes whole artifacts (every version of a fileName) under
+// scopeDir in least-recently-loaded order, excluding excludeDir, until at
+// least need bytes have been freed or there's nothing left to evict. It
+// re-scans scopeDir after each eviction rather than sorting once up front,
+// since the candidate list built before the first eviction is already stale
+// once a directory has been removed.
+//
+// Like Delete, it takes victim.dir's advisory lock to collect the hashes to
+// garbage-collect, releases it, and only then removes the directory — the
+// lock is held across the read so a concurrent Save/SaveStream can't be
+// caught mid-write (e.g. between its nextVersion read and its
+// writeFileAtomic), and released before the removal for the same
+// Windows-can't-delete-a-locked-file reason Delete documents.
+func (s *FilesystemService) evictLRU(scopeDir, excludeDir string, need int64) (int64, error) {
+	var freed int64
+	for freed < need {
+		candidates := s.collectArtifactCandidates(scopeDir, excludeDir)
+		if len(candidates) == 0 {
+			break
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].lastAccess.Before(candidates[j].lastAccess)
+		})
+
+		victim := candidates[0]
+		var hashes []string
+		if err := s.withDirLock(victim.dir, true, func() error {
+			hashes = s.collectDirHashes(victim.dir)
+			return nil
+		}); err != nil {
+			return freed, fmt.Errorf("failed to lock artifact for eviction: %w", err)
+		}
+		if err := os.RemoveAll(victim.dir); err != nil && !os.IsNotExist(err) {
+			return freed, fmt.Errorf("failed to evict artifact for quota: %w", err)
+		}
+		s.gcObjects(hashes)
+		freed += victim.size
+	}
+	return freed, nil
+}
+
+// startCompaction runs compactOnce every interval until Close cancels it.
+// Unlike enforceQuotas, which only ever looks at the scopes one particular
+// Save/SaveStream call touches, compactOnce sweeps every session and user
+// directory under basePath, so a scope nothing has written to recently
+// (e.g. after its limit was lowered) still gets reclaimed.
+func (s *FilesystemService) startCompaction(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.compactionCancel = cancel
+	s.compactionDone = make(chan struct{})
+
+	go func() {
+		defer close(s.compactionDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.compactOnce()
+			}
+		}
+	}()
+}
+
+// compactOnce enforces GlobalMaxBytes against the whole store, then
+// MaxBytesPerUser against every (appName, userID) directory it finds, then
+// MaxBytesPerSession against every session directory, evicting
+// least-recently-loaded artifacts in any scope that's over its limit.
+// Errors are swallowed the same way touchAccess's are: compaction is a
+// best-effort background reclaim, not something a caller is waiting on.
+func (s *FilesystemService) compactOnce() {
+	s.compactScope(s.basePath, s.globalMaxBytes)
+
+	if s.maxBytesPerUser <= 0 && s.maxBytesPerSession <= 0 {
+		return
+	}
+
+	userDirs := s.listSubdirs(s.listAppDirs()...)
+	if s.maxBytesPerUser > 0 {
+		for _, dir := range userDirs {
+			s.compactScope(dir, s.maxBytesPerUser)
+		}
+	}
+
+	if s.maxBytesPerSession > 0 {
+		for _, sessionDir := range s.listSubdirs(userDirs...) {
+			s.compactScope(sessionDir, s.maxBytesPerSession)
+		}
+	}
+}
+
+// listAppDirs returns the immediate subdirectories of basePath that hold
+// per-app artifact data, excluding objectsDirName (the content-addressed
+// blob store, which sits alongside them under basePath but isn't itself a
+// quota scope).
+func (s *FilesystemService) listAppDirs() []string {
+	var out []string
+	for _, dir := range s.listSubdirs(s.basePath) {
+		if filepath.Base(dir) != objectsDirName {
+			out = append(out, dir)
+		}
+	}
+	return out
+}
+
+// compactScope evicts least-recently-loaded artifacts under dir until its
+// usage fits within limit, or there's nothing left to evict. A zero limit
+// or an unreadable/missing dir is a no-op.
+func (s *FilesystemService) compactScope(dir string, limit int64) {
+	if limit <= 0 {
+		return
+	}
+	used, err := sizeOfDir(dir)
+	if err != nil || used <= limit {
+		return
+	}
+	s.evictLRU(dir, "", used-limit)
+}
+
+// listSubdirs returns the immediate subdirectories of every directory in
+// dirs, skipping anything unreadable (e.g. a directory that doesn't exist).
+func (s *FilesystemService) listSubdirs(dirs ...string) []string {
+	var out []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				out = append(out, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return out
+}
+
+// pruneOldVersions deletes the oldest versions of the artifact at dir once
+// it holds more than max, keeping the max most recent. Called after Save
+// writes a new version, while dir's lock is still held.
+func (s *FilesystemService) pruneOldVersions(dir string, max int) error {
+	versions, err := s.listVersions(dir) // newest first
+	if err != nil || len(versions) <= max {
+		return nil
+	}
+
+	for _, v := range versions[max:] {
+		jsonPath := filepath.Join(dir, fmt.Sprintf("%d.json", v))
+		hashes := s.manifestHashes(jsonPath)
+		os.Remove(jsonPath)
+		os.Remove(s.binPath(dir, v))
+		os.Remove(s.metaPath(dir, v))
+		s.gcObjects(hashes)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+func TestMaxVersionsPerFilePrunesOldest(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, MaxVersionsPerFile: 2})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+			Part: genai.NewPartFromText("v"),
+		}); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	versionsResp, err := svc.Versions(ctx, &artifact.VersionsRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt"})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(versionsResp.Versions) != 2 {
+		t.Fatalf("expected 2 versions kept, got %v", versionsResp.Versions)
+	}
+	if versionsResp.Versions[0] != 3 || versionsResp.Versions[1] != 2 {
+		t.Fatalf("expected versions [3 2] kept, got %v", versionsResp.Versions)
+	}
+}
+
+func TestSessionQuotaEvictsLeastRecentlyLoaded(t *testing.T) {
+	ctx := context.Background()
+
+	// Calibrate the quota against one real saved artifact's on-disk size
+	// (envelope overhead included) instead of guessing it, so the test
+	// doesn't depend on exactly how many bytes the JSON envelope adds.
+	probe := newTestService(t)
+	if _, err := probe.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "probe.txt",
+		Part: genai.NewPartFromText("12345"),
+	}); err != nil {
+		t.Fatalf("probe save failed: %v", err)
+	}
+	probeUsage, err := probe.Usage(ctx, UsageScope{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("probe usage failed: %v", err)
+	}
+	perFile := probeUsage.Bytes
+
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, MaxBytesPerSession: perFile*2 + perFile/2})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	save := func(fileName, text string) {
+		if _, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: fileName,
+			Part: genai.NewPartFromText(text),
+		}); err != nil {
+			t.Fatalf("save %s failed: %v", fileName, err)
+		}
+	}
+
+	save("old.txt", "12345")
+	// Loading old.txt marks it more recently used than a file that's never
+	// been loaded, so a later eviction should prefer to evict new.txt once
+	// it, in turn, falls out of favor relative to something newer still.
+	if _, err := svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "old.txt"}); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	save("new.txt", "12345")
+
+	listResp, err := svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(listResp.FileNames) != 2 {
+		t.Fatalf("expected both files to fit under quota, got %v", listResp.FileNames)
+	}
+
+	// A third save pushes total usage over the calibrated quota; old.txt
+	// was loaded most recently, so new.txt (never loaded since) should be
+	// evicted to make room.
+	save("newest.txt", "12345")
+
+	listResp, err = svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	found := map[string]bool{}
+	for _, name := range listResp.FileNames {
+		found[name] = true
+	}
+	if !found["old.txt"] || !found["newest.txt"] {
+		t.Fatalf("expected old.txt and newest.txt to survive, got %v", listResp.FileNames)
+	}
+	if found["new.txt"] {
+		t.Fatalf("expected new.txt to be evicted, got %v", listResp.FileNames)
+	}
+}
+
+func TestQuotaExceededWhenNothingLeftToEvict(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, MaxBytesPerSession: 1})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err = svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+		Part: genai.NewPartFromText("far too big for the quota"),
+	})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestBackgroundCompactionEvictsOverLimitScope(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Write two files unconstrained, so the session ends up over a limit
+	// set only once CompactionInterval is configured below — the scenario
+	// CompactionInterval exists for: a scope that's already over a newly
+	// lowered limit, with no Save call of its own to trigger inline
+	// enforcement.
+	seed, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	for _, fileName := range []string{"old.txt", "new.txt"} {
+		if _, err := seed.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: fileName,
+			Part: genai.NewPartFromText("12345"),
+		}); err != nil {
+			t.Fatalf("save %s failed: %v", fileName, err)
+		}
+	}
+	if _, err := seed.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "old.txt"}); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	usage, err := seed.Usage(ctx, UsageScope{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+
+	svc, err := NewFilesystemService(FilesystemServiceConfig{
+		BasePath:           dir,
+		MaxBytesPerSession: usage.Bytes - 1,
+		CompactionInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	defer svc.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		listResp, err := svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(listResp.FileNames) == 1 && listResp.FileNames[0] == "old.txt" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected new.txt to be compacted away, got %v", listResp.FileNames)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUsageReportsScopedSize(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+		Part: genai.NewPartFromText("12345"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	usage, err := svc.Usage(ctx, UsageScope{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+	if usage.Bytes <= 0 {
+		t.Fatalf("expected nonzero usage, got %d", usage.Bytes)
+	}
+
+	empty, err := svc.Usage(ctx, UsageScope{AppName: "app1", UserID: "user1", SessionID: "sess2"})
+	if err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+	if empty.Bytes != 0 {
+		t.Fatalf("expected zero usage for unused session, got %d", empty.Bytes)
+	}
+}
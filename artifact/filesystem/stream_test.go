@@ -0,0 +1,163 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+func TestSaveStreamAndLoadStreamRoundTrip(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	payload := strings.Repeat("streamed bytes ", 1000)
+	saveResp, err := svc.SaveStream(ctx, &StreamSaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin", MimeType: "application/octet-stream",
+	}, strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("save stream failed: %v", err)
+	}
+	if saveResp.Version != 1 {
+		t.Fatalf("expected version 1, got %d", saveResp.Version)
+	}
+
+	r, meta, err := svc.LoadStream(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin"})
+	if err != nil {
+		t.Fatalf("load stream failed: %v", err)
+	}
+	defer r.Close()
+
+	if meta.MimeType != "application/octet-stream" {
+		t.Errorf("expected mime type application/octet-stream, got %q", meta.MimeType)
+	}
+	if meta.Size != int64(len(payload)) {
+		t.Errorf("expected size %d, got %d", len(payload), meta.Size)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if string(got) != payload {
+		t.Fatalf("round-tripped payload mismatch")
+	}
+}
+
+func TestSaveStreamVersionsListAndDelete(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.SaveStream(ctx, &StreamSaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin", MimeType: "application/octet-stream",
+		}, strings.NewReader("v")); err != nil {
+			t.Fatalf("save stream failed: %v", err)
+		}
+	}
+
+	versionsResp, err := svc.Versions(ctx, &artifact.VersionsRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin"})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(versionsResp.Versions) != 3 {
+		t.Fatalf("expected 3 versions, got %v", versionsResp.Versions)
+	}
+
+	listResp, err := svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(listResp.FileNames) != 1 || listResp.FileNames[0] != "big.bin" {
+		t.Fatalf("expected [big.bin], got %v", listResp.FileNames)
+	}
+
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin", Version: 2}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	versionsResp, err = svc.Versions(ctx, &artifact.VersionsRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin"})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(versionsResp.Versions) != 2 {
+		t.Fatalf("expected 2 versions after delete, got %v", versionsResp.Versions)
+	}
+
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "big.bin"}); err != nil {
+		t.Fatalf("delete all failed: %v", err)
+	}
+	listResp, err = svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(listResp.FileNames) != 0 {
+		t.Fatalf("expected no files after delete all, got %v", listResp.FileNames)
+	}
+}
+
+func TestSaveRoutesLargePayloadsToBinaryForm(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := NewFilesystemService(FilesystemServiceConfig{BasePath: dir, InlineThresholdBytes: 16})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	large := bytes.Repeat([]byte("x"), 64)
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.bin",
+		Part: &genai.Part{InlineData: &genai.Blob{MIMEType: "application/octet-stream", Data: large}},
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.bin"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loadResp.Part.InlineData == nil || !bytes.Equal(loadResp.Part.InlineData.Data, large) {
+		t.Fatalf("unexpected loaded part: %+v", loadResp.Part)
+	}
+
+	// A small payload under the same threshold should still take the JSON path.
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "small.txt",
+		Part: genai.NewPartFromText("tiny"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	loadResp, err = svc.Load(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "small.txt"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loadResp.Part.Text != "tiny" {
+		t.Fatalf("expected tiny, got %+v", loadResp.Part)
+	}
+}
+
+func TestLoadStreamNotFound(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, _, err := svc.LoadStream(ctx, &artifact.LoadRequest{AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "missing.bin"}); err == nil {
+		t.Fatal("expected error for missing artifact")
+	}
+}
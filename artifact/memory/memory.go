@@ -0,0 +1,108 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory implements store.Backend with a process-local map, for
+// tests and single-process deployments that want artifact/store's
+// versioning semantics without standing up Consul, etcd, or an object
+// store.
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/achetronic/adk-utils-go/artifact/store"
+)
+
+// Backend implements store.Backend in memory, guarded by a single mutex.
+type Backend struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   []byte
+	version int64
+}
+
+// New creates an empty in-memory Backend.
+func New() *Backend {
+	return &Backend{entries: make(map[string]entry)}
+}
+
+// Get implements store.Backend.
+func (b *Backend) Get(_ context.Context, key string) ([]byte, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, 0, store.ErrNotFound
+	}
+	value := make([]byte, len(e.value))
+	copy(value, e.value)
+	return value, e.version, nil
+}
+
+// CompareAndSwap implements store.Backend.
+func (b *Backend) CompareAndSwap(_ context.Context, key string, expectedVersion int64, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	currentVersion := int64(0)
+	if ok {
+		currentVersion = e.version
+	}
+	if currentVersion != expectedVersion {
+		return store.ErrVersionMismatch
+	}
+
+	stored := make([]byte, len(value))
+	copy(stored, value)
+	b.entries[key] = entry{value: stored, version: currentVersion + 1}
+	return nil
+}
+
+// Delete implements store.Backend.
+func (b *Backend) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, key)
+	return nil
+}
+
+// List implements store.Backend.
+func (b *Backend) List(_ context.Context, prefix string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var keys []string
+	for key := range b.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Close implements store.Backend. It is a no-op: Backend holds no
+// connections or background goroutines.
+func (b *Backend) Close() error {
+	return nil
+}
+
+var _ store.Backend = (*Backend)(nil)
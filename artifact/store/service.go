@@ -0,0 +1,254 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+// StoreArtifactServiceConfig holds configuration for StoreArtifactService.
+type StoreArtifactServiceConfig struct {
+	// Backend is the durable key/value store artifacts are persisted to.
+	Backend Backend
+}
+
+// StoreArtifactService implements artifact.Service on top of any Backend.
+// Each version is its own immutable key, so Save's only race is two
+// writers picking the same next version number; saveAttempts bounds the
+// read-latest/CompareAndSwap retry loop that resolves it.
+type StoreArtifactService struct {
+	backend Backend
+}
+
+// NewStoreArtifactService creates a new Backend-agnostic artifact service.
+func NewStoreArtifactService(cfg StoreArtifactServiceConfig) (*StoreArtifactService, error) {
+	if cfg.Backend == nil {
+		return nil, fmt.Errorf("store: Backend is required")
+	}
+	return &StoreArtifactService{backend: cfg.Backend}, nil
+}
+
+const userScopedArtifactKey = "user"
+
+// saveAttempts bounds Save's read-latest/CompareAndSwap retry loop when two
+// writers race for the same next version number.
+const saveAttempts = 5
+
+// storableArtifact is the JSON value stored at each version key.
+type storableArtifact struct {
+	Part *genai.Part `json:"part"`
+}
+
+func scopeSegment(sessionID, fileName string) string {
+	if fileHasUserNamespace(fileName) {
+		return userScopedArtifactKey
+	}
+	return sessionID
+}
+
+func fileHasUserNamespace(fileName string) bool {
+	return strings.HasPrefix(fileName, "user:")
+}
+
+func (s *StoreArtifactService) artifactPrefix(appName, userID, sessionID, fileName string) string {
+	return fmt.Sprintf("artifact/%s/%s/%s/%s/", appName, userID, scopeSegment(sessionID, fileName), fileName)
+}
+
+func (s *StoreArtifactService) versionKey(appName, userID, sessionID, fileName string, version int64) string {
+	return fmt.Sprintf("%s%d", s.artifactPrefix(appName, userID, sessionID, fileName), version)
+}
+
+func (s *StoreArtifactService) sessionPrefix(appName, userID, sessionID string) string {
+	return fmt.Sprintf("artifact/%s/%s/%s/", appName, userID, sessionID)
+}
+
+// listVersions returns every version recorded for a file, sorted descending
+// (latest first), or nil if none exist.
+func (s *StoreArtifactService) listVersions(ctx context.Context, appName, userID, sessionID, fileName string) ([]int64, error) {
+	prefix := s.artifactPrefix(appName, userID, sessionID, fileName)
+	keys, err := s.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for _, key := range keys {
+		v, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	return versions, nil
+}
+
+// Save implements artifact.Service.
+func (s *StoreArtifactService) Save(ctx context.Context, req *artifact.SaveRequest) (*artifact.SaveResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	data, err := json.Marshal(storableArtifact{Part: req.Part})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal artifact: %w", err)
+	}
+
+	for attempt := 0; attempt < saveAttempts; attempt++ {
+		versions, err := s.listVersions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions: %w", err)
+		}
+
+		nextVersion := int64(1)
+		if len(versions) > 0 {
+			nextVersion = versions[0] + 1
+		}
+
+		key := s.versionKey(req.AppName, req.UserID, req.SessionID, req.FileName, nextVersion)
+		err = s.backend.CompareAndSwap(ctx, key, 0, data)
+		if err == nil {
+			return &artifact.SaveResponse{Version: nextVersion}, nil
+		}
+		if !errors.Is(err, ErrVersionMismatch) {
+			return nil, fmt.Errorf("failed to write artifact: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("store: Save exceeded %d attempts due to concurrent writers", saveAttempts)
+}
+
+// Load implements artifact.Service.
+func (s *StoreArtifactService) Load(ctx context.Context, req *artifact.LoadRequest) (*artifact.LoadResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	version := req.Version
+	if version <= 0 {
+		versions, err := s.listVersions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+		if err != nil || len(versions) == 0 {
+			return nil, fmt.Errorf("artifact not found: %s", req.FileName)
+		}
+		version = versions[0]
+	}
+
+	key := s.versionKey(req.AppName, req.UserID, req.SessionID, req.FileName, version)
+	data, _, err := s.backend.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("artifact not found: %s", req.FileName)
+		}
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	var storable storableArtifact
+	if err := json.Unmarshal(data, &storable); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal artifact: %w", err)
+	}
+
+	return &artifact.LoadResponse{Part: storable.Part}, nil
+}
+
+// Delete implements artifact.Service.
+func (s *StoreArtifactService) Delete(ctx context.Context, req *artifact.DeleteRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("request validation failed: %w", err)
+	}
+
+	if req.Version != 0 {
+		key := s.versionKey(req.AppName, req.UserID, req.SessionID, req.FileName, req.Version)
+		if err := s.backend.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete artifact version: %w", err)
+		}
+		return nil
+	}
+
+	versions, err := s.listVersions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return fmt.Errorf("failed to list versions: %w", err)
+	}
+	for _, v := range versions {
+		key := s.versionKey(req.AppName, req.UserID, req.SessionID, req.FileName, v)
+		if err := s.backend.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete artifact version %d: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// List implements artifact.Service.
+func (s *StoreArtifactService) List(ctx context.Context, req *artifact.ListRequest) (*artifact.ListResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	files := make(map[string]bool)
+	if err := s.collectFileNames(ctx, s.sessionPrefix(req.AppName, req.UserID, req.SessionID), files); err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	if err := s.collectFileNames(ctx, s.sessionPrefix(req.AppName, req.UserID, userScopedArtifactKey), files); err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	fileNames := make([]string, 0, len(files))
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	return &artifact.ListResponse{FileNames: fileNames}, nil
+}
+
+// collectFileNames adds every distinct file name found under
+// "<sessionPrefix><fileName>/<version>" keys to files.
+func (s *StoreArtifactService) collectFileNames(ctx context.Context, sessionPrefix string, files map[string]bool) error {
+	keys, err := s.backend.List(ctx, sessionPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, sessionPrefix)
+		if fileName, _, ok := strings.Cut(rest, "/"); ok {
+			files[fileName] = true
+		}
+	}
+	return nil
+}
+
+// Versions implements artifact.Service.
+func (s *StoreArtifactService) Versions(ctx context.Context, req *artifact.VersionsRequest) (*artifact.VersionsResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	versions, err := s.listVersions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil || len(versions) == 0 {
+		return nil, fmt.Errorf("artifact not found: %s", req.FileName)
+	}
+
+	return &artifact.VersionsResponse{Versions: versions}, nil
+}
+
+var _ artifact.Service = (*StoreArtifactService)(nil)
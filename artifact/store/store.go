@@ -0,0 +1,68 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store extracts the storage contract filesystem.FilesystemService
+// implements (google.golang.org/adk/artifact.Service, with per-file
+// monotonic versioning) into a backend-agnostic Backend interface, mirrored
+// on session/store's split between RedisSessionService and
+// StoreSessionService: a Backend exposing only a single-key
+// compare-and-swap lets StoreArtifactService sit on top of any KV or object
+// store with that primitive (S3 conditional writes, GCS generation
+// preconditions, an in-memory map), not just the local disk.
+// filesystem.FilesystemService predates this package and keeps its
+// dedicated implementation, which gets directory-level locking, gzip/zstd
+// compression, and content-addressed dedup that Backend's minimal contract
+// can't express.
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by Backend.Get when key doesn't exist.
+var ErrNotFound = errors.New("store: key not found")
+
+// ErrVersionMismatch is returned by Backend.CompareAndSwap when
+// expectedVersion no longer matches key's current version — another writer
+// created or overwrote it first.
+var ErrVersionMismatch = errors.New("store: version mismatch")
+
+// Backend is the minimal durable key/value contract StoreArtifactService
+// needs: version allocation, listing, and deletion all live in
+// StoreArtifactService itself, layered on top of plain versioned reads,
+// writes, and prefix listing.
+type Backend interface {
+	// Get returns the raw value stored at key and its current version, or
+	// ErrNotFound if key doesn't exist. version is backend-specific and is
+	// only meaningful as the expectedVersion argument of a later
+	// CompareAndSwap on the same key.
+	Get(ctx context.Context, key string) (value []byte, version int64, err error)
+
+	// CompareAndSwap writes value to key only if key's current version
+	// equals expectedVersion, or key doesn't exist yet and expectedVersion
+	// is 0. Returns ErrVersionMismatch otherwise, so callers can reread and
+	// retry.
+	CompareAndSwap(ctx context.Context, key string, expectedVersion int64, value []byte) error
+
+	// Delete removes key. Deleting an absent key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns every key stored under prefix, in no particular order.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Close releases any connections or background goroutines held by the
+	// backend.
+	Close() error
+}
@@ -0,0 +1,258 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+
+	"github.com/achetronic/adk-utils-go/artifact/memory"
+	"github.com/achetronic/adk-utils-go/artifact/store"
+)
+
+func newTestService(t *testing.T) *store.StoreArtifactService {
+	t.Helper()
+	svc, err := store.NewStoreArtifactService(store.StoreArtifactServiceConfig{Backend: memory.New()})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return svc
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	saveResp, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "hello.txt",
+		Part: genai.NewPartFromText("hello world"),
+	})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if saveResp.Version != 1 {
+		t.Fatalf("expected version 1, got %d", saveResp.Version)
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "hello.txt",
+	})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loadResp.Part.Text != "hello world" {
+		t.Fatalf("expected 'hello world', got %q", loadResp.Part.Text)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for i, text := range []string{"v1", "v2", "v3"} {
+		resp, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+			Part: genai.NewPartFromText(text),
+		})
+		if err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+		if resp.Version != int64(i+1) {
+			t.Fatalf("save %d: expected version %d, got %d", i, i+1, resp.Version)
+		}
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+	})
+	if err != nil {
+		t.Fatalf("load latest failed: %v", err)
+	}
+	if loadResp.Part.Text != "v3" {
+		t.Fatalf("expected latest 'v3', got %q", loadResp.Part.Text)
+	}
+
+	loadResp, err = svc.Load(ctx, &artifact.LoadRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Version: 2,
+	})
+	if err != nil {
+		t.Fatalf("load version 2 failed: %v", err)
+	}
+	if loadResp.Part.Text != "v2" {
+		t.Fatalf("expected 'v2', got %q", loadResp.Part.Text)
+	}
+}
+
+func TestVersionsList(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, text := range []string{"v1", "v2"} {
+		if _, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+			Part: genai.NewPartFromText(text),
+		}); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	resp, err := svc.Versions(ctx, &artifact.VersionsRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+	})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(resp.Versions) != 2 || resp.Versions[0] != 2 || resp.Versions[1] != 1 {
+		t.Fatalf("expected [2 1], got %v", resp.Versions)
+	}
+}
+
+func TestList(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: name,
+			Part: genai.NewPartFromText("data"),
+		}); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	resp, err := svc.List(ctx, &artifact.ListRequest{AppName: "app1", UserID: "user1", SessionID: "sess1"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(resp.FileNames) != 2 || resp.FileNames[0] != "a.txt" || resp.FileNames[1] != "b.txt" {
+		t.Fatalf("expected [a.txt b.txt], got %v", resp.FileNames)
+	}
+}
+
+func TestDeleteSingleVersion(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, text := range []string{"v1", "v2"} {
+		if _, err := svc.Save(ctx, &artifact.SaveRequest{
+			AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+			Part: genai.NewPartFromText(text),
+		}); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt", Version: 1,
+	}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	resp, err := svc.Versions(ctx, &artifact.VersionsRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+	})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(resp.Versions) != 1 || resp.Versions[0] != 2 {
+		t.Fatalf("expected [2], got %v", resp.Versions)
+	}
+}
+
+func TestDeleteAllVersions(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+		Part: genai.NewPartFromText("data"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	if err := svc.Delete(ctx, &artifact.DeleteRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+	}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if _, err := svc.Versions(ctx, &artifact.VersionsRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "f.txt",
+	}); err == nil {
+		t.Fatal("expected error after all versions deleted")
+	}
+}
+
+func TestUserScopedArtifacts(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Save(ctx, &artifact.SaveRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "user:profile.json",
+		Part: genai.NewPartFromText("profile"),
+	}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loadResp, err := svc.Load(ctx, &artifact.LoadRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess2", FileName: "user:profile.json",
+	})
+	if err != nil {
+		t.Fatalf("load from different session failed: %v", err)
+	}
+	if loadResp.Part.Text != "profile" {
+		t.Fatalf("expected 'profile', got %q", loadResp.Part.Text)
+	}
+}
+
+func TestConcurrentSavesProduceSequentialVersions(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.Save(ctx, &artifact.SaveRequest{
+				AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "concurrent.txt",
+				Part: genai.NewPartFromText("revision"),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+	}
+
+	resp, err := svc.Versions(ctx, &artifact.VersionsRequest{
+		AppName: "app1", UserID: "user1", SessionID: "sess1", FileName: "concurrent.txt",
+	})
+	if err != nil {
+		t.Fatalf("versions failed: %v", err)
+	}
+	if len(resp.Versions) != n {
+		t.Fatalf("expected %d distinct versions, got %d: %v", n, len(resp.Versions), resp.Versions)
+	}
+}
@@ -17,13 +17,89 @@ package postgres
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// defaultMaxBatchSize is the number of inputs packed into a single
+// embeddings request when callers don't override MaxBatchSize, matching the
+// limit OpenAI and most compatible providers enforce.
+const defaultMaxBatchSize = 96
+
+// Retry defaults for transient 429/5xx responses and network errors.
+const (
+	defaultMaxRetries     = 5
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// EncodingFormat selects the wire format requested via encoding_format on
+// the embeddings API.
+type EncodingFormat string
+
+const (
+	// EncodingFormatFloat requests the default JSON-array-of-floats response.
+	EncodingFormatFloat EncodingFormat = "float"
+	// EncodingFormatBase64 requests each embedding as a base64 blob of
+	// little-endian float32 values, roughly halving response size and
+	// JSON-decode CPU versus a JSON number array.
+	EncodingFormatBase64 EncodingFormat = "base64"
+)
+
+// requestTransport abstracts everything about an embeddings API call that
+// can diverge from plain OpenAI: the request URL, the auth header, extra
+// request body fields, and the response shape. This lets
+// OpenAICompatibleEmbedding's batching logic be reused by providers like
+// Azure OpenAI (see NewAzureOpenAIEmbedding), Cohere, Voyage, and Nomic
+// (see embedding_providers.go) instead of duplicating it per provider.
+type requestTransport interface {
+	// url returns the full embeddings endpoint URL for the given base URL.
+	url(baseURL string) string
+	// authenticate sets whatever header(s) the API expects for apiKey.
+	// A no-op if apiKey is empty.
+	authenticate(req *http.Request, apiKey string)
+	// augmentBody lets a transport add or rename request body fields (e.g.
+	// Cohere/Voyage's input_type, Cohere's "texts" instead of "input")
+	// before the body is marshaled. body is the in-progress request map.
+	augmentBody(body map[string]any)
+	// decodeResponse parses a raw response body into the common
+	// embeddingResponse shape.
+	decodeResponse(raw []byte) (embeddingResponse, error)
+}
+
+// standardTransport is the plain OpenAI-shaped embeddings endpoint:
+// POST {baseURL}/embeddings with an "Authorization: Bearer <key>" header,
+// "input"/"data" request/response field names, and no extra body fields.
+type standardTransport struct{}
+
+func (standardTransport) url(baseURL string) string {
+	return baseURL + "/embeddings"
+}
+
+func (standardTransport) authenticate(req *http.Request, apiKey string) {
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+func (standardTransport) augmentBody(body map[string]any) {}
+
+func (standardTransport) decodeResponse(raw []byte) (embeddingResponse, error) {
+	var result embeddingResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return embeddingResponse{}, err
+	}
+	return result, nil
+}
+
 // OpenAICompatibleEmbedding implements EmbeddingModel using the OpenAI embeddings API format.
 // This is the de facto standard supported by: OpenAI, Ollama (/v1), Azure OpenAI, vLLM, LocalAI, LiteLLM, etc.
 type OpenAICompatibleEmbedding struct {
@@ -32,9 +108,49 @@ type OpenAICompatibleEmbedding struct {
 	Model   string // e.g., "text-embedding-3-small", "nomic-embed-text"
 	dim     int    // embedding dimension, auto-detected if 0
 
+	// TruncateDimension requests Matryoshka-style truncated, renormalized
+	// vectors by sending "dimensions": N to the API (supported by
+	// text-embedding-3-small/-large and several compatible backends). When
+	// set, it is authoritative rather than a hint: Dimension() returns it
+	// immediately instead of waiting for auto-detection, and each response
+	// is validated to actually have this length.
+	TruncateDimension int
+
+	// MaxBatchSize caps how many texts EmbedBatch packs into a single
+	// request; calls with more texts are transparently chunked. Defaults to
+	// 96 if zero.
+	MaxBatchSize int
+
+	// EncodingFormat selects the response wire format. Defaults to
+	// EncodingFormatFloat for compatibility with providers that don't
+	// support base64.
+	EncodingFormat EncodingFormat
+
 	// HTTPClient allows customizing the HTTP client used for requests.
 	// If nil, http.DefaultClient is used.
 	HTTPClient *http.Client
+
+	// MaxRetries caps retry attempts for 429/5xx responses and network
+	// errors. Defaults to 5 when zero. Set to a negative value to disable
+	// retries entirely (e.g. in tests against a mock server that always
+	// returns the final status).
+	MaxRetries int
+
+	// InitialBackoff is the base delay for the first retry's full-jitter
+	// exponential backoff (actual delay is a random duration between 0 and
+	// this value, doubling each subsequent attempt up to MaxBackoff).
+	// Defaults to 500ms. Ignored for retries triggered by a Retry-After
+	// response header, which is honored exactly.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the computed backoff delay. Defaults to 30s.
+	MaxBackoff time.Duration
+
+	// transport abstracts the request URL and auth header, so API shapes
+	// that diverge from plain OpenAI (e.g. Azure OpenAI's deployment-scoped
+	// path and api-key header) can reuse the batching/decoding logic below
+	// instead of duplicating it. Defaults to standardTransport.
+	transport requestTransport
 }
 
 // OpenAICompatibleEmbeddingConfig holds configuration for the embedding model.
@@ -44,9 +160,36 @@ type OpenAICompatibleEmbeddingConfig struct {
 	Model     string
 	Dimension int // optional, will be auto-detected on first call if 0
 
+	// TruncateDimension requests Matryoshka-style truncated vectors via the
+	// API's "dimensions" request field instead of only auto-detecting the
+	// dimension from the first response. Set this (rather than, or in
+	// addition to, Dimension) to shrink the pgvector column/index width.
+	// See OpenAICompatibleEmbedding.TruncateDimension.
+	TruncateDimension int
+
+	// MaxBatchSize caps how many texts EmbedBatch packs into a single
+	// request. Defaults to 96 if zero.
+	MaxBatchSize int
+
+	// EncodingFormat selects the response wire format ("float" or
+	// "base64"). Defaults to "float" if empty.
+	EncodingFormat EncodingFormat
+
 	// HTTPClient allows customizing the HTTP client used for requests.
 	// Useful for testing with mock servers.
 	HTTPClient *http.Client
+
+	// MaxRetries caps retry attempts for 429/5xx responses and network
+	// errors. Defaults to 5 when zero. Set to a negative value to disable
+	// retries entirely, e.g. in tests against a mock server.
+	MaxRetries int
+
+	// InitialBackoff is the base delay for full-jitter exponential backoff.
+	// Defaults to 500ms when zero.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the computed backoff delay. Defaults to 30s when zero.
+	MaxBackoff time.Duration
 }
 
 // NewOpenAICompatibleEmbedding creates a new embedding model using OpenAI-compatible API.
@@ -56,76 +199,276 @@ func NewOpenAICompatibleEmbedding(cfg OpenAICompatibleEmbeddingConfig) *OpenAICo
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
+	maxBatchSize := cfg.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = defaultMaxBatchSize
+	}
+	dim := cfg.Dimension
+	if cfg.TruncateDimension > 0 {
+		dim = cfg.TruncateDimension
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	initialBackoff := cfg.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = defaultInitialBackoff
+	}
+	maxBackoff := cfg.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
 	return &OpenAICompatibleEmbedding{
-		BaseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
-		APIKey:     cfg.APIKey,
-		Model:      cfg.Model,
-		dim:        cfg.Dimension,
-		HTTPClient: httpClient,
+		BaseURL:           strings.TrimSuffix(cfg.BaseURL, "/"),
+		APIKey:            cfg.APIKey,
+		Model:             cfg.Model,
+		dim:               dim,
+		TruncateDimension: cfg.TruncateDimension,
+		MaxBatchSize:      maxBatchSize,
+		EncodingFormat:    cfg.EncodingFormat,
+		HTTPClient:        httpClient,
+		MaxRetries:        maxRetries,
+		InitialBackoff:    initialBackoff,
+		MaxBackoff:        maxBackoff,
+		transport:         standardTransport{},
 	}
 }
 
-// Dimension returns the embedding dimension.
-// Returns 0 if not yet known (will be auto-detected on first Embed call).
+// Dimension returns the embedding dimension. Returns 0 if not yet known
+// (will be auto-detected on first Embed call), unless TruncateDimension is
+// set, in which case that value is authoritative from the start.
 func (e *OpenAICompatibleEmbedding) Dimension() int {
 	return e.dim
 }
 
 // Embed generates an embedding vector for the given text.
 func (e *OpenAICompatibleEmbedding) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch generates embedding vectors for multiple texts in as few HTTP
+// requests as possible, packing them into the OpenAI input: [...] array
+// form instead of one request per text. Calls with more than MaxBatchSize
+// texts are transparently split into sequential chunked requests.
+func (e *OpenAICompatibleEmbedding) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	maxBatchSize := e.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = defaultMaxBatchSize
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(texts))
+		batch, err := e.embedBatchChunk(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		copy(embeddings[start:end], batch)
+	}
+
+	return embeddings, nil
+}
+
+// embedBatchChunk sends a single embeddings request for up to MaxBatchSize
+// texts and returns their embeddings in the same order as texts, regardless
+// of the order result.Data comes back in (the API does not guarantee it).
+func (e *OpenAICompatibleEmbedding) embedBatchChunk(ctx context.Context, texts []string) ([][]float32, error) {
 	reqBody := map[string]any{
 		"model": e.Model,
-		"input": text,
+		"input": texts,
 	}
+	if e.EncodingFormat != "" && e.EncodingFormat != EncodingFormatFloat {
+		reqBody["encoding_format"] = e.EncodingFormat
+	}
+	if e.TruncateDimension > 0 {
+		reqBody["dimensions"] = e.TruncateDimension
+	}
+
+	transport := e.transport
+	if transport == nil {
+		transport = standardTransport{}
+	}
+	transport.augmentBody(reqBody)
+
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/embeddings", bytes.NewReader(jsonBody))
+	resp, err := e.doWithRetry(ctx, transport, jsonBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	if e.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	resp, err := e.HTTPClient.Do(req)
+	rawBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call embedding API: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("embedding API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("embedding API returned status %d: %s", resp.StatusCode, string(rawBody))
 	}
 
-	var result embeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	result, err := transport.decodeResponse(rawBody)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if len(result.Data) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d embeddings for %d inputs", len(result.Data), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(embeddings) {
+			return nil, fmt.Errorf("embedding API returned out-of-range index %d for %d inputs", d.Index, len(texts))
+		}
+		if e.TruncateDimension > 0 && len(d.Embedding) != e.TruncateDimension {
+			return nil, fmt.Errorf("embedding API returned %d-dimensional vector, expected truncated dimension %d", len(d.Embedding), e.TruncateDimension)
+		}
+		embeddings[d.Index] = []float32(d.Embedding)
+	}
+
+	// Auto-detect dimension on first successful call, unless TruncateDimension
+	// already made it authoritative.
+	if e.dim == 0 && len(embeddings[0]) > 0 {
+		e.dim = len(embeddings[0])
+	}
+
+	return embeddings, nil
+}
+
+// doWithRetry sends the request built by transport/jsonBody, retrying on
+// 408, 429, 500, 502, 503, 504, and network errors with full-jitter exponential
+// backoff, honoring a Retry-After header (delta-seconds or HTTP-date) when
+// present. It never retries other 4xx statuses, and stops immediately if
+// ctx is done between attempts. On success (including a non-retryable error
+// status), the caller is responsible for closing the returned response body.
+func (e *OpenAICompatibleEmbedding) doWithRetry(ctx context.Context, transport requestTransport, jsonBody []byte) (*http.Response, error) {
+	maxRetries := e.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	initialBackoff := e.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = defaultInitialBackoff
+	}
+	maxBackoff := e.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", transport.url(e.BaseURL), bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		transport.authenticate(req, e.APIKey)
+
+		resp, err := e.HTTPClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to call embedding API: %w", err)
+			if attempt >= maxRetries {
+				return nil, lastErr
+			}
+			if !sleepBackoff(ctx, backoffDelay(attempt, initialBackoff, maxBackoff)) {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= maxRetries {
+			return resp, nil
+		}
+
+		delay := retryAfterDelay(resp.Header.Get("Retry-After"))
+		if delay <= 0 {
+			delay = backoffDelay(attempt, initialBackoff, maxBackoff)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if !sleepBackoff(ctx, delay) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isRetryableStatus reports whether status is worth retrying: 429 (rate
+// limit), 408 (request timeout), or a transient 5xx.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusRequestTimeout,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
 	}
+}
 
-	embedding := result.Data[0].Embedding
+// backoffDelay returns a full-jitter exponential backoff duration for the
+// given (zero-based) attempt: a random value between 0 and
+// min(maxBackoff, initial*2^attempt).
+func backoffDelay(attempt int, initial, maxBackoff time.Duration) time.Duration {
+	delay := initial << attempt
+	if delay <= 0 || delay > maxBackoff { // overflow or exceeds cap
+		delay = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
 
-	// Auto-detect dimension on first successful call
-	if e.dim == 0 && len(embedding) > 0 {
-		e.dim = len(embedding)
+// retryAfterDelay parses a Retry-After header value in either form defined
+// by RFC 9110: delta-seconds or an HTTP-date. Returns 0 if header is empty
+// or unparseable, signaling the caller should fall back to its own backoff.
+func retryAfterDelay(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
 	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
 
-	return embedding, nil
+// sleepBackoff waits for d or until ctx is done, whichever comes first.
+// Returns false if ctx was canceled before d elapsed.
+func sleepBackoff(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
 
 // embeddingResponse represents the OpenAI embeddings API response format.
 type embeddingResponse struct {
 	Data []struct {
-		Embedding []float32 `json:"embedding"`
-		Index     int       `json:"index"`
+		Embedding embeddingVector `json:"embedding"`
+		Index     int             `json:"index"`
 	} `json:"data"`
 	Model string `json:"model"`
 	Usage struct {
@@ -134,5 +477,42 @@ type embeddingResponse struct {
 	} `json:"usage"`
 }
 
+// embeddingVector decodes an embeddings API "embedding" field in either wire
+// format: a JSON array of numbers (EncodingFormatFloat), or a base64 string
+// of little-endian float32 values (EncodingFormatBase64).
+type embeddingVector []float32
+
+func (v *embeddingVector) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		var floats []float32
+		if err := json.Unmarshal(data, &floats); err != nil {
+			return fmt.Errorf("failed to decode float array embedding: %w", err)
+		}
+		*v = floats
+		return nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("failed to decode base64 embedding: %w", err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to base64-decode embedding: %w", err)
+	}
+	if len(raw)%4 != 0 {
+		return fmt.Errorf("base64 embedding has %d bytes, not a multiple of 4", len(raw))
+	}
+
+	floats := make([]float32, len(raw)/4)
+	for i := range floats {
+		bits := uint32(raw[i*4]) | uint32(raw[i*4+1])<<8 | uint32(raw[i*4+2])<<16 | uint32(raw[i*4+3])<<24
+		floats[i] = math.Float32frombits(bits)
+	}
+	*v = floats
+	return nil
+}
+
 // Ensure interface is implemented
 var _ EmbeddingModel = (*OpenAICompatibleEmbedding)(nil)
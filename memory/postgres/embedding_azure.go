@@ -0,0 +1,79 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultAzureAPIVersion is used when AzureOpenAIEmbeddingConfig.APIVersion
+// is left empty.
+const defaultAzureAPIVersion = "2024-02-01"
+
+// azureTransport implements requestTransport for Azure OpenAI's embeddings
+// endpoint, which diverges from plain OpenAI in three ways: the path is
+// deployment-scoped, auth uses an "api-key" header instead of "Authorization:
+// Bearer", and every request needs an api-version query parameter.
+type azureTransport struct {
+	standardTransport // augmentBody/decodeResponse: Azure's body/response shape matches plain OpenAI
+	deployment        string
+	apiVersion        string
+}
+
+func (t azureTransport) url(baseURL string) string {
+	return fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s", baseURL, t.deployment, t.apiVersion)
+}
+
+func (t azureTransport) authenticate(req *http.Request, apiKey string) {
+	if apiKey != "" {
+		req.Header.Set("api-key", apiKey)
+	}
+}
+
+// AzureOpenAIEmbeddingConfig holds configuration for NewAzureOpenAIEmbedding.
+type AzureOpenAIEmbeddingConfig struct {
+	Endpoint   string // e.g. "https://my-resource.openai.azure.com"
+	Deployment string // the Azure deployment name (not the model name)
+	APIKey     string
+	APIVersion string // optional, defaults to "2024-02-01"
+	Dimension  int    // optional, will be auto-detected on first call if 0
+	HTTPClient *http.Client
+}
+
+// NewAzureOpenAIEmbedding creates an embedding model for Azure OpenAI's
+// deployment-scoped embeddings endpoint. It's an OpenAICompatibleEmbedding
+// configured with an Azure-specific requestTransport, so it gets the same
+// batching, MaxBatchSize chunking, and float/base64 decoding for free.
+func NewAzureOpenAIEmbedding(cfg AzureOpenAIEmbeddingConfig) *OpenAICompatibleEmbedding {
+	apiVersion := cfg.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+
+	e := NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    strings.TrimSuffix(cfg.Endpoint, "/"),
+		APIKey:     cfg.APIKey,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+	e.transport = azureTransport{
+		deployment: cfg.Deployment,
+		apiVersion: apiVersion,
+	}
+
+	return e
+}
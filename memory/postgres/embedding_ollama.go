@@ -0,0 +1,166 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OllamaEmbedding implements EmbeddingModel against Ollama's native
+// /api/embeddings and /api/embed endpoints, rather than its OpenAI-compatible
+// /v1/embeddings shim (which has historically lagged the native API in
+// dimension handling, model-name pass-through, and batch support).
+type OllamaEmbedding struct {
+	BaseURL string // e.g. "http://localhost:11434"
+	Model   string // e.g. "nomic-embed-text"
+	dim     int    // embedding dimension, auto-detected if 0
+
+	// HTTPClient allows customizing the HTTP client used for requests.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// OllamaEmbeddingConfig holds configuration for NewOllamaEmbedding.
+type OllamaEmbeddingConfig struct {
+	BaseURL    string
+	Model      string
+	Dimension  int // optional, will be auto-detected on first call if 0
+	HTTPClient *http.Client
+}
+
+// NewOllamaEmbedding creates a new embedding model backed by a local (or
+// remote) Ollama server's native embeddings API.
+func NewOllamaEmbedding(cfg OllamaEmbeddingConfig) *OllamaEmbedding {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OllamaEmbedding{
+		BaseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		Model:      cfg.Model,
+		dim:        cfg.Dimension,
+		HTTPClient: httpClient,
+	}
+}
+
+// Dimension returns the embedding dimension.
+// Returns 0 if not yet known (will be auto-detected on first Embed call).
+func (e *OllamaEmbedding) Dimension() int {
+	return e.dim
+}
+
+// Embed generates an embedding vector for the given text via Ollama's
+// single-prompt /api/embeddings endpoint.
+func (e *OllamaEmbedding) Embed(ctx context.Context, text string) ([]float32, error) {
+	reqBody := map[string]any{
+		"model":  e.Model,
+		"prompt": text,
+	}
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/api/embeddings", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Ollama embeddings API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama embeddings API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if e.dim == 0 && len(result.Embedding) > 0 {
+		e.dim = len(result.Embedding)
+	}
+
+	return result.Embedding, nil
+}
+
+// EmbedBatch generates embedding vectors for multiple texts in a single
+// request using Ollama's newer /api/embed endpoint, which accepts an input
+// array directly (unlike /api/embeddings, which only takes one prompt).
+func (e *OllamaEmbedding) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	reqBody := map[string]any{
+		"model": e.Model,
+		"input": texts,
+	}
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/api/embed", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Ollama embeddings API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama embeddings API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("Ollama embeddings API returned %d embeddings for %d inputs", len(result.Embeddings), len(texts))
+	}
+
+	if e.dim == 0 && len(result.Embeddings[0]) > 0 {
+		e.dim = len(result.Embeddings[0])
+	}
+
+	return result.Embeddings, nil
+}
+
+// Ensure interface is implemented
+var _ EmbeddingModel = (*OllamaEmbedding)(nil)
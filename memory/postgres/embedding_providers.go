@@ -0,0 +1,245 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Thin preset constructors wiring the correct BaseURL, default Model, and
+// any provider-specific request/response quirks on top of
+// OpenAICompatibleEmbedding, so callers don't have to re-derive them.
+
+// flatEmbeddingsTransport handles providers (Cohere, Nomic) whose response
+// wraps embeddings in a single top-level "embeddings" array in input order,
+// rather than OpenAI's indexed "data" array, and whose request uses "texts"
+// instead of "input" plus one extra classification field (e.g. Cohere's
+// input_type, Nomic's task_type).
+type flatEmbeddingsTransport struct {
+	standardTransport
+	path       string // endpoint path appended to baseURL, e.g. "/embed"
+	extraField string
+	extraValue string
+}
+
+func (t flatEmbeddingsTransport) url(baseURL string) string {
+	return baseURL + t.path
+}
+
+func (t flatEmbeddingsTransport) augmentBody(body map[string]any) {
+	if texts, ok := body["input"]; ok {
+		delete(body, "input")
+		body["texts"] = texts
+	}
+	if t.extraField != "" && t.extraValue != "" {
+		body[t.extraField] = t.extraValue
+	}
+}
+
+func (t flatEmbeddingsTransport) decodeResponse(raw []byte) (embeddingResponse, error) {
+	var flat struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		return embeddingResponse{}, err
+	}
+	var result embeddingResponse
+	for i, emb := range flat.Embeddings {
+		result.Data = append(result.Data, struct {
+			Embedding embeddingVector `json:"embedding"`
+			Index     int             `json:"index"`
+		}{Embedding: embeddingVector(emb), Index: i})
+	}
+	return result, nil
+}
+
+// inputTypeTransport adds a single extra request field (e.g. Voyage's
+// input_type) on top of the plain OpenAI request/response shape.
+type inputTypeTransport struct {
+	standardTransport
+	field string
+	value string
+}
+
+func (t inputTypeTransport) augmentBody(body map[string]any) {
+	if t.field != "" && t.value != "" {
+		body[t.field] = t.value
+	}
+}
+
+// CohereEmbeddingConfig holds configuration for NewCohereEmbedding.
+type CohereEmbeddingConfig struct {
+	APIKey string
+	Model  string // defaults to "embed-english-v3.0"
+
+	// InputType is sent as Cohere's required input_type field. Defaults to
+	// "search_document"; pass "search_query" when embedding queries rather
+	// than documents to store.
+	InputType  string
+	Dimension  int
+	HTTPClient *http.Client
+}
+
+// NewCohereEmbedding creates an embedding model for Cohere's Embed API,
+// which diverges from plain OpenAI in its request ("texts" instead of
+// "input", required input_type) and response (a flat top-level
+// "embeddings" array instead of an indexed "data" array).
+func NewCohereEmbedding(cfg CohereEmbeddingConfig) *OpenAICompatibleEmbedding {
+	model := cfg.Model
+	if model == "" {
+		model = "embed-english-v3.0"
+	}
+	inputType := cfg.InputType
+	if inputType == "" {
+		inputType = "search_document"
+	}
+
+	e := NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    "https://api.cohere.com/v1",
+		APIKey:     cfg.APIKey,
+		Model:      model,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+	e.transport = flatEmbeddingsTransport{path: "/embed", extraField: "input_type", extraValue: inputType}
+	return e
+}
+
+// VoyageEmbeddingConfig holds configuration for NewVoyageEmbedding.
+type VoyageEmbeddingConfig struct {
+	APIKey string
+	Model  string // defaults to "voyage-3"
+
+	// InputType is sent as Voyage's input_type field. Defaults to
+	// "document"; pass "query" when embedding queries rather than
+	// documents to store.
+	InputType  string
+	Dimension  int
+	HTTPClient *http.Client
+}
+
+// NewVoyageEmbedding creates an embedding model for Voyage AI's embeddings
+// API, which otherwise matches the OpenAI request/response shape but
+// requires an input_type field distinguishing documents from queries.
+func NewVoyageEmbedding(cfg VoyageEmbeddingConfig) *OpenAICompatibleEmbedding {
+	model := cfg.Model
+	if model == "" {
+		model = "voyage-3"
+	}
+	inputType := cfg.InputType
+	if inputType == "" {
+		inputType = "document"
+	}
+
+	e := NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    "https://api.voyageai.com/v1",
+		APIKey:     cfg.APIKey,
+		Model:      model,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+	e.transport = inputTypeTransport{field: "input_type", value: inputType}
+	return e
+}
+
+// JinaEmbeddingConfig holds configuration for NewJinaEmbedding.
+type JinaEmbeddingConfig struct {
+	APIKey     string
+	Model      string // defaults to "jina-embeddings-v3"
+	Dimension  int
+	HTTPClient *http.Client
+}
+
+// NewJinaEmbedding creates an embedding model for Jina AI's embeddings API,
+// which is a straightforward OpenAI-compatible shape — this is a thin
+// BaseURL/Model preset with no request/response adaptation needed.
+func NewJinaEmbedding(cfg JinaEmbeddingConfig) *OpenAICompatibleEmbedding {
+	model := cfg.Model
+	if model == "" {
+		model = "jina-embeddings-v3"
+	}
+	return NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    "https://api.jina.ai/v1",
+		APIKey:     cfg.APIKey,
+		Model:      model,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+}
+
+// MistralEmbeddingConfig holds configuration for NewMistralEmbedding.
+type MistralEmbeddingConfig struct {
+	APIKey     string
+	Model      string // defaults to "mistral-embed"
+	Dimension  int
+	HTTPClient *http.Client
+}
+
+// NewMistralEmbedding creates an embedding model for Mistral's embeddings
+// API, which is OpenAI-compatible — a thin BaseURL/Model preset. Mistral's
+// vectors are already L2-normalized, so downstream cosine similarity does
+// not need a renormalization pass.
+func NewMistralEmbedding(cfg MistralEmbeddingConfig) *OpenAICompatibleEmbedding {
+	model := cfg.Model
+	if model == "" {
+		model = "mistral-embed"
+	}
+	return NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    "https://api.mistral.ai/v1",
+		APIKey:     cfg.APIKey,
+		Model:      model,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+}
+
+// NomicEmbeddingConfig holds configuration for NewNomicEmbedding.
+type NomicEmbeddingConfig struct {
+	APIKey string
+	Model  string // defaults to "nomic-embed-text-v1.5"
+
+	// TaskType is sent as Nomic's required task_type field. Defaults to
+	// "search_document"; pass "search_query" when embedding queries rather
+	// than documents to store.
+	TaskType   string
+	Dimension  int
+	HTTPClient *http.Client
+}
+
+// NewNomicEmbedding creates an embedding model for Nomic's hosted Atlas
+// embeddings API, which diverges from plain OpenAI the same way Cohere's
+// does: "texts" instead of "input", a required task_type field, and a flat
+// top-level "embeddings" response array instead of an indexed "data" array.
+func NewNomicEmbedding(cfg NomicEmbeddingConfig) *OpenAICompatibleEmbedding {
+	model := cfg.Model
+	if model == "" {
+		model = "nomic-embed-text-v1.5"
+	}
+	taskType := cfg.TaskType
+	if taskType == "" {
+		taskType = "search_document"
+	}
+
+	e := NewOpenAICompatibleEmbedding(OpenAICompatibleEmbeddingConfig{
+		BaseURL:    "https://api-atlas.nomic.ai/v1",
+		APIKey:     cfg.APIKey,
+		Model:      model,
+		Dimension:  cfg.Dimension,
+		HTTPClient: cfg.HTTPClient,
+	})
+	e.transport = flatEmbeddingsTransport{path: "/embedding/text", extraField: "task_type", extraValue: taskType}
+	return e
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func buildEmbeddingResponseJSON(tb testing.TB, dim int, base64Encoded bool) []byte {
+	tb.Helper()
+
+	floats := make([]float32, dim)
+	for i := range floats {
+		floats[i] = float32(i) / float32(dim)
+	}
+
+	var embeddingField any
+	if base64Encoded {
+		raw := make([]byte, dim*4)
+		for i, f := range floats {
+			bits := math.Float32bits(f)
+			raw[i*4] = byte(bits)
+			raw[i*4+1] = byte(bits >> 8)
+			raw[i*4+2] = byte(bits >> 16)
+			raw[i*4+3] = byte(bits >> 24)
+		}
+		embeddingField = base64.StdEncoding.EncodeToString(raw)
+	} else {
+		embeddingField = floats
+	}
+
+	resp := map[string]any{
+		"data": []map[string]any{
+			{"embedding": embeddingField, "index": 0},
+		},
+		"model": "text-embedding-3-small",
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		tb.Fatalf("failed to marshal fixture response: %v", err)
+	}
+	return data
+}
+
+func TestEmbeddingVectorUnmarshalFloatArray(t *testing.T) {
+	data := buildEmbeddingResponseJSON(t, 8, false)
+
+	var result embeddingResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if len(result.Data) != 1 || len(result.Data[0].Embedding) != 8 {
+		t.Fatalf("unexpected decoded embedding: %+v", result.Data)
+	}
+}
+
+func TestEmbeddingVectorUnmarshalBase64(t *testing.T) {
+	floatData := buildEmbeddingResponseJSON(t, 1536, false)
+	base64Data := buildEmbeddingResponseJSON(t, 1536, true)
+
+	var floatResult, base64Result embeddingResponse
+	if err := json.Unmarshal(floatData, &floatResult); err != nil {
+		t.Fatalf("unmarshal float response failed: %v", err)
+	}
+	if err := json.Unmarshal(base64Data, &base64Result); err != nil {
+		t.Fatalf("unmarshal base64 response failed: %v", err)
+	}
+
+	floatEmbedding := floatResult.Data[0].Embedding
+	base64Embedding := base64Result.Data[0].Embedding
+	if len(floatEmbedding) != len(base64Embedding) {
+		t.Fatalf("length mismatch: float=%d base64=%d", len(floatEmbedding), len(base64Embedding))
+	}
+	for i := range floatEmbedding {
+		if floatEmbedding[i] != base64Embedding[i] {
+			t.Fatalf("value mismatch at index %d: float=%v base64=%v", i, floatEmbedding[i], base64Embedding[i])
+		}
+	}
+}
+
+func TestEmbeddingVectorUnmarshalInvalidBase64Length(t *testing.T) {
+	data := []byte(`{"data":[{"embedding":"AAA=","index":0}]}`)
+
+	var result embeddingResponse
+	if err := json.Unmarshal(data, &result); err == nil {
+		t.Fatal("expected error for base64 payload not a multiple of 4 bytes")
+	}
+}
+
+// BenchmarkEmbeddingResponseDecode_Float and
+// BenchmarkEmbeddingResponseDecode_Base64 compare JSON-decode cost for a
+// 1536-dim embedding (OpenAI text-embedding-3-small's size) in each wire
+// format.
+func BenchmarkEmbeddingResponseDecode_Float(b *testing.B) {
+	data := buildEmbeddingResponseJSON(b, 1536, false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result embeddingResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEmbeddingResponseDecode_Base64(b *testing.B) {
+	data := buildEmbeddingResponseJSON(b, 1536, true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result embeddingResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestUpdateCalibrationState_FirstSampleBootstraps(t *testing.T) {
+	state := updateCalibrationState(CalibrationState{}, "gpt-4o", 1000, 2000)
+	if state.Mean != 2.0 || state.Variance != 0 || state.SampleCount != 1 || state.ModelName != "gpt-4o" {
+		t.Errorf("updateCalibrationState(zero, ...) = %+v, want Mean=2, Variance=0, SampleCount=1, ModelName=gpt-4o", state)
+	}
+}
+
+func TestUpdateCalibrationState_EWMABlendsSubsequentSamples(t *testing.T) {
+	state := updateCalibrationState(CalibrationState{}, "gpt-4o", 1000, 2000) // sample 2.0
+	state = updateCalibrationState(state, "gpt-4o", 1000, 1000)               // sample 1.0
+
+	wantMean := (1-calibrationEWMAAlpha)*2.0 + calibrationEWMAAlpha*1.0
+	if math.Abs(state.Mean-wantMean) > 1e-9 {
+		t.Errorf("Mean after second sample = %v, want %v", state.Mean, wantMean)
+	}
+	if state.Variance <= 0 {
+		t.Errorf("Variance after two differing samples = %v, want > 0", state.Variance)
+	}
+	if state.SampleCount != 2 {
+		t.Errorf("SampleCount = %d, want 2", state.SampleCount)
+	}
+}
+
+func TestUpdateCalibrationState_ResetsOnModelChange(t *testing.T) {
+	state := updateCalibrationState(CalibrationState{}, "gpt-4o", 1000, 3000) // sample 3.0
+	state = updateCalibrationState(state, "claude-3", 1000, 1000)             // different model, sample 1.0
+
+	if state.ModelName != "claude-3" {
+		t.Errorf("ModelName after reset = %q, want claude-3", state.ModelName)
+	}
+	if state.SampleCount != 1 {
+		t.Errorf("SampleCount after model reset = %d, want 1 (fresh estimator)", state.SampleCount)
+	}
+	if state.Mean != 1.0 {
+		t.Errorf("Mean after model reset = %v, want 1.0 (only the new model's sample)", state.Mean)
+	}
+}
+
+func TestUpdateCalibrationState_ClampsMeanToRange(t *testing.T) {
+	state := updateCalibrationState(CalibrationState{}, "gpt-4o", 1000, 10_000) // raw sample 10.0
+	if state.Mean != calibrationMeanCeil {
+		t.Errorf("Mean = %v, want clamped to ceil %v", state.Mean, calibrationMeanCeil)
+	}
+
+	state = updateCalibrationState(CalibrationState{}, "gpt-4o", 10_000, 100) // raw sample 0.01
+	if state.Mean != calibrationMeanFloor {
+		t.Errorf("Mean = %v, want clamped to floor %v", state.Mean, calibrationMeanFloor)
+	}
+}
+
+func TestUpdateCalibrationState_IgnoresNonPositiveHeuristic(t *testing.T) {
+	before := CalibrationState{Mean: 1.5, Variance: 0.1, SampleCount: 3, ModelName: "gpt-4o"}
+	after := updateCalibrationState(before, "gpt-4o", 0, 1000)
+	if after != before {
+		t.Errorf("updateCalibrationState with heuristic<=0 = %+v, want unchanged %+v", after, before)
+	}
+}
+
+func TestLoadCalibrationState_MigratesLegacySingleSampleState(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	persistRealTokens(ctx, 2000)
+	persistLastHeuristic(ctx, 1000)
+
+	state := loadCalibrationState(ctx)
+	if state.SampleCount != 1 || state.Mean != 2.0 {
+		t.Errorf("migrated state = %+v, want SampleCount=1, Mean=2.0", state)
+	}
+}
+
+func TestLoadCalibrationState_EmptyWhenNothingRecorded(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	if state := loadCalibrationState(ctx); state.SampleCount != 0 {
+		t.Errorf("loadCalibrationState with no history = %+v, want zero value", state)
+	}
+}
+
+func TestPersistAndLoadCalibrationState_RoundTrips(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	want := CalibrationState{Mean: 1.8, Variance: 0.05, SampleCount: 4, ModelName: "gpt-4o"}
+	persistCalibrationState(ctx, want)
+
+	got := loadCalibrationState(ctx)
+	if got != want {
+		t.Errorf("loadCalibrationState() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTokenCountWithK_WidensCorrectionAsVarianceGrows(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	persistRealTokens(ctx, 1_000)
+
+	// Two widely differing samples give the estimator a non-zero variance.
+	state := updateCalibrationState(CalibrationState{}, "test-model", 1000, 4000) // sample 4.0 (clamped ceil)
+	state = updateCalibrationState(state, "test-model", 1000, 500)                // sample 0.5 (clamped floor)
+	persistCalibrationState(ctx, state)
+
+	req := &model.LLMRequest{
+		Model: "test-model",
+		Contents: []*genai.Content{
+			textContent("user", strings.Repeat("a", 4000)),
+		},
+	}
+
+	zeroK := tokenCountWithK(ctx, req, 0)
+	oneK := tokenCountWithK(ctx, req, 1)
+	if oneK <= zeroK {
+		t.Errorf("tokenCountWithK(k=1) = %d, want > tokenCountWithK(k=0) = %d since variance is non-zero", oneK, zeroK)
+	}
+}
+
+func TestAfterModel_UpdatesPersistedCalibrationState(t *testing.T) {
+	guard := New(newMockRegistry())
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"})
+
+	g := &contextGuard{strategies: guard.strategies}
+	ctx := newMockCallbackContext("agent1")
+	persistLastHeuristic(ctx, 1_000)
+	persistLastModel(ctx, "gpt-4o")
+
+	resp := &model.LLMResponse{
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 2_000,
+		},
+	}
+	if _, err := g.afterModel(ctx, resp, nil); err != nil {
+		t.Fatalf("afterModel returned error: %v", err)
+	}
+
+	state := loadCalibrationState(ctx)
+	if state.SampleCount != 1 || state.Mean != 2.0 || state.ModelName != "gpt-4o" {
+		t.Errorf("calibration state after afterModel = %+v, want SampleCount=1, Mean=2.0, ModelName=gpt-4o", state)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// ErrCompactionInterrupted is the sentinel thresholdStrategy.Compact's
+// returned error wraps (via errors.Is, not a literal value — see
+// interruptedError) when a compaction pass stopped because ctx was
+// cancelled or its deadline passed, rather than because summarization
+// itself failed. Following the Cortex pattern of counting
+// runs_interrupted_total separately from runs_failed_total: callers (and
+// ContextGuard.CompactionResult.Interrupted, see observer.go) can use
+// errors.Is(err, ErrCompactionInterrupted) to tell "the caller gave up on
+// us" apart from "we tried and failed".
+var ErrCompactionInterrupted = errors.New("contextguard: compaction interrupted")
+
+// interruptedError wraps the context error that caused an interruption so
+// errors.Is still finds context.Canceled/context.DeadlineExceeded, while
+// also answering true for errors.Is(err, ErrCompactionInterrupted).
+type interruptedError struct {
+	cause error
+}
+
+func newInterruptedError(cause error) error {
+	return &interruptedError{cause: cause}
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrCompactionInterrupted, e.cause)
+}
+
+func (e *interruptedError) Unwrap() error { return e.cause }
+
+func (e *interruptedError) Is(target error) bool { return target == ErrCompactionInterrupted }
+
+// isContextInterruption reports whether err is (or wraps) context.Canceled
+// or context.DeadlineExceeded — the agent's ctx being done, not a genuine
+// summarization failure.
+func isContextInterruption(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// CompactionCheckpoint records an interrupted compaction pass's planned
+// range so a subsequent Compact call can resume it instead of
+// re-summarizing the whole window from scratch. Persisted by
+// compactPreserveTail on interruption, consumed by resumeIfPending.
+type CompactionCheckpoint struct {
+	// ContentsPlanned is len(old) for the interrupted attempt: the number
+	// of leading req.Contents that were being folded into the summary when
+	// ctx was cancelled.
+	ContentsPlanned int `json:"contents_planned"`
+}
+
+// loadCompactionCheckpoint reads the pending checkpoint from session state,
+// if any. Supports both CompactionCheckpoint (same-process state) and the
+// map[string]any shape a JSON round-trip through a real session store would
+// produce, following loadDedupHashes' precedent.
+func loadCompactionCheckpoint(ctx agent.CallbackContext) (CompactionCheckpoint, bool) {
+	key := stateKeyPrefixCompactionCheckpoint + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return CompactionCheckpoint{}, false
+	}
+
+	switch v := val.(type) {
+	case CompactionCheckpoint:
+		return v, true
+	case map[string]any:
+		return CompactionCheckpoint{ContentsPlanned: intFromAny(v["contents_planned"])}, true
+	}
+	return CompactionCheckpoint{}, false
+}
+
+// persistCompactionCheckpoint writes checkpoint to session state. Errors
+// are logged but not propagated.
+func persistCompactionCheckpoint(ctx agent.CallbackContext, checkpoint CompactionCheckpoint) {
+	key := stateKeyPrefixCompactionCheckpoint + ctx.AgentName()
+	if err := ctx.State().Set(key, checkpoint); err != nil {
+		slog.Warn("ContextGuard: failed to persist compaction checkpoint", "error", err)
+	}
+}
+
+// clearCompactionCheckpoint removes any pending checkpoint from session
+// state, so a checkpoint is consumed at most once whether or not
+// resumeIfPending could actually use it.
+func clearCompactionCheckpoint(ctx agent.CallbackContext) {
+	persistCompactionCheckpoint(ctx, CompactionCheckpoint{})
+}
+
+// resumeIfPending is Compact's first step: if an earlier call left a
+// checkpoint behind (interrupted mid-summarization), it resumes that
+// planned compaction instead of re-evaluating the threshold from scratch,
+// seeding the summarizer with whatever draft text summarizeStreaming had
+// already produced (see loadSummaryDraft) so the interrupted work isn't
+// wasted. handled is true whenever the checkpoint path ran at all — Compact
+// returns err directly in that case rather than falling through to its own
+// threshold check.
+func (s *thresholdStrategy) resumeIfPending(ctx agent.CallbackContext, req *model.LLMRequest) (handled bool, err error) {
+	checkpoint, ok := loadCompactionCheckpoint(ctx)
+	if !ok {
+		return false, nil
+	}
+	clearCompactionCheckpoint(ctx)
+
+	if checkpoint.ContentsPlanned <= 0 || checkpoint.ContentsPlanned > len(req.Contents) {
+		slog.Warn("ContextGuard [threshold]: discarding stale compaction checkpoint",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"contentsPlanned", checkpoint.ContentsPlanned,
+			"contentsNow", len(req.Contents),
+		)
+		return false, nil
+	}
+
+	slog.Info("ContextGuard [threshold]: resuming interrupted compaction from checkpoint",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"contentsPlanned", checkpoint.ContentsPlanned,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffer := s.computeBuffer(s.contextWindowFor(req))
+	todos := loadTodos(ctx)
+
+	seed := loadSummary(ctx)
+	if draft := loadSummaryDraft(ctx); draft != "" {
+		seed = draft
+	}
+
+	splitIdx := checkpoint.ContentsPlanned
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+
+	summary, summarizeErr := s.summarizeViaPool(ctx, oldContents, seed, buffer, todos)
+	if summarizeErr != nil {
+		if isContextInterruption(summarizeErr) {
+			persistCompactionCheckpoint(ctx, CompactionCheckpoint{ContentsPlanned: splitIdx})
+			return true, newInterruptedError(summarizeErr)
+		}
+		summary = buildFallbackSummary(oldContents, seed)
+	}
+
+	persistSummary(ctx, summary, s.estimateTotalTokens(ctx, req))
+	persistContentsAtCompaction(ctx, splitIdx)
+	s.writeThroughSummaryStore(ctx, summary, splitIdx)
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, ctx.UserContent())
+
+	return true, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestThresholdStrategy_CompactReturnsErrCompactionInterruptedOnCancellation(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", err: context.Canceled}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetThresholdOptions(ThresholdOptions{RetentionMode: PreserveTail})
+	ctx := newMockCallbackContext("agent1")
+
+	req := &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(50_000)}
+	err := s.Compact(ctx, req)
+
+	if !errors.Is(err, ErrCompactionInterrupted) {
+		t.Fatalf("Compact error = %v, want errors.Is(err, ErrCompactionInterrupted)", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("expected the underlying context.Canceled to still be reachable via errors.Is")
+	}
+
+	checkpoint, ok := loadCompactionCheckpoint(ctx)
+	if !ok {
+		t.Fatal("expected a compaction checkpoint to be persisted after interruption")
+	}
+	if checkpoint.ContentsPlanned <= 0 {
+		t.Errorf("ContentsPlanned = %d, want > 0", checkpoint.ContentsPlanned)
+	}
+}
+
+func TestThresholdStrategy_CompactResumesFromCheckpointAfterInterruption(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", err: context.Canceled}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetThresholdOptions(ThresholdOptions{RetentionMode: PreserveTail})
+	ctx := newMockCallbackContext("agent1")
+
+	req := &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(50_000)}
+	if err := s.Compact(ctx, req); !errors.Is(err, ErrCompactionInterrupted) {
+		t.Fatalf("first Compact error = %v, want ErrCompactionInterrupted", err)
+	}
+	if _, ok := loadCompactionCheckpoint(ctx); !ok {
+		t.Fatal("expected a checkpoint after the interrupted first call")
+	}
+
+	llm.err = nil
+	llm.response = "Summary: resumed after interruption."
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("second Compact error = %v, want nil (resumed via checkpoint)", err)
+	}
+
+	if _, ok := loadCompactionCheckpoint(ctx); ok {
+		t.Error("expected the checkpoint to be consumed once resumed")
+	}
+	if summary := loadSummary(ctx); summary == "" {
+		t.Error("expected a summary to be persisted after resuming the interrupted compaction")
+	}
+}
+
+func TestThresholdStrategy_ResumeIfPendingIgnoresStaleCheckpoint(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary."}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	persistCompactionCheckpoint(ctx, CompactionCheckpoint{ContentsPlanned: 1_000_000})
+
+	req := &model.LLMRequest{Model: "small-model", Contents: makeConversation(3)}
+	handled, err := s.resumeIfPending(ctx, req)
+	if handled {
+		t.Error("expected a checkpoint referencing more contents than req has to be discarded, not acted on")
+	}
+	if err != nil {
+		t.Errorf("unexpected error discarding a stale checkpoint: %v", err)
+	}
+	if _, ok := loadCompactionCheckpoint(ctx); ok {
+		t.Error("expected the stale checkpoint to be cleared even though it wasn't used")
+	}
+}
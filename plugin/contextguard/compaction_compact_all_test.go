@@ -0,0 +1,242 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// compactAllTestRegistry forces compaction on the first Compact call: a
+// window small enough that makeLargeConversation(2_000)/kubeAgentConversation
+// blow right through the buffer, the same sizing TestThresholdStrategy_
+// ExceedsThreshold and TestThresholdStrategy_IterativeCompaction rely on.
+func compactAllTestRegistry() *mockRegistry {
+	return &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+}
+
+// erroringStrategy is a minimal Strategy that always fails, used to exercise
+// CompactAll's errors.Join aggregation without depending on a real
+// threshold/summarization failure.
+type erroringStrategy struct {
+	err error
+}
+
+func (s *erroringStrategy) Name() string { return "erroring" }
+func (s *erroringStrategy) Compact(agent.CallbackContext, *model.LLMRequest) error {
+	return s.err
+}
+
+func TestCompactAll_CompactsEveryRegisteredAgent(t *testing.T) {
+	registry := compactAllTestRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary: batch compaction."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+	guard.Add("agent2", llm)
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+		"agent2": {Callback: newMockCallbackContext("agent2"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	if err := guard.CompactAll(context.Background(), contexts, 2, nil); err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+
+	if loadSummary(contexts["agent1"].Callback) == "" {
+		t.Error("expected agent1 to have been compacted")
+	}
+	if loadSummary(contexts["agent2"].Callback) == "" {
+		t.Error("expected agent2 to have been compacted")
+	}
+}
+
+func TestCompactAll_FilterExcludesAgents(t *testing.T) {
+	registry := compactAllTestRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary: batch compaction."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+	guard.Add("agent2", llm)
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+		"agent2": {Callback: newMockCallbackContext("agent2"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	err := guard.CompactAll(context.Background(), contexts, 2, func(agentID string) bool {
+		return agentID == "agent1"
+	})
+	if err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+
+	if loadSummary(contexts["agent1"].Callback) == "" {
+		t.Error("expected agent1 (accepted by filter) to have been compacted")
+	}
+	if loadSummary(contexts["agent2"].Callback) != "" {
+		t.Error("expected agent2 (rejected by filter) to have been left untouched")
+	}
+}
+
+func TestCompactAll_MissingContextIsSkipped(t *testing.T) {
+	registry := compactAllTestRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary: batch compaction."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+	guard.Add("agent2", llm)
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	if err := guard.CompactAll(context.Background(), contexts, 2, nil); err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+	if loadSummary(contexts["agent1"].Callback) == "" {
+		t.Error("expected agent1 to have been compacted")
+	}
+}
+
+func TestCompactAll_CancelledContextRunsNothing(t *testing.T) {
+	registry := compactAllTestRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary: batch compaction."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	if err := guard.CompactAll(cancelled, contexts, 2, nil); err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+	if loadSummary(contexts["agent1"].Callback) != "" {
+		t.Error("expected no compaction to run once ctx is already Done")
+	}
+}
+
+func TestCompactAll_JoinsErrorsFromFailingStrategies(t *testing.T) {
+	guard := New(compactAllTestRegistry())
+	guard.strategies["agent1"] = &erroringStrategy{err: errors.New("boom")}
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	err := guard.CompactAll(context.Background(), contexts, 1, nil)
+	if err == nil {
+		t.Fatal("expected CompactAll to return the joined strategy error")
+	}
+
+	found := false
+	for _, e := range unwrapJoined(err) {
+		if e.Error() == `contextguard: agent "agent1": boom` {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("CompactAll error = %v, want it to wrap agent1's \"boom\" with the agent ID", err)
+	}
+}
+
+// unwrapJoined extracts the individual errors out of an errors.Join result.
+func unwrapJoined(err error) []error {
+	type joined interface{ Unwrap() []error }
+	if j, ok := err.(joined); ok {
+		return j.Unwrap()
+	}
+	return []error{err}
+}
+
+func TestCompactAll_PerAgentStateRemainsIsolated(t *testing.T) {
+	registry := compactAllTestRegistry()
+	llm := &mockLLM{name: "small-model", response: "Summary: per-agent."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+	guard.Add("agent2", llm)
+
+	ctx1 := newMockCallbackContext("agent1")
+	ctx2 := newMockCallbackContext("agent2")
+	persistRealTokens(ctx1, 111)
+	persistRealTokens(ctx2, 222)
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: ctx1, Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+		"agent2": {Callback: ctx2, Request: &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}},
+	}
+
+	if err := guard.CompactAll(context.Background(), contexts, 2, nil); err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+
+	if got := loadRealTokens(ctx1); got != 111 {
+		t.Errorf("agent1 realTokens = %d, want 111 (unaffected by agent2's state)", got)
+	}
+	if got := loadRealTokens(ctx2); got != 222 {
+		t.Errorf("agent2 realTokens = %d, want 222 (unaffected by agent1's state)", got)
+	}
+	if loadContentsAtCompaction(ctx1) <= 0 {
+		t.Error("expected agent1's own watermark to have advanced")
+	}
+	if loadContentsAtCompaction(ctx2) <= 0 {
+		t.Error("expected agent2's own watermark to have advanced")
+	}
+}
+
+func TestCompactAll_SharedLLMPreservesToolCallPairing(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+	llm := &mockLLM{name: "small-model", response: "Summary: shared LLM."}
+	guard := New(registry)
+	guard.Add("agent1", llm)
+	guard.Add("agent2", llm)
+
+	contexts := map[string]CompactAllContext{
+		"agent1": {Callback: newMockCallbackContext("agent1"), Request: &model.LLMRequest{Model: "small-model", Contents: copyContents(kubeAgentConversation(5))}},
+		"agent2": {Callback: newMockCallbackContext("agent2"), Request: &model.LLMRequest{Model: "small-model", Contents: copyContents(kubeAgentConversation(5))}},
+	}
+
+	if err := guard.CompactAll(context.Background(), contexts, 4, nil); err != nil {
+		t.Fatalf("CompactAll error: %v", err)
+	}
+
+	for agentID, cc := range contexts {
+		for i, c := range cc.Request.Contents {
+			if c == nil || !contentHasFunctionCall(c) {
+				continue
+			}
+			if i+1 >= len(cc.Request.Contents) {
+				t.Errorf("%s: trailing FunctionCall with no paired FunctionResponse after compaction", agentID)
+				continue
+			}
+			next := cc.Request.Contents[i+1]
+			if next == nil || !contentHasFunctionResponse(next) {
+				t.Errorf("%s: FunctionCall at index %d not immediately followed by its FunctionResponse after compaction", agentID, i)
+			}
+		}
+	}
+}
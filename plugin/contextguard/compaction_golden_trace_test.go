@@ -0,0 +1,307 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// updateGolden regenerates testdata/golden/<test>.jsonl instead of
+// comparing against it. Run with -update-golden after a deliberate change
+// to the compaction decision function, then review the resulting diff.
+var updateGolden = flag.Bool("update-golden", false, "record golden compaction traces instead of replaying and comparing them")
+
+// GoldenTraceEntry is one compaction step's canonical record: which
+// messages were kept vs dropped (by content hash, not full text, so the
+// golden file stays diff-friendly) and the token accounting behind the
+// decision. A policy tweak that keeps the "no overflow" property but
+// changes which messages get dropped or when compaction fires changes this
+// record even though it wouldn't change a simple pass/fail assertion.
+type GoldenTraceEntry struct {
+	Turn             int      `json:"turn"`
+	Action           string   `json:"action"` // "noop" or "compact"
+	KeptHashes       []string `json:"kept_message_hashes"`
+	DroppedHashes    []string `json:"dropped_message_hashes"`
+	EstimatedTokens  int      `json:"estimated_tokens"`
+	RealTokens       int      `json:"real_tokens"`
+	CorrectionFactor float64  `json:"correction_factor"`
+}
+
+// GoldenTraceHook records a GoldenTraceEntry for every compaction step,
+// then writes or replays it against testdata/golden/<test>.jsonl.
+type GoldenTraceHook struct {
+	BaseSimHook
+	entries []GoldenTraceEntry
+}
+
+// NewGoldenTraceHook creates a GoldenTraceHook.
+func NewGoldenTraceHook() *GoldenTraceHook {
+	return &GoldenTraceHook{}
+}
+
+func (h *GoldenTraceHook) PostCompaction(before, after CompactionSnapshot) {
+	action := "noop"
+	if after.Compacted {
+		action = "compact"
+	}
+	h.entries = append(h.entries, GoldenTraceEntry{
+		Turn:             after.Turn,
+		Action:           action,
+		KeptHashes:       after.ContentHashes,
+		DroppedHashes:    diffHashes(before.ContentHashes, after.ContentHashes),
+		EstimatedTokens:  after.TokensAfter,
+		RealTokens:       after.RealTokens,
+		CorrectionFactor: after.CorrectionFactor,
+	})
+}
+
+// diffHashes returns the hashes present in before but absent from after,
+// in before's original order.
+func diffHashes(before, after []string) []string {
+	keep := make(map[string]bool, len(after))
+	for _, h := range after {
+		keep[h] = true
+	}
+	var dropped []string
+	for _, h := range before {
+		if !keep[h] {
+			dropped = append(dropped, h)
+		}
+	}
+	return dropped
+}
+
+// hashContent derives a short, stable fingerprint of a Content's role and
+// payload (text, function call, or function response), so golden traces
+// stay diff-friendly without embedding full message bodies.
+func hashContent(c *genai.Content) string {
+	if c == nil {
+		return "nil"
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|", c.Role)
+	for _, p := range c.Parts {
+		switch {
+		case p.Text != "":
+			fmt.Fprintf(h, "text:%s;", p.Text)
+		case p.FunctionCall != nil:
+			fmt.Fprintf(h, "call:%s:%v;", p.FunctionCall.Name, p.FunctionCall.Args)
+		case p.FunctionResponse != nil:
+			fmt.Fprintf(h, "resp:%s:%v;", p.FunctionResponse.Name, p.FunctionResponse.Response)
+		case p.InlineData != nil:
+			fmt.Fprintf(h, "inline:%s:%d;", p.InlineData.MIMEType, len(p.InlineData.Data))
+		}
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// hashContents hashes every Content in order.
+func hashContents(contents []*genai.Content) []string {
+	hashes := make([]string, len(contents))
+	for i, c := range contents {
+		hashes[i] = hashContent(c)
+	}
+	return hashes
+}
+
+func goldenTracePath(name string) string {
+	return filepath.Join("testdata", "golden", sanitizeTestName(name)+".jsonl")
+}
+
+// WriteOrCompare either records h's entries as the canonical golden trace
+// (-update-golden) or loads the existing golden trace and asserts it is
+// byte-identical to the current run, reporting a diff-friendly,
+// line-by-line mismatch otherwise.
+func (h *GoldenTraceHook) WriteOrCompare(t *testing.T, name string) {
+	t.Helper()
+
+	path := goldenTracePath(name)
+
+	var lines []string
+	for _, e := range h.entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("golden trace: failed to marshal entry: %v", err)
+		}
+		lines = append(lines, string(data))
+	}
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden trace: failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatalf("golden trace: failed to write %s: %v", path, err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden trace: no golden file at %s — run with -update-golden to record one: %v", path, err)
+	}
+
+	var want []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			want = append(want, line)
+		}
+	}
+
+	if len(want) != len(lines) {
+		t.Errorf("golden trace %s: got %d entries, want %d", path, len(lines), len(want))
+	}
+
+	for i := 0; i < len(want) && i < len(lines); i++ {
+		if want[i] != lines[i] {
+			t.Errorf("golden trace %s: entry %d mismatch:\n  want: %s\n  got:  %s", path, i, want[i], lines[i])
+		}
+	}
+}
+
+// goldenScenario names one (sessionConfig, turns) pair whose compaction
+// decisions are pinned to a testdata/golden/ trace.
+type goldenScenario struct {
+	name  string
+	cfg   sessionConfig
+	turns []turnConfig
+}
+
+// goldenScenarios covers twelve 8k scenarios and three 200k long-session
+// scenarios: enough variety (plain turns, tool bursts, no usage metadata,
+// high token ratios, long-running sessions) that a policy tweak changing
+// *which* messages get dropped or *when* compaction fires — while still
+// satisfying "no overflow" — shows up as a golden mismatch.
+func goldenScenarios() []goldenScenario {
+	eightKTurns := func(n, msgSize int) []turnConfig {
+		turns := make([]turnConfig, n)
+		for i := range turns {
+			turns[i] = turnConfig{userMessage: longMessage(i, msgSize)}
+		}
+		return turns
+	}
+
+	return []goldenScenario{
+		{"8k_normal_conversation", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, eightKTurns(20, 800)},
+		{"8k_small_tool_calls", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, func() []turnConfig {
+			turns := make([]turnConfig, 15)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: longMessage(i, 500), toolCalls: []toolCall{{name: "web_search", responseSize: 1_000}}}
+			}
+			return turns
+		}()},
+		{"8k_large_tool_response", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, []turnConfig{
+			{userMessage: "Get the full log file from the production server for analysis", toolCalls: []toolCall{{name: "read_file", responseSize: 20_000}}},
+			{userMessage: "What errors are in the log file? List them all"},
+			{userMessage: "Fix the first error you found"},
+		}},
+		{"8k_no_usage_metadata", sessionConfig{contextWindow: 8_000, systemPromptSize: 300, modelName: "custom-model", hasUsageMetadata: false, tokenRatio: 2.0}, func() []turnConfig {
+			turns := make([]turnConfig, 25)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: longMessage(i, 800), toolCalls: []toolCall{{name: "tool", responseSize: 1_500}}}
+			}
+			return turns
+		}()},
+		{"8k_long_running_40turns", sessionConfig{contextWindow: 8_000, systemPromptSize: 400, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, eightKTurns(40, 600)},
+		{"8k_tool_burst", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, func() []turnConfig {
+			turns := make([]turnConfig, 10)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: longMessage(i, 400), toolCalls: []toolCall{
+					{name: "tool_a", responseSize: 2_000}, {name: "tool_b", responseSize: 2_000},
+				}}
+			}
+			return turns
+		}()},
+		{"8k_high_token_ratio", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 3.0}, eightKTurns(20, 600)},
+		{"8k_large_system_prompt", sessionConfig{contextWindow: 8_000, systemPromptSize: 3_000, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, eightKTurns(15, 500)},
+		{"8k_only_tool_responses", sessionConfig{contextWindow: 8_000, systemPromptSize: 300, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, func() []turnConfig {
+			turns := make([]turnConfig, 12)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: "continue", toolCalls: []toolCall{{name: "tool", responseSize: 3_000}}}
+			}
+			return turns
+		}()},
+		{"8k_rapid_fire_short_messages", sessionConfig{contextWindow: 8_000, systemPromptSize: 300, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, eightKTurns(60, 80)},
+		{"8k_repeated_compactions", sessionConfig{contextWindow: 8_000, systemPromptSize: 500, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, eightKTurns(80, 700)},
+		{"8k_alternating_tool_and_text", sessionConfig{contextWindow: 8_000, systemPromptSize: 400, modelName: "small-model", hasUsageMetadata: true, tokenRatio: 1.8}, func() []turnConfig {
+			turns := make([]turnConfig, 20)
+			for i := range turns {
+				if i%2 == 0 {
+					turns[i] = turnConfig{userMessage: longMessage(i, 400), toolCalls: []toolCall{{name: "tool", responseSize: 2_500}}}
+				} else {
+					turns[i] = turnConfig{userMessage: longMessage(i, 400)}
+				}
+			}
+			return turns
+		}()},
+		{"200k_long_running_50turns", sessionConfig{contextWindow: 200_000, systemPromptSize: 1_000, modelName: "claude-sonnet", hasUsageMetadata: true, tokenRatio: 1.5}, func() []turnConfig {
+			turns := make([]turnConfig, 50)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: longMessage(i, 2_000), toolCalls: []toolCall{{name: "tool", responseSize: 5_000}}}
+			}
+			return turns
+		}()},
+		{"200k_100turns_mixed_workload", sessionConfig{contextWindow: 200_000, systemPromptSize: 1_500, modelName: "claude-sonnet", hasUsageMetadata: true, tokenRatio: 1.8}, func() []turnConfig {
+			turns := make([]turnConfig, 100)
+			for i := range turns {
+				switch i % 3 {
+				case 0:
+					turns[i] = turnConfig{userMessage: longMessage(i, 1_500)}
+				case 1:
+					turns[i] = turnConfig{userMessage: longMessage(i, 800), toolCalls: []toolCall{{name: "tool", responseSize: 4_000}}}
+				default:
+					turns[i] = turnConfig{userMessage: longMessage(i, 500), toolCalls: []toolCall{
+						{name: "tool_a", responseSize: 2_000}, {name: "tool_b", responseSize: 2_000},
+					}}
+				}
+			}
+			return turns
+		}()},
+		{"200k_repeated_compactions", sessionConfig{contextWindow: 200_000, systemPromptSize: 1_000, modelName: "claude-sonnet", hasUsageMetadata: true, tokenRatio: 1.5}, func() []turnConfig {
+			turns := make([]turnConfig, 120)
+			for i := range turns {
+				turns[i] = turnConfig{userMessage: longMessage(i, 2_500)}
+			}
+			return turns
+		}()},
+	}
+}
+
+// TestGoldenTrace_CompactionDecisions pins the exact sequence of compaction
+// decisions (which messages are kept/dropped, when compaction fires, the
+// token accounting behind it) for a fixed set of scenarios. Run with
+// -update-golden after a deliberate change to the compaction heuristic,
+// review the resulting testdata/golden/ diff, then commit it.
+func TestGoldenTrace_CompactionDecisions(t *testing.T) {
+	for _, sc := range goldenScenarios() {
+		t.Run(sc.name, func(t *testing.T) {
+			trace := NewGoldenTraceHook()
+			simulateSession(t, sc.cfg, sc.turns, trace)
+			trace.WriteOrCompare(t, "TestGoldenTrace_CompactionDecisions/"+sc.name)
+		})
+	}
+}
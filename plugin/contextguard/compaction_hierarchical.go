@@ -0,0 +1,304 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// defaultChunkTokenBudget is the maximum size (in estimated tokens) of a
+// single chunk handed to one summarizer call during hierarchical
+// compaction. defaultHierarchicalPoolSize bounds how many chunk summaries
+// run concurrently, the same way a bounded worker pool caps concurrent CAS
+// reads elsewhere — unbounded fan-out against a single conversation's tool
+// burst would just trade an overflow risk for a thundering herd of LLM
+// calls.
+const (
+	defaultChunkTokenBudget     = 8_000
+	defaultHierarchicalPoolSize = 8
+)
+
+// reduceGroupSize is how many summaries are merged together in one reduce
+// pass call. Keeping it small means each reduce call's prompt stays well
+// under any summarizer's context window regardless of how many chunks the
+// map phase produced.
+const reduceGroupSize = 4
+
+// contentChunk is one contiguous partition of conversation contents handed
+// to the map phase, together with the half-open [firstIndex, lastIndex)
+// range of req.Contents it covers. The range exists so partitioning never
+// has to be recomputed from the summary alone; it is not persisted — the
+// single contentsAtCompaction watermark already recorded by
+// persistContentsAtCompaction continues to gate what injectSummary strips
+// on the next call, the same way it does for a non-hierarchical compaction.
+type contentChunk struct {
+	contents   []*genai.Content
+	firstIndex int
+	lastIndex  int
+}
+
+// chunkSummary is one chunk's (or one previous-summary's) summarized text,
+// carrying the same index range as its source contentChunk.
+type chunkSummary struct {
+	text       string
+	firstIndex int
+	lastIndex  int
+}
+
+// partitionByTokenBudget splits contents into chunks, closing each one as
+// soon as its estimated tokens reach chunkTokenBudget, and never landing a
+// chunk boundary in the middle of a FunctionCall/FunctionResponse pair. A
+// chunk can therefore exceed chunkTokenBudget by its last entry (or by the
+// FunctionResponse kept with its call).
+func partitionByTokenBudget(contents []*genai.Content, chunkTokenBudget int) []contentChunk {
+	var chunks []contentChunk
+	start := 0
+	tokens := 0
+
+	for i, c := range contents {
+		tokens += estimateContentTokens([]*genai.Content{c})
+
+		last := i == len(contents)-1
+		if !last && (tokens < chunkTokenBudget || !isPairBoundarySafe(contents, i+1)) {
+			continue
+		}
+
+		chunks = append(chunks, contentChunk{
+			contents:   contents[start : i+1],
+			firstIndex: start,
+			lastIndex:  i + 1,
+		})
+		start = i + 1
+		tokens = 0
+	}
+
+	return chunks
+}
+
+// isPairBoundarySafe reports whether splitting contents right before idx is
+// safe, i.e. contents[idx-1] is not a FunctionCall awaiting its paired
+// FunctionResponse at contents[idx].
+func isPairBoundarySafe(contents []*genai.Content, idx int) bool {
+	if idx <= 0 || idx >= len(contents) {
+		return true
+	}
+	prev := contents[idx-1]
+	return prev == nil || prev.Role != "model" || !contentHasFunctionCall(prev)
+}
+
+// summarizeChunksConcurrently runs the map phase: each chunk is summarized
+// independently via summarize, with at most poolSize calls in flight at
+// once. The first error encountered aborts the remaining in-flight chunks'
+// results from being trusted; the caller treats it as the whole map phase
+// failing.
+func summarizeChunksConcurrently(ctx context.Context, llm model.LLM, chunks []contentChunk, todos []TodoItem, poolSize int) ([]chunkSummary, error) {
+	return summarizeChunksConcurrentlyWithTemplate(ctx, llm, chunks, todos, poolSize, "")
+}
+
+// summarizeChunksConcurrentlyWithTemplate is summarizeChunksConcurrently's
+// template-aware variant: an empty template behaves identically;
+// MapReduceSummarizer passes its MapPromptTemplate to customize the map
+// phase's system instruction independently of the default summarizer's.
+func summarizeChunksConcurrentlyWithTemplate(ctx context.Context, llm model.LLM, chunks []contentChunk, todos []TodoItem, poolSize int, template string) ([]chunkSummary, error) {
+	results := make([]chunkSummary, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, poolSize)
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk contentChunk) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			text, err := summarizeWithTemplate(ctx, llm, chunk.contents, "", defaultChunkTokenBudget, todos, template)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = chunkSummary{text: text, firstIndex: chunk.firstIndex, lastIndex: chunk.lastIndex}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("contextguard: hierarchical map phase failed: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// reduceSummaries merges chunk summaries down to a single block of text that
+// fits targetTokens, repeatedly running a bounded-concurrency reduce pass
+// over groups of reduceGroupSize summaries. It trips an error — rather than
+// looping forever — if two consecutive passes fail to shrink the combined
+// text, since that means the reducer itself is no longer making progress.
+func reduceSummaries(ctx context.Context, llm model.LLM, summaries []chunkSummary, targetTokens, poolSize int) (string, error) {
+	return reduceSummariesWithTemplate(ctx, llm, summaries, targetTokens, poolSize, "")
+}
+
+// reduceSummariesWithTemplate is reduceSummaries' template-aware variant: an
+// empty template behaves identically; MapReduceSummarizer passes its
+// ReducePromptTemplate to customize every reduce-phase call's system
+// instruction.
+func reduceSummariesWithTemplate(ctx context.Context, llm model.LLM, summaries []chunkSummary, targetTokens, poolSize int, template string) (string, error) {
+	return reduceSummariesWithFanout(ctx, llm, summaries, targetTokens, poolSize, reduceGroupSize, template)
+}
+
+// reduceSummariesWithFanout is reduceSummariesWithTemplate's fanout-aware
+// variant: groupSize <= 0 falls back to reduceGroupSize, the constant every
+// other caller gets by going through reduceSummariesWithTemplate.
+// hierarchicalMapReduceStrategy passes its own configured fanout so callers
+// can trade reduce-pass depth against per-call prompt size independently of
+// the package default.
+func reduceSummariesWithFanout(ctx context.Context, llm model.LLM, summaries []chunkSummary, targetTokens, poolSize, groupSize int, template string) (string, error) {
+	if groupSize <= 0 {
+		groupSize = reduceGroupSize
+	}
+
+	texts := make([]string, len(summaries))
+	for i, s := range summaries {
+		texts[i] = s.text
+	}
+
+	prevLen := -1
+	noProgressPasses := 0
+	for {
+		combinedLen := 0
+		for _, t := range texts {
+			combinedLen += len(t)
+		}
+		if len(texts) <= 1 || combinedLen/4 <= targetTokens {
+			return strings.Join(texts, "\n\n---\n\n"), nil
+		}
+
+		if prevLen >= 0 && combinedLen >= prevLen {
+			noProgressPasses++
+			if noProgressPasses >= 2 {
+				return "", fmt.Errorf("contextguard: hierarchical reduce made no progress for two consecutive passes (%d chars)", combinedLen)
+			}
+		} else {
+			noProgressPasses = 0
+		}
+		prevLen = combinedLen
+
+		next, err := reduceOnePass(ctx, llm, texts, targetTokens, poolSize, groupSize, template)
+		if err != nil {
+			return "", fmt.Errorf("contextguard: hierarchical reduce phase failed: %w", err)
+		}
+		texts = next
+	}
+}
+
+// reduceOnePass groups texts into groups of groupSize and summarizes each
+// group concurrently (bounded by poolSize), shrinking the number of
+// summaries by roughly groupSize per pass. An empty template uses the
+// default summarizer's system prompt, same as summarize.
+func reduceOnePass(ctx context.Context, llm model.LLM, texts []string, targetTokens, poolSize, groupSize int, template string) ([]string, error) {
+	var groups [][]string
+	for i := 0; i < len(texts); i += groupSize {
+		end := i + groupSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		groups = append(groups, texts[i:end])
+	}
+
+	results := make([]string, len(groups))
+	errs := make([]error, len(groups))
+	sem := make(chan struct{}, poolSize)
+
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, group []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			contents := make([]*genai.Content, len(group))
+			for j, text := range group {
+				contents[j] = &genai.Content{Role: "user", Parts: []*genai.Part{{Text: text}}}
+			}
+			summary, err := summarizeWithTemplate(ctx, llm, contents, "", targetTokens, nil, template)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = summary
+		}(i, group)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// hierarchicalCompact summarizes contents via a bounded-concurrency
+// map-reduce pass instead of a single summarizer call, for turns large
+// enough that one call's prompt would itself risk overflowing the
+// summarizer's own context window — e.g. a single turn with a dozen-plus
+// large tool responses. contents is partitioned into chunks of roughly
+// chunkTokenBudget tokens each (see partitionByTokenBudget; never splitting a FunctionCall/
+// FunctionResponse pair), every chunk is summarized concurrently with up to
+// poolSize calls in flight, and the resulting chunk summaries — plus
+// previousSummary, carried forward as an extra input rather than lost — are
+// reduced until the combined result fits targetTokens.
+func hierarchicalCompact(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, todos []TodoItem, chunkTokenBudget, targetTokens, poolSize int) (string, error) {
+	return hierarchicalCompactWithTemplates(ctx, llm, contents, previousSummary, todos, chunkTokenBudget, targetTokens, poolSize, "", "")
+}
+
+// hierarchicalCompactWithTemplates is hierarchicalCompact's template-aware
+// variant, and the implementation MapReduceSummarizer.Summarize delegates
+// to: empty mapTemplate/reduceTemplate reproduce hierarchicalCompact's
+// behavior exactly (hierarchicalCompact itself passes "", ""); non-empty ones
+// replace the map and/or reduce phase's system instruction respectively.
+func hierarchicalCompactWithTemplates(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, todos []TodoItem, chunkTokenBudget, targetTokens, poolSize int, mapTemplate, reduceTemplate string) (string, error) {
+	if chunkTokenBudget <= 0 {
+		chunkTokenBudget = defaultChunkTokenBudget
+	}
+	if poolSize <= 0 {
+		poolSize = defaultHierarchicalPoolSize
+	}
+
+	chunks := partitionByTokenBudget(contents, chunkTokenBudget)
+	if len(chunks) == 0 {
+		return previousSummary, nil
+	}
+
+	summaries, err := summarizeChunksConcurrentlyWithTemplate(ctx, llm, chunks, todos, poolSize, mapTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	if previousSummary != "" {
+		summaries = append([]chunkSummary{{text: previousSummary}}, summaries...)
+	}
+
+	return reduceSummariesWithTemplate(ctx, llm, summaries, targetTokens, poolSize, reduceTemplate)
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// CompactionHints directs how a strategy's selection algorithm should treat
+// one Content under compaction pressure, mirroring HTTP Cache-Control
+// directives. The zero value applies the strategy's normal size-based
+// selection with no special treatment.
+//
+// Precedence when more than one field applies to the same Content:
+//  1. NoCompact always wins — a pinned message (the user's original goal,
+//     a critical tool definition) is never evicted, and is preserved
+//     verbatim alongside the summary if full summarization still runs.
+//  2. MustSummarize is evaluated next and forces eviction once the
+//     content is older than MaxAgeTurns, even while the session has
+//     plenty of room to spare.
+//  3. EvictFirst is evaluated last, and only once compaction is already
+//     underway: these contents are evicted before the strategy falls back
+//     to full-conversation summarization, largest first.
+type CompactionHints struct {
+	NoCompact     bool
+	MustSummarize bool
+	EvictFirst    bool
+	MaxAgeTurns   int
+}
+
+// CompactionHintFunc classifies one Content in req.Contents with its
+// CompactionHints. contentsSinceAdded is how many later Content entries
+// have been appended since c — the closest proxy to "age in turns"
+// available without threading a turn counter through every Content (a
+// parallel tool-call round is one entry per role, same as a sequential
+// step). Only the caller knows which messages are a pinned user goal or a
+// critical tool definition, so this is supplied by the caller rather than
+// inferred from content shape.
+type CompactionHintFunc func(c *genai.Content, contentsSinceAdded int) CompactionHints
+
+const (
+	// hintEvictMarkerKey flags a FunctionResponse.Response map as already
+	// evicted by applyCompactionHints, so a later pass on the same
+	// conversation doesn't re-evict (and further shrink the placeholder
+	// of) an already-evicted response.
+	hintEvictMarkerKey = "_contextguard_hint_evicted"
+
+	// hintEvictedMIMEPrefix tags an evicted InlineData Blob's MIMEType,
+	// since Blob has no spare field to carry an idempotency marker in.
+	hintEvictedMIMEPrefix = "evicted/"
+
+	// hintEvictedTextPrefix marks an evicted plain-text Part, checked for
+	// idempotency the same way hintEvictMarkerKey and hintEvictedMIMEPrefix
+	// are for the other two part kinds.
+	hintEvictedTextPrefix = "[content evicted by compaction hint"
+
+	// hintEvictedTemplate is installed in place of an evicted Content's
+	// bulky parts. %s is the reason ("must-summarize" or "evict-first").
+	hintEvictedTemplate = "[content evicted by compaction hint: %s]"
+)
+
+// applyCompactionHints scans contents, classifying each entry with fn.
+// MustSummarize entries older than MaxAgeTurns are always evicted,
+// regardless of evictEvictFirst. EvictFirst entries are only evicted when
+// evictEvictFirst is true — callers call this once unconditionally early
+// in Compact (evictEvictFirst=false) so MustSummarize's "even if the
+// window has room" guarantee holds, and again right before falling back
+// to full summarization (evictEvictFirst=true) so EvictFirst content is
+// preferred for eviction over the strategy's normal heuristic.
+//
+// Returns the number of entries evicted this call and the NoCompact
+// entries seen, so thresholdStrategy.Compact can thread them into
+// replaceSummary's preserved tail if full summarization still runs.
+func applyCompactionHints(contents []*genai.Content, fn CompactionHintFunc, evictEvictFirst bool) (evicted int, preserved []*genai.Content) {
+	total := len(contents)
+
+	type candidate struct {
+		content *genai.Content
+		size    int
+	}
+	var evictFirstCandidates []candidate
+
+	for i, c := range contents {
+		if c == nil {
+			continue
+		}
+		age := total - 1 - i
+		hints := fn(c, age)
+
+		if hints.NoCompact {
+			preserved = append(preserved, c)
+			continue
+		}
+
+		if hints.MustSummarize && hints.MaxAgeTurns > 0 && age >= hints.MaxAgeTurns {
+			if evictContent(c, "must-summarize") {
+				evicted++
+			}
+			continue
+		}
+
+		if evictEvictFirst && hints.EvictFirst {
+			evictFirstCandidates = append(evictFirstCandidates, candidate{c, contentSize(c)})
+		}
+	}
+
+	sort.Slice(evictFirstCandidates, func(i, j int) bool {
+		return evictFirstCandidates[i].size > evictFirstCandidates[j].size
+	})
+	for _, cand := range evictFirstCandidates {
+		if evictContent(cand.content, "evict-first") {
+			evicted++
+		}
+	}
+
+	return evicted, preserved
+}
+
+// contentSize approximates one Content's byte footprint across every part
+// kind it might carry, for ranking EvictFirst candidates largest-first.
+func contentSize(c *genai.Content) int {
+	size := 0
+	for _, p := range c.Parts {
+		if p == nil {
+			continue
+		}
+		size += len(p.Text)
+		if p.FunctionResponse != nil {
+			size += len(fmt.Sprintf("%v", p.FunctionResponse.Response))
+		}
+		if p.InlineData != nil {
+			size += len(p.InlineData.Data)
+		}
+	}
+	return size
+}
+
+// evictContent replaces c's bulky parts with a short placeholder noting
+// reason, returning false if every part was already evicted (idempotent
+// across repeated BeforeModelCallback invocations on the same Content).
+func evictContent(c *genai.Content, reason string) bool {
+	changed := false
+	for _, p := range c.Parts {
+		switch {
+		case p == nil:
+			continue
+		case p.FunctionResponse != nil:
+			if p.FunctionResponse.Response[hintEvictMarkerKey] != nil {
+				continue
+			}
+			p.FunctionResponse.Response = map[string]any{
+				"result":           fmt.Sprintf(hintEvictedTemplate, reason),
+				hintEvictMarkerKey: true,
+			}
+			changed = true
+		case p.InlineData != nil:
+			if strings.HasPrefix(p.InlineData.MIMEType, hintEvictedMIMEPrefix) {
+				continue
+			}
+			p.InlineData.MIMEType = hintEvictedMIMEPrefix + p.InlineData.MIMEType
+			p.InlineData.Data = nil
+			changed = true
+		case p.Text != "":
+			if strings.HasPrefix(p.Text, hintEvictedTextPrefix) {
+				continue
+			}
+			p.Text = fmt.Sprintf(hintEvictedTemplate, reason)
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+)
+
+// defaultCompactionHistorySize bounds how many CompactionEvent entries
+// recordCompactionEvent keeps per agent. Once the ring is full, the oldest
+// entry is dropped to make room for the newest, the same trade-off
+// loadDedupHashes' callers accept for unbounded-growth session state.
+const defaultCompactionHistorySize = 20
+
+// CompactionEvent records one compaction pass for History/LastCompaction/
+// Rollback: enough to audit what was dropped (the index range folded into
+// Summary, and the token counts before/after) without keeping the evicted
+// Content entries themselves — those remain in the session's own history,
+// and FirstIndex/LastIndex is all injectSummary needs to know how much of
+// it to re-expose after a Rollback.
+type CompactionEvent struct {
+	// Timestamp is when this compaction ran, as a Unix timestamp (seconds).
+	Timestamp int64 `json:"timestamp"`
+
+	// Strategy is the compacting Strategy's Name(), e.g. "threshold" or
+	// "sliding_window".
+	Strategy string `json:"strategy"`
+
+	// FirstIndex is the contentsAtCompaction watermark in effect before this
+	// compaction ran (0 for an agent's first compaction).
+	FirstIndex int `json:"firstIndex"`
+
+	// LastIndex is the contentsAtCompaction watermark this compaction wrote,
+	// i.e. how many leading Content entries Summary now stands in for.
+	LastIndex int `json:"lastIndex"`
+
+	// TokensBefore and TokensAfter are the request's estimated token count
+	// immediately before and after this compaction pass.
+	TokensBefore int `json:"tokensBefore"`
+
+	// TokensAfter is the request's estimated token count immediately after
+	// this compaction pass.
+	TokensAfter int `json:"tokensAfter"`
+
+	// Summary is the resulting summary text this compaction produced. Empty
+	// for strategies that fold evicted turns into something other than a
+	// flat summary string (e.g. hierarchicalStrategy's SummaryTree).
+	Summary string `json:"summary"`
+}
+
+// loadCompactionHistoryFor reads agentName's compaction ring buffer from
+// session state, oldest first. Returns nil if none has been recorded yet.
+// Takes an explicit agentName rather than ctx.AgentName() so an operator
+// inspecting or rolling back history isn't required to be running inside
+// that agent's own BeforeModelCallback.
+func loadCompactionHistoryFor(ctx agent.CallbackContext, agentName string) []CompactionEvent {
+	key := stateKeyPrefixCompactionHistory + agentName
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return nil
+	}
+
+	switch v := val.(type) {
+	case []CompactionEvent:
+		return v
+	case []any:
+		events := make([]CompactionEvent, 0, len(v))
+		for _, raw := range v {
+			m, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			summary, _ := m["summary"].(string)
+			strategy, _ := m["strategy"].(string)
+			events = append(events, CompactionEvent{
+				Timestamp:    int64(floatFromAny(m["timestamp"])),
+				Strategy:     strategy,
+				FirstIndex:   intFromAny(m["firstIndex"]),
+				LastIndex:    intFromAny(m["lastIndex"]),
+				TokensBefore: intFromAny(m["tokensBefore"]),
+				TokensAfter:  intFromAny(m["tokensAfter"]),
+				Summary:      summary,
+			})
+		}
+		return events
+	}
+	return nil
+}
+
+// persistCompactionHistoryFor writes agentName's compaction ring buffer to
+// session state. Errors are logged but not propagated.
+func persistCompactionHistoryFor(ctx agent.CallbackContext, agentName string, events []CompactionEvent) {
+	key := stateKeyPrefixCompactionHistory + agentName
+	if err := ctx.State().Set(key, events); err != nil {
+		slog.Warn("ContextGuard: failed to persist compaction history", "error", err)
+	}
+}
+
+// recordCompactionEvent appends event to agentName's ring buffer, evicting
+// the oldest entry once the buffer exceeds defaultCompactionHistorySize.
+func recordCompactionEvent(ctx agent.CallbackContext, agentName string, event CompactionEvent) {
+	history := append(loadCompactionHistoryFor(ctx, agentName), event)
+	if len(history) > defaultCompactionHistorySize {
+		history = history[len(history)-defaultCompactionHistorySize:]
+	}
+	persistCompactionHistoryFor(ctx, agentName, history)
+}
+
+// History returns agentName's recorded compaction events, oldest first, up
+// to the most recent defaultCompactionHistorySize.
+func (g *ContextGuard) History(ctx agent.CallbackContext, agentName string) []CompactionEvent {
+	return loadCompactionHistoryFor(ctx, agentName)
+}
+
+// LastCompaction returns agentName's most recent CompactionEvent, and
+// whether any compaction has been recorded at all.
+func (g *ContextGuard) LastCompaction(ctx agent.CallbackContext, agentName string) (CompactionEvent, bool) {
+	history := loadCompactionHistoryFor(ctx, agentName)
+	if len(history) == 0 {
+		return CompactionEvent{}, false
+	}
+	return history[len(history)-1], true
+}
+
+// Rollback undoes agentName's n most recent compactions: the summary and
+// contentsAtCompaction watermark are reset to whatever they were just
+// before the oldest of those n events ran (or to the zero, pre-compaction
+// state if n reaches back past the first recorded event), and those n
+// events are dropped from the ring. The next beforeModel call's
+// injectSummary then re-exposes the raw Content entries the rolled-back
+// compactions had folded into a summary — the session's own history still
+// holds them; only ContextGuard's watermark and summary ever changed.
+// Returns an error if n isn't positive or exceeds the number of events
+// recorded for agentName.
+func (g *ContextGuard) Rollback(ctx agent.CallbackContext, agentName string, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("contextguard: rollback count must be positive, got %d", n)
+	}
+
+	history := loadCompactionHistoryFor(ctx, agentName)
+	if n > len(history) {
+		return fmt.Errorf("contextguard: only %d compaction(s) recorded for agent %q, cannot roll back %d", len(history), agentName, n)
+	}
+
+	keepIdx := len(history) - n
+	var restoredSummary string
+	var restoredWatermark int
+	if keepIdx > 0 {
+		restoredSummary = history[keepIdx-1].Summary
+		restoredWatermark = history[keepIdx-1].LastIndex
+	}
+
+	keySummary := stateKeyPrefixSummary + agentName
+	keyWatermark := stateKeyPrefixContentsAtCompaction + agentName
+	if err := ctx.State().Set(keySummary, restoredSummary); err != nil {
+		slog.Warn("ContextGuard: failed to roll back summary", "error", err)
+	}
+	if err := ctx.State().Set(keyWatermark, restoredWatermark); err != nil {
+		slog.Warn("ContextGuard: failed to roll back contentsAtCompaction watermark", "error", err)
+	}
+	persistCompactionHistoryFor(ctx, agentName, history[:keepIdx])
+
+	slog.Info("ContextGuard: rolled back compaction history",
+		"agent", agentName,
+		"eventsRolledBack", n,
+		"restoredWatermark", restoredWatermark,
+	)
+	return nil
+}
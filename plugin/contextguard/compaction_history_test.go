@@ -0,0 +1,195 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func thresholdRegistryForHistory() *mockRegistry {
+	return &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+}
+
+func TestCompactionHistory_RecordsEventOnThresholdCompaction(t *testing.T) {
+	llm := &mockLLM{name: "small-model", response: "Summarized conversation"}
+	g := &contextGuard{strategies: map[string]Strategy{
+		"agent1": newThresholdStrategy(thresholdRegistryForHistory(), llm, 0),
+	}}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{Model: "small-model", Contents: makeLargeConversation(2_000)}
+
+	guard := New(thresholdRegistryForHistory())
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel error: %v", err)
+	}
+
+	history := guard.History(ctx, "agent1")
+	if len(history) != 1 {
+		t.Fatalf("len(History()) = %d, want 1", len(history))
+	}
+	if history[0].Strategy != StrategyThreshold {
+		t.Errorf("Strategy = %q, want %q", history[0].Strategy, StrategyThreshold)
+	}
+	if history[0].Summary == "" {
+		t.Error("expected a non-empty Summary for the threshold strategy")
+	}
+	if history[0].LastIndex <= history[0].FirstIndex {
+		t.Errorf("LastIndex (%d) should exceed FirstIndex (%d)", history[0].LastIndex, history[0].FirstIndex)
+	}
+}
+
+func TestCompactionHistory_RecordsEventOnSlidingWindowCompaction(t *testing.T) {
+	llm := &mockLLM{name: "gpt-4o", response: "Summarized conversation"}
+	g := &contextGuard{strategies: map[string]Strategy{
+		"agent1": newSlidingWindowStrategy(newMockRegistry(), llm, 5),
+	}}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: kubeAgentConversation(10)}
+
+	guard := New(newMockRegistry())
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel error: %v", err)
+	}
+
+	history := guard.History(ctx, "agent1")
+	if len(history) != 1 {
+		t.Fatalf("len(History()) = %d, want 1", len(history))
+	}
+	if history[0].Strategy != StrategySlidingWindow {
+		t.Errorf("Strategy = %q, want %q", history[0].Strategy, StrategySlidingWindow)
+	}
+}
+
+func TestCompactionHistory_RingBufferEviction(t *testing.T) {
+	llm := &mockLLM{name: "gpt-4o", response: "Summarized conversation"}
+	g := &contextGuard{strategies: map[string]Strategy{
+		"agent1": newSlidingWindowStrategy(newMockRegistry(), llm, 5),
+	}}
+	ctx := newMockCallbackContext("agent1")
+	guard := New(newMockRegistry())
+
+	rounds := defaultCompactionHistorySize + 5
+	for i := 0; i < rounds; i++ {
+		req := &model.LLMRequest{Model: "gpt-4o", Contents: kubeAgentConversation(10)}
+		if _, err := g.beforeModel(ctx, req); err != nil {
+			t.Fatalf("round %d: beforeModel error: %v", i, err)
+		}
+	}
+
+	history := guard.History(ctx, "agent1")
+	if len(history) != defaultCompactionHistorySize {
+		t.Fatalf("len(History()) = %d, want %d (bounded ring)", len(history), defaultCompactionHistorySize)
+	}
+}
+
+func TestCompactionHistory_AgentNameIsolation(t *testing.T) {
+	ctx1 := newMockCallbackContext("agent1")
+	ctx2 := &mockCallbackContext{
+		Context:   context.Background(),
+		agentName: "agent2",
+		sessionID: "test-session",
+		state:     ctx1.state,
+	}
+
+	guard := New(newMockRegistry())
+	recordCompactionEvent(ctx1, "agent1", CompactionEvent{Strategy: "threshold", LastIndex: 10, Summary: "summary for agent1"})
+	recordCompactionEvent(ctx2, "agent2", CompactionEvent{Strategy: "sliding_window", LastIndex: 20, Summary: "summary for agent2"})
+
+	h1 := guard.History(ctx1, "agent1")
+	h2 := guard.History(ctx2, "agent2")
+
+	if len(h1) != 1 || h1[0].Summary != "summary for agent1" {
+		t.Errorf("agent1 history = %+v", h1)
+	}
+	if len(h2) != 1 || h2[0].Summary != "summary for agent2" {
+		t.Errorf("agent2 history = %+v", h2)
+	}
+}
+
+func TestContextGuard_LastCompaction(t *testing.T) {
+	guard := New(newMockRegistry())
+	ctx := newMockCallbackContext("agent1")
+
+	if _, ok := guard.LastCompaction(ctx, "agent1"); ok {
+		t.Fatal("expected no last compaction before any were recorded")
+	}
+
+	recordCompactionEvent(ctx, "agent1", CompactionEvent{Strategy: "threshold", LastIndex: 10, Summary: "first"})
+	recordCompactionEvent(ctx, "agent1", CompactionEvent{Strategy: "threshold", LastIndex: 20, Summary: "second"})
+
+	last, ok := guard.LastCompaction(ctx, "agent1")
+	if !ok {
+		t.Fatal("expected a last compaction after recording two")
+	}
+	if last.Summary != "second" {
+		t.Errorf("LastCompaction().Summary = %q, want %q", last.Summary, "second")
+	}
+}
+
+func TestContextGuard_Rollback_RestoresPriorWatermarkAndSummary(t *testing.T) {
+	guard := New(newMockRegistry())
+	ctx := newMockCallbackContext("agent1")
+
+	persistSummary(ctx, "summary after first compaction", 0)
+	persistContentsAtCompaction(ctx, 10)
+	recordCompactionEvent(ctx, "agent1", CompactionEvent{Strategy: "threshold", FirstIndex: 0, LastIndex: 10, Summary: "summary after first compaction"})
+
+	persistSummary(ctx, "summary after second compaction", 0)
+	persistContentsAtCompaction(ctx, 20)
+	recordCompactionEvent(ctx, "agent1", CompactionEvent{Strategy: "threshold", FirstIndex: 10, LastIndex: 20, Summary: "summary after second compaction"})
+
+	if err := guard.Rollback(ctx, "agent1", 1); err != nil {
+		t.Fatalf("Rollback error: %v", err)
+	}
+
+	if got := loadSummary(ctx); got != "summary after first compaction" {
+		t.Errorf("loadSummary() = %q, want the first compaction's summary", got)
+	}
+	if got := loadContentsAtCompaction(ctx); got != 10 {
+		t.Errorf("loadContentsAtCompaction() = %d, want 10", got)
+	}
+	if history := guard.History(ctx, "agent1"); len(history) != 1 {
+		t.Errorf("len(History()) = %d, want 1 after rolling back one event", len(history))
+	}
+
+	if err := guard.Rollback(ctx, "agent1", 1); err != nil {
+		t.Fatalf("second Rollback error: %v", err)
+	}
+	if got := loadSummary(ctx); got != "" {
+		t.Errorf("loadSummary() = %q, want empty after rolling back to before any compaction", got)
+	}
+	if got := loadContentsAtCompaction(ctx); got != 0 {
+		t.Errorf("loadContentsAtCompaction() = %d, want 0", got)
+	}
+}
+
+func TestContextGuard_Rollback_ErrorsWhenExceedingRecordedEvents(t *testing.T) {
+	guard := New(newMockRegistry())
+	ctx := newMockCallbackContext("agent1")
+	recordCompactionEvent(ctx, "agent1", CompactionEvent{Strategy: "threshold", LastIndex: 10})
+
+	if err := guard.Rollback(ctx, "agent1", 2); err == nil {
+		t.Error("expected an error rolling back more events than were recorded")
+	}
+	if err := guard.Rollback(ctx, "agent1", 0); err == nil {
+		t.Error("expected an error for a non-positive rollback count")
+	}
+}
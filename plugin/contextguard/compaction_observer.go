@@ -0,0 +1,202 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/adk/agent"
+)
+
+// CompactionStartEvent is reported to ThresholdCompactionObserver.OnCompactionStart
+// once Compact has decided a compaction pass is actually going to run (the
+// threshold was exceeded), before any summarization work begins.
+type CompactionStartEvent struct {
+	// Model is req.Model — the model the compacted request is bound for,
+	// not necessarily the one used to summarize it.
+	Model string
+
+	// PreTokens is the token estimate that triggered this compaction.
+	PreTokens int
+
+	// Threshold is the token budget that PreTokens exceeded.
+	Threshold int
+
+	// RetentionMode is the strategy's configured retention mode for this
+	// pass (see ThresholdOptions.RetentionMode).
+	RetentionMode RetentionMode
+}
+
+// SummaryProducedEvent is reported to ThresholdCompactionObserver.OnSummaryProduced
+// once a summary has been produced (successfully or via fallback), before
+// it's written into req.Contents.
+type SummaryProducedEvent struct {
+	// Model is the model that produced the summary: the agent's own LLM,
+	// unless a Summarizer or summarization pool member handled this call.
+	Model string
+
+	// SummaryLength is len(summary) in bytes.
+	SummaryLength int
+
+	// TurnsDropped is the number of Content entries folded into the summary
+	// (no longer present verbatim in req.Contents afterward).
+	TurnsDropped int
+
+	// Elapsed is how long summarization took.
+	Elapsed time.Duration
+
+	// Fallback is true if summarization failed and buildFallbackSummary was
+	// used instead.
+	Fallback bool
+
+	// PinnedSkipped counts Content entries excluded from this pass's
+	// summarization range because PinContent marked them no-compact — the
+	// "contents skipped due to no-compact mark" counter. They were kept
+	// verbatim instead of being folded into the summary (see
+	// splitNoCompactMarked).
+	PinnedSkipped int
+}
+
+// ContinuationInjectedEvent is reported to
+// ThresholdCompactionObserver.OnContinuationInjected once Compact has decided how
+// (or whether) to resume the conversation after the summary.
+type ContinuationInjectedEvent struct {
+	// Mode is the resolved ContinuationMode this pass used.
+	Mode ContinuationMode
+
+	// UserRequestRecovered is true if ctx.UserContent() yielded non-empty
+	// text that was threaded into the continuation message.
+	UserRequestRecovered bool
+
+	// PendingToolCallsPreserved is the number of trailing FunctionCall/
+	// FunctionResponse Content entries re-appended verbatim (see
+	// trailingToolState), 0 if none.
+	PendingToolCallsPreserved int
+
+	// PreTokens and PostTokens are the token estimates immediately before
+	// and after this compaction pass.
+	PreTokens  int
+	PostTokens int
+}
+
+// ThresholdCompactionObserver receives telemetry for every compaction pass a
+// thresholdStrategy runs, so operators get the kind of visibility into this
+// package's own behavior that instrumentation libraries already provide for
+// raw LLM calls. All three methods are called synchronously from Compact;
+// implementations that do I/O (exporting spans/metrics) should do so
+// non-blockingly. See SetCompactionObserver, WithCompactionObserver,
+// NoopThresholdCompactionObserver, OTelThresholdCompactionObserver.
+type ThresholdCompactionObserver interface {
+	OnCompactionStart(ctx agent.CallbackContext, event CompactionStartEvent)
+	OnSummaryProduced(ctx agent.CallbackContext, event SummaryProducedEvent)
+	OnContinuationInjected(ctx agent.CallbackContext, event ContinuationInjectedEvent)
+}
+
+// NoopThresholdCompactionObserver implements ThresholdCompactionObserver with no-ops. Useful
+// when composing observers (e.g. embedding it and overriding only one
+// method) or as an explicit no-telemetry default distinct from a nil field.
+type NoopThresholdCompactionObserver struct{}
+
+func (NoopThresholdCompactionObserver) OnCompactionStart(agent.CallbackContext, CompactionStartEvent) {
+}
+func (NoopThresholdCompactionObserver) OnSummaryProduced(agent.CallbackContext, SummaryProducedEvent) {
+}
+func (NoopThresholdCompactionObserver) OnContinuationInjected(agent.CallbackContext, ContinuationInjectedEvent) {
+}
+
+// OTelRecorder is the minimal surface OTelThresholdCompactionObserver needs from an
+// OpenTelemetry meter/tracer pair. Defined here instead of depending on a
+// specific go.opentelemetry.io/otel SDK version directly — same reasoning
+// as BlobClient in summary_doc_store.go: callers adapt their own
+// otel.Meter/otel.Tracer to this interface, so this package never pins a
+// particular SDK release.
+type OTelRecorder interface {
+	// StartSpan starts a span named name, tagged with attrs, for one
+	// compaction pass. The returned func ends it; callers invoke it when
+	// the pass completes (successfully or not).
+	StartSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, func())
+
+	// AddTokensSaved adds tokensSaved to the "adk.compaction.tokens_saved"
+	// counter, tagged with attrs.
+	AddTokensSaved(ctx context.Context, tokensSaved int64, attrs map[string]string)
+
+	// RecordDuration records seconds on the "adk.compaction.duration"
+	// histogram, tagged with attrs.
+	RecordDuration(ctx context.Context, seconds float64, attrs map[string]string)
+
+	// IncrementContinuations adds 1 to a continuation-injection counter,
+	// tagged with attrs (e.g. the ContinuationMode used).
+	IncrementContinuations(ctx context.Context, attrs map[string]string)
+}
+
+// OTelThresholdCompactionObserver implements ThresholdCompactionObserver by forwarding events
+// to an OTelRecorder: one span per compaction pass (started on
+// OnCompactionStart, ended on OnContinuationInjected), plus the
+// adk.compaction.tokens_saved counter and adk.compaction.duration histogram
+// the package overview promises.
+type OTelThresholdCompactionObserver struct {
+	Recorder OTelRecorder
+
+	endSpan func()
+}
+
+// NewOTelThresholdCompactionObserver returns an OTelThresholdCompactionObserver that forwards
+// every compaction pass to recorder.
+func NewOTelThresholdCompactionObserver(recorder OTelRecorder) *OTelThresholdCompactionObserver {
+	return &OTelThresholdCompactionObserver{Recorder: recorder}
+}
+
+func (o *OTelThresholdCompactionObserver) OnCompactionStart(ctx agent.CallbackContext, event CompactionStartEvent) {
+	attrs := map[string]string{
+		"agent":          ctx.AgentName(),
+		"model":          event.Model,
+		"retention_mode": strconv.Itoa(int(event.RetentionMode)),
+	}
+	_, end := o.Recorder.StartSpan(ctx, "adk.contextguard.compact", attrs)
+	o.endSpan = end
+}
+
+func (o *OTelThresholdCompactionObserver) OnSummaryProduced(ctx agent.CallbackContext, event SummaryProducedEvent) {
+	attrs := map[string]string{
+		"agent":    ctx.AgentName(),
+		"model":    event.Model,
+		"fallback": boolAttr(event.Fallback),
+	}
+	o.Recorder.RecordDuration(ctx, event.Elapsed.Seconds(), attrs)
+}
+
+func (o *OTelThresholdCompactionObserver) OnContinuationInjected(ctx agent.CallbackContext, event ContinuationInjectedEvent) {
+	attrs := map[string]string{
+		"agent": ctx.AgentName(),
+		"mode":  string(event.Mode),
+	}
+	if saved := int64(event.PreTokens - event.PostTokens); saved > 0 {
+		o.Recorder.AddTokensSaved(ctx, saved, attrs)
+	}
+	o.Recorder.IncrementContinuations(ctx, attrs)
+	if o.endSpan != nil {
+		o.endSpan()
+		o.endSpan = nil
+	}
+}
+
+func boolAttr(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+func TestNoopCompactionObserver_SatisfiesInterfaceWithoutPanicking(t *testing.T) {
+	var observer ThresholdCompactionObserver = NoopThresholdCompactionObserver{}
+	ctx := newMockCallbackContext("agent1")
+
+	observer.OnCompactionStart(ctx, CompactionStartEvent{})
+	observer.OnSummaryProduced(ctx, SummaryProducedEvent{})
+	observer.OnContinuationInjected(ctx, ContinuationInjectedEvent{})
+}
+
+type recordingOTelRecorder struct {
+	spansStarted    []string
+	spansEnded      int
+	tokensSaved     int64
+	durationsRecord []float64
+	continuations   int
+	lastAttrs       map[string]string
+}
+
+func (r *recordingOTelRecorder) StartSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, func()) {
+	r.spansStarted = append(r.spansStarted, name)
+	r.lastAttrs = attrs
+	return ctx, func() { r.spansEnded++ }
+}
+
+func (r *recordingOTelRecorder) AddTokensSaved(ctx context.Context, tokensSaved int64, attrs map[string]string) {
+	r.tokensSaved += tokensSaved
+}
+
+func (r *recordingOTelRecorder) RecordDuration(ctx context.Context, seconds float64, attrs map[string]string) {
+	r.durationsRecord = append(r.durationsRecord, seconds)
+}
+
+func (r *recordingOTelRecorder) IncrementContinuations(ctx context.Context, attrs map[string]string) {
+	r.continuations++
+}
+
+func TestOTelCompactionObserver_ForwardsEventsToRecorder(t *testing.T) {
+	recorder := &recordingOTelRecorder{}
+	observer := NewOTelThresholdCompactionObserver(recorder)
+	ctx := newMockCallbackContext("agent1")
+
+	observer.OnCompactionStart(ctx, CompactionStartEvent{Model: "sim-model", PreTokens: 9000, Threshold: 8000, RetentionMode: FullSummary})
+	if len(recorder.spansStarted) != 1 || recorder.spansStarted[0] != "adk.contextguard.compact" {
+		t.Fatalf("expected one span started, got %v", recorder.spansStarted)
+	}
+
+	observer.OnSummaryProduced(ctx, SummaryProducedEvent{Model: "sim-model", SummaryLength: 42, Elapsed: 0})
+	if len(recorder.durationsRecord) != 1 {
+		t.Fatalf("expected one duration recorded, got %d", len(recorder.durationsRecord))
+	}
+
+	observer.OnContinuationInjected(ctx, ContinuationInjectedEvent{Mode: ContinuationModeSyntheticUser, PreTokens: 9000, PostTokens: 3000})
+	if recorder.tokensSaved != 6000 {
+		t.Errorf("tokensSaved = %d, want 6000", recorder.tokensSaved)
+	}
+	if recorder.continuations != 1 {
+		t.Errorf("continuations = %d, want 1", recorder.continuations)
+	}
+	if recorder.spansEnded != 1 {
+		t.Errorf("spansEnded = %d, want 1", recorder.spansEnded)
+	}
+}
+
+func TestOTelCompactionObserver_NoTokensSavedWhenPostExceedsPre(t *testing.T) {
+	recorder := &recordingOTelRecorder{}
+	observer := NewOTelThresholdCompactionObserver(recorder)
+	ctx := newMockCallbackContext("agent1")
+
+	observer.OnContinuationInjected(ctx, ContinuationInjectedEvent{Mode: ContinuationModeAssistantResume, PreTokens: 1000, PostTokens: 1200})
+	if recorder.tokensSaved != 0 {
+		t.Errorf("tokensSaved = %d, want 0 when compaction grew the request", recorder.tokensSaved)
+	}
+}
+
+func TestWithCompactionObserver_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+	observer := NewOTelThresholdCompactionObserver(&recordingOTelRecorder{})
+
+	g.Add("agent1", llm, WithCompactionObserver(observer))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if ts.observer != observer {
+		t.Errorf("observer = %v, want %v", ts.observer, observer)
+	}
+}
+
+func TestThresholdStrategy_CompactReportsTelemetryToObserver(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+
+	var started []CompactionStartEvent
+	var summarized []SummaryProducedEvent
+	var continuations []ContinuationInjectedEvent
+	ts.SetCompactionObserver(&funcCompactionObserver{
+		start:        func(e CompactionStartEvent) { started = append(started, e) },
+		summary:      func(e SummaryProducedEvent) { summarized = append(summarized, e) },
+		continuation: func(e ContinuationInjectedEvent) { continuations = append(continuations, e) },
+	})
+
+	ctx := newMockCallbackContext("sim-agent")
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	if len(started) != 1 {
+		t.Fatalf("expected exactly one OnCompactionStart call, got %d", len(started))
+	}
+	if started[0].Model != "sim-model" {
+		t.Errorf("CompactionStartEvent.Model = %q, want %q", started[0].Model, "sim-model")
+	}
+	if len(summarized) != 1 {
+		t.Fatalf("expected exactly one OnSummaryProduced call, got %d", len(summarized))
+	}
+	if summarized[0].SummaryLength == 0 {
+		t.Error("expected SummaryLength > 0")
+	}
+	if len(continuations) != 1 {
+		t.Fatalf("expected exactly one OnContinuationInjected call, got %d", len(continuations))
+	}
+	if continuations[0].PreTokens <= continuations[0].PostTokens {
+		t.Errorf("expected PreTokens (%d) > PostTokens (%d) after compaction",
+			continuations[0].PreTokens, continuations[0].PostTokens)
+	}
+}
+
+// funcCompactionObserver adapts plain funcs to ThresholdCompactionObserver for tests
+// that only need to assert on a subset of events without hand-rolling a
+// dedicated struct per test.
+type funcCompactionObserver struct {
+	start        func(CompactionStartEvent)
+	summary      func(SummaryProducedEvent)
+	continuation func(ContinuationInjectedEvent)
+}
+
+func (f *funcCompactionObserver) OnCompactionStart(_ agent.CallbackContext, event CompactionStartEvent) {
+	if f.start != nil {
+		f.start(event)
+	}
+}
+
+func (f *funcCompactionObserver) OnSummaryProduced(_ agent.CallbackContext, event SummaryProducedEvent) {
+	if f.summary != nil {
+		f.summary(event)
+	}
+}
+
+func (f *funcCompactionObserver) OnContinuationInjected(_ agent.CallbackContext, event ContinuationInjectedEvent) {
+	if f.continuation != nil {
+		f.continuation(event)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// overflowDecision is the action OverflowLimiter.Decide selects for a tool
+// response that arrived while the current turn's token growth exceeded the
+// overflow trigger threshold.
+type overflowDecision int
+
+const (
+	// overflowDecisionInline lets the response through for ordinary
+	// in-process compaction (chain stubbing / summarization), unchanged.
+	overflowDecisionInline overflowDecision = iota
+
+	// overflowDecisionAsync replaces the response with a placeholder and
+	// hands the real summarization off to a background goroutine.
+	overflowDecisionAsync
+
+	// overflowDecisionDrop replaces the response with a hard-drop marker;
+	// the limiter is fully saturated and can't even queue more async work.
+	overflowDecisionDrop
+)
+
+const (
+	// defaultOverflowAsyncCapacity caps how many async summarization jobs an
+	// OverflowLimiter will have in flight at once. Beyond that, further
+	// overflow is hard-dropped rather than queued without bound.
+	defaultOverflowAsyncCapacity = 4
+
+	// overflowJobIDKey tags a placeholder FunctionResponse.Response map with
+	// the job ID that will eventually resolve it, so a later Compact call on
+	// the same conversation can substitute the real summary once ready.
+	overflowJobIDKey = "_contextguard_overflow_job_id"
+
+	// overflowDropMarkerKey flags a FunctionResponse.Response map as
+	// hard-dropped by the limiter rather than summarized.
+	overflowDropMarkerKey = "_contextguard_overflow_dropped"
+
+	// overflowPlaceholderTemplate is installed in place of a tool response
+	// queued for async summarization. %s is the job ID.
+	overflowPlaceholderTemplate = "result is being summarized in the background (job %s); the summary will replace this placeholder once ready"
+
+	// overflowDropTemplate is installed in place of a tool response the
+	// limiter hard-dropped. %s is the tool name, %d the original byte size.
+	overflowDropTemplate = "result from %s (%d bytes) was dropped: overflow limiter saturated"
+)
+
+// OverflowLimiter is a token-bucket rate limiter that decides, for each tool
+// response added while the current turn's token growth exceeds the trigger
+// threshold, whether to let it through for ordinary inline compaction, defer
+// it to an asynchronous summarization job (installing a placeholder until
+// the job completes), or hard-drop it with a marker once the limiter is
+// fully saturated. forcedKeys names tools (e.g. "kubectl_logs", "run_tests")
+// that always bypass the limiter and compact eagerly, since their output
+// tends to be both large and safe to summarize immediately.
+type OverflowLimiter struct {
+	mu sync.Mutex
+
+	burst      float64
+	perSecond  float64
+	tokens     float64
+	lastRefill time.Time
+
+	forcedKeys map[string]bool
+
+	asyncCapacity int
+	pending       map[string]*overflowJob
+	nextJobID     int
+}
+
+// overflowJob tracks one in-flight async summarization job. Fields are
+// guarded by their own mutex rather than the limiter's, since the
+// background goroutine that completes a job never touches the limiter.
+type overflowJob struct {
+	mu      sync.Mutex
+	done    bool
+	summary string
+	err     error
+}
+
+// NewOverflowLimiter creates an OverflowLimiter with the given token-bucket
+// parameters: perSecondLimit tokens are refilled every second, up to
+// burstLimit. forcedKeys lists tool names that always bypass the limiter.
+func NewOverflowLimiter(perSecondLimit, burstLimit float64, forcedKeys []string) *OverflowLimiter {
+	forced := make(map[string]bool, len(forcedKeys))
+	for _, k := range forcedKeys {
+		forced[k] = true
+	}
+	return &OverflowLimiter{
+		burst:         burstLimit,
+		perSecond:     perSecondLimit,
+		tokens:        burstLimit,
+		lastRefill:    time.Now(),
+		forcedKeys:    forced,
+		asyncCapacity: defaultOverflowAsyncCapacity,
+		pending:       make(map[string]*overflowJob),
+	}
+}
+
+// refill adds tokens accrued since the last call, capped at burst. Caller
+// must hold l.mu.
+func (l *OverflowLimiter) refill() {
+	now := time.Now()
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	l.lastRefill = now
+	l.tokens += elapsed * l.perSecond
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Decide selects how to handle a tool response for tool, consuming a token
+// from the bucket when it lets one through.
+func (l *OverflowLimiter) Decide(tool string) overflowDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.forcedKeys[tool] {
+		return overflowDecisionInline
+	}
+
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return overflowDecisionInline
+	}
+
+	if len(l.pending) < l.asyncCapacity {
+		return overflowDecisionAsync
+	}
+
+	return overflowDecisionDrop
+}
+
+// enqueue starts a background summarization of rendered and returns the job
+// ID to install as a placeholder marker. The goroutine only ever touches
+// ctx as a context.Context (passed to llm.GenerateContent), never its
+// session state, so it's safe to run concurrently with the main callback.
+func (l *OverflowLimiter) enqueue(ctx context.Context, llm model.LLM, tool, rendered string) string {
+	l.mu.Lock()
+	l.nextJobID++
+	id := fmt.Sprintf("ovf-%d", l.nextJobID)
+	job := &overflowJob{}
+	l.pending[id] = job
+	l.mu.Unlock()
+
+	go func() {
+		content := []*genai.Content{{
+			Role:  "user",
+			Parts: []*genai.Part{{Text: rendered}},
+		}}
+		summary, err := summarize(ctx, llm, content, "", defaultChunkTokenBudget, nil)
+		job.mu.Lock()
+		job.summary = summary
+		job.err = err
+		job.done = true
+		job.mu.Unlock()
+	}()
+
+	return id
+}
+
+// resolve checks job id for completion. ok is false if the job is unknown
+// (already resolved and forgotten) or still running.
+func (l *OverflowLimiter) resolve(id string) (summary string, ok bool) {
+	l.mu.Lock()
+	job, found := l.pending[id]
+	l.mu.Unlock()
+	if !found {
+		return "", false
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if !job.done {
+		return "", false
+	}
+
+	l.mu.Lock()
+	delete(l.pending, id)
+	l.mu.Unlock()
+
+	if job.err != nil || job.summary == "" {
+		return fmt.Sprintf("background summarization failed: %v", job.err), true
+	}
+	return job.summary, true
+}
+
+// resolveOverflowPlaceholders scans contents for FunctionResponse payloads
+// tagged with overflowJobIDKey and substitutes the real summary for any
+// whose job has completed, leaving still-running jobs' placeholders as-is.
+func resolveOverflowPlaceholders(limiter *OverflowLimiter, contents []*genai.Content) {
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			id, _ := part.FunctionResponse.Response[overflowJobIDKey].(string)
+			if id == "" {
+				continue
+			}
+			if summary, ok := limiter.resolve(id); ok {
+				part.FunctionResponse.Response = map[string]any{"result": summary}
+			}
+		}
+	}
+}
+
+// applyOverflowLimiter runs the limiter over the FunctionResponse parts of
+// the most recently appended Content entry — the tool results from the
+// turn that just pushed token growth over threshold — replacing each with a
+// placeholder or drop marker per Decide's verdict. Forced keys and
+// already-decided responses (idempotency marker present) are left alone.
+// Returns the number of responses it changed.
+func (s *thresholdStrategy) applyOverflowLimiter(ctx context.Context, llm model.LLM, contents []*genai.Content) int {
+	if len(contents) == 0 {
+		return 0
+	}
+	last := contents[len(contents)-1]
+	if last == nil || last.Role != "user" {
+		return 0
+	}
+
+	changed := 0
+	for _, part := range last.Parts {
+		if part == nil || part.FunctionResponse == nil {
+			continue
+		}
+		resp := part.FunctionResponse.Response
+		if resp[overflowJobIDKey] != nil || resp[overflowDropMarkerKey] != nil {
+			continue
+		}
+
+		tool := part.FunctionResponse.Name
+		switch s.overflow.Decide(tool) {
+		case overflowDecisionAsync:
+			rendered := fmt.Sprintf("%v", resp)
+			id := s.overflow.enqueue(ctx, llm, tool, rendered)
+			part.FunctionResponse.Response = map[string]any{
+				"result":         fmt.Sprintf(overflowPlaceholderTemplate, id),
+				overflowJobIDKey: id,
+			}
+			changed++
+		case overflowDecisionDrop:
+			rendered := fmt.Sprintf("%v", resp)
+			part.FunctionResponse.Response = map[string]any{
+				"result":              fmt.Sprintf(overflowDropTemplate, tool, len(rendered)),
+				overflowDropMarkerKey: true,
+			}
+			changed++
+		case overflowDecisionInline:
+			// Let normal chain/summarization handling deal with it.
+		}
+	}
+
+	if changed > 0 {
+		slog.Info("ContextGuard [threshold]: overflow limiter processed turn",
+			"responsesChanged", changed,
+		)
+	}
+
+	return changed
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestOverflowLimiter_ForcedKeyAlwaysInline(t *testing.T) {
+	l := NewOverflowLimiter(0, 0, []string{"kubectl_logs"})
+
+	for i := 0; i < 5; i++ {
+		if got := l.Decide("kubectl_logs"); got != overflowDecisionInline {
+			t.Errorf("iteration %d: forced key got decision %v, want inline", i, got)
+		}
+	}
+}
+
+func TestOverflowLimiter_BurstThenAsyncThenDrop(t *testing.T) {
+	l := NewOverflowLimiter(0, 2, nil)
+	l.asyncCapacity = 1
+
+	if got := l.Decide("tool"); got != overflowDecisionInline {
+		t.Fatalf("1st call: got %v, want inline (burst=2)", got)
+	}
+	if got := l.Decide("tool"); got != overflowDecisionInline {
+		t.Fatalf("2nd call: got %v, want inline (burst=2)", got)
+	}
+	if got := l.Decide("tool"); got != overflowDecisionAsync {
+		t.Fatalf("3rd call: got %v, want async (bucket empty)", got)
+	}
+	// Fake an in-flight job directly so the next Decide sees the async
+	// capacity as full, without waiting on a real goroutine.
+	l.pending["fake"] = &overflowJob{}
+	if got := l.Decide("tool"); got != overflowDecisionDrop {
+		t.Fatalf("4th call: got %v, want drop (async capacity saturated)", got)
+	}
+}
+
+func TestOverflowLimiter_RefillOverTime(t *testing.T) {
+	l := NewOverflowLimiter(100, 1, nil)
+	l.tokens = 0
+	l.lastRefill = time.Now().Add(-time.Second)
+
+	if got := l.Decide("tool"); got != overflowDecisionInline {
+		t.Errorf("expected refill after 1s at 100/s to allow an inline decision, got %v", got)
+	}
+}
+
+func TestOverflowLimiter_ResolveUnknownJobNotOK(t *testing.T) {
+	l := NewOverflowLimiter(1, 1, nil)
+	if _, ok := l.resolve("does-not-exist"); ok {
+		t.Error("resolving an unknown job ID should report ok=false")
+	}
+}
+
+func TestOverflowLimiter_ResolveWaitsForCompletion(t *testing.T) {
+	l := NewOverflowLimiter(1, 1, nil)
+	job := &overflowJob{}
+	l.pending["job-1"] = job
+
+	if _, ok := l.resolve("job-1"); ok {
+		t.Fatal("resolve should report ok=false while the job is still running")
+	}
+
+	job.mu.Lock()
+	job.done = true
+	job.summary = "final summary"
+	job.mu.Unlock()
+
+	summary, ok := l.resolve("job-1")
+	if !ok {
+		t.Fatal("resolve should report ok=true once the job is done")
+	}
+	if summary != "final summary" {
+		t.Errorf("resolve summary = %q, want %q", summary, "final summary")
+	}
+	if _, stillPending := l.pending["job-1"]; stillPending {
+		t.Error("resolve should forget a job once it's been resolved")
+	}
+}
+
+func TestResolveOverflowPlaceholders_SubstitutesCompletedJob(t *testing.T) {
+	l := NewOverflowLimiter(1, 1, nil)
+	job := &overflowJob{done: true, summary: "the real summary"}
+	l.pending["job-1"] = job
+
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{Name: "tool", Response: map[string]any{
+				"result":         "placeholder",
+				overflowJobIDKey: "job-1",
+			}},
+		}}},
+	}
+
+	resolveOverflowPlaceholders(l, contents)
+
+	got := contents[0].Parts[0].FunctionResponse.Response["result"]
+	if got != "the real summary" {
+		t.Errorf("result = %v, want %q", got, "the real summary")
+	}
+}
+
+func TestResolveOverflowPlaceholders_LeavesRunningJobAlone(t *testing.T) {
+	l := NewOverflowLimiter(1, 1, nil)
+	l.pending["job-1"] = &overflowJob{}
+
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{Name: "tool", Response: map[string]any{
+				"result":         "placeholder",
+				overflowJobIDKey: "job-1",
+			}},
+		}}},
+	}
+
+	resolveOverflowPlaceholders(l, contents)
+
+	got := contents[0].Parts[0].FunctionResponse.Response["result"]
+	if got != "placeholder" {
+		t.Errorf("result = %v, want placeholder left unchanged while job is running", got)
+	}
+}
+
+func TestThresholdStrategy_ApplyOverflowLimiter_DropsWhenSaturated(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	strategy := newThresholdStrategy(registry, llm, 8_000)
+	limiter := NewOverflowLimiter(0, 0, nil)
+	limiter.asyncCapacity = 0
+	strategy.SetOverflowLimiter(limiter)
+
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{Name: "tool", Response: map[string]any{"result": "some large payload"}},
+		}}},
+	}
+
+	ctx := newMockCallbackContext("agent1")
+	changed := strategy.applyOverflowLimiter(ctx, llm, contents)
+	if changed != 1 {
+		t.Fatalf("expected 1 response changed, got %d", changed)
+	}
+
+	dropped, _ := contents[0].Parts[0].FunctionResponse.Response[overflowDropMarkerKey].(bool)
+	if !dropped {
+		t.Error("expected the response to be marked as dropped when burst=0 and async capacity=0")
+	}
+}
+
+func TestThresholdStrategy_ApplyOverflowLimiter_ForcedKeyUnchanged(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	strategy := newThresholdStrategy(registry, llm, 8_000)
+	strategy.SetOverflowLimiter(NewOverflowLimiter(0, 0, []string{"kubectl_logs"}))
+
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{Name: "kubectl_logs", Response: map[string]any{"result": "log output"}},
+		}}},
+	}
+
+	ctx := newMockCallbackContext("agent1")
+	changed := strategy.applyOverflowLimiter(ctx, llm, contents)
+	if changed != 0 {
+		t.Fatalf("forced key should pass through untouched, got %d changes", changed)
+	}
+	if contents[0].Parts[0].FunctionResponse.Response["result"] != "log output" {
+		t.Error("forced key's response payload should be left exactly as-is")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultOversizedContentFraction is the fraction of the context window a
+// single part's estimated tokens must exceed before it's treated as
+// "oversized" and routed through summarizeOversizedParts instead of the
+// normal conversation-level summarization pass. A fraction rather than a
+// fixed token count keeps the trigger meaningful across both small local
+// models and huge-context hosted ones.
+//
+// defaultOversizedChunkTokens and defaultOversizedChunkOverlapTokens size
+// the sub-chunks a single oversized payload is split into: small enough
+// that one chunk's summarize call can't itself overflow, with enough
+// overlap that a fact split across a chunk boundary still appears whole in
+// at least one chunk.
+const (
+	defaultOversizedContentFraction    = 0.5
+	defaultOversizedChunkTokens        = 4_000
+	defaultOversizedChunkOverlapTokens = 200
+
+	// oversizedCharsPerToken mirrors the ~4-chars-per-token heuristic used
+	// throughout this package (see estimatePartTokens).
+	oversizedCharsPerToken = 4
+)
+
+// summarizeOversizedParts scans contents for any single Text or
+// FunctionResponse part whose estimated tokens exceed fraction *
+// contextWindow — the "one 200k-1M character tool response" pathology
+// where a single summarize call's prompt is larger than the summarizer's
+// own input window, so no amount of retrying the normal compaction passes
+// ever gets it to fit. Each oversized part's payload is split into
+// overlapping chunks (see splitIntoOverlappingChunks), summarized
+// concurrently, and reduced down to a single bounded summary via the same
+// chunk/reduce machinery hierarchicalCompact uses for oversized turns, then
+// written back in place of the original payload.
+//
+// A hash of each oversized payload is cached in session state
+// (loadOversizedCache/persistOversizedCache) so a later invocation that
+// sees the identical payload again — the tool response itself hasn't
+// changed, only newer turns were appended after it — reuses the cached
+// summary instead of paying for another map-reduce pass. fraction <= 0
+// selects defaultOversizedContentFraction. Returns how many parts were
+// summarized.
+func summarizeOversizedParts(ctx agent.CallbackContext, llm model.LLM, contents []*genai.Content, todos []TodoItem, contextWindow int, fraction float64) (int, error) {
+	if fraction <= 0 {
+		fraction = defaultOversizedContentFraction
+	}
+	limit := int(float64(contextWindow) * fraction)
+
+	cache := loadOversizedCache(ctx)
+	summarized := 0
+
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || estimatePartTokens(part) <= limit {
+				continue
+			}
+
+			payload := oversizedPartPayload(part)
+			if payload == "" {
+				continue
+			}
+			hash := oversizedContentHash(payload)
+
+			summary, cached := cache[hash]
+			if !cached {
+				var err error
+				summary, err = summarizeOversizedPayload(ctx, llm, payload, todos)
+				if err != nil {
+					return summarized, fmt.Errorf("contextguard: oversized content summarization failed: %w", err)
+				}
+				cache[hash] = summary
+			}
+
+			applyOversizedSummary(part, summary)
+			summarized++
+		}
+	}
+
+	if summarized > 0 {
+		persistOversizedCache(ctx, cache)
+	}
+	return summarized, nil
+}
+
+// oversizedPartPayload returns the text a part's size is dominated by: its
+// raw Text, or its rendered FunctionResponse.Response (the same rendering
+// estimatePartTokens and dedupHash use). Returns "" for part types this
+// pass doesn't apply to (FunctionCall, InlineData).
+func oversizedPartPayload(part *genai.Part) string {
+	if part.Text != "" {
+		return part.Text
+	}
+	if part.FunctionResponse != nil {
+		return fmt.Sprintf("%v", part.FunctionResponse.Response)
+	}
+	return ""
+}
+
+// applyOversizedSummary replaces a part's oversized payload in place with
+// its summary, preserving the part's shape (Text stays Text, a
+// FunctionResponse stays a FunctionResponse) so downstream code that
+// switches on part type keeps working.
+func applyOversizedSummary(part *genai.Part, summary string) {
+	if part.Text != "" {
+		part.Text = summary
+		return
+	}
+	if part.FunctionResponse != nil {
+		part.FunctionResponse.Response = map[string]any{"summarized": summary}
+	}
+}
+
+// oversizedContentHash returns the hex sha256 of payload, used as the
+// cache key in loadOversizedCache/persistOversizedCache.
+func oversizedContentHash(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitIntoOverlappingChunks splits text into chunks of at most chunkTokens
+// estimated tokens, each overlapping the previous by overlapTokens tokens
+// so a fact near a chunk boundary still appears whole in at least one
+// chunk. Splits on runes rather than bytes to never cut a multi-byte
+// character in half. Returns a single-element slice unchanged if text
+// already fits in one chunk.
+func splitIntoOverlappingChunks(text string, chunkTokens, overlapTokens int) []string {
+	if chunkTokens <= 0 {
+		chunkTokens = defaultOversizedChunkTokens
+	}
+	if overlapTokens < 0 || overlapTokens >= chunkTokens {
+		overlapTokens = 0
+	}
+
+	runes := []rune(text)
+	chunkSize := chunkTokens * oversizedCharsPerToken
+	overlapSize := overlapTokens * oversizedCharsPerToken
+
+	if len(runes) <= chunkSize {
+		return []string{text}
+	}
+
+	step := chunkSize - overlapSize
+	var chunks []string
+	for start := 0; start < len(runes); start += step {
+		end := min(start+chunkSize, len(runes))
+		chunks = append(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
+
+// summarizeOversizedPayload runs the map-reduce pass for a single oversized
+// payload: split into overlapping chunks, each summarized concurrently (up
+// to defaultHierarchicalPoolSize in flight), then reduced to a single
+// result bounded by defaultOversizedChunkTokens. Reuses
+// summarizeChunksConcurrently/reduceSummaries — the same machinery
+// hierarchicalCompact uses to map-reduce an oversized turn's worth of
+// contents — by wrapping each text chunk in a single-Content contentChunk.
+func summarizeOversizedPayload(ctx agent.CallbackContext, llm model.LLM, payload string, todos []TodoItem) (string, error) {
+	texts := splitIntoOverlappingChunks(payload, defaultOversizedChunkTokens, defaultOversizedChunkOverlapTokens)
+	if len(texts) <= 1 {
+		return payload, nil
+	}
+
+	chunks := make([]contentChunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = contentChunk{contents: []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: text}}}}}
+	}
+
+	summaries, err := summarizeChunksConcurrently(ctx, llm, chunks, todos, defaultHierarchicalPoolSize)
+	if err != nil {
+		return "", err
+	}
+
+	return reduceSummaries(ctx, llm, summaries, defaultOversizedChunkTokens, defaultHierarchicalPoolSize)
+}
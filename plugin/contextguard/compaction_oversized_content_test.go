@@ -0,0 +1,157 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestSplitIntoOverlappingChunks_FitsInOneChunk(t *testing.T) {
+	text := strings.Repeat("a", 100)
+
+	chunks := splitIntoOverlappingChunks(text, 4_000, 200)
+	if len(chunks) != 1 || chunks[0] != text {
+		t.Fatalf("splitIntoOverlappingChunks() = %v, want a single unchanged chunk", chunks)
+	}
+}
+
+func TestSplitIntoOverlappingChunks_SplitsWithOverlap(t *testing.T) {
+	// chunkTokens=10 -> 40 chars/chunk, overlapTokens=2 -> 8 chars overlap.
+	text := strings.Repeat("0123456789", 20) // 200 chars
+
+	chunks := splitIntoOverlappingChunks(text, 10, 2)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want more than one for 200 chars at a 40-char chunk size", len(chunks))
+	}
+
+	// Reassembling should cover the whole string: the overlap region at the
+	// end of one chunk must equal the start of the next.
+	for i := 0; i+1 < len(chunks); i++ {
+		tail := chunks[i][len(chunks[i])-8:]
+		head := chunks[i+1][:8]
+		if tail != head {
+			t.Errorf("chunk %d tail %q != chunk %d head %q, overlap not preserved", i, tail, i+1, head)
+		}
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(text, last) {
+		t.Errorf("last chunk %q is not a suffix of the original text", last)
+	}
+}
+
+func TestSummarizeOversizedParts_SummarizesOversizedFunctionResponse(t *testing.T) {
+	huge := strings.Repeat("pod-a Running\n", 20_000) // far larger than any reasonable context window
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name:     "kubectl_get_pods",
+			Response: map[string]any{"result": huge},
+		}}}},
+	}
+
+	llm := &mockLLM{name: "sim-model", response: "condensed: pods are running"}
+	ctx := newMockCallbackContext("oversized-agent")
+
+	n, err := summarizeOversizedParts(ctx, llm, contents, nil, 32_000, 0.1)
+	if err != nil {
+		t.Fatalf("summarizeOversizedParts() error: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("summarizeOversizedParts() = %d, want 1", n)
+	}
+
+	resp := contents[0].Parts[0].FunctionResponse.Response
+	summarized, ok := resp["summarized"].(string)
+	if !ok || summarized == "" {
+		t.Fatalf("FunctionResponse.Response = %v, want a non-empty summarized payload", resp)
+	}
+	if len(summarized) >= len(huge) {
+		t.Errorf("summarized payload (%d bytes) is not smaller than the original (%d bytes)", len(summarized), len(huge))
+	}
+}
+
+func TestSummarizeOversizedParts_LeavesSmallPartsUntouched(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name:     "kubectl_get_pods",
+			Response: map[string]any{"result": "pod-a Running"},
+		}}}},
+	}
+
+	llm := &mockLLM{name: "sim-model", response: "should not be called"}
+	ctx := newMockCallbackContext("oversized-agent")
+
+	n, err := summarizeOversizedParts(ctx, llm, contents, nil, 32_000, 0.5)
+	if err != nil {
+		t.Fatalf("summarizeOversizedParts() error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("summarizeOversizedParts() = %d, want 0 for a small payload", n)
+	}
+	if contents[0].Parts[0].FunctionResponse.Response["result"] != "pod-a Running" {
+		t.Errorf("small payload should have been left untouched")
+	}
+}
+
+// countingLLM wraps mockLLM's fixed-response behavior while counting how
+// many times GenerateContent was invoked, so cache-hit tests can assert no
+// further summarization calls were made.
+type countingLLM struct {
+	mockLLM
+	calls atomic.Int64
+	mu    sync.Mutex
+}
+
+func (c *countingLLM) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	c.calls.Add(1)
+	return c.mockLLM.GenerateContent(ctx, req, stream)
+}
+
+func TestSummarizeOversizedParts_CachesAcrossCalls(t *testing.T) {
+	huge := strings.Repeat("pod-a Running\n", 20_000)
+	buildContents := func() []*genai.Content {
+		return []*genai.Content{
+			{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+				Name:     "kubectl_get_pods",
+				Response: map[string]any{"result": huge},
+			}}}},
+		}
+	}
+
+	llm := &countingLLM{mockLLM: mockLLM{name: "sim-model", response: "condensed: pods are running"}}
+	ctx := newMockCallbackContext("oversized-agent")
+
+	if _, err := summarizeOversizedParts(ctx, llm, buildContents(), nil, 32_000, 0.1); err != nil {
+		t.Fatalf("first call error: %v", err)
+	}
+	firstCallCount := llm.calls.Load()
+	if firstCallCount == 0 {
+		t.Fatalf("expected the first call to invoke the LLM at least once")
+	}
+
+	if _, err := summarizeOversizedParts(ctx, llm, buildContents(), nil, 32_000, 0.1); err != nil {
+		t.Fatalf("second call error: %v", err)
+	}
+	if got := llm.calls.Load(); got != firstCallCount {
+		t.Errorf("second call invoked the LLM %d more times, want the cached summary to be reused with no new calls", got-firstCallCount)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+const (
+	// patternSimilarityThreshold is the fraction of token positions that
+	// must agree (or already be wildcarded) for a new log line to merge
+	// into an existing group instead of starting a new one.
+	patternSimilarityThreshold = 0.5
+
+	// patternWildcard marks a template position that has varied across
+	// the occurrences merged into a group.
+	patternWildcard = "<*>"
+
+	// patternSamplePreviewChars caps how much of the line that created a
+	// group survives into its rendered record.
+	patternSamplePreviewChars = 160
+
+	// defaultPatternRecentKeep is how many of the most recent Content
+	// entries PatternCompactor leaves completely untouched — the tail the
+	// model is actively reasoning from.
+	defaultPatternRecentKeep = 4
+
+	// patternClusterMarkerKey flags a FunctionResponse.Response map as
+	// already reduced to a cluster record, so re-running Compact on a
+	// conversation that's already been clustered doesn't re-cluster (and
+	// shrink the sample of) its own output.
+	patternClusterMarkerKey = "_contextguard_pattern_cluster"
+)
+
+// patternGroup is one Drain log-cluster group: a token-position template
+// with patternWildcard standing in for positions that have varied across
+// the occurrences merged into it.
+type patternGroup struct {
+	template      []string
+	count         int
+	firstSeenTurn int
+	lastSeenTurn  int
+	sample        string // the line that created this group
+}
+
+// render produces the compact record that replaces the raw tool response:
+// the template, how many times it's been seen, the turn range it spans,
+// and a preview of the line that created the group as a stand-in for the
+// wildcarded positions' sample values.
+func (g *patternGroup) render() string {
+	return fmt.Sprintf(
+		"template=%q occurrences=%d first_seen_turn=%d last_seen_turn=%d sample=%q",
+		strings.Join(g.template, " "), g.count, g.firstSeenTurn, g.lastSeenTurn,
+		truncatePreview(g.sample, patternSamplePreviewChars),
+	)
+}
+
+func truncatePreview(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// patternLeaf holds every group seen for one patternKey bucket.
+type patternLeaf struct {
+	groups []*patternGroup
+}
+
+// patternKey is Drain's fixed-depth prefix: routing a line by (tool name,
+// token count, first depth tokens) narrows comparison to a small bucket of
+// candidate groups instead of the full clustering history.
+type patternKey struct {
+	tool       string
+	tokenCount int
+	prefix     string
+}
+
+// patternTree is a Drain-style online log clusterer, one per
+// PatternCompactor (so templates persist across BeforeModelCallback
+// invocations for the lifetime of an agent, the same way ratioTracker
+// persists calibration across calls).
+type patternTree struct {
+	mu sync.Mutex
+
+	leaves map[patternKey]*patternLeaf
+
+	// depth is how many leading tokens key the prefix bucket. newPatternTree
+	// sets this to 1 (route by first token alone, PatternCompactor's
+	// original behavior); newPatternTreeWithDepth lets
+	// toolResultPatternCompressor configure a deeper prefix for a tighter
+	// bucket.
+	depth int
+
+	// similarity is the bestMatchingGroup threshold a candidate must clear
+	// to merge into an existing group instead of starting a new one.
+	similarity float64
+}
+
+func newPatternTree() *patternTree {
+	return newPatternTreeWithDepth(1, patternSimilarityThreshold)
+}
+
+// newPatternTreeWithDepth creates a patternTree bucketing on the first
+// depth tokens (depth <= 0 falls back to 1) and merging into an existing
+// group once similarity (<= 0 falls back to patternSimilarityThreshold) of
+// token positions agree.
+func newPatternTreeWithDepth(depth int, similarity float64) *patternTree {
+	if depth <= 0 {
+		depth = 1
+	}
+	if similarity <= 0 {
+		similarity = patternSimilarityThreshold
+	}
+	return &patternTree{leaves: make(map[patternKey]*patternLeaf), depth: depth, similarity: similarity}
+}
+
+// observe tokenizes line by whitespace, routes it to a bucket by (tool,
+// token count, first p.depth tokens), and either merges it into the
+// best-matching group in that bucket or starts a new one.
+func (p *patternTree) observe(tool, line string, turn int) *patternGroup {
+	tokens := strings.Fields(line)
+	if len(tokens) == 0 {
+		tokens = []string{""}
+	}
+	prefixLen := min(p.depth, len(tokens))
+	key := patternKey{tool: tool, tokenCount: len(tokens), prefix: strings.Join(tokens[:prefixLen], "\x1f")}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	leaf, ok := p.leaves[key]
+	if !ok {
+		leaf = &patternLeaf{}
+		p.leaves[key] = leaf
+	}
+
+	if best := bestMatchingGroup(leaf.groups, tokens, p.similarity); best != nil {
+		mergeIntoGroup(best, tokens)
+		best.count++
+		best.lastSeenTurn = turn
+		return best
+	}
+
+	group := &patternGroup{
+		template:      append([]string(nil), tokens...),
+		count:         1,
+		firstSeenTurn: turn,
+		lastSeenTurn:  turn,
+		sample:        line,
+	}
+	leaf.groups = append(leaf.groups, group)
+	return group
+}
+
+// bestMatchingGroup returns the group whose template has the highest
+// token-position similarity to tokens, or nil if none clears threshold.
+func bestMatchingGroup(groups []*patternGroup, tokens []string, threshold float64) *patternGroup {
+	var best *patternGroup
+	bestScore := 0.0
+	for _, g := range groups {
+		score := templateSimilarity(g.template, tokens)
+		if score >= threshold && score > bestScore {
+			best, bestScore = g, score
+		}
+	}
+	return best
+}
+
+// templateSimilarity returns the fraction of positions where template and
+// tokens agree, treating an already-wildcarded template position as an
+// automatic match since it already stands for "any token here".
+func templateSimilarity(template, tokens []string) float64 {
+	if len(template) != len(tokens) {
+		return 0
+	}
+	if len(template) == 0 {
+		return 1
+	}
+	matches := 0
+	for i, t := range template {
+		if t == patternWildcard || t == tokens[i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(template))
+}
+
+// mergeIntoGroup widens g's template to a wildcard at every position where
+// tokens disagrees with it.
+func mergeIntoGroup(g *patternGroup, tokens []string) {
+	for i, t := range g.template {
+		if t != patternWildcard && t != tokens[i] {
+			g.template[i] = patternWildcard
+		}
+	}
+}
+
+// PatternCompactor is a Strategy that runs a Drain-style online
+// log-clustering pass over historical tool responses before falling back
+// to fallback's usual threshold-based summarization. Each historical tool
+// response is replaced in place by its Drain group's {template,
+// occurrence_count, ...} record. Every response keeps its own record, so
+// the total size still grows with the number of responses, and a record
+// (which carries the full template plus a sample preview) is not
+// necessarily smaller than the response it replaces.
+type PatternCompactor struct {
+	fallback *thresholdStrategy
+	tree     *patternTree
+	mu       sync.Mutex
+
+	// recentKeep is how many of the most recent Content entries are left
+	// completely untouched, mirroring thresholdStrategy's rule that the
+	// tail the model is about to reason from is never rewritten.
+	recentKeep int
+}
+
+// newPatternCompactor creates a PatternCompactor backed by fallback for
+// whatever compaction the clustering pass alone doesn't resolve.
+func newPatternCompactor(fallback *thresholdStrategy) *PatternCompactor {
+	return &PatternCompactor{
+		fallback:   fallback,
+		tree:       newPatternTree(),
+		recentKeep: defaultPatternRecentKeep,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (p *PatternCompactor) Name() string {
+	return StrategyPattern
+}
+
+// contextWindowFor delegates to fallback. Implements streamWindowStrategy.
+func (p *PatternCompactor) contextWindowFor(req *model.LLMRequest) int {
+	return p.fallback.contextWindowFor(req)
+}
+
+// Compact checks the token estimate against fallback's context window and,
+// if exceeded, clusters historical tool responses in place before
+// delegating to fallback.Compact for whatever full-conversation
+// summarization the clustering pass alone didn't resolve.
+func (p *PatternCompactor) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	contextWindow := p.contextWindowFor(req)
+	threshold := contextWindow - computeBuffer(contextWindow)
+
+	if tokenCount(ctx, req) >= threshold {
+		p.clusterHistoricalResponses(ctx, req)
+	}
+
+	return p.fallback.Compact(ctx, req)
+}
+
+// clusterHistoricalResponses replaces the FunctionResponse payload of
+// every tool-response Content older than the most recent recentKeep
+// entries with its Drain-cluster record, skipping any that are already
+// marked as clustered. The FunctionCall/FunctionResponse entries
+// themselves are never removed, so tool_use/tool_result pairing is
+// unaffected — only the bulky response payload shrinks.
+func (p *PatternCompactor) clusterHistoricalResponses(ctx agent.CallbackContext, req *model.LLMRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	boundary := len(req.Contents) - p.recentKeep
+	if boundary <= 0 {
+		return
+	}
+	boundary = safeSplitIndex(req.Contents, boundary)
+
+	clustered := 0
+	for i := 0; i < boundary; i++ {
+		c := req.Contents[i]
+		if c == nil || c.Role != "user" {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			if already, _ := part.FunctionResponse.Response[patternClusterMarkerKey].(bool); already {
+				continue
+			}
+			rendered := fmt.Sprintf("%v", part.FunctionResponse.Response)
+			group := p.tree.observe(part.FunctionResponse.Name, rendered, i)
+			part.FunctionResponse.Response = map[string]any{
+				"result":                group.render(),
+				patternClusterMarkerKey: true,
+			}
+			clustered++
+		}
+	}
+
+	if clustered > 0 {
+		slog.Info("ContextGuard [pattern]: clustered historical tool responses",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"boundary", boundary,
+			"responsesClustered", clustered,
+		)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// defaultPatternCompressionDepth is the Drain prefix depth
+	// toolResultPatternCompressor uses when WithToolResultPatternCompression
+	// isn't given WithPatternCompressionDepth: deeper than PatternCompactor's
+	// depth-1 bucketing, since this pass additionally merges whole pairs
+	// away and a tighter bucket keeps unrelated tool calls from colliding.
+	defaultPatternCompressionDepth = 3
+
+	// defaultPatternCompressionSimilarity mirrors patternSimilarityThreshold,
+	// the existing Drain similarity floor PatternCompactor already tunes
+	// against.
+	defaultPatternCompressionSimilarity = patternSimilarityThreshold
+
+	// defaultPatternCompressionMinClusterSize is how many near-identical
+	// tool-call/tool-result pairs a template must accumulate before
+	// toolResultPatternCompressor merges them into one synthetic content.
+	defaultPatternCompressionMinClusterSize = 3
+)
+
+// toolResultPatternCompressionConfig holds the knobs set via
+// WithToolResultPatternCompression's PatternCompressionOptions.
+type toolResultPatternCompressionConfig struct {
+	depth          int
+	similarity     float64
+	minClusterSize int
+}
+
+// toolResultPatternCompressor runs a Drain-style clustering pass (see
+// patternTree) over the FunctionCall/FunctionResponse pairs in a
+// conversation and, unlike PatternCompactor's in-place per-response
+// shrinking, merges whole clusters of minClusterSize or more near-identical
+// pairs into a single synthetic content — reducing entry count rather than
+// just payload size, which is what a pre-summarization pass wants since
+// every pair still costs the summarizer a slice of its turn budget. One
+// compressor persists its patternTree for the lifetime of the owning
+// strategy, so templates learned on an early call keep matching later
+// occurrences of the same shape.
+type toolResultPatternCompressor struct {
+	tree           *patternTree
+	minClusterSize int
+	mu             sync.Mutex
+}
+
+// newToolResultPatternCompressor creates a compressor from cfg, applying
+// defaultPatternCompressionDepth/Similarity/MinClusterSize for zero-valued
+// fields.
+func newToolResultPatternCompressor(cfg toolResultPatternCompressionConfig) *toolResultPatternCompressor {
+	depth := cfg.depth
+	if depth <= 0 {
+		depth = defaultPatternCompressionDepth
+	}
+	similarity := cfg.similarity
+	if similarity <= 0 {
+		similarity = defaultPatternCompressionSimilarity
+	}
+	minClusterSize := cfg.minClusterSize
+	if minClusterSize <= 0 {
+		minClusterSize = defaultPatternCompressionMinClusterSize
+	}
+	return &toolResultPatternCompressor{
+		tree:           newPatternTreeWithDepth(depth, similarity),
+		minClusterSize: minClusterSize,
+	}
+}
+
+// compress clusters the FunctionCall/FunctionResponse pairs (matched by
+// toolPairSpans) whose response sits before boundary, then replaces every
+// cluster that reaches c.minClusterSize members with a single synthetic
+// content in place of all its member pairs, preserving the order and
+// identity of everything else — including pairs at or after boundary,
+// which are left untouched the same way recentKeep tails are elsewhere in
+// the package. boundary is expected to already sit on a pair boundary (see
+// safeSplitIndex), so no span straddles it. Returns the rewritten slice
+// (contents itself, unmodified, if nothing qualified) and how many
+// clusters were compressed.
+func (c *toolResultPatternCompressor) compress(contents []*genai.Content, boundary int) ([]*genai.Content, int) {
+	if boundary <= 0 || boundary > len(contents) {
+		return contents, 0
+	}
+
+	var pairs []toolPairSpan
+	for _, p := range toolPairSpans(contents) {
+		if p.respIdx < boundary {
+			pairs = append(pairs, p)
+		}
+	}
+	if len(pairs) == 0 {
+		return contents, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groupOf := make(map[int]*patternGroup, len(pairs))
+	membersOf := make(map[*patternGroup][]toolPairSpan)
+	var order []*patternGroup
+	seen := make(map[*patternGroup]bool)
+
+	for _, p := range pairs {
+		resp := contents[p.respIdx]
+		name := functionResponseName(resp)
+		rendered := functionResponseText(resp)
+		group := c.tree.observe(name, rendered, p.respIdx)
+		groupOf[p.respIdx] = group
+		if !seen[group] {
+			seen[group] = true
+			order = append(order, group)
+		}
+		membersOf[group] = append(membersOf[group], p)
+	}
+
+	skip := make(map[int]bool)
+	replace := make(map[int]*genai.Content)
+	compressed := 0
+	for _, g := range order {
+		members := membersOf[g]
+		if len(members) < c.minClusterSize {
+			continue
+		}
+
+		first := members[0]
+		replace[first.callIdx] = syntheticClusterContent(g, contents, members)
+		skip[first.respIdx] = true
+		for _, p := range members[1:] {
+			skip[p.callIdx] = true
+			skip[p.respIdx] = true
+		}
+		compressed++
+	}
+
+	if compressed == 0 {
+		return contents, 0
+	}
+
+	out := make([]*genai.Content, 0, len(contents))
+	for i, content := range contents {
+		if synthetic, ok := replace[i]; ok {
+			out = append(out, synthetic)
+			continue
+		}
+		if skip[i] {
+			continue
+		}
+		out = append(out, content)
+	}
+	return out, compressed
+}
+
+// syntheticClusterContent builds the single content that replaces every
+// member of a compressed cluster: the Drain template, the group's
+// lifetime occurrence count, and a short sample of up to three member
+// responses so a human (or the summarizer) can see what varied.
+func syntheticClusterContent(g *patternGroup, contents []*genai.Content, members []toolPairSpan) *genai.Content {
+	variants := make([]string, 0, 3)
+	for _, p := range members {
+		if len(variants) >= 3 {
+			break
+		}
+		variants = append(variants, truncatePreview(functionResponseText(contents[p.respIdx]), patternSamplePreviewChars))
+	}
+
+	return &genai.Content{
+		Role: "user",
+		Parts: []*genai.Part{{
+			Text: fmt.Sprintf("%s (observed %d times, variants: %s)",
+				strings.Join(g.template, " "), g.count, strings.Join(variants, " | ")),
+		}},
+	}
+}
+
+// functionResponseName returns the tool name of c's first FunctionResponse
+// part, or "" if it has none.
+func functionResponseName(c *genai.Content) string {
+	for _, part := range c.Parts {
+		if part != nil && part.FunctionResponse != nil {
+			return part.FunctionResponse.Name
+		}
+	}
+	return ""
+}
+
+// functionResponseText renders c's first FunctionResponse payload the same
+// way PatternCompactor.clusterHistoricalResponses does, so the two passes
+// cluster identical templates identically.
+func functionResponseText(c *genai.Content) string {
+	for _, part := range c.Parts {
+		if part != nil && part.FunctionResponse != nil {
+			return fmt.Sprintf("%v", part.FunctionResponse.Response)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func toolCallResponseContents(name string, n int, responseSize int) []*genai.Content {
+	var contents []*genai.Content
+	for i := 0; i < n; i++ {
+		contents = append(contents,
+			&genai.Content{Role: "model", Parts: []*genai.Part{{
+				FunctionCall: &genai.FunctionCall{Name: name, Args: map[string]any{"param": "value"}},
+			}}},
+			&genai.Content{Role: "user", Parts: []*genai.Part{{
+				FunctionResponse: &genai.FunctionResponse{Name: name, Response: map[string]any{"result": strings.Repeat("x", responseSize)}},
+			}}},
+		)
+	}
+	return contents
+}
+
+func TestToolResultPatternCompressor_MergesClusterIntoSingleContent(t *testing.T) {
+	c := newToolResultPatternCompressor(toolResultPatternCompressionConfig{minClusterSize: 3})
+
+	contents := toolCallResponseContents("kubectl_get_pods", 5, 200)
+	contents = append(contents, textContent("user", "what's the status"))
+
+	out, n := c.compress(contents, len(contents)-1)
+	if n != 1 {
+		t.Fatalf("clusters compressed = %d, want 1", n)
+	}
+	// 5 pairs (10 entries) collapse into 1 synthetic content, plus the
+	// trailing text content left untouched.
+	if len(out) != 2 {
+		t.Fatalf("len(out) = %d, want 2 (1 synthetic + 1 untouched tail)", len(out))
+	}
+	if out[0].Role != "user" || out[0].Parts[0].FunctionCall != nil || out[0].Parts[0].FunctionResponse != nil {
+		t.Errorf("expected a plain-text synthetic content, got %+v", out[0])
+	}
+	if !strings.Contains(out[0].Parts[0].Text, "observed 5 times") {
+		t.Errorf("synthetic content = %q, want it to mention the occurrence count", out[0].Parts[0].Text)
+	}
+}
+
+func TestToolResultPatternCompressor_LeavesSmallClusterUntouched(t *testing.T) {
+	c := newToolResultPatternCompressor(toolResultPatternCompressionConfig{minClusterSize: 5})
+
+	contents := toolCallResponseContents("kubectl_get_pods", 3, 200)
+
+	out, n := c.compress(contents, len(contents))
+	if n != 0 {
+		t.Fatalf("clusters compressed = %d, want 0 (below minClusterSize)", n)
+	}
+	if len(out) != len(contents) {
+		t.Errorf("len(out) = %d, want %d (untouched)", len(out), len(contents))
+	}
+}
+
+func TestToolResultPatternCompressor_SeparatesDistinctToolNames(t *testing.T) {
+	c := newToolResultPatternCompressor(toolResultPatternCompressionConfig{minClusterSize: 3})
+
+	var contents []*genai.Content
+	contents = append(contents, toolCallResponseContents("kubectl_get_pods", 3, 200)...)
+	contents = append(contents, toolCallResponseContents("kubectl_logs", 3, 200)...)
+
+	out, n := c.compress(contents, len(contents))
+	if n != 2 {
+		t.Fatalf("clusters compressed = %d, want 2 (one per tool name)", n)
+	}
+	if len(out) != 2 {
+		t.Fatalf("len(out) = %d, want 2 (one synthetic content per tool)", len(out))
+	}
+}
+
+func TestToolResultPatternCompressor_RespectsBoundary(t *testing.T) {
+	c := newToolResultPatternCompressor(toolResultPatternCompressionConfig{minClusterSize: 3})
+
+	contents := toolCallResponseContents("kubectl_get_pods", 6, 200)
+	boundary := 4 // only the first two pairs are in scope
+
+	out, n := c.compress(contents, boundary)
+	if n != 0 {
+		t.Fatalf("clusters compressed = %d, want 0 (only 2 pairs before boundary, below minClusterSize)", n)
+	}
+	if len(out) != len(contents) {
+		t.Errorf("len(out) = %d, want %d (untouched)", len(out), len(contents))
+	}
+}
+
+func TestToolResultPatternCompressor_PreservesToolPairing(t *testing.T) {
+	c := newToolResultPatternCompressor(toolResultPatternCompressionConfig{minClusterSize: 3})
+
+	contents := toolCallResponseContents("kubectl_get_pods", 5, 200)
+	out, n := c.compress(contents, len(contents))
+	if n != 1 {
+		t.Fatalf("clusters compressed = %d, want 1", n)
+	}
+	validateToolPairing(t, out, 0)
+}
+
+func TestThresholdStrategy_ToolResultPatternCompression_RunsBeforeSummarization(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"small-model": 50_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+	llm := &mockLLM{name: "small-model", response: "Summarized"}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetToolResultPatternCompression(toolResultPatternCompressionConfig{minClusterSize: 3})
+	ctx := newMockCallbackContext("agent1")
+
+	contents := toolCallResponseContents("kubectl_get_pods", 10, 200)
+	contents = append(contents, textContent("user", "ok"))
+	req := &model.LLMRequest{Model: "small-model", Contents: contents}
+
+	rawLen := len(req.Contents)
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	if len(req.Contents) >= rawLen {
+		t.Errorf("expected pattern compression to shrink req.Contents below its raw length %d, got %d", rawLen, len(req.Contents))
+	}
+}
+
+func TestAdd_WithToolResultPatternCompression(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithToolResultPatternCompression(
+		WithPatternCompressionDepth(2),
+		WithPatternCompressionSimilarity(0.7),
+		WithPatternCompressionMinClusterSize(4),
+	))
+
+	s, ok := guard.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.patternCompressor == nil {
+		t.Fatal("expected patternCompressor to be configured")
+	}
+	if s.patternCompressor.minClusterSize != 4 {
+		t.Errorf("minClusterSize = %d, want 4", s.patternCompressor.minClusterSize)
+	}
+}
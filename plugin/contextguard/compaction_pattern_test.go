@@ -0,0 +1,207 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestTemplateSimilarity_IdenticalTokensIsFullMatch(t *testing.T) {
+	got := templateSimilarity([]string{"pod", "nginx-1", "Running"}, []string{"pod", "nginx-1", "Running"})
+	if got != 1.0 {
+		t.Errorf("identical token sequences: got similarity %v, want 1.0", got)
+	}
+}
+
+func TestTemplateSimilarity_DifferentLengthIsZero(t *testing.T) {
+	got := templateSimilarity([]string{"a", "b"}, []string{"a", "b", "c"})
+	if got != 0 {
+		t.Errorf("different lengths: got similarity %v, want 0", got)
+	}
+}
+
+func TestTemplateSimilarity_WildcardPositionAlwaysMatches(t *testing.T) {
+	got := templateSimilarity([]string{"pod", patternWildcard, "Running"}, []string{"pod", "nginx-2", "Running"})
+	if got != 1.0 {
+		t.Errorf("wildcard position should match any token: got %v, want 1.0", got)
+	}
+}
+
+func TestMergeIntoGroup_WidensDivergentPositions(t *testing.T) {
+	g := &patternGroup{template: []string{"pod", "nginx-1", "Running"}}
+	mergeIntoGroup(g, []string{"pod", "nginx-2", "Running"})
+
+	want := []string{"pod", patternWildcard, "Running"}
+	for i, tok := range want {
+		if g.template[i] != tok {
+			t.Errorf("template[%d] = %q, want %q", i, g.template[i], tok)
+		}
+	}
+}
+
+func TestPatternTree_ObserveMergesSimilarLines(t *testing.T) {
+	tree := newPatternTree()
+
+	g1 := tree.observe("kubectl_get_pods", "pod nginx-1 Running", 0)
+	g2 := tree.observe("kubectl_get_pods", "pod nginx-2 Running", 1)
+
+	if g1 != g2 {
+		t.Fatalf("expected the second near-identical line to merge into the first line's group")
+	}
+	if g1.count != 2 {
+		t.Errorf("group count = %d, want 2", g1.count)
+	}
+	if g1.template[1] != patternWildcard {
+		t.Errorf("varying position should have been wildcarded, got template %v", g1.template)
+	}
+}
+
+func TestPatternTree_ObserveSeparatesDissimilarLines(t *testing.T) {
+	tree := newPatternTree()
+
+	g1 := tree.observe("kubectl_get_pods", "pod nginx-1 Running", 0)
+	g2 := tree.observe("kubectl_get_pods", "error: connection refused", 1)
+
+	if g1 == g2 {
+		t.Fatalf("expected a dissimilar line to start a new group instead of merging")
+	}
+}
+
+func TestPatternTree_ObserveSeparatesByTool(t *testing.T) {
+	tree := newPatternTree()
+
+	g1 := tree.observe("kubectl_get_pods", "pod nginx-1 Running", 0)
+	g2 := tree.observe("kubectl_logs", "pod nginx-1 Running", 0)
+
+	if g1 == g2 {
+		t.Fatalf("expected lines from different tools to never share a group, even with identical text")
+	}
+}
+
+// TestPatternCompactor_ClustersRepeatedResponsesToOBytesForKTemplates builds
+// a conversation with n tool-response pairs spread across only k distinct
+// response shapes (two tools, each always returning the same-length
+// payload) and asserts that after clustering, the total size of the
+// responses is bounded by k rather than growing with n — the request's
+// explicit ask that repeated-tool storms compact to O(k) bytes for k
+// unique templates rather than O(n) bytes for n turns.
+func TestPatternCompactor_ClustersRepeatedResponsesToOBytesForKTemplates(t *testing.T) {
+	const n = 40
+	const responseSize = 500
+
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	fallback := newThresholdStrategy(registry, llm, 8_000)
+	pc := newPatternCompactor(fallback)
+	pc.recentKeep = 0 // cluster everything for this byte-accounting test
+
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "small-model",
+		Contents: []*genai.Content{textContent("user", "investigate")},
+	}
+
+	for i := 0; i < n; i++ {
+		name := "kubectl_get_pods"
+		if i%2 == 1 {
+			name = "kubectl_logs"
+		}
+		req.Contents = append(req.Contents,
+			&genai.Content{Role: "model", Parts: []*genai.Part{{
+				FunctionCall: &genai.FunctionCall{Name: name, Args: map[string]any{"param": "value"}},
+			}}},
+			&genai.Content{Role: "user", Parts: []*genai.Part{{
+				FunctionResponse: &genai.FunctionResponse{Name: name, Response: map[string]any{"result": strings.Repeat("x", responseSize)}},
+			}}},
+		)
+	}
+
+	rawBytes := responseBytes(req.Contents)
+
+	pc.clusterHistoricalResponses(ctx, req)
+
+	clusteredBytes := responseBytes(req.Contents)
+
+	if clusteredBytes >= rawBytes {
+		t.Fatalf("clustering did not shrink responses: raw=%d clustered=%d", rawBytes, clusteredBytes)
+	}
+
+	// Only two unique templates (kubectl_get_pods, kubectl_logs) exist, so
+	// the clustered size should be a small constant multiple of a single
+	// rendered record, not scale with n.
+	maxExpected := 2 * patternSamplePreviewChars * 4
+	if clusteredBytes > maxExpected {
+		t.Errorf("clustered bytes %d exceeded O(k) bound %d for k=2 templates (raw was %d for n=%d)",
+			clusteredBytes, maxExpected, rawBytes, n)
+	}
+
+	validateToolPairing(t, req.Contents, n)
+}
+
+func TestPatternCompactor_IdempotentAcrossRepeatedCompact(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	fallback := newThresholdStrategy(registry, llm, 8_000)
+	pc := newPatternCompactor(fallback)
+	pc.recentKeep = 0
+
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model: "small-model",
+		Contents: []*genai.Content{
+			textContent("user", "investigate"),
+			{Role: "model", Parts: []*genai.Part{{
+				FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods", Args: map[string]any{"param": "value"}},
+			}}},
+			{Role: "user", Parts: []*genai.Part{{
+				FunctionResponse: &genai.FunctionResponse{Name: "kubectl_get_pods", Response: map[string]any{"result": strings.Repeat("x", 500)}},
+			}}},
+		},
+	}
+
+	pc.clusterHistoricalResponses(ctx, req)
+	firstPass := fmt.Sprintf("%v", req.Contents[2].Parts[0].FunctionResponse.Response)
+
+	pc.clusterHistoricalResponses(ctx, req)
+	secondPass := fmt.Sprintf("%v", req.Contents[2].Parts[0].FunctionResponse.Response)
+
+	if firstPass != secondPass {
+		t.Errorf("second clustering pass re-rendered an already-clustered response: first=%q second=%q", firstPass, secondPass)
+	}
+}
+
+// responseBytes sums the rendered length of every FunctionResponse payload
+// in contents.
+func responseBytes(contents []*genai.Content) int {
+	total := 0
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			total += len(fmt.Sprintf("%v", part.FunctionResponse.Response))
+		}
+	}
+	return total
+}
@@ -0,0 +1,214 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// defaultPoolMaxConcurrent is SummarizationPool's default MaxConcurrent when
+// NewSummarizationPool is called with a non-positive value.
+const defaultPoolMaxConcurrent = 100
+
+// SummarizationPool bounds and deduplicates summarize calls shared across
+// every agent registered on a ContextGuard. Under an agent-storm workload —
+// many agents compacting around the same time, or one tool response
+// fanned out to several sub-agents that each see overlapping history — it
+// keeps at most MaxConcurrent summarize calls in flight at once, and
+// collapses concurrent requests for the same (contents, previousSummary,
+// model) into a single in-flight LLM call shared by every caller.
+//
+// A SummarizationPool is safe for concurrent use and is meant to be created
+// once per ContextGuard (see WithSummarizationPool) and shared by every
+// agent's Strategy, the same way ContextGuard.ratios is shared.
+type SummarizationPool struct {
+	sem chan struct{}
+
+	mu       sync.Mutex
+	inFlight map[string]*poolJob
+
+	metrics poolMetrics
+}
+
+// poolJob tracks one in-flight (or just-completed) summarize call that
+// other callers with a matching dedup key can wait on and share.
+type poolJob struct {
+	done   chan struct{}
+	result string
+	err    error
+}
+
+// poolMetrics holds SummarizationPool's Prometheus-style counters and wall
+// time histogram. All fields are safe for concurrent use independently.
+type poolMetrics struct {
+	jobsQueued   atomic.Int64
+	jobsInFlight atomic.Int64
+	dedupHits    atomic.Int64
+	llmErrors    atomic.Int64
+
+	mu       sync.Mutex
+	wallTime *hdrHistogram
+}
+
+// SummarizationPoolMetrics is a point-in-time snapshot of a
+// SummarizationPool's counters, suitable for exposing through a Prometheus
+// exporter (see MetricsPrometheusExporter) or logging periodically.
+type SummarizationPoolMetrics struct {
+	// JobsQueued is the total number of Summarize calls made, including
+	// ones that were satisfied by joining an in-flight or deduped job.
+	JobsQueued int64
+
+	// JobsInFlight is the number of summarize calls currently executing
+	// against the LLM (i.e. not yet joined or deduped).
+	JobsInFlight int64
+
+	// DedupHits is the number of Summarize calls that were satisfied by an
+	// in-flight call for the same (contents, previousSummary, model) key
+	// instead of making their own LLM round-trip.
+	DedupHits int64
+
+	// LLMErrors is the number of summarize calls whose LLM round-trip
+	// returned an error.
+	LLMErrors int64
+
+	// WallTime is the distribution of wall-clock durations of summarize
+	// calls that actually reached the LLM (i.e. excluding DedupHits).
+	WallTime HistogramSnapshot
+}
+
+// NewSummarizationPool creates a SummarizationPool that allows at most
+// maxConcurrent summarize calls to run against the LLM at once. A
+// non-positive maxConcurrent selects defaultPoolMaxConcurrent.
+func NewSummarizationPool(maxConcurrent int) *SummarizationPool {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultPoolMaxConcurrent
+	}
+	return &SummarizationPool{
+		sem:      make(chan struct{}, maxConcurrent),
+		inFlight: make(map[string]*poolJob),
+		metrics: poolMetrics{
+			wallTime: newHDRHistogram(),
+		},
+	}
+}
+
+// Summarize submits a summarize job to the pool, blocking until either a
+// worker slot is free and the LLM call completes, or ctx is canceled. Jobs
+// with an identical (contents, previousSummary, llm.Name()) key that are
+// already in flight are joined rather than re-submitted, so two agents
+// compacting overlapping histories pay for one LLM call between them.
+func (p *SummarizationPool) Summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem) (string, error) {
+	p.metrics.jobsQueued.Add(1)
+
+	key := poolJobKey(contents, previousSummary, llm.Name())
+
+	p.mu.Lock()
+	if job, ok := p.inFlight[key]; ok {
+		p.mu.Unlock()
+		p.metrics.dedupHits.Add(1)
+		select {
+		case <-job.done:
+			return job.result, job.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	job := &poolJob{done: make(chan struct{})}
+	p.inFlight[key] = job
+	p.mu.Unlock()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		job.err = ctx.Err()
+		p.mu.Lock()
+		delete(p.inFlight, key)
+		p.mu.Unlock()
+		close(job.done)
+		return "", ctx.Err()
+	}
+
+	p.metrics.jobsInFlight.Add(1)
+	start := time.Now()
+	job.result, job.err = summarize(ctx, llm, contents, previousSummary, bufferTokens, todos)
+	p.metrics.wallTime.Record(int(time.Since(start).Milliseconds()))
+	p.metrics.jobsInFlight.Add(-1)
+	<-p.sem
+
+	if job.err != nil {
+		p.metrics.llmErrors.Add(1)
+	}
+
+	p.mu.Lock()
+	delete(p.inFlight, key)
+	p.mu.Unlock()
+	close(job.done)
+
+	return job.result, job.err
+}
+
+// Metrics returns a point-in-time snapshot of the pool's counters.
+func (p *SummarizationPool) Metrics() SummarizationPoolMetrics {
+	p.metrics.mu.Lock()
+	wallTime := p.metrics.wallTime.Snapshot()
+	p.metrics.mu.Unlock()
+
+	return SummarizationPoolMetrics{
+		JobsQueued:   p.metrics.jobsQueued.Load(),
+		JobsInFlight: p.metrics.jobsInFlight.Load(),
+		DedupHits:    p.metrics.dedupHits.Load(),
+		LLMErrors:    p.metrics.llmErrors.Load(),
+		WallTime:     wallTime,
+	}
+}
+
+// poolJobKey computes a stable dedup key for a summarize job from the
+// contents being summarized, the previous summary carried forward, and the
+// target model name — two calls with an identical key are asking the LLM
+// the same question and can share one in-flight answer.
+func poolJobKey(contents []*genai.Content, previousSummary, llmModel string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", llmModel, previousSummary)
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00", c.Role)
+		for _, part := range c.Parts {
+			if part == nil {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00", part.Text)
+			if part.FunctionCall != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionCall.Name, part.FunctionCall.Args)
+			}
+			if part.FunctionResponse != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionResponse.Name, part.FunctionResponse.Response)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,214 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// blockingLLM blocks inside GenerateContent until release is closed,
+// counting how many times it was actually invoked, for exercising
+// SummarizationPool's dedup and concurrency-bound behavior.
+type blockingLLM struct {
+	name    string
+	release chan struct{}
+	calls   atomic.Int64
+	failErr error
+}
+
+func (l *blockingLLM) Name() string { return l.name }
+
+func (l *blockingLLM) GenerateContent(_ context.Context, _ *model.LLMRequest, _ bool) iter.Seq2[*model.LLMResponse, error] {
+	l.calls.Add(1)
+	<-l.release
+	return func(yield func(*model.LLMResponse, error) bool) {
+		if l.failErr != nil {
+			yield(nil, l.failErr)
+			return
+		}
+		yield(&model.LLMResponse{
+			Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "summary"}}},
+		}, nil)
+	}
+}
+
+func TestSummarizationPool_DedupsInFlightCalls(t *testing.T) {
+	llm := &blockingLLM{name: "gpt-4o", release: make(chan struct{})}
+	pool := NewSummarizationPool(10)
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hello"}}}}
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	errs := make([]error, 2)
+	for i := range 2 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = pool.Summarize(context.Background(), llm, contents, "", 1000, nil)
+		}(i)
+	}
+
+	// Give both goroutines a chance to reach the LLM/join point before
+	// releasing, so the second one observes the first as in-flight.
+	time.Sleep(20 * time.Millisecond)
+	close(llm.release)
+	wg.Wait()
+
+	if llm.calls.Load() != 1 {
+		t.Errorf("LLM invoked %d times, want exactly 1 for two identical concurrent requests", llm.calls.Load())
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Summarize()[%d] error: %v", i, err)
+		}
+	}
+	if results[0] != results[1] {
+		t.Errorf("results differ between joined callers: %q vs %q", results[0], results[1])
+	}
+
+	metrics := pool.Metrics()
+	if metrics.JobsQueued != 2 {
+		t.Errorf("JobsQueued = %d, want 2", metrics.JobsQueued)
+	}
+	if metrics.DedupHits != 1 {
+		t.Errorf("DedupHits = %d, want 1", metrics.DedupHits)
+	}
+}
+
+// TestSummarizationPool_OwnerCancelWhileQueuedPropagatesErrorToJoiners
+// guards against a deduped joiner silently observing a successful empty
+// summary when the job-owning caller's context is canceled while it's
+// still waiting for a semaphore slot (before the LLM is ever called).
+func TestSummarizationPool_OwnerCancelWhileQueuedPropagatesErrorToJoiners(t *testing.T) {
+	llm := &blockingLLM{name: "gpt-4o", release: make(chan struct{})}
+	defer close(llm.release)
+	pool := NewSummarizationPool(1)
+
+	// Occupy the pool's only slot with an unrelated job so the owner below
+	// has to queue for the semaphore instead of reaching the LLM.
+	filler := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "filler"}}}}
+	go pool.Summarize(context.Background(), llm, filler, "", 1000, nil)
+	time.Sleep(20 * time.Millisecond)
+
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "shared"}}}}
+	ownerCtx, cancel := context.WithCancel(context.Background())
+
+	ownerStarted := make(chan struct{})
+	ownerDone := make(chan struct{})
+	go func() {
+		close(ownerStarted)
+		pool.Summarize(ownerCtx, llm, contents, "", 1000, nil)
+		close(ownerDone)
+	}()
+	<-ownerStarted
+	time.Sleep(20 * time.Millisecond) // let the owner register its job before we join it
+
+	joinResult := make(chan string, 1)
+	joinErr := make(chan error, 1)
+	go func() {
+		result, err := pool.Summarize(context.Background(), llm, contents, "", 1000, nil)
+		joinResult <- result
+		joinErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // let the joiner reach the dedup wait
+
+	cancel()
+	<-ownerDone
+
+	select {
+	case err := <-joinErr:
+		if err == nil {
+			t.Fatal("joiner observed a nil error for a job whose owner's context was canceled")
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("joiner error = %v, want context.Canceled", err)
+		}
+		if result := <-joinResult; result != "" {
+			t.Errorf("joiner result = %q, want empty alongside the error", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("joiner never observed the owner's cancellation")
+	}
+}
+
+func TestSummarizationPool_BoundsConcurrency(t *testing.T) {
+	llm := &blockingLLM{name: "gpt-4o", release: make(chan struct{})}
+	pool := NewSummarizationPool(1)
+
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "distinct"}, {Text: string(rune('a' + i))}}}}
+			_, _ = pool.Summarize(context.Background(), llm, contents, "", 1000, nil)
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if inFlight := pool.Metrics().JobsInFlight; inFlight > 1 {
+		t.Errorf("JobsInFlight = %d, want at most 1 with MaxConcurrent=1", inFlight)
+	}
+	close(llm.release)
+	wg.Wait()
+
+	if llm.calls.Load() != 2 {
+		t.Errorf("LLM invoked %d times, want 2 for two distinct requests", llm.calls.Load())
+	}
+}
+
+func TestSummarizationPool_RecordsLLMErrors(t *testing.T) {
+	llm := &blockingLLM{name: "gpt-4o", release: make(chan struct{}), failErr: errors.New("boom")}
+	close(llm.release)
+	pool := NewSummarizationPool(1)
+
+	_, err := pool.Summarize(context.Background(), llm, nil, "", 1000, nil)
+	if err == nil {
+		t.Fatal("Summarize() with a failing LLM: got nil error")
+	}
+
+	if got := pool.Metrics().LLMErrors; got != 1 {
+		t.Errorf("LLMErrors = %d, want 1", got)
+	}
+}
+
+func TestThresholdStrategy_SummarizeViaPoolRoutesThroughPool(t *testing.T) {
+	llm := &mockLLM{name: "gpt-4o", response: "pooled summary"}
+	pool := NewSummarizationPool(5)
+	s := newThresholdStrategy(newMockRegistry(), llm, 0)
+	s.SetSummarizationPool(pool)
+
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hi"}}}}
+	result, err := s.summarizeViaPool(context.Background(), contents, "", 1000, nil)
+	if err != nil {
+		t.Fatalf("summarizeViaPool() error: %v", err)
+	}
+	if result != "pooled summary" {
+		t.Errorf("summarizeViaPool() = %q, want %q", result, "pooled summary")
+	}
+	if got := pool.Metrics().JobsQueued; got != 1 {
+		t.Errorf("JobsQueued = %d, want 1", got)
+	}
+}
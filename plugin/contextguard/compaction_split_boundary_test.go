@@ -0,0 +1,142 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// toolCallContentMulti builds a single model Content with one FunctionCall
+// part per name, for exercising parallel tool calls issued in one turn.
+func toolCallContentMulti(names ...string) *genai.Content {
+	parts := make([]*genai.Part, len(names))
+	for i, name := range names {
+		parts[i] = &genai.Part{FunctionCall: &genai.FunctionCall{Name: name, Args: map[string]any{"q": "test"}}}
+	}
+	return &genai.Content{Role: "model", Parts: parts}
+}
+
+// toolResultContentMulti builds a single user Content with one
+// FunctionResponse part per name, answering a prior toolCallContentMulti.
+func toolResultContentMulti(names ...string) *genai.Content {
+	parts := make([]*genai.Part, len(names))
+	for i, name := range names {
+		parts[i] = &genai.Part{FunctionResponse: &genai.FunctionResponse{Name: name, Response: map[string]any{"result": "ok"}}}
+	}
+	return &genai.Content{Role: "user", Parts: parts}
+}
+
+func TestAlignSplitToolBoundaries_AdjacentPairUnaffectedByCleanSplit(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "hi"),
+		textContent("model", "hello"),
+		toolCallContent("read_file"),
+		toolResultContent("read_file"),
+		textContent("model", "done"),
+	}
+
+	got := alignSplitToolBoundaries(contents, 4)
+	if got != 4 {
+		t.Errorf("alignSplitToolBoundaries at a clean boundary = %d, want 4 (unchanged)", got)
+	}
+}
+
+func TestAlignSplitToolBoundaries_SlidesEarlierWhenCallEvictedButResponseKept(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "hi"),
+		toolCallContent("read_file"),   // idx 1
+		toolResultContent("read_file"), // idx 2
+		textContent("model", "done"),
+	}
+
+	// Splitting at 2 would evict the call (idx 1) while keeping the
+	// response (idx 2) — must slide back to 1 so the pair stays together.
+	got := alignSplitToolBoundaries(contents, 2)
+	if got != 1 {
+		t.Errorf("alignSplitToolBoundaries = %d, want 1 (pulled the call into the kept region)", got)
+	}
+}
+
+func TestAlignSplitToolBoundaries_NonAdjacentPairSeparatedByInterleavedMessage(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "start"),      // 0
+		toolCallContent("long_running"),   // 1
+		textContent("model", "working…"),  // 2 — interleaved, not adjacent to the pair
+		toolResultContent("long_running"), // 3
+		textContent("model", "done"),      // 4
+	}
+
+	// A positional/adjacency-only walk would see index 2 as a clean text
+	// boundary and stop there, splitting the call (1) from its response
+	// (3). Matching by name must still catch this and slide back to 1.
+	got := alignSplitToolBoundaries(contents, 2)
+	if got != 1 {
+		t.Errorf("alignSplitToolBoundaries = %d, want 1 (call/response pair spans the interleaved message)", got)
+	}
+}
+
+func TestAlignSplitToolBoundaries_ParallelCallsAnsweredOutOfOrder(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "start"), // 0
+		toolCallContent("fetch_a"),   // 1
+		toolCallContent("fetch_b"),   // 2
+		toolResultContent("fetch_a"), // 3
+		toolResultContent("fetch_b"), // 4
+		textContent("model", "done"), // 5
+	}
+
+	// Splitting at 3 would keep fetch_a's response but evict fetch_b's
+	// call (idx 2) while its response (idx 4) stays kept — must slide back
+	// past both calls to 1.
+	got := alignSplitToolBoundaries(contents, 3)
+	if got != 1 {
+		t.Errorf("alignSplitToolBoundaries = %d, want 1 (fetch_b's call/response pair still spans the split)", got)
+	}
+}
+
+func TestAlignSplitToolBoundaries_CascadingViolationsResolveToEarliestCall(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "start"),  // 0
+		toolCallContent("step_one"),   // 1
+		toolResultContent("step_one"), // 2
+		toolCallContent("step_two"),   // 3
+		toolResultContent("step_two"), // 4
+		textContent("model", "done"),  // 5
+	}
+
+	// idx 4 violates step_two's pair alone (call at 3 evicted, response at
+	// 4 kept); sliding to 3 resolves it without disturbing step_one's pair
+	// (1, 2), which is already fully evicted.
+	got := alignSplitToolBoundaries(contents, 4)
+	if got != 3 {
+		t.Errorf("alignSplitToolBoundaries = %d, want 3", got)
+	}
+}
+
+func TestAlignSplitToolBoundaries_MultiPartContentStaysTogether(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "start"),                 // 0
+		toolCallContentMulti("fetch_a", "fetch_b"),   // 1
+		toolResultContentMulti("fetch_a", "fetch_b"), // 2
+		textContent("model", "done"),                 // 3
+	}
+
+	got := alignSplitToolBoundaries(contents, 2)
+	if got != 1 {
+		t.Errorf("alignSplitToolBoundaries = %d, want 1 (both parallel calls pulled in with their responses)", got)
+	}
+}
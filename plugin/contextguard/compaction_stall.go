@@ -0,0 +1,124 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/genai"
+)
+
+// convergedFloorReduction is the minimum fractional token reduction a
+// compactPreserveTail retry attempt must make over the previous attempt to
+// be considered progress. Below this, further attempts are assumed to be
+// chasing diminishing returns against a floor the summarizer can't get
+// under (e.g. it always echoes back a fixed-size boilerplate summary).
+const convergedFloorReduction = 0.05
+
+// StallReason classifies why compactPreserveTail's retry loop gave up
+// before exhausting MaxCompactionAttempts.
+type StallReason string
+
+const (
+	// StallConverged means the last two attempts reduced the token
+	// estimate by less than convergedFloorReduction — further attempts are
+	// unlikely to help.
+	StallConverged StallReason = "converged"
+
+	// StallRegressed means an attempt's token estimate was no smaller than
+	// the previous attempt's — the summary text is now at least as large
+	// as what it replaced.
+	StallRegressed StallReason = "regressed"
+)
+
+// CompactionStallEvent describes the retry loop's state at the attempt
+// where it detected StallConverged or StallRegressed, passed to an
+// OnCompactionStalledFunc so it can decide how to recover.
+type CompactionStallEvent struct {
+	// Agent is the stalled agent's ID.
+	Agent string
+
+	// Reason is why the retry loop stopped early.
+	Reason StallReason
+
+	// Attempt is the 0-based attempt index at which the stall was detected.
+	Attempt int
+
+	// TokensAfter holds one post-summarization token estimate per attempt
+	// made so far, in order.
+	TokensAfter []int
+
+	// Old is the portion of the conversation the stalled attempt was
+	// summarizing away.
+	Old []*genai.Content
+
+	// Recent is the verbatim tail the stalled attempt preserved.
+	Recent []*genai.Content
+
+	// Summary is the best (most recent) summary text produced before the
+	// stall was detected.
+	Summary string
+}
+
+// OnCompactionStalledFunc is an escape hatch invoked when
+// compactPreserveTail's retry loop detects it has stopped making useful
+// progress (see CompactionStallEvent). It returns the genai.Content slice
+// Compact should use in place of [summary]+[recent tail] — e.g. a harder
+// truncation, or the recent tail with function-call/response pairs
+// dropped — or a non-nil error to abort compaction with a typed error
+// instead of silently returning the stalled, possibly over-budget, result.
+// A nil slice and nil error leaves the stalled result as-is.
+type OnCompactionStalledFunc func(event CompactionStallEvent) ([]*genai.Content, error)
+
+// HardTruncateOnStall returns an OnCompactionStalledFunc that drops
+// everything from event.Old, keeping only a stub marker plus the last
+// keepRecent entries of event.Recent — a blunt but guaranteed-smaller
+// fallback for when summarization itself has stopped shrinking the
+// conversation.
+func HardTruncateOnStall(keepRecent int) OnCompactionStalledFunc {
+	return func(event CompactionStallEvent) ([]*genai.Content, error) {
+		stub := &genai.Content{
+			Role:  "user",
+			Parts: []*genai.Part{{Text: "[Earlier conversation history truncated after compaction stalled.]"}},
+		}
+
+		recent := event.Recent
+		if keepRecent > 0 && len(recent) > keepRecent {
+			recent = recent[len(recent)-keepRecent:]
+		}
+
+		contents := make([]*genai.Content, 0, 1+len(recent))
+		contents = append(contents, stub)
+		contents = append(contents, recent...)
+		return contents, nil
+	}
+}
+
+// persistCompactionTrace records the per-attempt post-summarization token
+// estimates from a compactPreserveTail run, so operators can inspect why
+// compaction plateaued on a specific session (e.g. via a debug endpoint
+// that reads session state) without needing to reproduce the trace from
+// logs alone.
+func persistCompactionTrace(ctx agent.CallbackContext, tokensAfter []int) {
+	key := stateKeyPrefixCompactionTrace + ctx.AgentName()
+	trace := make([]any, len(tokensAfter))
+	for i, v := range tokensAfter {
+		trace[i] = v
+	}
+	if err := ctx.State().Set(key, trace); err != nil {
+		slog.Warn("ContextGuard: failed to persist compaction trace", "error", err)
+	}
+}
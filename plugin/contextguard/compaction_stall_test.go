@@ -0,0 +1,102 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestDetectCompactionStall_RegressionWhenTokensDidNotShrink(t *testing.T) {
+	reason, detected := detectCompactionStall(1000, 1000)
+	if !detected || reason != StallRegressed {
+		t.Errorf("detectCompactionStall(1000, 1000) = (%v, %v), want (%v, true)", reason, detected, StallRegressed)
+	}
+
+	reason, detected = detectCompactionStall(1000, 1200)
+	if !detected || reason != StallRegressed {
+		t.Errorf("detectCompactionStall(1000, 1200) = (%v, %v), want (%v, true)", reason, detected, StallRegressed)
+	}
+}
+
+func TestDetectCompactionStall_ConvergedWhenReductionTooSmall(t *testing.T) {
+	reason, detected := detectCompactionStall(1000, 980) // 2% reduction
+	if !detected || reason != StallConverged {
+		t.Errorf("detectCompactionStall(1000, 980) = (%v, %v), want (%v, true)", reason, detected, StallConverged)
+	}
+}
+
+func TestDetectCompactionStall_ProgressIsNotAStall(t *testing.T) {
+	_, detected := detectCompactionStall(1000, 500) // 50% reduction
+	if detected {
+		t.Errorf("detectCompactionStall(1000, 500): got a stall, want none for a large reduction")
+	}
+}
+
+func TestHardTruncateOnStall_KeepsOnlyRecentTailAndStub(t *testing.T) {
+	recent := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "1"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "2"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "3"}}},
+	}
+	handler := HardTruncateOnStall(1)
+
+	contents, err := handler(CompactionStallEvent{Recent: recent})
+	if err != nil {
+		t.Fatalf("HardTruncateOnStall()() error: %v", err)
+	}
+	if len(contents) != 2 {
+		t.Fatalf("got %d contents, want 2 (1 stub + 1 kept recent)", len(contents))
+	}
+	if contents[1] != recent[len(recent)-1] {
+		t.Errorf("kept content = %v, want the last recent entry", contents[1])
+	}
+}
+
+func TestThresholdStrategy_CompactPreserveTailInvokesStallHandlerOnRegression(t *testing.T) {
+	// A fixed-response LLM never shrinks the conversation turn over turn,
+	// so every retry after the first should detect a regression or a
+	// converged floor and hand off to the stall handler.
+	llm := &mockLLM{name: "small-model", response: "this summary never gets any smaller no matter how many times we ask for it again"}
+	registry := newMockRegistry()
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetThresholdOptions(ThresholdOptions{RetentionMode: PreserveTail, MaxCompactionAttempts: 4})
+
+	var handlerCalled bool
+	s.SetOnCompactionStalled(func(event CompactionStallEvent) ([]*genai.Content, error) {
+		handlerCalled = true
+		if event.Reason != StallConverged && event.Reason != StallRegressed {
+			t.Errorf("stall event Reason = %v, want StallConverged or StallRegressed", event.Reason)
+		}
+		return HardTruncateOnStall(1)(event)
+	})
+
+	ctx := newMockCallbackContext("stall-agent")
+	contents := make([]*genai.Content, 0, 200)
+	for i := 0; i < 200; i++ {
+		contents = append(contents, textContent("user", "a fairly chunky piece of conversation history padding out the transcript"))
+	}
+	req := &model.LLMRequest{Model: "small-model", Contents: contents}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	if !handlerCalled {
+		t.Error("expected the stall handler to be invoked when the fixed-response LLM never shrinks the conversation")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// adaptiveReservoirSize bounds the number of real PromptTokenCount samples
+// adaptiveStrategy keeps in memory. 256 samples is enough to estimate p50/p95
+// stably without the reservoir growing unbounded across a long-running
+// session.
+const adaptiveReservoirSize = 256
+
+// adaptiveStaticCap is the fraction of the context window the adaptive
+// threshold never exceeds, regardless of how low the observed variance is.
+// It sits slightly above the 80% point that thresholdStrategy's
+// computeBuffer (a 20% buffer) leaves for small context windows, so a quiet
+// session still compacts before truly running out of room.
+const adaptiveStaticCap = 0.85
+
+// adaptiveStrategy implements a compaction threshold that follows the
+// session's own observed token distribution instead of a single scalar
+// threshold. It maintains a fixed-size reservoir of real per-turn
+// PromptTokenCount observations (fed by contextGuard.afterModel through
+// tokenObserver) and computes the trigger as
+// min(contextWindow*0.85, p95(tokens)*growthFactor), where growthFactor is
+// the ratio of p95 to p50 over the reservoir. A session with stable token
+// usage (growthFactor near 1) compacts close to p95, saving summarization
+// calls; a burst of huge tool responses widens the p50/p95 gap and tightens
+// the trigger automatically.
+//
+// Compaction itself reuses the same full-summary flow as thresholdStrategy:
+// the result is [summary] + [continuation].
+type adaptiveStrategy struct {
+	registry  ModelRegistry
+	llm       model.LLM
+	maxTokens int
+	mu        sync.Mutex
+
+	rng       *rand.Rand
+	reservoir []int
+	seen      int
+}
+
+// newAdaptiveStrategy creates an adaptive strategy. If maxTokens > 0 it
+// overrides the registry lookup for the context window size, matching
+// newThresholdStrategy's convention.
+func newAdaptiveStrategy(registry ModelRegistry, llm model.LLM, maxTokens int) *adaptiveStrategy {
+	return &adaptiveStrategy{
+		registry:  registry,
+		llm:       llm,
+		maxTokens: maxTokens,
+		rng:       rand.New(rand.NewSource(1)),
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *adaptiveStrategy) Name() string {
+	return StrategyAdaptive
+}
+
+// observeRealTokens records a real PromptTokenCount observation using
+// reservoir sampling (Vitter's algorithm R), so the reservoir stays a
+// uniform random sample of all observations seen even after it fills.
+// Implements tokenObserver.
+func (s *adaptiveStrategy) observeRealTokens(tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seen++
+	if len(s.reservoir) < adaptiveReservoirSize {
+		s.reservoir = append(s.reservoir, tokens)
+		return
+	}
+	j := s.rng.Intn(s.seen)
+	if j < adaptiveReservoirSize {
+		s.reservoir[j] = tokens
+	}
+}
+
+// threshold computes the adaptive compaction trigger for contextWindow. With
+// fewer than two samples there's no distribution to follow yet, so it falls
+// back to the static contextWindow*0.85 cap.
+func (s *adaptiveStrategy) threshold(contextWindow int) int {
+	s.mu.Lock()
+	sorted := append([]int(nil), s.reservoir...)
+	s.mu.Unlock()
+
+	staticCap := int(float64(contextWindow) * adaptiveStaticCap)
+	if len(sorted) < 2 {
+		return staticCap
+	}
+	sort.Ints(sorted)
+
+	p50 := percentile(sorted, 0.50)
+	p95 := percentile(sorted, 0.95)
+	growthFactor := 1.0
+	if p50 > 0 {
+		growthFactor = float64(p95) / float64(p50)
+	}
+	if growthFactor < 1.0 {
+		growthFactor = 1.0
+	}
+
+	adaptiveCap := int(float64(p95) * growthFactor)
+	if adaptiveCap < staticCap {
+		return adaptiveCap
+	}
+	return staticCap
+}
+
+// StrategyStats is a point-in-time snapshot of a strategy's observed token
+// distribution, exposed for observability. See StatsProvider.
+type StrategyStats struct {
+	Samples   int
+	P50Tokens int
+	P95Tokens int
+	P99Tokens int
+}
+
+// StatsProvider is implemented by strategies that can report a token
+// distribution snapshot. Kept separate from the core Strategy interface
+// (the same pattern as streamWindowStrategy) so strategies without a
+// meaningful distribution to report — sliding-window, summarization — don't
+// need a no-op implementation.
+type StatsProvider interface {
+	Stats() StrategyStats
+}
+
+// Stats returns a snapshot of the reservoir's observed token distribution.
+// Implements StatsProvider.
+func (s *adaptiveStrategy) Stats() StrategyStats {
+	s.mu.Lock()
+	sorted := append([]int(nil), s.reservoir...)
+	seen := s.seen
+	s.mu.Unlock()
+
+	sort.Ints(sorted)
+	return StrategyStats{
+		Samples:   seen,
+		P50Tokens: percentile(sorted, 0.50),
+		P95Tokens: percentile(sorted, 0.95),
+		P99Tokens: percentile(sorted, 0.99),
+	}
+}
+
+// percentile returns the p-th percentile (0..1) of sorted, which must
+// already be sorted ascending. Returns 0 for an empty slice.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)-1))
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// Compact checks the token estimate against the adaptive threshold and, if
+// exceeded, summarizes the entire conversation the same way
+// thresholdStrategy.Compact does.
+func (s *adaptiveStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	var contextWindow int
+	if s.maxTokens > 0 {
+		contextWindow = s.maxTokens
+	} else {
+		contextWindow = s.registry.ContextWindow(req.Model)
+	}
+	buffer := computeBuffer(contextWindow)
+	threshold := s.threshold(contextWindow)
+
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	totalSessionContents := len(req.Contents)
+	if existingSummary != "" {
+		injectSummary(req, existingSummary, contentsAtLastCompaction)
+	}
+
+	totalTokens := tokenCount(ctx, req)
+	if totalTokens < threshold {
+		return nil
+	}
+
+	stats := s.Stats()
+	slog.Info("ContextGuard [adaptive]: threshold exceeded, summarizing",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"tokens", totalTokens,
+		"threshold", threshold,
+		"contextWindow", contextWindow,
+		"buffer", buffer,
+		"samples", stats.Samples,
+		"p50Tokens", stats.P50Tokens,
+		"p95Tokens", stats.P95Tokens,
+		"p99Tokens", stats.P99Tokens,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+
+	contentsForSummary := truncateForSummarizer(req.Contents, contextWindow)
+
+	summary, err := summarize(ctx, s.llm, contentsForSummary, existingSummary, buffer, todos)
+	if err != nil {
+		slog.Warn("ContextGuard [adaptive]: summarization failed, using fallback",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		summary = buildFallbackSummary(contentsForSummary, existingSummary)
+	}
+
+	persistSummary(ctx, summary, totalTokens)
+	persistContentsAtCompaction(ctx, totalSessionContents)
+	replaceSummary(req, summary, nil)
+	injectContinuation(req, userContent)
+
+	resetCalibration(ctx)
+
+	newTokens := estimateTokens(req)
+
+	slog.Info("ContextGuard [adaptive]: compaction completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(req.Contents),
+		"newTokenEstimate", newTokens,
+		"threshold", threshold,
+	)
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestThresholdStrategy_CompactNowForcesCompactionAtWatermark(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: forced compaction."}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.CompactNow(ctx, req, 10); err != nil {
+		t.Fatalf("CompactNow error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected CompactNow to produce a summary")
+	}
+	if got := loadContentsAtCompaction(ctx); got <= 0 {
+		t.Errorf("expected contentsAtCompaction watermark to advance, got %d", got)
+	}
+}
+
+func TestThresholdStrategy_CompactNowNoOpsAtOrBeforeWatermark(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: forced compaction."}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+	persistContentsAtCompaction(ctx, 15)
+
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.CompactNow(ctx, req, 10); err != nil {
+		t.Fatalf("CompactNow error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no-op (no summary) when upTo is at or before the watermark")
+	}
+}
+
+func TestThresholdStrategy_CompactNowRejectsTooAggressiveUpTo(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: forced compaction."}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(5)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	err := s.CompactNow(ctx, req, len(req.Contents))
+	if !errors.Is(err, ErrCompactNowTooAggressive) {
+		t.Fatalf("CompactNow error = %v, want ErrCompactNowTooAggressive", err)
+	}
+}
+
+func TestContextGuard_CompactNowPassthrough(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: forced compaction."}
+	guard.Add("agent1", llm)
+
+	ctx := newMockCallbackContext("agent1")
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := guard.CompactNow(ctx, req, 10); err != nil {
+		t.Fatalf("CompactNow error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected CompactNow to produce a summary")
+	}
+}
+
+func TestContextGuard_CompactNowUnsupportedStrategy(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithSlidingWindow(30))
+
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(kubeAgentConversation(5))}
+
+	if err := guard.CompactNow(ctx, req, 2); err == nil {
+		t.Error("expected an error for a strategy that doesn't support CompactNow")
+	}
+}
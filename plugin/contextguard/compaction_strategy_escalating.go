@@ -0,0 +1,236 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// escalationLargeMaxTurns and escalationSmallMaxTurns are the recent-window
+// sizes for the escalating strategy's two sliding-window rungs: a cheap,
+// barely-invasive pass first, then a much more aggressive one, before
+// resorting to a full threshold summarization.
+const (
+	escalationLargeMaxTurns = 40
+	escalationSmallMaxTurns = 8
+)
+
+// EscalationStepResult records one step of an escalatingStrategy pass: the
+// step's name and the token estimate immediately before and after it ran.
+type EscalationStepResult struct {
+	Name         string `json:"name"`
+	TokensBefore int    `json:"tokensBefore"`
+	TokensAfter  int    `json:"tokensAfter"`
+}
+
+// EscalationResult is the structured outcome of one escalatingStrategy.Compact
+// call, persisted to session state (see persistEscalationResult) so a
+// simulation harness can assert monotonic reduction across steps without
+// re-deriving it from raw token counts.
+type EscalationResult struct {
+	// Steps records each ladder step that actually ran, in order. A step is
+	// skipped (and so absent here) once an earlier step already brought the
+	// request back under threshold.
+	Steps []EscalationStepResult `json:"steps"`
+
+	// Fit is true if the request was under threshold by the time Compact
+	// returned, whether because it already fit or because some step in the
+	// ladder brought it back under.
+	Fit bool `json:"fit"`
+}
+
+// escalatingStrategy implements a fail-forward compaction ladder: it tries
+// an ordered list of increasingly aggressive steps, re-estimating tokens
+// after each one, and stops as soon as the request fits under the model's
+// context window. Individual steps are plain Strategy implementations (the
+// same sliding-window and threshold strategies usable on their own), plus
+// two escalation-only steps — a tool-response reduction pass and a
+// last-resort hard truncation — that only make sense as part of a ladder.
+//
+// Every step operates on whole Content entries via safeSplitIndex/
+// findSplitIndex or in-place FunctionResponse edits, so the escalation
+// contract (never splitting a tool_call/tool_response pair) holds across
+// the whole ladder, not just within one step.
+type escalatingStrategy struct {
+	registry  ModelRegistry
+	maxTokens int
+	steps     []Strategy
+}
+
+// newEscalatingStrategy builds the default escalation ladder: tool-response
+// reduction, a large-window then small-window sliding-window pass, full
+// threshold summarization, and finally hard truncation of the oldest
+// entries.
+func newEscalatingStrategy(registry ModelRegistry, llm model.LLM, maxTokens int) *escalatingStrategy {
+	return &escalatingStrategy{
+		registry:  registry,
+		maxTokens: maxTokens,
+		steps: []Strategy{
+			&toolReductionStep{},
+			newSlidingWindowStrategy(registry, llm, escalationLargeMaxTurns),
+			newSlidingWindowStrategy(registry, llm, escalationSmallMaxTurns),
+			newThresholdStrategy(registry, llm, maxTokens),
+			&hardTruncateStrategy{registry: registry, maxTokens: maxTokens},
+		},
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *escalatingStrategy) Name() string {
+	return StrategyEscalating
+}
+
+// contextWindowFor returns the context window this strategy checks req's
+// token estimate against, honoring the maxTokens override the same way
+// thresholdStrategy.contextWindowFor does. Implements streamWindowStrategy
+// for beforeModelStream.
+func (s *escalatingStrategy) contextWindowFor(req *model.LLMRequest) int {
+	if s.maxTokens > 0 {
+		return s.maxTokens
+	}
+	return s.registry.ContextWindow(req.Model)
+}
+
+// Compact walks the ladder in order, re-estimating tokens after each step
+// and stopping as soon as the request fits under threshold. Every step's
+// own error is logged and swallowed rather than returned, so a failure in
+// one rung (e.g. a summarization LLM call) doesn't prevent later, cheaper
+// rungs (hard truncation) from still running — the whole point of the
+// ladder is to keep trying until something works. The structured outcome
+// is persisted via persistEscalationResult for callers (and simulation
+// harnesses) that need to assert on it.
+func (s *escalatingStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	contextWindow := s.contextWindowFor(req)
+	threshold := contextWindow - computeBuffer(contextWindow)
+
+	result := EscalationResult{}
+
+	tokens := estimateTokens(req)
+	if tokens < threshold {
+		result.Fit = true
+		persistEscalationResult(ctx, result)
+		return nil
+	}
+
+	for _, step := range s.steps {
+		before := estimateTokens(req)
+
+		if err := step.Compact(ctx, req); err != nil {
+			slog.Warn("ContextGuard [escalating]: step failed, continuing to next rung",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"step", step.Name(),
+				"error", err,
+			)
+		}
+
+		after := estimateTokens(req)
+		result.Steps = append(result.Steps, EscalationStepResult{
+			Name:         step.Name(),
+			TokensBefore: before,
+			TokensAfter:  after,
+		})
+
+		if after < threshold {
+			result.Fit = true
+			break
+		}
+	}
+
+	persistEscalationResult(ctx, result)
+
+	slog.Info("ContextGuard [escalating]: escalation ladder completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"stepsRun", len(result.Steps),
+		"fit", result.Fit,
+		"tokensBefore", tokens,
+		"tokensAfter", estimateTokens(req),
+	)
+
+	return nil
+}
+
+// toolReductionStep adapts reduceToolResponses to the Strategy interface so
+// it can sit in the escalation ladder alongside the real strategies. Unlike
+// thresholdStrategy/slidingWindowStrategy's own SetToolReducers (which only
+// reduces historical turns, preserving defaultToolReducerRecentKeep recent
+// ones), this step reduces the entire conversation including the most
+// recent turn: by the time the ladder reaches for it, the conversation has
+// already failed to fit, so the usual "don't touch what the model is
+// actively reasoning about" carve-out is a luxury it can't afford.
+type toolReductionStep struct{}
+
+// Name returns the step identifier for logging and EscalationStepResult.
+func (toolReductionStep) Name() string {
+	return "tool_reduction"
+}
+
+// Compact runs reduceToolResponses over the whole conversation.
+func (toolReductionStep) Compact(_ agent.CallbackContext, req *model.LLMRequest) error {
+	reduceToolResponses(req.Contents, 0)
+	return nil
+}
+
+// hardTruncateStrategy is the escalation ladder's last resort: it never
+// calls an LLM, it just drops the oldest Content entries outright. Each
+// attempt halves the survivors, using safeSplitIndex so the cut never lands
+// inside a tool_call/tool_response pair, until the conversation fits under
+// threshold, only a handful of entries remain, or maxCompactionAttempts is
+// exhausted.
+type hardTruncateStrategy struct {
+	registry  ModelRegistry
+	maxTokens int
+}
+
+// Name returns the strategy identifier for logging.
+func (s *hardTruncateStrategy) Name() string {
+	return "hard_truncate"
+}
+
+// contextWindowFor mirrors thresholdStrategy.contextWindowFor.
+func (s *hardTruncateStrategy) contextWindowFor(req *model.LLMRequest) int {
+	if s.maxTokens > 0 {
+		return s.maxTokens
+	}
+	return s.registry.ContextWindow(req.Model)
+}
+
+// Compact drops the oldest half of req.Contents, repeatedly, until the
+// request fits under threshold or there's nothing left worth dropping.
+func (s *hardTruncateStrategy) Compact(_ agent.CallbackContext, req *model.LLMRequest) error {
+	contextWindow := s.contextWindowFor(req)
+	threshold := contextWindow - computeBuffer(contextWindow)
+
+	for attempt := 0; attempt < maxCompactionAttempts; attempt++ {
+		if estimateTokens(req) < threshold {
+			break
+		}
+		if len(req.Contents) <= 2 {
+			break
+		}
+
+		cut := safeSplitIndex(req.Contents, len(req.Contents)/2)
+		if cut <= 0 || cut >= len(req.Contents) {
+			break
+		}
+		req.Contents = req.Contents[cut:]
+	}
+
+	return nil
+}
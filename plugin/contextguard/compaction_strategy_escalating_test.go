@@ -0,0 +1,100 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestEscalatingStrategy_StormMonsterFits(t *testing.T) {
+	storm := pureToolStorm(100, 10_000)
+	runEscalatingFitCheck(t, "tool-storm-100x10k / 32k ctx", storm, 32_000)
+}
+
+func TestEscalatingStrategy_LongSessionFits(t *testing.T) {
+	longSession := kubeAgentConversation(50)
+	runEscalatingFitCheck(t, "kube-50rounds / 32k ctx", longSession, 32_000)
+}
+
+// runEscalatingFitCheck drives an escalatingStrategy over contents and
+// asserts it ends up fitting under contextWindow, with every recorded step
+// making monotonic progress (never increasing the token estimate) and no
+// step splitting a tool_call/tool_response pair.
+func runEscalatingFitCheck(t *testing.T, scenario string, contents []*genai.Content, contextWindow int) {
+	t.Helper()
+
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": contextWindow},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{
+		name:     "sim-model",
+		response: "Summary: The conversation involved multiple tool calls to investigate and resolve issues.",
+	}
+
+	s := newEscalatingStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("sim-agent")
+
+	req := &model.LLMRequest{
+		Model:    "sim-model",
+		Contents: copyContents(contents),
+	}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("[%s] Compact error: %v", scenario, err)
+	}
+
+	result := loadEscalationResult(ctx)
+	if !result.Fit {
+		t.Fatalf("[%s] escalation result Fit = false, want true", scenario)
+	}
+
+	buffer := computeBuffer(contextWindow)
+	threshold := contextWindow - buffer
+	if tokensAfter := estimateTokens(req); tokensAfter >= threshold {
+		t.Errorf("[%s] final tokens %d still >= threshold %d", scenario, tokensAfter, threshold)
+	}
+
+	for i, step := range result.Steps {
+		if step.TokensAfter > step.TokensBefore {
+			t.Errorf("[%s] step %d (%s) increased tokens: %d -> %d",
+				scenario, i, step.Name, step.TokensBefore, step.TokensAfter)
+		}
+	}
+
+	assertNoSplitPairs(t, scenario, req.Contents)
+}
+
+// assertNoSplitPairs walks contents looking for a FunctionCall with no
+// matching FunctionResponse immediately after it (or vice versa), which
+// would mean some step split a tool_call/tool_response pair.
+func assertNoSplitPairs(t *testing.T, scenario string, contents []*genai.Content) {
+	t.Helper()
+
+	for i, c := range contents {
+		if c == nil {
+			continue
+		}
+		if c.Role == "model" && contentHasFunctionCall(c) {
+			if i+1 >= len(contents) || !contentHasFunctionResponse(contents[i+1]) {
+				t.Errorf("[%s] content %d has a FunctionCall with no matching FunctionResponse following it", scenario, i)
+			}
+		}
+	}
+}
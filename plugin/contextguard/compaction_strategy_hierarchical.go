@@ -0,0 +1,164 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultHierarchicalBaseBudget is the Level-0 token budget used when
+// WithHierarchical is given baseBudget <= 0. hierarchicalBudgetGrowth is
+// the factor each level's budget grows by over the level below it
+// (budget_{k+1} = budget_k * hierarchicalBudgetGrowth), so higher levels
+// tolerate more accumulated text before they too get rolled up — see
+// SummaryTree.promoteByBudget.
+const (
+	defaultHierarchicalBaseBudget = 2_000
+	hierarchicalBudgetGrowth      = 2
+)
+
+// hierarchicalStrategy implements turn-count-based eviction, like
+// slidingWindowStrategy, but folds evicted turns into a multi-level
+// SummaryTree "ledger" of chapters instead of one flat summary string: a
+// level is promoted into a single node at the next level up — and
+// cleared — whenever its combined token estimate exceeds that level's
+// budget. This bounds long-horizon memory to roughly O(levels) chapters
+// instead of letting a single summary blob grow without limit across many
+// compactions. See WithHierarchical.
+type hierarchicalStrategy struct {
+	registry   ModelRegistry
+	llm        model.LLM
+	maxTurns   int
+	baseBudget int
+	mu         sync.Mutex
+}
+
+// newHierarchicalStrategy creates a hierarchical strategy for a single
+// agent. maxTurns <= 0 selects defaultMaxTurns; baseBudget <= 0 selects
+// defaultHierarchicalBaseBudget.
+func newHierarchicalStrategy(registry ModelRegistry, llm model.LLM, maxTurns, baseBudget int) *hierarchicalStrategy {
+	if maxTurns <= 0 {
+		maxTurns = defaultMaxTurns
+	}
+	if baseBudget <= 0 {
+		baseBudget = defaultHierarchicalBaseBudget
+	}
+	return &hierarchicalStrategy{
+		registry:   registry,
+		llm:        llm,
+		maxTurns:   maxTurns,
+		baseBudget: baseBudget,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *hierarchicalStrategy) Name() string {
+	return StrategyHierarchical
+}
+
+// Compact counts Content entries that arrived after the last compaction,
+// the same trigger slidingWindowStrategy uses. Once maxTurns is exceeded,
+// the evicted turns are summarized into a new Level-0 SummaryTree node,
+// any level now over its token budget is promoted into a chapter one level
+// up (see SummaryTree.promoteByBudget), and the tree's rendered form —
+// oldest chapter first, current leaf last, per WithHierarchical — replaces
+// the evicted turns the same way a flat summary would.
+func (s *hierarchicalStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	tree := loadSummaryTree(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if rendered := tree.render(); rendered != "" {
+		injectSummary(req, rendered, contentsAtLastCompaction)
+	}
+
+	totalContents := len(req.Contents)
+	turnsSinceCompaction := totalContents - contentsAtLastCompaction
+	if turnsSinceCompaction <= s.maxTurns {
+		return nil
+	}
+
+	slog.Info("ContextGuard [hierarchical]: turn limit exceeded, summarizing",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"totalContents", totalContents,
+		"contentsAtLastCompaction", contentsAtLastCompaction,
+		"turnsSinceCompaction", turnsSinceCompaction,
+		"maxTurns", s.maxTurns,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contextWindow := s.registry.ContextWindow(req.Model)
+	buffer := computeBuffer(contextWindow)
+	todos := loadTodos(ctx)
+	recentKeep := max(3, s.maxTurns*30/100)
+
+	splitIdx := safeSplitIndex(req.Contents, len(req.Contents)-recentKeep)
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+	if len(oldContents) == 0 {
+		slog.Warn("ContextGuard [hierarchical]: nothing to compact (split at 0), aborting",
+			"agent", ctx.AgentName(),
+		)
+		return nil
+	}
+
+	var leafText string
+	var err error
+	if estimateContentTokens(oldContents) > defaultChunkTokenBudget*2 {
+		leafText, err = hierarchicalCompact(ctx, s.llm, oldContents, "", todos,
+			defaultChunkTokenBudget, s.baseBudget, defaultHierarchicalPoolSize)
+	} else {
+		leafText, err = summarize(ctx, s.llm, oldContents, "", buffer, todos)
+	}
+	if err != nil {
+		slog.Error("ContextGuard [hierarchical]: summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+	tree.appendLevelZero(leafText)
+
+	if err := tree.promoteByBudget(ctx, s.llm, s.baseBudget, hierarchicalBudgetGrowth); err != nil {
+		slog.Warn("ContextGuard [hierarchical]: level promotion failed, keeping unpromoted levels",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+	}
+
+	persistSummaryTree(ctx, tree)
+	persistContentsAtCompaction(ctx, totalContents)
+	replaceSummary(req, tree.render(), recentContents)
+	injectContinuation(req, ctx.UserContent())
+
+	slog.Info("ContextGuard [hierarchical]: compaction pass completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+		"treeLevels", len(tree.Nodes),
+		"watermarkWritten", totalContents,
+	)
+
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultHierarchicalMapReduceRecentKeep is the number of trailing Content
+// entries hierarchicalMapReduceStrategy always keeps verbatim, the same
+// floor weightedSlidingWindowStrategy and hierarchicalStrategy use for
+// their own recent-turn tail.
+const defaultHierarchicalMapReduceRecentKeep = 3
+
+// hierarchicalMapReduceStrategy implements threshold-triggered compaction
+// like thresholdStrategy, but always summarizes the pre-split contents via
+// a bounded-concurrency chunk/reduce pass (see hierarchicalCompact) instead
+// of a single summarizer call — thresholdStrategy only falls back to that
+// machinery when a single turn's contents would themselves risk
+// overflowing the summarizer's context window; this strategy uses it
+// unconditionally, trading some latency (many small calls instead of one
+// large one) for a summarizer prompt size that never grows with the
+// conversation. Each chunk's summary is cached in session state keyed by a
+// hash of its contents (see chunkContentHash/loadChunkSummaryCache), so a
+// later compaction pass over a prefix whose chunks are unchanged reuses
+// the cached summaries instead of re-summarizing them.
+type hierarchicalMapReduceStrategy struct {
+	registry    ModelRegistry
+	llm         model.LLM
+	chunkTokens int
+	fanout      int
+	mu          sync.Mutex
+}
+
+// newHierarchicalMapReduceStrategy creates a hierarchical-map-reduce
+// strategy for a single agent. chunkTokens <= 0 selects
+// defaultChunkTokenBudget; fanout <= 0 selects reduceGroupSize.
+func newHierarchicalMapReduceStrategy(registry ModelRegistry, llm model.LLM, chunkTokens, fanout int) *hierarchicalMapReduceStrategy {
+	return &hierarchicalMapReduceStrategy{
+		registry:    registry,
+		llm:         llm,
+		chunkTokens: chunkTokens,
+		fanout:      fanout,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *hierarchicalMapReduceStrategy) Name() string {
+	return StrategyHierarchicalMapReduce
+}
+
+// Compact summarizes once estimated token usage approaches the model's
+// context window, the same trigger thresholdStrategy uses, but always
+// routes the pre-split contents through the chunk/reduce map-reduce pass
+// (see mapReduceCompact) rather than a single summarizer call.
+func (s *hierarchicalMapReduceStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if existingSummary != "" {
+		injectSummary(req, existingSummary, contentsAtLastCompaction)
+	}
+
+	contextWindow := s.registry.ContextWindow(req.Model)
+	buffer := computeBuffer(contextWindow)
+	threshold := contextWindow - buffer
+
+	totalTokens := estimateTokens(req)
+	if totalTokens < threshold {
+		return nil
+	}
+
+	slog.Info("ContextGuard [hierarchical_map_reduce]: threshold exceeded, summarizing",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"tokens", totalTokens,
+		"threshold", threshold,
+		"contextWindow", contextWindow,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+
+	splitIdx := safeSplitIndex(req.Contents, len(req.Contents)-defaultHierarchicalMapReduceRecentKeep)
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+	if len(oldContents) == 0 {
+		slog.Warn("ContextGuard [hierarchical_map_reduce]: nothing to compact (split at 0), aborting",
+			"agent", ctx.AgentName(),
+		)
+		return nil
+	}
+
+	summary, err := s.mapReduceCompact(ctx, oldContents, existingSummary, todos, int(float64(buffer)*0.50))
+	if err != nil {
+		slog.Error("ContextGuard [hierarchical_map_reduce]: summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	persistSummary(ctx, summary, totalTokens)
+	persistContentsAtCompaction(ctx, len(req.Contents))
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, userContent)
+
+	slog.Info("ContextGuard [hierarchical_map_reduce]: compaction pass completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+	)
+
+	return nil
+}
+
+// mapReduceCompact partitions contents into s.chunkTokens-sized chunks (see
+// partitionByTokenBudget), summarizes each chunk concurrently with its
+// result cached in session state by content hash (see
+// summarizeChunksCached), then reduces the resulting chunk summaries —
+// plus previousSummary, carried forward as an extra input rather than
+// lost — down to a single summary via repeated reduce passes over groups
+// of s.fanout at a time.
+func (s *hierarchicalMapReduceStrategy) mapReduceCompact(ctx agent.CallbackContext, contents []*genai.Content, previousSummary string, todos []TodoItem, targetTokens int) (string, error) {
+	chunkTokens := s.chunkTokens
+	if chunkTokens <= 0 {
+		chunkTokens = defaultChunkTokenBudget
+	}
+	poolSize := defaultHierarchicalPoolSize
+
+	chunks := partitionByTokenBudget(contents, chunkTokens)
+	if len(chunks) == 0 {
+		return previousSummary, nil
+	}
+
+	summaries, err := s.summarizeChunksCached(ctx, chunks, todos, poolSize)
+	if err != nil {
+		return "", err
+	}
+
+	if previousSummary != "" {
+		summaries = append([]chunkSummary{{text: previousSummary}}, summaries...)
+	}
+
+	return reduceSummariesWithFanout(ctx, s.llm, summaries, targetTokens, poolSize, s.fanout, "")
+}
+
+// summarizeChunksCached is summarizeChunksConcurrentlyWithTemplate's
+// cache-aware variant: before summarizing a chunk, it checks
+// loadChunkSummaryCache for a hit keyed by chunkContentHash, and only the
+// chunks that miss are summarized (with up to poolSize calls in flight at
+// once) and added to the cache before it's persisted back. A cache hit
+// means a later compaction pass over a prefix whose chunks haven't
+// changed since skips paying for that chunk's summarize call again.
+func (s *hierarchicalMapReduceStrategy) summarizeChunksCached(ctx agent.CallbackContext, chunks []contentChunk, todos []TodoItem, poolSize int) ([]chunkSummary, error) {
+	cache := loadChunkSummaryCache(ctx)
+	hashes := make([]string, len(chunks))
+	results := make([]chunkSummary, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var toSummarize []int
+	for i, chunk := range chunks {
+		hash := chunkContentHash(chunk)
+		hashes[i] = hash
+		if cached, ok := cache[hash]; ok {
+			results[i] = chunkSummary{text: cached, firstIndex: chunk.firstIndex, lastIndex: chunk.lastIndex}
+			continue
+		}
+		toSummarize = append(toSummarize, i)
+	}
+
+	if len(toSummarize) > 0 {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, poolSize)
+		var mu sync.Mutex
+
+		for _, i := range toSummarize {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				chunk := chunks[i]
+				text, err := summarizeWithTemplate(ctx, s.llm, chunk.contents, "", defaultChunkTokenBudget, todos, "")
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				results[i] = chunkSummary{text: text, firstIndex: chunk.firstIndex, lastIndex: chunk.lastIndex}
+
+				mu.Lock()
+				cache[hashes[i]] = text
+				mu.Unlock()
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("contextguard: hierarchical map-reduce map phase failed: %w", err)
+			}
+		}
+		persistChunkSummaryCache(ctx, cache)
+	}
+
+	return results, nil
+}
+
+// chunkContentHash returns the hex sha256 of chunk's contents, following
+// poolJobKey's precedent for hashing a []*genai.Content deterministically.
+// Unlike poolJobKey, it carries no previousSummary/model component: the
+// cache is keyed purely on a chunk's own contents, since the same chunk
+// should hit the cache regardless of what summary or model context it's
+// being reduced alongside this time.
+func chunkContentHash(chunk contentChunk) string {
+	h := sha256.New()
+	for _, c := range chunk.contents {
+		if c == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00", c.Role)
+		for _, part := range c.Parts {
+			if part == nil {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00", part.Text)
+			if part.FunctionCall != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionCall.Name, part.FunctionCall.Args)
+			}
+			if part.FunctionResponse != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionResponse.Name, part.FunctionResponse.Response)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestHierarchicalMapReduceStrategy_DoesNotCompactBelowThreshold(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newHierarchicalMapReduceStrategy(registry, llm, 0, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(2)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary when well under the context window")
+	}
+}
+
+func TestHierarchicalMapReduceStrategy_CompactsAboveThreshold(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 2_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: heavy session compacted."}
+	s := newHierarchicalMapReduceStrategy(registry, llm, 0, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary once estimated tokens exceeded the context window threshold")
+	}
+	if got := loadContentsAtCompaction(ctx); got <= 0 {
+		t.Errorf("expected contentsAtCompaction watermark to advance, got %d", got)
+	}
+}
+
+func TestHierarchicalMapReduceStrategy_CachesChunkSummariesAcrossCalls(t *testing.T) {
+	llm := &countingLLM{mockLLM: mockLLM{name: "gpt-4o", response: "condensed chunk summary"}}
+	s := newHierarchicalMapReduceStrategy(newMockRegistry(), llm, 500, 8)
+	ctx := newMockCallbackContext("agent1")
+
+	oldContents := kubeAgentConversation(10)
+
+	if _, err := s.mapReduceCompact(ctx, oldContents, "", nil, 100_000); err != nil {
+		t.Fatalf("first mapReduceCompact error: %v", err)
+	}
+	firstCallCount := llm.calls.Load()
+	if firstCallCount < 2 {
+		t.Fatalf("expected the first pass to split into multiple chunks and invoke the LLM more than once, got %d", firstCallCount)
+	}
+
+	if _, err := s.mapReduceCompact(ctx, oldContents, "", nil, 100_000); err != nil {
+		t.Fatalf("second mapReduceCompact error: %v", err)
+	}
+	if got := llm.calls.Load(); got != firstCallCount {
+		t.Errorf("second pass over identical contents invoked the LLM %d more times, want every chunk summary reused from cache", got-firstCallCount)
+	}
+}
+
+func TestNewHierarchicalMapReduceStrategy_DefaultsChunkTokensAndFanout(t *testing.T) {
+	s := newHierarchicalMapReduceStrategy(newMockRegistry(), &mockLLM{name: "gpt-4o"}, 0, 0)
+	if s.chunkTokens != 0 {
+		t.Errorf("chunkTokens = %d, want 0 (resolved lazily to defaultChunkTokenBudget)", s.chunkTokens)
+	}
+	if s.fanout != 0 {
+		t.Errorf("fanout = %d, want 0 (resolved lazily to reduceGroupSize)", s.fanout)
+	}
+}
+
+func TestAdd_WithHierarchicalMapReduce(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithHierarchicalMapReduce(1_500, 6))
+
+	s, ok := guard.strategies["agent1"].(*hierarchicalMapReduceStrategy)
+	if !ok {
+		t.Fatalf("expected *hierarchicalMapReduceStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.Name() != StrategyHierarchicalMapReduce {
+		t.Errorf("strategy = %q, want %q", s.Name(), StrategyHierarchicalMapReduce)
+	}
+	if s.chunkTokens != 1_500 {
+		t.Errorf("chunkTokens = %d, want 1500", s.chunkTokens)
+	}
+	if s.fanout != 6 {
+		t.Errorf("fanout = %d, want 6", s.fanout)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultPeriodicMinTurns is used when newPeriodicStrategy is given
+// minTurns <= 0.
+const defaultPeriodicMinTurns = 3
+
+// periodicStrategy implements wall-clock-based compaction: summarization
+// fires once interval has elapsed since the last compaction, regardless of
+// turn count, as long as at least minTurns Content entries have
+// accumulated. This complements slidingWindowStrategy's turn-count trigger
+// for long-lived, bursty-then-idle agents that would otherwise never cross
+// a turn threshold between bursts.
+type periodicStrategy struct {
+	registry ModelRegistry
+	llm      model.LLM
+	interval time.Duration
+	minTurns int
+	mu       sync.Mutex
+}
+
+// newPeriodicStrategy creates a periodic strategy for a single agent. If
+// minTurns <= 0 it defaults to defaultPeriodicMinTurns.
+func newPeriodicStrategy(registry ModelRegistry, llm model.LLM, interval time.Duration, minTurns int) *periodicStrategy {
+	if minTurns <= 0 {
+		minTurns = defaultPeriodicMinTurns
+	}
+	return &periodicStrategy{
+		registry: registry,
+		llm:      llm,
+		interval: interval,
+		minTurns: minTurns,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *periodicStrategy) Name() string {
+	return StrategyPeriodic
+}
+
+// Compact summarizes the conversation once interval has elapsed since the
+// last compaction (or since this agent started, if none has run yet) and
+// at least minTurns Content entries are present. Otherwise it injects the
+// existing summary (if any) and returns without touching the conversation.
+func (s *periodicStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	totalContents := len(req.Contents)
+
+	last, hasLast := loadLastCompactionTime(ctx)
+	if !hasLast {
+		// Nothing to compact against yet; treat this call as the baseline so
+		// the interval starts counting from here rather than firing
+		// immediately on the very first request.
+		persistLastCompactionTime(ctx, time.Now())
+		if existingSummary != "" {
+			injectSummary(req, existingSummary, contentsAtLastCompaction)
+		}
+		return nil
+	}
+
+	elapsed := time.Since(last)
+	if elapsed < s.interval || totalContents < s.minTurns {
+		if existingSummary != "" {
+			injectSummary(req, existingSummary, contentsAtLastCompaction)
+		}
+		return nil
+	}
+
+	slog.Info("ContextGuard [periodic]: compaction interval elapsed, summarizing",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"elapsed", elapsed,
+		"interval", s.interval,
+		"totalContents", totalContents,
+		"minTurns", s.minTurns,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contextWindow := s.registry.ContextWindow(req.Model)
+	buffer := computeBuffer(contextWindow)
+
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+	recentKeep := s.minTurns
+
+	splitIdx := safeSplitIndex(req.Contents, len(req.Contents)-recentKeep)
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+
+	if len(oldContents) == 0 {
+		slog.Warn("ContextGuard [periodic]: nothing to compact (split at 0), aborting",
+			"agent", ctx.AgentName(),
+		)
+		persistLastCompactionTime(ctx, time.Now())
+		return nil
+	}
+
+	summary, err := summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+	if err != nil {
+		slog.Error("ContextGuard [periodic]: summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	tokenEstimate := estimateContentTokens(oldContents)
+	persistSummary(ctx, summary, tokenEstimate)
+	persistContentsAtCompaction(ctx, totalContents)
+	persistLastCompactionTime(ctx, time.Now())
+
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, userContent)
+
+	newTokens := estimateTokens(req)
+
+	slog.Info("ContextGuard [periodic]: compaction pass completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+		"newTokenEstimate", newTokens,
+	)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+)
+
+func TestPeriodicStrategy_FirstCallEstablishesBaselineWithoutCompacting(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newPeriodicStrategy(registry, llm, time.Hour, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(10)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary on the first call")
+	}
+	if _, ok := loadLastCompactionTime(ctx); !ok {
+		t.Error("expected a baseline compaction time to be recorded on the first call")
+	}
+}
+
+func TestPeriodicStrategy_DoesNotCompactBeforeIntervalElapses(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newPeriodicStrategy(registry, llm, time.Hour, 0)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now())
+
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary before the interval elapses, regardless of turn count")
+	}
+}
+
+func TestPeriodicStrategy_CompactsOnceIntervalElapsedAndMinTurnsMet(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: long-running session compacted."}
+	s := newPeriodicStrategy(registry, llm, time.Hour, 5)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now().Add(-2*time.Hour))
+
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary once the interval elapsed and minTurns was met")
+	}
+}
+
+func TestPeriodicStrategy_MinTurnsFloorPreventsCompactingAnIdleTinyConversation(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newPeriodicStrategy(registry, llm, time.Hour, 10)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now().Add(-24*time.Hour))
+
+	contents := kubeAgentConversation(1)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected minTurns to keep a tiny conversation from being compacted even after a long idle period")
+	}
+}
+
+func TestNewPeriodicStrategy_DefaultsMinTurns(t *testing.T) {
+	s := newPeriodicStrategy(newMockRegistry(), &mockLLM{name: "gpt-4o"}, time.Hour, 0)
+	if s.minTurns != defaultPeriodicMinTurns {
+		t.Errorf("minTurns = %d, want default %d", s.minTurns, defaultPeriodicMinTurns)
+	}
+}
+
+func TestAdd_WithPeriodicCompaction(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithPeriodicCompaction(30*time.Minute, 5))
+
+	s, ok := guard.strategies["agent1"].(*periodicStrategy)
+	if !ok {
+		t.Fatalf("expected *periodicStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.Name() != StrategyPeriodic {
+		t.Errorf("strategy = %q, want %q", s.Name(), StrategyPeriodic)
+	}
+	if s.interval != 30*time.Minute {
+		t.Errorf("interval = %v, want 30m", s.interval)
+	}
+	if s.minTurns != 5 {
+		t.Errorf("minTurns = %d, want 5", s.minTurns)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultSemanticRecentKeep is the number of trailing Content entries
+// semanticStrategy always keeps verbatim regardless of relevance score, the
+// same floor hierarchicalMapReduceStrategy and weightedSlidingWindowStrategy
+// use for their own recent-turn tail.
+const defaultSemanticRecentKeep = 3
+
+// semanticStrategy implements threshold-triggered compaction like
+// thresholdStrategy, but instead of summarizing every turn older than the
+// recent tail, it ranks them by relevance to the current task (see
+// semanticEvictionStrategy) and only summarizes away the lowest-scoring
+// ones that don't fit within keepTokens — so turns still relevant to what
+// the agent is doing survive verbatim even if they're old, while stale
+// turns are evicted before recent ones regardless of age.
+type semanticStrategy struct {
+	registry   ModelRegistry
+	llm        model.LLM
+	eviction   *semanticEvictionStrategy
+	keepTokens int
+	mu         sync.Mutex
+}
+
+// newSemanticStrategy creates a semantic strategy for a single agent.
+// embedder scores each older turn against the current user turn. keepTokens
+// is the budget for everything kept verbatim: the always-kept
+// defaultSemanticRecentKeep trailing entries are charged against it first,
+// then older turns are kept in descending score order while any budget is
+// left, so the last turn kept can take the total past keepTokens.
+func newSemanticStrategy(registry ModelRegistry, llm model.LLM, embedder Embedder, keepTokens int) *semanticStrategy {
+	return &semanticStrategy{
+		registry: registry,
+		llm:      llm,
+		eviction: &semanticEvictionStrategy{
+			embedder:   embedder,
+			keepRecent: defaultSemanticRecentKeep,
+		},
+		keepTokens: keepTokens,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *semanticStrategy) Name() string {
+	return StrategySemantic
+}
+
+// Compact summarizes once estimated token usage approaches the model's
+// context window, the same trigger thresholdStrategy uses, but splits
+// old/recent through s.eviction instead of a plain recency cut: the
+// lowest-scoring turns (by cosine similarity to the current task) are
+// summarized away first, and the highest-scoring ones are kept verbatim
+// while s.keepTokens has budget left (see newSemanticStrategy), even if
+// they're older than turns that got evicted.
+func (s *semanticStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if existingSummary != "" {
+		injectSummary(req, existingSummary, contentsAtLastCompaction)
+	}
+
+	contextWindow := s.registry.ContextWindow(req.Model)
+	buffer := computeBuffer(contextWindow)
+	threshold := contextWindow - buffer
+
+	totalTokens := estimateTokens(req)
+	if totalTokens < threshold {
+		return nil
+	}
+
+	slog.Info("ContextGuard [semantic]: threshold exceeded, summarizing by relevance",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"tokens", totalTokens,
+		"threshold", threshold,
+		"contextWindow", contextWindow,
+		"keepTokens", s.keepTokens,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+
+	oldContents, recentContents := s.eviction.Evict(ctx, req.Contents, s.keepTokens)
+	if len(oldContents) == 0 {
+		slog.Warn("ContextGuard [semantic]: nothing to compact (all turns scored within keepTokens), aborting",
+			"agent", ctx.AgentName(),
+		)
+		return nil
+	}
+
+	summary, err := summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+	if err != nil {
+		slog.Error("ContextGuard [semantic]: summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	persistSummary(ctx, summary, totalTokens)
+	persistContentsAtCompaction(ctx, len(req.Contents))
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, userContent)
+
+	slog.Info("ContextGuard [semantic]: compaction pass completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+	)
+
+	return nil
+}
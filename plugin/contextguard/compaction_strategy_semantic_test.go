@@ -0,0 +1,140 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestSemanticStrategy_DoesNotCompactBelowThreshold(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	embedder := &stubEmbedder{vectors: map[string][]float32{}}
+	s := newSemanticStrategy(registry, llm, embedder, 1000)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(2)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary when well under the context window")
+	}
+}
+
+func TestSemanticStrategy_EvictsLowestScoringTurnsFirst(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 2_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: stale turns compacted."}
+
+	relevant := "payment module update: added retries\n"
+	irrelevant := "unrelated aside about lunch plans\n"
+	current := "task: refactor the payment module\n"
+
+	embedder := &stubEmbedder{vectors: map[string][]float32{
+		current:    {1, 0},
+		relevant:   {1, 0},
+		irrelevant: {0, 1},
+	}}
+	s := newSemanticStrategy(registry, llm, embedder, 50)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(10)
+	contents = append(contents,
+		textContent("user", relevant),
+		textContent("user", irrelevant),
+		textContent("model", "noted"),
+		textContent("model", "noted"),
+		textContent("user", current),
+	)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: contents}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary once estimated tokens exceeded the context window threshold")
+	}
+	if got := loadContentsAtCompaction(ctx); got <= 0 {
+		t.Errorf("expected contentsAtCompaction watermark to advance, got %d", got)
+	}
+
+	var keptRelevant, keptIrrelevant bool
+	for _, c := range req.Contents {
+		for _, p := range c.Parts {
+			if p == nil {
+				continue
+			}
+			switch p.Text {
+			case relevant:
+				keptRelevant = true
+			case irrelevant:
+				keptIrrelevant = true
+			}
+		}
+	}
+	if !keptRelevant {
+		t.Error("expected the high-scoring relevant turn to be kept verbatim")
+	}
+	if keptIrrelevant {
+		t.Error("expected the low-scoring irrelevant turn to be summarized away")
+	}
+}
+
+func TestSemanticStrategy_FallsBackToRecencyOnEmbedderError(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 2_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: fallback path."}
+	embedder := &stubEmbedder{err: errors.New("embedding service unavailable")}
+	s := newSemanticStrategy(registry, llm, embedder, 50)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary via the recency fallback despite the embedder error")
+	}
+}
+
+func TestAdd_WithSemanticCompaction(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	embedder := &stubEmbedder{vectors: map[string][]float32{}}
+	guard.Add("agent1", llm, WithSemanticCompaction(embedder, 500))
+
+	s, ok := guard.strategies["agent1"].(*semanticStrategy)
+	if !ok {
+		t.Fatalf("expected *semanticStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.keepTokens != 500 {
+		t.Errorf("keepTokens = %d, want 500", s.keepTokens)
+	}
+	if s.Name() != StrategySemantic {
+		t.Errorf("Name() = %q, want %q", s.Name(), StrategySemantic)
+	}
+}
@@ -18,9 +18,11 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/model"
+	"google.golang.org/genai"
 )
 
 // slidingWindowStrategy implements turn-count-based compaction. When the
@@ -32,6 +34,26 @@ type slidingWindowStrategy struct {
 	llm      model.LLM
 	maxTurns int
 	mu       sync.Mutex
+
+	// reduceResponses is false unless SetToolReducers was called. See
+	// thresholdStrategy.SetToolReducers for the rationale.
+	reduceResponses bool
+
+	// dedup and dedupNormalizer are set by SetDedup. See
+	// thresholdStrategy.SetDedup for the rationale.
+	dedup           bool
+	dedupNormalizer DedupNormalizerFunc
+
+	// patternCompressor is set by SetToolResultPatternCompression. See
+	// thresholdStrategy.SetToolResultPatternCompression for the rationale.
+	patternCompressor *toolResultPatternCompressor
+
+	// batchLimit and sleepInterval are set by SetBatching. batchLimit <= 0
+	// (the default) summarizes oldContents in a single call, preserving the
+	// pre-batching behavior; sleepInterval <= 0 means no pause between
+	// chunks.
+	batchLimit    int
+	sleepInterval time.Duration
 }
 
 const recentKeepRatio = 0.30
@@ -50,6 +72,85 @@ func (s *slidingWindowStrategy) Name() string {
 	return StrategySlidingWindow
 }
 
+// SetToolReducers enables the ToolReducer pass (see RegisterToolReducer):
+// Compact shrinks recognized tool-response payloads older than the most
+// recent defaultToolReducerRecentKeep entries before counting turns.
+func (s *slidingWindowStrategy) SetToolReducers(enabled bool) {
+	s.reduceResponses = enabled
+}
+
+// SetDedup enables content-hash deduplication of repeated tool responses.
+// See thresholdStrategy.SetDedup for the rationale; normalizer may be nil to
+// use defaultDedupNormalizer.
+func (s *slidingWindowStrategy) SetDedup(normalizer DedupNormalizerFunc) {
+	s.dedup = true
+	s.dedupNormalizer = normalizer
+}
+
+// SetToolResultPatternCompression enables a Drain-style clustering pass
+// (see toolResultPatternCompressor) that merges clusters of near-identical
+// historical tool-call/tool-result pairs into a single synthetic content
+// before turns are counted. See
+// thresholdStrategy.SetToolResultPatternCompression for the rationale.
+func (s *slidingWindowStrategy) SetToolResultPatternCompression(cfg toolResultPatternCompressionConfig) {
+	s.patternCompressor = newToolResultPatternCompressor(cfg)
+}
+
+// SetBatching enables map-reduce-style batched summarization: oldContents
+// is split into chunks of at most batchLimit entries, each summarized with
+// the previous chunk's output fed in as existingSummary, with a pause of
+// sleepInterval between chunks so large histories don't blow past provider
+// TPM/RPM limits in a single burst. batchLimit <= 0 disables batching
+// (summarize the whole slice in one call, the default); sleepInterval <= 0
+// means no pause between chunks.
+func (s *slidingWindowStrategy) SetBatching(batchLimit int, sleepInterval time.Duration) {
+	s.batchLimit = batchLimit
+	s.sleepInterval = sleepInterval
+}
+
+// summarizeBatched summarizes oldContents, splitting it into chunks of at
+// most s.batchLimit entries when batching is enabled (see SetBatching).
+// Each chunk is summarized with the previous chunk's summary fed in as
+// existingSummary, map-reduce style, with a sleep of s.sleepInterval
+// between chunks. With batching disabled it's equivalent to a single call
+// to summarize.
+func (s *slidingWindowStrategy) summarizeBatched(ctx agent.CallbackContext, oldContents []*genai.Content, existingSummary string, buffer int, todos []TodoItem) (string, error) {
+	if s.batchLimit <= 0 || len(oldContents) <= s.batchLimit {
+		return summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+	}
+
+	var chunks [][]*genai.Content
+	for start := 0; start < len(oldContents); start += s.batchLimit {
+		end := min(start+s.batchLimit, len(oldContents))
+		chunks = append(chunks, oldContents[start:end])
+	}
+
+	summary := existingSummary
+	cumulativeTokens := 0
+	for i, chunk := range chunks {
+		var err error
+		summary, err = summarize(ctx, s.llm, chunk, summary, buffer, todos)
+		if err != nil {
+			return "", fmt.Errorf("batch %d/%d: %w", i+1, len(chunks), err)
+		}
+
+		cumulativeTokens += estimateContentTokens(chunk)
+		slog.Info("ContextGuard [sliding_window]: batched summarization chunk completed",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"chunk", i+1,
+			"chunks", len(chunks),
+			"cumulativeTokenEstimate", cumulativeTokens,
+		)
+
+		if i < len(chunks)-1 && s.sleepInterval > 0 {
+			time.Sleep(s.sleepInterval)
+		}
+	}
+
+	return summary, nil
+}
+
 // Compact counts Content entries that arrived after the last compaction.
 // If that count exceeds maxTurns, it summarizes all old entries and keeps
 // only a small recent window. If a single pass still exceeds the context
@@ -57,6 +158,39 @@ func (s *slidingWindowStrategy) Name() string {
 // maxCompactionAttempts). Otherwise it injects the existing summary
 // (if any) and returns without touching the conversation.
 func (s *slidingWindowStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	if s.reduceResponses {
+		if n := reduceToolResponses(req.Contents, defaultToolReducerRecentKeep); n > 0 {
+			slog.Info("ContextGuard [sliding_window]: reduced historical tool responses",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"responsesReduced", n,
+			)
+		}
+	}
+
+	if s.dedup {
+		if n := dedupToolResponses(ctx, req.Contents, s.dedupNormalizer); n > 0 {
+			slog.Info("ContextGuard [sliding_window]: deduplicated repeated tool responses",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"responsesDeduped", n,
+			)
+		}
+	}
+
+	if s.patternCompressor != nil {
+		if boundary := safeSplitIndex(req.Contents, len(req.Contents)-defaultPatternRecentKeep); boundary > 0 {
+			if compressed, n := s.patternCompressor.compress(req.Contents, boundary); n > 0 {
+				req.Contents = compressed
+				slog.Info("ContextGuard [sliding_window]: compressed repetitive tool-result clusters",
+					"agent", ctx.AgentName(),
+					"session", ctx.SessionID(),
+					"clustersCompressed", n,
+				)
+			}
+		}
+	}
+
 	existingSummary := loadSummary(ctx)
 	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
 
@@ -103,7 +237,7 @@ func (s *slidingWindowStrategy) Compact(ctx agent.CallbackContext, req *model.LL
 			break
 		}
 
-		summary, err := summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+		summary, err := s.summarizeBatched(ctx, oldContents, existingSummary, buffer, todos)
 		if err != nil {
 			slog.Error("ContextGuard [sliding_window]: summarization FAILED",
 				"agent", ctx.AgentName(),
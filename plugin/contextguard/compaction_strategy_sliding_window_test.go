@@ -0,0 +1,99 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+)
+
+func TestSlidingWindowStrategy_BatchedSummarizationSplitsIntoChunks(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &countingLLM{mockLLM: mockLLM{name: "gpt-4o", response: "Summary: chunk processed."}}
+	s := newSlidingWindowStrategy(registry, llm, 10)
+	s.SetBatching(5, 0)
+
+	ctx := newMockCallbackContext("agent1")
+	contents := kubeAgentConversation(20)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary after batched compaction")
+	}
+	if got := llm.calls.Load(); got < 2 {
+		t.Errorf("summarizer called %d time(s), want one call per chunk (at least 2)", got)
+	}
+}
+
+func TestSlidingWindowStrategy_SummarizeBatchedMatchesUnbatchedWhenDisabled(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: single pass."}
+	s := newSlidingWindowStrategy(registry, llm, 10)
+
+	ctx := newMockCallbackContext("agent1")
+	contents := kubeAgentConversation(20)
+
+	got, err := s.summarizeBatched(ctx, contents, "", 1000, nil)
+	if err != nil {
+		t.Fatalf("summarizeBatched error: %v", err)
+	}
+	want, err := summarize(ctx, s.llm, contents, "", 1000, nil)
+	if err != nil {
+		t.Fatalf("summarize error: %v", err)
+	}
+	if got != want {
+		t.Errorf("summarizeBatched() = %q, want %q (batching disabled should match summarize)", got, want)
+	}
+}
+
+func TestSlidingWindowStrategy_SummarizeBatchedSleepsBetweenChunks(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: chunk processed."}
+	s := newSlidingWindowStrategy(registry, llm, 10)
+	s.SetBatching(5, 10*time.Millisecond)
+
+	ctx := newMockCallbackContext("agent1")
+	contents := kubeAgentConversation(20)
+
+	start := time.Now()
+	if _, err := s.summarizeBatched(ctx, contents, "", 1000, nil); err != nil {
+		t.Fatalf("summarizeBatched error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("expected summarizeBatched to pause between chunks, elapsed only %v", elapsed)
+	}
+}
+
+func TestAdd_WithBatchedSummarization(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithSlidingWindow(30), WithBatchedSummarization(25, 5*time.Second))
+
+	s, ok := guard.strategies["agent1"].(*slidingWindowStrategy)
+	if !ok {
+		t.Fatalf("expected *slidingWindowStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.batchLimit != 25 {
+		t.Errorf("batchLimit = %d, want 25", s.batchLimit)
+	}
+	if s.sleepInterval != 5*time.Second {
+		t.Errorf("sleepInterval = %v, want 5s", s.sleepInterval)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// SummarizationOptions configures the summarization strategy.
+type SummarizationOptions struct {
+	// TargetTokens is the high-water mark: compaction fires when the
+	// estimated token count crosses it. A single pass then summarizes every
+	// entry older than the KeepRecentTurns tail; the result is not checked
+	// against TargetTokens again, so it can stay above it when the kept tail
+	// is large. <= 0 uses the context window minus computeBuffer.
+	TargetTokens int
+
+	// KeepRecentTurns is the number of most recent Content entries that are
+	// never summarized, regardless of TargetTokens.
+	KeepRecentTurns int
+
+	// PreserveToolCalls keeps the split point from landing between a
+	// tool_call and its tool_response, so function-calling chains don't
+	// break mid-pair. When true, the split point is adjusted with
+	// safeSplitIndex the same way the other strategies do. Pairs older than
+	// the split are still folded into the summary.
+	PreserveToolCalls bool
+
+	// PromptTemplate overrides the system prompt used for the summarization
+	// call. Empty uses the shared summarizeSystemPrompt.
+	PromptTemplate string
+
+	// Summarizer overrides the LLM used to produce summaries. Defaults to
+	// the llmModel passed to ContextGuard.Add.
+	Summarizer model.LLM
+}
+
+// SummarizationStats reports cumulative summarization activity for a single
+// agent's strategy, so callers can log token spend without instrumenting
+// Compact themselves.
+type SummarizationStats struct {
+	// CompactionCount is the number of times Compact has summarized content.
+	CompactionCount int
+	// TotalSummarizedTokens is the cumulative estimated token count of all
+	// content that has been folded into a summary.
+	TotalSummarizedTokens int
+	// EstimatedCostUSD is the cumulative estimated cost of the
+	// summarization LLM calls, using the registry's cost metadata when
+	// available (e.g. CrushRegistry). Zero if the registry doesn't expose
+	// pricing.
+	EstimatedCostUSD float64
+}
+
+// costProvider is implemented by ModelRegistry backends that expose pricing
+// metadata (currently CrushRegistry). Strategies type-assert against it to
+// populate SummarizationStats.EstimatedCostUSD.
+type costProvider interface {
+	CostPerMillionTokens(modelID string) (in, out float64)
+}
+
+// summarizationStrategy implements a high-water-mark compaction strategy
+// with an explicit recent-turn floor and an optional tool-call-safe split,
+// as an alternative to the threshold and sliding-window strategies.
+type summarizationStrategy struct {
+	registry ModelRegistry
+	llm      model.LLM
+	opts     SummarizationOptions
+	mu       sync.Mutex
+	stats    SummarizationStats
+}
+
+// newSummarizationStrategy creates a summarization strategy. If
+// opts.Summarizer is nil, llm is used for summarization calls.
+func newSummarizationStrategy(registry ModelRegistry, llm model.LLM, opts SummarizationOptions) *summarizationStrategy {
+	if opts.Summarizer == nil {
+		opts.Summarizer = llm
+	}
+	if opts.KeepRecentTurns <= 0 {
+		opts.KeepRecentTurns = 3
+	}
+	return &summarizationStrategy{
+		registry: registry,
+		llm:      llm,
+		opts:     opts,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *summarizationStrategy) Name() string {
+	return StrategySummarization
+}
+
+// Stats returns a snapshot of cumulative summarization activity for this
+// agent, so callers can log summarization token/cost spend.
+func (s *summarizationStrategy) Stats() SummarizationStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Compact summarizes the oldest turns (preserving the last KeepRecentTurns
+// and, if PreserveToolCalls is set, whole tool-call/tool-response pairs)
+// whenever the token estimate crosses TargetTokens. The previous summary is
+// folded into every new one, so a rolling "summary of summaries" is kept
+// across multiple compactions instead of the context degrading monotonically.
+func (s *summarizationStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if existingSummary != "" {
+		injectSummary(req, existingSummary, contentsAtLastCompaction)
+	}
+
+	targetTokens := s.opts.TargetTokens
+	if targetTokens <= 0 {
+		targetTokens = s.registry.ContextWindow(req.Model) - computeBuffer(s.registry.ContextWindow(req.Model))
+	}
+
+	if estimateTokens(req) < targetTokens {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := s.opts.KeepRecentTurns
+	splitIdx := len(req.Contents) - keep
+	if splitIdx < 0 {
+		splitIdx = 0
+	}
+	if s.opts.PreserveToolCalls {
+		splitIdx = safeSplitIndex(req.Contents, splitIdx)
+	}
+
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+	if len(oldContents) == 0 {
+		return nil
+	}
+
+	buffer := computeBuffer(s.registry.ContextWindow(req.Model))
+	summary, err := summarize(ctx, s.opts.Summarizer, oldContents, existingSummary, buffer, loadTodos(ctx))
+	if err != nil {
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	tokens := estimateContentTokens(oldContents)
+	persistSummary(ctx, summary, tokens)
+	persistContentsAtCompaction(ctx, len(req.Contents))
+	replaceSummary(req, summary, recentContents)
+
+	s.stats.CompactionCount++
+	s.stats.TotalSummarizedTokens += tokens
+	if cp, ok := s.registry.(costProvider); ok {
+		in, _ := cp.CostPerMillionTokens(req.Model)
+		s.stats.EstimatedCostUSD += float64(tokens) / 1_000_000 * in
+	}
+
+	slog.Info("ContextGuard [summarization]: compaction completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+		"compactionCount", s.stats.CompactionCount,
+	)
+
+	return nil
+}
@@ -15,11 +15,16 @@
 package contextguard
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/model"
+	"google.golang.org/genai"
 )
 
 // thresholdStrategy implements token-based compaction. It estimates total
@@ -38,15 +43,720 @@ type thresholdStrategy struct {
 	llm       model.LLM
 	maxTokens int
 	mu        sync.Mutex
+
+	// tokenizer, ratios, and pending are nil unless the agent was registered
+	// with WithTokenizerRegistry. Set directly by ContextGuard.Add rather
+	// than threaded through newThresholdStrategy, so existing call sites
+	// that construct a thresholdStrategy without them keep working
+	// unchanged.
+	tokenizer *TokenizerRegistry
+	ratios    *ratioTracker
+	pending   *pendingHeuristicTracker
+
+	// tokenCountCache memoizes rawHeuristic's last result against the exact
+	// *model.LLMRequest and Contents length it was computed for, so a
+	// provider-level retry of the same unmodified request doesn't re-run a
+	// real (possibly network-backed, see NewVertexTokenizer) Tokenizer
+	// against it a second time.
+	tokenCountCache lastCallCache
+
+	// chain is the zero value (keepRecent == 0) unless
+	// SetChainCompactionPolicy was called, in which case Compact prefers it
+	// over full summarization whenever req.Contents ends with an in-flight
+	// sequential tool chain.
+	chain chainCompactionPolicy
+
+	// overflow is nil unless SetOverflowLimiter was called, in which case
+	// Compact consults it before full summarization whenever the threshold
+	// is exceeded (see applyOverflowLimiter).
+	overflow *OverflowLimiter
+
+	// hints is nil unless SetCompactionHints was called, in which case
+	// Compact honors per-Content CompactionHints (see applyCompactionHints)
+	// both unconditionally (MustSummarize) and as a cheaper alternative to
+	// full summarization (EvictFirst/NoCompact).
+	hints CompactionHintFunc
+
+	// opts is the zero ThresholdOptions (RetentionMode FullSummary, every
+	// ratio/attempt defaulted) unless SetThresholdOptions was called.
+	opts ThresholdOptions
+
+	// store is nil unless SetSummaryStore was called, in which case Compact
+	// consults it on cold start (ctx.State() has no summary yet, e.g. this
+	// replica never handled the session before) and writes through to it
+	// after every successful compaction, so the summary and calibration
+	// counters survive a process restart or move to a different replica.
+	store SummaryStore
+
+	// reduceResponses is false unless SetToolReducers was called, in which
+	// case Compact runs the ToolReducer pass (see reduceToolResponses) over
+	// historical tool responses before estimating tokens, so well-known
+	// noisy payloads (kubectl JSON, Prometheus ranges, SQL row dumps) shrink
+	// before they ever factor into the threshold check — and ideally before
+	// they'd otherwise force a full summarization pass at all.
+	reduceResponses bool
+
+	// dedup is false unless SetDedup was called, in which case Compact runs
+	// dedupToolResponses over the whole conversation before estimating
+	// tokens, replacing every repeat occurrence of an identical (normalized)
+	// tool response with a small {deduped_ref, first_seen_turn} stub.
+	dedup bool
+
+	// dedupNormalizer is passed to dedupToolResponses; nil selects
+	// defaultDedupNormalizer. Only meaningful when dedup is true.
+	dedupNormalizer DedupNormalizerFunc
+
+	// patternCompressor is nil unless SetToolResultPatternCompression was
+	// called, in which case Compact runs it over historical tool-call/
+	// tool-result pairs before estimating tokens, merging clusters of
+	// near-identical results into a single synthetic content (see
+	// toolResultPatternCompressor).
+	patternCompressor *toolResultPatternCompressor
+
+	// hierarchical is false unless SetHierarchicalSummaries was called, in
+	// which case Compact (under RetentionMode FullSummary only) maintains a
+	// rolling SummaryTree instead of a single flat summary string, bounding
+	// total summary length as the session grows.
+	hierarchical bool
+
+	// summaryTreeFanout is the SummaryTree's per-level node cap; <= 0
+	// selects defaultSummaryTreeFanout. Only meaningful when hierarchical is
+	// true.
+	summaryTreeFanout int
+
+	// summaryLeafTokens is the target length for a SummaryTree Level-0 node
+	// (the summary of one just-evicted window), independent of the token
+	// budget internal roll-up nodes are held to. <= 0 falls back to the
+	// existing buffer-derived target. Only meaningful when hierarchical is
+	// true. See WithHierarchicalSummary.
+	summaryLeafTokens int
+
+	// summaryMaxDepth caps how many levels a SummaryTree may grow to; <= 0
+	// leaves it unbounded. Once the deepest allowed level would overflow
+	// fanout, rollUp collapses it in place (summarizing all of its nodes
+	// into one) instead of promoting into a new level. Only meaningful when
+	// hierarchical is true. See WithHierarchicalSummary.
+	summaryMaxDepth int
+
+	// oversizedContent is false unless SetOversizedContentSplitting was
+	// called, in which case Compact runs summarizeOversizedParts over the
+	// conversation before estimating tokens, map-reduce-summarizing any
+	// single part (a giant tool response) too large for a normal
+	// summarization pass to ever fit.
+	oversizedContent bool
+
+	// oversizedContentFraction is the fraction of the context window a
+	// part's estimated tokens must exceed to be treated as oversized; <= 0
+	// selects defaultOversizedContentFraction. Only meaningful when
+	// oversizedContent is true.
+	oversizedContentFraction float64
+
+	// pool is nil unless SetSummarizationPool was called, in which case
+	// every summarize call this strategy makes (see summarizeViaPool) goes
+	// through it instead of calling summarize directly, bounding
+	// concurrency and deduplicating identical in-flight requests across
+	// every agent sharing the pool.
+	pool *SummarizationPool
+
+	// stallHandler is nil unless SetOnCompactionStalled was called, in
+	// which case compactPreserveTail's retry loop invokes it instead of
+	// silently keeping a stalled (converged or regressed) attempt's
+	// result. See CompactionStallEvent.
+	stallHandler OnCompactionStalledFunc
+
+	// progress is nil unless SetSummaryProgress was called, in which case
+	// every summarize call this strategy makes (outside the SummarizationPool
+	// path, which has its own call path) reports incremental partial text
+	// through it as the summarizer LLM streams its response.
+	progress SummaryProgress
+
+	// eviction is nil unless SetEvictionStrategy was called, in which case
+	// compactPreserveTail splits old/recent through it instead of the
+	// default recency-based findSplitIndex. See WithSemanticEviction.
+	eviction EvictionStrategy
+
+	// planner is nil unless SetPlanner was called, in which case
+	// compactPreserveTail delegates the whole old/recent/MustRetain
+	// decision to it instead of building a thresholdPlanner on the fly
+	// from eviction/counter. See Planner, WithPlanner.
+	planner Planner
+
+	// structuredSummary is false unless SetStructuredSummary was called, in
+	// which case summarizeViaPool requests a typed SummaryDoc from the
+	// summarizer LLM instead of a flat Markdown string. See
+	// WithStructuredSummary.
+	structuredSummary bool
+
+	// summaryDocStore is nil unless SetSummaryDocStore was called, in which
+	// case a structured summary is written there instead of inline in
+	// session state, and only a short ref is kept in session state. Only
+	// meaningful when structuredSummary is true. See WithSummaryDocStore.
+	summaryDocStore SummaryDocStore
+
+	// summarizer is nil unless SetSummarizer was called, in which case
+	// summarizeViaPool delegates to it instead of the package's default
+	// single-shot summarizeStreaming/SummarizationPool path. Takes priority
+	// over pool but not over structuredSummary, which needs its own typed
+	// JSON call path. See WithSummarizer, MapReduceSummarizer.
+	summarizer Summarizer
+
+	// continuationBuilder is nil unless SetContinuationPromptBuilder was
+	// called, in which case Compact renders the post-compaction continuation
+	// message through it instead of defaultContinuationBuilder. See
+	// WithContinuationPromptBuilder.
+	continuationBuilder ContinuationPromptBuilder
+
+	// continuationLocale is threaded into every ContinuationPromptData.Locale
+	// field this strategy builds, for a continuationBuilder whose template
+	// branches on locale (e.g. one built with
+	// NewContinuationPromptBuilderFromTemplate covering more than one
+	// language). "" unless SetContinuationLocale was called.
+	continuationLocale string
+
+	// continuationMode selects whether Compact follows a summary with a
+	// synthetic user turn, resumes a truncated assistant turn verbatim, or
+	// detects which applies automatically. "" (the zero value) behaves like
+	// ContinuationModeAuto. See SetContinuationMode, WithContinuationMode.
+	continuationMode ContinuationMode
+
+	// observer is nil unless SetCompactionObserver was called, in which case
+	// Compact reports CompactionStartEvent/SummaryProducedEvent/
+	// ContinuationInjectedEvent to it instead of running silently. See
+	// WithCompactionObserver.
+	observer ThresholdCompactionObserver
+
+	// counter is nil unless SetTokenCounter was called, in which case
+	// compactPreserveTail's findSplitIndex call uses it instead of the
+	// package's fixed chars-per-token heuristic, for a split boundary that
+	// holds up closer to the real threshold on code, JSON tool payloads, and
+	// non-Latin scripts. See WithTokenCounter.
+	counter TokenCounter
+
+	// incrementalSummary is true unless SetIncrementalSummary(false) was
+	// called. When true, a RetentionMode FullSummary compaction that already
+	// has a previous summary sends only the delta contents since the last
+	// compaction to the summarizer, with an "extend, don't rewrite"
+	// instruction, instead of re-summarizing from scratch every time. Has no
+	// effect under PreserveTail (which already only summarizes the evicted
+	// portion) or when SetStructuredSummary/SetSummarizer/
+	// SetSummarizationPool is also configured. See WithIncrementalSummary.
+	incrementalSummary bool
+
+	// summaryRewriteEvery forces a full rewrite every summaryRewriteEvery-th
+	// compaction instead of extending incrementally, to bound drift from
+	// compounding incremental edits. <= 0 (the default) never forces one. See
+	// WithSummaryRewriteEvery.
+	summaryRewriteEvery int
+}
+
+// RetentionMode selects how thresholdStrategy's summarization fallback
+// treats the most recent portion of the conversation once the threshold is
+// exceeded.
+type RetentionMode int
+
+const (
+	// FullSummary summarizes the entire conversation with no recent tail
+	// kept verbatim, matching Crush CLI behavior. This is the default
+	// (the zero value of RetentionMode).
+	FullSummary RetentionMode = iota
+
+	// PreserveTail keeps a RecentWindowRatio-sized tail of the conversation
+	// verbatim and summarizes only the older portion, retrying with a
+	// progressively smaller tail (up to MaxCompactionAttempts) if one pass
+	// isn't enough to land back under the threshold.
+	PreserveTail
+)
+
+// ThresholdOptions configures thresholdStrategy's retention behavior. The
+// zero value selects FullSummary with the package's existing defaults.
+// Set via SetThresholdOptions, or contextguard.WithThresholdOptions when
+// registering an agent.
+type ThresholdOptions struct {
+	// RetentionMode selects FullSummary (default) or PreserveTail.
+	RetentionMode RetentionMode
+
+	// RecentWindowRatio sizes PreserveTail's verbatim tail, as a fraction of
+	// the context window. Defaults to recentWindowRatio (0.20) when <= 0.
+	// Unused under FullSummary.
+	RecentWindowRatio float64
+
+	// MaxCompactionAttempts bounds PreserveTail's shrink loop: if a pass
+	// still exceeds the threshold, RecentWindowRatio is halved and
+	// summarization retried. Defaults to maxCompactionAttempts (3) when
+	// <= 0. Unused under FullSummary.
+	MaxCompactionAttempts int
+
+	// BufferFraction overrides the safety buffer computeBuffer reserves for
+	// context windows below largeContextWindowThreshold, as a fraction of
+	// the window. Defaults to smallContextWindowRatio (0.20) when <= 0.
+	BufferFraction float64
 }
 
 // newThresholdStrategy creates a threshold strategy. If maxTokens > 0 it
 // overrides the registry lookup for the context window size.
 func newThresholdStrategy(registry ModelRegistry, llm model.LLM, maxTokens int) *thresholdStrategy {
 	return &thresholdStrategy{
-		registry:  registry,
-		llm:       llm,
-		maxTokens: maxTokens,
+		registry:           registry,
+		llm:                llm,
+		maxTokens:          maxTokens,
+		incrementalSummary: true,
+	}
+}
+
+// defaultChainStubTemplate is the fallback used by SetChainCompactionPolicy
+// when no stubTemplate is given. It is a fmt verb taking (step index,
+// original response byte size, truncated preview of the original response).
+const defaultChainStubTemplate = "step-%d produced %d bytes summarizing to: %s"
+
+// chainStubPreviewChars caps how much of an old tool result's rendered
+// response survives into its stub, keeping the stub itself cheap.
+const chainStubPreviewChars = 80
+
+// chainStubMarkerKey flags a FunctionResponse.Response map as already
+// stubbed, so a chain that's reduced across several consecutive
+// BeforeModelCallback invocations doesn't re-stub (and re-shrink the
+// preview of) an already-stubbed result.
+const chainStubMarkerKey = "_contextguard_chain_stub"
+
+// chainCompactionPolicy configures the in-flight tool-chain reducer. The
+// zero value disables it.
+type chainCompactionPolicy struct {
+	keepRecent   int
+	stubTemplate string
+
+	// proactive enables mid-turn triggering (see SetMidTurnChainCompaction):
+	// the reducer runs as soon as the chain's projected next step would
+	// overflow the threshold, instead of waiting for req.Contents to
+	// already be over it.
+	proactive bool
+}
+
+// SetChainCompactionPolicy enables the in-flight tool-chain reducer: when
+// Compact's threshold check finds that req.Contents ends with a run of
+// sequential [model:FunctionCall, user:FunctionResponse] pairs from the
+// current unfinished assistant turn (see detectToolChain), it keeps the
+// most recent keepRecent pairs verbatim and replaces the FunctionResponse
+// payload of older pairs in that same run with a short stub built from
+// stubTemplate. The FunctionCall/FunctionResponse entries themselves are
+// never removed, so tool_use/tool_result pairing stays intact — only the
+// bulky response payload shrinks. A chain's final, not-yet-answered step is
+// never touched, since it is the tool result the model is about to reason
+// about next.
+//
+// This runs before falling back to full conversation summarization, and
+// only when at least one full pair past keepRecent exists in the chain —
+// stubbing is cheap (no LLM call) and avoids the risk of a summarizer
+// describing a tool result the model still needs mid-chain. stubTemplate
+// defaults to defaultChainStubTemplate when empty; it must be a fmt verb
+// taking (step index, original byte size, truncated preview).
+func (s *thresholdStrategy) SetChainCompactionPolicy(keepRecent int, stubTemplate string) {
+	if stubTemplate == "" {
+		stubTemplate = defaultChainStubTemplate
+	}
+	s.chain.keepRecent = keepRecent
+	s.chain.stubTemplate = stubTemplate
+}
+
+// SetMidTurnChainCompaction enables proactive triggering of the in-flight
+// tool-chain reducer (see SetChainCompactionPolicy, which this must be
+// combined with — it has no effect while keepRecent is 0): instead of only
+// reducing the chain once req.Contents already exceeds the threshold,
+// Compact also estimates the token size of the chain's next, not-yet-run
+// step from the rolling average of its completed steps (see
+// projectedChainNextStepTokens) and reduces early whenever that projection
+// would itself push the conversation over the threshold. This catches
+// chains whose step sizes escalate (a "list" step followed by increasingly
+// large "describe"/"analyze" steps) before the overflowing step actually
+// lands, rather than one step late.
+func (s *thresholdStrategy) SetMidTurnChainCompaction(enabled bool) {
+	s.chain.proactive = enabled
+}
+
+// SetOverflowLimiter enables the overflow limiter: whenever Compact's
+// threshold check fires, the FunctionResponse parts of the most recently
+// appended tool-result Content are run through limiter.Decide before
+// falling back to chain reduction and full summarization, so a limiter
+// fully saturated by back-to-back overflowing turns degrades to async
+// placeholders or hard-drops instead of an LLM summarization call on every
+// single turn.
+func (s *thresholdStrategy) SetOverflowLimiter(limiter *OverflowLimiter) {
+	s.overflow = limiter
+}
+
+// SetCompactionHints enables per-Content CompactionHints: Compact consults
+// fn both unconditionally, each call (so MustSummarize's "even if the
+// window has room" guarantee holds), and again — to pick EvictFirst
+// content over its normal heuristic — right before falling back to full
+// summarization. See CompactionHints and applyCompactionHints.
+func (s *thresholdStrategy) SetCompactionHints(fn CompactionHintFunc) {
+	s.hints = fn
+}
+
+// SetThresholdOptions selects thresholdStrategy's retention behavior (see
+// ThresholdOptions and RetentionMode). Unset fields keep the package's
+// existing defaults, so passing a ThresholdOptions with only RetentionMode
+// set is enough to switch modes.
+func (s *thresholdStrategy) SetThresholdOptions(opts ThresholdOptions) {
+	s.opts = opts
+}
+
+// SetSummaryStore enables cross-restart/cross-replica persistence of the
+// running summary and calibration counters (see SummaryStore). Compact
+// consults store on cold start and writes through after every compaction;
+// the per-request ctx.State() values set by persistSummary/
+// persistContentsAtCompaction/resetCalibration remain the source of truth
+// for the rest of the current process's lifetime.
+func (s *thresholdStrategy) SetSummaryStore(store SummaryStore) {
+	s.store = store
+}
+
+// SetToolReducers enables the ToolReducer pass (see RegisterToolReducer and
+// the package's built-in kubectl/Prometheus/SQL reducers): Compact shrinks
+// recognized tool-response payloads older than the most recent
+// defaultToolReducerRecentKeep entries before estimating tokens, on every
+// call, not just once the threshold is already exceeded.
+func (s *thresholdStrategy) SetToolReducers(enabled bool) {
+	s.reduceResponses = enabled
+}
+
+// SetDedup enables content-hash deduplication of repeated tool responses
+// (see dedupToolResponses): on every Compact call, the second and later
+// occurrence of an identical (normalized) FunctionResponse payload is
+// replaced with a small {deduped_ref, first_seen_turn} stub before tokens
+// are estimated. normalizer may be nil to use defaultDedupNormalizer.
+func (s *thresholdStrategy) SetDedup(normalizer DedupNormalizerFunc) {
+	s.dedup = true
+	s.dedupNormalizer = normalizer
+}
+
+// SetToolResultPatternCompression enables a Drain-style clustering pass
+// (see toolResultPatternCompressor) that merges clusters of near-identical
+// historical tool-call/tool-result pairs into a single synthetic content
+// before tokens are estimated, instead of handing every repeated
+// occurrence to the summarizer LLM. See WithToolResultPatternCompression.
+func (s *thresholdStrategy) SetToolResultPatternCompression(cfg toolResultPatternCompressionConfig) {
+	s.patternCompressor = newToolResultPatternCompressor(cfg)
+}
+
+// SetHierarchicalSummaries switches Compact (under RetentionMode
+// FullSummary) from a single flat summary string to a rolling SummaryTree:
+// each compaction produces one Level-0 node for the newly-evicted turns,
+// and whenever a level exceeds fanout nodes, the oldest fanout are merged
+// into a node one level up. fanout <= 0 selects defaultSummaryTreeFanout.
+// Has no effect under RetentionMode PreserveTail.
+func (s *thresholdStrategy) SetHierarchicalSummaries(fanout int) {
+	s.hierarchical = true
+	s.summaryTreeFanout = fanout
+}
+
+// SetHierarchicalSummaryLimits additionally bounds compactHierarchical's
+// SummaryTree: leafTokens overrides the buffer-derived target used for each
+// Level-0 node (<= 0 keeps the existing derived target), and maxDepth caps
+// how many levels the tree may grow to (<= 0 leaves it unbounded). See
+// WithHierarchicalSummary.
+func (s *thresholdStrategy) SetHierarchicalSummaryLimits(leafTokens, maxDepth int) {
+	s.summaryLeafTokens = leafTokens
+	s.summaryMaxDepth = maxDepth
+}
+
+// SetOversizedContentSplitting enables summarizeOversizedParts: before
+// estimating tokens, Compact map-reduce-summarizes any single part (a
+// FunctionResponse payload or raw Text block) whose estimated tokens
+// exceed fraction of the context window, so a single outsized tool
+// response can't permanently overflow every compaction attempt regardless
+// of how aggressively the rest of the conversation is compacted. fraction
+// <= 0 selects defaultOversizedContentFraction.
+func (s *thresholdStrategy) SetOversizedContentSplitting(fraction float64) {
+	s.oversizedContent = true
+	s.oversizedContentFraction = fraction
+}
+
+// SetSummarizationPool routes every summarize call this strategy makes
+// through pool instead of calling the LLM directly, bounding concurrency
+// and deduplicating identical in-flight requests shared with other agents
+// on the same pool. See WithSummarizationPool.
+func (s *thresholdStrategy) SetSummarizationPool(pool *SummarizationPool) {
+	s.pool = pool
+}
+
+// SetOnCompactionStalled installs handler as compactPreserveTail's escape
+// hatch for a retry loop that has converged or regressed (see
+// CompactionStallEvent). See WithOnCompactionStalled.
+func (s *thresholdStrategy) SetOnCompactionStalled(handler OnCompactionStalledFunc) {
+	s.stallHandler = handler
+}
+
+// SetSummaryProgress installs progress to receive the partial summary text
+// as summarizeViaPool's streaming calls accumulate it. See WithSummaryProgress.
+func (s *thresholdStrategy) SetSummaryProgress(progress SummaryProgress) {
+	s.progress = progress
+}
+
+// SetEvictionStrategy installs eviction as compactPreserveTail's old/recent
+// split, replacing the default recency-based findSplitIndex. See
+// WithSemanticEviction.
+func (s *thresholdStrategy) SetEvictionStrategy(eviction EvictionStrategy) {
+	s.eviction = eviction
+}
+
+// SetPlanner installs planner as compactPreserveTail's sole source of the
+// old/recent/MustRetain decision, replacing the thresholdPlanner built
+// on the fly from eviction/counter. See Planner, WithPlanner.
+func (s *thresholdStrategy) SetPlanner(planner Planner) {
+	s.planner = planner
+}
+
+// SetStructuredSummary enables summarizeViaPool's structured path (see
+// summarizeStructured, SummaryDoc): the summarizer LLM is asked for JSON
+// matching SummaryDoc's schema instead of freeform Markdown, and the parsed
+// doc is persisted via persistSummaryDoc in addition to the rendered
+// Markdown string every other call site expects. See WithStructuredSummary.
+func (s *thresholdStrategy) SetStructuredSummary(enabled bool) {
+	s.structuredSummary = enabled
+}
+
+// SetSummaryDocStore routes SetStructuredSummary's persisted SummaryDoc
+// through store instead of inline session state, keeping only a short ref
+// in session state (see persistSummaryDoc, LoadSummaryDoc). Only meaningful
+// when SetStructuredSummary is also enabled. See WithSummaryDocStore.
+func (s *thresholdStrategy) SetSummaryDocStore(store SummaryDocStore) {
+	s.summaryDocStore = store
+}
+
+// SetSummarizer routes every summarize call this strategy makes (see
+// summarizeViaPool) through summarizer instead of the default single-shot
+// summarizeStreaming/SummarizationPool path. Has no effect when
+// SetStructuredSummary is also enabled, since that path requires a typed
+// JSON response no Summarizer implementation here produces. See
+// WithSummarizer.
+func (s *thresholdStrategy) SetSummarizer(summarizer Summarizer) {
+	s.summarizer = summarizer
+}
+
+// SetContinuationPromptBuilder routes the post-compaction continuation
+// message through builder instead of defaultContinuationBuilder. See
+// WithContinuationPromptBuilder.
+func (s *thresholdStrategy) SetContinuationPromptBuilder(builder ContinuationPromptBuilder) {
+	s.continuationBuilder = builder
+}
+
+// SetContinuationLocale sets the Locale field this strategy populates in
+// every ContinuationPromptData it builds. See WithContinuationLocale.
+func (s *thresholdStrategy) SetContinuationLocale(locale string) {
+	s.continuationLocale = locale
+}
+
+// SetContinuationMode overrides how this strategy resumes the conversation
+// after a compaction; see ContinuationMode. Leaving this unset (or passing
+// "") keeps the default, ContinuationModeAuto. See WithContinuationMode.
+func (s *thresholdStrategy) SetContinuationMode(mode ContinuationMode) {
+	s.continuationMode = mode
+}
+
+// resolvedContinuationMode returns s.continuationMode, defaulting unset to
+// ContinuationModeAuto and resolving Auto against contents via
+// shouldResumeAssistantTurn.
+func (s *thresholdStrategy) resolvedContinuationMode(ctx agent.CallbackContext, contents []*genai.Content) ContinuationMode {
+	mode := s.continuationMode
+	if mode == "" {
+		mode = ContinuationModeAuto
+	}
+	if mode != ContinuationModeAuto {
+		return mode
+	}
+	if shouldResumeAssistantTurn(ctx, contents) {
+		return ContinuationModeAssistantResume
+	}
+	return ContinuationModeSyntheticUser
+}
+
+// SetCompactionObserver routes every compaction pass's telemetry through
+// observer instead of running silently. See WithCompactionObserver.
+func (s *thresholdStrategy) SetCompactionObserver(observer ThresholdCompactionObserver) {
+	s.observer = observer
+}
+
+// SetTokenCounter routes compactPreserveTail's split-boundary decision
+// through counter instead of the package's fixed chars-per-token
+// heuristic. See WithTokenCounter.
+func (s *thresholdStrategy) SetTokenCounter(counter TokenCounter) {
+	s.counter = counter
+}
+
+// SetIncrementalSummary toggles incremental summarization (see
+// incrementalSummary); it defaults to true from newThresholdStrategy, so
+// this is normally only called to disable it. See WithIncrementalSummary.
+func (s *thresholdStrategy) SetIncrementalSummary(enabled bool) {
+	s.incrementalSummary = enabled
+}
+
+// SetSummaryRewriteEvery installs n as summaryRewriteEvery. See
+// WithSummaryRewriteEvery.
+func (s *thresholdStrategy) SetSummaryRewriteEvery(n int) {
+	s.summaryRewriteEvery = n
+}
+
+// shouldUseIncrementalSummary decides whether Compact's default (flat,
+// non-hierarchical, non-map-reduce) summarization branch should extend
+// existingSummary with just the delta contents rather than re-summarize
+// from scratch, and advances the incremental-run counter accordingly.
+//
+// Incremental mode requires an existing summary to extend (the first
+// compaction of a session always does a full summary) and is skipped
+// entirely when a more specialized summarization path — structured output,
+// a custom Summarizer, or a shared SummarizationPool — is configured, since
+// none of those compose with sending a partial transcript. Otherwise, it
+// applies unless summaryRewriteEvery says this is the Nth compaction since
+// the last full rewrite, in which case the counter resets and a full
+// rewrite runs instead.
+func (s *thresholdStrategy) shouldUseIncrementalSummary(ctx agent.CallbackContext, existingSummary string) bool {
+	if existingSummary == "" || !s.incrementalSummary {
+		return false
+	}
+	if s.structuredSummary || s.summarizer != nil || s.pool != nil {
+		return false
+	}
+
+	if s.summaryRewriteEvery > 0 && loadIncrementalCount(ctx)+1 >= s.summaryRewriteEvery {
+		persistIncrementalCount(ctx, 0)
+		return false
+	}
+
+	persistIncrementalCount(ctx, loadIncrementalCount(ctx)+1)
+	return true
+}
+
+// buildContinuationData assembles a ContinuationPromptData for this
+// strategy's configured locale from the pieces Compact has on hand at the
+// point it's ready to inject the continuation message.
+func (s *thresholdStrategy) buildContinuationData(ctx agent.CallbackContext, req *model.LLMRequest, userContent *genai.Content, summary string) ContinuationPromptData {
+	var systemPrompt string
+	if req.Config != nil && req.Config.SystemInstruction != nil {
+		for _, part := range req.Config.SystemInstruction.Parts {
+			if part != nil && part.Text != "" {
+				systemPrompt = part.Text
+				break
+			}
+		}
+	}
+
+	return ContinuationPromptData{
+		UserRequest:      userText(userContent),
+		Summary:          summary,
+		PendingToolCalls: pendingToolCallNames(req.Contents),
+		AgentName:        ctx.AgentName(),
+		SystemPrompt:     systemPrompt,
+		Locale:           s.continuationLocale,
+	}
+}
+
+// summarizeViaPool is the single call site every Compact code path uses in
+// place of calling summarize directly, so SetSummarizationPool applies
+// uniformly regardless of which retry/fallback branch produced this
+// summarize request.
+//
+// When SetStructuredSummary is enabled, it instead calls summarizeStructured
+// and persists the parsed SummaryDoc (when ctx carries a
+// agent.CallbackContext), returning the doc's rendered Markdown form so the
+// rest of the compaction pipeline — which only ever handles a flat string —
+// doesn't need to change. SetSummarizationPool and SetSummaryProgress have
+// no effect in this mode; see WithStructuredSummary.
+//
+// mustRetain carries a Planner's CompactionPlan.MustRetain facts, if any.
+// It only reaches the prompt on the default summarizeStreaming path: a
+// custom Summarizer or SummarizationPool builds its own prompt and isn't
+// required to honor it, and the structured-summary path has its own JSON
+// schema to extend instead.
+func (s *thresholdStrategy) summarizeViaPool(ctx context.Context, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem, mustRetain ...string) (string, error) {
+	if s.structuredSummary {
+		doc, err := summarizeStructured(ctx, s.llm, contents, previousSummary, bufferTokens, todos)
+		if err != nil {
+			return "", err
+		}
+		if cbCtx, ok := ctx.(agent.CallbackContext); ok {
+			persistSummaryDoc(cbCtx, doc, s.summaryDocStore)
+		}
+		return doc.Render(), nil
+	}
+	if s.summarizer != nil {
+		return s.summarizer.Summarize(ctx, s.llm, contents, previousSummary, bufferTokens, todos)
+	}
+	if s.pool != nil {
+		return s.pool.Summarize(ctx, s.llm, contents, previousSummary, bufferTokens, todos)
+	}
+	return summarizeStreaming(ctx, s.llm, contents, previousSummary, bufferTokens, todos, s.progress, mustRetain...)
+}
+
+// compactHierarchical produces the next SummaryTree state for contents (the
+// portion of the conversation being evicted this call): it summarizes
+// contents into a fresh Level-0 node (falling back to the map-reduce
+// hierarchicalCompact when contents alone would overflow the summarizer's
+// own context window, same as the flat path), rolls up any level that's now
+// over fanout, persists the tree, and returns its rendered form for
+// injection into req the same way a flat summary would be.
+func (s *thresholdStrategy) compactHierarchical(ctx agent.CallbackContext, contents []*genai.Content, todos []TodoItem, buffer int) (string, error) {
+	fanout := s.summaryTreeFanout
+	if fanout <= 0 {
+		fanout = defaultSummaryTreeFanout
+	}
+	targetTokens := int(float64(buffer) * 0.50)
+
+	leafBuffer := buffer
+	leafTargetTokens := targetTokens
+	if s.summaryLeafTokens > 0 {
+		leafBuffer = s.summaryLeafTokens
+		leafTargetTokens = s.summaryLeafTokens
+	}
+
+	tree := loadSummaryTree(ctx)
+
+	var nodeText string
+	var err error
+	if estimateContentTokens(contents) > defaultChunkTokenBudget*2 {
+		nodeText, err = hierarchicalCompact(ctx, s.llm, contents, "", todos,
+			defaultChunkTokenBudget, leafTargetTokens, defaultHierarchicalPoolSize)
+	} else {
+		nodeText, err = s.summarizeViaPool(ctx, contents, "", leafBuffer, todos)
+	}
+	if err != nil {
+		return "", err
+	}
+	tree.appendLevelZero(nodeText)
+
+	if err := tree.rollUp(ctx, s.llm, fanout, targetTokens, s.summaryMaxDepth); err != nil {
+		slog.Warn("ContextGuard [threshold]: summary tree roll-up failed, keeping un-rolled levels",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+	}
+
+	persistSummaryTree(ctx, tree)
+	return tree.render(), nil
+}
+
+// writeThroughSummaryStore persists summary and contentsAtCompaction to
+// s.store after a successful compaction, using the real token/heuristic
+// counters resetCalibration is about to zero in ctx.State() (a fresh
+// calibration cycle, so the snapshot carries no stale correction factor into
+// the next replica that picks up this session). A no-op when no store was
+// configured. Failures are logged, not propagated — a write-through miss
+// only degrades a future cold start back to full re-summarization, it
+// doesn't affect the compaction that just completed.
+func (s *thresholdStrategy) writeThroughSummaryStore(ctx agent.CallbackContext, summary string, contentsAtCompaction int) {
+	if s.store == nil {
+		return
+	}
+	snap := Snapshot{
+		Summary:              summary,
+		ContentsAtCompaction: contentsAtCompaction,
+	}
+	if err := s.store.Put(ctx, ctx.SessionID(), ctx.AgentName(), snap); err != nil {
+		slog.Warn("ContextGuard [threshold]: failed to write summary snapshot to store",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
 	}
 }
 
@@ -55,33 +765,239 @@ func (s *thresholdStrategy) Name() string {
 	return StrategyThreshold
 }
 
+// rawHeuristic estimates req's token count using the configured Tokenizer
+// (resolved by model name) when one was set via WithTokenizerRegistry,
+// falling back to the default len/4 heuristic otherwise. This is the
+// "current heuristic" half of the (heuristic, real) pair ratioTracker
+// learns from.
+func (s *thresholdStrategy) rawHeuristic(req *model.LLMRequest) int {
+	if s.tokenizer != nil {
+		return s.tokenCountCache.countTokens(s.tokenizer.Resolve(req.Model), req)
+	}
+	return estimateTokens(req)
+}
+
+// contextWindowFor returns the context window this strategy checks req's
+// token estimate against, honoring the maxTokens override the same way
+// Compact does. Implements streamWindowStrategy for beforeModelStream.
+func (s *thresholdStrategy) contextWindowFor(req *model.LLMRequest) int {
+	if s.maxTokens > 0 {
+		return s.maxTokens
+	}
+	return s.registry.ContextWindow(req.Model)
+}
+
+// estimateTotalTokens computes req's current token estimate using whichever
+// calibration path this strategy is configured for — the same branching
+// Compact's initial totalTokens computation uses, factored out so the
+// in-flight chain reducer's effect can be checked against threshold without
+// duplicating it.
+func (s *thresholdStrategy) estimateTotalTokens(ctx agent.CallbackContext, req *model.LLMRequest) int {
+	if s.tokenizer == nil {
+		return tokenCount(ctx, req)
+	}
+	heuristic := s.rawHeuristic(req)
+	if isExactTokenizer(s.tokenizer.Resolve(req.Model)) {
+		if real := loadRealTokens(ctx); real > heuristic {
+			return real
+		}
+		return heuristic
+	}
+	ratio := defaultHeuristicCorrectionFactor
+	if s.ratios != nil {
+		ratio = s.ratios.Ratio(ctx.AgentName())
+	}
+	calibrated := int(float64(heuristic) * ratio)
+	if real := loadRealTokens(ctx); real > calibrated {
+		calibrated = real
+	}
+	return calibrated
+}
+
+// chainProjectedToOverflow reports whether req.Contents ends in an in-flight
+// sequential tool chain whose projected next step (see
+// projectedChainNextStepTokens) would push totalTokens past threshold, so
+// Compact can trigger the chain reducer a step early instead of waiting for
+// that step to actually land. Always false unless SetMidTurnChainCompaction
+// was enabled.
+func (s *thresholdStrategy) chainProjectedToOverflow(ctx agent.CallbackContext, req *model.LLMRequest, totalTokens, threshold int) bool {
+	if !s.chain.proactive || s.chain.keepRecent <= 0 {
+		return false
+	}
+	chainStart, ok := detectToolChain(req.Contents)
+	if !ok {
+		return false
+	}
+	projected := projectedChainNextStepTokens(req.Contents, chainStart)
+	if totalTokens+projected < threshold {
+		return false
+	}
+	slog.Info("ContextGuard [threshold]: proactive mid-turn compaction triggered",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"tokens", totalTokens,
+		"projectedNextStep", projected,
+		"threshold", threshold,
+	)
+	return true
+}
+
+// computeBuffer is computeBuffer, honoring s.opts.BufferFraction as an
+// override of smallContextWindowRatio when set.
+func (s *thresholdStrategy) computeBuffer(contextWindow int) int {
+	if s.opts.BufferFraction <= 0 {
+		return computeBuffer(contextWindow)
+	}
+	if contextWindow >= largeContextWindowThreshold {
+		return largeContextWindowBuffer
+	}
+	return int(float64(contextWindow) * s.opts.BufferFraction)
+}
+
 // Compact checks the token estimate against the model's context window and,
 // if the threshold is exceeded, summarizes the entire conversation and
 // rewrites req.Contents to [summary] + [continuation instruction].
 //
 // Token source priority: calibrated heuristic > stale real tokens > raw heuristic.
 func (s *thresholdStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	if handled, err := s.resumeIfPending(ctx, req); handled {
+		return err
+	}
+
 	var contextWindow int
 	if s.maxTokens > 0 {
 		contextWindow = s.maxTokens
 	} else {
 		contextWindow = s.registry.ContextWindow(req.Model)
 	}
-	buffer := computeBuffer(contextWindow)
+	buffer := s.computeBuffer(contextWindow)
 	threshold := contextWindow - buffer
 
+	if s.overflow != nil {
+		resolveOverflowPlaceholders(s.overflow, req.Contents)
+	}
+
+	if s.reduceResponses {
+		if n := reduceToolResponses(req.Contents, defaultToolReducerRecentKeep); n > 0 {
+			slog.Info("ContextGuard [threshold]: reduced historical tool responses",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"responsesReduced", n,
+			)
+		}
+	}
+
+	if s.dedup {
+		if n := dedupToolResponses(ctx, req.Contents, s.dedupNormalizer); n > 0 {
+			slog.Info("ContextGuard [threshold]: deduplicated repeated tool responses",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"responsesDeduped", n,
+			)
+		}
+	}
+
+	if s.oversizedContent {
+		n, err := summarizeOversizedParts(ctx, s.llm, req.Contents, loadTodos(ctx), contextWindow, s.oversizedContentFraction)
+		if err != nil {
+			slog.Error("ContextGuard [threshold]: oversized content summarization FAILED, continuing with raw payload",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"error", err,
+			)
+		} else if n > 0 {
+			slog.Info("ContextGuard [threshold]: summarized oversized tool response payloads",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"partsSummarized", n,
+			)
+		}
+	}
+
+	if s.patternCompressor != nil {
+		if boundary := safeSplitIndex(req.Contents, len(req.Contents)-defaultPatternRecentKeep); boundary > 0 {
+			if compressed, n := s.patternCompressor.compress(req.Contents, boundary); n > 0 {
+				req.Contents = compressed
+				slog.Info("ContextGuard [threshold]: compressed repetitive tool-result clusters",
+					"agent", ctx.AgentName(),
+					"session", ctx.SessionID(),
+					"clustersCompressed", n,
+				)
+			}
+		}
+	}
+
 	existingSummary := loadSummary(ctx)
 	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if existingSummary == "" && s.store != nil {
+		if snap, err := s.store.Get(ctx, ctx.SessionID(), ctx.AgentName()); err == nil {
+			existingSummary = snap.Summary
+			contentsAtLastCompaction = snap.ContentsAtCompaction
+			persistSummary(ctx, snap.Summary, 0)
+			persistContentsAtCompaction(ctx, snap.ContentsAtCompaction)
+			persistRealTokens(ctx, snap.RealTokens)
+			persistLastHeuristic(ctx, snap.LastHeuristic)
+		} else if !errors.Is(err, ErrSnapshotNotFound) {
+			slog.Warn("ContextGuard [threshold]: summary store cold-start lookup failed",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"error", err,
+			)
+		}
+	}
 	totalSessionContents := len(req.Contents)
 	if existingSummary != "" {
 		injectSummary(req, existingSummary, contentsAtLastCompaction)
 	}
 
-	totalTokens := tokenCount(ctx, req)
+	heuristic := s.rawHeuristic(req)
+	persistLastHeuristic(ctx, heuristic)
+	persistLastModel(ctx, req.Model)
+	if s.pending != nil {
+		s.pending.Record(ctx.InvocationID(), ctx.AgentName(), heuristic)
+	}
+
+	if s.hints != nil {
+		if evicted, _ := applyCompactionHints(req.Contents, s.hints, false); evicted > 0 {
+			slog.Info("ContextGuard [threshold]: forced eviction of must-summarize hints",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"evicted", evicted,
+			)
+		}
+	}
+
+	totalTokens := s.estimateTotalTokens(ctx, req)
 	if totalTokens < threshold {
-		return nil
+		if !s.chainProjectedToOverflow(ctx, req, totalTokens, threshold) {
+			return nil
+		}
+	}
+
+	if s.overflow != nil {
+		if s.applyOverflowLimiter(ctx, s.llm, req.Contents) > 0 {
+			totalTokens = s.estimateTotalTokens(ctx, req)
+			if totalTokens < threshold {
+				return nil
+			}
+		}
 	}
 
+	if s.chain.keepRecent > 0 {
+		if chainStart, ok := detectToolChain(req.Contents); ok && reduceToolChain(req.Contents, chainStart, s.chain) {
+			slog.Info("ContextGuard [threshold]: reduced in-flight tool chain",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"chainStart", chainStart,
+			)
+			totalTokens = s.estimateTotalTokens(ctx, req)
+			if totalTokens < threshold {
+				return nil
+			}
+		}
+	}
+
+	budget := EstimateTokenBudget(req)
 	slog.Info("ContextGuard [threshold]: threshold exceeded, summarizing",
 		"agent", ctx.AgentName(),
 		"session", ctx.SessionID(),
@@ -90,35 +1006,176 @@ func (s *thresholdStrategy) Compact(ctx agent.CallbackContext, req *model.LLMReq
 		"contextWindow", contextWindow,
 		"buffer", buffer,
 		"maxSummaryWords", int(float64(buffer)*0.50*0.75),
+		"contentTokens", budget.ContentTokens,
+		"systemInstructionTokens", budget.SystemInstructionTokens,
+		"toolTokens", budget.ToolTokens,
+		"inlineDataTokens", budget.InlineDataTokens,
 	)
 
+	if s.observer != nil {
+		s.observer.OnCompactionStart(ctx, CompactionStartEvent{
+			Model:         req.Model,
+			PreTokens:     totalTokens,
+			Threshold:     threshold,
+			RetentionMode: s.opts.RetentionMode,
+		})
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	userContent := ctx.UserContent()
 	todos := loadTodos(ctx)
 
+	var hintsPreservedTail []*genai.Content
+	if s.hints != nil {
+		var evicted int
+		evicted, hintsPreservedTail = applyCompactionHints(req.Contents, s.hints, true)
+		if evicted > 0 {
+			slog.Info("ContextGuard [threshold]: evicted evict-first hints before summarizing",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"evicted", evicted,
+			)
+		}
+	}
+
+	if s.opts.RetentionMode == PreserveTail {
+		return s.compactPreserveTail(ctx, req, contextWindow, buffer, threshold, totalTokens, totalSessionContents, existingSummary, hintsPreservedTail)
+	}
+
+	resumeAssistant := s.resolvedContinuationMode(ctx, req.Contents) == ContinuationModeAssistantResume
+	if resumeAssistant && s.continuationMode != ContinuationModeAssistantResume &&
+		loadLastFinishReason(ctx) != FinishReasonLength && len(trailingToolState(req.Contents)) > 0 {
+		// Under Auto, an unanswered tool call goes through the tool-state
+		// path below (re-appended after the continuation message) instead of
+		// being resumed in place; only a length-truncated turn is resumed.
+		resumeAssistant = false
+	}
 	contentsForSummary := truncateForSummarizer(req.Contents, contextWindow)
 
-	summary, err := summarize(ctx, s.llm, contentsForSummary, existingSummary, buffer, todos)
+	var toolStateTail []*genai.Content
+	if resumeAssistant {
+		// The trailing turn is being resumed verbatim, not summarized, so
+		// pull it out of what gets sent to the summarizer and carry it
+		// through replaceSummary via hintsPreservedTail instead.
+		last := req.Contents[len(req.Contents)-1]
+		if n := len(contentsForSummary); n > 0 && contentsForSummary[n-1] == last {
+			contentsForSummary = contentsForSummary[:n-1]
+		}
+		hintsPreservedTail = append(hintsPreservedTail, last)
+	} else if toolStateTail = trailingToolState(req.Contents); len(toolStateTail) > 0 {
+		// Unlike resumeAssistant, this state isn't kept in place — it's
+		// re-appended verbatim after the continuation message below, so the
+		// summary still reads as the most recent prose context and the
+		// intact tool-call/tool-response pairing follows it.
+		if n := len(contentsForSummary); n >= len(toolStateTail) {
+			contentsForSummary = contentsForSummary[:n-len(toolStateTail)]
+		}
+	}
+
+	contentsForSummary, pinned := splitNoCompactMarked(ctx, contentsForSummary)
+	if len(pinned) > 0 {
+		hintsPreservedTail = append(append([]*genai.Content(nil), hintsPreservedTail...), pinned...)
+	}
+
+	summarizeStart := time.Now()
+	var summary string
+	var err error
+	switch {
+	case s.hierarchical:
+		summary, err = s.compactHierarchical(ctx, contentsForSummary, todos, buffer)
+	case estimateContentTokens(contentsForSummary) > defaultChunkTokenBudget*2:
+		// A single summarizer call over this much content risks overflowing
+		// the summarizer's own context window (e.g. a burst of large tool
+		// responses in one turn) — fall back to map-reduce instead of
+		// trusting one call to fit it all.
+		summary, err = hierarchicalCompact(ctx, s.llm, contentsForSummary, existingSummary, todos,
+			defaultChunkTokenBudget, int(float64(buffer)*0.50), defaultHierarchicalPoolSize)
+	case s.shouldUseIncrementalSummary(ctx, existingSummary):
+		summary, err = summarizeIncremental(ctx, s.llm, stripSummaryInjectionStub(contentsForSummary), existingSummary, buffer, todos, s.progress)
+	default:
+		summary, err = s.summarizeViaPool(ctx, contentsForSummary, existingSummary, buffer, todos)
+	}
+	fellBack := false
 	if err != nil {
+		if isContextInterruption(err) {
+			// Unlike compactPreserveTail, there's no checkpoint here: under
+			// FullSummary, contentsForSummary may already be a
+			// truncateForSummarizer-trimmed suffix of req.Contents rather
+			// than a stable leading range, so "resume from this split" isn't
+			// a safe thing to persist. The interruption is still classified
+			// and surfaced via ErrCompactionInterrupted; the next call just
+			// re-summarizes from scratch, same as before this existed.
+			slog.Warn("ContextGuard [threshold]: summarization interrupted",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"error", err,
+			)
+			return newInterruptedError(err)
+		}
 		slog.Warn("ContextGuard [threshold]: summarization failed, using fallback",
 			"agent", ctx.AgentName(),
 			"session", ctx.SessionID(),
 			"error", err,
 		)
 		summary = buildFallbackSummary(contentsForSummary, existingSummary)
+		fellBack = true
+	}
+	if s.observer != nil {
+		s.observer.OnSummaryProduced(ctx, SummaryProducedEvent{
+			Model:         s.llm.Name(),
+			SummaryLength: len(summary),
+			TurnsDropped:  len(contentsForSummary),
+			Elapsed:       time.Since(summarizeStart),
+			Fallback:      fellBack,
+			PinnedSkipped: len(pinned),
+		})
 	}
 
 	persistSummary(ctx, summary, totalTokens)
 	persistContentsAtCompaction(ctx, totalSessionContents)
-	replaceSummary(req, summary, nil)
-	injectContinuation(req, userContent)
+	s.writeThroughSummaryStore(ctx, summary, totalSessionContents)
+	replaceSummary(req, summary, hintsPreservedTail)
+	if resumeAssistant {
+		slog.Info("ContextGuard [threshold]: resuming truncated assistant turn verbatim instead of injecting a continuation message",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+		)
+	} else {
+		data := s.buildContinuationData(ctx, req, userContent, summary)
+		if len(toolStateTail) > 0 {
+			data.PendingToolCalls = pendingToolCallNames(toolStateTail)
+		}
+		injectContinuationWithBuilder(req, data, s.continuationBuilder)
+		if len(toolStateTail) > 0 {
+			req.Contents = append(req.Contents, toolStateTail...)
+			slog.Info("ContextGuard [threshold]: preserved pending tool-call state after the continuation message",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"entries", len(toolStateTail),
+			)
+		}
+	}
 
 	resetCalibration(ctx)
 
 	newTokens := estimateTokens(req)
 
+	if s.observer != nil {
+		mode := ContinuationModeSyntheticUser
+		if resumeAssistant {
+			mode = ContinuationModeAssistantResume
+		}
+		s.observer.OnContinuationInjected(ctx, ContinuationInjectedEvent{
+			Mode:                      mode,
+			UserRequestRecovered:      userText(userContent) != "",
+			PendingToolCallsPreserved: len(toolStateTail),
+			PreTokens:                 totalTokens,
+			PostTokens:                newTokens,
+		})
+	}
+
 	slog.Info("ContextGuard [threshold]: compaction completed",
 		"agent", ctx.AgentName(),
 		"session", ctx.SessionID(),
@@ -129,3 +1186,276 @@ func (s *thresholdStrategy) Compact(ctx agent.CallbackContext, req *model.LLMReq
 
 	return nil
 }
+
+// detectCompactionStall compares an attempt's post-summarization token
+// estimate against the previous attempt's, returning the StallReason and
+// true if the retry loop is no longer making useful progress: either the
+// new estimate is no smaller than the previous one (StallRegressed), or it
+// reduced tokens by less than convergedFloorReduction (StallConverged).
+func detectCompactionStall(prevTokens, newTokens int) (StallReason, bool) {
+	if newTokens >= prevTokens {
+		return StallRegressed, true
+	}
+	if prevTokens <= 0 {
+		return "", false
+	}
+	reduction := 1 - float64(newTokens)/float64(prevTokens)
+	if reduction < convergedFloorReduction {
+		return StallConverged, true
+	}
+	return "", false
+}
+
+// compactPreserveTail implements ThresholdOptions{RetentionMode: PreserveTail}:
+// instead of summarizing the entire conversation, it keeps a RecentWindowRatio-
+// sized tail verbatim and summarizes only the older portion (found via
+// findSplitIndex). If the result still exceeds threshold, it retries with the
+// tail halved, up to MaxCompactionAttempts times, matching Crush CLI's
+// shrink-on-retry behavior for constrained context windows. Called by Compact
+// once s.opts.RetentionMode == PreserveTail has been checked.
+func (s *thresholdStrategy) compactPreserveTail(ctx agent.CallbackContext, req *model.LLMRequest, contextWindow, buffer, threshold, totalTokens, totalSessionContents int, existingSummary string, hintsPreservedTail []*genai.Content) error {
+	ratio := s.opts.RecentWindowRatio
+	if ratio <= 0 {
+		ratio = recentWindowRatio
+	}
+	maxAttempts := s.opts.MaxCompactionAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = maxCompactionAttempts
+	}
+
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+
+	var summary string
+	var recent []*genai.Content
+	var newTokens int
+	var tokensAfter []int
+	var stallEvent *CompactionStallEvent
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		recentBudget := int(float64(contextWindow) * ratio)
+		planner := s.planner
+		if planner == nil {
+			planner = &thresholdPlanner{eviction: s.eviction, counter: s.counter}
+		}
+		plan, planErr := planner.Plan(ctx, req, recentBudget, todos)
+		if planErr != nil {
+			slog.Warn("ContextGuard [threshold]: planner failed, falling back to the default recency split",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"error", planErr,
+			)
+			plan, _ = (&thresholdPlanner{eviction: s.eviction, counter: s.counter}).Plan(ctx, req, recentBudget, todos)
+		}
+		old, pinned := splitNoCompactMarked(ctx, plan.Old)
+		recent = plan.Recent
+		mustRetain := plan.MustRetain
+		preservedTail := hintsPreservedTail
+		if len(pinned) > 0 {
+			preservedTail = append(append([]*genai.Content(nil), hintsPreservedTail...), pinned...)
+		}
+
+		summarizeStart := time.Now()
+		var err error
+		if estimateContentTokens(old) > defaultChunkTokenBudget*2 {
+			summary, err = hierarchicalCompact(ctx, s.llm, old, existingSummary, todos,
+				defaultChunkTokenBudget, int(float64(buffer)*0.50), defaultHierarchicalPoolSize)
+		} else {
+			summary, err = s.summarizeViaPool(ctx, old, existingSummary, buffer, todos, mustRetain...)
+		}
+		fellBack := false
+		if err != nil {
+			if isContextInterruption(err) {
+				persistCompactionCheckpoint(ctx, CompactionCheckpoint{ContentsPlanned: len(old)})
+				slog.Warn("ContextGuard [threshold]: preserve-tail summarization interrupted, checkpointed for resume",
+					"agent", ctx.AgentName(),
+					"session", ctx.SessionID(),
+					"contentsPlanned", len(old),
+					"error", err,
+				)
+				return newInterruptedError(err)
+			}
+			slog.Warn("ContextGuard [threshold]: preserve-tail summarization failed, using fallback",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+				"error", err,
+			)
+			summary = buildFallbackSummary(old, existingSummary)
+			fellBack = true
+		}
+		if s.observer != nil {
+			s.observer.OnSummaryProduced(ctx, SummaryProducedEvent{
+				Model:         s.llm.Name(),
+				SummaryLength: len(summary),
+				TurnsDropped:  len(old),
+				Elapsed:       time.Since(summarizeStart),
+				Fallback:      fellBack,
+				PinnedSkipped: len(pinned),
+			})
+		}
+
+		merged := mergePreservedTail(preservedTail, recent)
+		replaceSummary(req, summary, merged)
+		resumeAssistant := s.resolvedContinuationMode(ctx, req.Contents) == ContinuationModeAssistantResume
+		if resumeAssistant {
+			slog.Info("ContextGuard [threshold]: resuming truncated assistant turn verbatim instead of injecting a continuation message",
+				"agent", ctx.AgentName(),
+				"session", ctx.SessionID(),
+			)
+		} else {
+			injectContinuationWithBuilder(req, s.buildContinuationData(ctx, req, userContent, summary), s.continuationBuilder)
+		}
+
+		newTokens = estimateTokens(req)
+		tokensAfter = append(tokensAfter, newTokens)
+
+		if s.observer != nil {
+			mode := ContinuationModeSyntheticUser
+			if resumeAssistant {
+				mode = ContinuationModeAssistantResume
+			}
+			s.observer.OnContinuationInjected(ctx, ContinuationInjectedEvent{
+				Mode:                 mode,
+				UserRequestRecovered: userText(userContent) != "",
+				PreTokens:            totalTokens,
+				PostTokens:           newTokens,
+			})
+		}
+
+		if newTokens < threshold {
+			break
+		}
+
+		if attempt > 0 {
+			prevTokens := tokensAfter[attempt-1]
+			reason, detected := detectCompactionStall(prevTokens, newTokens)
+			if detected {
+				stallEvent = &CompactionStallEvent{
+					Agent:       ctx.AgentName(),
+					Reason:      reason,
+					Attempt:     attempt,
+					TokensAfter: append([]int(nil), tokensAfter...),
+					Old:         old,
+					Recent:      recent,
+					Summary:     summary,
+				}
+				break
+			}
+		}
+
+		if attempt == maxAttempts-1 {
+			break
+		}
+		ratio /= 2
+	}
+
+	persistCompactionTrace(ctx, tokensAfter)
+
+	if stallEvent != nil {
+		slog.Warn("ContextGuard [threshold]: preserve-tail compaction stalled",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"reason", stallEvent.Reason,
+			"attempt", stallEvent.Attempt,
+			"tokensAfter", stallEvent.TokensAfter,
+		)
+		if s.stallHandler != nil {
+			replacement, err := s.stallHandler(*stallEvent)
+			if err != nil {
+				return fmt.Errorf("contextguard: compaction stalled (%s): %w", stallEvent.Reason, err)
+			}
+			if replacement != nil {
+				req.Contents = replacement
+				newTokens = estimateTokens(req)
+			}
+		}
+	}
+
+	persistSummary(ctx, summary, totalTokens)
+	persistContentsAtCompaction(ctx, totalSessionContents)
+	s.writeThroughSummaryStore(ctx, summary, totalSessionContents)
+	resetCalibration(ctx)
+
+	slog.Info("ContextGuard [threshold]: preserve-tail compaction completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"preservedTail", len(recent),
+		"newTokenEstimate", newTokens,
+		"threshold", threshold,
+	)
+
+	return nil
+}
+
+// defaultCompactNowRecentKeep is the minimum number of trailing Content
+// entries CompactNow refuses to compact away, regardless of the upTo the
+// caller asked for.
+const defaultCompactNowRecentKeep = 3
+
+// ErrCompactNowTooAggressive is returned by CompactNow when upTo would
+// leave fewer than defaultCompactNowRecentKeep messages after the split.
+var ErrCompactNowTooAggressive = errors.New("contextguard: upTo would leave too few recent messages")
+
+// CompactNow forces a compaction pass up to upTo (an index into
+// req.Contents), independent of the threshold trigger Compact would
+// otherwise use — the analogue of etcd's explicit Compact(rev) RPC sitting
+// next to auto-compaction. Useful when the calling agent knows a
+// task/subplan just finished and wants to collapse everything before that
+// boundary, or when a UI exposes a "compact now" button.
+//
+// CompactNow no-ops if upTo is at or before the watermark left by the last
+// compaction (nothing new to fold in), and returns
+// ErrCompactNowTooAggressive without touching req if upTo would leave
+// fewer than defaultCompactNowRecentKeep trailing messages.
+func (s *thresholdStrategy) CompactNow(ctx agent.CallbackContext, req *model.LLMRequest, upTo int) error {
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+	if upTo <= contentsAtLastCompaction {
+		return nil
+	}
+	if len(req.Contents)-upTo < defaultCompactNowRecentKeep {
+		return ErrCompactNowTooAggressive
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existingSummary := loadSummary(ctx)
+	buffer := computeBuffer(s.registry.ContextWindow(req.Model))
+	todos := loadTodos(ctx)
+
+	splitIdx := safeSplitIndex(req.Contents, upTo)
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+
+	if len(oldContents) == 0 {
+		return nil
+	}
+
+	summary, err := summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+	if err != nil {
+		slog.Error("ContextGuard [threshold]: CompactNow summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	tokenEstimate := estimateContentTokens(oldContents)
+	persistSummary(ctx, summary, tokenEstimate)
+	persistContentsAtCompaction(ctx, splitIdx)
+
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, ctx.UserContent())
+
+	slog.Info("ContextGuard [threshold]: CompactNow forced a compaction pass",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"upTo", upTo,
+		"splitIdx", splitIdx,
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+	)
+
+	return nil
+}
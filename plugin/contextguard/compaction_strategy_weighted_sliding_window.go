@@ -0,0 +1,192 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultWeightedWindowFraction is the default fraction of the model's
+// context window at which effectiveTokens triggers summarization, used
+// when newWeightedSlidingWindowStrategy is given fraction <= 0.
+const defaultWeightedWindowFraction = 0.75
+
+// defaultWeightedRecentKeep is the recent-turn floor used when
+// newWeightedSlidingWindowStrategy is given recentKeep <= 0.
+const defaultWeightedRecentKeep = 3
+
+// weightedSlidingWindowStrategy implements a smoothed alternative to
+// slidingWindowStrategy's hard turn-count cutoff, borrowing the "previous
+// window * weight + current window" idea from sliding-window rate
+// limiters: effectiveTokens = prevWindowTokens*weight + currWindowTokens,
+// where weight is the fraction of windowDuration still remaining since the
+// last compaction (or window rollover). This smooths compaction across
+// window boundaries — a session that just rolled into a new window doesn't
+// immediately re-summarize on the strength of the old window alone, while
+// one carrying heavy state is compacted earlier than a strict turn-count
+// check would allow.
+type weightedSlidingWindowStrategy struct {
+	registry       ModelRegistry
+	llm            model.LLM
+	windowDuration time.Duration
+	fraction       float64
+	recentKeep     int
+	mu             sync.Mutex
+}
+
+// newWeightedSlidingWindowStrategy creates a weighted-sliding-window
+// strategy for a single agent. fraction <= 0 defaults to
+// defaultWeightedWindowFraction; recentKeep <= 0 defaults to
+// defaultWeightedRecentKeep.
+func newWeightedSlidingWindowStrategy(registry ModelRegistry, llm model.LLM, windowDuration time.Duration, fraction float64, recentKeep int) *weightedSlidingWindowStrategy {
+	if fraction <= 0 {
+		fraction = defaultWeightedWindowFraction
+	}
+	if recentKeep <= 0 {
+		recentKeep = defaultWeightedRecentKeep
+	}
+	return &weightedSlidingWindowStrategy{
+		registry:       registry,
+		llm:            llm,
+		windowDuration: windowDuration,
+		fraction:       fraction,
+		recentKeep:     recentKeep,
+	}
+}
+
+// Name returns the strategy identifier for logging.
+func (s *weightedSlidingWindowStrategy) Name() string {
+	return StrategyWeightedSlidingWindow
+}
+
+// Compact computes effectiveTokens from the weighted blend of the previous
+// and current window's token counts and summarizes once it exceeds
+// fraction of the model's context window. Window boundaries roll over
+// (prevWindowTokens := currWindowTokens, currWindowTokens reset) whenever
+// windowDuration has elapsed since the last rollover, independent of
+// whether a compaction fired.
+func (s *weightedSlidingWindowStrategy) Compact(ctx agent.CallbackContext, req *model.LLMRequest) error {
+	existingSummary := loadSummary(ctx)
+	contentsAtLastCompaction := loadContentsAtCompaction(ctx)
+
+	last, hasLast := loadLastCompactionTime(ctx)
+	if !hasLast {
+		persistLastCompactionTime(ctx, time.Now())
+		persistCurrWindowTokens(ctx, estimateTokens(req))
+		if existingSummary != "" {
+			injectSummary(req, existingSummary, contentsAtLastCompaction)
+		}
+		return nil
+	}
+
+	elapsed := time.Since(last)
+	prevTokens := loadPrevWindowTokens(ctx)
+	currTokens := loadCurrWindowTokens(ctx)
+
+	if elapsed >= s.windowDuration {
+		prevTokens = currTokens
+		currTokens = 0
+		last = time.Now()
+		elapsed = 0
+		persistLastCompactionTime(ctx, last)
+		persistPrevWindowTokens(ctx, prevTokens)
+	}
+
+	currTokens = estimateTokens(req)
+	persistCurrWindowTokens(ctx, currTokens)
+
+	remaining := s.windowDuration - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	weight := float64(remaining) / float64(s.windowDuration)
+	effectiveTokens := int(float64(prevTokens)*weight) + currTokens
+
+	contextWindow := s.registry.ContextWindow(req.Model)
+	threshold := int(s.fraction * float64(contextWindow))
+
+	if effectiveTokens <= threshold {
+		if existingSummary != "" {
+			injectSummary(req, existingSummary, contentsAtLastCompaction)
+		}
+		return nil
+	}
+
+	slog.Info("ContextGuard [weighted_sliding_window]: effective tokens exceeded threshold, summarizing",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"prevWindowTokens", prevTokens,
+		"currWindowTokens", currTokens,
+		"weight", weight,
+		"effectiveTokens", effectiveTokens,
+		"threshold", threshold,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffer := computeBuffer(contextWindow)
+	userContent := ctx.UserContent()
+	todos := loadTodos(ctx)
+
+	splitIdx := safeSplitIndex(req.Contents, len(req.Contents)-s.recentKeep)
+	oldContents := req.Contents[:splitIdx]
+	recentContents := req.Contents[splitIdx:]
+
+	if len(oldContents) == 0 {
+		slog.Warn("ContextGuard [weighted_sliding_window]: nothing to compact (split at 0), aborting",
+			"agent", ctx.AgentName(),
+		)
+		return nil
+	}
+
+	summary, err := summarize(ctx, s.llm, oldContents, existingSummary, buffer, todos)
+	if err != nil {
+		slog.Error("ContextGuard [weighted_sliding_window]: summarization FAILED",
+			"agent", ctx.AgentName(),
+			"session", ctx.SessionID(),
+			"error", err,
+		)
+		return fmt.Errorf("summarization failed: %w", err)
+	}
+
+	tokenEstimate := estimateContentTokens(oldContents)
+	persistSummary(ctx, summary, tokenEstimate)
+	persistContentsAtCompaction(ctx, len(req.Contents))
+	persistLastCompactionTime(ctx, time.Now())
+	persistPrevWindowTokens(ctx, tokenEstimate)
+
+	replaceSummary(req, summary, recentContents)
+	injectContinuation(req, userContent)
+
+	newTokens := estimateTokens(req)
+	persistCurrWindowTokens(ctx, newTokens)
+
+	slog.Info("ContextGuard [weighted_sliding_window]: compaction pass completed",
+		"agent", ctx.AgentName(),
+		"session", ctx.SessionID(),
+		"oldMessages", len(oldContents),
+		"recentMessages", len(recentContents),
+		"newTokenEstimate", newTokens,
+	)
+
+	return nil
+}
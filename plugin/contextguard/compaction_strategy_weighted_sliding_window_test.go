@@ -0,0 +1,139 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+)
+
+func TestWeightedSlidingWindowStrategy_FirstCallEstablishesBaselineWithoutCompacting(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newWeightedSlidingWindowStrategy(registry, llm, time.Hour, 0, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary on the first call")
+	}
+}
+
+func TestWeightedSlidingWindowStrategy_DoesNotCompactBelowThreshold(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 1_000_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newWeightedSlidingWindowStrategy(registry, llm, time.Hour, 0.75, 0)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now())
+	persistPrevWindowTokens(ctx, 0)
+
+	contents := kubeAgentConversation(5)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) != "" {
+		t.Error("expected no summary when effectiveTokens is well under threshold")
+	}
+}
+
+func TestWeightedSlidingWindowStrategy_CompactsWhenEffectiveTokensExceedThreshold(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 2_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: heavy session compacted."}
+	s := newWeightedSlidingWindowStrategy(registry, llm, time.Hour, 0.5, 0)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now())
+	persistPrevWindowTokens(ctx, 5000)
+
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if loadSummary(ctx) == "" {
+		t.Error("expected a summary once effectiveTokens exceeded the fraction-of-context-window threshold")
+	}
+}
+
+func TestWeightedSlidingWindowStrategy_WindowRolloverDecaysPreviousWeight(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"gpt-4o": 2_000},
+		maxTokens:      map[string]int{"gpt-4o": 4096},
+	}
+	llm := &mockLLM{name: "gpt-4o", response: "Summary: ..."}
+	s := newWeightedSlidingWindowStrategy(registry, llm, time.Millisecond, 0.99, 0)
+	ctx := newMockCallbackContext("agent1")
+	persistLastCompactionTime(ctx, time.Now().Add(-time.Hour))
+	persistPrevWindowTokens(ctx, 100_000)
+	persistCurrWindowTokens(ctx, 0)
+
+	contents := kubeAgentConversation(2)
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: copyContents(contents)}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	if got := loadPrevWindowTokens(ctx); got == 100_000 {
+		t.Error("expected the huge stale prevWindowTokens to be replaced by the rolled-over currWindowTokens, not persist unchanged")
+	}
+}
+
+func TestNewWeightedSlidingWindowStrategy_DefaultsFractionAndRecentKeep(t *testing.T) {
+	s := newWeightedSlidingWindowStrategy(newMockRegistry(), &mockLLM{name: "gpt-4o"}, time.Hour, 0, 0)
+	if s.fraction != defaultWeightedWindowFraction {
+		t.Errorf("fraction = %v, want default %v", s.fraction, defaultWeightedWindowFraction)
+	}
+	if s.recentKeep != defaultWeightedRecentKeep {
+		t.Errorf("recentKeep = %d, want default %d", s.recentKeep, defaultWeightedRecentKeep)
+	}
+}
+
+func TestAdd_WithWeightedSlidingWindow(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithWeightedSlidingWindow(30*time.Minute, 0.6, 5))
+
+	s, ok := guard.strategies["agent1"].(*weightedSlidingWindowStrategy)
+	if !ok {
+		t.Fatalf("expected *weightedSlidingWindowStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.Name() != StrategyWeightedSlidingWindow {
+		t.Errorf("strategy = %q, want %q", s.Name(), StrategyWeightedSlidingWindow)
+	}
+	if s.windowDuration != 30*time.Minute {
+		t.Errorf("windowDuration = %v, want 30m", s.windowDuration)
+	}
+	if s.fraction != 0.6 {
+		t.Errorf("fraction = %v, want 0.6", s.fraction)
+	}
+	if s.recentKeep != 5 {
+		t.Errorf("recentKeep = %d, want 5", s.recentKeep)
+	}
+}
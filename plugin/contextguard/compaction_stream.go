@@ -0,0 +1,122 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultStreamExpansionFactor and defaultStreamSafetyMargin tune
+// StreamGuard's running projection of a streaming response's final token
+// cost. expansionFactor compensates for estimateTokens's len/4 heuristic
+// undercounting relative to a real provider tokenizer; safetyMargin leaves
+// headroom so the soft-stop fires before, not at, the context window limit.
+const (
+	defaultStreamExpansionFactor = 1.3
+	defaultStreamSafetyMargin    = 0.95
+)
+
+// StreamProgress is invoked by StreamGuard.Observe with the most recently
+// streamed chunk and the updated projected final token count, so a caller
+// can log or export streaming progress without having to recompute it.
+type StreamProgress func(chunk string, predictedFinalTokens int)
+
+// StreamGuard tracks a single in-flight streaming LLM response and decides
+// when accumulated output risks pushing the turn over its context window.
+// Unlike beforeModel, which only sees real usage metadata at end-of-stream,
+// StreamGuard lets a caller react while the response is still being
+// generated. Create one via contextGuard.beforeModelStream.
+type StreamGuard struct {
+	contextWindow   int
+	promptTokens    int
+	expansionFactor float64
+	safetyMargin    float64
+	onProgress      StreamProgress
+
+	streamedChars int
+}
+
+// Observe records a newly streamed chunk and returns true once the
+// projected final token count (prompt tokens + streamed-so-far ×
+// expansionFactor) crosses contextWindow × safetyMargin. A true result is a
+// soft-stop signal: the caller should cancel the generation context so the
+// model finishes its current sentence rather than being truncated
+// mid-token by the provider.
+func (g *StreamGuard) Observe(chunk string) bool {
+	g.streamedChars += len(chunk)
+	predicted := g.PredictedFinalTokens()
+
+	if g.onProgress != nil {
+		g.onProgress(chunk, predicted)
+	}
+
+	return float64(predicted) > float64(g.contextWindow)*g.safetyMargin
+}
+
+// PredictedFinalTokens returns the current projected final token count.
+func (g *StreamGuard) PredictedFinalTokens() int {
+	streamedTokens := g.streamedChars / 4
+	return g.promptTokens + int(float64(streamedTokens)*g.expansionFactor)
+}
+
+// streamWindowStrategy is implemented by strategies that have a concrete
+// context window to project a streaming response against: thresholdStrategy,
+// escalatingStrategy, hardTruncateStrategy and PatternCompactor. The
+// sliding-window and summarization strategies trigger on turn count or a
+// different high-water mark, not a context window, so beforeModelStream has
+// nothing to project for them.
+type streamWindowStrategy interface {
+	contextWindowFor(req *model.LLMRequest) int
+}
+
+// beforeModelStream runs the same pre-call compaction check as beforeModel,
+// then returns a StreamGuard the caller feeds streamed chunks into via
+// Observe as they arrive. Returns a nil StreamGuard (with no error) if the
+// agent is unregistered or its strategy has no context window concept to
+// project against.
+func (g *contextGuard) beforeModelStream(ctx agent.CallbackContext, req *model.LLMRequest, onProgress StreamProgress) (*StreamGuard, error) {
+	strategy, ok := g.strategies[ctx.AgentName()]
+	if !ok {
+		return nil, nil
+	}
+
+	if err := g.safeCompact(ctx, strategy, req); err != nil {
+		slog.Warn("ContextGuard: compaction failed, passing through",
+			"agent", ctx.AgentName(),
+			"strategy", strategy.Name(),
+			"error", err,
+		)
+	}
+
+	sw, ok := strategy.(streamWindowStrategy)
+	if !ok {
+		return nil, nil
+	}
+	contextWindow := sw.contextWindowFor(req)
+	if contextWindow <= 0 {
+		return nil, nil
+	}
+
+	return &StreamGuard{
+		contextWindow:   contextWindow,
+		promptTokens:    tokenCount(ctx, req),
+		expansionFactor: defaultStreamExpansionFactor,
+		safetyMargin:    defaultStreamSafetyMargin,
+		onProgress:      onProgress,
+	}, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"math/rand"
+	"time"
+)
+
+// CompactionPolicy is a hook-requested override of simulateSession's normal
+// compaction decision for the current step, returned by SimHook.PreCompaction.
+type CompactionPolicy int
+
+const (
+	// CompactionPolicyDefault lets simulateSession decide whether to compact,
+	// as if no hook had an opinion.
+	CompactionPolicyDefault CompactionPolicy = iota
+	// CompactionPolicyForce makes simulateSession compact on this step
+	// regardless of the estimated token count, to exercise worst-case
+	// compaction boundaries (e.g. "compact at turn N").
+	CompactionPolicyForce
+	// CompactionPolicySkip makes simulateSession skip the BeforeModelCallback
+	// entirely on this step.
+	CompactionPolicySkip
+)
+
+// SimState is the mutable, per-step state simulateSession exposes to hooks.
+// Hooks read it to make decisions (e.g. "is this turn N?") and may write to
+// SuppressUsageMetadata to simulate a provider that drops usage metadata.
+type SimState struct {
+	Turn                  int
+	TokensBefore          int
+	SuppressUsageMetadata bool
+}
+
+// CompactionSnapshot describes one BeforeModelCallback step's token counts
+// and content hashes, passed to SimHook.PostCompaction both before and after
+// the call. RealTokens and CorrectionFactor are populated on the "after"
+// snapshot only, once the AfterModelCallback has run.
+type CompactionSnapshot struct {
+	Turn             int
+	TokensBefore     int
+	TokensAfter      int
+	Compacted        bool
+	ContentHashes    []string
+	RealTokens       int
+	CorrectionFactor float64
+}
+
+// turnResult summarizes one completed user turn, passed to SimHook.PostTurn.
+type turnResult struct {
+	Turn        int
+	TokensAfter int
+	Compacted   bool
+	Overflowed  bool
+}
+
+// SimHook is simulateSession's extension point, analogous to Erlang's
+// ct_hooks: it is notified at session start/end, around every turn, and
+// around every BeforeModelCallback (compaction) step, and may steer the
+// compaction decision via PreCompaction's return value. Tests register any
+// number of hooks; simulateSession runs them in registration order.
+type SimHook interface {
+	OnInit(cfg sessionConfig)
+	PreTurn(turn int, tc turnConfig, state *SimState)
+	PostTurn(turn int, r turnResult, state *SimState)
+	PreCompaction(state *SimState) CompactionPolicy
+	PostCompaction(before, after CompactionSnapshot)
+	OnTerminate(r sessionResult)
+}
+
+// BaseSimHook implements SimHook with no-op methods, so a hook that only
+// cares about one or two callbacks can embed BaseSimHook and override just
+// those, rather than hand-writing six empty methods.
+type BaseSimHook struct{}
+
+func (BaseSimHook) OnInit(sessionConfig)                            {}
+func (BaseSimHook) PreTurn(int, turnConfig, *SimState)              {}
+func (BaseSimHook) PostTurn(int, turnResult, *SimState)             {}
+func (BaseSimHook) PreCompaction(*SimState) CompactionPolicy        { return CompactionPolicyDefault }
+func (BaseSimHook) PostCompaction(before, after CompactionSnapshot) {}
+func (BaseSimHook) OnTerminate(sessionResult)                       {}
+
+// TokenBudgetTraceHook records every compaction step's CompactionSnapshot,
+// giving a turn-by-turn trace of token usage without instrumenting
+// simulateSession itself.
+type TokenBudgetTraceHook struct {
+	BaseSimHook
+	Trace []CompactionSnapshot
+}
+
+// NewTokenBudgetTraceHook creates a TokenBudgetTraceHook.
+func NewTokenBudgetTraceHook() *TokenBudgetTraceHook {
+	return &TokenBudgetTraceHook{}
+}
+
+func (h *TokenBudgetTraceHook) PostCompaction(before, after CompactionSnapshot) {
+	h.Trace = append(h.Trace, after)
+}
+
+// NetworkLatencyHook injects artificial latency before every compaction
+// step, simulating a slow provider round-trip.
+type NetworkLatencyHook struct {
+	BaseSimHook
+	Delay time.Duration
+}
+
+// NewNetworkLatencyHook creates a NetworkLatencyHook that sleeps delay
+// before every BeforeModelCallback step.
+func NewNetworkLatencyHook(delay time.Duration) *NetworkLatencyHook {
+	return &NetworkLatencyHook{Delay: delay}
+}
+
+func (h *NetworkLatencyHook) PreCompaction(state *SimState) CompactionPolicy {
+	time.Sleep(h.Delay)
+	return CompactionPolicyDefault
+}
+
+// ForceCompactionAtTurnHook forces a compaction on one specific turn
+// regardless of the estimated token count, to test compaction at a known,
+// reproducible boundary instead of only whichever turn happens to cross the
+// threshold.
+type ForceCompactionAtTurnHook struct {
+	BaseSimHook
+	Turn int
+}
+
+// NewForceCompactionAtTurnHook creates a ForceCompactionAtTurnHook that
+// forces compaction on the given turn index.
+func NewForceCompactionAtTurnHook(turn int) *ForceCompactionAtTurnHook {
+	return &ForceCompactionAtTurnHook{Turn: turn}
+}
+
+func (h *ForceCompactionAtTurnHook) PreCompaction(state *SimState) CompactionPolicy {
+	if state.Turn == h.Turn {
+		return CompactionPolicyForce
+	}
+	return CompactionPolicyDefault
+}
+
+// ChaosHook randomly suppresses usage metadata on some compaction steps,
+// simulating a flaky provider that doesn't always report real token counts.
+type ChaosHook struct {
+	BaseSimHook
+	rng             *rand.Rand
+	dropProbability float64
+}
+
+// NewChaosHook creates a ChaosHook that suppresses usage metadata with the
+// given probability (0..1) on each compaction step, drawing from rng so
+// runs stay reproducible under a fixed seed.
+func NewChaosHook(rng *rand.Rand, dropProbability float64) *ChaosHook {
+	return &ChaosHook{rng: rng, dropProbability: dropProbability}
+}
+
+func (h *ChaosHook) PreCompaction(state *SimState) CompactionPolicy {
+	if h.rng.Float64() < h.dropProbability {
+		state.SuppressUsageMetadata = true
+	}
+	return CompactionPolicyDefault
+}
@@ -0,0 +1,244 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// benchBaseline and benchTolerance turn the stress suite's "assert no
+// overflow" tests into continuous regression benchmarks: pass
+// -bench.baseline=testdata/bench/<test>.json from a prior run to diff
+// against it, failing the test if any tracked metric regresses beyond
+// -bench.tolerance.
+var (
+	benchBaseline  = flag.String("bench.baseline", "", "path to a previous testdata/bench JSON artifact to diff the current run against")
+	benchTolerance = flag.Float64("bench.tolerance", 0.10, "fractional regression tolerance before Reporter.Report fails the test")
+)
+
+// Sample is one runLLMStep's worth of measurements, recorded by
+// simulateSession into a Reporter.
+type Sample struct {
+	EstimatedTokens   int
+	RealTokens        int     // 0 when the session has no usage metadata
+	CorrectionFactor  float64 // realTokensForLLM / estimatedTokens, 0 if unavailable
+	TokensDropped     int     // tokensBefore - tokensAfter on a compacting step, else 0
+	CompactionLatency int64   // nanoseconds spent in this step's beforeModel call, when it compacted
+}
+
+// Reporter accumulates Samples for one test and reports them as a
+// stats table plus a testdata/bench/<test>.json artifact, mirroring the
+// columns of an erlperf-style report (N, mean, stddev, median, P95, P99, max).
+type Reporter struct {
+	test    string
+	samples []Sample
+}
+
+// NewReporter creates a Reporter for the given test name (conventionally
+// t.Name()).
+func NewReporter(test string) *Reporter {
+	return &Reporter{test: test}
+}
+
+// Record appends one sample.
+func (r *Reporter) Record(s Sample) {
+	r.samples = append(r.samples, s)
+}
+
+// Stats summarizes a set of float64 samples.
+type Stats struct {
+	N      int
+	Mean   float64
+	StdDev float64
+	Median float64
+	P95    float64
+	P99    float64
+	Max    float64
+}
+
+func computeStats(values []float64) Stats {
+	n := len(values)
+	if n == 0 {
+		return Stats{}
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(n)
+
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(n)
+
+	return Stats{
+		N:      n,
+		Mean:   mean,
+		StdDev: math.Sqrt(variance),
+		Median: percentileFloat(sorted, 0.50),
+		P95:    percentileFloat(sorted, 0.95),
+		P99:    percentileFloat(sorted, 0.99),
+		Max:    sorted[n-1],
+	}
+}
+
+// percentileFloat returns the p-th percentile (0..1) of sorted, which must
+// already be sorted ascending.
+func percentileFloat(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)-1))
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// BenchArtifact is the JSON-serializable snapshot persisted under
+// testdata/bench/<test>.json after each Report call.
+type BenchArtifact struct {
+	Test    string             `json:"test"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// Report prints a summary table for the recorded samples plus any extra
+// scalar metrics (e.g. sessionResult.compactions, .maxTokensSeen), writes
+// the combined result to testdata/bench/<test>.json, and — when
+// -bench.baseline is set — diffs against that prior artifact, failing t if
+// any tracked metric regressed beyond -bench.tolerance.
+func (r *Reporter) Report(t *testing.T, extra map[string]float64) {
+	t.Helper()
+
+	metrics := make(map[string]float64, len(extra))
+	for k, v := range extra {
+		metrics[k] = v
+	}
+
+	addStats := func(name string, values []float64) {
+		s := computeStats(values)
+		if s.N == 0 {
+			return
+		}
+		metrics[name+".mean"] = s.Mean
+		metrics[name+".stddev"] = s.StdDev
+		metrics[name+".median"] = s.Median
+		metrics[name+".p95"] = s.P95
+		metrics[name+".p99"] = s.P99
+		metrics[name+".max"] = s.Max
+
+		t.Logf("%-22s n=%-5d mean=%-10.1f stddev=%-10.1f median=%-10.1f p95=%-10.1f p99=%-10.1f max=%-10.1f",
+			name, s.N, s.Mean, s.StdDev, s.Median, s.P95, s.P99, s.Max)
+	}
+
+	var estimated, real, correction, dropped, latency []float64
+	for _, s := range r.samples {
+		estimated = append(estimated, float64(s.EstimatedTokens))
+		if s.RealTokens > 0 {
+			real = append(real, float64(s.RealTokens))
+		}
+		if s.CorrectionFactor > 0 {
+			correction = append(correction, s.CorrectionFactor)
+		}
+		if s.TokensDropped > 0 {
+			dropped = append(dropped, float64(s.TokensDropped))
+		}
+		if s.CompactionLatency > 0 {
+			latency = append(latency, float64(s.CompactionLatency))
+		}
+	}
+
+	addStats("estimatedTokens", estimated)
+	addStats("realTokens", real)
+	addStats("correctionFactor", correction)
+	addStats("tokensDropped", dropped)
+	addStats("compactionLatencyNs", latency)
+
+	r.writeArtifact(t, metrics)
+	r.diffBaseline(t, metrics)
+}
+
+func (r *Reporter) writeArtifact(t *testing.T, metrics map[string]float64) {
+	t.Helper()
+
+	dir := filepath.Join("testdata", "bench")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Logf("stress reporter: failed to create %s: %v", dir, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(BenchArtifact{Test: r.test, Metrics: metrics}, "", "  ")
+	if err != nil {
+		t.Logf("stress reporter: failed to marshal artifact: %v", err)
+		return
+	}
+
+	path := filepath.Join(dir, sanitizeTestName(r.test)+".json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Logf("stress reporter: failed to write %s: %v", path, err)
+	}
+}
+
+func (r *Reporter) diffBaseline(t *testing.T, metrics map[string]float64) {
+	t.Helper()
+
+	if *benchBaseline == "" {
+		return
+	}
+
+	data, err := os.ReadFile(*benchBaseline)
+	if err != nil {
+		t.Logf("stress reporter: failed to read baseline %s: %v", *benchBaseline, err)
+		return
+	}
+
+	var prior BenchArtifact
+	if err := json.Unmarshal(data, &prior); err != nil {
+		t.Logf("stress reporter: failed to parse baseline %s: %v", *benchBaseline, err)
+		return
+	}
+
+	for name, baseVal := range prior.Metrics {
+		curVal, ok := metrics[name]
+		if !ok || baseVal == 0 {
+			continue
+		}
+		delta := (curVal - baseVal) / baseVal
+		t.Logf("%-22s %+.1f%% (baseline=%.1f current=%.1f)", name, delta*100, baseVal, curVal)
+		if delta > *benchTolerance {
+			t.Errorf("regression: %s grew %.1f%%, exceeding tolerance %.1f%%", name, delta*100, *benchTolerance*100)
+		}
+	}
+}
+
+func sanitizeTestName(name string) string {
+	return strings.NewReplacer("/", "_", " ", "_").Replace(name)
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"iter"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// chunkedLLM streams Chunks as successive response parts, one per
+// iteration, so summarizeStreaming's incremental persistence/cancellation
+// can be exercised without a real multi-turn network stream.
+type chunkedLLM struct {
+	name   string
+	chunks []string
+}
+
+func (m *chunkedLLM) Name() string { return m.name }
+
+func (m *chunkedLLM) GenerateContent(_ context.Context, _ *model.LLMRequest, _ bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		for _, c := range m.chunks {
+			resp := &model.LLMResponse{
+				Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: c}}},
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestSummarizeStreaming_AccumulatesChunksAndPersistsDraft(t *testing.T) {
+	llm := &chunkedLLM{name: "small-model", chunks: []string{"one ", "two ", "three"}}
+	ctx := newMockCallbackContext("agent1")
+
+	got, err := summarizeStreaming(ctx, llm, nil, "", 1000, nil, nil)
+	if err != nil {
+		t.Fatalf("summarizeStreaming() error = %v", err)
+	}
+	if got != "one two three" {
+		t.Errorf("summarizeStreaming() = %q, want %q", got, "one two three")
+	}
+	if draft := loadSummaryDraft(ctx); draft != "one two three" {
+		t.Errorf("loadSummaryDraft() = %q, want the final accumulated text persisted", draft)
+	}
+}
+
+func TestSummarizeStreaming_ReportsProgressPerChunk(t *testing.T) {
+	llm := &chunkedLLM{name: "small-model", chunks: []string{"a", "b", "c"}}
+	ctx := newMockCallbackContext("agent1")
+
+	var seen []string
+	progress := func(agentName, partial string) {
+		if agentName != "agent1" {
+			t.Errorf("progress agentName = %q, want %q", agentName, "agent1")
+		}
+		seen = append(seen, partial)
+	}
+
+	if _, err := summarizeStreaming(ctx, llm, nil, "", 1000, nil, progress); err != nil {
+		t.Fatalf("summarizeStreaming() error = %v", err)
+	}
+
+	want := []string{"a", "ab", "abc"}
+	if len(seen) != len(want) {
+		t.Fatalf("progress called %d times, want %d", len(seen), len(want))
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("progress call %d = %q, want %q", i, seen[i], want[i])
+		}
+	}
+}
+
+func TestSummarizeStreaming_CancelledMidStreamReturnsPartialResult(t *testing.T) {
+	llm := &chunkedLLM{name: "small-model", chunks: []string{"partial summary text", "more text never seen"}}
+	ctx := newMockCallbackContext("agent1")
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	var calls int
+	progress := func(_, partial string) {
+		calls++
+		if calls == 1 {
+			cancel()
+		}
+	}
+
+	got, err := summarizeStreaming(cancelCtx, llm, nil, "", 1000, nil, progress)
+	if err != nil {
+		t.Fatalf("summarizeStreaming() error = %v", err)
+	}
+	if got != "partial summary text" {
+		t.Errorf("summarizeStreaming() = %q, want the partial text produced before cancellation", got)
+	}
+	if calls != 1 {
+		t.Errorf("progress called %d times, want 1 (stream should stop right after cancellation)", calls)
+	}
+}
+
+func TestSummarizeStreaming_EmptyResultFallsBackEvenWhenCancelled(t *testing.T) {
+	llm := &chunkedLLM{name: "small-model", chunks: nil}
+	ctx := newMockCallbackContext("agent1")
+	contents := []*genai.Content{textContent("user", "hello there")}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	got, err := summarizeStreaming(cancelCtx, llm, contents, "", 1000, nil, nil)
+	if err != nil {
+		t.Fatalf("summarizeStreaming() error = %v", err)
+	}
+	if got != buildFallbackSummary(contents, "") {
+		t.Errorf("summarizeStreaming() = %q, want buildFallbackSummary's mechanical fallback", got)
+	}
+}
+
+func TestSummarizeStreaming_WithoutCallbackContextSkipsDraftPersistence(t *testing.T) {
+	llm := &chunkedLLM{name: "small-model", chunks: []string{"hello"}}
+
+	got, err := summarizeStreaming(context.Background(), llm, nil, "", 1000, nil, nil)
+	if err != nil {
+		t.Fatalf("summarizeStreaming() error = %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("summarizeStreaming() = %q, want %q", got, "hello")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// SummaryDoc is the structured form of a conversation summary: the same
+// information summarizeSystemPrompt's "## Current State" / "## Key
+// Information" / "## Context & Decisions" / "## Exact Next Steps" sections
+// carry, but as typed fields a caller can parse without re-deriving
+// Markdown section boundaries. summarizeStructured populates one from the
+// summarizer LLM's JSON response; Render renders it back to the same
+// Markdown shape for injection into a model.LLMRequest.
+type SummaryDoc struct {
+	CurrentState string     `json:"current_state"`
+	KeyFacts     []Fact     `json:"key_facts,omitempty"`
+	Decisions    []Decision `json:"decisions,omitempty"`
+	NextSteps    []Step     `json:"next_steps,omitempty"`
+	Todos        []TodoItem `json:"todos,omitempty"`
+}
+
+// Fact is one entry of SummaryDoc.KeyFacts: a labeled piece of information
+// (a name, date, identifier, preference, ...) worth preserving verbatim.
+type Fact struct {
+	Label  string `json:"label"`
+	Detail string `json:"detail"`
+}
+
+// Decision is one entry of SummaryDoc.Decisions: a choice made during the
+// conversation and why, so it isn't silently revisited after compaction.
+type Decision struct {
+	Decision  string `json:"decision"`
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// Step is one entry of SummaryDoc.NextSteps: a specific, actionable item
+// rather than a vague "continue with the task".
+type Step struct {
+	Description string `json:"description"`
+}
+
+// Render renders doc back to the same Markdown section layout
+// summarizeSystemPrompt asks for, so it can be injected into a request or
+// fed back in as previousSummary exactly like the flat-string summaries
+// every other call site produces.
+func (d SummaryDoc) Render() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Current State\n\n%s\n", d.CurrentState)
+
+	if len(d.KeyFacts) > 0 {
+		b.WriteString("\n## Key Information\n\n")
+		for _, f := range d.KeyFacts {
+			fmt.Fprintf(&b, "- **%s**: %s\n", f.Label, f.Detail)
+		}
+	}
+
+	if len(d.Decisions) > 0 {
+		b.WriteString("\n## Context & Decisions\n\n")
+		for _, dec := range d.Decisions {
+			if dec.Rationale != "" {
+				fmt.Fprintf(&b, "- %s — %s\n", dec.Decision, dec.Rationale)
+			} else {
+				fmt.Fprintf(&b, "- %s\n", dec.Decision)
+			}
+		}
+	}
+
+	if len(d.NextSteps) > 0 {
+		b.WriteString("\n## Exact Next Steps\n\n")
+		for _, s := range d.NextSteps {
+			fmt.Fprintf(&b, "- %s\n", s.Description)
+		}
+	}
+
+	return b.String()
+}
+
+// SummaryMigrator converts a legacy flat-string summary — the shape every
+// summary had before structured summaries were introduced — into a
+// SummaryDoc, storing the raw text as CurrentState since a freeform string
+// can't be reliably split back into facts/decisions/steps. loadSummaryDoc
+// applies it automatically so callers never see the old shape.
+func SummaryMigrator(raw string) SummaryDoc {
+	return SummaryDoc{CurrentState: raw}
+}
+
+// summaryDocSchema constrains summarizeStructured's JSON response to
+// SummaryDoc's shape, keyed to its json tags.
+var summaryDocSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"current_state": {Type: genai.TypeString},
+		"key_facts": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"label":  {Type: genai.TypeString},
+					"detail": {Type: genai.TypeString},
+				},
+				Required: []string{"label", "detail"},
+			},
+		},
+		"decisions": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"decision":  {Type: genai.TypeString},
+					"rationale": {Type: genai.TypeString},
+				},
+				Required: []string{"decision"},
+			},
+		},
+		"next_steps": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"description": {Type: genai.TypeString},
+				},
+				Required: []string{"description"},
+			},
+		},
+	},
+	Required: []string{"current_state"},
+}
+
+// summarizeStructured is summarize's structured counterpart: it asks the
+// summarizer LLM for a JSON response matching summaryDocSchema instead of
+// freeform Markdown (via GenerateContentConfig.ResponseMIMEType /
+// ResponseSchema) and unmarshals the result into a SummaryDoc. Falls back to
+// a SummaryDoc wrapping buildFallbackSummary's mechanical excerpt if the LLM
+// returns no text, the same fallback summarizeStreaming uses for the flat
+// path. Unlike summarizeStreaming, this call isn't incremental — a
+// streamed partial JSON response can't be parsed until it's complete — so
+// SetSummaryProgress and SetSummarizationPool have no effect when structured
+// summaries are enabled.
+func summarizeStructured(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem) (SummaryDoc, error) {
+	maxOutputTokens := int32(float64(bufferTokens) * 0.50)
+	maxWords := int(float64(maxOutputTokens) * 0.75)
+
+	systemPrompt := summarizeSystemPrompt + fmt.Sprintf(
+		"\n\nKeep the summary under %d words. Respond with JSON matching the provided schema instead of Markdown.", maxWords)
+	userPrompt := buildSummarizePrompt(contents, previousSummary, todos, false)
+
+	req := &model.LLMRequest{
+		Model: llm.Name(),
+		Contents: []*genai.Content{
+			{
+				Role:  "user",
+				Parts: []*genai.Part{{Text: userPrompt}},
+			},
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{
+				Parts: []*genai.Part{{Text: systemPrompt}},
+			},
+			MaxOutputTokens:  maxOutputTokens,
+			ResponseMIMEType: "application/json",
+			ResponseSchema:   summaryDocSchema,
+		},
+	}
+
+	var result string
+	for resp, err := range llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return SummaryDoc{}, fmt.Errorf("structured summarization LLM call failed: %w", err)
+		}
+		if resp != nil && resp.Content != nil {
+			for _, part := range resp.Content.Parts {
+				if part != nil && part.Text != "" {
+					result += part.Text
+				}
+			}
+		}
+	}
+
+	if result == "" {
+		return SummaryDoc{CurrentState: buildFallbackSummary(contents, previousSummary)}, nil
+	}
+
+	var doc SummaryDoc
+	if err := json.Unmarshal([]byte(result), &doc); err != nil {
+		return SummaryDoc{}, fmt.Errorf("contextguard: failed to parse structured summary JSON: %w", err)
+	}
+	if len(todos) > 0 {
+		doc.Todos = todos
+	}
+	return doc, nil
+}
+
+// persistSummaryDoc writes doc as the structured form of the agent's
+// running summary, for consumers (an "export session brief" command,
+// another agent resuming the session) that want typed fields instead of
+// re-parsing Markdown. When store is non-nil, doc is written there instead
+// and session state only keeps the short ref store.Put returns
+// (stateKeyPrefixSummaryRef) — so the full doc no longer has to travel with
+// every session state read/write, and an unrelated agent holding the same
+// ref can dereference it via store.Get without access to this agent's
+// session. store == nil keeps the doc inline in session state as before.
+// Errors are logged but not propagated.
+func persistSummaryDoc(ctx agent.CallbackContext, doc SummaryDoc, store SummaryDocStore) {
+	if store != nil {
+		ref, err := store.Put(ctx, ctx.AgentName(), ctx.SessionID(), doc)
+		if err != nil {
+			slog.Warn("ContextGuard: failed to persist structured summary to store", "error", err)
+		} else {
+			persistSummaryRef(ctx, ref)
+			return
+		}
+	}
+
+	key := stateKeyPrefixSummaryDoc + ctx.AgentName()
+	if err := ctx.State().Set(key, doc); err != nil {
+		slog.Warn("ContextGuard: failed to persist structured summary", "error", err)
+	}
+}
+
+// persistSummaryRef writes ref — the handle persistSummaryDoc got back from
+// a SummaryDocStore — to session state in place of the full doc.
+func persistSummaryRef(ctx agent.CallbackContext, ref string) {
+	key := stateKeyPrefixSummaryRef + ctx.AgentName()
+	if err := ctx.State().Set(key, ref); err != nil {
+		slog.Warn("ContextGuard: failed to persist summary ref", "error", err)
+	}
+}
+
+// loadSummaryRef reads back the ref persistSummaryRef wrote, or "" if none
+// has been recorded yet.
+func loadSummaryRef(ctx agent.CallbackContext) string {
+	key := stateKeyPrefixSummaryRef + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return ""
+	}
+	ref, _ := val.(string)
+	return ref
+}
+
+// LoadSummaryDoc reads agentID's structured summary. If ctx's session state
+// holds a ref (persistSummaryDoc was called with a SummaryDocStore), it's
+// dereferenced through store, which must be the same store (or one sharing
+// the same backing data) that produced it — this is also how a supervisor
+// agent reads a sub-agent's summary: given that agent's ref and a
+// SummaryDocStore pointed at the same backend, store == nil only reads the
+// inline session-state shapes. Legacy sessions that only ever stored the
+// flat-string summary (stateKeyPrefixSummary) are transparently migrated
+// via SummaryMigrator, so callers never need to special-case the
+// pre-structured-summary shape. Returns the zero SummaryDoc if nothing has
+// been recorded yet.
+func LoadSummaryDoc(ctx agent.CallbackContext, store SummaryDocStore) SummaryDoc {
+	key := stateKeyPrefixSummaryDoc + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err == nil && val != nil {
+		switch v := val.(type) {
+		case SummaryDoc:
+			return v
+		case string:
+			return SummaryMigrator(v)
+		case map[string]any:
+			return summaryDocFromMap(v)
+		}
+	}
+
+	if store != nil {
+		if ref := loadSummaryRef(ctx); ref != "" {
+			if doc, err := store.Get(ctx, ref); err == nil {
+				return doc
+			}
+		}
+	}
+
+	if raw := loadSummary(ctx); raw != "" {
+		return SummaryMigrator(raw)
+	}
+	return SummaryDoc{}
+}
+
+// ResolveSummaryDoc dereferences ref through store directly, for a caller
+// (e.g. a supervisor agent) that was handed another agent's summary ref
+// out-of-band rather than reading it from that agent's own session state.
+func ResolveSummaryDoc(ctx context.Context, store SummaryDocStore, ref string) (SummaryDoc, error) {
+	return store.Get(ctx, ref)
+}
+
+// summaryDocFromMap decodes the map[string]any/[]any shape a real session
+// store's JSON round-trip would hand SummaryDoc back as, following
+// loadSummaryTree's precedent for the same situation.
+func summaryDocFromMap(v map[string]any) SummaryDoc {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return SummaryDoc{}
+	}
+	var doc SummaryDoc
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return SummaryDoc{}
+	}
+	return doc
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestSummaryDoc_RenderIncludesNonEmptySectionsInOrder(t *testing.T) {
+	doc := SummaryDoc{
+		CurrentState: "investigating the outage",
+		KeyFacts:     []Fact{{Label: "service", Detail: "checkout-api"}},
+		Decisions:    []Decision{{Decision: "rolled back deploy", Rationale: "error rate spiked"}},
+		NextSteps:    []Step{{Description: "confirm error rate recovers"}},
+	}
+
+	rendered := doc.Render()
+
+	for _, want := range []string{
+		"## Current State", "investigating the outage",
+		"## Key Information", "**service**: checkout-api",
+		"## Context & Decisions", "rolled back deploy — error rate spiked",
+		"## Exact Next Steps", "confirm error rate recovers",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("Render() missing %q, got: %q", want, rendered)
+		}
+	}
+
+	stateIdx := strings.Index(rendered, "## Current State")
+	stepsIdx := strings.Index(rendered, "## Exact Next Steps")
+	if stateIdx == -1 || stepsIdx == -1 || stateIdx > stepsIdx {
+		t.Errorf("Render() sections out of order: %q", rendered)
+	}
+}
+
+func TestSummaryDoc_RenderOmitsEmptySections(t *testing.T) {
+	doc := SummaryDoc{CurrentState: "just getting started"}
+
+	rendered := doc.Render()
+
+	for _, unwanted := range []string{"## Key Information", "## Context & Decisions", "## Exact Next Steps"} {
+		if strings.Contains(rendered, unwanted) {
+			t.Errorf("Render() should omit empty section %q, got: %q", unwanted, rendered)
+		}
+	}
+}
+
+func TestSummaryMigrator_WrapsRawTextAsCurrentState(t *testing.T) {
+	doc := SummaryMigrator("legacy flat summary text")
+
+	if doc.CurrentState != "legacy flat summary text" {
+		t.Errorf("CurrentState = %q, want the raw legacy text", doc.CurrentState)
+	}
+	if len(doc.KeyFacts) != 0 || len(doc.Decisions) != 0 || len(doc.NextSteps) != 0 {
+		t.Errorf("migrated doc should have no structured fields, got %+v", doc)
+	}
+}
+
+func TestLoadSummaryDoc_MigratesLegacyFlatSummary(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	persistSummary(ctx, "legacy summary from before structured summaries", 42)
+
+	doc := LoadSummaryDoc(ctx, nil)
+
+	if doc.CurrentState != "legacy summary from before structured summaries" {
+		t.Errorf("LoadSummaryDoc() = %+v, want the legacy text migrated into CurrentState", doc)
+	}
+}
+
+func TestLoadSummaryDoc_PersistLoadRoundTrip(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	doc := SummaryDoc{
+		CurrentState: "reviewing the PR",
+		KeyFacts:     []Fact{{Label: "repo", Detail: "adk-utils-go"}},
+	}
+	persistSummaryDoc(ctx, doc, nil)
+
+	loaded := LoadSummaryDoc(ctx, nil)
+
+	if loaded.CurrentState != doc.CurrentState || len(loaded.KeyFacts) != 1 || loaded.KeyFacts[0].Detail != "adk-utils-go" {
+		t.Fatalf("LoadSummaryDoc() = %+v, want the doc just persisted", loaded)
+	}
+}
+
+func TestSummarizeStructured_ParsesJSONResponse(t *testing.T) {
+	llm := &mockLLM{name: "sim-model", response: `{
+		"current_state": "refactoring the payment module",
+		"key_facts": [{"label": "ticket", "detail": "PAY-123"}],
+		"next_steps": [{"description": "add retry tests"}]
+	}`}
+	contents := kubeAgentConversation(2)
+
+	doc, err := summarizeStructured(context.Background(), llm, contents, "", 4000, nil)
+	if err != nil {
+		t.Fatalf("summarizeStructured error: %v", err)
+	}
+
+	if doc.CurrentState != "refactoring the payment module" {
+		t.Errorf("CurrentState = %q, want the parsed value", doc.CurrentState)
+	}
+	if len(doc.KeyFacts) != 1 || doc.KeyFacts[0].Label != "ticket" {
+		t.Errorf("KeyFacts = %+v, want one parsed fact", doc.KeyFacts)
+	}
+	if len(doc.NextSteps) != 1 || doc.NextSteps[0].Description != "add retry tests" {
+		t.Errorf("NextSteps = %+v, want one parsed step", doc.NextSteps)
+	}
+}
+
+func TestSummarizeStructured_InvalidJSONReturnsError(t *testing.T) {
+	llm := &mockLLM{name: "sim-model", response: "not valid json"}
+	contents := kubeAgentConversation(2)
+
+	if _, err := summarizeStructured(context.Background(), llm, contents, "", 4000, nil); err == nil {
+		t.Fatal("expected an error for a non-JSON summarizer response")
+	}
+}
+
+func TestThresholdStrategy_StructuredSummaryPersistsDoc(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: `{"current_state": "mid-investigation"}`}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	ts.SetStructuredSummary(true)
+	ctx := newMockCallbackContext("sim-agent")
+
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	doc := LoadSummaryDoc(ctx, nil)
+	if doc.CurrentState != "mid-investigation" {
+		t.Errorf("LoadSummaryDoc() = %+v, want the structured summary persisted during Compact", doc)
+	}
+}
+
+func TestPersistSummaryDoc_RoutesThroughStoreAndPersistsRef(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	store := NewMemorySummaryDocStore()
+	doc := SummaryDoc{CurrentState: "mid-migration"}
+
+	persistSummaryDoc(ctx, doc, store)
+
+	if _, err := ctx.State().Get(stateKeyPrefixSummaryDoc + ctx.AgentName()); err == nil {
+		t.Errorf("persistSummaryDoc with a store should not also write the inline session-state doc")
+	}
+	ref := loadSummaryRef(ctx)
+	if ref == "" {
+		t.Fatal("persistSummaryDoc did not persist a ref to session state")
+	}
+	stored, err := store.Get(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("store.Get(%q): %v", ref, err)
+	}
+	if stored.CurrentState != doc.CurrentState {
+		t.Errorf("store.Get(%q) = %+v, want %+v", ref, stored, doc)
+	}
+}
+
+func TestLoadSummaryDoc_DereferencesRefThroughStore(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	store := NewMemorySummaryDocStore()
+	doc := SummaryDoc{CurrentState: "mid-migration"}
+
+	persistSummaryDoc(ctx, doc, store)
+
+	loaded := LoadSummaryDoc(ctx, store)
+	if loaded.CurrentState != doc.CurrentState {
+		t.Errorf("LoadSummaryDoc() = %+v, want the doc dereferenced through the store", loaded)
+	}
+
+	// A second agent holding the same ref out-of-band, without ctx's session
+	// state, can still resolve it directly against the shared store.
+	ref := loadSummaryRef(ctx)
+	resolved, err := ResolveSummaryDoc(context.Background(), store, ref)
+	if err != nil {
+		t.Fatalf("ResolveSummaryDoc: %v", err)
+	}
+	if resolved.CurrentState != doc.CurrentState {
+		t.Errorf("ResolveSummaryDoc() = %+v, want %+v", resolved, doc)
+	}
+}
+
+func TestWithSummaryDocStore_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+	store := NewMemorySummaryDocStore()
+
+	g.Add("agent1", llm, WithStructuredSummary(), WithSummaryDocStore(store))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if !ts.structuredSummary {
+		t.Error("WithStructuredSummary did not wire structuredSummary")
+	}
+	if ts.summaryDocStore != store {
+		t.Errorf("summaryDocStore = %v, want the configured store", ts.summaryDocStore)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// defaultSummaryTreeFanout bounds how many nodes may accumulate at a given
+// level of a SummaryTree before they're rolled up into one node at the next
+// level. Chosen the same way reduceGroupSize was: small enough that a
+// roll-up's prompt (the fanout nodes' texts concatenated) stays comfortably
+// under any summarizer's context window.
+const defaultSummaryTreeFanout = 5
+
+// SummaryTreeNode is one node of a SummaryTree: Level 0 nodes each
+// summarize one batch of newly-evicted conversation turns; a node at Level
+// L+1 summarizes defaultSummaryTreeFanout (or SetHierarchicalSummaries'
+// fanout) sibling nodes at Level L.
+type SummaryTreeNode struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// SummaryTree is a rolling, multi-level summary: unlike a single flat
+// summary string that grows unbounded as more turns are folded in, each
+// level's node count is capped at fanout — once it's exceeded, the oldest
+// fanout nodes are merged into a single node at the next level up. This
+// bounds total summary length to roughly O(fanout * levels) while still
+// preserving temporal locality (recent history stays in full detail at
+// Level 0; older history is progressively compressed).
+type SummaryTree struct {
+	// Nodes[level] holds that level's nodes not yet rolled up into the next
+	// level, oldest first.
+	Nodes [][]SummaryTreeNode `json:"nodes"`
+}
+
+// appendLevelZero adds a new Level-0 node summarizing the most recently
+// evicted turns.
+func (t *SummaryTree) appendLevelZero(text string) {
+	if len(t.Nodes) == 0 {
+		t.Nodes = make([][]SummaryTreeNode, 1)
+	}
+	t.Nodes[0] = append(t.Nodes[0], SummaryTreeNode{Text: text})
+}
+
+// rollUp merges nodes at every level that has more than fanout of them into
+// new nodes one level up, repeating until every level is back at or under
+// fanout. A roll-up failure at one level leaves that level's nodes
+// un-merged (so no history is lost) and stops further roll-ups, since a
+// failing summarizer call is unlikely to succeed on the next level either.
+//
+// maxDepth <= 0 leaves the tree free to grow as many levels as it needs.
+// maxDepth > 0 caps it: once the deepest allowed level (maxDepth-1) itself
+// overflows fanout, its entire backlog is collapsed into a single node in
+// place instead of promoting into a level beyond the cap.
+func (t *SummaryTree) rollUp(ctx context.Context, llm model.LLM, fanout, targetTokens, maxDepth int) error {
+	for level := 0; level < len(t.Nodes); level++ {
+		atDepthCap := maxDepth > 0 && level == maxDepth-1
+		for len(t.Nodes[level]) > fanout {
+			group := t.Nodes[level]
+			if !atDepthCap {
+				group = group[:fanout]
+			}
+
+			contents := make([]*genai.Content, len(group))
+			for i, node := range group {
+				contents[i] = &genai.Content{Role: "user", Parts: []*genai.Part{{Text: node.Text}}}
+			}
+			rolledText, err := summarize(ctx, llm, contents, "", targetTokens, nil)
+			if err != nil {
+				return fmt.Errorf("contextguard: summary tree roll-up failed at level %d: %w", level, err)
+			}
+
+			if atDepthCap {
+				t.Nodes[level] = []SummaryTreeNode{{Level: level, Text: rolledText}}
+				break
+			}
+
+			t.Nodes[level] = t.Nodes[level][fanout:]
+			if level+1 >= len(t.Nodes) {
+				t.Nodes = append(t.Nodes, nil)
+			}
+			t.Nodes[level+1] = append(t.Nodes[level+1], SummaryTreeNode{Level: level + 1, Text: rolledText})
+		}
+	}
+	return nil
+}
+
+// promoteByBudget promotes whole levels into "chapters" one level up based
+// on token budget rather than node count: starting at Level 0 with
+// baseBudget, whenever a level's combined text exceeds that level's budget,
+// all of that level's nodes are summarized together into a single new node
+// one level up and the level is cleared, then the next level is checked
+// against budget*growth (each level up compresses more aggressively than
+// the one below it). Unlike rollUp, which bounds a level by node count
+// (fanout) and leaves a fanout-sized remainder behind, promoteByBudget
+// collapses a whole level at once — this is the recurrence
+// WithHierarchical documents as budget_{k+1} = budget_k * growth. A
+// promotion failure at one level leaves that level's nodes un-merged and
+// stops further promotions, for the same reason rollUp does.
+func (t *SummaryTree) promoteByBudget(ctx context.Context, llm model.LLM, baseBudget, growth int) error {
+	if growth <= 0 {
+		growth = 1
+	}
+
+	budget := baseBudget
+	for level := 0; level < len(t.Nodes); level++ {
+		if levelText := joinNodeTexts(t.Nodes[level]); levelText != "" &&
+			estimateContentTokens([]*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: levelText}}}}) > budget {
+
+			contents := make([]*genai.Content, len(t.Nodes[level]))
+			for i, node := range t.Nodes[level] {
+				contents[i] = &genai.Content{Role: "user", Parts: []*genai.Part{{Text: node.Text}}}
+			}
+			rolledText, err := summarize(ctx, llm, contents, "", budget, nil)
+			if err != nil {
+				return fmt.Errorf("contextguard: summary tree budget promotion failed at level %d: %w", level, err)
+			}
+
+			t.Nodes[level] = nil
+			if level+1 >= len(t.Nodes) {
+				t.Nodes = append(t.Nodes, nil)
+			}
+			t.Nodes[level+1] = append(t.Nodes[level+1], SummaryTreeNode{Level: level + 1, Text: rolledText})
+		}
+		budget *= growth
+	}
+	return nil
+}
+
+// joinNodeTexts concatenates a level's node texts for the token-budget
+// check in promoteByBudget, without the Markdown headers render() adds —
+// those exist for the LLM-facing rendering, not for measuring size.
+func joinNodeTexts(nodes []SummaryTreeNode) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(node.Text)
+	}
+	return b.String()
+}
+
+// render flattens the tree into a single preamble: every level above 0
+// verbatim (oldest/highest level first), followed by every Level-0 node in
+// full — the small, fanout-bounded handful of most-recently-evicted
+// batches that haven't been rolled up yet.
+func (t *SummaryTree) render() string {
+	var b strings.Builder
+
+	for level := len(t.Nodes) - 1; level >= 1; level-- {
+		for _, node := range t.Nodes[level] {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			fmt.Fprintf(&b, "## History (level %d)\n\n%s", level, node.Text)
+		}
+	}
+
+	if len(t.Nodes) > 0 {
+		for _, node := range t.Nodes[0] {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			fmt.Fprintf(&b, "## Recent history\n\n%s", node.Text)
+		}
+	}
+
+	return b.String()
+}
+
+// persistSummaryTree writes tree to session state. Errors are logged but
+// not propagated.
+func persistSummaryTree(ctx agent.CallbackContext, tree SummaryTree) {
+	key := stateKeyPrefixSummaryTree + ctx.AgentName()
+	if err := ctx.State().Set(key, tree); err != nil {
+		slog.Warn("ContextGuard: failed to persist summary tree", "error", err)
+	}
+}
+
+// loadSummaryTree reads the summary tree from session state. Returns the
+// zero SummaryTree if none has been recorded yet. Supports both
+// SummaryTree (same-process state) and the map[string]any/[]any shapes a
+// JSON round-trip through a real session store would produce, following
+// loadTodos' precedent.
+func loadSummaryTree(ctx agent.CallbackContext) SummaryTree {
+	key := stateKeyPrefixSummaryTree + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return SummaryTree{}
+	}
+
+	switch v := val.(type) {
+	case SummaryTree:
+		return v
+	case map[string]any:
+		tree := SummaryTree{}
+		rawLevels, _ := v["nodes"].([]any)
+		for _, rawLevel := range rawLevels {
+			rawNodes, _ := rawLevel.([]any)
+			var nodes []SummaryTreeNode
+			for _, raw := range rawNodes {
+				m, ok := raw.(map[string]any)
+				if !ok {
+					continue
+				}
+				node := SummaryTreeNode{Level: intFromAny(m["level"])}
+				if text, ok := m["text"].(string); ok {
+					node.Text = text
+				}
+				nodes = append(nodes, node)
+			}
+			tree.Nodes = append(tree.Nodes, nodes)
+		}
+		return tree
+	}
+	return SummaryTree{}
+}
@@ -0,0 +1,233 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+func TestSummaryTree_AppendLevelZero(t *testing.T) {
+	var tree SummaryTree
+	tree.appendLevelZero("first batch")
+	tree.appendLevelZero("second batch")
+
+	if len(tree.Nodes) != 1 || len(tree.Nodes[0]) != 2 {
+		t.Fatalf("tree.Nodes = %+v, want one level with two nodes", tree.Nodes)
+	}
+	if tree.Nodes[0][0].Text != "first batch" || tree.Nodes[0][1].Text != "second batch" {
+		t.Errorf("unexpected node texts: %+v", tree.Nodes[0])
+	}
+}
+
+func TestSummaryTree_RollUpMergesAcrossFanout(t *testing.T) {
+	var tree SummaryTree
+	for i := range 6 {
+		tree.appendLevelZero(fmt.Sprintf("batch %d", i))
+	}
+
+	llm := &mockLLM{name: "sim-model", response: "rolled up summary"}
+	if err := tree.rollUp(context.Background(), llm, 5, 2_000, 0); err != nil {
+		t.Fatalf("rollUp error: %v", err)
+	}
+
+	if len(tree.Nodes[0]) != 1 {
+		t.Fatalf("level 0 has %d nodes left, want 1 (6 - fanout 5)", len(tree.Nodes[0]))
+	}
+	if len(tree.Nodes) != 2 || len(tree.Nodes[1]) != 1 {
+		t.Fatalf("tree.Nodes = %+v, want a new level 1 with exactly one rolled-up node", tree.Nodes)
+	}
+	if tree.Nodes[1][0].Text != "rolled up summary" {
+		t.Errorf("rolled-up node text = %q, want the summarizer's output", tree.Nodes[1][0].Text)
+	}
+	if tree.Nodes[1][0].Level != 1 {
+		t.Errorf("rolled-up node level = %d, want 1", tree.Nodes[1][0].Level)
+	}
+}
+
+func TestSummaryTree_RollUpCascadesMultipleLevels(t *testing.T) {
+	var tree SummaryTree
+	for i := range 31 {
+		tree.appendLevelZero(fmt.Sprintf("batch %d", i))
+	}
+
+	llm := &mockLLM{name: "sim-model", response: "rolled up summary"}
+	if err := tree.rollUp(context.Background(), llm, 5, 2_000, 0); err != nil {
+		t.Fatalf("rollUp error: %v", err)
+	}
+
+	// 31 level-0 nodes with fanout 5 roll up into 6 level-1 nodes (1 left
+	// over at level 0); level 1 now exceeds fanout, so its oldest 5 roll up
+	// into 1 level-2 node, leaving 1 at level 1.
+	if len(tree.Nodes[0]) != 1 {
+		t.Errorf("level 0 has %d nodes, want 1", len(tree.Nodes[0]))
+	}
+	if len(tree.Nodes) != 3 {
+		t.Fatalf("tree has %d levels, want 3", len(tree.Nodes))
+	}
+	if len(tree.Nodes[1]) != 1 {
+		t.Errorf("level 1 has %d nodes, want 1 (6 - fanout 5)", len(tree.Nodes[1]))
+	}
+	if len(tree.Nodes[2]) != 1 {
+		t.Errorf("level 2 has %d nodes, want 1", len(tree.Nodes[2]))
+	}
+}
+
+func TestSummaryTree_RollUpRespectsMaxDepth(t *testing.T) {
+	var tree SummaryTree
+	for i := range 51 {
+		tree.appendLevelZero(fmt.Sprintf("batch %d", i))
+	}
+
+	llm := &mockLLM{name: "sim-model", response: "rolled up summary"}
+	if err := tree.rollUp(context.Background(), llm, 5, 2_000, 2); err != nil {
+		t.Fatalf("rollUp error: %v", err)
+	}
+
+	// With maxDepth 2, level 1 (index maxDepth-1) is the deepest allowed
+	// level: rather than promoting into a level 2, its overflow collapses
+	// in place into a single node.
+	if len(tree.Nodes) != 2 {
+		t.Fatalf("tree has %d levels, want 2 (capped by maxDepth)", len(tree.Nodes))
+	}
+	if len(tree.Nodes[1]) != 1 {
+		t.Fatalf("level 1 has %d nodes, want 1 (collapsed in place)", len(tree.Nodes[1]))
+	}
+	if tree.Nodes[1][0].Text != "rolled up summary" {
+		t.Errorf("collapsed node text = %q, want the summarizer's output", tree.Nodes[1][0].Text)
+	}
+}
+
+func TestSummaryTree_Render(t *testing.T) {
+	tree := SummaryTree{
+		Nodes: [][]SummaryTreeNode{
+			{{Text: "recent A"}, {Text: "recent B"}},
+			{{Level: 1, Text: "older rollup"}},
+		},
+	}
+
+	rendered := tree.render()
+
+	if !strings.Contains(rendered, "## History (level 1)") || !strings.Contains(rendered, "older rollup") {
+		t.Errorf("render() missing level-1 section: %q", rendered)
+	}
+	if !strings.Contains(rendered, "## Recent history") || !strings.Contains(rendered, "recent A") || !strings.Contains(rendered, "recent B") {
+		t.Errorf("render() missing recent-history section: %q", rendered)
+	}
+
+	levelIdx := strings.Index(rendered, "## History (level 1)")
+	recentIdx := strings.Index(rendered, "## Recent history")
+	if levelIdx == -1 || recentIdx == -1 || levelIdx > recentIdx {
+		t.Errorf("render() should put higher levels before level-0, got: %q", rendered)
+	}
+}
+
+func TestSummaryTree_PersistLoadRoundTrip(t *testing.T) {
+	ctx := newMockCallbackContext("tree-agent")
+
+	tree := SummaryTree{Nodes: [][]SummaryTreeNode{
+		{{Text: "recent"}},
+		{{Level: 1, Text: "older"}},
+	}}
+	persistSummaryTree(ctx, tree)
+
+	loaded := loadSummaryTree(ctx)
+	if len(loaded.Nodes) != 2 || loaded.Nodes[0][0].Text != "recent" || loaded.Nodes[1][0].Text != "older" {
+		t.Fatalf("loadSummaryTree() = %+v, want the tree just persisted", loaded)
+	}
+}
+
+func TestSummaryTree_LoadFromJSONFallbackShape(t *testing.T) {
+	ctx := newMockCallbackContext("tree-agent")
+
+	// Simulate what a real session store's JSON round-trip would hand back:
+	// the concrete SummaryTree type decoded into map[string]any/[]any.
+	raw := map[string]any{
+		"nodes": []any{
+			[]any{map[string]any{"level": float64(0), "text": "recent"}},
+			[]any{map[string]any{"level": float64(1), "text": "older"}},
+		},
+	}
+	if err := ctx.State().Set(stateKeyPrefixSummaryTree+ctx.AgentName(), raw); err != nil {
+		t.Fatalf("State().Set: %v", err)
+	}
+
+	loaded := loadSummaryTree(ctx)
+	if len(loaded.Nodes) != 2 || loaded.Nodes[0][0].Text != "recent" || loaded.Nodes[1][0].Text != "older" {
+		t.Fatalf("loadSummaryTree() = %+v, want the tree decoded from the map/slice shape", loaded)
+	}
+}
+
+func TestThresholdStrategy_HierarchicalSummariesStayBounded(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{
+		name:     "sim-model",
+		response: "Summary: the agent inspected and fixed several pods across namespaces.",
+	}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	ts.SetHierarchicalSummaries(3)
+	ctx := newMockCallbackContext("sim-agent")
+
+	contents := kubeAgentConversation(50)
+
+	var lastLen int
+	for round := range 10 {
+		end := min(len(contents), (round+1)*len(contents)/10)
+		req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents[:end])}
+
+		if err := ts.Compact(ctx, req); err != nil {
+			t.Fatalf("round %d: Compact error: %v", round, err)
+		}
+
+		tree := loadSummaryTree(ctx)
+		rendered := tree.render()
+		if round >= 5 && lastLen > 0 {
+			// Once the tree has rolled up at least once, its rendered length
+			// should stop growing linearly with the number of rounds -- the
+			// whole point of capping each level at the fanout.
+			if len(rendered) > lastLen*2 {
+				t.Errorf("round %d: rendered summary grew from %d to %d bytes, want roughly bounded growth", round, lastLen, len(rendered))
+			}
+		}
+		lastLen = len(rendered)
+	}
+}
+
+func TestWithHierarchicalSummary_RegistersLimitsOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+
+	g.Add("agent1", llm, WithHierarchicalSummary(3, 500, 2))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if !ts.hierarchical || ts.summaryTreeFanout != 3 {
+		t.Fatalf("hierarchical/fanout not wired: hierarchical=%v fanout=%d", ts.hierarchical, ts.summaryTreeFanout)
+	}
+	if ts.summaryLeafTokens != 500 || ts.summaryMaxDepth != 2 {
+		t.Errorf("leafTokens/maxDepth = %d/%d, want 500/2", ts.summaryLeafTokens, ts.summaryMaxDepth)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestTrailingToolState_InFlightFunctionCallNoResponseYet(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "check pods"),
+		{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}}}},
+	}
+
+	got := trailingToolState(contents)
+	if len(got) != 1 || got[0] != contents[1] {
+		t.Fatalf("trailingToolState() = %v, want the trailing FunctionCall content", got)
+	}
+}
+
+func TestTrailingToolState_ResponseArrivedNotYetConsumed(t *testing.T) {
+	call := &genai.Content{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}}}}
+	resp := &genai.Content{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "kubectl_get_pods"}}}}
+	contents := []*genai.Content{textContent("user", "check pods"), call, resp}
+
+	got := trailingToolState(contents)
+	if len(got) != 2 || got[0] != call || got[1] != resp {
+		t.Fatalf("trailingToolState() = %v, want [call, response] pair", got)
+	}
+}
+
+func TestTrailingToolState_ParallelToolCalls(t *testing.T) {
+	call := &genai.Content{Role: "model", Parts: []*genai.Part{
+		{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}},
+		{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_logs"}},
+	}}
+	contents := []*genai.Content{textContent("user", "check everything"), call}
+
+	got := trailingToolState(contents)
+	if len(got) != 1 || got[0] != call {
+		t.Fatalf("trailingToolState() = %v, want the single parallel-call content", got)
+	}
+}
+
+func TestTrailingToolState_NoneForPlainTextTurn(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "hi"),
+		{Role: "model", Parts: []*genai.Part{{Text: "hello, all done here."}}},
+	}
+
+	if got := trailingToolState(contents); got != nil {
+		t.Errorf("trailingToolState() = %v, want nil for a completed plain-text turn", got)
+	}
+}
+
+func TestTrailingToolState_OrphanedResponseWithoutPrecedingCall(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "kubectl_get_pods"}}}},
+	}
+
+	got := trailingToolState(contents)
+	if len(got) != 1 || got[0] != contents[0] {
+		t.Fatalf("trailingToolState() = %v, want the lone response content", got)
+	}
+}
+
+func TestThresholdStrategy_CompactPreservesInFlightFunctionCallAfterContinuation(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+
+	ctx := newMockCallbackContext("sim-agent")
+	contents := kubeAgentConversation(50)
+	contents = append(contents, &genai.Content{
+		Role:  "model",
+		Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}}},
+	})
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	last := req.Contents[len(req.Contents)-1]
+	if last.Role != "model" || last.Parts[0].FunctionCall == nil || last.Parts[0].FunctionCall.Name != "kubectl_get_pods" {
+		t.Fatalf("expected the in-flight FunctionCall re-appended last, got role=%q parts=%v", last.Role, last.Parts)
+	}
+
+	secondToLast := req.Contents[len(req.Contents)-2]
+	if secondToLast.Role != "user" || !strings.Contains(secondToLast.Parts[0].Text, "Continue working") {
+		t.Errorf("expected the continuation message just before the preserved tool state, got role=%q text=%q",
+			secondToLast.Role, secondToLast.Parts[0].Text)
+	}
+	if !strings.Contains(secondToLast.Parts[0].Text, "kubectl_get_pods") {
+		t.Errorf("expected the continuation message to mention the pending tool call, got %q", secondToLast.Parts[0].Text)
+	}
+}
+
+func TestThresholdStrategy_CompactPreservesCallResponsePairAfterContinuation(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+
+	ctx := newMockCallbackContext("sim-agent")
+	contents := kubeAgentConversation(50)
+	contents = append(contents,
+		&genai.Content{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}}}},
+		&genai.Content{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "kubectl_get_pods"}}}},
+	)
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	n := len(req.Contents)
+	if n < 2 {
+		t.Fatalf("expected at least 2 trailing entries, got %d total", n)
+	}
+	callContent, respContent := req.Contents[n-2], req.Contents[n-1]
+	if callContent.Role != "model" || callContent.Parts[0].FunctionCall == nil {
+		t.Errorf("expected the preserved FunctionCall second-to-last, got role=%q parts=%v", callContent.Role, callContent.Parts)
+	}
+	if respContent.Role != "user" || respContent.Parts[0].FunctionResponse == nil {
+		t.Errorf("expected the preserved FunctionResponse last, got role=%q parts=%v", respContent.Role, respContent.Parts)
+	}
+}
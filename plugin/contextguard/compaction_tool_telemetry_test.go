@@ -0,0 +1,154 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/genai"
+)
+
+// toolStatsEWMAAlpha weights how heavily the most recent turn's
+// post-compaction byte count contributes to ToolStats.EWMA — higher reacts
+// faster to a tool suddenly dominating the window, lower smooths out noise.
+const toolStatsEWMAAlpha = 0.3
+
+// ToolStats is one tool name's context-pressure history across a
+// simulateSession run, sampled once per runLLMStep so stress tests can
+// pinpoint which tool is driving growth instead of only seeing aggregate
+// counters.
+type ToolStats struct {
+	// BytesOverTime is this tool's total FunctionResponse payload bytes
+	// present in req.Contents before compaction, at each runLLMStep.
+	BytesOverTime []int
+
+	// CountOverTime is this tool's cumulative FunctionResponse invocation
+	// count in req.Contents before compaction, at each runLLMStep.
+	CountOverTime []int
+
+	// PostCompactionBytes is this tool's total FunctionResponse payload
+	// bytes remaining in req.Contents after compaction, at each runLLMStep.
+	PostCompactionBytes []int
+
+	// EWMA is a running exponentially-weighted average of
+	// PostCompactionBytes, weighted by toolStatsEWMAAlpha — an estimate of
+	// how many of this tool's bytes typically survive into the next turn.
+	EWMA float64
+}
+
+// toolTelemetry accumulates ToolStats per tool name across a
+// simulateSession run.
+type toolTelemetry struct {
+	stats map[string]*ToolStats
+}
+
+func newToolTelemetry() *toolTelemetry {
+	return &toolTelemetry{stats: make(map[string]*ToolStats)}
+}
+
+// record samples one runLLMStep's before/after Contents, attributing
+// FunctionResponse bytes and counts to the tool name on each part.
+func (tt *toolTelemetry) record(before, after []*genai.Content) {
+	beforeBytes, counts := toolResponseBytes(before)
+	afterBytes, _ := toolResponseBytes(after)
+
+	seen := make(map[string]bool, len(beforeBytes)+len(afterBytes))
+	for name := range beforeBytes {
+		seen[name] = true
+	}
+	for name := range afterBytes {
+		seen[name] = true
+	}
+
+	for name := range seen {
+		st, ok := tt.stats[name]
+		if !ok {
+			st = &ToolStats{}
+			tt.stats[name] = st
+		}
+		st.BytesOverTime = append(st.BytesOverTime, beforeBytes[name])
+		st.CountOverTime = append(st.CountOverTime, counts[name])
+		postBytes := afterBytes[name]
+		st.PostCompactionBytes = append(st.PostCompactionBytes, postBytes)
+		if len(st.PostCompactionBytes) == 1 {
+			st.EWMA = float64(postBytes)
+		} else {
+			st.EWMA = toolStatsEWMAAlpha*float64(postBytes) + (1-toolStatsEWMAAlpha)*st.EWMA
+		}
+	}
+}
+
+// snapshot returns a copy of the accumulated per-tool stats for the final
+// sessionResult.
+func (tt *toolTelemetry) snapshot() map[string]ToolStats {
+	out := make(map[string]ToolStats, len(tt.stats))
+	for name, st := range tt.stats {
+		out[name] = *st
+	}
+	return out
+}
+
+// toolResponseBytes sums FunctionResponse payload bytes and invocation
+// counts in contents, keyed by tool name.
+func toolResponseBytes(contents []*genai.Content) (bytes map[string]int, counts map[string]int) {
+	bytes = make(map[string]int)
+	counts = make(map[string]int)
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			name := part.FunctionResponse.Name
+			bytes[name] += len(fmt.Sprintf("%v", part.FunctionResponse.Response))
+			counts[name]++
+		}
+	}
+	return bytes, counts
+}
+
+// toolStatsTopN returns up to k tool names from stats ordered by their most
+// recent pre-compaction byte sample, descending — the tools currently
+// dominating context pressure.
+func toolStatsTopN(stats map[string]ToolStats, k int) []string {
+	type pair struct {
+		name  string
+		bytes int
+	}
+	pairs := make([]pair, 0, len(stats))
+	for name, st := range stats {
+		if len(st.BytesOverTime) == 0 {
+			continue
+		}
+		pairs = append(pairs, pair{name, st.BytesOverTime[len(st.BytesOverTime)-1]})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].bytes != pairs[j].bytes {
+			return pairs[i].bytes > pairs[j].bytes
+		}
+		return pairs[i].name < pairs[j].name
+	})
+	if k > len(pairs) {
+		k = len(pairs)
+	}
+	names := make([]string, k)
+	for i := 0; i < k; i++ {
+		names[i] = pairs[i].name
+	}
+	return names
+}
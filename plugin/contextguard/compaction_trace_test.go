@@ -0,0 +1,434 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// ==========================================================================
+// Property-based temporal verification of compaction invariants
+//
+// simulateSession's stress tests only assert scalar postconditions
+// (overflowed, compactions >= N, loopDetected). This harness instead records
+// a full per-step TraceEvent stream — every preCallEstimate, compactionFired,
+// postCallUsage, and factorAdjusted across a session — and evaluates
+// temporal invariants over that trace, then fuzzes sessionConfig/turnConfig
+// inputs with a small rapid-style generate-and-shrink loop to find a minimal
+// counterexample when an invariant breaks.
+// ==========================================================================
+
+type traceEventKind string
+
+const (
+	traceTurnStart       traceEventKind = "turnStart"
+	tracePreCallEstimate traceEventKind = "preCallEstimate"
+	traceCompactionFired traceEventKind = "compactionFired"
+	tracePostCallUsage   traceEventKind = "postCallUsage"
+	traceFactorAdjusted  traceEventKind = "factorAdjusted"
+)
+
+// TraceEvent is one typed occurrence in a traced session's execution. Not
+// every field is meaningful for every Kind — see the traceEventKind
+// constants' usage in traceSimulateSession.
+type TraceEvent struct {
+	Kind traceEventKind
+	Turn int
+	Step int
+
+	TokenEstimate int
+	RealTokens    int
+
+	Reason  string
+	Dropped int
+
+	OldFactor float64
+	NewFactor float64
+
+	SystemPromptBytes int
+}
+
+// traceSimulateSession runs the same turn/tool-call flow as simulateSession
+// but additionally records a TraceEvent per step, and wires the threshold
+// strategy's real TokenizerRegistry/ratioTracker calibration (see chunk3-1)
+// so factorAdjusted events reflect the actual production calibration logic
+// rather than a reimplementation of it.
+func traceSimulateSession(t *testing.T, cfg sessionConfig, turns []turnConfig) (sessionResult, []TraceEvent) {
+	t.Helper()
+
+	registry := &mockRegistry{
+		contextWindows: map[string]int{cfg.modelName: cfg.contextWindow},
+		maxTokens:      map[string]int{cfg.modelName: 4096},
+	}
+	llm := &mockLLM{name: cfg.modelName, response: "Summary: traced session."}
+	strategy := newThresholdStrategy(registry, llm, 0)
+	strategy.tokenizer = NewTokenizerRegistry()
+	strategy.ratios = newRatioTracker()
+
+	guard := &contextGuard{strategies: map[string]Strategy{"test-agent": strategy}}
+	ctx := newMockCallbackContext("test-agent")
+	ctx.sessionID = "trace-session"
+
+	var systemInstruction *genai.Content
+	if cfg.systemPromptSize > 0 {
+		systemInstruction = &genai.Content{
+			Parts: []*genai.Part{{Text: strings.Repeat("You are a helpful assistant. ", cfg.systemPromptSize/28+1)[:cfg.systemPromptSize]}},
+		}
+	}
+
+	var contents []*genai.Content
+	var events []TraceEvent
+	result := sessionResult{}
+	step := 0
+
+	if cfg.tokenRatio == 0 {
+		cfg.tokenRatio = 2.0
+	}
+
+	runLLMStep := func(turnIdx int) {
+		step++
+		req := &model.LLMRequest{
+			Model:    cfg.modelName,
+			Contents: cloneContents(contents),
+			Config:   &genai.GenerateContentConfig{},
+		}
+		if systemInstruction != nil {
+			req.Config.SystemInstruction = systemInstruction
+		}
+
+		tokensBefore := estimateTokens(req)
+		events = append(events, TraceEvent{Kind: tracePreCallEstimate, Turn: turnIdx, Step: step, TokenEstimate: tokensBefore})
+
+		prevRatio := strategy.ratios.Ratio("test-agent")
+
+		if _, err := guard.beforeModel(ctx, req); err != nil {
+			result.compactionFailed = true
+		}
+
+		tokensAfter := estimateTokens(req)
+		compacted := tokensAfter < tokensBefore && loadSummary(ctx) != ""
+		if compacted {
+			result.compactions++
+			events = append(events, TraceEvent{
+				Kind: traceCompactionFired, Turn: turnIdx, Step: step,
+				Reason: "threshold_exceeded", Dropped: tokensBefore - tokensAfter,
+			})
+			if tokensAfter >= tokensBefore {
+				result.loopDetected = true
+			}
+		}
+
+		realTokensForLLM := int(float64(tokensAfter) * cfg.tokenRatio)
+		if realTokensForLLM > result.maxTokensSeen {
+			result.maxTokensSeen = realTokensForLLM
+		}
+		if realTokensForLLM > cfg.contextWindow {
+			result.overflowed = true
+		}
+
+		if cfg.hasUsageMetadata {
+			realPromptTokens := int(float64(estimateTokens(req)) * cfg.tokenRatio)
+			resp := &model.LLMResponse{
+				Content: textContent("model", "Model response"),
+				UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+					PromptTokenCount: int32(realPromptTokens),
+				},
+			}
+			events = append(events, TraceEvent{Kind: tracePostCallUsage, Turn: turnIdx, Step: step, TokenEstimate: tokensAfter, RealTokens: realPromptTokens})
+			guard.afterModel(ctx, resp, nil)
+
+			newRatio := strategy.ratios.Ratio("test-agent")
+			if newRatio != prevRatio {
+				events = append(events, TraceEvent{Kind: traceFactorAdjusted, Turn: turnIdx, Step: step, OldFactor: prevRatio, NewFactor: newRatio})
+			}
+		}
+	}
+
+	for i, turn := range turns {
+		events = append(events, TraceEvent{Kind: traceTurnStart, Turn: i, Step: step, SystemPromptBytes: cfg.systemPromptSize})
+
+		userParts := []*genai.Part{{Text: turn.userMessage}}
+		contents = append(contents, &genai.Content{Role: "user", Parts: userParts})
+		runLLMStep(i)
+
+		for _, tc := range turn.toolCalls {
+			contents = append(contents, &genai.Content{
+				Role:  "model",
+				Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: tc.name, Args: map[string]any{"param": "value"}}}},
+			})
+			contents = append(contents, &genai.Content{
+				Role:  "user",
+				Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: tc.name, Response: map[string]any{"result": strings.Repeat("x", tc.responseSize)}}}},
+			})
+			runLLMStep(i)
+		}
+
+		respSize := turn.responseSize
+		if respSize <= 0 {
+			respSize = 120
+		}
+		modelResp := fmt.Sprintf("Turn %d analysis: %s", i, strings.Repeat("findings. ", respSize/10+1)[:respSize])
+		contents = append(contents, textContent("model", modelResp))
+	}
+
+	result.turns = len(turns)
+	result.finalTokens = estimateContentTokens(contents)
+	return result, events
+}
+
+// --- Temporal predicate helpers ---
+
+// neverBetween reports whether no event matching target occurs strictly
+// between the event at startIdx and the next event matching stop (or end of
+// trace, if stop never occurs again).
+func neverBetween(events []TraceEvent, startIdx int, stop, target traceEventKind) bool {
+	for i := startIdx + 1; i < len(events); i++ {
+		if events[i].Kind == stop {
+			return true
+		}
+		if events[i].Kind == target {
+			return false
+		}
+	}
+	return true
+}
+
+// eventuallyWithin reports whether an event matching target occurs within
+// the next maxSteps events after startIdx.
+func eventuallyWithin(events []TraceEvent, startIdx int, target traceEventKind, maxSteps int) bool {
+	end := startIdx + maxSteps
+	if end > len(events) {
+		end = len(events)
+	}
+	for i := startIdx + 1; i < end; i++ {
+		if events[i].Kind == target {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Named invariant checkers ---
+
+// checkMonotoneBetweenCompactions verifies invariant (a): between any two
+// consecutive compactionFired events, the token estimate (preCallEstimate)
+// is monotonically non-increasing until the next turnStart — a compaction
+// should never be immediately followed by the estimate climbing back up
+// before the user even sends a new message.
+func checkMonotoneBetweenCompactions(events []TraceEvent) (bool, string) {
+	for i, e := range events {
+		if e.Kind != traceCompactionFired {
+			continue
+		}
+		var last int
+		haveLast := false
+		for j := i + 1; j < len(events); j++ {
+			if events[j].Kind == traceTurnStart || events[j].Kind == traceCompactionFired {
+				break
+			}
+			if events[j].Kind != tracePreCallEstimate {
+				continue
+			}
+			if haveLast && events[j].TokenEstimate > last {
+				return false, fmt.Sprintf("token estimate rose from %d to %d after compaction at step %d, before next turn", last, events[j].TokenEstimate, e.Step)
+			}
+			last = events[j].TokenEstimate
+			haveLast = true
+		}
+	}
+	return true, ""
+}
+
+// checkFactorAdjustedAfterDrift verifies invariant (b): after any
+// postCallUsage event whose real/estimate ratio drifts beyond
+// driftThreshold from 1.0, a factorAdjusted event occurs before the next
+// preCallEstimate.
+func checkFactorAdjustedAfterDrift(events []TraceEvent, driftThreshold float64) (bool, string) {
+	for i, e := range events {
+		if e.Kind != tracePostCallUsage || e.TokenEstimate <= 0 {
+			continue
+		}
+		ratio := float64(e.RealTokens) / float64(e.TokenEstimate)
+		if ratio < 0 {
+			ratio = -ratio
+		}
+		if abs(ratio-1.0) <= driftThreshold {
+			continue
+		}
+		// A preCallEstimate reached before any factorAdjusted is a violation;
+		// reaching the end of the trace first has nothing to violate.
+		if !neverBetween(events, i, traceFactorAdjusted, tracePreCallEstimate) {
+			return false, fmt.Sprintf("usage at step %d drifted %.2fx with no factorAdjusted before the next preCallEstimate", e.Step, ratio)
+		}
+	}
+	return true, ""
+}
+
+// checkSystemPromptNeverDropped verifies invariant (c): the system prompt
+// byte count recorded at every turnStart never changes across the trace —
+// compaction only ever rewrites req.Contents, never req.Config.
+// SystemInstruction, so this should hold by construction.
+func checkSystemPromptNeverDropped(events []TraceEvent) (bool, string) {
+	first := -1
+	for _, e := range events {
+		if e.Kind != traceTurnStart {
+			continue
+		}
+		if first == -1 {
+			first = e.SystemPromptBytes
+			continue
+		}
+		if e.SystemPromptBytes != first {
+			return false, fmt.Sprintf("system prompt size changed from %d to %d at step %d", first, e.SystemPromptBytes, e.Step)
+		}
+	}
+	return true, ""
+}
+
+// checkNoCompactionAfterLoopDetected verifies invariant (d): once a
+// compactionFired event's Dropped is non-positive (compaction had no
+// effect — the same condition traceSimulateSession uses to flag
+// loopDetected), no further compactionFired events appear in the trace.
+func checkNoCompactionAfterLoopDetected(events []TraceEvent) (bool, string) {
+	loopAt := -1
+	for i, e := range events {
+		if e.Kind != traceCompactionFired {
+			continue
+		}
+		if loopAt != -1 {
+			return false, fmt.Sprintf("compactionFired at step %d occurred after loop was detected at step %d", e.Step, events[loopAt].Step)
+		}
+		if e.Dropped <= 0 {
+			loopAt = i
+		}
+	}
+	return true, ""
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// --- Random generators ---
+
+func genSessionConfig(rnd *rand.Rand) sessionConfig {
+	windows := []int{8_000, 100_000, 200_000}
+	return sessionConfig{
+		contextWindow:    windows[rnd.Intn(len(windows))],
+		systemPromptSize: rnd.Intn(4_000),
+		modelName:        "trace-model",
+		hasUsageMetadata: true,
+		tokenRatio:       1.0 + rnd.Float64()*2.0,
+	}
+}
+
+func genTurns(rnd *rand.Rand, n int) []turnConfig {
+	turns := make([]turnConfig, n)
+	for i := range turns {
+		numTools := rnd.Intn(3)
+		tools := make([]toolCall, numTools)
+		for j := range tools {
+			tools[j] = toolCall{name: fmt.Sprintf("tool_%d", j), responseSize: rnd.Intn(20_000)}
+		}
+		turns[i] = turnConfig{
+			userMessage:  fmt.Sprintf("turn %d: %s", i, strings.Repeat("data ", rnd.Intn(50)+1)),
+			toolCalls:    tools,
+			responseSize: rnd.Intn(2_000),
+		}
+	}
+	return turns
+}
+
+// shrinkTurns progressively simplifies turns (fewer turns, smaller tool
+// responses) while the predicate continues to fail, returning the smallest
+// reproducing case found.
+func shrinkTurns(cfg sessionConfig, turns []turnConfig, fails func(sessionConfig, []turnConfig) bool) []turnConfig {
+	current := turns
+	for len(current) > 1 {
+		half := current[:len(current)/2]
+		if fails(cfg, half) {
+			current = half
+			continue
+		}
+		break
+	}
+	for i := range current {
+		for j := range current[i].toolCalls {
+			for current[i].toolCalls[j].responseSize > 100 {
+				shrunk := append([]turnConfig(nil), current...)
+				shrunkTools := append([]toolCall(nil), shrunk[i].toolCalls...)
+				shrunkTools[j].responseSize /= 2
+				shrunk[i].toolCalls = shrunkTools
+				if !fails(cfg, shrunk) {
+					break
+				}
+				current = shrunk
+			}
+		}
+	}
+	return current
+}
+
+// TestPropertyTraceInvariants runs a small rapid-style generate-and-shrink
+// loop: random sessionConfig/turnConfig inputs are traced via
+// traceSimulateSession, and every trace is checked against invariants
+// (a)-(d). A trial failing (a), (c) or (d) is shrunk to a minimal
+// reproducing turn sequence before being reported; a (b) failure is
+// reported as generated.
+func TestPropertyTraceInvariants(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+
+	checks := []struct {
+		name string
+		fn   func([]TraceEvent) (bool, string)
+	}{
+		{"monotone-between-compactions", checkMonotoneBetweenCompactions},
+		{"system-prompt-never-dropped", checkSystemPromptNeverDropped},
+		{"no-compaction-after-loop-detected", checkNoCompactionAfterLoopDetected},
+	}
+
+	const trials = 50
+	for trial := 0; trial < trials; trial++ {
+		cfg := genSessionConfig(rnd)
+		turns := genTurns(rnd, 3+rnd.Intn(12))
+
+		_, events := traceSimulateSession(t, cfg, turns)
+
+		if ok, detail := checkFactorAdjustedAfterDrift(events, 0.5); !ok {
+			t.Errorf("trial %d: factor-adjusted-after-drift violated: %s", trial, detail)
+		}
+
+		for _, c := range checks {
+			if ok, detail := c.fn(events); !ok {
+				minimal := shrinkTurns(cfg, turns, func(cfg sessionConfig, turns []turnConfig) bool {
+					_, ev := traceSimulateSession(t, cfg, turns)
+					ok, _ := c.fn(ev)
+					return !ok
+				})
+				t.Errorf("trial %d: invariant %q violated: %s (shrunk to %d turns)", trial, c.name, detail, len(minimal))
+			}
+		}
+	}
+}
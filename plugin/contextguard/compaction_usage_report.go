@@ -0,0 +1,126 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// maxPendingHeuristics bounds how many not-yet-reported turns
+// pendingHeuristicTracker remembers. A provider that never calls
+// ReportUsage for some turns (or calls it with the wrong turnID) must not
+// let this grow without bound; the oldest pending turn is evicted first,
+// the same trade-off adaptiveStrategy's bounded reservoir makes.
+const maxPendingHeuristics = 1000
+
+// pendingHeuristic is one turn's recorded heuristic estimate, kept around
+// until ReportUsage arrives (possibly several turns and an arbitrary delay
+// later) to pair it with the real prompt token count.
+type pendingHeuristic struct {
+	agentID   string
+	heuristic int
+}
+
+// pendingHeuristicTracker lets a ContextGuard remember the heuristic token
+// estimate behind a turn by turn ID, so a provider that reports usage late
+// or out of order (common for streaming APIs and async billing endpoints)
+// can still be matched against the estimate that was actually in effect for
+// that turn, rather than whatever the latest turn happens to be.
+type pendingHeuristicTracker struct {
+	mu     sync.Mutex
+	byTurn map[string]pendingHeuristic
+	order  []string // turn IDs in insertion order, for bounded eviction
+}
+
+func newPendingHeuristicTracker() *pendingHeuristicTracker {
+	return &pendingHeuristicTracker{byTurn: make(map[string]pendingHeuristic)}
+}
+
+// Record remembers agentID's heuristic estimate for turnID, evicting the
+// oldest pending turn if the tracker is at capacity.
+func (p *pendingHeuristicTracker) Record(turnID, agentID string, heuristic int) {
+	if turnID == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.byTurn[turnID]; !exists {
+		p.order = append(p.order, turnID)
+	}
+	p.byTurn[turnID] = pendingHeuristic{agentID: agentID, heuristic: heuristic}
+
+	if len(p.order) > maxPendingHeuristics {
+		oldest := p.order[0]
+		p.order = p.order[1:]
+		delete(p.byTurn, oldest)
+	}
+}
+
+// Take removes and returns the pending heuristic for turnID, if any.
+func (p *pendingHeuristicTracker) Take(turnID string) (pendingHeuristic, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ph, ok := p.byTurn[turnID]
+	if !ok {
+		return pendingHeuristic{}, false
+	}
+	delete(p.byTurn, turnID)
+	for i, id := range p.order {
+		if id == turnID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+	return ph, true
+}
+
+// ReportUsage retroactively feeds a turn's real token counts into the
+// correction-factor learner, for providers (streaming APIs, async billing
+// endpoints) that report usage several turns late or out of order instead
+// of in-band with the response. turnID must match the agent.CallbackContext
+// InvocationID of the turn being reported; unknown or already-reported
+// turn IDs are ignored. completionTokens is accepted for symmetry with the
+// provider's usage report but only promptTokens feeds the ratio, since
+// that's what the heuristic estimates.
+//
+// Only agents registered with WithTokenizerRegistry learn from this — the
+// same gate afterModel's in-band calibration uses — since the default
+// len/4 heuristic has no ratioTracker to update.
+func (g *ContextGuard) ReportUsage(turnID string, promptTokens, completionTokens int) {
+	if g.pending == nil || g.ratios == nil {
+		return
+	}
+
+	ph, ok := g.pending.Take(turnID)
+	if !ok {
+		slog.Warn("ContextGuard: ReportUsage for unknown or already-reported turn", "turnID", turnID)
+		return
+	}
+
+	g.ratios.Observe(ph.agentID, ph.heuristic, promptTokens)
+
+	slog.Info("ContextGuard: late usage report applied",
+		"agent", ph.agentID,
+		"turnID", turnID,
+		"heuristic", ph.heuristic,
+		"promptTokens", promptTokens,
+		"completionTokens", completionTokens,
+		"learnedRatio", g.ratios.Ratio(ph.agentID),
+	)
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// queuedUsageReport is one simulated provider usage callback, scheduled to
+// be delivered a number of turns after the turn it actually describes —
+// modeling the streaming/async-billing providers ReportUsage exists for.
+type queuedUsageReport struct {
+	deliverAtTurn int
+	turnID        string
+	promptTokens  int
+}
+
+// TestReportUsage_LateAndOutOfOrderConverges drives a session where every
+// turn's real usage is reported 1-5 turns late, roughly half of them
+// out of order relative to each other, and asserts the learned ratio still
+// converges close to the true heuristic/real ratio — because
+// pendingHeuristicTracker pairs each report with the heuristic that was
+// actually in effect for its turn, not whichever turn is most recent.
+func TestReportUsage_LateAndOutOfOrderConverges(t *testing.T) {
+	const trueRatio = 2.4
+	const turns = 60
+
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"test-model": 1_000_000},
+		maxTokens:      map[string]int{"test-model": 4096},
+	}
+	llm := &mockLLM{name: "test-model", response: "Summary: usage report test."}
+
+	g := New(registry)
+	g.Add("test-agent", llm, WithTokenizerRegistry(NewTokenizerRegistry()))
+	guard := &contextGuard{strategies: g.strategies}
+
+	ctx := newMockCallbackContext("test-agent")
+	rng := rand.New(rand.NewSource(7))
+
+	var pending []queuedUsageReport
+	var contents []*genai.Content
+
+	for turn := 0; turn < turns; turn++ {
+		contents = append(contents,
+			textContent("user", fmt.Sprintf("message %d padding padding padding", turn)),
+			textContent("model", fmt.Sprintf("response %d padding padding padding", turn)),
+		)
+
+		ctx.invocationID = fmt.Sprintf("turn-%d", turn)
+		req := &model.LLMRequest{
+			Model:    "test-model",
+			Contents: contents,
+			Config:   &genai.GenerateContentConfig{},
+		}
+		heuristic := estimateTokens(req)
+		if _, err := guard.beforeModel(ctx, req); err != nil {
+			t.Fatalf("turn %d: beforeModel returned error: %v", turn, err)
+		}
+
+		realTokens := int(float64(heuristic) * trueRatio)
+		delay := 1 + rng.Intn(5)
+		pending = append(pending, queuedUsageReport{
+			deliverAtTurn: turn + delay,
+			turnID:        ctx.invocationID,
+			promptTokens:  realTokens,
+		})
+
+		// Shuffle delivery order for reports becoming due this turn, so
+		// roughly half the time two reports due on the same turn arrive
+		// in the opposite order their turns actually happened.
+		if rng.Intn(2) == 0 {
+			for i := len(pending) - 1; i > 0; i-- {
+				if pending[i].deliverAtTurn != pending[i-1].deliverAtTurn {
+					continue
+				}
+				pending[i], pending[i-1] = pending[i-1], pending[i]
+			}
+		}
+
+		remaining := pending[:0]
+		for _, r := range pending {
+			if r.deliverAtTurn > turn {
+				remaining = append(remaining, r)
+				continue
+			}
+			g.ReportUsage(r.turnID, r.promptTokens, r.promptTokens/2)
+		}
+		pending = remaining
+	}
+
+	// Drain whatever's left so the final ratio reflects every turn, not
+	// just the ones that happened to clear their delay before the loop
+	// ended.
+	for _, r := range pending {
+		g.ReportUsage(r.turnID, r.promptTokens, r.promptTokens/2)
+	}
+
+	got := g.ratios.Ratio("test-agent")
+	tolerance := trueRatio * 0.10
+	if got < trueRatio-tolerance || got > trueRatio+tolerance {
+		t.Errorf("learned ratio = %.3f, want within 10%% of %.3f", got, trueRatio)
+	}
+}
+
+// TestReportUsage_UnknownTurnIgnored confirms a turn ID that was never
+// recorded (e.g. a duplicate delivery, or a provider reporting on a turn
+// from a different agent) is dropped instead of corrupting the ratio.
+func TestReportUsage_UnknownTurnIgnored(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"test-model": 1_000_000},
+		maxTokens:      map[string]int{"test-model": 4096},
+	}
+	llm := &mockLLM{name: "test-model", response: "Summary."}
+
+	g := New(registry)
+	g.Add("test-agent", llm, WithTokenizerRegistry(NewTokenizerRegistry()))
+
+	before := g.ratios.Ratio("test-agent")
+	g.ReportUsage("no-such-turn", 500, 100)
+	after := g.ratios.Ratio("test-agent")
+
+	if before != after {
+		t.Errorf("ratio changed from unknown turnID: before=%.3f after=%.3f", before, after)
+	}
+}
+
+// TestReportUsage_WithoutTokenizerRegistryIsNoOp confirms an agent
+// registered without WithTokenizerRegistry (so it has no ratioTracker to
+// feed) ignores ReportUsage rather than panicking on the nil pending
+// tracker wiring.
+func TestReportUsage_WithoutTokenizerRegistryIsNoOp(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"test-model": 1_000_000},
+		maxTokens:      map[string]int{"test-model": 4096},
+	}
+	llm := &mockLLM{name: "test-model", response: "Summary."}
+
+	g := New(registry)
+	g.Add("test-agent", llm)
+	guard := &contextGuard{strategies: g.strategies}
+
+	ctx := newMockCallbackContext("test-agent")
+	ctx.invocationID = "turn-0"
+	req := &model.LLMRequest{
+		Model:    "test-model",
+		Contents: []*genai.Content{textContent("user", "hello")},
+		Config:   &genai.GenerateContentConfig{},
+	}
+	if _, err := guard.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel returned error: %v", err)
+	}
+
+	g.ReportUsage("turn-0", 100, 20)
+}
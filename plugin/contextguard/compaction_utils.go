@@ -19,7 +19,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"strings"
+	"time"
 
 	"google.golang.org/genai"
 
@@ -119,6 +121,87 @@ func persistContentsAtCompaction(ctx agent.CallbackContext, count int) {
 	}
 }
 
+// loadLastCompactionTime reads the wall-clock time of the last periodic
+// compaction from session state, stored as a Unix timestamp (seconds). The
+// second return value is false if no compaction has happened yet.
+func loadLastCompactionTime(ctx agent.CallbackContext) (time.Time, bool) {
+	key := stateKeyPrefixLastCompactionTime + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return time.Time{}, false
+	}
+	switch v := val.(type) {
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case float64:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// persistLastCompactionTime records when a periodic compaction ran, so the
+// next call can compute time.Since(last) against the configured interval.
+func persistLastCompactionTime(ctx agent.CallbackContext, when time.Time) {
+	key := stateKeyPrefixLastCompactionTime + ctx.AgentName()
+	if err := ctx.State().Set(key, when.Unix()); err != nil {
+		slog.Warn("ContextGuard: failed to persist last compaction time", "error", err)
+	}
+}
+
+// loadPrevWindowTokens reads the token estimate recorded for the previous
+// weighted-sliding-window period. Returns 0 if none has been recorded yet.
+func loadPrevWindowTokens(ctx agent.CallbackContext) int {
+	key := stateKeyPrefixPrevWindowTokens + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return 0
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// persistPrevWindowTokens records the token estimate for the previous
+// weighted-sliding-window period.
+func persistPrevWindowTokens(ctx agent.CallbackContext, tokens int) {
+	key := stateKeyPrefixPrevWindowTokens + ctx.AgentName()
+	if err := ctx.State().Set(key, tokens); err != nil {
+		slog.Warn("ContextGuard: failed to persist previous window tokens", "error", err)
+	}
+}
+
+// loadCurrWindowTokens reads the token estimate accumulated in the current
+// weighted-sliding-window period. Returns 0 if none has been recorded yet.
+func loadCurrWindowTokens(ctx agent.CallbackContext) int {
+	key := stateKeyPrefixCurrWindowTokens + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return 0
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// persistCurrWindowTokens records the token estimate accumulated in the
+// current weighted-sliding-window period.
+func persistCurrWindowTokens(ctx agent.CallbackContext, tokens int) {
+	key := stateKeyPrefixCurrWindowTokens + ctx.AgentName()
+	if err := ctx.State().Set(key, tokens); err != nil {
+		slog.Warn("ContextGuard: failed to persist current window tokens", "error", err)
+	}
+}
+
 // persistRealTokens writes the real token count from the provider to session
 // state. Called by the AfterModelCallback.
 func persistRealTokens(ctx agent.CallbackContext, tokens int) {
@@ -181,7 +264,9 @@ func loadLastHeuristic(ctx agent.CallbackContext) int {
 // resetCalibration clears the real token count and last heuristic from
 // session state. Called after compaction so the next turn starts fresh
 // instead of applying a stale correction factor derived from a much
-// larger pre-compaction request.
+// larger pre-compaction request. The running CalibrationState is left
+// alone — a compaction changes the size of the request, not the model's
+// real-vs-heuristic token ratio, so there's nothing to relearn.
 func resetCalibration(ctx agent.CallbackContext) {
 	keyReal := stateKeyPrefixRealTokens + ctx.AgentName()
 	keyHeuristic := stateKeyPrefixLastHeuristic + ctx.AgentName()
@@ -193,6 +278,347 @@ func resetCalibration(ctx agent.CallbackContext) {
 	}
 }
 
+// loadIncrementalCount reads how many consecutive incremental (extend,
+// don't rewrite) summarizations have run since the last full rewrite.
+// Returns 0 if not yet recorded, which also covers "never compacted" and
+// "last compaction was a full rewrite".
+func loadIncrementalCount(ctx agent.CallbackContext) int {
+	key := stateKeyPrefixIncrementalCount + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return 0
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// persistIncrementalCount writes the consecutive-incremental-summarization
+// counter SetIncrementalSummary's WithSummaryRewriteEvery check consults.
+func persistIncrementalCount(ctx agent.CallbackContext, count int) {
+	key := stateKeyPrefixIncrementalCount + ctx.AgentName()
+	if err := ctx.State().Set(key, count); err != nil {
+		slog.Warn("ContextGuard: failed to persist incremental summary count", "error", err)
+	}
+}
+
+// persistLastModel writes the model name of the request the current
+// heuristic was computed against, so the next AfterModelCallback can tell
+// whether a new (heuristic, real) sample still applies to the same model
+// CalibrationState is tracking, or whether the estimator needs to reset
+// first (see updateCalibrationState).
+func persistLastModel(ctx agent.CallbackContext, modelName string) {
+	key := stateKeyPrefixLastModel + ctx.AgentName()
+	if err := ctx.State().Set(key, modelName); err != nil {
+		slog.Warn("ContextGuard: failed to persist last model", "error", err)
+	}
+}
+
+// loadLastModel reads the model name persisted by persistLastModel.
+// Returns "" if none has been recorded yet.
+func loadLastModel(ctx agent.CallbackContext) string {
+	key := stateKeyPrefixLastModel + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return ""
+	}
+	s, _ := val.(string)
+	return s
+}
+
+// CalibrationState is the persisted, exponentially-weighted estimate of
+// the real/heuristic token ratio for one agent, maintained across turns so
+// tokenCount's timing-gap correction (see below) reflects a running mean
+// and variance instead of a single last-sample ratio, which chunk10-5
+// found brittle whenever the previous turn's content mix (mostly base64
+// vs. mostly prose) wasn't representative of the current one.
+type CalibrationState struct {
+	// Mean is the exponentially-weighted average of observed
+	// real/heuristic ratios, clamped to [calibrationMeanFloor,
+	// calibrationMeanCeil].
+	Mean float64
+
+	// Variance is the exponentially-weighted variance of observed ratios
+	// around Mean, used to widen the correction (Mean + k*stddev) when
+	// recent samples have been noisy.
+	Variance float64
+
+	// SampleCount is how many ratio samples have been folded into Mean and
+	// Variance since the last model-name reset.
+	SampleCount int
+
+	// ModelName is the model the current Mean/Variance were learned
+	// against. A new observation for a different model resets the
+	// estimator instead of blending across unrelated models.
+	ModelName string
+}
+
+// loadCalibrationState reads the versioned CalibrationState from session
+// state. If none has been recorded yet, it migrates the legacy
+// single-sample state (stateKeyPrefixRealTokens + stateKeyPrefixLastHeuristic)
+// into a one-sample CalibrationState so agents upgrading mid-session don't
+// lose the one data point they already had. Returns the zero
+// CalibrationState (SampleCount 0) if neither is present.
+func loadCalibrationState(ctx agent.CallbackContext) CalibrationState {
+	key := stateKeyPrefixCalibrationV2 + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err == nil && val != nil {
+		switch v := val.(type) {
+		case CalibrationState:
+			return v
+		case map[string]any:
+			return CalibrationState{
+				Mean:        floatFromAny(v["Mean"]),
+				Variance:    floatFromAny(v["Variance"]),
+				SampleCount: intFromAny(v["SampleCount"]),
+				ModelName:   fmt.Sprint(v["ModelName"]),
+			}
+		}
+	}
+
+	if real, heuristic := loadRealTokens(ctx), loadLastHeuristic(ctx); real > 0 && heuristic > 0 {
+		sample := clampFloat(float64(real)/float64(heuristic), calibrationMeanFloor, calibrationMeanCeil)
+		return CalibrationState{Mean: sample, SampleCount: 1, ModelName: loadLastModel(ctx)}
+	}
+	return CalibrationState{}
+}
+
+// persistCalibrationState writes state to session state under the
+// versioned calibration key. Errors are logged but not propagated.
+func persistCalibrationState(ctx agent.CallbackContext, state CalibrationState) {
+	key := stateKeyPrefixCalibrationV2 + ctx.AgentName()
+	if err := ctx.State().Set(key, state); err != nil {
+		slog.Warn("ContextGuard: failed to persist calibration state", "error", err)
+	}
+}
+
+// updateCalibrationState folds one new (heuristic, real) observation for
+// modelName into state, returning the updated estimator. If modelName
+// differs from state.ModelName (and both are non-empty), the estimator
+// resets first — a calibration learned against one model shouldn't bias
+// estimates for another. Mean is clamped to [calibrationMeanFloor,
+// calibrationMeanCeil] to survive a garbage sample (e.g. a provider
+// momentarily misreporting usage).
+func updateCalibrationState(state CalibrationState, modelName string, heuristic, real int) CalibrationState {
+	if heuristic <= 0 {
+		return state
+	}
+	if state.ModelName != "" && modelName != "" && state.ModelName != modelName {
+		state = CalibrationState{ModelName: modelName}
+	}
+	if state.ModelName == "" {
+		state.ModelName = modelName
+	}
+
+	sample := clampFloat(float64(real)/float64(heuristic), calibrationMeanFloor, calibrationMeanCeil)
+
+	if state.SampleCount == 0 {
+		state.Mean = sample
+		state.Variance = 0
+		state.SampleCount = 1
+		return state
+	}
+
+	delta := sample - state.Mean
+	state.Mean = clampFloat(state.Mean+calibrationEWMAAlpha*delta, calibrationMeanFloor, calibrationMeanCeil)
+	state.Variance = (1 - calibrationEWMAAlpha) * (state.Variance + calibrationEWMAAlpha*delta*delta)
+	state.SampleCount++
+	return state
+}
+
+// clampFloat restricts v to [min, max].
+func clampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// floatFromAny converts a JSON-deserialized numeric value (float64) or a
+// native int to float64, returning 0 for anything else. Mirrors
+// intFromAny for CalibrationState's map[string]any migration path.
+func floatFromAny(val any) float64 {
+	switch v := val.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// persistEscalationResult writes the escalating strategy's structured
+// outcome to session state. Errors are logged but not propagated.
+func persistEscalationResult(ctx agent.CallbackContext, result EscalationResult) {
+	key := stateKeyPrefixEscalation + ctx.AgentName()
+	if err := ctx.State().Set(key, result); err != nil {
+		slog.Warn("ContextGuard: failed to persist escalation result", "error", err)
+	}
+}
+
+// loadEscalationResult reads the escalating strategy's last outcome from
+// session state. Returns the zero EscalationResult if none has been
+// recorded yet. Supports both EscalationResult (same-process state) and the
+// map[string]any/[]any shapes a JSON round-trip through a real session
+// store would produce, following loadTodos' precedent.
+func loadEscalationResult(ctx agent.CallbackContext) EscalationResult {
+	key := stateKeyPrefixEscalation + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return EscalationResult{}
+	}
+
+	switch v := val.(type) {
+	case EscalationResult:
+		return v
+	case map[string]any:
+		result := EscalationResult{}
+		if fit, ok := v["fit"].(bool); ok {
+			result.Fit = fit
+		}
+		steps, _ := v["steps"].([]any)
+		for _, raw := range steps {
+			m, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			step := EscalationStepResult{}
+			if name, ok := m["name"].(string); ok {
+				step.Name = name
+			}
+			step.TokensBefore = intFromAny(m["tokensBefore"])
+			step.TokensAfter = intFromAny(m["tokensAfter"])
+			result.Steps = append(result.Steps, step)
+		}
+		return result
+	}
+	return EscalationResult{}
+}
+
+// intFromAny converts a JSON-deserialized numeric value (float64) or a
+// native int to int, returning 0 for anything else.
+func intFromAny(val any) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// loadDedupHashes reads the dedup hash -> first-seen-index map from session
+// state. Returns an empty (non-nil) map if none has been recorded yet.
+// Supports both map[string]int (same-process state) and the
+// map[string]any shape a JSON round-trip through a real session store
+// would produce.
+func loadDedupHashes(ctx agent.CallbackContext) map[string]int {
+	key := stateKeyPrefixDedupHashes + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return make(map[string]int)
+	}
+
+	switch v := val.(type) {
+	case map[string]int:
+		return v
+	case map[string]any:
+		hashes := make(map[string]int, len(v))
+		for hash, idx := range v {
+			hashes[hash] = intFromAny(idx)
+		}
+		return hashes
+	}
+	return make(map[string]int)
+}
+
+// persistDedupHashes writes the dedup hash -> first-seen-index map to
+// session state. Errors are logged but not propagated.
+func persistDedupHashes(ctx agent.CallbackContext, hashes map[string]int) {
+	key := stateKeyPrefixDedupHashes + ctx.AgentName()
+	if err := ctx.State().Set(key, hashes); err != nil {
+		slog.Warn("ContextGuard: failed to persist dedup hashes", "error", err)
+	}
+}
+
+// loadOversizedCache reads the per-oversized-payload-hash summary cache
+// from session state. Returns an empty (non-nil) map if none has been
+// recorded yet. Supports the map[string]any JSON-round-trip shape a real
+// session store would hand back, following loadDedupHashes' precedent.
+func loadOversizedCache(ctx agent.CallbackContext) map[string]string {
+	key := stateKeyPrefixOversizedCache + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return make(map[string]string)
+	}
+
+	switch v := val.(type) {
+	case map[string]string:
+		return v
+	case map[string]any:
+		cache := make(map[string]string, len(v))
+		for hash, summary := range v {
+			if s, ok := summary.(string); ok {
+				cache[hash] = s
+			}
+		}
+		return cache
+	}
+	return make(map[string]string)
+}
+
+// persistOversizedCache writes the oversized-payload hash -> summary cache
+// to session state. Errors are logged but not propagated.
+func persistOversizedCache(ctx agent.CallbackContext, cache map[string]string) {
+	key := stateKeyPrefixOversizedCache + ctx.AgentName()
+	if err := ctx.State().Set(key, cache); err != nil {
+		slog.Warn("ContextGuard: failed to persist oversized content cache", "error", err)
+	}
+}
+
+// loadChunkSummaryCache reads hierarchicalMapReduceStrategy's per-chunk
+// content-hash summary cache from session state. Returns an empty
+// (non-nil) map if none has been recorded yet. Follows loadOversizedCache's
+// precedent for tolerating the map[string]any JSON-round-trip shape a real
+// session store would hand back.
+func loadChunkSummaryCache(ctx agent.CallbackContext) map[string]string {
+	key := stateKeyPrefixChunkSummaryCache + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return make(map[string]string)
+	}
+
+	switch v := val.(type) {
+	case map[string]string:
+		return v
+	case map[string]any:
+		cache := make(map[string]string, len(v))
+		for hash, summary := range v {
+			if s, ok := summary.(string); ok {
+				cache[hash] = s
+			}
+		}
+		return cache
+	}
+	return make(map[string]string)
+}
+
+// persistChunkSummaryCache writes the chunk-content-hash -> summary cache
+// to session state. Errors are logged but not propagated.
+func persistChunkSummaryCache(ctx agent.CallbackContext, cache map[string]string) {
+	key := stateKeyPrefixChunkSummaryCache + ctx.AgentName()
+	if err := ctx.State().Set(key, cache); err != nil {
+		slog.Warn("ContextGuard: failed to persist chunk summary cache", "error", err)
+	}
+}
+
 // truncateForSummarizer trims the conversation contents so that the
 // summarization prompt itself doesn't exceed the summarizer LLM's context
 // window. It keeps the most recent messages (freshest context) and drops
@@ -212,20 +638,32 @@ func truncateForSummarizer(contents []*genai.Content, contextWindow int) []*gena
 }
 
 // tokenCount returns the best available token estimate for the current
-// request. It uses a calibrated heuristic to close the timing gap between
-// AfterModelCallback (where real tokens are recorded) and BeforeModelCallback
-// (where the check runs on a potentially larger request).
+// request, using tokenCountWithK with the default one-sigma safety margin.
+// See tokenCountWithK for the algorithm.
+func tokenCount(ctx agent.CallbackContext, req *model.LLMRequest) int {
+	return tokenCountWithK(ctx, req, defaultCalibrationKSigma)
+}
+
+// tokenCountWithK returns the best available token estimate for the
+// current request. It uses a calibrated heuristic to close the timing gap
+// between AfterModelCallback (where real tokens are recorded) and
+// BeforeModelCallback (where the check runs on a potentially larger
+// request).
 //
 // Algorithm:
 //  1. Compute the heuristic on the current request (reflects tool results
 //     added since the last LLM call).
-//  2. If we have both real tokens and a heuristic from the previous call,
-//     derive a correction factor and apply it to the current heuristic.
+//  2. If a CalibrationState has been learned for this agent, correct the
+//     current heuristic by (mean + k*stddev) of its observed
+//     real/heuristic ratio samples — a k-sigma safety margin above the
+//     average correction, so a single unrepresentative previous turn
+//     (e.g. mostly base64 tool output) can't anchor the whole estimate the
+//     way a single-sample ratio would.
 //  3. Return max(realTokens, calibratedHeuristic) so neither stale real
 //     tokens nor an inaccurate heuristic can cause an undercount.
-//  4. If no real tokens are available, fall back to the raw heuristic
+//  4. If no real tokens are available yet, fall back to the raw heuristic
 //     scaled by a conservative default factor.
-func tokenCount(ctx agent.CallbackContext, req *model.LLMRequest) int {
+func tokenCountWithK(ctx agent.CallbackContext, req *model.LLMRequest, k float64) int {
 	currentHeuristic := estimateTokens(req)
 	realTokens := loadRealTokens(ctx)
 
@@ -240,22 +678,15 @@ func tokenCount(ctx agent.CallbackContext, req *model.LLMRequest) int {
 		return result
 	}
 
-	lastHeuristic := loadLastHeuristic(ctx)
-	var calibrated int
+	state := loadCalibrationState(ctx)
 	var correction float64
-	if lastHeuristic > 0 {
-		correction = float64(realTokens) / float64(lastHeuristic)
-		if correction < 1.0 {
-			correction = 1.0
-		}
-		if correction > maxCorrectionFactor {
-			correction = maxCorrectionFactor
-		}
-		calibrated = int(float64(currentHeuristic) * correction)
+	if state.SampleCount > 0 {
+		correction = state.Mean + k*math.Sqrt(state.Variance)
+		correction = clampFloat(correction, 1.0, maxCorrectionFactor)
 	} else {
 		correction = defaultHeuristicCorrectionFactor
-		calibrated = int(float64(currentHeuristic) * correction)
 	}
+	calibrated := int(float64(currentHeuristic) * correction)
 
 	result := calibrated
 	if realTokens > calibrated {
@@ -266,7 +697,9 @@ func tokenCount(ctx agent.CallbackContext, req *model.LLMRequest) int {
 		"agent", ctx.AgentName(),
 		"heuristic", currentHeuristic,
 		"realTokens", realTokens,
-		"lastHeuristic", lastHeuristic,
+		"calibrationMean", fmt.Sprintf("%.2f", state.Mean),
+		"calibrationStddev", fmt.Sprintf("%.2f", math.Sqrt(state.Variance)),
+		"sampleCount", state.SampleCount,
 		"correction", fmt.Sprintf("%.2f", correction),
 		"calibrated", calibrated,
 		"result", result,
@@ -330,12 +763,166 @@ func loadTodos(ctx agent.CallbackContext) []TodoItem {
 //
 // When todos is non-empty, the todo list is appended to the summarization
 // prompt so it can be preserved across compaction boundaries.
-func summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem) (string, error) {
+//
+// summarize is the stable entry point every call site uses; see
+// summarizeStreaming for the streaming/cancellation/progress-reporting
+// implementation.
+func summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem, mustRetain ...string) (string, error) {
+	return summarizeStreaming(ctx, llm, contents, previousSummary, bufferTokens, todos, nil, mustRetain...)
+}
+
+// summarizeWithTemplate is summarize's template-aware variant: an empty
+// template behaves exactly like summarize; a non-empty one replaces
+// summarizeSystemPrompt as the system instruction, letting a caller (e.g.
+// MapReduceSummarizer's map/reduce phases) customize the summarizer's
+// wording per call site without affecting the package's default summarizer.
+// Unlike summarizeStreaming, this call isn't incremental: it's meant for the
+// hierarchical map-reduce phases, which already run many calls concurrently
+// rather than relying on one streamed response's progress.
+func summarizeWithTemplate(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem, template string, mustRetain ...string) (string, error) {
+	if template == "" {
+		return summarize(ctx, llm, contents, previousSummary, bufferTokens, todos, mustRetain...)
+	}
+
+	maxOutputTokens := int32(float64(bufferTokens) * 0.50)
+	maxWords := int(float64(maxOutputTokens) * 0.75)
+
+	systemPrompt := template + fmt.Sprintf("\n\nKeep the summary under %d words.", maxWords)
+	userPrompt := buildSummarizePrompt(contents, previousSummary, todos, false, mustRetain...)
+
+	req := &model.LLMRequest{
+		Model: llm.Name(),
+		Contents: []*genai.Content{
+			{
+				Role:  "user",
+				Parts: []*genai.Part{{Text: userPrompt}},
+			},
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{
+				Parts: []*genai.Part{{Text: systemPrompt}},
+			},
+			MaxOutputTokens: maxOutputTokens,
+		},
+	}
+
+	var result string
+	for resp, err := range llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return "", fmt.Errorf("summarization LLM call failed: %w", err)
+		}
+		if resp != nil && resp.Content != nil {
+			for _, part := range resp.Content.Parts {
+				if part != nil && part.Text != "" {
+					result += part.Text
+				}
+			}
+		}
+	}
+
+	if result == "" {
+		return buildFallbackSummary(contents, previousSummary), nil
+	}
+	return result, nil
+}
+
+// SummaryProgress is invoked with the best-effort partial summary text
+// accumulated so far, once per streamed response chunk, so a TUI can render
+// the summary as the summarizer LLM writes it. agentName is "" when ctx
+// isn't an agent.CallbackContext (e.g. the hierarchical map phase's
+// concurrent chunk summarization).
+type SummaryProgress func(agentName, partial string)
+
+// summarizeStreaming is summarize's implementation: it accumulates the LLM
+// response incrementally rather than blocking until the stream completes,
+// so a slow summarizer call (e.g. Claude Opus against a 200k window) can be
+// recovered from instead of losing everything.
+//
+// Each streamed chunk's running text is persisted to session state under
+// stateKeyPrefixSummaryDraft (when ctx is an agent.CallbackContext) and
+// handed to progress (when non-nil), then ctx.Done() is checked: if the
+// caller cancels mid-stream, the loop stops immediately and whatever text
+// had accumulated so far is returned as the summary, same as a clean finish.
+// Only an empty result (no text produced, by cancellation or otherwise)
+// falls back to buildFallbackSummary.
+func summarizeStreaming(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem, progress SummaryProgress, mustRetain ...string) (string, error) {
+	maxOutputTokens := int32(float64(bufferTokens) * 0.50)
+	maxWords := int(float64(maxOutputTokens) * 0.75)
+
+	systemPrompt := summarizeSystemPrompt + fmt.Sprintf("\n\nKeep the summary under %d words.", maxWords)
+	userPrompt := buildSummarizePrompt(contents, previousSummary, todos, false, mustRetain...)
+
+	req := &model.LLMRequest{
+		Model: llm.Name(),
+		Contents: []*genai.Content{
+			{
+				Role:  "user",
+				Parts: []*genai.Part{{Text: userPrompt}},
+			},
+		},
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{
+				Parts: []*genai.Part{{Text: systemPrompt}},
+			},
+			MaxOutputTokens: maxOutputTokens,
+		},
+	}
+
+	cbCtx, _ := ctx.(agent.CallbackContext)
+	agentName := ""
+	if cbCtx != nil {
+		agentName = cbCtx.AgentName()
+	}
+
+	var result string
+	for resp, err := range llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return "", fmt.Errorf("summarization LLM call failed: %w", err)
+		}
+		if resp != nil && resp.Content != nil {
+			for _, part := range resp.Content.Parts {
+				if part != nil && part.Text != "" {
+					result += part.Text
+				}
+			}
+		}
+
+		if cbCtx != nil {
+			persistSummaryDraft(cbCtx, result)
+		}
+		if progress != nil {
+			progress(agentName, result)
+		}
+
+		if ctx.Err() != nil {
+			slog.Info("ContextGuard: summarize cancelled mid-stream, using partial result",
+				"agent", agentName,
+				"partialLen", len(result),
+			)
+			break
+		}
+	}
+
+	if result == "" {
+		return buildFallbackSummary(contents, previousSummary), nil
+	}
+
+	return result, nil
+}
+
+// summarizeIncremental is summarizeStreaming's incremental counterpart (see
+// thresholdStrategy.SetIncrementalSummary): contents is expected to already
+// be just the delta since the last compaction, not the whole pre-split
+// history, and the prompt asks the LLM to extend previousSummary rather than
+// regenerate it wholesale. Streaming/draft-persistence/cancellation behavior
+// is identical to summarizeStreaming; a cancelled or empty result still
+// falls back to buildFallbackSummary, which folds previousSummary in as-is.
+func summarizeIncremental(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem, progress SummaryProgress, mustRetain ...string) (string, error) {
 	maxOutputTokens := int32(float64(bufferTokens) * 0.50)
 	maxWords := int(float64(maxOutputTokens) * 0.75)
 
 	systemPrompt := summarizeSystemPrompt + fmt.Sprintf("\n\nKeep the summary under %d words.", maxWords)
-	userPrompt := buildSummarizePrompt(contents, previousSummary, todos)
+	userPrompt := buildSummarizePrompt(contents, previousSummary, todos, true, mustRetain...)
 
 	req := &model.LLMRequest{
 		Model: llm.Name(),
@@ -353,6 +940,12 @@ func summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, pr
 		},
 	}
 
+	cbCtx, _ := ctx.(agent.CallbackContext)
+	agentName := ""
+	if cbCtx != nil {
+		agentName = cbCtx.AgentName()
+	}
+
 	var result string
 	for resp, err := range llm.GenerateContent(ctx, req, false) {
 		if err != nil {
@@ -365,6 +958,21 @@ func summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, pr
 				}
 			}
 		}
+
+		if cbCtx != nil {
+			persistSummaryDraft(cbCtx, result)
+		}
+		if progress != nil {
+			progress(agentName, result)
+		}
+
+		if ctx.Err() != nil {
+			slog.Info("ContextGuard: summarize cancelled mid-stream, using partial result",
+				"agent", agentName,
+				"partialLen", len(result),
+			)
+			break
+		}
 	}
 
 	if result == "" {
@@ -374,11 +982,43 @@ func summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, pr
 	return result, nil
 }
 
+// persistSummaryDraft records the best-effort partial summary text produced
+// so far by an in-flight summarizeStreaming call, so a mid-stream
+// cancellation or crash doesn't lose it — a caller (or a future retry) can
+// recover the latest draft via loadSummaryDraft instead of starting over.
+func persistSummaryDraft(ctx agent.CallbackContext, partial string) {
+	key := stateKeyPrefixSummaryDraft + ctx.AgentName()
+	if err := ctx.State().Set(key, partial); err != nil {
+		slog.Warn("ContextGuard: failed to persist summary draft", "error", err)
+	}
+}
+
+// loadSummaryDraft reads back the partial summary text persisted by
+// persistSummaryDraft, or "" if none has been recorded yet.
+func loadSummaryDraft(ctx agent.CallbackContext) string {
+	key := stateKeyPrefixSummaryDraft + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return ""
+	}
+	text, _ := val.(string)
+	return text
+}
+
 // buildSummarizePrompt assembles the user-facing prompt sent to the LLM for
 // summarization: a request to summarize, any previous summary for continuity,
 // a transcript of the conversation contents, and optionally the current todo
-// list for preservation.
-func buildSummarizePrompt(contents []*genai.Content, previousSummary string, todos []TodoItem) string {
+// list for preservation. incremental selects the instruction that accompanies
+// previousSummary: false (the default, full-rewrite mode) asks the LLM to
+// fold previousSummary and contents into one new summary; true (see
+// thresholdStrategy.SetIncrementalSummary) asks it to extend previousSummary
+// with only what's new in contents, leaving what it already covers alone —
+// appropriate when contents is just the delta since the last compaction
+// rather than the whole conversation. mustRetain is a Planner's
+// CompactionPlan.MustRetain facts, if any — each is rendered as a fact the
+// summary must explicitly keep even though its source messages are being
+// folded away.
+func buildSummarizePrompt(contents []*genai.Content, previousSummary string, todos []TodoItem, incremental bool, mustRetain ...string) string {
 	var sb strings.Builder
 	sb.WriteString("Provide a detailed summary of the following conversation.")
 	sb.WriteString("\n\n")
@@ -387,7 +1027,11 @@ func buildSummarizePrompt(contents []*genai.Content, previousSummary string, tod
 		sb.WriteString("[Previous summary for context]\n")
 		sb.WriteString(previousSummary)
 		sb.WriteString("\n[End previous summary]\n\n")
-		sb.WriteString("Incorporate the previous summary into your new summary, updating any information that has changed.\n\n")
+		if incremental {
+			sb.WriteString("Extend the previous summary with the new information below. Do not rewrite or restate what it already covers — produce the previous summary plus only what's new, as one continuous summary.\n\n")
+		} else {
+			sb.WriteString("Incorporate the previous summary into your new summary, updating any information that has changed.\n\n")
+		}
 	}
 
 	sb.WriteString("[Conversation to summarize]\n")
@@ -436,6 +1080,17 @@ func buildSummarizePrompt(contents []*genai.Content, previousSummary string, tod
 		sb.WriteString("Instruct the resuming assistant to restore them using the `todos` tool to continue tracking progress.\n")
 	}
 
+	if len(mustRetain) > 0 {
+		sb.WriteString("\n[Facts that must be preserved]\n")
+		for _, fact := range mustRetain {
+			sb.WriteString("- ")
+			sb.WriteString(fact)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("[End facts that must be preserved]\n\n")
+		sb.WriteString("Your summary MUST explicitly retain each of the facts above, even if this means being less thorough elsewhere.\n")
+	}
+
 	return sb.String()
 }
 
@@ -499,11 +1154,25 @@ func estimatePartTokens(part *genai.Part) int {
 	}
 	if part.InlineData != nil {
 		total += len(part.InlineData.MIMEType) / 4
-		total += len(part.InlineData.Data) / 4
+		total += len(part.InlineData.Data) / inlineDataBytesPerToken(part.InlineData.MIMEType)
 	}
 	return total
 }
 
+// inlineDataBytesPerToken returns the bytes-per-token divisor used to price
+// an InlineData blob by MIME type. True per-tile (image) or per-second
+// (audio) pricing would require decoding the blob's actual resolution or
+// duration, which isn't available from a raw byte count alone — this
+// approximates that intent with a coarser per-category rate instead.
+func inlineDataBytesPerToken(mimeType string) int {
+	if strings.HasPrefix(mimeType, "audio/") {
+		// Audio codecs pack far more raw bytes per unit of content a model
+		// actually attends to than text or images do.
+		return 16
+	}
+	return 4
+}
+
 // estimateTokens returns a rough token count for the entire LLM request
 // (contents + system instruction + tool definitions) using the ~4 chars per
 // token heuristic. Tool definitions (function declarations with their JSON
@@ -634,6 +1303,88 @@ func safeSplitIndex(contents []*genai.Content, idx int) int {
 		idx = len(contents) - 1
 	}
 
+	return alignSplitToolBoundaries(contents, idx)
+}
+
+// toolPairSpan is one matched [FunctionCall index, FunctionResponse index]
+// pair found by toolPairSpans. callIdx <= respIdx always, since a call must
+// precede the response it's answered by.
+type toolPairSpan struct {
+	callIdx int
+	respIdx int
+}
+
+// toolPairSpans scans contents for FunctionCall/FunctionResponse pairs,
+// matching each response to the oldest still-open call of the same name (a
+// FIFO per name) rather than requiring the two to sit at adjacent indices —
+// genai doesn't surface a call ID this package can rely on, so name is the
+// same identifier detectToolChain and dedupToolResponses already match
+// tool calls by. A response with no open call of that name (a pair already
+// split by an earlier compaction, or malformed input) is skipped.
+func toolPairSpans(contents []*genai.Content) []toolPairSpan {
+	pending := make(map[string][]int)
+	var spans []toolPairSpan
+
+	for i, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil {
+				continue
+			}
+			if part.FunctionCall != nil {
+				name := part.FunctionCall.Name
+				pending[name] = append(pending[name], i)
+			}
+			if part.FunctionResponse != nil {
+				name := part.FunctionResponse.Name
+				queue := pending[name]
+				if len(queue) == 0 {
+					continue
+				}
+				spans = append(spans, toolPairSpan{callIdx: queue[0], respIdx: i})
+				pending[name] = queue[1:]
+			}
+		}
+	}
+	return spans
+}
+
+// alignSplitToolBoundaries adjusts a candidate split index so no
+// FunctionCall/FunctionResponse pair ends up straddling it: contents[:idx]
+// is the region about to be summarized away, contents[idx:] is kept
+// verbatim, and a pair with its call evicted but its response kept (or
+// vice versa) leaves the kept region with an orphaned half of a pair most
+// model backends reject. Pairs are matched by name via toolPairSpans
+// rather than safeSplitIndex's positional walk, so this also catches pairs
+// that aren't immediately adjacent — parallel tool calls answered out of
+// order, or a call and response separated by an interleaved message.
+// Violations are resolved by sliding idx earlier (growing the kept region)
+// to the start of the offending call, which may surface further
+// violations with earlier pairs still evicted; this repeats until stable.
+func alignSplitToolBoundaries(contents []*genai.Content, idx int) int {
+	if idx <= 0 || idx >= len(contents) {
+		return idx
+	}
+
+	spans := toolPairSpans(contents)
+	for {
+		earliest := idx
+		for _, s := range spans {
+			if s.callIdx < earliest && s.respIdx >= earliest {
+				earliest = s.callIdx
+			}
+		}
+		if earliest == idx {
+			break
+		}
+		idx = earliest
+	}
+
+	if idx <= 0 {
+		idx = 1
+	}
 	return idx
 }
 
@@ -710,6 +1461,143 @@ func contentHasFunctionCall(c *genai.Content) bool {
 	return false
 }
 
+// trailingToolState returns the verbatim trailing entries of contents that
+// represent tool-call state a full summarization pass would otherwise
+// collapse into prose: either an in-flight FunctionCall (possibly several,
+// for a parallel tool call turn) with no FunctionResponse recorded yet, or
+// a FunctionResponse the model hasn't yet produced a turn consuming — kept
+// paired with the FunctionCall content that produced it when that's what
+// immediately precedes it. Returns nil if contents doesn't end in either
+// shape, meaning there's no structured tool state to lose beyond what the
+// prose summary already captures. See injectContinuationWithBuilder's
+// callers in compaction_strategy_threshold.go, which re-append this
+// verbatim after the continuation message.
+func trailingToolState(contents []*genai.Content) []*genai.Content {
+	n := len(contents)
+	if n == 0 {
+		return nil
+	}
+	last := contents[n-1]
+	if last == nil {
+		return nil
+	}
+
+	switch {
+	case last.Role == "model" && contentHasFunctionCall(last):
+		return []*genai.Content{last}
+	case last.Role == "user" && contentHasFunctionResponse(last):
+		if n >= 2 && contents[n-2] != nil && contents[n-2].Role == "model" && contentHasFunctionCall(contents[n-2]) {
+			return []*genai.Content{contents[n-2], last}
+		}
+		return []*genai.Content{last}
+	default:
+		return nil
+	}
+}
+
+// detectToolChain reports whether contents ends with a run of one or more
+// sequential [model:FunctionCall, user:FunctionResponse] pairs — the shape
+// ADK produces when a model chains tool calls one at a time within a
+// single unfinished turn (see TestBrutal_8k_SequentialToolChain). start is
+// the index of the first pair in that trailing run; ok is false if
+// contents doesn't end in a complete pair at all.
+func detectToolChain(contents []*genai.Content) (start int, ok bool) {
+	idx := len(contents)
+	for idx >= 2 {
+		call := contents[idx-2]
+		resp := contents[idx-1]
+		if call == nil || resp == nil {
+			break
+		}
+		if call.Role != "model" || !contentHasFunctionCall(call) {
+			break
+		}
+		if resp.Role != "user" || !contentHasFunctionResponse(resp) {
+			break
+		}
+		idx -= 2
+	}
+	if idx == len(contents) {
+		return 0, false
+	}
+	return idx, true
+}
+
+// reduceToolChain shrinks the FunctionResponse payload of every pair in the
+// chain starting at chainStart except the most recent policy.keepRecent
+// pairs, replacing it with a short stub built from policy.stubTemplate. The
+// FunctionCall/FunctionResponse entries themselves are left in place, so
+// tool_use/tool_result pairing is unaffected. Returns false if the chain
+// has no more than keepRecent pairs, so there is nothing to reduce.
+func reduceToolChain(contents []*genai.Content, chainStart int, policy chainCompactionPolicy) bool {
+	pairs := (len(contents) - chainStart) / 2
+	reducible := pairs - policy.keepRecent
+	if reducible <= 0 {
+		return false
+	}
+
+	changed := false
+	for i := 0; i < reducible; i++ {
+		resp := contents[chainStart+2*i+1]
+		if stubbedFunctionResponse(resp, i, policy.stubTemplate) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// projectedChainNextStepTokens estimates the token size of an in-flight
+// chain's next, not-yet-executed step from the rolling average of its
+// completed [FunctionCall, FunctionResponse] pairs starting at chainStart,
+// for thresholdStrategy's proactive mid-turn trigger (see
+// SetMidTurnChainCompaction). Returns 0 if the chain has no completed pairs
+// yet to average.
+func projectedChainNextStepTokens(contents []*genai.Content, chainStart int) int {
+	pairs := (len(contents) - chainStart) / 2
+	if pairs == 0 {
+		return 0
+	}
+	total := 0
+	for i := 0; i < pairs; i++ {
+		total += estimateContentTokens(contents[chainStart+2*i : chainStart+2*i+2])
+	}
+	return total / pairs
+}
+
+// stubbedFunctionResponse replaces c's FunctionResponse payload(s) with a
+// short stub, unless c was already stubbed by a previous reduceToolChain
+// call. Returns whether it changed anything.
+func stubbedFunctionResponse(c *genai.Content, step int, stubTemplate string) bool {
+	changed := false
+	for _, part := range c.Parts {
+		if part == nil || part.FunctionResponse == nil {
+			continue
+		}
+		if already, _ := part.FunctionResponse.Response[chainStubMarkerKey].(bool); already {
+			continue
+		}
+
+		rendered := fmt.Sprintf("%v", part.FunctionResponse.Response)
+		preview := rendered
+		if len(preview) > chainStubPreviewChars {
+			preview = preview[:chainStubPreviewChars]
+		}
+		part.FunctionResponse.Response = map[string]any{
+			"result":           fmt.Sprintf(stubTemplate, step, len(rendered), preview),
+			chainStubMarkerKey: true,
+		}
+		changed = true
+	}
+	return changed
+}
+
+// summaryInjectionPrefix marks a synthetic Content as holding an injected
+// summary rather than real conversation, both so injectSummary can detect
+// it's already run (idempotency) and so a caller that wants only the
+// genuine delta contents (see stripSummaryInjectionStub) can strip it back
+// out.
+const summaryInjectionPrefix = "[Previous conversation summary]"
+
 // injectSummary replaces events that were already summarized with the
 // summary content block. contentsAtCompaction is the number of Content
 // entries in req.Contents when the summary was produced. Events after
@@ -717,13 +1605,13 @@ func contentHasFunctionCall(c *genai.Content) bool {
 // If contentsAtCompaction is 0 or exceeds the current length, the summary
 // is simply prepended (first compaction or safety fallback).
 func injectSummary(req *model.LLMRequest, summary string, contentsAtCompaction int) {
-	summaryText := fmt.Sprintf("[Previous conversation summary]\n%s\n[End of summary — conversation continues below]", summary)
+	summaryText := fmt.Sprintf("%s\n%s\n[End of summary — conversation continues below]", summaryInjectionPrefix, summary)
 
 	if len(req.Contents) > 0 && req.Contents[0] != nil &&
 		req.Contents[0].Role == "user" && len(req.Contents[0].Parts) > 0 {
 		first := req.Contents[0]
 		if first.Parts[0] != nil && first.Parts[0].Text != "" &&
-			strings.HasPrefix(first.Parts[0].Text, "[Previous conversation summary]") {
+			strings.HasPrefix(first.Parts[0].Text, summaryInjectionPrefix) {
 			return
 		}
 	}
@@ -749,36 +1637,85 @@ func replaceSummary(req *model.LLMRequest, summary string, recentContents []*gen
 	summaryContent := &genai.Content{
 		Role: "user",
 		Parts: []*genai.Part{
-			{Text: fmt.Sprintf("[Previous conversation summary]\n%s\n[End of summary — conversation continues below]", summary)},
+			{Text: fmt.Sprintf("%s\n%s\n[End of summary — conversation continues below]", summaryInjectionPrefix, summary)},
 		},
 	}
 	req.Contents = append([]*genai.Content{summaryContent}, recentContents...)
 }
 
+// stripSummaryInjectionStub drops contents' leading entry if it's the
+// synthetic summary block injectSummary prepends, returning the genuine
+// delta contents underneath it unchanged otherwise. Used by incremental
+// summarization (see thresholdStrategy.SetIncrementalSummary), which already
+// receives the previous summary as its own argument and would otherwise
+// send it to the summarizer twice.
+func stripSummaryInjectionStub(contents []*genai.Content) []*genai.Content {
+	if len(contents) == 0 || contents[0] == nil || len(contents[0].Parts) == 0 {
+		return contents
+	}
+	first := contents[0].Parts[0]
+	if first != nil && strings.HasPrefix(first.Text, summaryInjectionPrefix) {
+		return contents[1:]
+	}
+	return contents
+}
+
+// mergePreservedTail combines CompactionHints' NoCompact preserved contents
+// with PreserveTail's split-based recent tail, deduplicating by pointer
+// identity since a NoCompact entry may already fall inside recent. preserved
+// entries are kept in their original relative order ahead of recent, so a
+// pinned early message still reads before the verbatim tail it precedes.
+func mergePreservedTail(preserved, recent []*genai.Content) []*genai.Content {
+	if len(preserved) == 0 {
+		return recent
+	}
+
+	inRecent := make(map[*genai.Content]bool, len(recent))
+	for _, c := range recent {
+		inRecent[c] = true
+	}
+
+	merged := make([]*genai.Content, 0, len(preserved)+len(recent))
+	for _, c := range preserved {
+		if !inRecent[c] {
+			merged = append(merged, c)
+		}
+	}
+	merged = append(merged, recent...)
+	return merged
+}
+
 // injectContinuation appends a continuation instruction to req.Contents so
 // the agent knows to resume work without re-asking the user. If userContent
 // is available, the original user request is included for reference.
+// injectContinuation appends the plain-English continuation nudge built from
+// defaultContinuationBuilder. Call sites that can supply richer context (the
+// summary, pending tool-call state, the agent's name/system prompt/locale,
+// or a per-agent ContinuationPromptBuilder override) should use
+// injectContinuationWithBuilder instead; this is a thin convenience wrapper
+// kept for call sites with only userContent on hand.
 func injectContinuation(req *model.LLMRequest, userContent *genai.Content) {
-	var text string
-	if userContent != nil {
-		for _, part := range userContent.Parts {
-			if part != nil && part.Text != "" {
-				text = part.Text
-				break
-			}
-		}
+	injectContinuationWithBuilder(req, ContinuationPromptData{UserRequest: userText(userContent)}, nil)
+}
+
+// injectContinuationWithBuilder appends the continuation message req.Contents
+// gets after a compaction, rendering it via builder (or defaultContinuationBuilder
+// when builder is nil) against data. This is the single template execution
+// path that replaced the package's former hard-coded fmt.Sprintf branches;
+// see ContinuationPromptBuilder and WithContinuationPromptBuilder.
+//
+// If rendering fails (a malformed custom template), the default English
+// builder is used instead so a misconfigured override degrades to a working
+// nudge rather than silently dropping the continuation message.
+func injectContinuationWithBuilder(req *model.LLMRequest, data ContinuationPromptData, builder ContinuationPromptBuilder) {
+	if builder == nil {
+		builder = defaultContinuationBuilder
 	}
 
-	var msg string
-	if text != "" {
-		msg = fmt.Sprintf(
-			"[System: The conversation was compacted because it exceeded the context window. "+
-				"The summary above contains all prior context. The user's current request is: `%s`. "+
-				"Continue working on this request without asking the user to repeat anything.]", text)
-	} else {
-		msg = "[System: The conversation was compacted because it exceeded the context window. " +
-			"The summary above contains all prior context. " +
-			"Continue working without asking the user to repeat anything.]"
+	msg, err := builder.Build(data)
+	if err != nil {
+		slog.Warn("ContextGuard: continuation prompt builder failed, using default template", "error", err)
+		msg, _ = defaultContinuationBuilder.Build(data)
 	}
 
 	req.Contents = append(req.Contents, &genai.Content{
@@ -786,3 +1723,17 @@ func injectContinuation(req *model.LLMRequest, userContent *genai.Content) {
 		Parts: []*genai.Part{{Text: msg}},
 	})
 }
+
+// userText extracts the first non-empty text part from userContent, or ""
+// if userContent is nil or has none.
+func userText(userContent *genai.Content) string {
+	if userContent == nil {
+		return ""
+	}
+	for _, part := range userContent.Parts {
+		if part != nil && part.Text != "" {
+			return part.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,295 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compactionbench runs a statistical A/B comparison of registered
+// contextguard strategies: the same randomized workload is replayed (via
+// simtest.Run) against each agent in turn, and the resulting per-trial
+// token-reduction and fit-rate samples are compared pairwise with a
+// Mann-Whitney U test (see MannWhitneyU). This turns "strategy X looks
+// better in the simulation table" into "strategy X reduces tokens
+// significantly more than strategy Y on this workload, p=0.002" — an
+// objective gate for reviewing a new strategy's simulation results.
+package compactionbench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/achetronic/adk-utils-go/plugin/contextguard"
+	"github.com/achetronic/adk-utils-go/plugin/contextguard/simtest"
+)
+
+// TrialConfig bounds the randomized scenario generator Compare uses to
+// produce each trial's workload.
+type TrialConfig struct {
+	// MinTurns and MaxTurns bound how many turns a generated scenario has.
+	MinTurns int
+	MaxTurns int
+
+	// MinToolResponseBytes and MaxToolResponseBytes bound each generated
+	// tool call's synthetic FunctionResponse payload size.
+	MinToolResponseBytes int
+	MaxToolResponseBytes int
+
+	// MaxToolCallsPerTurn bounds how many tool calls a single generated
+	// turn carries (0 to this value, inclusive).
+	MaxToolCallsPerTurn int
+
+	// ContextWindows is the set of context window sizes a trial's model is
+	// drawn from, uniformly at random, modeling real deployments that mix
+	// small local models with huge-context hosted ones.
+	ContextWindows []int
+}
+
+// DefaultTrialConfig returns sensible bounds modeling a tool-heavy agent
+// session: tens of turns, tool responses from small JSON replies to
+// multi-KB dumps, context windows spanning a small local model up to a
+// large hosted one.
+func DefaultTrialConfig() TrialConfig {
+	return TrialConfig{
+		MinTurns:             10,
+		MaxTurns:             60,
+		MinToolResponseBytes: 200,
+		MaxToolResponseBytes: 20_000,
+		MaxToolCallsPerTurn:  3,
+		ContextWindows:       []int{8_000, 32_000, 128_000, 200_000},
+	}
+}
+
+// StrategySample is one agent's (i.e. one strategy's) aggregated results
+// across all trials Compare ran.
+type StrategySample struct {
+	// AgentID identifies the strategy, matching the agentID Compare was
+	// given (and that was registered on the ContextGuard via Add).
+	AgentID string `json:"agentID"`
+
+	// TokenReductions holds one token-reduction ratio per trial (see
+	// tokenReduction): roughly "what fraction of the peak token count this
+	// strategy had shed by the end of the scenario."
+	TokenReductions []float64 `json:"tokenReductions"`
+
+	// FitRates holds one 0/1 value per trial: 1 if the scenario never
+	// overflowed its context window under this strategy, 0 otherwise.
+	FitRates []float64 `json:"fitRates"`
+
+	// GeoMeanReduction is the geometric mean of TokenReductions (via the
+	// (1+r) growth-rate convention, see geometricMeanGrowth), a single
+	// summary number robust to a handful of outlier trials.
+	GeoMeanReduction float64 `json:"geoMeanReduction"`
+
+	// MeanFitRate is the arithmetic mean of FitRates: the fraction of
+	// trials this strategy kept the conversation under budget.
+	MeanFitRate float64 `json:"meanFitRate"`
+}
+
+// PairComparison is the Mann-Whitney U comparison of two strategies'
+// samples from the same Compare run.
+type PairComparison struct {
+	StrategyA string `json:"strategyA"`
+	StrategyB string `json:"strategyB"`
+
+	// TokenReduction compares the two strategies' TokenReductions samples.
+	TokenReduction MannWhitneyResult `json:"tokenReduction"`
+
+	// FitRate compares the two strategies' FitRates samples.
+	FitRate MannWhitneyResult `json:"fitRate"`
+}
+
+// Report is Compare's machine-readable result, suitable for JSON-encoding
+// and also rendered by String as a human-readable table.
+type Report struct {
+	// Trials is the number of randomized scenarios each strategy was run
+	// against.
+	Trials int `json:"trials"`
+
+	// Samples holds one StrategySample per agentID Compare was given, in
+	// the same order.
+	Samples []StrategySample `json:"samples"`
+
+	// Comparisons holds one PairComparison per unordered pair of agentIDs.
+	Comparisons []PairComparison `json:"comparisons"`
+}
+
+// Compare runs trials randomized scenarios (generated from cfg, seeded by
+// seed for reproducibility) against every agentID in turn — all agentIDs
+// must already be registered on guard via ContextGuard.Add, typically each
+// with a different strategy — and returns the aggregated samples plus
+// pairwise Mann-Whitney U comparisons.
+//
+// The same sequence of randomized scenarios is replayed against every
+// agentID, so differences in the resulting samples reflect the strategies'
+// behavior rather than randomness in the workload generator.
+func Compare(guard *contextguard.ContextGuard, agentIDs []string, trials int, seed int64, cfg TrialConfig) (Report, error) {
+	rng := rand.New(rand.NewSource(seed))
+
+	samples := make(map[string]*StrategySample, len(agentIDs))
+	for _, id := range agentIDs {
+		samples[id] = &StrategySample{AgentID: id}
+	}
+
+	for t := 0; t < trials; t++ {
+		scenario := randomScenario(rng, cfg)
+
+		for _, id := range agentIDs {
+			trialScenario := scenario
+			trialScenario.AgentID = id
+
+			report, err := simtest.Run(guard, trialScenario)
+			if err != nil {
+				return Report{}, fmt.Errorf("compactionbench: trial %d, agent %q: %w", t, id, err)
+			}
+
+			fit := 0.0
+			if !report.Overflowed {
+				fit = 1.0
+			}
+
+			s := samples[id]
+			s.TokenReductions = append(s.TokenReductions, tokenReduction(report))
+			s.FitRates = append(s.FitRates, fit)
+		}
+	}
+
+	result := Report{Trials: trials}
+	for _, id := range agentIDs {
+		s := samples[id]
+		s.GeoMeanReduction = geometricMeanGrowth(s.TokenReductions)
+		s.MeanFitRate = mean(s.FitRates)
+		result.Samples = append(result.Samples, *s)
+	}
+
+	for i := 0; i < len(agentIDs); i++ {
+		for j := i + 1; j < len(agentIDs); j++ {
+			a, b := samples[agentIDs[i]], samples[agentIDs[j]]
+			result.Comparisons = append(result.Comparisons, PairComparison{
+				StrategyA:      a.AgentID,
+				StrategyB:      b.AgentID,
+				TokenReduction: MannWhitneyU(a.TokenReductions, b.TokenReductions),
+				FitRate:        MannWhitneyU(a.FitRates, b.FitRates),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// tokenReduction summarizes one simtest.Report as a single ratio: the
+// fraction of the scenario's peak token count (MaxTokensSeen) that had
+// been shed by the final turn's post-compaction estimate. A strategy that
+// never compacted scores ~0; one that aggressively summarizes everything
+// down scores close to 1.
+func tokenReduction(report simtest.Report) float64 {
+	if report.MaxTokensSeen == 0 || len(report.PerTurn) == 0 {
+		return 0
+	}
+	last := report.PerTurn[len(report.PerTurn)-1]
+	return 1 - float64(last.TokensAfter)/float64(report.MaxTokensSeen)
+}
+
+// geometricMeanGrowth computes the geometric mean of ratios under the
+// (1+r) "growth rate" convention, which — unlike a plain geometric mean —
+// tolerates negative ratios (a trial where the conversation ended up
+// larger than its peak, which a poorly-tuned strategy can produce).
+// Ratios at or below -1 are clamped, since log(1+r) is undefined there.
+func geometricMeanGrowth(ratios []float64) float64 {
+	if len(ratios) == 0 {
+		return 0
+	}
+	var sumLog float64
+	for _, r := range ratios {
+		sumLog += math.Log(1 + math.Max(r, -0.999999))
+	}
+	return math.Exp(sumLog/float64(len(ratios))) - 1
+}
+
+// mean returns the arithmetic mean of xs, or 0 for an empty slice.
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// randomScenario generates one randomized simtest.Scenario from cfg. The
+// returned scenario's AgentID is left blank; Compare sets it per-strategy
+// before replaying the same scenario against each agent.
+func randomScenario(rng *rand.Rand, cfg TrialConfig) simtest.Scenario {
+	turnCount := cfg.MinTurns + rng.Intn(cfg.MaxTurns-cfg.MinTurns+1)
+	contextWindow := cfg.ContextWindows[rng.Intn(len(cfg.ContextWindows))]
+
+	scenario := simtest.Scenario{
+		Model:         "compactionbench-model",
+		ContextWindow: contextWindow,
+		Turns:         make([]simtest.Turn, turnCount),
+	}
+
+	for i := range turnCount {
+		toolCallCount := rng.Intn(cfg.MaxToolCallsPerTurn + 1)
+		calls := make([]simtest.ToolCall, toolCallCount)
+		for j := range calls {
+			size := cfg.MinToolResponseBytes + rng.Intn(cfg.MaxToolResponseBytes-cfg.MinToolResponseBytes+1)
+			calls[j] = simtest.ToolCall{Name: fmt.Sprintf("tool_%d", j), ResponseBytes: size}
+		}
+		scenario.Turns[i] = simtest.Turn{
+			UserMessage: fmt.Sprintf("turn %d: please investigate", i),
+			ToolCalls:   calls,
+		}
+	}
+
+	return scenario
+}
+
+// String renders report as the human-readable table contributors read in
+// CI output: one row per strategy summarizing its geometric-mean reduction
+// and fit rate, followed by one row per pairwise comparison with its
+// p-values and a significance marker at p < 0.05.
+func (r Report) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "compactionbench: %d trials\n\n", r.Trials)
+	fmt.Fprintf(&b, "%-24s %16s %12s\n", "strategy", "geomean reduction", "fit rate")
+	for _, s := range r.Samples {
+		fmt.Fprintf(&b, "%-24s %15.1f%% %11.1f%%\n", s.AgentID, s.GeoMeanReduction*100, s.MeanFitRate*100)
+	}
+
+	if len(r.Comparisons) > 0 {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "%-16s %-16s %18s %18s\n", "strategy A", "strategy B", "reduction p-value", "fit-rate p-value")
+		for _, c := range r.Comparisons {
+			fmt.Fprintf(&b, "%-16s %-16s %17s %17s\n",
+				c.StrategyA, c.StrategyB,
+				significanceLabel(c.TokenReduction.PValue),
+				significanceLabel(c.FitRate.PValue),
+			)
+		}
+	}
+
+	return b.String()
+}
+
+// significanceLabel formats a p-value with a "*" marker when it's below the
+// conventional 0.05 significance threshold.
+func significanceLabel(p float64) string {
+	label := fmt.Sprintf("%.4f", p)
+	if p < 0.05 {
+		label += "*"
+	}
+	return label
+}
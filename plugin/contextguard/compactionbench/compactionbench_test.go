@@ -0,0 +1,134 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compactionbench
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+
+	"github.com/achetronic/adk-utils-go/plugin/contextguard"
+	"github.com/achetronic/adk-utils-go/plugin/contextguard/simtest"
+)
+
+// fakeRegistry is a minimal contextguard.ModelRegistry for tests in this
+// package, which can't reach contextguard's own unexported mockRegistry.
+type fakeRegistry struct{}
+
+func (fakeRegistry) ContextWindow(string) int    { return 32_000 }
+func (fakeRegistry) DefaultMaxTokens(string) int { return 2_048 }
+
+// fakeLLM is a minimal model.LLM that always "summarizes" by returning a
+// short fixed response, regardless of the request contents.
+type fakeLLM struct {
+	name string
+}
+
+func (l *fakeLLM) Name() string { return l.name }
+
+func (l *fakeLLM) GenerateContent(_ context.Context, _ *model.LLMRequest, _ bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(&model.LLMResponse{
+			Content: &genai.Content{
+				Role:  "model",
+				Parts: []*genai.Part{{Text: "summary"}},
+			},
+		}, nil)
+	}
+}
+
+func TestCompare_ReturnsSamplesAndComparisonsForEachAgent(t *testing.T) {
+	guard := contextguard.New(fakeRegistry{})
+	guard.Add("threshold-agent", &fakeLLM{name: "compactionbench-model"})
+	guard.Add("sliding-window-agent", &fakeLLM{name: "compactionbench-model"}, contextguard.WithSlidingWindow(10))
+
+	cfg := DefaultTrialConfig()
+	cfg.MinTurns, cfg.MaxTurns = 3, 5
+	cfg.MaxToolResponseBytes = 2_000
+
+	report, err := Compare(guard, []string{"threshold-agent", "sliding-window-agent"}, 5, 1, cfg)
+	if err != nil {
+		t.Fatalf("Compare() error: %v", err)
+	}
+
+	if report.Trials != 5 {
+		t.Errorf("Trials = %d, want 5", report.Trials)
+	}
+	if len(report.Samples) != 2 {
+		t.Fatalf("len(Samples) = %d, want 2", len(report.Samples))
+	}
+	for _, s := range report.Samples {
+		if len(s.TokenReductions) != 5 || len(s.FitRates) != 5 {
+			t.Errorf("agent %q: got %d token-reduction samples and %d fit-rate samples, want 5 each", s.AgentID, len(s.TokenReductions), len(s.FitRates))
+		}
+	}
+	if len(report.Comparisons) != 1 {
+		t.Fatalf("len(Comparisons) = %d, want 1 for two agents", len(report.Comparisons))
+	}
+
+	out := report.String()
+	if !strings.Contains(out, "threshold-agent") || !strings.Contains(out, "sliding-window-agent") {
+		t.Errorf("String() = %q, want it to mention both agent IDs", out)
+	}
+}
+
+func TestCompare_UnregisteredAgentErrors(t *testing.T) {
+	guard := contextguard.New(fakeRegistry{})
+	guard.Add("known-agent", &fakeLLM{name: "compactionbench-model"})
+
+	_, err := Compare(guard, []string{"known-agent", "unknown-agent"}, 1, 1, DefaultTrialConfig())
+	if err == nil {
+		t.Fatal("Compare() with an unregistered agent ID: got nil error, want a non-nil one")
+	}
+}
+
+func TestTokenReduction_ZeroWhenNoTurnsReported(t *testing.T) {
+	if got := tokenReduction(simtest.Report{}); got != 0 {
+		t.Errorf("tokenReduction(empty) = %v, want 0", got)
+	}
+}
+
+func TestGeometricMeanGrowth_EmptyIsZero(t *testing.T) {
+	if got := geometricMeanGrowth(nil); got != 0 {
+		t.Errorf("geometricMeanGrowth(nil) = %v, want 0", got)
+	}
+}
+
+func TestGeometricMeanGrowth_ToleratesNegativeRatios(t *testing.T) {
+	got := geometricMeanGrowth([]float64{-0.5, -0.5})
+	if got >= 0 {
+		t.Errorf("geometricMeanGrowth([-0.5, -0.5]) = %v, want a negative result", got)
+	}
+}
+
+func TestMean_EmptyIsZero(t *testing.T) {
+	if got := mean(nil); got != 0 {
+		t.Errorf("mean(nil) = %v, want 0", got)
+	}
+}
+
+func TestSignificanceLabel_MarksValuesBelowThreshold(t *testing.T) {
+	if got := significanceLabel(0.001); !strings.HasSuffix(got, "*") {
+		t.Errorf("significanceLabel(0.001) = %q, want a trailing '*'", got)
+	}
+	if got := significanceLabel(0.5); strings.HasSuffix(got, "*") {
+		t.Errorf("significanceLabel(0.5) = %q, want no trailing '*'", got)
+	}
+}
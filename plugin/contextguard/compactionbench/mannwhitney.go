@@ -0,0 +1,238 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compactionbench
+
+import (
+	"math"
+	"sort"
+)
+
+// maxExactMannWhitneyN is the largest combined sample size (nA + nB) for
+// which MannWhitneyU computes the exact permutation p-value. Above this,
+// and whenever the samples contain ties (which the exact recurrence below
+// doesn't account for), it falls back to the normal approximation.
+const maxExactMannWhitneyN = 40
+
+// MannWhitneyResult is the outcome of a two-sample Mann-Whitney U test
+// comparing sample A against sample B.
+type MannWhitneyResult struct {
+	// NA and NB are the two sample sizes.
+	NA int `json:"nA"`
+	NB int `json:"nB"`
+
+	// UA and UB are the U statistic from sample A's and sample B's
+	// perspective, respectively (UA + UB == NA*NB).
+	UA float64 `json:"uA"`
+	UB float64 `json:"uB"`
+
+	// Z is the normal-approximation z-score. Zero when Exact is true, since
+	// the exact method doesn't use it.
+	Z float64 `json:"z,omitempty"`
+
+	// PValue is the two-sided p-value: from the exact permutation
+	// distribution when Exact is true, otherwise the normal approximation.
+	PValue float64 `json:"pValue"`
+
+	// Exact is true if PValue came from the exact permutation distribution
+	// (small, tie-free samples) rather than the normal approximation.
+	Exact bool `json:"exact"`
+}
+
+// rankedValue is one observation tagged with which sample it came from, for
+// ranking the combined pooled sample.
+type rankedValue struct {
+	value float64
+	group int // 0 = sample A, 1 = sample B
+}
+
+// MannWhitneyU runs a two-sided Mann-Whitney U test comparing a against b.
+// U is computed from the rank sums of the pooled, sorted sample (ties
+// receive the average of the ranks they span). The p-value comes from the
+// exact permutation distribution when both samples are tie-free and their
+// combined size is at most maxExactMannWhitneyN; otherwise it falls back to
+// the continuity-corrected normal approximation, which is accurate once
+// nA and nB are each at least ~20.
+func MannWhitneyU(a, b []float64) MannWhitneyResult {
+	nA, nB := len(a), len(b)
+	result := MannWhitneyResult{NA: nA, NB: nB}
+	if nA == 0 || nB == 0 {
+		result.PValue = 1
+		return result
+	}
+
+	combined := make([]rankedValue, 0, nA+nB)
+	for _, v := range a {
+		combined = append(combined, rankedValue{value: v, group: 0})
+	}
+	for _, v := range b {
+		combined = append(combined, rankedValue{value: v, group: 1})
+	}
+
+	ranks, tied := assignRanks(combined)
+
+	var rankSumA float64
+	for i, rv := range combined {
+		if rv.group == 0 {
+			rankSumA += ranks[i]
+		}
+	}
+
+	uA := rankSumA - float64(nA*(nA+1))/2
+	uB := float64(nA*nB) - uA
+	result.UA = uA
+	result.UB = uB
+
+	if !tied && nA+nB <= maxExactMannWhitneyN {
+		result.PValue = exactMannWhitneyPValue(nA, nB, math.Min(uA, uB))
+		result.Exact = true
+		return result
+	}
+
+	meanU := float64(nA*nB) / 2
+	stdU := math.Sqrt(float64(nA*nB*(nA+nB+1)) / 12)
+	if stdU == 0 {
+		result.PValue = 1
+		return result
+	}
+
+	u := math.Min(uA, uB)
+	// Continuity correction: move u half a step toward the mean before
+	// standardizing, since U is discrete but the normal distribution isn't.
+	continuity := 0.5
+	if u > meanU {
+		continuity = -0.5
+	}
+	z := (u - meanU + continuity) / stdU
+	result.Z = z
+	result.PValue = 2 * normalCDF(-math.Abs(z))
+	if result.PValue > 1 {
+		result.PValue = 1
+	}
+	return result
+}
+
+// assignRanks returns the rank (1-based) of each element of combined in
+// sorted order, with tied values receiving the average of the ranks they
+// span, and whether any tie was found.
+func assignRanks(combined []rankedValue) ([]float64, bool) {
+	type indexedValue struct {
+		value float64
+		index int
+	}
+	sorted := make([]indexedValue, len(combined))
+	for i, rv := range combined {
+		sorted[i] = indexedValue{value: rv.value, index: i}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].value < sorted[j].value })
+
+	ranks := make([]float64, len(combined))
+	tied := false
+
+	i := 0
+	for i < len(sorted) {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1].value == sorted[i].value {
+			j++
+		}
+		if j > i {
+			tied = true
+		}
+		avgRank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[sorted[k].index] = avgRank
+		}
+		i = j + 1
+	}
+
+	return ranks, tied
+}
+
+// normalCDF returns the standard normal cumulative distribution function at
+// x, via the error function identity Φ(x) = (1 + erf(x/√2)) / 2.
+func normalCDF(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
+
+// exactMannWhitneyCounts memoizes the exact U-distribution recurrence
+// (countArrangements) across calls within a single MannWhitneyU invocation.
+// Keyed by (nA, nB, u); nA and nB are small enough in practice (bounded by
+// maxExactMannWhitneyN) that this stays cheap.
+type exactMannWhitneyCounts struct {
+	memo map[[3]int]float64
+}
+
+// countArrangements returns the number of ways to partition nA+nB ranked
+// (tie-free) observations into a group of size nA and a group of size nB
+// such that the resulting U statistic (from group A's perspective) equals
+// exactly u, via the standard recurrence
+//
+//	c(nA, nB, u) = c(nA-1, nB, u-nB) + c(nA, nB-1, u)
+//
+// with base cases c(0, nB, 0) = c(nA, 0, 0) = 1 and c(nA, nB, u) = 0 for
+// u < 0 or u > nA*nB.
+func (m *exactMannWhitneyCounts) countArrangements(nA, nB, u int) float64 {
+	if u < 0 || u > nA*nB {
+		return 0
+	}
+	if nA == 0 || nB == 0 {
+		if u == 0 {
+			return 1
+		}
+		return 0
+	}
+
+	key := [3]int{nA, nB, u}
+	if v, ok := m.memo[key]; ok {
+		return v
+	}
+
+	v := m.countArrangements(nA-1, nB, u-nB) + m.countArrangements(nA, nB-1, u)
+	m.memo[key] = v
+	return v
+}
+
+// exactMannWhitneyPValue computes the two-sided exact p-value for observing
+// a U statistic as extreme as u, under sample sizes nA and nB, by summing
+// the exact U distribution's tail probabilities and doubling the smaller
+// tail (capped at 1, since both tails can overlap at u's own point mass).
+func exactMannWhitneyPValue(nA, nB int, u float64) float64 {
+	counts := &exactMannWhitneyCounts{memo: make(map[[3]int]float64)}
+
+	maxU := nA * nB
+	total := 0.0
+	for uVal := 0; uVal <= maxU; uVal++ {
+		total += counts.countArrangements(nA, nB, uVal)
+	}
+	if total == 0 {
+		return 1
+	}
+
+	uFloor := int(math.Floor(u + 1e-9))
+
+	lowerTail := 0.0
+	for uVal := 0; uVal <= uFloor; uVal++ {
+		lowerTail += counts.countArrangements(nA, nB, uVal)
+	}
+	upperTail := 0.0
+	for uVal := maxU - uFloor; uVal <= maxU; uVal++ {
+		upperTail += counts.countArrangements(nA, nB, uVal)
+	}
+
+	pValue := 2 * math.Min(lowerTail, upperTail) / total
+	if pValue > 1 {
+		pValue = 1
+	}
+	return pValue
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compactionbench
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU_IdenticalSamplesNotSignificant(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	result := MannWhitneyU(a, b)
+	if result.PValue < 0.5 {
+		t.Errorf("PValue = %v, want a large p-value for identical samples", result.PValue)
+	}
+	if result.Exact {
+		t.Errorf("expected the normal approximation: identical samples tie on every value")
+	}
+}
+
+func TestMannWhitneyU_ClearlySeparatedSamplesAreSignificant(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []float64{101, 102, 103, 104, 105, 106, 107, 108}
+
+	result := MannWhitneyU(a, b)
+	if result.PValue >= 0.05 {
+		t.Errorf("PValue = %v, want < 0.05 for two completely non-overlapping samples", result.PValue)
+	}
+	if result.UA != 0 && result.UB != 0 {
+		t.Errorf("UA=%v UB=%v, want one of them to be 0 for completely separated samples", result.UA, result.UB)
+	}
+}
+
+func TestMannWhitneyU_TiesFallBackToNormalApproximation(t *testing.T) {
+	a := []float64{1, 1, 1, 2, 2, 2, 3, 3, 3, 4}
+	b := []float64{1, 1, 2, 2, 3, 3, 4, 4, 5, 5}
+
+	result := MannWhitneyU(a, b)
+	if result.Exact {
+		t.Errorf("expected tied samples to fall back to the normal approximation, not the exact method")
+	}
+	if math.IsNaN(result.PValue) || result.PValue < 0 || result.PValue > 1 {
+		t.Errorf("PValue = %v, want a value in [0, 1]", result.PValue)
+	}
+}
+
+func TestMannWhitneyU_LargeSamplesUseNormalApproximation(t *testing.T) {
+	a := make([]float64, 25)
+	b := make([]float64, 25)
+	for i := range a {
+		a[i] = float64(i)
+		b[i] = float64(i) + 0.5
+	}
+
+	result := MannWhitneyU(a, b)
+	if result.Exact {
+		t.Errorf("expected samples above maxExactMannWhitneyN to use the normal approximation")
+	}
+}
+
+func TestMannWhitneyU_EmptySampleReturnsPValueOne(t *testing.T) {
+	result := MannWhitneyU(nil, []float64{1, 2, 3})
+	if result.PValue != 1 {
+		t.Errorf("PValue = %v, want 1 for an empty sample", result.PValue)
+	}
+}
+
+func TestAssignRanks_AveragesTiedRanks(t *testing.T) {
+	combined := []rankedValue{
+		{value: 10, group: 0},
+		{value: 20, group: 1},
+		{value: 20, group: 0},
+		{value: 30, group: 1},
+	}
+
+	ranks, tied := assignRanks(combined)
+	if !tied {
+		t.Fatal("expected assignRanks to report a tie")
+	}
+	if ranks[0] != 1 {
+		t.Errorf("rank of 10 = %v, want 1", ranks[0])
+	}
+	if ranks[1] != 2.5 || ranks[2] != 2.5 {
+		t.Errorf("ranks of the tied 20s = %v, %v, want 2.5, 2.5", ranks[1], ranks[2])
+	}
+	if ranks[3] != 4 {
+		t.Errorf("rank of 30 = %v, want 4", ranks[3])
+	}
+}
+
+func TestExactMannWhitneyPValue_SymmetricAtMedianU(t *testing.T) {
+	// For nA = nB = 4, the maximum possible U is 16 and its distribution is
+	// symmetric around 8 — the p-value there should be 1 (every
+	// arrangement is at least as extreme as the median).
+	p := exactMannWhitneyPValue(4, 4, 8)
+	if p != 1 {
+		t.Errorf("exactMannWhitneyPValue(4, 4, 8) = %v, want 1", p)
+	}
+}
@@ -43,7 +43,15 @@
 package contextguard
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
@@ -60,12 +68,102 @@ const (
 	// StrategySlidingWindow selects the sliding-window strategy: summarization
 	// fires when the number of Content entries exceeds a configured limit.
 	StrategySlidingWindow = "sliding_window"
+
+	// StrategySummarization selects the summarization strategy: a
+	// high-water-mark strategy with an explicit recent-turn floor and
+	// optional tool-call-safe splitting. See WithSummarization.
+	StrategySummarization = "summarization"
+
+	// StrategyAdaptive selects the adaptive strategy: summarization fires at
+	// a threshold derived from the session's own observed token
+	// distribution rather than a single scalar cutoff. See
+	// WithAdaptiveThreshold.
+	StrategyAdaptive = "adaptive"
+
+	// StrategyPattern selects the pattern strategy: a Drain-style online
+	// log-clustering pass collapses repetitive historical tool responses
+	// into {template, occurrence_count, ...} records before falling back to
+	// the threshold strategy's usual summarization. See
+	// WithPatternCompaction.
+	StrategyPattern = "pattern"
+
+	// StrategyEscalating selects the escalating strategy: an ordered ladder
+	// of steps — tool-response reduction, two sliding-window passes, full
+	// threshold summarization, then hard truncation — tried in sequence
+	// until the request fits under the context window. See WithEscalation.
+	StrategyEscalating = "escalating"
+
+	// StrategyHierarchical selects the hierarchical strategy: compaction
+	// fires on turn count like sliding_window, but evicted turns are folded
+	// into a multi-level SummaryTree ledger instead of one flat summary —
+	// a level is promoted into a single "chapter" node one level up, and
+	// cleared, whenever its combined token estimate exceeds that level's
+	// budget. See WithHierarchical.
+	StrategyHierarchical = "hierarchical"
+
+	// StrategyPeriodic selects the periodic strategy: summarization fires
+	// when a configured wall-clock duration has elapsed since the last
+	// compaction, regardless of turn count, with a turn-count floor so an
+	// idle, nearly-empty conversation isn't summarized just because time
+	// passed. See WithPeriodicCompaction.
+	StrategyPeriodic = "periodic"
+
+	// StrategyWeightedSlidingWindow selects the weighted-sliding-window
+	// strategy: instead of sliding_window's hard turn-count cutoff, it
+	// blends a decaying share of the previous window's token count with the
+	// current window's, smoothing compaction behavior across window
+	// boundaries. See WithWeightedSlidingWindow.
+	StrategyWeightedSlidingWindow = "weighted_sliding_window"
+
+	// StrategyHierarchicalMapReduce selects the hierarchical-map-reduce
+	// strategy: like threshold, compaction fires once estimated token usage
+	// approaches the model's context window, but the pre-split contents are
+	// always summarized via the same bounded-concurrency chunk/reduce pass
+	// hierarchicalCompact uses for a single oversized turn, instead of one
+	// summarizer call over everything. See WithHierarchicalMapReduce.
+	StrategyHierarchicalMapReduce = "hierarchical_map_reduce"
+
+	// StrategySemantic selects the semantic strategy: like threshold,
+	// compaction fires once estimated token usage approaches the model's
+	// context window, but instead of a plain recency cut, older turns are
+	// ranked by cosine similarity of their embedding against the current
+	// user turn and the lowest-scoring ones are summarized away first,
+	// regardless of age. See WithSemanticCompaction.
+	StrategySemantic = "semantic"
 )
 
 const (
 	stateKeyPrefixSummary              = "__context_guard_summary_"
 	stateKeyPrefixSummarizedAt         = "__context_guard_summarized_at_"
 	stateKeyPrefixContentsAtCompaction = "__context_guard_contents_at_compaction_"
+	stateKeyPrefixRealTokens           = "__context_guard_real_tokens_"
+	stateKeyPrefixLastHeuristic        = "__context_guard_last_heuristic_"
+	stateKeyPrefixEscalation           = "__context_guard_escalation_"
+	stateKeyPrefixDedupHashes          = "__context_guard_dedup_hashes_"
+	stateKeyPrefixSummaryTree          = "__context_guard_summary_tree_"
+	stateKeyPrefixOversizedCache       = "__context_guard_oversized_cache_"
+	stateKeyPrefixCompactionTrace      = "__context_guard_compaction_trace_"
+	stateKeyPrefixLastModel            = "__context_guard_last_model_"
+	stateKeyPrefixSummaryDraft         = "__context_guard_summary_draft_"
+	stateKeyPrefixEmbeddingCache       = "__context_guard_embedding_cache_"
+	stateKeyPrefixSummaryDoc           = "__context_guard_summary_doc_"
+	stateKeyPrefixSummaryRef           = "__context_guard_summary_ref_"
+	stateKeyPrefixLastCompactionTime   = "__context_guard_last_compaction_time_"
+	stateKeyPrefixPrevWindowTokens     = "__context_guard_prev_window_tokens_"
+	stateKeyPrefixCurrWindowTokens     = "__context_guard_curr_window_tokens_"
+	stateKeyPrefixChunkSummaryCache    = "__context_guard_chunk_summary_cache_"
+	stateKeyPrefixCompactionHistory    = "__context_guard_compaction_history_"
+	stateKeyPrefixIncrementalCount     = "__context_guard_incremental_count_"
+	stateKeyPrefixNoCompactMarks       = "__context_guard_no_compact_marks_"
+	stateKeyPrefixCompactionCheckpoint = "__context_guard_compaction_checkpoint_"
+
+	// stateKeyPrefixCalibrationV2 is versioned (v2) because it replaces the
+	// single-sample (stateKeyPrefixLastHeuristic, stateKeyPrefixRealTokens)
+	// correction with a running (mean, variance, sample count) estimator —
+	// see CalibrationState. The distinct key lets loadCalibrationState tell
+	// a session with no calibration history yet apart from one it needs to
+	// migrate from the old single-sample state.
+	stateKeyPrefixCalibrationV2 = "__context_guard_calibration_v2_"
 
 	largeContextWindowThreshold = 200_000
 	largeContextWindowBuffer    = 20_000
@@ -75,10 +173,38 @@ const (
 	maxCompactionAttempts = 3
 )
 
+// defaultHeuristicCorrectionFactor is applied to the len/4 heuristic when no
+// real token count has been observed yet for an agent, compensating for the
+// heuristic's tendency to undercount against real provider tokenizers.
+// maxCorrectionFactor caps how far a calibrated or learned correction can
+// grow, so a single anomalous observation can't send future estimates wildly
+// high.
+const (
+	defaultHeuristicCorrectionFactor = 1.3
+	maxCorrectionFactor              = 4.0
+)
+
+// calibrationMeanFloor and calibrationMeanCeil bound CalibrationState.Mean,
+// so a handful of garbage samples (e.g. a provider briefly reporting
+// UsageMetadata for the wrong request) can't pin the estimator at an
+// unusable extreme. calibrationEWMAAlpha weights each new sample against
+// the running mean/variance, matching ratioTracker's ratioEWMAAlpha so the
+// two independent calibration mechanisms (in-process per-ContextGuard vs.
+// persisted per-session) settle at a comparable pace.
+const (
+	calibrationMeanFloor     = 0.5
+	calibrationMeanCeil      = 4.0
+	calibrationEWMAAlpha     = ratioEWMAAlpha
+	defaultCalibrationKSigma = 1.0
+)
+
 const defaultMaxTurns = 20
 
 // Strategy defines how a compaction algorithm decides whether and how to
-// compact conversation history before an LLM call.
+// compact conversation history before an LLM call. The built-in strategies
+// (threshold, sliding_window, and their siblings) all implement this; so
+// can custom strategies registered with RegisterStrategy and selected via
+// WithStrategy.
 type Strategy interface {
 	Name() string
 	Compact(ctx agent.CallbackContext, req *model.LLMRequest) error
@@ -88,9 +214,55 @@ type Strategy interface {
 type AgentOption func(*agentConfig)
 
 type agentConfig struct {
-	strategy  string
-	maxTurns  int
-	maxTokens int
+	strategy               string
+	strategyOptions        map[string]any
+	maxTurns               int
+	maxTokens              int
+	summarization          SummarizationOptions
+	tokenizerRegistry      *TokenizerRegistry
+	chain                  chainCompactionPolicy
+	overflow               *OverflowLimiter
+	hints                  CompactionHintFunc
+	thresholdOpts          ThresholdOptions
+	summaryStore           SummaryStore
+	reduceTools            bool
+	dedup                  bool
+	dedupNormalizer        DedupNormalizerFunc
+	hierarchical           bool
+	summaryTreeFanout      int
+	summaryLeafTokens      int
+	summaryMaxDepth        int
+	oversizedContent       bool
+	oversizedFraction      float64
+	onStalled              OnCompactionStalledFunc
+	hierarchicalBaseBudget int
+	memoryOffload          *memoryOffload
+	toolProfile            *toolProfile
+	summaryProgress        SummaryProgress
+	evictionStrategy       EvictionStrategy
+	structuredSummary      bool
+	summaryDocStore        SummaryDocStore
+	summarizer             Summarizer
+	continuationBuilder    ContinuationPromptBuilder
+	continuationLocale     string
+	continuationMode       ContinuationMode
+	observer               ThresholdCompactionObserver
+	tokenCounter           TokenCounter
+	periodicInterval       time.Duration
+	periodicMinTurns       int
+	batchLimit             int
+	batchSleepInterval     time.Duration
+	weightedWindowDuration time.Duration
+	weightedFraction       float64
+	weightedRecentKeep     int
+	mapReduceChunkTokens   int
+	mapReduceFanout        int
+	patternCompression     *toolResultPatternCompressionConfig
+	semanticEmbedder       Embedder
+	semanticKeepTokens     int
+	incrementalSummary     *bool
+	summaryRewriteEvery    int
+	planner                Planner
 }
 
 // WithSlidingWindow selects the sliding-window strategy with the given
@@ -102,6 +274,37 @@ func WithSlidingWindow(maxTurns int) AgentOption {
 	}
 }
 
+// WithPeriodicCompaction selects the periodic strategy: summarization fires
+// once interval has elapsed since the last compaction (or since the agent
+// was added, if none has run yet), regardless of turn count. minTurns is a
+// floor — Compact won't summarize a conversation with fewer than minTurns
+// Content entries even if interval has elapsed, so a long-idle-but-tiny
+// conversation isn't needlessly compacted.
+func WithPeriodicCompaction(interval time.Duration, minTurns int) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyPeriodic
+		c.periodicInterval = interval
+		c.periodicMinTurns = minTurns
+	}
+}
+
+// WithWeightedSlidingWindow selects the weighted-sliding-window strategy:
+// summarization fires once a weighted blend of the previous and current
+// window's token counts — effectiveTokens = prevWindowTokens*weight +
+// currWindowTokens, where weight decays from 1 to 0 as windowDuration
+// elapses since the last window rollover — exceeds fraction of the
+// model's context window. fraction <= 0 defaults to
+// defaultWeightedWindowFraction; recentKeep <= 0 defaults to
+// defaultWeightedRecentKeep.
+func WithWeightedSlidingWindow(windowDuration time.Duration, fraction float64, recentKeep int) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyWeightedSlidingWindow
+		c.weightedWindowDuration = windowDuration
+		c.weightedFraction = fraction
+		c.weightedRecentKeep = recentKeep
+	}
+}
+
 // WithMaxTokens sets a manual context window size override (in tokens).
 // Only used by the threshold strategy. When set, the ModelRegistry is
 // bypassed for this agent.
@@ -111,20 +314,668 @@ func WithMaxTokens(maxTokens int) AgentOption {
 	}
 }
 
+// WithSummarization selects the summarization strategy: when the token count
+// crosses opts.TargetTokens, the oldest turns (short of opts.KeepRecentTurns)
+// are replaced with a single summary message produced by opts.Summarizer
+// (defaulting to the llm passed to Add).
+func WithSummarization(opts SummarizationOptions) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategySummarization
+		c.summarization = opts
+	}
+}
+
+// WithAdaptiveThreshold selects the adaptive strategy: instead of a single
+// scalar threshold, the compaction trigger is derived from a bounded
+// reservoir of the session's own real PromptTokenCount observations (see
+// adaptiveStrategy). Only used by the adaptive strategy.
+func WithAdaptiveThreshold() AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyAdaptive
+	}
+}
+
+// WithTokenizerRegistry selects a provider-aware Tokenizer (resolved by
+// model name) for the threshold strategy's token estimate, instead of the
+// default len/4 heuristic. It also enables online ratio calibration: the
+// ContextGuard's AfterModelCallback compares this estimate against each
+// response's real PromptTokenCount and learns a per-agent correction factor
+// that's applied to subsequent estimates. Only used by the threshold
+// strategy.
+func WithTokenizerRegistry(registry *TokenizerRegistry) AgentOption {
+	return func(c *agentConfig) {
+		c.tokenizerRegistry = registry
+	}
+}
+
+// WithTokenizer is sugar over WithTokenizerRegistry for the common case of
+// a single Tokenizer (e.g. NewVertexTokenizer or NewTiktokenTokenizer)
+// handling every model this agent talks to. modelIDPrefix is registered as
+// tk's sole prefix match (see TokenizerRegistry.Register); pass "" to make
+// tk the registry's fallback for every model. Only used by the threshold
+// strategy.
+func WithTokenizer(modelIDPrefix string, tk Tokenizer) AgentOption {
+	return func(c *agentConfig) {
+		registry := NewTokenizerRegistry()
+		if modelIDPrefix == "" {
+			registry.fallback = tk
+		} else {
+			registry.Register(modelIDPrefix, tk)
+		}
+		c.tokenizerRegistry = registry
+	}
+}
+
+// WithChainCompactionPolicy enables the threshold strategy's in-flight
+// tool-chain reducer (see thresholdStrategy.SetChainCompactionPolicy) for
+// this agent: instead of summarizing the whole conversation whenever
+// req.Contents ends in a sequential tool-call chain, it keeps the most
+// recent keepRecent tool results verbatim and stubs older ones in that same
+// chain. stubTemplate may be empty to use the default. Only used by the
+// threshold strategy.
+func WithChainCompactionPolicy(keepRecent int, stubTemplate string) AgentOption {
+	return func(c *agentConfig) {
+		c.chain.keepRecent = keepRecent
+		c.chain.stubTemplate = stubTemplate
+	}
+}
+
+// WithMidTurnChainCompaction enables the in-flight tool-chain reducer's
+// proactive trigger (see thresholdStrategy.SetMidTurnChainCompaction):
+// instead of waiting for req.Contents to already exceed the threshold, the
+// reducer also fires as soon as the chain's projected next step — the
+// rolling average of its completed steps so far — would itself overflow
+// it. Must be combined with WithChainCompactionPolicy, which this has no
+// effect without. Only used by the threshold and pattern strategies.
+func WithMidTurnChainCompaction() AgentOption {
+	return func(c *agentConfig) {
+		c.chain.proactive = true
+	}
+}
+
+// WithPatternCompaction selects the pattern strategy: before falling back to
+// the threshold strategy's summarization, a Drain-style online
+// log-clustering pass (see PatternCompactor) replaces repetitive historical
+// tool responses — repeated kubectl_get_pods polling, repeated test runs —
+// with compact {template, occurrence_count, ...} records, so the number of
+// distinct response shapes dominates context growth rather than the number
+// of turns. Respects WithMaxTokens and WithTokenizerRegistry the same way
+// the threshold strategy does, since it wraps one as its fallback.
+func WithPatternCompaction() AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyPattern
+	}
+}
+
+// WithOverflowLimiter enables the threshold strategy's overflow limiter (see
+// OverflowLimiter and thresholdStrategy.SetOverflowLimiter) for this agent.
+// Only used by the threshold and pattern strategies.
+func WithOverflowLimiter(perSecondLimit, burstLimit float64, forcedKeys []string) AgentOption {
+	return func(c *agentConfig) {
+		c.overflow = NewOverflowLimiter(perSecondLimit, burstLimit, forcedKeys)
+	}
+}
+
+// WithCompactionHints enables per-Content CompactionHints (see
+// CompactionHints and thresholdStrategy.SetCompactionHints) for this agent:
+// fn classifies messages as pinned (NoCompact), forced-evict-by-age
+// (MustSummarize), or preferred-for-eviction (EvictFirst) ahead of the
+// strategy's normal size-based selection. Only used by the threshold and
+// pattern strategies.
+func WithCompactionHints(fn CompactionHintFunc) AgentOption {
+	return func(c *agentConfig) {
+		c.hints = fn
+	}
+}
+
+// WithOnCompactionStalled installs an escape hatch for when
+// compactPreserveTail's retry loop detects it has stopped making useful
+// progress (see CompactionStallEvent, OnCompactionStalledFunc). Without
+// one, a stalled retry loop simply uses its last (possibly over-budget)
+// attempt, matching prior behavior. Only used by the threshold and pattern
+// strategies, and only when ThresholdOptions.RetentionMode is PreserveTail.
+func WithOnCompactionStalled(fn OnCompactionStalledFunc) AgentOption {
+	return func(c *agentConfig) {
+		c.onStalled = fn
+	}
+}
+
+// WithSummaryProgress installs progress to receive the in-progress summary
+// text as the summarizer LLM streams its response (see SummaryProgress,
+// summarizeStreaming), so a TUI can render it live instead of the
+// BeforeModelCallback appearing to hang until the whole summary is ready.
+// Only used by the threshold and pattern strategies, and not when
+// SetSummarizationPool/WithSummarizationPool is also in effect — the pool's
+// own shared call path doesn't thread per-agent progress through.
+func WithSummaryProgress(progress SummaryProgress) AgentOption {
+	return func(c *agentConfig) {
+		c.summaryProgress = progress
+	}
+}
+
+// WithStructuredSummary switches Compact from storing a single flat
+// Markdown summary string to requesting a typed SummaryDoc from the
+// summarizer LLM (see summarizeStructured), so downstream consumers — an
+// "export session brief" command, another agent resuming the session —
+// can read structured fields instead of re-parsing Markdown section
+// headers. The rendered Markdown form (SummaryDoc.Render) is still what's
+// injected into the model.LLMRequest and fed back in as previousSummary, so
+// nothing else in the compaction pipeline needs to change. LoadSummaryDoc
+// reads it back, transparently migrating legacy flat-string summaries via
+// SummaryMigrator. Not incremental: SetSummaryProgress and
+// SetSummarizationPool have no effect while this is enabled. Only used by
+// the threshold and pattern strategies.
+func WithStructuredSummary() AgentOption {
+	return func(c *agentConfig) {
+		c.structuredSummary = true
+	}
+}
+
+// WithSummaryDocStore routes WithStructuredSummary's persisted SummaryDoc
+// through store (see SummaryDocStore, MemorySummaryDocStore,
+// FileSummaryDocStore, BlobSummaryDocStore) instead of inline session
+// state: session state then only keeps a short ref, so the full doc no
+// longer travels with every state read/write, and any other agent holding
+// the same ref against the same store can read it back via
+// ResolveSummaryDoc — e.g. a supervisor agent reading a sub-agent's
+// summary. Has no effect unless WithStructuredSummary is also set. Only
+// used by the threshold and pattern strategies.
+func WithSummaryDocStore(store SummaryDocStore) AgentOption {
+	return func(c *agentConfig) {
+		c.summaryDocStore = store
+	}
+}
+
+// WithSummarizer replaces the threshold strategy's default single-shot
+// summarizer with summarizer for every compaction, not just the internal
+// fallback used when a single turn would overflow the summarizer's own
+// context window (see hierarchicalCompact). Pass a *MapReduceSummarizer to
+// always chunk-and-reduce instead, with its own chunk size, target budget,
+// and prompt templates. Has no effect when WithStructuredSummary is also
+// set, since that path needs a typed JSON response. Only used by the
+// threshold and pattern strategies.
+func WithSummarizer(summarizer Summarizer) AgentOption {
+	return func(c *agentConfig) {
+		c.summarizer = summarizer
+	}
+}
+
+// WithContinuationPromptBuilder replaces the post-compaction continuation
+// message's default English template with builder — e.g. a
+// *TemplateContinuationPromptBuilder built via NewContinuationPromptBuilder
+// for a non-English locale, or NewContinuationPromptBuilderFromTemplate for
+// a fully custom one (a "coding" agent re-emphasizing file-editing
+// conventions instead of the generic "continue working" nudge). Only used by
+// the threshold and pattern strategies.
+func WithContinuationPromptBuilder(builder ContinuationPromptBuilder) AgentOption {
+	return func(c *agentConfig) {
+		c.continuationBuilder = builder
+	}
+}
+
+// WithContinuationLocale sets the Locale field threaded into every
+// ContinuationPromptData the threshold strategy builds, for a
+// ContinuationPromptBuilder whose own template branches on locale. Only used
+// by the threshold and pattern strategies.
+func WithContinuationLocale(locale string) AgentOption {
+	return func(c *agentConfig) {
+		c.continuationLocale = locale
+	}
+}
+
+// WithContinuationMode overrides how the threshold strategy resumes the
+// conversation after injecting a summary — appending a synthetic user turn,
+// resuming a truncated assistant turn verbatim, or (the default,
+// ContinuationModeAuto) detecting which applies from the trailing content's
+// finish reason and any unresolved tool call. Only used by the threshold and
+// pattern strategies.
+func WithContinuationMode(mode ContinuationMode) AgentOption {
+	return func(c *agentConfig) {
+		c.continuationMode = mode
+	}
+}
+
+// WithCompactionObserver registers a ThresholdCompactionObserver that
+// receives telemetry (pre/post token counts, summary length, elapsed time,
+// and whether a continuation was injected) for every compaction pass this
+// agent's threshold strategy runs. See ThresholdCompactionObserver,
+// NoopThresholdCompactionObserver, and OTelThresholdCompactionObserver. Only
+// used by the threshold and pattern strategies.
+func WithCompactionObserver(observer ThresholdCompactionObserver) AgentOption {
+	return func(c *agentConfig) {
+		c.observer = observer
+	}
+}
+
+// WithTokenCounter routes the threshold strategy's split-boundary decision
+// (compactPreserveTail's findSplitIndex call) through counter instead of
+// the package's fixed ~4-chars-per-token heuristic. See TokenCounter,
+// NewTiktokenTokenCounter, NewAnthropicTokenCounter. Only used by the
+// threshold and pattern strategies.
+func WithTokenCounter(counter TokenCounter) AgentOption {
+	return func(c *agentConfig) {
+		c.tokenCounter = counter
+	}
+}
+
+// WithThresholdOptions configures the threshold strategy's retention
+// behavior (see ThresholdOptions and thresholdStrategy.SetThresholdOptions)
+// for this agent — in particular, selecting RetentionMode: PreserveTail to
+// keep a verbatim recent tail instead of summarizing the whole conversation.
+// Only used by the threshold and pattern strategies.
+func WithThresholdOptions(opts ThresholdOptions) AgentOption {
+	return func(c *agentConfig) {
+		c.thresholdOpts = opts
+	}
+}
+
+// WithSummaryStore enables cross-restart/cross-replica persistence of the
+// running summary and calibration counters (see SummaryStore and
+// thresholdStrategy.SetSummaryStore) for this agent. Without it, the summary
+// lives only in the current process's session state and is lost whenever
+// the process handling the session changes. Only used by the threshold and
+// pattern strategies.
+func WithSummaryStore(store SummaryStore) AgentOption {
+	return func(c *agentConfig) {
+		c.summaryStore = store
+	}
+}
+
+// WithToolReducers enables the ToolReducer pass (see ToolReducer,
+// RegisterToolReducer, and the package's built-in kubectl/Prometheus/SQL
+// reducers) for this agent: recognized tool-response payloads older than
+// the most recent few turns are shrunk to a representative sample before
+// every token estimate, recovering tokens without an LLM call and without
+// losing the conversation's tool_use/tool_result structure. Used by the
+// sliding-window, threshold, and pattern strategies.
+func WithToolReducers() AgentOption {
+	return func(c *agentConfig) {
+		c.reduceTools = true
+	}
+}
+
+// WithDedupNormalizer enables content-hash deduplication (see
+// dedupToolResponses) for this agent: every FunctionResponse payload is
+// hashed after normalization, and the second and later occurrences of a
+// hash already seen (in this call's contents or a previous one, tracked
+// across compaction rounds) are replaced with a {"deduped_ref",
+// "first_seen_turn"} stub, leaving the first occurrence untouched.
+// normalizer may be nil to use defaultDedupNormalizer (RFC 3339 timestamp
+// stripping plus whitespace collapsing); pass a tool-specific normalizer
+// (e.g. one that also strips a kubectl resourceVersion field) to catch
+// near-duplicates the default would miss. Used by the sliding-window,
+// threshold, and pattern strategies.
+func WithDedupNormalizer(normalizer DedupNormalizerFunc) AgentOption {
+	return func(c *agentConfig) {
+		c.dedup = true
+		c.dedupNormalizer = normalizer
+	}
+}
+
+// WithBatchedSummarization enables map-reduce-style batched summarization
+// (see slidingWindowStrategy.SetBatching) for this agent: instead of one
+// LLM call over the entire evicted window, it's split into chunks of at
+// most batchLimit Content entries, each summarized with the previous
+// chunk's output fed in as existingSummary, with a pause of sleepInterval
+// between chunks to stay under provider TPM/RPM limits. batchLimit <= 0
+// disables batching (summarize the whole slice in one call, the default).
+// Only used by the sliding-window strategy.
+func WithBatchedSummarization(batchLimit int, sleepInterval time.Duration) AgentOption {
+	return func(c *agentConfig) {
+		c.batchLimit = batchLimit
+		c.batchSleepInterval = sleepInterval
+	}
+}
+
+// WithHierarchicalSummaries enables thresholdStrategy's rolling SummaryTree
+// (see SummaryTree and thresholdStrategy.SetHierarchicalSummaries) for this
+// agent, in place of a single flat summary string that grows unbounded as
+// more turns are folded in: each compaction adds one Level-0 node, and
+// levels are rolled up into the next whenever they exceed fanout nodes.
+// fanout <= 0 selects defaultSummaryTreeFanout. Only used by the threshold
+// and pattern strategies, and only under RetentionMode FullSummary (the
+// default) — has no effect under PreserveTail.
+func WithHierarchicalSummaries(fanout int) AgentOption {
+	return func(c *agentConfig) {
+		c.hierarchical = true
+		c.summaryTreeFanout = fanout
+	}
+}
+
+// WithHierarchicalSummary extends WithHierarchicalSummaries with two further
+// bounds on the SummaryTree it enables: leafTokens overrides the target
+// length of each Level-0 node (the summary of one just-evicted window) in
+// place of the buffer-derived default — useful for keeping leaves short and
+// uniform regardless of how large a buffer the surrounding compaction pass
+// happens to have. maxDepth caps how many levels the tree may grow to;
+// once the deepest allowed level itself overflows fanout, it's collapsed
+// into a single node in place rather than promoted further (see
+// SummaryTree.rollUp). leafTokens <= 0 and maxDepth <= 0 both fall back to
+// WithHierarchicalSummaries' unbounded behavior. Only used by the
+// threshold and pattern strategies, and only under RetentionMode
+// FullSummary.
+func WithHierarchicalSummary(fanout, leafTokens, maxDepth int) AgentOption {
+	return func(c *agentConfig) {
+		c.hierarchical = true
+		c.summaryTreeFanout = fanout
+		c.summaryLeafTokens = leafTokens
+		c.summaryMaxDepth = maxDepth
+	}
+}
+
+// WithOversizedContentSplitting enables thresholdStrategy's
+// summarizeOversizedParts pass (see SetOversizedContentSplitting): before
+// estimating tokens, any single part whose estimated size exceeds fraction
+// of the context window — a tool response of hundreds of thousands of
+// characters, the kind no single summarize call could ever fit — is
+// map-reduce-summarized down to a bounded size on its own, turning an
+// unbounded overflow into bounded, cached, log-scale work. fraction <= 0
+// selects defaultOversizedContentFraction. Only used by the threshold and
+// pattern strategies.
+func WithOversizedContentSplitting(fraction float64) AgentOption {
+	return func(c *agentConfig) {
+		c.oversizedContent = true
+		c.oversizedFraction = fraction
+	}
+}
+
+// WithEscalation selects the escalating strategy: instead of one compaction
+// pass, an ordered ladder of steps (tool-response reduction, a large-window
+// then small-window sliding-window pass, full threshold summarization, and
+// finally hard truncation of the oldest entries) runs in sequence, checking
+// after each step whether the request now fits under the context window and
+// stopping as soon as it does. Intended for workloads where a single
+// strategy alone can't reliably bring extreme conversations (bulk tool
+// storms, very long sessions) back under budget. Respects WithMaxTokens.
+func WithEscalation() AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyEscalating
+	}
+}
+
+// WithHierarchical selects the hierarchical strategy: like
+// WithSlidingWindow, compaction fires once more than maxTurns Content
+// entries have arrived since the last pass, but evicted turns are folded
+// into a multi-level SummaryTree ledger (see SummaryTree and
+// hierarchicalStrategy) instead of a single flat summary string that grows
+// unbounded across many compactions. baseBudget is the Level-0 token
+// budget past which a level is promoted into a single "chapter" node one
+// level up — budgets double at each level above it (see
+// SummaryTree.promoteByBudget) so higher levels compress more
+// aggressively. maxTurns <= 0 selects defaultMaxTurns; baseBudget <= 0
+// selects defaultHierarchicalBaseBudget.
+func WithHierarchical(maxTurns, baseBudget int) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyHierarchical
+		c.maxTurns = maxTurns
+		c.hierarchicalBaseBudget = baseBudget
+	}
+}
+
+// WithHierarchicalMapReduce selects the hierarchical-map-reduce strategy:
+// like the default threshold strategy, compaction fires once estimated
+// token usage approaches the model's context window, but the pre-split
+// contents are always partitioned into chunkTokens-sized chunks (never
+// splitting a FunctionCall/FunctionResponse pair, per
+// partitionByTokenBudget), summarized concurrently, then folded down to a
+// single summary by repeated reduce passes over groups of fanout
+// summaries at a time — the same hierarchicalCompact machinery the
+// threshold strategy only falls back to for a single oversized turn, used
+// unconditionally here instead. Each chunk's summary is cached in session
+// state keyed by a hash of its contents, so a later compaction over a
+// prefix whose chunks haven't changed reuses the cached summaries instead
+// of re-summarizing them. chunkTokens <= 0 selects
+// defaultChunkTokenBudget; fanout <= 0 selects reduceGroupSize.
+func WithHierarchicalMapReduce(chunkTokens, fanout int) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategyHierarchicalMapReduce
+		c.mapReduceChunkTokens = chunkTokens
+		c.mapReduceFanout = fanout
+	}
+}
+
+// WithSemanticCompaction selects the semantic strategy: compaction fires on
+// the same token-threshold trigger as the default threshold strategy, but
+// embedder scores every turn older than the verbatim recent tail by cosine
+// similarity against the current user turn (see semanticEvictionStrategy),
+// and only the lowest-scoring turns that don't fit within keepTokens are
+// summarized away — so a turn that's still relevant to the current task
+// survives even if it's older than turns that got evicted. Falls back to a
+// plain recency split if embedder returns an error. Distinct from
+// WithSemanticEviction, which plugs the same scoring logic into the
+// threshold strategy's PreserveTail retention mode instead of selecting its
+// own top-level strategy.
+func WithSemanticCompaction(embedder Embedder, keepTokens int) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = StrategySemantic
+		c.semanticEmbedder = embedder
+		c.semanticKeepTokens = keepTokens
+	}
+}
+
+// PatternCompressionOption configures WithToolResultPatternCompression.
+type PatternCompressionOption func(*toolResultPatternCompressionConfig)
+
+// WithPatternCompressionDepth overrides the Drain prefix depth (default
+// defaultPatternCompressionDepth) toolResultPatternCompressor buckets
+// candidate templates by before comparing token-position similarity.
+func WithPatternCompressionDepth(depth int) PatternCompressionOption {
+	return func(c *toolResultPatternCompressionConfig) {
+		c.depth = depth
+	}
+}
+
+// WithPatternCompressionSimilarity overrides the fraction of token
+// positions that must agree (or already be wildcarded) for a tool result to
+// merge into an existing cluster instead of starting a new one (default
+// defaultPatternCompressionSimilarity).
+func WithPatternCompressionSimilarity(threshold float64) PatternCompressionOption {
+	return func(c *toolResultPatternCompressionConfig) {
+		c.similarity = threshold
+	}
+}
+
+// WithPatternCompressionMinClusterSize overrides how many near-identical
+// tool-call/tool-result pairs a Drain template must accumulate before
+// toolResultPatternCompressor merges them into a single synthetic content
+// (default defaultPatternCompressionMinClusterSize).
+func WithPatternCompressionMinClusterSize(n int) PatternCompressionOption {
+	return func(c *toolResultPatternCompressionConfig) {
+		c.minClusterSize = n
+	}
+}
+
+// WithToolResultPatternCompression enables a pre-summarization compression
+// pass (see toolResultPatternCompressor) on the threshold and
+// sliding-window strategies: historical FunctionCall/FunctionResponse pairs
+// are clustered by a Drain-style parse tree, and every cluster that
+// accumulates enough near-identical members is merged into a single
+// synthetic content before the summarizer — or even the threshold/turn
+// check — ever sees them. This targets conversations dominated by
+// repetitive polling-style tool calls (kubectl get pods in a loop, repeated
+// health checks), where the number of distinct response shapes matters far
+// more than the number of times the model called the same tool.
+func WithToolResultPatternCompression(opts ...PatternCompressionOption) AgentOption {
+	return func(c *agentConfig) {
+		cfg := &toolResultPatternCompressionConfig{}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		c.patternCompression = cfg
+	}
+}
+
+// WithIncrementalSummary toggles thresholdStrategy's incremental
+// summarization (see thresholdStrategy.SetIncrementalSummary): when enabled
+// (the default) a RetentionMode FullSummary compaction that already has a
+// previous summary sends only the delta contents since the last compaction
+// to the summarizer, with an "extend, don't rewrite" instruction, instead of
+// re-summarizing the whole pre-split history every time. Pass false to
+// restore the old full-rewrite-every-time behavior. Has no effect under
+// RetentionMode PreserveTail, or when WithStructuredSummary, WithSummarizer,
+// or WithSummarizationPool is also configured. Only used by the threshold
+// and pattern strategies.
+func WithIncrementalSummary(enabled bool) AgentOption {
+	return func(c *agentConfig) {
+		c.incrementalSummary = &enabled
+	}
+}
+
+// WithSummaryRewriteEvery forces a full rewrite every n-th compaction
+// instead of extending incrementally (see WithIncrementalSummary), bounding
+// how far a running summary can drift from compounding incremental edits.
+// n <= 0 (the default) never forces one. Only used by the threshold and
+// pattern strategies.
+func WithSummaryRewriteEvery(n int) AgentOption {
+	return func(c *agentConfig) {
+		c.summaryRewriteEvery = n
+	}
+}
+
+// WithPlanner installs planner as the threshold strategy's sole source of
+// the old/recent/MustRetain decision for compactPreserveTail, replacing
+// its default recency/eviction-based thresholdPlanner. Use this to swap
+// in RecencyToolAwarePlanner, or a custom Planner implementation, without
+// reimplementing the summarize/rewrite/persist machinery thresholdStrategy
+// already provides.
+func WithPlanner(planner Planner) AgentOption {
+	return func(c *agentConfig) {
+		c.planner = planner
+	}
+}
+
+// WithMemoryOffload bridges this agent's compaction to long-term memory,
+// working alongside whatever strategy is otherwise selected: every Content
+// a Strategy evicts during compaction is persisted to service (tagged with
+// the session ID and a monotonically increasing turn number) instead of
+// being lost for good, and every call also searches service for the
+// memories closest to the latest user message and injects the top hits as
+// a short recall hint (see memoryOffload). This turns search_memory/
+// save_to_memory (tools/memory.Toolset) and ContextGuard into a coherent
+// short-term/long-term memory pipeline. service must implement AddSession
+// and Search the way google.golang.org/adk/memory.Service does.
+func WithMemoryOffload(service MemoryService, appName string) AgentOption {
+	return func(c *agentConfig) {
+		c.memoryOffload = &memoryOffload{service: service, appName: appName}
+	}
+}
+
+// WithToolProfile registers filter to prune req.Config.Tools on every
+// BeforeModelCallback for this agent, after its Strategy has run. name
+// identifies the profile in logging only (e.g. "post-summary"). A common
+// use is dropping MCP tools that weren't referenced in the turns still
+// present after compaction, since estimateToolTokens shows their
+// declarations can be a meaningful share of the request. Only one profile
+// per agent — a later WithToolProfile call replaces an earlier one.
+func WithToolProfile(name string, filter ToolFilter) AgentOption {
+	return func(c *agentConfig) {
+		c.toolProfile = &toolProfile{name: name, filter: filter}
+	}
+}
+
+// RecoveryHandler is invoked with the recovered panic value whenever a
+// Strategy's Compact method panics. It runs inside the deferred recover, so
+// it should be quick (log, emit a metric, report upstream) rather than doing
+// further work against ctx. Returning a non-nil error overrides the default
+// "recovered panic in strategy %q" error that is otherwise logged.
+type RecoveryHandler func(ctx context.Context, recovered any) error
+
+// Option configures global ContextGuard behavior, as opposed to AgentOption
+// which configures a single agent's strategy.
+type Option func(*ContextGuard)
+
+// WithRecovery wraps every strategy's Compact invocation in a defer/recover
+// that converts a panic (e.g. a bad tokenizer, nil model metadata from
+// CrushRegistry) and its stack trace into a returned error instead of
+// crashing the runner. The runner then continues serving the turn with the
+// pre-compaction context, the same way a regular Compact error is handled.
+// This mirrors the gRPC recovery-interceptor pattern.
+func WithRecovery(handler RecoveryHandler) Option {
+	return func(g *ContextGuard) {
+		g.recovery = handler
+	}
+}
+
+// WithCalibrationQuantile switches token-ratio calibration (see
+// WithTokenizerRegistry) from its default EWMA average to the given high
+// percentile (e.g. 0.9 for p90) of each agent's recent observed ratio
+// distribution. This trades some estimate tightness for headroom against
+// bimodal workloads — an agent that's mostly plain text with occasional
+// JSON-heavy tool responses won't have its worst turns averaged away.
+func WithCalibrationQuantile(q float64) Option {
+	return func(g *ContextGuard) {
+		g.ratios.SetCalibrationQuantile(q)
+	}
+}
+
+// WithToolResponseCap enforces a per-tool-name token cap on every
+// FunctionResponse payload (see ResponseCapPolicy and capToolResponse),
+// applied to every agent's request before its Strategy ever runs. A tool
+// response over its cap has its middle replaced with a stable truncation
+// marker, keeping a head and tail slice so the model still sees the
+// payload's schema and its terminal output. Use the key "*" for a default
+// cap applied to any tool with no specific entry.
+func WithToolResponseCap(policy map[string]int) Option {
+	return func(g *ContextGuard) {
+		g.capPolicy = ResponseCapPolicy(policy)
+	}
+}
+
+// WithSummarizationPool shares a single SummarizationPool across every
+// agent registered on this ContextGuard (see ContextGuard.Add), bounding
+// concurrent LLM summarize calls and deduplicating identical in-flight
+// requests across agents the same way ContextGuard.ratios already shares
+// calibration state. Only used by the threshold and pattern strategies.
+func WithSummarizationPool(pool *SummarizationPool) Option {
+	return func(g *ContextGuard) {
+		g.pool = pool
+	}
+}
+
+// WithMetrics installs store to record per-agent token and compaction
+// samples (see MetricsStore), making ContextGuard.Query available. Without
+// it, New creates a default MetricsStore anyway — recording never errors
+// out and costs little — so this option only matters when a caller wants
+// shared retention/bucket-width settings, or to share one MetricsStore
+// across more than one ContextGuard.
+func WithMetrics(store *MetricsStore) Option {
+	return func(g *ContextGuard) {
+		g.metrics = store
+	}
+}
+
 // ContextGuard accumulates per-agent strategies and produces a single
 // runner.PluginConfig. Use New to create one, Add to register agents,
 // and PluginConfig to get the final configuration.
 type ContextGuard struct {
-	registry   ModelRegistry
-	strategies map[string]Strategy
+	registry     ModelRegistry
+	strategies   map[string]Strategy
+	offloads     map[string]*memoryOffload
+	toolProfiles map[string]*toolProfile
+	recovery     RecoveryHandler
+	ratios       *ratioTracker
+	pending      *pendingHeuristicTracker
+	observer     CompactionObserver
+	capPolicy    ResponseCapPolicy
+	pool         *SummarizationPool
+	metrics      *MetricsStore
 }
 
 // New creates a ContextGuard backed by the given ModelRegistry.
-func New(registry ModelRegistry) *ContextGuard {
-	return &ContextGuard{
-		registry:   registry,
-		strategies: make(map[string]Strategy),
+func New(registry ModelRegistry, opts ...Option) *ContextGuard {
+	g := &ContextGuard{
+		registry:     registry,
+		strategies:   make(map[string]Strategy),
+		offloads:     make(map[string]*memoryOffload),
+		toolProfiles: make(map[string]*toolProfile),
+		ratios:       newRatioTracker(),
+		pending:      newPendingHeuristicTracker(),
+		metrics:      NewMetricsStore(0, 0),
 	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
 }
 
 // Add registers an agent with its LLM for summarization. Without options,
@@ -143,9 +994,237 @@ func (g *ContextGuard) Add(agentID string, llm model.LLM, opts ...AgentOption) {
 		if maxTurns <= 0 {
 			maxTurns = defaultMaxTurns
 		}
-		g.strategies[agentID] = newSlidingWindowStrategy(g.registry, llm, maxTurns)
+		sw := newSlidingWindowStrategy(g.registry, llm, maxTurns)
+		if cfg.reduceTools {
+			sw.SetToolReducers(true)
+		}
+		if cfg.dedup {
+			sw.SetDedup(cfg.dedupNormalizer)
+		}
+		if cfg.batchLimit > 0 || cfg.batchSleepInterval > 0 {
+			sw.SetBatching(cfg.batchLimit, cfg.batchSleepInterval)
+		}
+		if cfg.patternCompression != nil {
+			sw.SetToolResultPatternCompression(*cfg.patternCompression)
+		}
+		g.strategies[agentID] = sw
+	case StrategySummarization:
+		g.strategies[agentID] = newSummarizationStrategy(g.registry, llm, cfg.summarization)
+	case StrategyAdaptive:
+		g.strategies[agentID] = newAdaptiveStrategy(g.registry, llm, cfg.maxTokens)
+	case StrategyEscalating:
+		g.strategies[agentID] = newEscalatingStrategy(g.registry, llm, cfg.maxTokens)
+	case StrategyHierarchical:
+		g.strategies[agentID] = newHierarchicalStrategy(g.registry, llm, cfg.maxTurns, cfg.hierarchicalBaseBudget)
+	case StrategyHierarchicalMapReduce:
+		g.strategies[agentID] = newHierarchicalMapReduceStrategy(g.registry, llm, cfg.mapReduceChunkTokens, cfg.mapReduceFanout)
+	case StrategySemantic:
+		g.strategies[agentID] = newSemanticStrategy(g.registry, llm, cfg.semanticEmbedder, cfg.semanticKeepTokens)
+	case StrategyPeriodic:
+		g.strategies[agentID] = newPeriodicStrategy(g.registry, llm, cfg.periodicInterval, cfg.periodicMinTurns)
+	case StrategyWeightedSlidingWindow:
+		g.strategies[agentID] = newWeightedSlidingWindowStrategy(g.registry, llm, cfg.weightedWindowDuration, cfg.weightedFraction, cfg.weightedRecentKeep)
+	case StrategyPattern:
+		ts := newThresholdStrategy(g.registry, llm, cfg.maxTokens)
+		if tokenizerRegistry := resolveTokenizerRegistry(g.registry, cfg.tokenizerRegistry); tokenizerRegistry != nil {
+			ts.tokenizer = tokenizerRegistry
+			ts.ratios = g.ratios
+			ts.pending = g.pending
+		}
+		if cfg.chain.keepRecent > 0 {
+			ts.SetChainCompactionPolicy(cfg.chain.keepRecent, cfg.chain.stubTemplate)
+			if cfg.chain.proactive {
+				ts.SetMidTurnChainCompaction(true)
+			}
+		}
+		if cfg.overflow != nil {
+			ts.SetOverflowLimiter(cfg.overflow)
+		}
+		if cfg.hints != nil {
+			ts.SetCompactionHints(cfg.hints)
+		}
+		ts.SetThresholdOptions(cfg.thresholdOpts)
+		if cfg.summaryStore != nil {
+			ts.SetSummaryStore(cfg.summaryStore)
+		}
+		if cfg.reduceTools {
+			ts.SetToolReducers(true)
+		}
+		if cfg.dedup {
+			ts.SetDedup(cfg.dedupNormalizer)
+		}
+		if cfg.hierarchical {
+			ts.SetHierarchicalSummaries(cfg.summaryTreeFanout)
+			if cfg.summaryLeafTokens != 0 || cfg.summaryMaxDepth != 0 {
+				ts.SetHierarchicalSummaryLimits(cfg.summaryLeafTokens, cfg.summaryMaxDepth)
+			}
+		}
+		if cfg.oversizedContent {
+			ts.SetOversizedContentSplitting(cfg.oversizedFraction)
+		}
+		if g.pool != nil {
+			ts.SetSummarizationPool(g.pool)
+		}
+		if cfg.onStalled != nil {
+			ts.SetOnCompactionStalled(cfg.onStalled)
+		}
+		if cfg.summaryProgress != nil {
+			ts.SetSummaryProgress(cfg.summaryProgress)
+		}
+		if cfg.evictionStrategy != nil {
+			ts.SetEvictionStrategy(cfg.evictionStrategy)
+		}
+		if cfg.planner != nil {
+			ts.SetPlanner(cfg.planner)
+		}
+		if cfg.structuredSummary {
+			ts.SetStructuredSummary(true)
+		}
+		if cfg.summaryDocStore != nil {
+			ts.SetSummaryDocStore(cfg.summaryDocStore)
+		}
+		if cfg.summarizer != nil {
+			ts.SetSummarizer(cfg.summarizer)
+		}
+		if cfg.continuationBuilder != nil {
+			ts.SetContinuationPromptBuilder(cfg.continuationBuilder)
+		}
+		if cfg.continuationLocale != "" {
+			ts.SetContinuationLocale(cfg.continuationLocale)
+		}
+		if cfg.continuationMode != "" {
+			ts.SetContinuationMode(cfg.continuationMode)
+		}
+		if cfg.observer != nil {
+			ts.SetCompactionObserver(cfg.observer)
+		}
+		if cfg.tokenCounter != nil {
+			ts.SetTokenCounter(cfg.tokenCounter)
+		}
+		if cfg.patternCompression != nil {
+			ts.SetToolResultPatternCompression(*cfg.patternCompression)
+		}
+		if cfg.incrementalSummary != nil {
+			ts.SetIncrementalSummary(*cfg.incrementalSummary)
+		}
+		if cfg.summaryRewriteEvery > 0 {
+			ts.SetSummaryRewriteEvery(cfg.summaryRewriteEvery)
+		}
+		g.strategies[agentID] = newPatternCompactor(ts)
 	default:
-		g.strategies[agentID] = newThresholdStrategy(g.registry, llm, cfg.maxTokens)
+		if cfg.strategy != StrategyThreshold && cfg.strategy != "" {
+			if factory, ok := lookupStrategy(cfg.strategy); ok {
+				strategy, err := factory(StrategyConfig{
+					Registry: g.registry,
+					LLM:      llm,
+					Options:  cfg.strategyOptions,
+				})
+				if err != nil {
+					slog.Error("ContextGuard: custom strategy factory failed, falling back to threshold strategy",
+						"agent", agentID,
+						"strategy", cfg.strategy,
+						"error", err,
+					)
+				} else {
+					g.strategies[agentID] = strategy
+					break
+				}
+			}
+		}
+
+		ts := newThresholdStrategy(g.registry, llm, cfg.maxTokens)
+		if tokenizerRegistry := resolveTokenizerRegistry(g.registry, cfg.tokenizerRegistry); tokenizerRegistry != nil {
+			ts.tokenizer = tokenizerRegistry
+			ts.ratios = g.ratios
+			ts.pending = g.pending
+		}
+		if cfg.chain.keepRecent > 0 {
+			ts.SetChainCompactionPolicy(cfg.chain.keepRecent, cfg.chain.stubTemplate)
+			if cfg.chain.proactive {
+				ts.SetMidTurnChainCompaction(true)
+			}
+		}
+		if cfg.overflow != nil {
+			ts.SetOverflowLimiter(cfg.overflow)
+		}
+		if cfg.hints != nil {
+			ts.SetCompactionHints(cfg.hints)
+		}
+		ts.SetThresholdOptions(cfg.thresholdOpts)
+		if cfg.summaryStore != nil {
+			ts.SetSummaryStore(cfg.summaryStore)
+		}
+		if cfg.reduceTools {
+			ts.SetToolReducers(true)
+		}
+		if cfg.dedup {
+			ts.SetDedup(cfg.dedupNormalizer)
+		}
+		if cfg.hierarchical {
+			ts.SetHierarchicalSummaries(cfg.summaryTreeFanout)
+			if cfg.summaryLeafTokens != 0 || cfg.summaryMaxDepth != 0 {
+				ts.SetHierarchicalSummaryLimits(cfg.summaryLeafTokens, cfg.summaryMaxDepth)
+			}
+		}
+		if cfg.oversizedContent {
+			ts.SetOversizedContentSplitting(cfg.oversizedFraction)
+		}
+		if g.pool != nil {
+			ts.SetSummarizationPool(g.pool)
+		}
+		if cfg.onStalled != nil {
+			ts.SetOnCompactionStalled(cfg.onStalled)
+		}
+		if cfg.summaryProgress != nil {
+			ts.SetSummaryProgress(cfg.summaryProgress)
+		}
+		if cfg.evictionStrategy != nil {
+			ts.SetEvictionStrategy(cfg.evictionStrategy)
+		}
+		if cfg.planner != nil {
+			ts.SetPlanner(cfg.planner)
+		}
+		if cfg.structuredSummary {
+			ts.SetStructuredSummary(true)
+		}
+		if cfg.summaryDocStore != nil {
+			ts.SetSummaryDocStore(cfg.summaryDocStore)
+		}
+		if cfg.summarizer != nil {
+			ts.SetSummarizer(cfg.summarizer)
+		}
+		if cfg.continuationBuilder != nil {
+			ts.SetContinuationPromptBuilder(cfg.continuationBuilder)
+		}
+		if cfg.continuationLocale != "" {
+			ts.SetContinuationLocale(cfg.continuationLocale)
+		}
+		if cfg.continuationMode != "" {
+			ts.SetContinuationMode(cfg.continuationMode)
+		}
+		if cfg.observer != nil {
+			ts.SetCompactionObserver(cfg.observer)
+		}
+		if cfg.tokenCounter != nil {
+			ts.SetTokenCounter(cfg.tokenCounter)
+		}
+		if cfg.patternCompression != nil {
+			ts.SetToolResultPatternCompression(*cfg.patternCompression)
+		}
+		if cfg.incrementalSummary != nil {
+			ts.SetIncrementalSummary(*cfg.incrementalSummary)
+		}
+		if cfg.summaryRewriteEvery > 0 {
+			ts.SetSummaryRewriteEvery(cfg.summaryRewriteEvery)
+		}
+		g.strategies[agentID] = ts
+	}
+
+	if cfg.memoryOffload != nil {
+		g.offloads[agentID] = cfg.memoryOffload
+	}
+	if cfg.toolProfile != nil {
+		g.toolProfiles[agentID] = cfg.toolProfile
 	}
 
 	slog.Info("ContextGuard: strategy configured",
@@ -154,14 +1233,166 @@ func (g *ContextGuard) Add(agentID string, llm model.LLM, opts ...AgentOption) {
 	)
 }
 
+// StrategyFor returns the Strategy registered for agentID by Add, and
+// whether one was found. This is an escape hatch for callers that need to
+// drive compaction directly — benchmark/regression harnesses replaying
+// recorded workload traces (see plugin/contextguard/simtest) — without
+// standing up the full ADK plugin/runner pipeline that PluginConfig wires
+// up for production use.
+func (g *ContextGuard) StrategyFor(agentID string) (Strategy, bool) {
+	s, ok := g.strategies[agentID]
+	return s, ok
+}
+
+// Query returns agent's samples for metric within [start, end), resampled
+// onto step — see MetricsStore.Query. Backed by the MetricsStore every
+// beforeModel/afterModel call on this ContextGuard records into (either the
+// default one New creates, or one installed via WithMetrics).
+func (g *ContextGuard) Query(agent string, metric Metric, start, end time.Time, step time.Duration) []Sample {
+	return g.metrics.Query(agent, metric, start, end, step)
+}
+
+// SumOverTime is MetricsStore.SumOverTime for this ContextGuard's metrics.
+func (g *ContextGuard) SumOverTime(agent string, metric Metric, start, end time.Time) float64 {
+	return g.metrics.SumOverTime(agent, metric, start, end)
+}
+
+// MaxOverTime is MetricsStore.MaxOverTime for this ContextGuard's metrics.
+func (g *ContextGuard) MaxOverTime(agent string, metric Metric, start, end time.Time) float64 {
+	return g.metrics.MaxOverTime(agent, metric, start, end)
+}
+
+// Rate is MetricsStore.Rate for this ContextGuard's metrics.
+func (g *ContextGuard) Rate(agent string, metric Metric, start, end time.Time) float64 {
+	return g.metrics.Rate(agent, metric, start, end)
+}
+
+// CompactNow forces a compaction pass for agentID up to upTo (an index
+// into req.Contents), independent of whatever trigger the agent's
+// strategy normally compacts on — see thresholdStrategy.CompactNow for the
+// exact semantics (no-op watermark guard, ErrCompactNowTooAggressive). It
+// returns an error if agentID has no strategy registered, or if the
+// registered strategy doesn't support caller-driven compaction.
+func (g *ContextGuard) CompactNow(ctx agent.CallbackContext, req *model.LLMRequest, upTo int) error {
+	strategy, ok := g.strategies[ctx.AgentName()]
+	if !ok {
+		return fmt.Errorf("contextguard: no strategy registered for agent %q", ctx.AgentName())
+	}
+	ts, ok := strategy.(*thresholdStrategy)
+	if !ok {
+		return fmt.Errorf("contextguard: strategy %q for agent %q does not support CompactNow", strategy.Name(), ctx.AgentName())
+	}
+	return ts.CompactNow(ctx, req, upTo)
+}
+
+// PinContent marks content as ineligible for summarization/removal by
+// agentID's strategy for the rest of the session — the analogue of
+// Thanos's no-compact-mark.json for a single turn. reason is free-form
+// text recorded alongside the mark for operators inspecting state; it
+// isn't interpreted. Use this to pin a system instruction, a long file
+// quote that must survive verbatim, or a tool result a later turn will
+// reference, without disabling compaction for the rest of the
+// conversation the way WithCompactionHints' NoCompact classification
+// would if applied broadly.
+//
+// PinContent returns an error if agentID has no strategy registered, or if
+// the registered strategy doesn't support pinning (only thresholdStrategy's
+// Compact/CompactNow consult marks today).
+func (g *ContextGuard) PinContent(ctx agent.CallbackContext, content *genai.Content, reason string) error {
+	strategy, ok := g.strategies[ctx.AgentName()]
+	if !ok {
+		return fmt.Errorf("contextguard: no strategy registered for agent %q", ctx.AgentName())
+	}
+	if _, ok := strategy.(*thresholdStrategy); !ok {
+		return fmt.Errorf("contextguard: strategy %q for agent %q does not support PinContent", strategy.Name(), ctx.AgentName())
+	}
+	return pinContent(ctx, content, reason)
+}
+
+// CompactAllContext pairs the agent.CallbackContext and in-flight
+// *model.LLMRequest CompactAll should run one registered agent's
+// Strategy.Compact against — the same two values beforeModel receives from
+// ADK on the request path, assembled here by the caller for a session that
+// isn't mid-turn (e.g. loaded from a session.Service for an idle agent).
+type CompactAllContext struct {
+	Callback agent.CallbackContext
+	Request  *model.LLMRequest
+}
+
+// CompactAll runs Strategy.Compact concurrently for every registered agent
+// present in contexts and accepted by filter (a nil filter accepts every
+// agent), bounded to at most parallelism Compact calls in flight at once —
+// the same semaphore-and-WaitGroup worker pool
+// summarizeChunksConcurrentlyWithTemplate uses to bound chunk-summarization
+// fan-out. This is the entry point a periodic background sweeper (run
+// under its own long-lived context, the way CrushRegistry.Start is) calls
+// to proactively compact idle sessions ahead of their next turn, instead of
+// paying for it inline in beforeModel.
+//
+// ctx governs the sweep itself: once it is Done, CompactAll stops starting
+// new Compact calls — in-flight ones still run to completion and their
+// results are still collected — and returns promptly. parallelism <= 0
+// defaults to 1.
+//
+// Each agent's Compact call gets the same panic recovery and compaction
+// history recording a request-path compaction would, plus a
+// MetricsStore record when the compaction actually drops contents, the
+// same as contextGuard.recordCompactionMetrics. Every per-agent failure is
+// wrapped with the agent ID and merged into a single errors.Join result; a
+// nil return means every considered agent compacted (or had nothing to do)
+// without error.
+func (g *ContextGuard) CompactAll(ctx context.Context, contexts map[string]CompactAllContext, parallelism int, filter func(agentID string) bool) error {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for agentID, strategy := range g.strategies {
+		if ctx.Err() != nil {
+			break
+		}
+		if filter != nil && !filter(agentID) {
+			continue
+		}
+		cc, ok := contexts[agentID]
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(agentID string, strategy Strategy, cc CompactAllContext) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			contentsBefore := len(cc.Request.Contents)
+			if err := safeCompactWithRecovery(cc.Callback, strategy, cc.Request, g.recovery); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("contextguard: agent %q: %w", agentID, err))
+				mu.Unlock()
+				return
+			}
+			recordCompactionMetricsTo(g.metrics, agentID, cc.Request.Model, contentsBefore, len(cc.Request.Contents))
+		}(agentID, strategy, cc)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 // PluginConfig returns a runner.PluginConfig ready to pass to the ADK
 // launcher or runner.
 func (g *ContextGuard) PluginConfig() runner.PluginConfig {
-	guard := &contextGuard{strategies: g.strategies}
+	guard := &contextGuard{strategies: g.strategies, offloads: g.offloads, toolProfiles: g.toolProfiles, recovery: g.recovery, observer: g.observer, capPolicy: g.capPolicy, metrics: g.metrics}
 
 	p, _ := plugin.New(plugin.Config{
 		Name:                "context_guard",
 		BeforeModelCallback: llmagent.BeforeModelCallback(guard.beforeModel),
+		AfterModelCallback:  llmagent.AfterModelCallback(guard.afterModel),
 	})
 
 	return runner.PluginConfig{
@@ -172,28 +1403,297 @@ func (g *ContextGuard) PluginConfig() runner.PluginConfig {
 // contextGuard is the internal state of the plugin, holding per-agent
 // strategies keyed by agent ID.
 type contextGuard struct {
-	strategies map[string]Strategy
+	strategies   map[string]Strategy
+	offloads     map[string]*memoryOffload
+	toolProfiles map[string]*toolProfile
+	recovery     RecoveryHandler
+	observer     CompactionObserver
+	capPolicy    ResponseCapPolicy
+	metrics      *MetricsStore
 }
 
 // beforeModel is the BeforeModelCallback invoked by ADK before every LLM
-// call. It looks up the agent's strategy and delegates compaction to it.
+// call. It enforces the tool-response cap (if configured), then looks up
+// the agent's strategy and delegates compaction to it, recovering from any
+// panic so a single bad strategy can't crash the runner.
 func (g *contextGuard) beforeModel(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
 	if req == nil || len(req.Contents) == 0 {
 		return nil, nil
 	}
 
+	if len(g.capPolicy) > 0 {
+		if n := capToolResponses(req.Contents, g.capPolicy); n > 0 {
+			slog.Info("ContextGuard: capped over-sized tool responses",
+				"agent", ctx.AgentName(),
+				"responsesCapped", n,
+			)
+		}
+	}
+
 	strategy, ok := g.strategies[ctx.AgentName()]
 	if !ok {
 		return nil, nil
 	}
 
-	if err := strategy.Compact(ctx, req); err != nil {
+	offload := g.offloads[ctx.AgentName()]
+	var before []*genai.Content
+	if offload != nil {
+		before = append([]*genai.Content(nil), req.Contents...)
+	}
+
+	if g.observer == nil {
+		contentsBeforeCompact := len(req.Contents)
+		if err := g.safeCompact(ctx, strategy, req); err != nil {
+			slog.Warn("ContextGuard: compaction failed, passing through",
+				"agent", ctx.AgentName(),
+				"strategy", strategy.Name(),
+				"error", err,
+			)
+		}
+		g.recordCompactionMetrics(ctx, req, contentsBeforeCompact)
+		if offload != nil {
+			offload.offloadEvicted(ctx, before, req)
+			offload.injectRecallHint(ctx, req)
+		}
+		if profile, ok := g.toolProfiles[ctx.AgentName()]; ok {
+			profile.apply(ctx, req)
+		}
+		return nil, nil
+	}
+
+	budgetBefore := EstimateTokenBudget(req)
+	contentsBefore := len(req.Contents)
+	g.observer.OnCompactionStart(CompactionEvent{
+		Agent:        ctx.AgentName(),
+		Model:        req.Model,
+		TokensBefore: budgetBefore.Total,
+	})
+
+	compactStart := time.Now()
+	err := g.safeCompact(ctx, strategy, req)
+	duration := time.Since(compactStart)
+	if err != nil {
 		slog.Warn("ContextGuard: compaction failed, passing through",
 			"agent", ctx.AgentName(),
 			"strategy", strategy.Name(),
 			"error", err,
 		)
 	}
+	g.recordCompactionMetrics(ctx, req, contentsBefore)
+
+	if offload != nil {
+		offload.offloadEvicted(ctx, before, req)
+		offload.injectRecallHint(ctx, req)
+	}
+	if profile, ok := g.toolProfiles[ctx.AgentName()]; ok {
+		profile.apply(ctx, req)
+	}
+
+	budgetAfter := EstimateTokenBudget(req)
+	g.observer.OnCompactionEnd(CompactionResult{
+		Agent:        ctx.AgentName(),
+		Model:        req.Model,
+		TokensBefore: budgetBefore.Total,
+		TokensAfter:  budgetAfter.Total,
+		Err:          err,
+		Duration:     duration,
+		Interrupted:  errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded),
+	})
+
+	windowSize := 0
+	if sw, ok := strategy.(streamWindowStrategy); ok {
+		windowSize = sw.contextWindowFor(req)
+	}
+
+	compactionRan := len(req.Contents) != contentsBefore
+	decision := DecisionSkip
+	switch {
+	case err != nil:
+		decision = DecisionOverflowRisk
+	case compactionRan:
+		decision = DecisionCompact
+		if budgetAfter.Total >= budgetBefore.Total {
+			g.observer.OnLoopSuspected("compaction ran but did not reduce token count")
+		}
+	case windowSize > 0 && budgetBefore.Total >= windowSize:
+		// No compaction fired even though the pre-compaction estimate
+		// already meets or exceeds the window — e.g. tool-definition or
+		// inline-data tokens alone dominate the budget in a way the
+		// strategy's own threshold check didn't catch.
+		decision = DecisionOverflowRisk
+	}
+
+	g.observer.OnEstimate(EstimateEvent{
+		Agent:            ctx.AgentName(),
+		Model:            req.Model,
+		WindowSize:       windowSize,
+		HeuristicTokens:  budgetBefore.Total,
+		CorrectionFactor: correctionFactorFor(strategy, ctx.AgentName()),
+		ToolDefTokens:    budgetBefore.ToolTokens,
+		InlineDataTokens: budgetBefore.InlineDataTokens,
+		MessageTokens:    budgetBefore.ContentTokens + budgetBefore.SystemInstructionTokens,
+		Decision:         decision,
+	})
 
 	return nil, nil
 }
+
+// recordCompactionMetrics records MetricCompactionsTriggered and
+// MetricContentsDroppedByCompaction into g.metrics when req.Contents
+// shrank across a Compact call, i.e. compaction actually ran rather than
+// being a below-threshold no-op. A no-op MetricsStore (g.metrics == nil,
+// reachable only when a contextGuard is constructed directly rather than
+// via ContextGuard.PluginConfig, e.g. in tests) is silently skipped.
+func (g *contextGuard) recordCompactionMetrics(ctx agent.CallbackContext, req *model.LLMRequest, contentsBefore int) {
+	recordCompactionMetricsTo(g.metrics, ctx.AgentName(), req.Model, contentsBefore, len(req.Contents))
+}
+
+// recordCompactionMetricsTo is recordCompactionMetrics' store-agnostic core,
+// shared with ContextGuard.CompactAll so a batch sweep's compactions land in
+// the same MetricsStore a request-path compaction would.
+func recordCompactionMetricsTo(metrics *MetricsStore, agentID, modelName string, contentsBefore, contentsAfter int) {
+	if metrics == nil {
+		return
+	}
+	dropped := contentsBefore - contentsAfter
+	if dropped <= 0 {
+		return
+	}
+	now := time.Now()
+	metrics.Incr(agentID, modelName, MetricCompactionsTriggered, now, 1)
+	metrics.Incr(agentID, modelName, MetricContentsDroppedByCompaction, now, dropped)
+}
+
+// correctionFactorFor returns the calibration ratio in effect for
+// agentName, if strategy is a *thresholdStrategy with ratio calibration
+// enabled (see WithTokenizerRegistry), or defaultHeuristicCorrectionFactor
+// otherwise.
+func correctionFactorFor(strategy Strategy, agentName string) float64 {
+	if ts, ok := strategy.(*thresholdStrategy); ok && ts.ratios != nil {
+		return ts.ratios.Ratio(agentName)
+	}
+	return defaultHeuristicCorrectionFactor
+}
+
+// tokenObserver is implemented by strategies that learn from real per-turn
+// token counts as a session progresses. Kept separate from the core Strategy
+// interface (the same pattern as streamWindowStrategy and StatsProvider) so
+// strategies with nothing to learn — sliding-window, summarization — don't
+// need a no-op implementation.
+type tokenObserver interface {
+	observeRealTokens(tokens int)
+}
+
+// afterModel is the AfterModelCallback invoked by ADK after every LLM call.
+// It persists the response's real prompt token count so the next
+// beforeModel call can prefer it over the len/4 heuristic, and feeds that
+// real count to the agent's strategy when it implements tokenObserver —
+// which includes the threshold strategy's ratioTracker calibration (when
+// configured with WithTokenizerRegistry) and the adaptive strategy's
+// reservoir. Partial (streamed) responses and unregistered agents are
+// ignored, since neither reflects a complete request's real token count.
+func (g *contextGuard) afterModel(ctx agent.CallbackContext, resp *model.LLMResponse, modelErr error) (*model.LLMResponse, error) {
+	if resp == nil || resp.Partial || resp.UsageMetadata == nil {
+		return nil, nil
+	}
+
+	strategy, ok := g.strategies[ctx.AgentName()]
+	if !ok {
+		return nil, nil
+	}
+
+	realTokens := int(resp.UsageMetadata.PromptTokenCount)
+	persistRealTokens(ctx, realTokens)
+
+	modelName := loadLastModel(ctx)
+	heuristic := loadLastHeuristic(ctx)
+	if rto, ok := g.observer.(RealTokenObserver); ok {
+		rto.OnRealTokens(ctx.AgentName(), ctx.SessionID(), modelName, realTokens)
+	}
+	if g.metrics != nil {
+		now := time.Now()
+		g.metrics.Record(ctx.AgentName(), modelName, MetricPromptTokens, now, float64(realTokens))
+		g.metrics.Record(ctx.AgentName(), modelName, MetricRealTokens, now, float64(realTokens))
+		if heuristic > 0 {
+			g.metrics.Record(ctx.AgentName(), modelName, MetricHeuristicTokens, now, float64(heuristic))
+		}
+	}
+
+	if heuristic > 0 {
+		state := loadCalibrationState(ctx)
+		state = updateCalibrationState(state, modelName, heuristic, realTokens)
+		persistCalibrationState(ctx, state)
+	}
+
+	if ts, ok := strategy.(*thresholdStrategy); ok && ts.ratios != nil {
+		heuristic := loadLastHeuristic(ctx)
+		ts.ratios.Observe(ctx.AgentName(), heuristic, realTokens)
+		if g.observer != nil {
+			g.observer.OnCalibrationSample(ctx.AgentName(), heuristic, realTokens)
+		}
+	}
+
+	if obs, ok := strategy.(tokenObserver); ok {
+		obs.observeRealTokens(realTokens)
+	}
+
+	return nil, nil
+}
+
+// safeCompact invokes strategy.Compact wrapped in a defer/recover. On panic
+// it captures the stack trace, reports it through the configured
+// RecoveryHandler (if any), and returns an error instead of propagating the
+// panic — letting the runner continue serving the turn with the
+// pre-compaction context.
+func (g *contextGuard) safeCompact(ctx agent.CallbackContext, strategy Strategy, req *model.LLMRequest) error {
+	return safeCompactWithRecovery(ctx, strategy, req, g.recovery)
+}
+
+// safeCompactWithRecovery is safeCompact's recovery-handler-agnostic core,
+// shared with ContextGuard.CompactAll so a batch sweep's Compact calls get
+// the same panic-recovery and compaction-history recording a request-path
+// compaction gets, without a batch sweep needing its own *contextGuard.
+func safeCompactWithRecovery(ctx agent.CallbackContext, strategy Strategy, req *model.LLMRequest, recovery RecoveryHandler) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		stack := debug.Stack()
+		slog.Error("ContextGuard: recovered from panic in strategy",
+			"agent", ctx.AgentName(),
+			"strategy", strategy.Name(),
+			"panic", r,
+			"stack", string(stack),
+		)
+
+		if recovery != nil {
+			if herr := recovery(ctx, r); herr != nil {
+				err = herr
+				return
+			}
+		}
+		err = fmt.Errorf("contextguard: recovered panic in strategy %q: %v", strategy.Name(), r)
+	}()
+
+	watermarkBefore := loadContentsAtCompaction(ctx)
+	tokensBefore := estimateTokens(req)
+
+	if err := strategy.Compact(ctx, req); err != nil {
+		return err
+	}
+
+	if watermarkAfter := loadContentsAtCompaction(ctx); watermarkAfter != watermarkBefore {
+		recordCompactionEvent(ctx, ctx.AgentName(), CompactionEvent{
+			Timestamp:    time.Now().Unix(),
+			Strategy:     strategy.Name(),
+			FirstIndex:   watermarkBefore,
+			LastIndex:    watermarkAfter,
+			TokensBefore: tokensBefore,
+			TokensAfter:  estimateTokens(req),
+			Summary:      loadSummary(ctx),
+		})
+	}
+	return nil
+}
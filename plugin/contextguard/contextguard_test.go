@@ -67,30 +67,32 @@ func (s *mockState) All() iter.Seq2[string, any] {
 
 type mockCallbackContext struct {
 	context.Context
-	agentName string
-	sessionID string
-	state     session.State
+	agentName    string
+	sessionID    string
+	invocationID string
+	state        session.State
 }
 
 func newMockCallbackContext(agentName string) *mockCallbackContext {
 	return &mockCallbackContext{
-		Context:   context.Background(),
-		agentName: agentName,
-		sessionID: "test-session",
-		state:     newMockState(),
+		Context:      context.Background(),
+		agentName:    agentName,
+		sessionID:    "test-session",
+		invocationID: "inv-1",
+		state:        newMockState(),
 	}
 }
 
-func (m *mockCallbackContext) UserContent() *genai.Content            { return nil }
-func (m *mockCallbackContext) InvocationID() string                   { return "inv-1" }
-func (m *mockCallbackContext) AgentName() string                      { return m.agentName }
-func (m *mockCallbackContext) ReadonlyState() session.ReadonlyState   { return m.state }
-func (m *mockCallbackContext) UserID() string                         { return "user-1" }
-func (m *mockCallbackContext) AppName() string                        { return "test-app" }
-func (m *mockCallbackContext) SessionID() string                      { return m.sessionID }
-func (m *mockCallbackContext) Branch() string                         { return "" }
-func (m *mockCallbackContext) Artifacts() agent.Artifacts             { return &mockArtifacts{} }
-func (m *mockCallbackContext) State() session.State                   { return m.state }
+func (m *mockCallbackContext) UserContent() *genai.Content          { return nil }
+func (m *mockCallbackContext) InvocationID() string                 { return m.invocationID }
+func (m *mockCallbackContext) AgentName() string                    { return m.agentName }
+func (m *mockCallbackContext) ReadonlyState() session.ReadonlyState { return m.state }
+func (m *mockCallbackContext) UserID() string                       { return "user-1" }
+func (m *mockCallbackContext) AppName() string                      { return "test-app" }
+func (m *mockCallbackContext) SessionID() string                    { return m.sessionID }
+func (m *mockCallbackContext) Branch() string                       { return "" }
+func (m *mockCallbackContext) Artifacts() agent.Artifacts           { return &mockArtifacts{} }
+func (m *mockCallbackContext) State() session.State                 { return m.state }
 
 type mockArtifacts struct{}
 
@@ -110,6 +112,11 @@ func (a *mockArtifacts) LoadVersion(_ context.Context, _ string, _ int) (*artifa
 type mockLLM struct {
 	name     string
 	response string
+
+	// err, if set, makes GenerateContent yield it instead of a response —
+	// no chunk streams first, simulating e.g. a context cancellation the
+	// summarizer's underlying call surfaces before it can stream anything.
+	err error
 }
 
 func (m *mockLLM) Name() string { return m.name }
@@ -117,6 +124,10 @@ func (m *mockLLM) Name() string { return m.name }
 func (m *mockLLM) GenerateContent(_ context.Context, _ *model.LLMRequest, _ bool) iter.Seq2[*model.LLMResponse, error] {
 	resp := m.response
 	return func(yield func(*model.LLMResponse, error) bool) {
+		if m.err != nil {
+			yield(nil, m.err)
+			return
+		}
 		yield(&model.LLMResponse{
 			Content: &genai.Content{
 				Role:  "model",
@@ -341,6 +352,117 @@ func TestContentHasFunctionResponse(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Tests: detectToolChain / reduceToolChain
+// ---------------------------------------------------------------------------
+
+func TestDetectToolChain_TrailingSequentialPairs(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "investigate"),
+		toolCallContent("step0"),
+		toolResultContent("step0"),
+		toolCallContent("step1"),
+		toolResultContent("step1"),
+	}
+
+	start, ok := detectToolChain(contents)
+	if !ok {
+		t.Fatal("expected a chain to be detected")
+	}
+	if start != 1 {
+		t.Errorf("start = %d, want 1", start)
+	}
+}
+
+func TestDetectToolChain_NoTrailingPair(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "hello"),
+		textContent("model", "hi there"),
+	}
+
+	if _, ok := detectToolChain(contents); ok {
+		t.Error("expected no chain for a plain text exchange")
+	}
+}
+
+func TestDetectToolChain_StopsAtNonToolContent(t *testing.T) {
+	contents := []*genai.Content{
+		toolCallContent("step0"),
+		toolResultContent("step0"),
+		textContent("model", "here are the results"),
+		textContent("user", "thanks"),
+	}
+
+	if _, ok := detectToolChain(contents); ok {
+		t.Error("expected no trailing chain once a text exchange follows it")
+	}
+}
+
+func TestReduceToolChain_StubsOlderPairsKeepsRecent(t *testing.T) {
+	contents := []*genai.Content{
+		toolCallContent("step0"),
+		toolResultContent("step0"),
+		toolCallContent("step1"),
+		toolResultContent("step1"),
+		toolCallContent("step2"),
+		toolResultContent("step2"),
+	}
+
+	changed := reduceToolChain(contents, 0, chainCompactionPolicy{keepRecent: 1, stubTemplate: defaultChainStubTemplate})
+	if !changed {
+		t.Fatal("expected reduceToolChain to report a change")
+	}
+
+	for i, wantStubbed := range []bool{true, true, false} {
+		resp := contents[2*i+1].Parts[0].FunctionResponse
+		_, stubbed := resp.Response[chainStubMarkerKey]
+		if stubbed != wantStubbed {
+			t.Errorf("pair %d: stubbed = %v, want %v", i, stubbed, wantStubbed)
+		}
+	}
+
+	// The FunctionCall entries must survive untouched — only the response
+	// payload shrinks, so tool_use/tool_result pairing never breaks.
+	for i := 0; i < 3; i++ {
+		if contents[2*i].Parts[0].FunctionCall.Name != fmt.Sprintf("step%d", i) {
+			t.Errorf("pair %d: FunctionCall was modified or reordered", i)
+		}
+	}
+}
+
+func TestReduceToolChain_NothingToReduce(t *testing.T) {
+	contents := []*genai.Content{
+		toolCallContent("step0"),
+		toolResultContent("step0"),
+	}
+
+	if reduceToolChain(contents, 0, chainCompactionPolicy{keepRecent: 5}) {
+		t.Error("expected no change when pairs <= keepRecent")
+	}
+}
+
+func TestReduceToolChain_Idempotent(t *testing.T) {
+	contents := []*genai.Content{
+		toolCallContent("step0"),
+		toolResultContent("step0"),
+		toolCallContent("step1"),
+		toolResultContent("step1"),
+	}
+	policy := chainCompactionPolicy{keepRecent: 0, stubTemplate: defaultChainStubTemplate}
+
+	if !reduceToolChain(contents, 0, policy) {
+		t.Fatal("expected first reduction to report a change")
+	}
+	firstStub := contents[1].Parts[0].FunctionResponse.Response["result"]
+
+	if reduceToolChain(contents, 0, policy) {
+		t.Error("expected second reduction over already-stubbed pairs to report no change")
+	}
+	if contents[1].Parts[0].FunctionResponse.Response["result"] != firstStub {
+		t.Error("re-reducing an already-stubbed pair should not re-shrink its preview")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Tests: findSplitIndex / safeSplitIndex
 // ---------------------------------------------------------------------------
@@ -465,7 +587,7 @@ func TestBuildSummarizePrompt_WithoutPreviousSummary(t *testing.T) {
 		textContent("user", "What is Go?"),
 		textContent("model", "Go is a programming language."),
 	}
-	prompt := buildSummarizePrompt(contents, "", nil)
+	prompt := buildSummarizePrompt(contents, "", nil, false)
 
 	if !strings.Contains(prompt, "Provide a detailed summary") {
 		t.Error("missing summary instruction")
@@ -485,7 +607,7 @@ func TestBuildSummarizePrompt_WithPreviousSummary(t *testing.T) {
 	contents := []*genai.Content{
 		textContent("user", "Tell me more"),
 	}
-	prompt := buildSummarizePrompt(contents, "Earlier we discussed Go.", nil)
+	prompt := buildSummarizePrompt(contents, "Earlier we discussed Go.", nil, false)
 
 	if !strings.Contains(prompt, "Earlier we discussed Go.") {
 		t.Error("missing previous summary")
@@ -493,6 +615,26 @@ func TestBuildSummarizePrompt_WithPreviousSummary(t *testing.T) {
 	if !strings.Contains(prompt, "Incorporate the previous summary") {
 		t.Error("missing incorporation instruction")
 	}
+	if strings.Contains(prompt, "Extend the previous summary") {
+		t.Error("full-rewrite mode should not use the incremental instruction")
+	}
+}
+
+func TestBuildSummarizePrompt_WithPreviousSummary_Incremental(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "Tell me more"),
+	}
+	prompt := buildSummarizePrompt(contents, "Earlier we discussed Go.", nil, true)
+
+	if !strings.Contains(prompt, "Earlier we discussed Go.") {
+		t.Error("missing previous summary")
+	}
+	if !strings.Contains(prompt, "Extend the previous summary") {
+		t.Error("missing incremental extend instruction")
+	}
+	if strings.Contains(prompt, "Incorporate the previous summary") {
+		t.Error("incremental mode should not use the full-rewrite instruction")
+	}
 }
 
 func TestBuildSummarizePrompt_WithToolCalls(t *testing.T) {
@@ -500,7 +642,7 @@ func TestBuildSummarizePrompt_WithToolCalls(t *testing.T) {
 		toolCallContent("search"),
 		toolResultContent("search"),
 	}
-	prompt := buildSummarizePrompt(contents, "", nil)
+	prompt := buildSummarizePrompt(contents, "", nil, false)
 
 	if !strings.Contains(prompt, "[called tool: search]") {
 		t.Error("missing tool call in transcript")
@@ -512,7 +654,7 @@ func TestBuildSummarizePrompt_WithToolCalls(t *testing.T) {
 
 func TestBuildSummarizePrompt_NilContents(t *testing.T) {
 	contents := []*genai.Content{nil, textContent("user", "hello"), nil}
-	prompt := buildSummarizePrompt(contents, "", nil)
+	prompt := buildSummarizePrompt(contents, "", nil, false)
 	if !strings.Contains(prompt, "hello") {
 		t.Error("should include non-nil content")
 	}
@@ -884,6 +1026,143 @@ func TestThresholdStrategy_InjectsExistingSummary(t *testing.T) {
 	}
 }
 
+func TestThresholdStrategy_IncrementalSummary_DefaultOnSendsOnlyDeltaWithExtendInstruction(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+	llm := &recordingLLM{mockLLM: mockLLM{name: "small-model", response: "extended summary"}}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	persistSummary(ctx, "prior summary", 5000)
+	persistContentsAtCompaction(ctx, 2)
+
+	req := &model.LLMRequest{
+		Model:    "small-model",
+		Contents: makeLargeConversation(2_000),
+	}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	if len(llm.userPrompts) != 1 {
+		t.Fatalf("expected 1 summarizer call, got %d", len(llm.userPrompts))
+	}
+	prompt := llm.userPrompts[0]
+	if !strings.Contains(prompt, "Extend the previous summary") {
+		t.Error("expected the incremental extend instruction, not a full rewrite")
+	}
+}
+
+func TestStripSummaryInjectionStub_DropsLeadingSyntheticSummary(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: summaryInjectionPrefix + "\nold stuff\n[End of summary — conversation continues below]"}}},
+		textContent("user", "what's next"),
+	}
+
+	got := stripSummaryInjectionStub(contents)
+	if len(got) != 1 {
+		t.Fatalf("len(got) = %d, want 1 (stub dropped)", len(got))
+	}
+	if got[0].Parts[0].Text != "what's next" {
+		t.Errorf("unexpected remaining content: %q", got[0].Parts[0].Text)
+	}
+}
+
+func TestStripSummaryInjectionStub_LeavesNonStubContentsUntouched(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "hello"),
+		textContent("model", "hi"),
+	}
+
+	got := stripSummaryInjectionStub(contents)
+	if len(got) != 2 {
+		t.Errorf("len(got) = %d, want 2 (untouched)", len(got))
+	}
+}
+
+func TestThresholdStrategy_IncrementalSummary_DisabledDoesFullRewrite(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+	llm := &recordingLLM{mockLLM: mockLLM{name: "small-model", response: "rewritten summary"}}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetIncrementalSummary(false)
+	ctx := newMockCallbackContext("agent1")
+
+	persistSummary(ctx, "prior summary", 5000)
+	persistContentsAtCompaction(ctx, 2)
+
+	req := &model.LLMRequest{
+		Model:    "small-model",
+		Contents: makeLargeConversation(2_000),
+	}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	if len(llm.userPrompts) != 1 {
+		t.Fatalf("expected 1 summarizer call, got %d", len(llm.userPrompts))
+	}
+	if !strings.Contains(llm.userPrompts[0], "Incorporate the previous summary") {
+		t.Error("expected the full-rewrite instruction when incremental summary is disabled")
+	}
+}
+
+func TestThresholdStrategy_SummaryRewriteEvery_ForcesPeriodicFullRewrite(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"small-model": 1_000},
+		maxTokens:      map[string]int{"small-model": 512},
+	}
+	llm := &recordingLLM{mockLLM: mockLLM{name: "small-model", response: "summary"}}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetSummaryRewriteEvery(2)
+	ctx := newMockCallbackContext("agent1")
+
+	persistSummary(ctx, "prior summary", 5000)
+	persistContentsAtCompaction(ctx, 2)
+	persistIncrementalCount(ctx, 1)
+
+	req := &model.LLMRequest{
+		Model:    "small-model",
+		Contents: makeLargeConversation(2_000),
+	}
+
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	if len(llm.userPrompts) != 1 {
+		t.Fatalf("expected 1 summarizer call, got %d", len(llm.userPrompts))
+	}
+	if !strings.Contains(llm.userPrompts[0], "Incorporate the previous summary") {
+		t.Error("the 2nd compaction since the last rewrite should force a full rewrite")
+	}
+	if got := loadIncrementalCount(ctx); got != 0 {
+		t.Errorf("incremental count = %d, want 0 (reset after forced rewrite)", got)
+	}
+}
+
+func TestAdd_WithIncrementalSummary(t *testing.T) {
+	guard := New(newMockRegistry())
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"}, WithIncrementalSummary(false), WithSummaryRewriteEvery(5))
+
+	s, ok := guard.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", guard.strategies["agent1"])
+	}
+	if s.incrementalSummary {
+		t.Error("expected incrementalSummary to be false after WithIncrementalSummary(false)")
+	}
+	if s.summaryRewriteEvery != 5 {
+		t.Errorf("summaryRewriteEvery = %d, want 5", s.summaryRewriteEvery)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Tests: Sliding window strategy (Compact)
 // ---------------------------------------------------------------------------
@@ -1732,7 +2011,7 @@ func TestBuildSummarizePrompt_WithTodos(t *testing.T) {
 		{Content: "Write docs", Status: "pending"},
 	}
 
-	prompt := buildSummarizePrompt(contents, "", todos)
+	prompt := buildSummarizePrompt(contents, "", todos, false)
 
 	if !strings.Contains(prompt, "[Current todo list]") {
 		t.Error("should contain todo list header")
@@ -1756,7 +2035,7 @@ func TestBuildSummarizePrompt_WithoutTodos(t *testing.T) {
 		textContent("user", "hello"),
 	}
 
-	prompt := buildSummarizePrompt(contents, "", nil)
+	prompt := buildSummarizePrompt(contents, "", nil, false)
 
 	if strings.Contains(prompt, "[Current todo list]") {
 		t.Error("should not contain todo list when nil")
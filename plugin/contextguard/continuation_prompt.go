@@ -0,0 +1,166 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"google.golang.org/genai"
+)
+
+// ContinuationPromptData carries everything a ContinuationPromptBuilder's
+// template may want to reference when rendering the message injectContinuation
+// appends after a compaction.
+type ContinuationPromptData struct {
+	// UserRequest is the current turn's original user text, or "" if none
+	// was available (e.g. ctx.UserContent() returned nil).
+	UserRequest string
+
+	// Summary is the compaction summary that was just injected ahead of
+	// this continuation message.
+	Summary string
+
+	// PendingToolCalls holds the names of any FunctionCalls at the tail of
+	// the (possibly truncated) conversation still awaiting a
+	// FunctionResponse, so the template can call them out explicitly
+	// instead of silently dropping that state from the nudge. Empty when
+	// there is none.
+	PendingToolCalls []string
+
+	// AgentName is ctx.AgentName() — the agent this compaction ran for.
+	AgentName string
+
+	// SystemPrompt is the agent's system instruction text, when available,
+	// so a template can re-emphasize a convention from it (e.g. a coding
+	// agent's file-editing rules) instead of a generic nudge.
+	SystemPrompt string
+
+	// Locale selects which built-in template NewContinuationPromptBuilder
+	// looks up; e.g. "en", "es". Templates registered via
+	// NewContinuationPromptBuilderFromTemplate ignore it.
+	Locale string
+}
+
+// ContinuationPromptBuilder renders the message injectContinuation appends
+// to req.Contents after a compaction, replacing the package's hard-coded
+// English fmt.Sprintf strings with a single template execution path. See
+// TemplateContinuationPromptBuilder, WithContinuationPromptBuilder.
+type ContinuationPromptBuilder interface {
+	Build(data ContinuationPromptData) (string, error)
+}
+
+// defaultContinuationTemplates ships one template per supported locale.
+// Each renders the same structure the original fmt.Sprintf branches did:
+// an explanation that compaction happened, the user's current request (when
+// known), and a nudge to keep going without asking the user to repeat
+// themselves.
+var defaultContinuationTemplates = map[string]string{
+	"en": "[System: The conversation was compacted because it exceeded the context window. " +
+		"The summary above contains all prior context.{{if .UserRequest}} The user's current request is: `{{.UserRequest}}`.{{end}}" +
+		"{{if .PendingToolCalls}} The following tool call(s) were in flight and still need a result: {{join .PendingToolCalls}}.{{end}} " +
+		"Continue working{{if .UserRequest}} on this request{{end}} without asking the user to repeat anything.]",
+
+	"es": "[Sistema: La conversación se resumió porque excedió la ventana de contexto. " +
+		"El resumen anterior contiene todo el contexto previo.{{if .UserRequest}} La solicitud actual del usuario es: `{{.UserRequest}}`.{{end}}" +
+		"{{if .PendingToolCalls}} Las siguientes llamadas a herramientas estaban en curso y aún necesitan un resultado: {{join .PendingToolCalls}}.{{end}} " +
+		"Continúa trabajando{{if .UserRequest}} en esta solicitud{{end}} sin pedirle al usuario que repita nada.]",
+}
+
+// defaultContinuationLocale is used when ContinuationPromptData.Locale (or
+// the locale passed to NewContinuationPromptBuilder) isn't one of
+// defaultContinuationTemplates' keys.
+const defaultContinuationLocale = "en"
+
+// continuationTemplateFuncs are available to every built-in and custom
+// continuation template.
+var continuationTemplateFuncs = template.FuncMap{
+	"join": func(items []string) string { return strings.Join(items, ", ") },
+}
+
+// defaultContinuationBuilder renders the plain English message
+// injectContinuation uses when no agent-specific ContinuationPromptBuilder
+// was configured, replacing the package's former two fmt.Sprintf branches
+// with the same single template execution path every other locale/override
+// goes through.
+var defaultContinuationBuilder = &TemplateContinuationPromptBuilder{
+	tmpl: template.Must(template.New("continuation").Funcs(continuationTemplateFuncs).
+		Parse(defaultContinuationTemplates[defaultContinuationLocale])),
+}
+
+// TemplateContinuationPromptBuilder implements ContinuationPromptBuilder by
+// executing a text/template against ContinuationPromptData.
+type TemplateContinuationPromptBuilder struct {
+	tmpl *template.Template
+}
+
+// NewContinuationPromptBuilder returns a TemplateContinuationPromptBuilder
+// using the built-in template for locale. An unrecognized locale falls back
+// to defaultContinuationLocale rather than erroring, since a caller
+// iterating agent configs by locale shouldn't have to special-case a typo
+// or an as-yet-untranslated locale.
+func NewContinuationPromptBuilder(locale string) (*TemplateContinuationPromptBuilder, error) {
+	text, ok := defaultContinuationTemplates[locale]
+	if !ok {
+		text = defaultContinuationTemplates[defaultContinuationLocale]
+	}
+	return NewContinuationPromptBuilderFromTemplate(text)
+}
+
+// NewContinuationPromptBuilderFromTemplate parses a caller-supplied
+// text/template, for an agent that wants to fully replace the nudge — e.g.
+// a coding agent re-emphasizing file-editing conventions instead of the
+// generic "continue working" message. The template is executed against a
+// ContinuationPromptData; see that type's fields and the "join" helper
+// function (for PendingToolCalls).
+func NewContinuationPromptBuilderFromTemplate(text string) (*TemplateContinuationPromptBuilder, error) {
+	tmpl, err := template.New("continuation").Funcs(continuationTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("contextguard: failed to parse continuation prompt template: %w", err)
+	}
+	return &TemplateContinuationPromptBuilder{tmpl: tmpl}, nil
+}
+
+// Build implements ContinuationPromptBuilder.
+func (b *TemplateContinuationPromptBuilder) Build(data ContinuationPromptData) (string, error) {
+	var sb strings.Builder
+	if err := b.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("contextguard: failed to render continuation prompt: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// pendingToolCallNames returns the names of any FunctionCalls at the tail of
+// contents still awaiting a FunctionResponse, for ContinuationPromptData.
+// PendingToolCalls. Returns nil if contents doesn't end in an unresolved
+// call.
+func pendingToolCallNames(contents []*genai.Content) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	last := contents[len(contents)-1]
+	if last == nil || last.Role != "model" {
+		return nil
+	}
+
+	var names []string
+	for _, part := range last.Parts {
+		if part != nil && part.FunctionCall != nil {
+			names = append(names, part.FunctionCall.Name)
+		}
+	}
+	return names
+}
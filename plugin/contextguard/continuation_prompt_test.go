@@ -0,0 +1,216 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestNewContinuationPromptBuilder_English(t *testing.T) {
+	builder, err := NewContinuationPromptBuilder("en")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilder: %v", err)
+	}
+
+	msg, err := builder.Build(ContinuationPromptData{UserRequest: "fix the bug"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(msg, "compacted") || !strings.Contains(msg, "fix the bug") {
+		t.Errorf("Build() = %q, want the English template with the user request", msg)
+	}
+}
+
+func TestNewContinuationPromptBuilder_NonEnglishLocale(t *testing.T) {
+	builder, err := NewContinuationPromptBuilder("es")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilder: %v", err)
+	}
+
+	msg, err := builder.Build(ContinuationPromptData{UserRequest: "arregla el error"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(msg, "resumió") || !strings.Contains(msg, "arregla el error") {
+		t.Errorf("Build() = %q, want the Spanish template with the user request", msg)
+	}
+}
+
+func TestNewContinuationPromptBuilder_UnknownLocaleFallsBackToEnglish(t *testing.T) {
+	builder, err := NewContinuationPromptBuilder("xx-unknown")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilder: %v", err)
+	}
+
+	msg, err := builder.Build(ContinuationPromptData{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(msg, "compacted") {
+		t.Errorf("Build() = %q, want the English fallback template", msg)
+	}
+}
+
+func TestNewContinuationPromptBuilder_MentionsPendingToolCalls(t *testing.T) {
+	builder, err := NewContinuationPromptBuilder("en")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilder: %v", err)
+	}
+
+	msg, err := builder.Build(ContinuationPromptData{PendingToolCalls: []string{"kubectl_get_pods", "kubectl_get_logs"}})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(msg, "kubectl_get_pods") || !strings.Contains(msg, "kubectl_get_logs") {
+		t.Errorf("Build() = %q, want both pending tool call names mentioned", msg)
+	}
+}
+
+func TestNewContinuationPromptBuilderFromTemplate_CustomOverride(t *testing.T) {
+	builder, err := NewContinuationPromptBuilderFromTemplate(
+		"[System: compacted. Remember: always use str_replace for edits, agent={{.AgentName}}.]")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilderFromTemplate: %v", err)
+	}
+
+	msg, err := builder.Build(ContinuationPromptData{AgentName: "coding-agent"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(msg, "str_replace") || !strings.Contains(msg, "coding-agent") {
+		t.Errorf("Build() = %q, want the custom template rendered with AgentName", msg)
+	}
+}
+
+func TestNewContinuationPromptBuilderFromTemplate_InvalidTemplateErrors(t *testing.T) {
+	if _, err := NewContinuationPromptBuilderFromTemplate("{{.Broken"); err == nil {
+		t.Fatal("expected an error for a malformed template")
+	}
+}
+
+func TestInjectContinuationWithBuilder_FallsBackToDefaultOnRenderError(t *testing.T) {
+	failing := &failingContinuationBuilder{}
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "summary here")}}
+
+	injectContinuationWithBuilder(req, ContinuationPromptData{UserRequest: "do the thing"}, failing)
+
+	last := req.Contents[len(req.Contents)-1]
+	if !strings.Contains(last.Parts[0].Text, "compacted") {
+		t.Errorf("expected the default template's text after a failing builder, got %q", last.Parts[0].Text)
+	}
+}
+
+type failingContinuationBuilder struct{}
+
+func (failingContinuationBuilder) Build(ContinuationPromptData) (string, error) {
+	return "", errTestBuilderFailed
+}
+
+var errTestBuilderFailed = errors.New("builder intentionally failed")
+
+func TestPendingToolCallNames_DetectsUnresolvedTrailingCall(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "check pods"),
+		{
+			Role: "model",
+			Parts: []*genai.Part{{
+				FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"},
+			}},
+		},
+	}
+
+	names := pendingToolCallNames(contents)
+	if len(names) != 1 || names[0] != "kubectl_get_pods" {
+		t.Errorf("pendingToolCallNames() = %v, want [kubectl_get_pods]", names)
+	}
+}
+
+func TestPendingToolCallNames_NoneWhenLastIsResolved(t *testing.T) {
+	contents := []*genai.Content{
+		{
+			Role: "model",
+			Parts: []*genai.Part{{
+				FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"},
+			}},
+		},
+		{
+			Role: "user",
+			Parts: []*genai.Part{{
+				FunctionResponse: &genai.FunctionResponse{Name: "kubectl_get_pods"},
+			}},
+		},
+	}
+
+	if names := pendingToolCallNames(contents); names != nil {
+		t.Errorf("pendingToolCallNames() = %v, want nil when the last content is a FunctionResponse", names)
+	}
+}
+
+func TestWithContinuationPromptBuilder_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+	builder, err := NewContinuationPromptBuilder("es")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilder: %v", err)
+	}
+
+	g.Add("agent1", llm, WithContinuationPromptBuilder(builder), WithContinuationLocale("es"))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if ts.continuationBuilder != ContinuationPromptBuilder(builder) {
+		t.Errorf("continuationBuilder = %v, want the configured builder", ts.continuationBuilder)
+	}
+	if ts.continuationLocale != "es" {
+		t.Errorf("continuationLocale = %q, want %q", ts.continuationLocale, "es")
+	}
+}
+
+func TestThresholdStrategy_CompactUsesConfiguredContinuationBuilder(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	builder, err := NewContinuationPromptBuilderFromTemplate("[CUSTOM_MARKER: continue, {{.AgentName}}.]")
+	if err != nil {
+		t.Fatalf("NewContinuationPromptBuilderFromTemplate: %v", err)
+	}
+	ts.SetContinuationPromptBuilder(builder)
+
+	ctx := newMockCallbackContext("sim-agent")
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	last := req.Contents[len(req.Contents)-1]
+	if !strings.Contains(last.Parts[0].Text, "CUSTOM_MARKER") || !strings.Contains(last.Parts[0].Text, "sim-agent") {
+		t.Errorf("expected the configured continuation builder's output, got %q", last.Parts[0].Text)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"google.golang.org/adk/agent"
+	"google.golang.org/genai"
+)
+
+// FinishReason mirrors the handful of provider finish-reason values this
+// package cares about when deciding whether a compaction's trailing
+// assistant turn was truncated mid-generation rather than completed. The
+// compaction pipeline never learns this by calling the model itself — it's
+// read from session state under lastFinishReasonStateKey, written by
+// whatever layer actually makes the LLM call, the same way loadTodos reads
+// "todos" without ever writing it.
+type FinishReason string
+
+const (
+	FinishReasonUnspecified FinishReason = ""
+	FinishReasonStop        FinishReason = "stop"
+	FinishReasonLength      FinishReason = "length"
+	FinishReasonToolCalls   FinishReason = "tool_calls"
+)
+
+// lastFinishReasonStateKey is the session-state key loadLastFinishReason
+// reads. Unprefixed (unlike this package's own stateKeyPrefixXxx keys)
+// because it's owned by the orchestrator layer that makes the LLM call, not
+// by contextguard — matching the plain "todos" key loadTodos reads.
+const lastFinishReasonStateKey = "last_finish_reason"
+
+// ContinuationMode selects how Compact resumes the conversation after
+// injecting a summary: by appending a synthetic user turn (the package's
+// original behavior), by leaving a truncated assistant turn in place so the
+// next LLM call continues it directly, or by detecting which applies. See
+// WithContinuationMode, SetContinuationMode.
+type ContinuationMode string
+
+const (
+	// ContinuationModeAuto resumes the assistant turn verbatim (see
+	// shouldResumeAssistantTurn) when the trailing content is an assistant
+	// message cut off mid-generation or left with an unresolved tool call,
+	// and otherwise falls back to ContinuationModeSyntheticUser. This is the
+	// default when SetContinuationMode was never called. thresholdStrategy's
+	// FullSummary pass does not resume an unresolved tool call: it appends
+	// the continuation message and re-appends the call after it (see
+	// trailingToolState).
+	ContinuationModeAuto ContinuationMode = "auto"
+
+	// ContinuationModeSyntheticUser always appends the configured
+	// ContinuationPromptBuilder's message as a new user turn, regardless of
+	// what the trailing content is.
+	ContinuationModeSyntheticUser ContinuationMode = "synthetic_user"
+
+	// ContinuationModeAssistantResume always leaves the trailing content in
+	// place rather than appending a continuation message, so the next LLM
+	// call continues it directly (Anthropic-style trailing assistant
+	// priming, or OpenAI-style with the partial content preserved). Only
+	// safe when the trailing content really is an incomplete assistant
+	// turn — prefer Auto unless the caller can guarantee that.
+	ContinuationModeAssistantResume ContinuationMode = "assistant_resume"
+)
+
+// loadLastFinishReason reads the finish reason of the most recent LLM
+// response from session state. Returns FinishReasonUnspecified if absent or
+// stored as a type other than FinishReason/string.
+func loadLastFinishReason(ctx agent.CallbackContext) FinishReason {
+	val, err := ctx.State().Get(lastFinishReasonStateKey)
+	if err != nil || val == nil {
+		return FinishReasonUnspecified
+	}
+	switch v := val.(type) {
+	case FinishReason:
+		return v
+	case string:
+		return FinishReason(v)
+	}
+	return FinishReasonUnspecified
+}
+
+// shouldResumeAssistantTurn reports whether the trailing entry of contents
+// is an assistant turn that Compact should resume verbatim instead of
+// following with a synthetic continuation message: one cut off
+// mid-generation (FinishReasonLength) or left with a FunctionCall that
+// hasn't been answered yet.
+func shouldResumeAssistantTurn(ctx agent.CallbackContext, contents []*genai.Content) bool {
+	if len(contents) == 0 {
+		return false
+	}
+	last := contents[len(contents)-1]
+	if last == nil || last.Role != "model" {
+		return false
+	}
+	if loadLastFinishReason(ctx) == FinishReasonLength {
+		return true
+	}
+	return len(pendingToolCallNames(contents)) > 0
+}
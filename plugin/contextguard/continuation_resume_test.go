@@ -0,0 +1,165 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestLoadLastFinishReason_AbsentReturnsUnspecified(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	if got := loadLastFinishReason(ctx); got != FinishReasonUnspecified {
+		t.Errorf("loadLastFinishReason() = %q, want unspecified", got)
+	}
+}
+
+func TestLoadLastFinishReason_ReadsStringAndTypedValues(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+
+	ctx.State().Set(lastFinishReasonStateKey, "length")
+	if got := loadLastFinishReason(ctx); got != FinishReasonLength {
+		t.Errorf("loadLastFinishReason() = %q, want %q", got, FinishReasonLength)
+	}
+
+	ctx.State().Set(lastFinishReasonStateKey, FinishReasonToolCalls)
+	if got := loadLastFinishReason(ctx); got != FinishReasonToolCalls {
+		t.Errorf("loadLastFinishReason() = %q, want %q", got, FinishReasonToolCalls)
+	}
+}
+
+func TestShouldResumeAssistantTurn_TruncatedByLength(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	ctx.State().Set(lastFinishReasonStateKey, "length")
+
+	contents := []*genai.Content{
+		textContent("user", "keep going"),
+		{Role: "model", Parts: []*genai.Part{{Text: "partial reply cut off mid-sen"}}},
+	}
+
+	if !shouldResumeAssistantTurn(ctx, contents) {
+		t.Error("expected true for a model turn truncated by length")
+	}
+}
+
+func TestShouldResumeAssistantTurn_UnresolvedToolCall(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+
+	contents := []*genai.Content{
+		textContent("user", "check pods"),
+		{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "kubectl_get_pods"}}}},
+	}
+
+	if !shouldResumeAssistantTurn(ctx, contents) {
+		t.Error("expected true for a trailing unresolved tool call")
+	}
+}
+
+func TestShouldResumeAssistantTurn_FalseForCompletedUserOrAssistantTurn(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+
+	userLast := []*genai.Content{
+		{Role: "model", Parts: []*genai.Part{{Text: "done"}}},
+		textContent("user", "thanks"),
+	}
+	if shouldResumeAssistantTurn(ctx, userLast) {
+		t.Error("expected false when the trailing content is a user turn")
+	}
+
+	completedAssistant := []*genai.Content{
+		textContent("user", "hi"),
+		{Role: "model", Parts: []*genai.Part{{Text: "hello, all done here."}}},
+	}
+	if shouldResumeAssistantTurn(ctx, completedAssistant) {
+		t.Error("expected false for a completed assistant turn with no finish-reason/tool-call signal")
+	}
+}
+
+func TestThresholdStrategy_ContinuationModeAssistantResumeLeavesTrailingTurnInPlace(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	ts.SetContinuationMode(ContinuationModeAssistantResume)
+
+	ctx := newMockCallbackContext("sim-agent")
+	contents := kubeAgentConversation(50)
+	contents = append(contents, &genai.Content{
+		Role:  "model",
+		Parts: []*genai.Part{{Text: "partial reply cut off"}},
+	})
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	last := req.Contents[len(req.Contents)-1]
+	if last.Role != "model" || !strings.Contains(last.Parts[0].Text, "partial reply cut off") {
+		t.Errorf("expected the truncated assistant turn to remain last, got role=%q text=%q", last.Role, last.Parts[0].Text)
+	}
+}
+
+func TestThresholdStrategy_ContinuationModeSyntheticUserAlwaysAppendsContinuation(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "Summary: ..."}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	ts.SetContinuationMode(ContinuationModeSyntheticUser)
+
+	ctx := newMockCallbackContext("sim-agent")
+	ctx.State().Set(lastFinishReasonStateKey, "length")
+	contents := kubeAgentConversation(50)
+	contents = append(contents, &genai.Content{
+		Role:  "model",
+		Parts: []*genai.Part{{Text: "partial reply cut off"}},
+	})
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	last := req.Contents[len(req.Contents)-1]
+	if last.Role != "user" {
+		t.Errorf("expected a synthetic user turn appended last, got role=%q", last.Role)
+	}
+}
+
+func TestWithContinuationMode_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+
+	g.Add("agent1", llm, WithContinuationMode(ContinuationModeAssistantResume))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if ts.continuationMode != ContinuationModeAssistantResume {
+		t.Errorf("continuationMode = %q, want %q", ts.continuationMode, ContinuationModeAssistantResume)
+	}
+}
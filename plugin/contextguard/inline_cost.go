@@ -0,0 +1,338 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/adk/model"
+)
+
+// InlineCostFunc computes the token cost of one inline attachment (an
+// image or PDF) given its MIME type and raw bytes, replacing the
+// byte-ratio heuristic in estimatePartTokens with pricing rules that
+// reflect how a specific model family actually bills attachments.
+type InlineCostFunc func(mimeType string, data []byte) int
+
+type inlineCostEntry struct {
+	prefix string
+	fn     InlineCostFunc
+}
+
+// InlineCostRegistry resolves an InlineCostFunc by model name prefix,
+// mirroring TokenizerRegistry's longest-prefix-wins lookup. An unmatched
+// model ID resolves to a nil func; callers fall back to the byte-ratio
+// estimate in that case instead of the registry guessing at a price it
+// has no preset for.
+type InlineCostRegistry struct {
+	mu      sync.RWMutex
+	entries []inlineCostEntry
+}
+
+// NewInlineCostRegistry creates a registry pre-populated with presets for
+// Anthropic (claude-), Google (gemini-), and OpenAI (gpt-, o1-, o3-, o4-)
+// image/PDF pricing. RegisterInlineCostFunc can add or override presets.
+func NewInlineCostRegistry() *InlineCostRegistry {
+	r := &InlineCostRegistry{}
+	r.RegisterInlineCostFunc("claude-", anthropicImageCost)
+	r.RegisterInlineCostFunc("gemini-", geminiImageCost)
+	r.RegisterInlineCostFunc("gpt-", openAIImageCost)
+	r.RegisterInlineCostFunc("o1-", openAIImageCost)
+	r.RegisterInlineCostFunc("o3-", openAIImageCost)
+	r.RegisterInlineCostFunc("o4-", openAIImageCost)
+	return r
+}
+
+// RegisterInlineCostFunc associates a model name prefix with an
+// InlineCostFunc. On a Resolve conflict between two registered prefixes,
+// the longer (more specific) one wins.
+func (r *InlineCostRegistry) RegisterInlineCostFunc(modelPattern string, fn InlineCostFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, inlineCostEntry{prefix: modelPattern, fn: fn})
+}
+
+// Resolve returns the InlineCostFunc registered for the longest matching
+// prefix of modelID, or nil if nothing matches.
+func (r *InlineCostRegistry) Resolve(modelID string) InlineCostFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best inlineCostEntry
+	for _, e := range r.entries {
+		if strings.HasPrefix(modelID, e.prefix) && len(e.prefix) > len(best.prefix) {
+			best = e
+		}
+	}
+	return best.fn
+}
+
+// imageAwareTokenizer wraps a base Tokenizer, replacing its per-part
+// byte-ratio InlineData contribution with costs resolves for model,
+// leaving every other field's estimate (text, function calls/responses,
+// tool declarations) untouched.
+type imageAwareTokenizer struct {
+	base  Tokenizer
+	costs *InlineCostRegistry
+	model string
+}
+
+func (t imageAwareTokenizer) CountTokens(req *model.LLMRequest) int {
+	total := t.base.CountTokens(req)
+	fn := t.costs.Resolve(t.model)
+	if fn == nil {
+		return total
+	}
+	for _, content := range req.Contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part == nil || part.InlineData == nil {
+				continue
+			}
+			byteRatioCost := len(part.InlineData.Data) / inlineDataBytesPerToken(part.InlineData.MIMEType)
+			total += fn(part.InlineData.MIMEType, part.InlineData.Data) - byteRatioCost
+		}
+	}
+	return total
+}
+
+// Exact reports whether the wrapped base Tokenizer is itself an
+// ExactTokenizer — the InlineData cost substitution above doesn't change
+// whether the rest of the estimate is provider-exact.
+func (t imageAwareTokenizer) Exact() bool {
+	return isExactTokenizer(t.base)
+}
+
+// --- Anthropic: ceil(width*height / 750), capped by a 1568px max-side resize ---
+
+const (
+	anthropicPixelsPerToken   = 750
+	anthropicMaxImageSide     = 1568
+	anthropicPDFTokensPerPage = 1500
+)
+
+func anthropicImageCost(mimeType string, data []byte) int {
+	if isPDF(mimeType) {
+		return pdfPageCount(data) * anthropicPDFTokensPerPage
+	}
+	w, h, ok := imageDimensions(mimeType, data)
+	if !ok {
+		return len(data) / inlineDataBytesPerToken(mimeType)
+	}
+	w, h = clampMaxSide(w, h, anthropicMaxImageSide)
+	return int(math.Ceil(float64(w*h) / anthropicPixelsPerToken))
+}
+
+// --- Gemini: flat 258 tokens <=384x384, else 258 per 768x768 tile ---
+
+const (
+	geminiSmallImageMaxSide = 384
+	geminiSmallImageTokens  = 258
+	geminiTileSize          = 768
+	geminiTileTokens        = 258
+	geminiPDFTokensPerPage  = 258
+)
+
+func geminiImageCost(mimeType string, data []byte) int {
+	if isPDF(mimeType) {
+		return pdfPageCount(data) * geminiPDFTokensPerPage
+	}
+	w, h, ok := imageDimensions(mimeType, data)
+	if !ok {
+		return len(data) / inlineDataBytesPerToken(mimeType)
+	}
+	if w <= geminiSmallImageMaxSide && h <= geminiSmallImageMaxSide {
+		return geminiSmallImageTokens
+	}
+	tilesX := int(math.Ceil(float64(w) / geminiTileSize))
+	tilesY := int(math.Ceil(float64(h) / geminiTileSize))
+	return tilesX * tilesY * geminiTileTokens
+}
+
+// --- OpenAI: low/high detail tile model ---
+
+const (
+	openAILowDetailMaxSide = 512
+	openAILowDetailTokens  = 85
+	openAIBaseTokens       = 85
+	openAITileSize         = 512
+	openAITileTokens       = 170
+	openAIMaxSide          = 2048
+	openAIShortSideTarget  = 768
+	openAIPDFTokensPerPage = 85
+)
+
+func openAIImageCost(mimeType string, data []byte) int {
+	if isPDF(mimeType) {
+		return pdfPageCount(data) * openAIPDFTokensPerPage
+	}
+	w, h, ok := imageDimensions(mimeType, data)
+	if !ok {
+		return len(data) / inlineDataBytesPerToken(mimeType)
+	}
+	if w <= openAILowDetailMaxSide && h <= openAILowDetailMaxSide {
+		return openAILowDetailTokens
+	}
+
+	w, h = clampMaxSide(w, h, openAIMaxSide)
+	if shortSide := min(w, h); shortSide > openAIShortSideTarget {
+		scale := float64(openAIShortSideTarget) / float64(shortSide)
+		w = int(float64(w) * scale)
+		h = int(float64(h) * scale)
+	}
+
+	tilesX := int(math.Ceil(float64(w) / openAITileSize))
+	tilesY := int(math.Ceil(float64(h) / openAITileSize))
+	return openAIBaseTokens + tilesX*tilesY*openAITileTokens
+}
+
+// clampMaxSide scales w,h down (preserving aspect ratio) so neither side
+// exceeds maxSide. Leaves w,h unchanged if already within bounds.
+func clampMaxSide(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w > h {
+		h = int(float64(h) * float64(maxSide) / float64(w))
+		return maxSide, h
+	}
+	w = int(float64(w) * float64(maxSide) / float64(h))
+	return w, maxSide
+}
+
+func isPDF(mimeType string) bool {
+	return strings.Contains(mimeType, "pdf")
+}
+
+// imageDimensions decodes just enough of an image's header to recover its
+// pixel dimensions, without a full decode: PNG's IHDR chunk, JPEG's SOFn
+// marker, or WebP's VP8/VP8L/VP8X chunk.
+func imageDimensions(mimeType string, data []byte) (w, h int, ok bool) {
+	switch {
+	case strings.Contains(mimeType, "png"):
+		return pngDimensions(data)
+	case strings.Contains(mimeType, "jpeg"), strings.Contains(mimeType, "jpg"):
+		return jpegDimensions(data)
+	case strings.Contains(mimeType, "webp"):
+		return webpDimensions(data)
+	}
+	return 0, 0, false
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// pngDimensions reads width/height straight out of the IHDR chunk, which
+// PNG always places immediately after the 8-byte file signature.
+func pngDimensions(data []byte) (int, int, bool) {
+	if len(data) < 24 || !bytes.HasPrefix(data, pngSignature) {
+		return 0, 0, false
+	}
+	w := binary.BigEndian.Uint32(data[16:20])
+	h := binary.BigEndian.Uint32(data[20:24])
+	return int(w), int(h), true
+}
+
+// jpegDimensions walks JPEG markers looking for a start-of-frame (SOF0-SOF15,
+// excluding the DHT/JPG/DAC marker numbers which share the 0xC4/0xC8/0xCC
+// range), which carries the image's height and width.
+func jpegDimensions(data []byte) (int, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, 0, false
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			i++
+			continue
+		}
+		marker := data[i+1]
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD9) {
+			i += 2
+			continue
+		}
+		segLen := int(data[i+2])<<8 | int(data[i+3])
+		isSOF := marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+		if isSOF {
+			if i+9 > len(data) {
+				return 0, 0, false
+			}
+			h := int(data[i+5])<<8 | int(data[i+6])
+			w := int(data[i+7])<<8 | int(data[i+8])
+			return w, h, true
+		}
+		i += 2 + segLen
+	}
+	return 0, 0, false
+}
+
+// webpDimensions reads the lossy (VP8), lossless (VP8L), or extended
+// (VP8X) chunk that follows every WebP's RIFF/WEBP header.
+func webpDimensions(data []byte) (int, int, bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(data[12:16]) {
+	case "VP8X":
+		w := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		h := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return w + 1, h + 1, true
+	case "VP8 ":
+		w := int(data[26]) | int(data[27])<<8
+		h := int(data[28]) | int(data[29])<<8
+		return w & 0x3fff, h & 0x3fff, true
+	case "VP8L":
+		if len(data) < 25 {
+			return 0, 0, false
+		}
+		bits := uint32(data[21]) | uint32(data[22])<<8 | uint32(data[23])<<16 | uint32(data[24])<<24
+		w := int(bits&0x3FFF) + 1
+		h := int((bits>>14)&0x3FFF) + 1
+		return w, h, true
+	}
+	return 0, 0, false
+}
+
+var (
+	// pdfPageCountPattern matches the page tree root's explicit /Count
+	// entry, the cheapest reliable way to learn a PDF's page count
+	// without walking the whole page tree.
+	pdfPageCountPattern = regexp.MustCompile(`(?s)/Type\s*/Pages.*?/Count\s+(\d+)`)
+	// pdfPageObjectPattern falls back to counting individual page objects
+	// when no /Pages root with a /Count is found (e.g. a malformed or
+	// linearized PDF missing its trailer-referenced root).
+	pdfPageObjectPattern = regexp.MustCompile(`/Type\s*/Page[^s]`)
+)
+
+// pdfPageCount extracts a PDF's page count from its /Pages root's /Count
+// entry, falling back to counting /Type /Page objects directly, without a
+// full PDF parse. Returns 1 if neither pattern is found.
+func pdfPageCount(data []byte) int {
+	if m := pdfPageCountPattern.FindSubmatch(data); m != nil {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > 0 {
+			return n
+		}
+	}
+	if count := len(pdfPageObjectPattern.FindAll(data, -1)); count > 0 {
+		return count
+	}
+	return 1
+}
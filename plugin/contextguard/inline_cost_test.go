@@ -0,0 +1,202 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// fakePNG builds a minimal valid PNG header (signature + IHDR chunk) with
+// the given pixel dimensions, enough for pngDimensions to parse.
+func fakePNG(w, h int) []byte {
+	data := make([]byte, 24)
+	copy(data[0:8], pngSignature)
+	binary.BigEndian.PutUint32(data[16:20], uint32(w))
+	binary.BigEndian.PutUint32(data[20:24], uint32(h))
+	return data
+}
+
+// fakeJPEG builds a minimal JPEG with an SOI marker followed directly by
+// an SOF0 segment carrying the given pixel dimensions.
+func fakeJPEG(w, h int) []byte {
+	data := []byte{0xFF, 0xD8, 0xFF, 0xC0, 0x00, 0x11, 0x08}
+	hBytes := []byte{byte(h >> 8), byte(h)}
+	wBytes := []byte{byte(w >> 8), byte(w)}
+	data = append(data, hBytes...)
+	data = append(data, wBytes...)
+	data = append(data, 0x03) // component count, padding for the rest of the segment
+	return data
+}
+
+func TestPNGDimensions(t *testing.T) {
+	w, h, ok := pngDimensions(fakePNG(1024, 768))
+	if !ok || w != 1024 || h != 768 {
+		t.Errorf("pngDimensions() = %d,%d,%v, want 1024,768,true", w, h, ok)
+	}
+}
+
+func TestJPEGDimensions(t *testing.T) {
+	w, h, ok := jpegDimensions(fakeJPEG(800, 600))
+	if !ok || w != 800 || h != 600 {
+		t.Errorf("jpegDimensions() = %d,%d,%v, want 800,600,true", w, h, ok)
+	}
+}
+
+func TestImageDimensions_UnknownMimeFallsBack(t *testing.T) {
+	if _, _, ok := imageDimensions("image/tiff", []byte{1, 2, 3}); ok {
+		t.Error("imageDimensions() for an unsupported MIME type should report ok=false")
+	}
+}
+
+func TestAnthropicImageCost_SmallImage(t *testing.T) {
+	// 100x100 image, well under the 1568px resize cap: ceil(100*100/750).
+	got := anthropicImageCost("image/png", fakePNG(100, 100))
+	want := 14
+	if got != want {
+		t.Errorf("anthropicImageCost() = %d, want %d", got, want)
+	}
+}
+
+func TestAnthropicImageCost_ResizesOversizedImage(t *testing.T) {
+	// A 4000x4000 image gets clamped to 1568x1568 before pricing, not
+	// priced at its raw (much larger) resolution.
+	got := anthropicImageCost("image/png", fakePNG(4000, 4000))
+	uncapped := int(float64(4000*4000) / anthropicPixelsPerToken)
+	if got >= uncapped {
+		t.Errorf("anthropicImageCost() = %d, want less than the uncapped cost %d", got, uncapped)
+	}
+}
+
+func TestGeminiImageCost_SmallImageIsFlatRate(t *testing.T) {
+	got := geminiImageCost("image/png", fakePNG(200, 200))
+	if got != geminiSmallImageTokens {
+		t.Errorf("geminiImageCost() = %d, want flat %d for a <=384x384 image", got, geminiSmallImageTokens)
+	}
+}
+
+func TestGeminiImageCost_TiledForLargeImage(t *testing.T) {
+	got := geminiImageCost("image/png", fakePNG(1536, 768))
+	// 1536x768 = 2 tiles x 1 tile = 2 tiles.
+	want := 2 * geminiTileTokens
+	if got != want {
+		t.Errorf("geminiImageCost() = %d, want %d", got, want)
+	}
+}
+
+func TestOpenAIImageCost_LowDetailFlatRate(t *testing.T) {
+	got := openAIImageCost("image/png", fakePNG(300, 300))
+	if got != openAILowDetailTokens {
+		t.Errorf("openAIImageCost() = %d, want flat %d for a <=512x512 image", got, openAILowDetailTokens)
+	}
+}
+
+func TestOpenAIImageCost_TiledForLargeImage(t *testing.T) {
+	got := openAIImageCost("image/png", fakePNG(1024, 1024))
+	if got <= openAIBaseTokens {
+		t.Errorf("openAIImageCost() = %d, want more than the base %d for a tiled image", got, openAIBaseTokens)
+	}
+}
+
+func TestInlineCostRegistry_ResolveByPrefix(t *testing.T) {
+	r := NewInlineCostRegistry()
+	if r.Resolve("claude-sonnet-4-5") == nil {
+		t.Error("Resolve(claude-sonnet-4-5) should match the claude- preset")
+	}
+	if r.Resolve("unknown-model") != nil {
+		t.Error("Resolve(unknown-model) should report nil, not a guessed preset")
+	}
+}
+
+func TestPDFPageCount_FromPagesCount(t *testing.T) {
+	data := []byte("1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 7 >> endobj")
+	if got := pdfPageCount(data); got != 7 {
+		t.Errorf("pdfPageCount() = %d, want 7", got)
+	}
+}
+
+func TestPDFPageCount_FallsBackToCountingPageObjects(t *testing.T) {
+	data := []byte("1 0 obj << /Type /Page >> endobj 2 0 obj << /Type /Page >> endobj")
+	if got := pdfPageCount(data); got != 2 {
+		t.Errorf("pdfPageCount() = %d, want 2", got)
+	}
+}
+
+func TestPDFPageCount_DefaultsToOne(t *testing.T) {
+	if got := pdfPageCount([]byte("not a pdf")); got != 1 {
+		t.Errorf("pdfPageCount() = %d, want 1 for an unrecognized blob", got)
+	}
+}
+
+func TestImageAwareTokenizer_ReplacesByteRatioWithRealCost(t *testing.T) {
+	registry := NewTokenizerRegistry()
+	registry.SetInlineCostRegistry(NewInlineCostRegistry())
+
+	req := &model.LLMRequest{
+		Model: "claude-sonnet-4-5",
+		Contents: []*genai.Content{
+			{
+				Role: "user",
+				Parts: []*genai.Part{{
+					InlineData: &genai.Blob{MIMEType: "image/png", Data: fakePNG(2000, 2000)},
+				}},
+			},
+		},
+	}
+
+	tokenizer := registry.Resolve("claude-sonnet-4-5")
+	got := tokenizer.CountTokens(req)
+	if got <= 0 {
+		t.Fatalf("CountTokens() = %d, want a positive token count", got)
+	}
+
+	byteRatioOnly := registry.fallback.CountTokens(req)
+	if got == byteRatioOnly {
+		t.Errorf("CountTokens() = %d, want it to differ from the plain byte-ratio estimate %d", got, byteRatioOnly)
+	}
+}
+
+// TestImageAwareTokenizer_FixesByteRatioOvercharge reproduces the bug this
+// chunk fixes: a small, high-resolution-but-heavily-compressed PNG (small
+// file, large pixel area) used to be charged tokens as a fraction of its
+// file size, which both over- and under-charges depending on compression.
+// Pricing by decoded resolution instead corrects that independent of how
+// many bytes the file happens to take on the wire.
+func TestImageAwareTokenizer_FixesByteRatioOvercharge(t *testing.T) {
+	registry := NewTokenizerRegistry()
+	registry.SetInlineCostRegistry(NewInlineCostRegistry())
+
+	// A 4000x4000 screenshot that happens to compress down to a tiny 2KB
+	// file — byte-ratio pricing would under-charge this (500 tokens),
+	// while dimension-based pricing correctly reflects its large,
+	// over-the-1568px-cap resolution.
+	small := fakePNG(4000, 4000)
+	small = append(small, make([]byte, 2_000-len(small))...)
+
+	req := &model.LLMRequest{
+		Model:    "claude-sonnet-4-5",
+		Contents: []*genai.Content{{Role: "user", Parts: []*genai.Part{{InlineData: &genai.Blob{MIMEType: "image/png", Data: small}}}}},
+	}
+
+	byteRatioCost := len(small) / inlineDataBytesPerToken("image/png")
+	resolutionCost := anthropicImageCost("image/png", small)
+	if resolutionCost <= byteRatioCost {
+		t.Errorf("resolution-based cost = %d, want it greater than the byte-ratio cost %d for a heavily compressed high-res image", resolutionCost, byteRatioCost)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+)
+
+// defaultRecallTopK caps how many search_memory hits injectRecallHint folds
+// into its system note, when WithMemoryOffload doesn't specify one.
+const defaultRecallTopK = 3
+
+// MemoryService is the subset of google.golang.org/adk/memory.Service that
+// WithMemoryOffload needs: persisting evicted turns and searching them back
+// out. Matches tools/memory.MemoryService, duplicated locally for the same
+// reason that package duplicates it — so this package doesn't need to
+// depend on the concrete adk/memory.Service type, only its shape.
+type MemoryService interface {
+	AddSession(ctx context.Context, s session.Session) error
+	Search(ctx context.Context, req *memory.SearchRequest) (*memory.SearchResponse, error)
+}
+
+// memoryOffload bridges one agent's compaction to long-term memory: every
+// Content a Strategy evicts is persisted to service before it's gone for
+// good (see offloadEvicted), and every call also injects a short "recall
+// hint" of the memories semantically closest to the latest user message
+// (see injectRecallHint) — so dropped context stays reachable both through
+// the search_memory tool and automatically, without the agent having to
+// think to ask for it.
+type memoryOffload struct {
+	service MemoryService
+	appName string
+	topK    int
+}
+
+// offloadEvicted persists every Content present in before but no longer
+// present in req.Contents — i.e. everything the just-run Strategy.Compact
+// dropped — tagging each one with the session ID and a monotonically
+// increasing turn number so the memory backend can reconstruct eviction
+// order across repeated compactions of the same session.
+func (m *memoryOffload) offloadEvicted(ctx agent.CallbackContext, before []*genai.Content, req *model.LLMRequest) {
+	evicted := evictedPrefix(before, req.Contents)
+	if len(evicted) == 0 {
+		return
+	}
+
+	startTurn := loadOffloadTurn(ctx)
+	sess := &offloadSession{
+		id:        fmt.Sprintf("offload-%s-%d", ctx.SessionID(), startTurn),
+		appName:   m.appName,
+		userID:    ctx.UserID(),
+		sessionID: ctx.SessionID(),
+		startTurn: startTurn,
+		contents:  evicted,
+	}
+
+	if err := m.service.AddSession(ctx, sess); err != nil {
+		slog.Warn("ContextGuard: failed to offload evicted turns to memory",
+			"agent", ctx.AgentName(),
+			"error", err,
+		)
+		return
+	}
+
+	persistOffloadTurn(ctx, startTurn+len(evicted))
+}
+
+// injectRecallHint searches service for the current user turn and, if
+// anything relevant comes back, prepends a system note listing the topK
+// closest hits to req.Contents. A search error or empty result leaves req
+// untouched — the agent still has search_memory to fall back on.
+func (m *memoryOffload) injectRecallHint(ctx agent.CallbackContext, req *model.LLMRequest) {
+	query := firstText(ctx.UserContent())
+	if query == "" {
+		return
+	}
+
+	resp, err := m.service.Search(ctx, &memory.SearchRequest{
+		AppName: m.appName,
+		UserID:  ctx.UserID(),
+		Query:   query,
+	})
+	if err != nil || resp == nil || len(resp.Memories) == 0 {
+		return
+	}
+
+	topK := m.topK
+	if topK <= 0 {
+		topK = defaultRecallTopK
+	}
+
+	var b strings.Builder
+	b.WriteString("[Recalled from long-term memory, most relevant first]\n")
+	n := 0
+	for _, mem := range resp.Memories {
+		if n >= topK {
+			break
+		}
+		text := firstText(mem.Content)
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s\n", text)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	hint := &genai.Content{
+		Role:  "user",
+		Parts: []*genai.Part{{Text: b.String()}},
+	}
+	req.Contents = append([]*genai.Content{hint}, req.Contents...)
+}
+
+// firstText returns the text of the first non-empty Text part in c, or ""
+// if c is nil or has none.
+func firstText(c *genai.Content) string {
+	if c == nil {
+		return ""
+	}
+	for _, part := range c.Parts {
+		if part != nil && part.Text != "" {
+			return part.Text
+		}
+	}
+	return ""
+}
+
+// evictedPrefix returns the leading slice of before with no counterpart in
+// after, found by walking both slices backwards from their ends while
+// pointers match. Every Strategy.Compact implementation drops some prefix
+// of history and keeps the rest verbatim (possibly behind a prepended
+// summary Content), so the longest common pointer-identical suffix of
+// before and after is exactly what survived compaction; anything ahead of
+// it in before was evicted.
+func evictedPrefix(before, after []*genai.Content) []*genai.Content {
+	i, j := len(before)-1, len(after)-1
+	for i >= 0 && j >= 0 && before[i] == after[j] {
+		i--
+		j--
+	}
+	return before[:i+1]
+}
+
+const stateKeyPrefixOffloadTurn = "__context_guard_offload_turn_"
+
+// loadOffloadTurn reads the next turn number offloadEvicted should tag its
+// events with. Returns 0 if no turns have been offloaded yet.
+func loadOffloadTurn(ctx agent.CallbackContext) int {
+	key := stateKeyPrefixOffloadTurn + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return 0
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// persistOffloadTurn records the next turn number for subsequent
+// offloadEvicted calls to resume from.
+func persistOffloadTurn(ctx agent.CallbackContext, turn int) {
+	key := stateKeyPrefixOffloadTurn + ctx.AgentName()
+	if err := ctx.State().Set(key, turn); err != nil {
+		slog.Warn("ContextGuard: failed to persist memory offload turn", "error", err)
+	}
+}
+
+// offloadSession is a minimal session.Session that hands MemoryService one
+// Event per evicted Content, mirroring tools/memory's singleEntrySession but
+// carrying a whole evicted batch tagged with the live session ID and a
+// monotonically increasing turn number instead of one ad-hoc entry.
+type offloadSession struct {
+	id        string
+	appName   string
+	userID    string
+	sessionID string
+	startTurn int
+	contents  []*genai.Content
+}
+
+func (s *offloadSession) ID() string                { return s.id }
+func (s *offloadSession) AppName() string           { return s.appName }
+func (s *offloadSession) UserID() string            { return s.userID }
+func (s *offloadSession) State() session.State      { return nil }
+func (s *offloadSession) LastUpdateTime() time.Time { return time.Now() }
+
+func (s *offloadSession) Events() session.Events {
+	return &offloadEvents{sessionID: s.sessionID, startTurn: s.startTurn, contents: s.contents}
+}
+
+// offloadEvents adapts offloadSession's evicted Contents to session.Events,
+// one Event per Content, numbered startTurn, startTurn+1, ...
+type offloadEvents struct {
+	sessionID string
+	startTurn int
+	contents  []*genai.Content
+}
+
+func (e *offloadEvents) All() iter.Seq[*session.Event] {
+	return func(yield func(*session.Event) bool) {
+		for i, c := range e.contents {
+			if !yield(e.eventAt(i, c)) {
+				return
+			}
+		}
+	}
+}
+
+func (e *offloadEvents) Len() int {
+	return len(e.contents)
+}
+
+func (e *offloadEvents) At(i int) *session.Event {
+	if i < 0 || i >= len(e.contents) {
+		return nil
+	}
+	return e.eventAt(i, e.contents[i])
+}
+
+func (e *offloadEvents) eventAt(i int, c *genai.Content) *session.Event {
+	author := c.Role
+	if author == "" {
+		author = "unknown"
+	}
+	return &session.Event{
+		ID:        fmt.Sprintf("offload-%s-turn-%d", e.sessionID, e.startTurn+i),
+		Author:    author,
+		Timestamp: time.Now(),
+		LLMResponse: model.LLMResponse{
+			Content: c,
+		},
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+)
+
+// fakeMemoryService is a MemoryService that records every AddSession call
+// and returns a scripted Search result, for exercising memoryOffload
+// without a real memory backend.
+type fakeMemoryService struct {
+	addedSessions []session.Session
+	searchResp    *memory.SearchResponse
+	searchErr     error
+}
+
+func (f *fakeMemoryService) AddSession(_ context.Context, s session.Session) error {
+	f.addedSessions = append(f.addedSessions, s)
+	return nil
+}
+
+func (f *fakeMemoryService) Search(_ context.Context, _ *memory.SearchRequest) (*memory.SearchResponse, error) {
+	return f.searchResp, f.searchErr
+}
+
+// withUserContent overrides mockCallbackContext's always-nil UserContent.
+type withUserContent struct {
+	*mockCallbackContext
+	content *genai.Content
+}
+
+func (c *withUserContent) UserContent() *genai.Content { return c.content }
+
+func TestEvictedPrefix_NoChangeWhenNothingEvicted(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "a"),
+		textContent("model", "b"),
+	}
+	got := evictedPrefix(contents, contents)
+	if len(got) != 0 {
+		t.Errorf("evictedPrefix(x, x) = %d entries, want 0", len(got))
+	}
+}
+
+func TestEvictedPrefix_DetectsDroppedLeadingTurns(t *testing.T) {
+	dropped := []*genai.Content{textContent("user", "old1"), textContent("model", "old2")}
+	kept := []*genai.Content{textContent("user", "recent1"), textContent("model", "recent2")}
+	before := append(append([]*genai.Content{}, dropped...), kept...)
+
+	got := evictedPrefix(before, kept)
+	if len(got) != len(dropped) {
+		t.Fatalf("evictedPrefix() = %d entries, want %d", len(got), len(dropped))
+	}
+	for i := range dropped {
+		if got[i] != dropped[i] {
+			t.Errorf("evictedPrefix()[%d] = %p, want %p", i, got[i], dropped[i])
+		}
+	}
+}
+
+func TestEvictedPrefix_DetectsSummaryPrependedAheadOfKeptTail(t *testing.T) {
+	dropped := []*genai.Content{textContent("user", "old1"), textContent("model", "old2")}
+	kept := []*genai.Content{textContent("user", "recent")}
+	before := append(append([]*genai.Content{}, dropped...), kept...)
+
+	after := append([]*genai.Content{textContent("user", "[Previous conversation summary]\n...")}, kept...)
+
+	got := evictedPrefix(before, after)
+	if len(got) != len(dropped) {
+		t.Fatalf("evictedPrefix() = %d entries, want %d (the prepended summary isn't 'evicted')", len(got), len(dropped))
+	}
+}
+
+func TestMemoryOffload_OffloadEvictedPersistsDroppedContentsAndAdvancesTurn(t *testing.T) {
+	svc := &fakeMemoryService{}
+	offload := &memoryOffload{service: svc, appName: "test-app"}
+	ctx := newMockCallbackContext("agent1")
+
+	dropped := []*genai.Content{textContent("user", "old1"), textContent("model", "old2")}
+	recent := textContent("user", "recent")
+	before := append(append([]*genai.Content{}, dropped...), recent)
+	req := &model.LLMRequest{Contents: []*genai.Content{recent}}
+
+	offload.offloadEvicted(ctx, before, req)
+
+	if len(svc.addedSessions) != 1 {
+		t.Fatalf("AddSession called %d times, want 1", len(svc.addedSessions))
+	}
+	events := svc.addedSessions[0].Events()
+	if events.Len() != len(dropped) {
+		t.Fatalf("offloaded %d events, want %d (the dropped turns)", events.Len(), len(dropped))
+	}
+
+	if got := loadOffloadTurn(ctx); got != len(dropped) {
+		t.Errorf("loadOffloadTurn() = %d, want %d (advanced past the offloaded turns)", got, len(dropped))
+	}
+}
+
+func TestMemoryOffload_OffloadEvictedNoopWhenNothingEvicted(t *testing.T) {
+	svc := &fakeMemoryService{}
+	offload := &memoryOffload{service: svc, appName: "test-app"}
+	ctx := newMockCallbackContext("agent1")
+
+	contents := []*genai.Content{textContent("user", "hi")}
+	req := &model.LLMRequest{Contents: contents}
+
+	offload.offloadEvicted(ctx, contents, req)
+
+	if len(svc.addedSessions) != 0 {
+		t.Errorf("AddSession called %d times, want 0 (nothing evicted)", len(svc.addedSessions))
+	}
+}
+
+func TestMemoryOffload_InjectRecallHintNoopWithoutUserContent(t *testing.T) {
+	svc := &fakeMemoryService{searchResp: &memory.SearchResponse{}}
+	offload := &memoryOffload{service: svc, appName: "test-app"}
+	ctx := newMockCallbackContext("agent1") // UserContent() returns nil
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	offload.injectRecallHint(ctx, req)
+
+	if len(req.Contents) != 1 {
+		t.Errorf("req.Contents grew to %d, want unchanged at 1 (no user content to search with)", len(req.Contents))
+	}
+}
+
+func TestMemoryOffload_InjectRecallHintNoopOnSearchError(t *testing.T) {
+	svc := &fakeMemoryService{searchErr: errors.New("backend down")}
+	offload := &memoryOffload{service: svc, appName: "test-app"}
+	ctx := &withUserContent{mockCallbackContext: newMockCallbackContext("agent1"), content: textContent("user", "what did we decide?")}
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	offload.injectRecallHint(ctx, req)
+
+	if len(req.Contents) != 1 {
+		t.Errorf("req.Contents grew to %d, want unchanged at 1 (Search errored)", len(req.Contents))
+	}
+}
+
+func TestMemoryOffload_InjectRecallHintNoopOnEmptyResult(t *testing.T) {
+	svc := &fakeMemoryService{searchResp: &memory.SearchResponse{}}
+	offload := &memoryOffload{service: svc, appName: "test-app"}
+	ctx := &withUserContent{mockCallbackContext: newMockCallbackContext("agent1"), content: textContent("user", "what did we decide?")}
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	offload.injectRecallHint(ctx, req)
+
+	if len(req.Contents) != 1 {
+		t.Errorf("req.Contents grew to %d, want unchanged at 1 (no memories found)", len(req.Contents))
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// hdrBucketBase spaces hdrHistogram's buckets at powers of this value, the
+// same log-linear layout HdrHistogram.js/HdrHistogram-Go use, so a fixed,
+// small number of buckets covers the full hdrMinValue..hdrMaxValue range
+// while keeping relative error bounded (~(hdrBucketBase-1)/2 per bucket)
+// regardless of whether a sample is 10 tokens or 2 million.
+const hdrBucketBase = 1.05
+
+const (
+	hdrMinValue = 1
+	hdrMaxValue = 2_000_000
+)
+
+// hdrLogBase and hdrBucketN are derived once from hdrBucketBase/hdrMaxValue
+// rather than hand-maintained, so changing either constant can't silently
+// leave the other stale.
+var (
+	hdrLogBase = math.Log(hdrBucketBase)
+	hdrBucketN = hdrBucketIndex(hdrMaxValue) + 1
+)
+
+// hdrBucketIndex returns the bucket a value of v falls into: floor(log_base(v)).
+func hdrBucketIndex(v int) int {
+	if v < hdrMinValue {
+		v = hdrMinValue
+	}
+	idx := int(math.Log(float64(v)) / hdrLogBase)
+	if idx < 0 {
+		idx = 0
+	}
+	return idx
+}
+
+// hdrBucketUpperBound returns the largest value that still falls into
+// bucket idx, used as the approximate value returned by Percentile.
+func hdrBucketUpperBound(idx int) int {
+	return int(math.Pow(hdrBucketBase, float64(idx+1)))
+}
+
+// HistogramSnapshot is a point-in-time read-out of an hdrHistogram: count,
+// extremes, mean, and the percentiles callers care about most. Values
+// above P99 aren't tracked individually — query Percentile for any other
+// quantile.
+type HistogramSnapshot struct {
+	Count int
+	Min   int
+	Max   int
+	Mean  float64
+	P50   int
+	P95   int
+	P99   int
+}
+
+// hdrHistogram is a high-dynamic-range histogram: a fixed-size array of
+// log-linear bucket counts (see hdrBucketBase) covering hdrMinValue to
+// hdrMaxValue in a few KB regardless of how many samples are recorded,
+// unlike a literal sorted sample list. Merge is a lossless bucket-wise add,
+// so histograms recorded by independent agent workers can be aggregated
+// centrally without resampling or precision loss.
+type hdrHistogram struct {
+	mu      sync.Mutex
+	buckets []uint64
+	count   uint64
+	sum     float64
+	min     int
+	max     int
+}
+
+func newHDRHistogram() *hdrHistogram {
+	return &hdrHistogram{buckets: make([]uint64, hdrBucketN), min: math.MaxInt}
+}
+
+// Record adds one observation of value (clamped to [hdrMinValue, hdrMaxValue]).
+func (h *hdrHistogram) Record(value int) {
+	if value < hdrMinValue {
+		value = hdrMinValue
+	}
+	if value > hdrMaxValue {
+		value = hdrMaxValue
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buckets[hdrBucketIndex(value)]++
+	h.count++
+	h.sum += float64(value)
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// Merge adds other's bucket counts, sum, and extremes into h. Bucket
+// boundaries are identical across every hdrHistogram (fixed by hdrBucketBase
+// and hdrMaxValue), so this is an exact, lossless aggregation rather than a
+// re-bucketing approximation.
+func (h *hdrHistogram) Merge(other *hdrHistogram) {
+	other.mu.Lock()
+	otherBuckets := append([]uint64(nil), other.buckets...)
+	otherCount, otherSum := other.count, other.sum
+	otherMin, otherMax := other.min, other.max
+	other.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, c := range otherBuckets {
+		h.buckets[i] += c
+	}
+	h.count += otherCount
+	h.sum += otherSum
+	if otherMin < h.min {
+		h.min = otherMin
+	}
+	if otherMax > h.max {
+		h.max = otherMax
+	}
+}
+
+// Percentile returns the approximate value at percentile p (0-100): the
+// upper bound of the bucket in which the cumulative count first reaches
+// p% of all observations. The result can be up to ~(hdrBucketBase-1) of
+// itself above the true value, the price of fixed-memory buckets.
+func (h *hdrHistogram) Percentile(p float64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.percentileLocked(p)
+}
+
+func (h *hdrHistogram) percentileLocked(p float64) int {
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if target == 0 {
+		target = 1
+	}
+	var cum uint64
+	for i, c := range h.buckets {
+		cum += c
+		if cum >= target {
+			return hdrBucketUpperBound(i)
+		}
+	}
+	return h.max
+}
+
+// Snapshot returns a HistogramSnapshot of h's current state.
+func (h *hdrHistogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return HistogramSnapshot{}
+	}
+	return HistogramSnapshot{
+		Count: int(h.count),
+		Min:   h.min,
+		Max:   h.max,
+		Mean:  h.sum / float64(h.count),
+		P50:   h.percentileLocked(50),
+		P95:   h.percentileLocked(95),
+		P99:   h.percentileLocked(99),
+	}
+}
+
+// compactionRatioScale converts a tokensAfter/tokensBefore ratio (typically
+// in (0, 1]) into an hdrHistogram-friendly integer by scaling it up, since
+// hdrHistogram only records positive ints >= hdrMinValue. Snapshot callers
+// divide back by this to recover the ratio.
+const compactionRatioScale = 10_000
+
+// Metrics records high-dynamic-range distributions of token and compaction
+// measurements so operators — and tests — can query percentiles (p50/p95/
+// p99) of turn size, per-tool response size, compaction ratio, and time
+// between compactions, instead of only the boolean overflow/loop-detected
+// flags CompactionObserver and the stress reporter expose. HDRMetrics is
+// the default implementation; MetricsPrometheusExporter renders one for
+// scraping.
+type Metrics interface {
+	// RecordTurnTokens records one LLM call's total token estimate for agent.
+	RecordTurnTokens(agent string, tokens int)
+	// RecordToolResponseTokens records one tool response's token size.
+	RecordToolResponseTokens(tool string, tokens int)
+	// RecordCompactionRatio records one compaction's tokensAfter/tokensBefore
+	// ratio for agent. tokensBefore <= 0 is ignored.
+	RecordCompactionRatio(agent string, tokensBefore, tokensAfter int)
+	// RecordTimeBetweenCompactions records the wall-clock gap between two
+	// consecutive compactions for agent.
+	RecordTimeBetweenCompactions(agent string, d time.Duration)
+}
+
+// HDRMetrics is the default Metrics implementation, backing each recorded
+// dimension with its own per-key hdrHistogram.
+type HDRMetrics struct {
+	mu                     sync.Mutex
+	turnTokens             map[string]*hdrHistogram // by agent
+	toolResponseTokens     map[string]*hdrHistogram // by tool
+	compactionRatio        map[string]*hdrHistogram // by agent, scaled by compactionRatioScale
+	timeBetweenCompactions map[string]*hdrHistogram // by agent, milliseconds
+}
+
+// NewHDRMetrics creates an empty HDRMetrics ready to record into.
+func NewHDRMetrics() *HDRMetrics {
+	return &HDRMetrics{
+		turnTokens:             make(map[string]*hdrHistogram),
+		toolResponseTokens:     make(map[string]*hdrHistogram),
+		compactionRatio:        make(map[string]*hdrHistogram),
+		timeBetweenCompactions: make(map[string]*hdrHistogram),
+	}
+}
+
+func (m *HDRMetrics) histFor(store map[string]*hdrHistogram, key string) *hdrHistogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := store[key]
+	if !ok {
+		h = newHDRHistogram()
+		store[key] = h
+	}
+	return h
+}
+
+func (m *HDRMetrics) RecordTurnTokens(agent string, tokens int) {
+	m.histFor(m.turnTokens, agent).Record(tokens)
+}
+
+func (m *HDRMetrics) RecordToolResponseTokens(tool string, tokens int) {
+	m.histFor(m.toolResponseTokens, tool).Record(tokens)
+}
+
+func (m *HDRMetrics) RecordCompactionRatio(agent string, tokensBefore, tokensAfter int) {
+	if tokensBefore <= 0 {
+		return
+	}
+	ratio := float64(tokensAfter) / float64(tokensBefore)
+	m.histFor(m.compactionRatio, agent).Record(int(ratio * compactionRatioScale))
+}
+
+func (m *HDRMetrics) RecordTimeBetweenCompactions(agent string, d time.Duration) {
+	m.histFor(m.timeBetweenCompactions, agent).Record(int(d.Milliseconds()))
+}
+
+// TurnTokensSnapshot returns agent's turn-token distribution.
+func (m *HDRMetrics) TurnTokensSnapshot(agent string) HistogramSnapshot {
+	return m.histFor(m.turnTokens, agent).Snapshot()
+}
+
+// ToolResponseTokensSnapshot returns tool's response-size distribution.
+func (m *HDRMetrics) ToolResponseTokensSnapshot(tool string) HistogramSnapshot {
+	return m.histFor(m.toolResponseTokens, tool).Snapshot()
+}
+
+// CompactionRatioSnapshot returns agent's compaction-ratio distribution,
+// scaled by compactionRatioScale — divide Mean/P50/P95/P99 by that to
+// recover the tokensAfter/tokensBefore ratio.
+func (m *HDRMetrics) CompactionRatioSnapshot(agent string) HistogramSnapshot {
+	return m.histFor(m.compactionRatio, agent).Snapshot()
+}
+
+// TimeBetweenCompactionsSnapshot returns agent's inter-compaction gap
+// distribution, in milliseconds.
+func (m *HDRMetrics) TimeBetweenCompactionsSnapshot(agent string) HistogramSnapshot {
+	return m.histFor(m.timeBetweenCompactions, agent).Snapshot()
+}
+
+// Merge adds other's histograms into m, bucket-by-bucket, so metrics
+// recorded by independent agent workers can be scraped and aggregated
+// centrally. See hdrHistogram.Merge.
+func (m *HDRMetrics) Merge(other *HDRMetrics) {
+	other.mu.Lock()
+	turnTokens := other.turnTokens
+	toolResponseTokens := other.toolResponseTokens
+	compactionRatio := other.compactionRatio
+	timeBetweenCompactions := other.timeBetweenCompactions
+	other.mu.Unlock()
+
+	m.mergeInto(m.turnTokens, turnTokens)
+	m.mergeInto(m.toolResponseTokens, toolResponseTokens)
+	m.mergeInto(m.compactionRatio, compactionRatio)
+	m.mergeInto(m.timeBetweenCompactions, timeBetweenCompactions)
+}
+
+func (m *HDRMetrics) mergeInto(dst map[string]*hdrHistogram, src map[string]*hdrHistogram) {
+	for key, sh := range src {
+		m.mu.Lock()
+		dh, ok := dst[key]
+		if !ok {
+			dh = newHDRHistogram()
+			dst[key] = dh
+		}
+		m.mu.Unlock()
+		dh.Merge(sh)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MetricsPrometheusExporter renders an HDRMetrics as Prometheus summary
+// metrics: count, sum, and the p50/p95/p99/min/max quantiles already
+// tracked in HistogramSnapshot. It deliberately does not emit HDRMetrics'
+// ~300 raw buckets per series as Prometheus histogram buckets — at one
+// series per agent/tool that would dominate a /metrics response — so
+// quantiles are the unit of aggregation here rather than raw buckets.
+// Pre-merge multiple HDRMetrics with HDRMetrics.Merge for multi-worker
+// scraping before wrapping the result in a MetricsPrometheusExporter.
+type MetricsPrometheusExporter struct {
+	metrics *HDRMetrics
+}
+
+// NewMetricsPrometheusExporter wraps metrics for Prometheus text-exposition
+// rendering via WriteTo.
+func NewMetricsPrometheusExporter(metrics *HDRMetrics) *MetricsPrometheusExporter {
+	return &MetricsPrometheusExporter{metrics: metrics}
+}
+
+// WriteTo renders every series accumulated in the wrapped HDRMetrics in
+// the Prometheus text exposition format to w.
+func (e *MetricsPrometheusExporter) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	sb.WriteString("# HELP contextguard_turn_tokens Token estimate per LLM call, by agent.\n")
+	sb.WriteString("# TYPE contextguard_turn_tokens summary\n")
+	e.writeSeries(&sb, e.metrics.turnTokens, "contextguard_turn_tokens", "agent", 1)
+
+	sb.WriteString("# HELP contextguard_tool_response_tokens Token size of one tool response, by tool.\n")
+	sb.WriteString("# TYPE contextguard_tool_response_tokens summary\n")
+	e.writeSeries(&sb, e.metrics.toolResponseTokens, "contextguard_tool_response_tokens", "tool", 1)
+
+	sb.WriteString("# HELP contextguard_compaction_ratio tokensAfter/tokensBefore for one compaction, by agent.\n")
+	sb.WriteString("# TYPE contextguard_compaction_ratio summary\n")
+	e.writeSeries(&sb, e.metrics.compactionRatio, "contextguard_compaction_ratio", "agent", compactionRatioScale)
+
+	sb.WriteString("# HELP contextguard_time_between_compactions_ms Milliseconds between two consecutive compactions, by agent.\n")
+	sb.WriteString("# TYPE contextguard_time_between_compactions_ms summary\n")
+	e.writeSeries(&sb, e.metrics.timeBetweenCompactions, "contextguard_time_between_compactions_ms", "agent", 1)
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// writeSeries renders one metric across every key in m, dividing every
+// reported value by scale (compactionRatio is stored pre-scaled by
+// compactionRatioScale to fit hdrHistogram's positive-int domain).
+func (e *MetricsPrometheusExporter) writeSeries(sb *strings.Builder, m map[string]*hdrHistogram, name, labelName string, scale float64) {
+	e.metrics.mu.Lock()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	e.metrics.mu.Unlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		snap := m[k].Snapshot()
+		labels := fmt.Sprintf("%s=%q", labelName, k)
+		fmt.Fprintf(sb, "%s{%s,quantile=\"0.5\"} %s\n", name, labels, formatPromFloat(float64(snap.P50)/scale))
+		fmt.Fprintf(sb, "%s{%s,quantile=\"0.95\"} %s\n", name, labels, formatPromFloat(float64(snap.P95)/scale))
+		fmt.Fprintf(sb, "%s{%s,quantile=\"0.99\"} %s\n", name, labels, formatPromFloat(float64(snap.P99)/scale))
+		fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, labels, formatPromFloat(snap.Mean*float64(snap.Count)/scale))
+		fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labels, snap.Count)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metric identifies one of the timeseries MetricsStore tracks.
+type Metric string
+
+const (
+	// MetricPromptTokens is the real per-request prompt token count reported
+	// by the provider's UsageMetadata, recorded on every afterModel call.
+	MetricPromptTokens Metric = "prompt_tokens"
+
+	// MetricHeuristicTokens is the len/4-or-Tokenizer heuristic estimate
+	// recorded alongside MetricPromptTokens, for comparing against it to spot
+	// calibration drift (see CalibrationState).
+	MetricHeuristicTokens Metric = "heuristic_tokens"
+
+	// MetricRealTokens is an alias recorded at the same call sites as
+	// MetricPromptTokens; kept distinct so a query can select "the real
+	// count used for calibration" independently of "the raw prompt token
+	// count", even though today they're the same value.
+	MetricRealTokens Metric = "real_tokens"
+
+	// MetricCompactionsTriggered counts one sample per Compact call that
+	// actually rewrote req.Contents (as opposed to a no-op below-threshold
+	// check).
+	MetricCompactionsTriggered Metric = "compactions_triggered"
+
+	// MetricContentsDroppedByCompaction counts how many Content entries a
+	// triggered compaction replaced with a summary (len(old) for the
+	// full-summary path, or the evicted count under PreserveTail).
+	MetricContentsDroppedByCompaction Metric = "contents_dropped_by_compaction"
+)
+
+// defaultMetricsBucketWidth is MetricsStore's default bucket size.
+const defaultMetricsBucketWidth = 15 * time.Second
+
+// defaultMetricsRetention is how many buckets MetricsStore keeps per series
+// before evicting the oldest — defaultMetricsRetention * defaultMetricsBucketWidth
+// is ~1 hour of history at the defaults.
+const defaultMetricsRetention = 240
+
+// Sample is one (timestamp, value) point returned by Query, oldest first.
+// Timestamp is the start of the bucket the value was aggregated into.
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// metricsSeriesKey identifies one timeseries: a metric tracked for one
+// agent against one model. Query aggregates across every model recorded
+// for a given (agent, metric) pair, since callers usually care about an
+// agent's overall pressure, not a per-model breakdown.
+type metricsSeriesKey struct {
+	agent  string
+	model  string
+	metric Metric
+}
+
+// metricsBucket accumulates every sample recorded within one bucketWidth
+// window for a series.
+type metricsBucket struct {
+	start time.Time
+	sum   float64
+	max   float64
+	count int
+}
+
+// MetricsStore is an in-memory time-series store of per-(agent, model)
+// compaction and token metrics, bucketed into fixed windows with bounded
+// retention. It is the in-process analogue of a Prometheus TSDB scoped to
+// this plugin: contextGuard.afterModel and every strategy's Compact call
+// record samples into it, and ContextGuard.Query answers range-vector style
+// reads plus the sum_over_time/max_over_time/rate aggregations a dashboard
+// or alert rule would want. See Snapshot for a scrape-friendly rollup a
+// caller's own prometheus.Collector can wrap without depending on this
+// store's internal bucket representation.
+type MetricsStore struct {
+	mu          sync.Mutex
+	bucketWidth time.Duration
+	retention   int
+	series      map[metricsSeriesKey][]metricsBucket
+}
+
+// NewMetricsStore creates a MetricsStore. bucketWidth <= 0 selects
+// defaultMetricsBucketWidth; retention <= 0 (the per-series bucket cap)
+// selects defaultMetricsRetention.
+func NewMetricsStore(bucketWidth time.Duration, retention int) *MetricsStore {
+	if bucketWidth <= 0 {
+		bucketWidth = defaultMetricsBucketWidth
+	}
+	if retention <= 0 {
+		retention = defaultMetricsRetention
+	}
+	return &MetricsStore{
+		bucketWidth: bucketWidth,
+		retention:   retention,
+		series:      make(map[metricsSeriesKey][]metricsBucket),
+	}
+}
+
+// Record appends value to the (agent, model, metric) series' bucket
+// covering at, creating a new bucket (and evicting the oldest past
+// retention) if at falls outside the series' most recent bucket.
+func (m *MetricsStore) Record(agent, model string, metric Metric, at time.Time, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := metricsSeriesKey{agent: agent, model: model, metric: metric}
+	buckets := m.series[key]
+	start := at.Truncate(m.bucketWidth)
+
+	if n := len(buckets); n > 0 && buckets[n-1].start.Equal(start) {
+		b := &buckets[n-1]
+		b.sum += value
+		if value > b.max {
+			b.max = value
+		}
+		b.count++
+		return
+	}
+
+	buckets = append(buckets, metricsBucket{start: start, sum: value, max: value, count: 1})
+	if len(buckets) > m.retention {
+		buckets = buckets[len(buckets)-m.retention:]
+	}
+	m.series[key] = buckets
+}
+
+// Incr is Record's counter-style convenience, for the MetricCompactionsTriggered/
+// MetricContentsDroppedByCompaction counters.
+func (m *MetricsStore) Incr(agent, model string, metric Metric, at time.Time, delta int) {
+	m.Record(agent, model, metric, at, float64(delta))
+}
+
+// matchingBuckets returns a flattened, time-sorted copy of every bucket
+// recorded for (agent, metric) across all models, for Query/SumOverTime/
+// MaxOverTime/Rate to aggregate over.
+func (m *MetricsStore) matchingBuckets(agent string, metric Metric) []metricsBucket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []metricsBucket
+	for key, buckets := range m.series {
+		if key.agent != agent || key.metric != metric {
+			continue
+		}
+		out = append(out, buckets...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	return out
+}
+
+// Query returns samples for metric on agent within [start, end), resampled
+// onto a step grid: each returned Sample's Value is the sum of every
+// underlying bucket's sum whose start falls in that step window — the same
+// sum_over_time semantics Prometheus uses when a query_range's step is
+// coarser than the underlying scrape interval. step <= 0 returns one sample
+// per underlying bucket unchanged.
+func (m *MetricsStore) Query(agent string, metric Metric, start, end time.Time, step time.Duration) []Sample {
+	buckets := m.matchingBuckets(agent, metric)
+	if step <= 0 {
+		var out []Sample
+		for _, b := range buckets {
+			if b.start.Before(start) || !b.start.Before(end) {
+				continue
+			}
+			out = append(out, Sample{Timestamp: b.start, Value: b.sum})
+		}
+		return out
+	}
+
+	var out []Sample
+	for windowStart := start; windowStart.Before(end); windowStart = windowStart.Add(step) {
+		windowEnd := windowStart.Add(step)
+		var sum float64
+		var any bool
+		for _, b := range buckets {
+			if b.start.Before(windowStart) || !b.start.Before(windowEnd) {
+				continue
+			}
+			sum += b.sum
+			any = true
+		}
+		if any {
+			out = append(out, Sample{Timestamp: windowStart, Value: sum})
+		}
+	}
+	return out
+}
+
+// SumOverTime totals every bucket's sum for (agent, metric) within
+// [start, end).
+func (m *MetricsStore) SumOverTime(agent string, metric Metric, start, end time.Time) float64 {
+	var total float64
+	for _, b := range m.matchingBuckets(agent, metric) {
+		if b.start.Before(start) || !b.start.Before(end) {
+			continue
+		}
+		total += b.sum
+	}
+	return total
+}
+
+// MaxOverTime returns the largest single recorded value for (agent, metric)
+// within [start, end).
+func (m *MetricsStore) MaxOverTime(agent string, metric Metric, start, end time.Time) float64 {
+	var max float64
+	for _, b := range m.matchingBuckets(agent, metric) {
+		if b.start.Before(start) || !b.start.Before(end) {
+			continue
+		}
+		if b.max > max {
+			max = b.max
+		}
+	}
+	return max
+}
+
+// Rate returns (agent, metric)'s SumOverTime within [start, end) divided by
+// the window's duration in seconds — the per-second rate a counter metric
+// (MetricCompactionsTriggered, MetricContentsDroppedByCompaction) increased
+// over that window. Returns 0 if end is not after start.
+func (m *MetricsStore) Rate(agent string, metric Metric, start, end time.Time) float64 {
+	seconds := end.Sub(start).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return m.SumOverTime(agent, metric, start, end) / seconds
+}
+
+// CollectorSample is one series' most recent bucket, shaped for a caller's
+// own prometheus.Collector.Collect implementation to read without importing
+// this package's internal bucket type. Avg is sum/count, the natural gauge
+// reading for a bucket that received more than one sample (e.g. two LLM
+// calls for the same agent+model landing in the same 15s window).
+type CollectorSample struct {
+	Agent     string
+	Model     string
+	Metric    Metric
+	Timestamp time.Time
+	Sum       float64
+	Max       float64
+	Avg       float64
+}
+
+// Snapshot returns CollectorSample's for the latest bucket of every series
+// currently tracked, in no particular order. This is the scrape-time read a
+// prometheus.Collector wrapping a MetricsStore would call from its Collect
+// method — this package doesn't import client_golang itself, so the actual
+// prometheus.Collector/prometheus.Registerer glue (translating each
+// CollectorSample into a prometheus.Metric with agent/model/metric labels)
+// lives in the operator's own collector package.
+func (m *MetricsStore) Snapshot() []CollectorSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]CollectorSample, 0, len(m.series))
+	for key, buckets := range m.series {
+		if len(buckets) == 0 {
+			continue
+		}
+		last := buckets[len(buckets)-1]
+		avg := last.sum
+		if last.count > 0 {
+			avg = last.sum / float64(last.count)
+		}
+		out = append(out, CollectorSample{
+			Agent:     key.agent,
+			Model:     key.model,
+			Metric:    key.metric,
+			Timestamp: last.start,
+			Sum:       last.sum,
+			Max:       last.max,
+			Avg:       avg,
+		})
+	}
+	return out
+}
@@ -0,0 +1,235 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestMetricsStore_RecordAndQuery_BucketsByWidth(t *testing.T) {
+	m := NewMetricsStore(time.Minute, 10)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base, 100)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(10*time.Second), 50)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(2*time.Minute), 10)
+
+	samples := m.Query("agent1", MetricPromptTokens, base.Add(-time.Minute), base.Add(3*time.Minute), 0)
+	if len(samples) != 2 {
+		t.Fatalf("len(samples) = %d, want 2 (one per minute bucket)", len(samples))
+	}
+	if samples[0].Value != 150 {
+		t.Errorf("samples[0].Value = %v, want 150 (100+50 merged into one bucket)", samples[0].Value)
+	}
+	if samples[1].Value != 10 {
+		t.Errorf("samples[1].Value = %v, want 10", samples[1].Value)
+	}
+}
+
+func TestMetricsStore_Query_ResamplesOntoStep(t *testing.T) {
+	m := NewMetricsStore(time.Second, 100)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		m.Record("agent1", "gpt-4o", MetricCompactionsTriggered, base.Add(time.Duration(i)*time.Second), 1)
+	}
+
+	samples := m.Query("agent1", MetricCompactionsTriggered, base, base.Add(10*time.Second), 5*time.Second)
+	if len(samples) != 2 {
+		t.Fatalf("len(samples) = %d, want 2 (two 5s windows)", len(samples))
+	}
+	if samples[0].Value != 5 || samples[1].Value != 5 {
+		t.Errorf("samples = %+v, want 5 and 5", samples)
+	}
+}
+
+func TestMetricsStore_Incr_AggregatesAcrossModelsForQuery(t *testing.T) {
+	m := NewMetricsStore(time.Minute, 10)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.Incr("agent1", "gpt-4o", MetricContentsDroppedByCompaction, at, 3)
+	m.Incr("agent1", "claude-3", MetricContentsDroppedByCompaction, at, 2)
+
+	got := m.SumOverTime("agent1", MetricContentsDroppedByCompaction, at.Add(-time.Second), at.Add(time.Minute))
+	if got != 5 {
+		t.Errorf("SumOverTime across models = %v, want 5", got)
+	}
+}
+
+func TestMetricsStore_MaxOverTime_ReturnsLargestSingleSample(t *testing.T) {
+	m := NewMetricsStore(time.Minute, 10)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base, 100)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(2*time.Minute), 900)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(4*time.Minute), 300)
+
+	got := m.MaxOverTime("agent1", MetricPromptTokens, base.Add(-time.Minute), base.Add(5*time.Minute))
+	if got != 900 {
+		t.Errorf("MaxOverTime = %v, want 900", got)
+	}
+}
+
+func TestMetricsStore_Rate_DividesSumByWindowSeconds(t *testing.T) {
+	m := NewMetricsStore(time.Second, 100)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		m.Incr("agent1", "gpt-4o", MetricCompactionsTriggered, base.Add(time.Duration(i)*time.Second), 1)
+	}
+
+	got := m.Rate("agent1", MetricCompactionsTriggered, base, base.Add(4*time.Second))
+	if got != 1 {
+		t.Errorf("Rate = %v, want 1 (4 events over 4 seconds)", got)
+	}
+}
+
+func TestMetricsStore_Rate_ZeroWindowReturnsZero(t *testing.T) {
+	m := NewMetricsStore(0, 0)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := m.Rate("agent1", MetricCompactionsTriggered, at, at); got != 0 {
+		t.Errorf("Rate with zero-width window = %v, want 0", got)
+	}
+}
+
+func TestMetricsStore_Record_EvictsOldestPastRetention(t *testing.T) {
+	m := NewMetricsStore(time.Minute, 3)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(time.Duration(i)*time.Minute), 1)
+	}
+
+	samples := m.Query("agent1", MetricPromptTokens, base.Add(-time.Minute), base.Add(6*time.Minute), 0)
+	if len(samples) != 3 {
+		t.Fatalf("len(samples) = %d, want 3 (retention cap)", len(samples))
+	}
+	if samples[0].Timestamp.Before(base.Add(2 * time.Minute)) {
+		t.Errorf("oldest surviving bucket = %v, want the 3 most recent buckets", samples[0].Timestamp)
+	}
+}
+
+func TestMetricsStore_Snapshot_ReturnsLatestBucketPerSeries(t *testing.T) {
+	m := NewMetricsStore(time.Minute, 10)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base, 100)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base, 50)
+	m.Record("agent1", "gpt-4o", MetricPromptTokens, base.Add(time.Minute), 10)
+
+	snap := m.Snapshot()
+	if len(snap) != 1 {
+		t.Fatalf("len(snap) = %d, want 1 series", len(snap))
+	}
+	s := snap[0]
+	if s.Agent != "agent1" || s.Model != "gpt-4o" || s.Metric != MetricPromptTokens {
+		t.Errorf("snapshot series = %+v, want agent1/gpt-4o/prompt_tokens", s)
+	}
+	if s.Sum != 10 || s.Max != 10 || s.Avg != 10 {
+		t.Errorf("snapshot latest bucket = %+v, want the most recent bucket (sum=max=avg=10)", s)
+	}
+}
+
+func TestWithMetrics_InstallsCustomStore(t *testing.T) {
+	store := NewMetricsStore(time.Second, 5)
+	g := New(newMockRegistry(), WithMetrics(store))
+
+	if g.metrics != store {
+		t.Error("WithMetrics did not install the provided *MetricsStore")
+	}
+}
+
+func TestContextGuard_QueryAndAggregates_Passthrough(t *testing.T) {
+	g := New(newMockRegistry())
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	g.metrics.Record("agent1", "gpt-4o", MetricPromptTokens, at, 500)
+
+	samples := g.Query("agent1", MetricPromptTokens, at.Add(-time.Minute), at.Add(time.Minute), 0)
+	if len(samples) != 1 || samples[0].Value != 500 {
+		t.Errorf("Query passthrough = %+v, want one sample of 500", samples)
+	}
+	if got := g.SumOverTime("agent1", MetricPromptTokens, at.Add(-time.Minute), at.Add(time.Minute)); got != 500 {
+		t.Errorf("SumOverTime passthrough = %v, want 500", got)
+	}
+	if got := g.MaxOverTime("agent1", MetricPromptTokens, at.Add(-time.Minute), at.Add(time.Minute)); got != 500 {
+		t.Errorf("MaxOverTime passthrough = %v, want 500", got)
+	}
+}
+
+func TestRecordCompactionMetrics_SkipsNoOpCompactions(t *testing.T) {
+	store := NewMetricsStore(time.Minute, 10)
+	g := &contextGuard{strategies: map[string]Strategy{}, metrics: store}
+	ctx := newMockCallbackContext("agent1")
+
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: []*genai.Content{textContent("user", "hi")}}
+	g.recordCompactionMetrics(ctx, req, len(req.Contents))
+
+	if got := store.SumOverTime("agent1", MetricCompactionsTriggered, time.Now().Add(-time.Minute), time.Now().Add(time.Minute)); got != 0 {
+		t.Errorf("recordCompactionMetrics recorded a no-op compaction, SumOverTime = %v, want 0", got)
+	}
+}
+
+func TestRecordCompactionMetrics_RecordsDroppedContents(t *testing.T) {
+	store := NewMetricsStore(time.Minute, 10)
+	g := &contextGuard{strategies: map[string]Strategy{}, metrics: store}
+	ctx := newMockCallbackContext("agent1")
+
+	before := 10
+	req := &model.LLMRequest{Model: "gpt-4o", Contents: []*genai.Content{textContent("user", "summary")}}
+	g.recordCompactionMetrics(ctx, req, before)
+
+	now := time.Now()
+	if got := store.SumOverTime("agent1", MetricCompactionsTriggered, now.Add(-time.Minute), now.Add(time.Minute)); got != 1 {
+		t.Errorf("MetricCompactionsTriggered sum = %v, want 1", got)
+	}
+	if got := store.SumOverTime("agent1", MetricContentsDroppedByCompaction, now.Add(-time.Minute), now.Add(time.Minute)); got != 9 {
+		t.Errorf("MetricContentsDroppedByCompaction sum = %v, want 9", got)
+	}
+}
+
+func TestAfterModel_RecordsTokenMetrics(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm)
+
+	g := &contextGuard{strategies: guard.strategies, metrics: guard.metrics}
+	ctx := newMockCallbackContext("agent1")
+	persistLastModel(ctx, "gpt-4o")
+	persistLastHeuristic(ctx, 40_000)
+
+	resp := &model.LLMResponse{
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 50_000,
+		},
+	}
+	if _, err := g.afterModel(ctx, resp, nil); err != nil {
+		t.Fatalf("afterModel error: %v", err)
+	}
+
+	now := time.Now()
+	if got := guard.metrics.MaxOverTime("agent1", MetricPromptTokens, now.Add(-time.Minute), now.Add(time.Minute)); got != 50_000 {
+		t.Errorf("MetricPromptTokens = %v, want 50000", got)
+	}
+	if got := guard.metrics.MaxOverTime("agent1", MetricHeuristicTokens, now.Add(-time.Minute), now.Add(time.Minute)); got != 40_000 {
+		t.Errorf("MetricHeuristicTokens = %v, want 40000", got)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+// modelLookup is implemented by ModelRegistry backends that can report
+// whether they actually hold data for a given model ID, as opposed to
+// silently returning a fallback default (e.g. CrushRegistry's 128000/4096).
+// CompositeRegistry uses this to skip a registry's default rather than
+// mistaking it for a real hit; a registry that doesn't implement it is
+// always treated as authoritative (its answer, default or not, is returned
+// and the rest of the chain is never consulted).
+type modelLookup interface {
+	HasModel(modelID string) bool
+}
+
+// CompositeRegistry chains ModelRegistry implementations in priority order,
+// so local overrides (a FileRegistry describing private/self-hosted models
+// like gpt-oss, qwen3-coder, or Bedrock-hosted variants) can augment or
+// shadow a shared source like CrushRegistry without forking it.
+//
+// ContextWindow and DefaultMaxTokens try each registry in order and return
+// the first one that either doesn't implement modelLookup (so it can't
+// distinguish a default from a real hit, and is trusted outright) or reports
+// HasModel true. If every registry in the chain claims not to have the
+// model, the last registry's answer is returned, so a composite still always
+// resolves to a usable default even when none of it knows the model.
+//
+// Usage:
+//
+//	registry := contextguard.CompositeRegistry{fileRegistry, contextguard.NewCrushRegistry()}
+//	guard := contextguard.New(registry)
+type CompositeRegistry []ModelRegistry
+
+// ContextWindow returns the first registry's ContextWindow whose modelLookup
+// (if implemented) reports HasModel true, falling back to the last
+// registry's answer if none claim the model.
+func (c CompositeRegistry) ContextWindow(modelID string) int {
+	if len(c) == 0 {
+		return crushDefaultCtxWindow
+	}
+	for _, reg := range c {
+		if lookup, ok := reg.(modelLookup); ok && !lookup.HasModel(modelID) {
+			continue
+		}
+		return reg.ContextWindow(modelID)
+	}
+	return c[len(c)-1].ContextWindow(modelID)
+}
+
+// DefaultMaxTokens returns the first registry's DefaultMaxTokens whose
+// modelLookup (if implemented) reports HasModel true, falling back to the
+// last registry's answer if none claim the model.
+func (c CompositeRegistry) DefaultMaxTokens(modelID string) int {
+	if len(c) == 0 {
+		return crushDefaultMaxTokens
+	}
+	for _, reg := range c {
+		if lookup, ok := reg.(modelLookup); ok && !lookup.HasModel(modelID) {
+			continue
+		}
+		return reg.DefaultMaxTokens(modelID)
+	}
+	return c[len(c)-1].DefaultMaxTokens(modelID)
+}
+
+// HasModel reports whether any registry in the chain claims modelID,
+// implementing modelLookup so a CompositeRegistry can itself be nested
+// inside another CompositeRegistry.
+func (c CompositeRegistry) HasModel(modelID string) bool {
+	for _, reg := range c {
+		if lookup, ok := reg.(modelLookup); ok {
+			if lookup.HasModel(modelID) {
+				return true
+			}
+			continue
+		}
+		// A registry with no modelLookup can't say "I don't have this", so
+		// its mere presence in the chain counts as a claim.
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFileRegistry(t *testing.T, doc string) *FileRegistry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatalf("writing registry file: %v", err)
+	}
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+	return r
+}
+
+func TestCompositeRegistry_PrefersFirstHit(t *testing.T) {
+	override := writeFileRegistry(t, `{"models":[
+		{"id":"local-model","context_window":32000,"default_max_tokens":2048}
+	]}`)
+	fallback := &mockRegistry{
+		contextWindows: map[string]int{"claude-sonnet": 200_000},
+		maxTokens:      map[string]int{"claude-sonnet": 8192},
+	}
+
+	composite := CompositeRegistry{override, fallback}
+
+	if got := composite.ContextWindow("local-model"); got != 32000 {
+		t.Errorf("ContextWindow(local-model) = %d, want 32000", got)
+	}
+	if got := composite.ContextWindow("claude-sonnet"); got != 200_000 {
+		t.Errorf("ContextWindow(claude-sonnet) = %d, want 200000 (fallthrough to fallback)", got)
+	}
+}
+
+func TestCompositeRegistry_FallsThroughWhenFileRegistryMisses(t *testing.T) {
+	override := writeFileRegistry(t, `{"models":[{"id":"local-model","context_window":32000}]}`)
+	fallback := &mockRegistry{
+		contextWindows: map[string]int{"claude-sonnet": 200_000},
+		maxTokens:      map[string]int{"claude-sonnet": 8192},
+	}
+
+	composite := CompositeRegistry{override, fallback}
+
+	if got := composite.DefaultMaxTokens("claude-sonnet"); got != 8192 {
+		t.Errorf("DefaultMaxTokens(claude-sonnet) = %d, want 8192", got)
+	}
+}
+
+func TestCompositeRegistry_UnknownModelFallsBackToLast(t *testing.T) {
+	override := writeFileRegistry(t, `{"models":[{"id":"local-model","context_window":32000}]}`)
+	fallback := &mockRegistry{
+		contextWindows: map[string]int{},
+		maxTokens:      map[string]int{},
+	}
+
+	composite := CompositeRegistry{override, fallback}
+
+	if got := composite.ContextWindow("totally-unknown"); got != fallback.ContextWindow("totally-unknown") {
+		t.Errorf("ContextWindow(totally-unknown) = %d, want fallback's default %d", got, fallback.ContextWindow("totally-unknown"))
+	}
+}
+
+func TestCompositeRegistry_Empty(t *testing.T) {
+	var composite CompositeRegistry
+	if got := composite.ContextWindow("anything"); got != crushDefaultCtxWindow {
+		t.Errorf("ContextWindow on empty composite = %d, want %d", got, crushDefaultCtxWindow)
+	}
+	if composite.HasModel("anything") {
+		t.Error("HasModel on empty composite = true, want false")
+	}
+}
+
+func TestCompositeRegistry_HasModel(t *testing.T) {
+	a := writeFileRegistry(t, `{"models":[{"id":"local-model","context_window":32000}]}`)
+	b := writeFileRegistry(t, `{"models":[{"id":"other-model","context_window":16000}]}`)
+
+	composite := CompositeRegistry{a, b}
+
+	if !composite.HasModel("local-model") {
+		t.Error("HasModel(local-model) = false, want true")
+	}
+	if !composite.HasModel("other-model") {
+		t.Error("HasModel(other-model) = false, want true (should check every registry in the chain)")
+	}
+	if composite.HasModel("totally-unknown") {
+		t.Error("HasModel(totally-unknown) = true, want false when every registry implements modelLookup and none has it")
+	}
+}
+
+// TestCompositeRegistry_HasModel_NonLookupRegistryCountsAsClaim documents
+// that a registry with no modelLookup can't say "I don't have this", so its
+// mere presence makes HasModel report true for any model ID.
+func TestCompositeRegistry_HasModel_NonLookupRegistryCountsAsClaim(t *testing.T) {
+	composite := CompositeRegistry{newMockRegistry()}
+	if !composite.HasModel("totally-unknown") {
+		t.Error("HasModel with a non-modelLookup registry in the chain = false, want true")
+	}
+}
@@ -15,23 +15,33 @@
 package contextguard
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
 const (
-	crushSourceURL         = "https://raw.githubusercontent.com/charmbracelet/crush/main/internal/agent/hyper/provider.json"
-	crushRefreshInterval   = 6 * time.Hour
-	crushFetchTimeout      = 15 * time.Second
-	crushDefaultCtxWindow  = 128000
-	crushDefaultMaxTokens  = 4096
-	crushMaxResponseBytes  = 2 << 20
+	crushSourceURL        = "https://raw.githubusercontent.com/charmbracelet/crush/main/internal/agent/hyper/provider.json"
+	crushRefreshInterval  = 6 * time.Hour
+	crushFetchTimeout     = 15 * time.Second
+	crushDefaultCtxWindow = 128000
+	crushDefaultMaxTokens = 4096
+	crushMaxResponseBytes = 2 << 20
+
+	// crushCacheSubdir and crushCacheFileName compose the default cache
+	// path: $XDG_CACHE_HOME/contextguard/crush-provider.json.gz (os.UserCacheDir
+	// already resolves XDG_CACHE_HOME on Linux, falling back to the platform
+	// convention elsewhere).
+	crushCacheSubdir   = "contextguard"
+	crushCacheFileName = "crush-provider.json.gz"
 )
 
 // crushModelInfo holds the metadata for a single LLM model as read from
@@ -51,9 +61,84 @@ type crushProviderJSON struct {
 	Models []crushModelInfo `json:"models"`
 }
 
+// crushCacheFile is the gzip-compressed JSON document persisted to disk
+// between processes. ETag and LastModified are carried alongside the models
+// so a restarted process can issue a conditional request instead of always
+// re-downloading and re-parsing provider.json from scratch.
+type crushCacheFile struct {
+	ETag         string                    `json:"etag,omitempty"`
+	LastModified string                    `json:"last_modified,omitempty"`
+	Models       map[string]crushModelInfo `json:"models"`
+}
+
+// CrushOption configures a CrushRegistry at construction time.
+type CrushOption func(*CrushRegistry)
+
+// WithCacheFile overrides the on-disk cache path (default
+// $XDG_CACHE_HOME/contextguard/crush-provider.json.gz, via defaultCrushCacheFile).
+// An empty path disables on-disk caching entirely.
+func WithCacheFile(path string) CrushOption {
+	return func(r *CrushRegistry) {
+		r.cacheFile = path
+	}
+}
+
+// WithRefreshInterval overrides the background refresh period (default
+// crushRefreshInterval, 6 hours).
+func WithRefreshInterval(d time.Duration) CrushOption {
+	return func(r *CrushRegistry) {
+		r.refreshInterval = d
+	}
+}
+
+// WithCrushTokenizerRegistry installs registry as the TokenizerRegistry
+// Tokenizers returns, instead of the lazily-constructed NewTokenizerRegistry
+// default. Use this to register provider-specific overrides (e.g. a real
+// NewTiktokenTokenizer) that Tokenizers should resolve for the models this
+// CrushRegistry already knows the context windows and max tokens for.
+func WithCrushTokenizerRegistry(registry *TokenizerRegistry) CrushOption {
+	return func(r *CrushRegistry) {
+		r.tokenizers = registry
+	}
+}
+
+// Tokenizers returns the TokenizerRegistry this CrushRegistry resolves
+// per-model Tokenizers from, lazily creating the NewTokenizerRegistry
+// default (gpt-/o1-/o3-/o4- → OpenAI, claude- → Anthropic, gemini- →
+// Google) on first use unless WithCrushTokenizerRegistry overrode it.
+// ContextGuard.Add calls this for an agent that didn't configure its own
+// WithTokenizerRegistry/WithTokenizer, so a single CrushRegistry supplies
+// both a model's limits and its tokenizer.
+func (r *CrushRegistry) Tokenizers() *TokenizerRegistry {
+	r.tokenizersMu.Lock()
+	defer r.tokenizersMu.Unlock()
+	if r.tokenizers == nil {
+		r.tokenizers = NewTokenizerRegistry()
+	}
+	return r.tokenizers
+}
+
+// defaultCrushCacheFile returns $XDG_CACHE_HOME/contextguard/crush-provider.json.gz
+// (os.UserCacheDir resolves XDG_CACHE_HOME on Linux and the platform
+// convention elsewhere). Returns "" if no cache directory can be determined,
+// in which case on-disk caching is simply skipped.
+func defaultCrushCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, crushCacheSubdir, crushCacheFileName)
+}
+
 // CrushRegistry implements ModelRegistry by fetching and caching model
 // metadata from Crush's provider.json. It refreshes in the background
-// every 6 hours.
+// every refreshInterval (default 6 hours), using conditional requests
+// (If-None-Match / If-Modified-Since) so an unchanged upstream file costs a
+// 304 instead of a full re-download and re-parse. The last-good payload is
+// persisted gzip-compressed to cacheFile and loaded on Start before the
+// first network fetch, so a process that comes up offline (or while GitHub
+// is unreachable) still serves real model data instead of falling back to
+// the 128k/4096 defaults.
 //
 // Usage:
 //
@@ -63,29 +148,46 @@ type crushProviderJSON struct {
 //
 //	guard := contextguard.New(registry)
 type CrushRegistry struct {
-	mu     sync.RWMutex
-	models map[string]crushModelInfo
+	mu           sync.RWMutex
+	models       map[string]crushModelInfo
+	etag         string
+	lastModified string
+
 	cancel context.CancelFunc
+
+	cacheFile       string
+	refreshInterval time.Duration
+
+	tokenizersMu sync.Mutex
+	tokenizers   *TokenizerRegistry
 }
 
 // NewCrushRegistry creates an empty registry. Call Start to populate it
 // and begin periodic refresh.
-func NewCrushRegistry() *CrushRegistry {
-	return &CrushRegistry{
-		models: make(map[string]crushModelInfo),
+func NewCrushRegistry(opts ...CrushOption) *CrushRegistry {
+	r := &CrushRegistry{
+		models:          make(map[string]crushModelInfo),
+		cacheFile:       defaultCrushCacheFile(),
+		refreshInterval: crushRefreshInterval,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-// Start performs the initial fetch and spawns a background goroutine
-// that refreshes every 6 hours.
+// Start loads the on-disk cache (if any), performs the initial fetch, and
+// spawns a background goroutine that refreshes every refreshInterval.
 func (r *CrushRegistry) Start(ctx context.Context) {
+	r.loadCache()
+
 	ctx, cancel := context.WithCancel(ctx)
 	r.cancel = cancel
 
 	r.fetch()
 
 	go func() {
-		ticker := time.NewTicker(crushRefreshInterval)
+		ticker := time.NewTicker(r.refreshInterval)
 		defer ticker.Stop()
 		for {
 			select {
@@ -127,9 +229,115 @@ func (r *CrushRegistry) DefaultMaxTokens(modelID string) int {
 	return crushDefaultMaxTokens
 }
 
-// fetch downloads the provider.json, parses it, and atomically replaces
-// the in-memory model map. Errors are logged and silently ignored so the
-// registry keeps serving stale data rather than failing.
+// HasModel reports whether modelID was present in the last successfully
+// fetched or loaded provider.json, as opposed to ContextWindow/
+// DefaultMaxTokens silently falling back to their package defaults.
+// Implements modelLookup so CompositeRegistry can tell a real hit from a
+// default.
+func (r *CrushRegistry) HasModel(modelID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.models[modelID]
+	return ok
+}
+
+// CostPerMillionTokens returns the input/output cost per million tokens for
+// the given model ID, as reported by Crush's provider.json. Returns 0, 0 if
+// the model is not found. Implements the contextguard costProvider interface
+// so strategies (e.g. the summarization strategy's Stats method) can report
+// estimated spend.
+func (r *CrushRegistry) CostPerMillionTokens(modelID string) (in, out float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if info, ok := r.models[modelID]; ok {
+		return info.CostPerMIn, info.CostPerMOut
+	}
+	return 0, 0
+}
+
+// loadCache populates r.models, r.etag, and r.lastModified from cacheFile, if
+// it exists and is readable. A missing or corrupt cache file just leaves the
+// registry empty, the same as a freshly-constructed one — Start's subsequent
+// fetch() will populate it over the network instead.
+func (r *CrushRegistry) loadCache() {
+	if r.cacheFile == "" {
+		return
+	}
+
+	f, err := os.Open(r.cacheFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		slog.Warn("CrushRegistry: failed to decompress cache file", "path", r.cacheFile, "error", err)
+		return
+	}
+	defer gz.Close()
+
+	var cache crushCacheFile
+	if err := json.NewDecoder(gz).Decode(&cache); err != nil {
+		slog.Warn("CrushRegistry: failed to decode cache file", "path", r.cacheFile, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	r.models = cache.Models
+	r.etag = cache.ETag
+	r.lastModified = cache.LastModified
+	r.mu.Unlock()
+
+	slog.Info(fmt.Sprintf("CrushRegistry: loaded %d models from cache", len(cache.Models)), "path", r.cacheFile)
+}
+
+// saveCache gzip-compresses and writes the current models/etag/lastModified
+// to cacheFile, creating any missing parent directories. Errors are logged
+// and otherwise ignored — a failed write only means the next cold start
+// falls back to a network fetch, same as today.
+func (r *CrushRegistry) saveCache() {
+	if r.cacheFile == "" {
+		return
+	}
+
+	r.mu.RLock()
+	cache := crushCacheFile{
+		ETag:         r.etag,
+		LastModified: r.lastModified,
+		Models:       r.models,
+	}
+	r.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(r.cacheFile), 0o755); err != nil {
+		slog.Warn("CrushRegistry: failed to create cache directory", "path", r.cacheFile, "error", err)
+		return
+	}
+
+	f, err := os.Create(r.cacheFile)
+	if err != nil {
+		slog.Warn("CrushRegistry: failed to create cache file", "path", r.cacheFile, "error", err)
+		return
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if err := json.NewEncoder(gz).Encode(cache); err != nil {
+		slog.Warn("CrushRegistry: failed to encode cache file", "path", r.cacheFile, "error", err)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		slog.Warn("CrushRegistry: failed to flush cache file", "path", r.cacheFile, "error", err)
+	}
+}
+
+// fetch conditionally downloads the provider.json, parses it, and atomically
+// replaces the in-memory model map. If the previous response's ETag or
+// Last-Modified is known, it's sent as If-None-Match / If-Modified-Since; a
+// 304 response skips parsing entirely and keeps serving whatever is already
+// in memory (loaded from disk or a prior fetch). Errors are logged and
+// silently ignored so the registry keeps serving stale data rather than
+// failing.
 func (r *CrushRegistry) fetch() {
 	ctx, cancel := context.WithTimeout(context.Background(), crushFetchTimeout)
 	defer cancel()
@@ -140,6 +348,16 @@ func (r *CrushRegistry) fetch() {
 		return
 	}
 
+	r.mu.RLock()
+	etag, lastModified := r.etag, r.lastModified
+	r.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		slog.Warn("CrushRegistry: fetch failed", "error", err)
@@ -147,6 +365,11 @@ func (r *CrushRegistry) fetch() {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		slog.Info("CrushRegistry: provider.json not modified, skipping re-parse")
+		return
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		slog.Warn("CrushRegistry: unexpected status", "status", resp.StatusCode)
 		return
@@ -171,7 +394,11 @@ func (r *CrushRegistry) fetch() {
 
 	r.mu.Lock()
 	r.models = models
+	r.etag = resp.Header.Get("ETag")
+	r.lastModified = resp.Header.Get("Last-Modified")
 	r.mu.Unlock()
 
 	slog.Info(fmt.Sprintf("CrushRegistry: loaded %d models", len(models)))
+
+	r.saveCache()
 }
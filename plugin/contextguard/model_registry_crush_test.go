@@ -0,0 +1,118 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCrushRegistry_CacheRoundTrip(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "nested", "crush-provider.json.gz")
+
+	r := NewCrushRegistry(WithCacheFile(cacheFile))
+	r.models = map[string]crushModelInfo{
+		"claude-sonnet": {ID: "claude-sonnet", ContextWindow: 200_000, DefaultMaxTokens: 8192},
+	}
+	r.etag = `"abc123"`
+	r.lastModified = "Wed, 01 Jan 2025 00:00:00 GMT"
+
+	r.saveCache()
+
+	r2 := NewCrushRegistry(WithCacheFile(cacheFile))
+	r2.loadCache()
+
+	if got := r2.ContextWindow("claude-sonnet"); got != 200_000 {
+		t.Errorf("ContextWindow after cache load = %d, want 200000", got)
+	}
+	if got := r2.DefaultMaxTokens("claude-sonnet"); got != 8192 {
+		t.Errorf("DefaultMaxTokens after cache load = %d, want 8192", got)
+	}
+	if r2.etag != `"abc123"` {
+		t.Errorf("etag after cache load = %q, want %q", r2.etag, `"abc123"`)
+	}
+	if r2.lastModified != "Wed, 01 Jan 2025 00:00:00 GMT" {
+		t.Errorf("lastModified after cache load = %q", r2.lastModified)
+	}
+}
+
+func TestCrushRegistry_LoadCacheMissingFileIsNoop(t *testing.T) {
+	r := NewCrushRegistry(WithCacheFile(filepath.Join(t.TempDir(), "does-not-exist.json.gz")))
+	r.loadCache()
+
+	if got := r.ContextWindow("anything"); got != crushDefaultCtxWindow {
+		t.Errorf("ContextWindow with no cache = %d, want default %d", got, crushDefaultCtxWindow)
+	}
+}
+
+func TestCrushRegistry_WithRefreshInterval(t *testing.T) {
+	r := NewCrushRegistry(WithRefreshInterval(30 * time.Minute))
+	if r.refreshInterval != 30*time.Minute {
+		t.Errorf("refreshInterval = %v, want 30m", r.refreshInterval)
+	}
+}
+
+func TestCrushRegistry_DefaultsWithoutOptions(t *testing.T) {
+	r := NewCrushRegistry()
+	if r.refreshInterval != crushRefreshInterval {
+		t.Errorf("refreshInterval default = %v, want %v", r.refreshInterval, crushRefreshInterval)
+	}
+}
+
+func TestCrushRegistry_Tokenizers_LazilyCreatesDefault(t *testing.T) {
+	r := NewCrushRegistry()
+
+	got := r.Tokenizers()
+	if got == nil {
+		t.Fatal("Tokenizers() = nil, want a lazily-created default registry")
+	}
+	if got2 := r.Tokenizers(); got2 != got {
+		t.Error("Tokenizers() returned a different registry on a second call, want the same lazily-created instance")
+	}
+}
+
+func TestCrushRegistry_WithCrushTokenizerRegistry_OverridesDefault(t *testing.T) {
+	custom := NewTokenizerRegistry()
+	r := NewCrushRegistry(WithCrushTokenizerRegistry(custom))
+
+	if got := r.Tokenizers(); got != custom {
+		t.Errorf("Tokenizers() = %p, want the registry passed to WithCrushTokenizerRegistry", got)
+	}
+}
+
+func TestResolveTokenizerRegistry_ExplicitWins(t *testing.T) {
+	explicit := NewTokenizerRegistry()
+	r := NewCrushRegistry(WithCrushTokenizerRegistry(NewTokenizerRegistry()))
+
+	if got := resolveTokenizerRegistry(r, explicit); got != explicit {
+		t.Error("resolveTokenizerRegistry() did not prefer the explicit registry over the provider's")
+	}
+}
+
+func TestResolveTokenizerRegistry_FallsBackToProvider(t *testing.T) {
+	r := NewCrushRegistry()
+
+	got := resolveTokenizerRegistry(r, nil)
+	if got != r.Tokenizers() {
+		t.Error("resolveTokenizerRegistry() did not fall back to the ModelRegistry's own TokenizerRegistry")
+	}
+}
+
+func TestResolveTokenizerRegistry_NilWhenNeitherAvailable(t *testing.T) {
+	if got := resolveTokenizerRegistry(newMockRegistry(), nil); got != nil {
+		t.Errorf("resolveTokenizerRegistry() = %v, want nil (mockRegistry isn't a tokenizerProvider)", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileModelInfo holds the metadata for a single model entry in a FileRegistry
+// document. It extends crushModelInfo's shape with the fields a local
+// override file needs but Crush's provider.json doesn't carry: per-token
+// cost for models Crush doesn't know about, the tokenizer to use for it, and
+// any aliases the model is also addressed by (e.g. a deployment name that
+// differs from the upstream model ID).
+type fileModelInfo struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	ContextWindow     int      `json:"context_window"`
+	DefaultMaxTokens  int      `json:"default_max_tokens"`
+	InputCostPerMTok  float64  `json:"input_cost_usd_per_mtok"`
+	OutputCostPerMTok float64  `json:"output_cost_usd_per_mtok"`
+	Tokenizer         string   `json:"tokenizer"`
+	Aliases           []string `json:"aliases"`
+}
+
+// fileProviderJSON mirrors the top-level structure of a FileRegistry
+// document, deliberately kept compatible with crushProviderJSON's shape so
+// a file can start as an exported/edited copy of Crush's provider.json.
+type fileProviderJSON struct {
+	Models []fileModelInfo `json:"models"`
+}
+
+// FileRegistry is a ModelRegistry backed by a local JSON file, for models a
+// shared source like CrushRegistry doesn't know about: self-hosted models,
+// private fine-tunes, or fast local overrides while waiting on an upstream
+// update. It's meant to be combined with other registries via
+// CompositeRegistry rather than used standalone.
+//
+// Only JSON is supported. The repo has no go.mod to declare a YAML
+// dependency against and doesn't vendor one elsewhere, so adding YAML
+// parsing here would mean introducing a new third-party dependency with no
+// way to pin or vendor it — callers who want YAML can convert it to JSON
+// ahead of time.
+type FileRegistry struct {
+	mu     sync.RWMutex
+	models map[string]fileModelInfo
+}
+
+// NewFileRegistry reads and parses path immediately, since it describes a
+// small local config file rather than a live remote source — there's no
+// background refresh loop like CrushRegistry's. Call Reload to pick up
+// changes to the file after construction.
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	r := &FileRegistry{}
+	if err := r.Reload(path); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads and re-parses the file at path, replacing the registry's
+// in-memory model set atomically. Useful for a long-running process that
+// wants to pick up edits to a hand-maintained overrides file without
+// restarting.
+func (r *FileRegistry) Reload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("contextguard: reading file registry %q: %w", path, err)
+	}
+
+	var doc fileProviderJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("contextguard: parsing file registry %q: %w", path, err)
+	}
+
+	models := make(map[string]fileModelInfo, len(doc.Models))
+	for _, info := range doc.Models {
+		models[info.ID] = info
+		for _, alias := range info.Aliases {
+			models[alias] = info
+		}
+	}
+
+	r.mu.Lock()
+	r.models = models
+	r.mu.Unlock()
+	return nil
+}
+
+// ContextWindow returns the context window size (in tokens) for the given
+// model ID, or 0 if it's not in the file. Callers should combine FileRegistry
+// with a fallback registry via CompositeRegistry rather than rely on this
+// zero value directly.
+func (r *FileRegistry) ContextWindow(modelID string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models[modelID].ContextWindow
+}
+
+// DefaultMaxTokens returns the default max output tokens for the given
+// model ID, or 0 if it's not in the file.
+func (r *FileRegistry) DefaultMaxTokens(modelID string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models[modelID].DefaultMaxTokens
+}
+
+// HasModel reports whether modelID (or one of its aliases) is present in the
+// file. Implements modelLookup so CompositeRegistry knows when to trust
+// FileRegistry's answer instead of falling through to the next registry.
+func (r *FileRegistry) HasModel(modelID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.models[modelID]
+	return ok
+}
+
+// CostPerMillionTokens returns the input/output cost per million tokens for
+// the given model ID, as recorded in the file. Returns 0, 0 if the model is
+// not found. Implements the contextguard costProvider interface.
+func (r *FileRegistry) CostPerMillionTokens(modelID string) (in, out float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info := r.models[modelID]
+	return info.InputCostPerMTok, info.OutputCostPerMTok
+}
+
+// TokenizerName returns the tokenizer name recorded for modelID in the file,
+// or "" if none was set or the model isn't known. It's plain metadata: the
+// package's TokenizerRegistry resolves model-prefixes to Tokenizer instances
+// directly and has no mechanism to turn a name like this into one, so
+// callers that want a specific Tokenizer still need to Register it
+// themselves.
+func (r *FileRegistry) TokenizerName(modelID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models[modelID].Tokenizer
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testFileRegistryDoc = `{
+	"models": [
+		{
+			"id": "gpt-oss-120b",
+			"name": "GPT-OSS 120B",
+			"context_window": 131072,
+			"default_max_tokens": 8192,
+			"input_cost_usd_per_mtok": 0.1,
+			"output_cost_usd_per_mtok": 0.4,
+			"tokenizer": "o200k_base",
+			"aliases": ["gpt-oss-120b-instruct"]
+		}
+	]
+}`
+
+func TestFileRegistry_LoadsModelFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(testFileRegistryDoc), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+
+	if got := r.ContextWindow("gpt-oss-120b"); got != 131072 {
+		t.Errorf("ContextWindow = %d, want 131072", got)
+	}
+	if got := r.DefaultMaxTokens("gpt-oss-120b"); got != 8192 {
+		t.Errorf("DefaultMaxTokens = %d, want 8192", got)
+	}
+	if in, out := r.CostPerMillionTokens("gpt-oss-120b"); in != 0.1 || out != 0.4 {
+		t.Errorf("CostPerMillionTokens = (%v, %v), want (0.1, 0.4)", in, out)
+	}
+	if got := r.TokenizerName("gpt-oss-120b"); got != "o200k_base" {
+		t.Errorf("TokenizerName = %q, want o200k_base", got)
+	}
+}
+
+func TestFileRegistry_ResolvesAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(testFileRegistryDoc), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+
+	if !r.HasModel("gpt-oss-120b-instruct") {
+		t.Error("HasModel(alias) = false, want true")
+	}
+	if got := r.ContextWindow("gpt-oss-120b-instruct"); got != 131072 {
+		t.Errorf("ContextWindow(alias) = %d, want 131072", got)
+	}
+}
+
+func TestFileRegistry_UnknownModelReturnsZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(testFileRegistryDoc), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+
+	if r.HasModel("unknown-model") {
+		t.Error("HasModel(unknown-model) = true, want false")
+	}
+	if got := r.ContextWindow("unknown-model"); got != 0 {
+		t.Errorf("ContextWindow(unknown-model) = %d, want 0", got)
+	}
+}
+
+func TestFileRegistry_MissingFileErrors(t *testing.T) {
+	_, err := NewFileRegistry(filepath.Join(t.TempDir(), "does-not-exist.json"))
+	if err == nil {
+		t.Fatal("NewFileRegistry with missing file: want error, got nil")
+	}
+}
+
+func TestFileRegistry_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(`{"models":[{"id":"m1","context_window":1000}]}`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+	if got := r.ContextWindow("m1"); got != 1000 {
+		t.Fatalf("ContextWindow before reload = %d, want 1000", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"models":[{"id":"m1","context_window":2000}]}`), 0o644); err != nil {
+		t.Fatalf("rewriting file: %v", err)
+	}
+	if err := r.Reload(path); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := r.ContextWindow("m1"); got != 2000 {
+		t.Errorf("ContextWindow after reload = %d, want 2000", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+)
+
+// NoCompactMark is the metadata persisted for one pinned Content: why it
+// was pinned. Marks are keyed by contentHash rather than by the Content's
+// position in req.Contents, since compaction shifts indices around but a
+// pin needs to survive however many compaction passes happen before the
+// pinned turn is finally evicted by the caller.
+//
+// This is the analogue of Thanos's no-compact-mark.json: a persisted flag
+// that tells compaction "leave this block alone", independent of
+// CompactionHints (see compaction_hints.go), which classifies content
+// freshly on every Compact call from a caller-supplied function instead of
+// from state a caller set once and forgets about.
+type NoCompactMark struct {
+	Reason string `json:"reason"`
+}
+
+// loadNoCompactMarks reads the contentHash -> NoCompactMark map from
+// session state. Returns an empty (non-nil) map if none has been recorded
+// yet. Supports both map[string]NoCompactMark (same-process state) and the
+// map[string]any shape a JSON round-trip through a real session store would
+// produce, following loadDedupHashes' precedent.
+func loadNoCompactMarks(ctx agent.CallbackContext) map[string]NoCompactMark {
+	key := stateKeyPrefixNoCompactMarks + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return make(map[string]NoCompactMark)
+	}
+
+	switch v := val.(type) {
+	case map[string]NoCompactMark:
+		return v
+	case map[string]any:
+		marks := make(map[string]NoCompactMark, len(v))
+		for hash, raw := range v {
+			switch m := raw.(type) {
+			case NoCompactMark:
+				marks[hash] = m
+			case map[string]any:
+				reason, _ := m["reason"].(string)
+				marks[hash] = NoCompactMark{Reason: reason}
+			}
+		}
+		return marks
+	}
+	return make(map[string]NoCompactMark)
+}
+
+// persistNoCompactMarks writes the contentHash -> NoCompactMark map to
+// session state. Errors are logged but not propagated.
+func persistNoCompactMarks(ctx agent.CallbackContext, marks map[string]NoCompactMark) {
+	key := stateKeyPrefixNoCompactMarks + ctx.AgentName()
+	if err := ctx.State().Set(key, marks); err != nil {
+		slog.Warn("ContextGuard: failed to persist no-compact marks", "error", err)
+	}
+}
+
+// contentHash returns the hex sha256 of content's role and parts, used as
+// the stable key PinContent and splitNoCompactMarked match against —
+// stable across compaction passes even though a pinned Content's index
+// into req.Contents changes every time something ahead of it gets
+// summarized away. Follows chunkContentHash's precedent for hashing
+// *genai.Content deterministically.
+func contentHash(content *genai.Content) string {
+	h := sha256.New()
+	if content != nil {
+		fmt.Fprintf(h, "%s\x00", content.Role)
+		for _, part := range content.Parts {
+			if part == nil {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00", part.Text)
+			if part.FunctionCall != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionCall.Name, part.FunctionCall.Args)
+			}
+			if part.FunctionResponse != nil {
+				fmt.Fprintf(h, "%s:%v\x00", part.FunctionResponse.Name, part.FunctionResponse.Response)
+			}
+		}
+	}
+	sum := h.Sum(nil)
+	return hex.EncodeToString(sum[:])
+}
+
+// pinContent marks content as ineligible for summarization/removal in any
+// future compaction pass for ctx.AgentName()'s session, recording reason
+// alongside it for operators inspecting state. It is ContextGuard.
+// PinContent's strategy-agnostic core — the mark itself is just session
+// state, so nothing here depends on *thresholdStrategy; ContextGuard.
+// PinContent gates on the strategy the same way CompactNow does, since
+// only thresholdStrategy's Compact currently consults marks.
+func pinContent(ctx agent.CallbackContext, content *genai.Content, reason string) error {
+	if content == nil {
+		return fmt.Errorf("contextguard: cannot pin a nil content")
+	}
+	marks := loadNoCompactMarks(ctx)
+	marks[contentHash(content)] = NoCompactMark{Reason: reason}
+	persistNoCompactMarks(ctx, marks)
+	return nil
+}
+
+// splitNoCompactMarked partitions contents into stillEligible (unmarked,
+// free to be summarized) and pinned (matched against a mark loaded from
+// session state, to be kept verbatim instead). Called once per planner
+// attempt inside compactPreserveTail, since each attempt re-derives Old
+// from scratch as the retention ratio shrinks.
+func splitNoCompactMarked(ctx agent.CallbackContext, contents []*genai.Content) (stillEligible, pinned []*genai.Content) {
+	marks := loadNoCompactMarks(ctx)
+	if len(marks) == 0 {
+		return contents, nil
+	}
+
+	stillEligible = make([]*genai.Content, 0, len(contents))
+	for _, c := range contents {
+		if _, ok := marks[contentHash(c)]; ok {
+			pinned = append(pinned, c)
+			continue
+		}
+		stillEligible = append(stillEligible, c)
+	}
+	return stillEligible, pinned
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestContentHash_StableAndDistinct(t *testing.T) {
+	a := textContent("user", "please remember this exactly")
+	b := textContent("user", "please remember this exactly")
+	c := textContent("user", "something else entirely")
+
+	if contentHash(a) != contentHash(b) {
+		t.Error("expected equal content to hash the same regardless of pointer identity")
+	}
+	if contentHash(a) == contentHash(c) {
+		t.Error("expected different content to hash differently")
+	}
+}
+
+func TestPinContent_MarksAreExcludedBySplitNoCompactMarked(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	pinned := textContent("user", "critical system instruction")
+
+	if err := pinContent(ctx, pinned, "must quote this verbatim later"); err != nil {
+		t.Fatalf("pinContent error: %v", err)
+	}
+
+	all := append([]*genai.Content(nil), makeConversation(3)...)
+	all = append(all, pinned)
+
+	stillEligible, skipped := splitNoCompactMarked(ctx, all)
+	if len(skipped) != 1 || skipped[0] != pinned {
+		t.Fatalf("expected exactly the pinned content to be skipped, got %d entries", len(skipped))
+	}
+	for _, c := range stillEligible {
+		if c == pinned {
+			t.Error("pinned content leaked into stillEligible")
+		}
+	}
+	if len(stillEligible)+len(skipped) != len(all) {
+		t.Errorf("split dropped content: eligible=%d skipped=%d want total=%d", len(stillEligible), len(skipped), len(all))
+	}
+}
+
+func TestSplitNoCompactMarked_NoMarksReturnsInputUnchanged(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	contents := makeConversation(3)
+
+	stillEligible, skipped := splitNoCompactMarked(ctx, contents)
+	if len(skipped) != 0 {
+		t.Errorf("expected no skipped content without any marks, got %d", len(skipped))
+	}
+	if len(stillEligible) != len(contents) {
+		t.Errorf("stillEligible = %d, want all %d entries unchanged", len(stillEligible), len(contents))
+	}
+}
+
+func TestLoadNoCompactMarks_SupportsMapAnyRoundTripShape(t *testing.T) {
+	ctx := newMockCallbackContext("agent1")
+	key := stateKeyPrefixNoCompactMarks + ctx.AgentName()
+	if err := ctx.State().Set(key, map[string]any{
+		"deadbeef": map[string]any{"reason": "pinned via a real session store"},
+	}); err != nil {
+		t.Fatalf("State().Set error: %v", err)
+	}
+
+	marks := loadNoCompactMarks(ctx)
+	mark, ok := marks["deadbeef"]
+	if !ok {
+		t.Fatal("expected mark for hash \"deadbeef\" to round-trip through the map[string]any shape")
+	}
+	if mark.Reason != "pinned via a real session store" {
+		t.Errorf("Reason = %q, want %q", mark.Reason, "pinned via a real session store")
+	}
+}
+
+func TestContextGuard_PinContentPassthrough(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o", response: "summary"}
+	guard.Add("agent1", llm)
+
+	ctx := newMockCallbackContext("agent1")
+	pinned := textContent("user", "keep me verbatim")
+
+	if err := guard.PinContent(ctx, pinned, "referenced later"); err != nil {
+		t.Fatalf("PinContent error: %v", err)
+	}
+
+	marks := loadNoCompactMarks(ctx)
+	if _, ok := marks[contentHash(pinned)]; !ok {
+		t.Error("expected PinContent to persist a mark for the pinned content")
+	}
+}
+
+func TestContextGuard_PinContentUnsupportedStrategy(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithSlidingWindow(30))
+
+	ctx := newMockCallbackContext("agent1")
+	if err := guard.PinContent(ctx, textContent("user", "hi"), "reason"); err == nil {
+		t.Error("expected an error for a strategy that doesn't support PinContent")
+	}
+}
+
+func TestThresholdStrategy_CompactPreserveTailKeepsPinnedContentVerbatim(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	s := newThresholdStrategy(registry, llm, 0)
+	s.SetThresholdOptions(ThresholdOptions{RetentionMode: PreserveTail})
+	ctx := newMockCallbackContext("agent1")
+
+	pinned := textContent("user", "[pinned] the exact deployment manifest")
+	contents := append([]*genai.Content{pinned}, makeLargeConversation(50_000)...)
+
+	if err := pinContent(ctx, pinned, "must be quoted exactly"); err != nil {
+		t.Fatalf("pinContent error: %v", err)
+	}
+
+	req := &model.LLMRequest{Model: "small-model", Contents: contents}
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	found := false
+	for _, c := range req.Contents {
+		if c == pinned {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("expected the pinned content to survive PreserveTail compaction verbatim")
+	}
+}
+
+func TestThresholdStrategy_CompactFullSummaryKeepsPinnedContentVerbatim(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	s := newThresholdStrategy(registry, llm, 0)
+	ctx := newMockCallbackContext("agent1")
+
+	pinned := textContent("user", "[pinned] the exact deployment manifest")
+	contents := append([]*genai.Content{pinned}, makeLargeConversation(50_000)...)
+
+	if err := pinContent(ctx, pinned, "must be quoted exactly"); err != nil {
+		t.Fatalf("pinContent error: %v", err)
+	}
+
+	req := &model.LLMRequest{Model: "small-model", Contents: contents}
+	if err := s.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	found := false
+	for _, c := range req.Contents {
+		if c == pinned {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("expected the pinned content to survive full-summary compaction verbatim")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import "time"
+
+// CompactionDecision classifies what a single BeforeModelCallback
+// invocation did with the request it saw.
+type CompactionDecision string
+
+const (
+	// DecisionSkip means the estimate stayed under the strategy's
+	// threshold; the request passed through unchanged.
+	DecisionSkip CompactionDecision = "skip"
+	// DecisionCompact means the strategy rewrote req.Contents to a
+	// smaller representation (summary + continuation).
+	DecisionCompact CompactionDecision = "compact"
+	// DecisionOverflowRisk means compaction was attempted but failed
+	// (returned an error) or did not reduce the token estimate, so the
+	// request is going out at its original, possibly over-budget, size.
+	DecisionOverflowRisk CompactionDecision = "overflow-risk"
+)
+
+// EstimateEvent describes one BeforeModelCallback invocation's token
+// accounting and the decision ContextGuard made as a result. WindowSize is
+// 0 when the agent's strategy doesn't expose a concrete context window
+// (see streamWindowStrategy).
+type EstimateEvent struct {
+	Agent            string
+	Model            string
+	WindowSize       int
+	HeuristicTokens  int
+	CorrectionFactor float64
+	ToolDefTokens    int
+	InlineDataTokens int
+	MessageTokens    int
+	Decision         CompactionDecision
+}
+
+// CompactionEvent describes the start of a compaction attempt.
+type CompactionEvent struct {
+	Agent        string
+	Model        string
+	TokensBefore int
+}
+
+// CompactionResult describes the outcome of a compaction attempt.
+type CompactionResult struct {
+	Agent        string
+	Model        string
+	TokensBefore int
+	TokensAfter  int
+	Err          error
+
+	// Duration is how long the Compact call took, start to end.
+	Duration time.Duration
+
+	// Interrupted is true if Err wraps context.Canceled or
+	// context.DeadlineExceeded — the agent's ctx was done, not a real
+	// compaction failure. Observers that count failures should treat this
+	// separately from Err != nil && !Interrupted.
+	Interrupted bool
+}
+
+// CompactionObserver receives structured telemetry for every
+// BeforeModelCallback/AfterModelCallback invocation, so compaction
+// behavior (tool-definition pressure, inline-data pressure, calibration
+// drift, suspected compaction loops) is diagnosable in production instead
+// of only in test logs. Wire one in with WithObserver.
+//
+// Implementations that only care about some events can embed
+// NoopCompactionObserver and override the rest, the same pattern
+// BaseSimHook uses for SimHook in the stress-test harness.
+type CompactionObserver interface {
+	// OnEstimate fires once per BeforeModelCallback invocation, after the
+	// compaction decision has been made.
+	OnEstimate(EstimateEvent)
+	// OnCompactionStart fires immediately before a strategy's Compact
+	// runs, once the estimate has crossed its threshold.
+	OnCompactionStart(CompactionEvent)
+	// OnCompactionEnd fires immediately after Compact returns.
+	OnCompactionEnd(CompactionResult)
+	// OnCalibrationSample fires whenever the threshold strategy's
+	// ratioTracker learns from a new (heuristic, real) pair. model is
+	// actually the agent ID — ratioTracker calibrates at per-agent
+	// granularity, not per-model (see ratioTracker's doc comment).
+	OnCalibrationSample(model string, heuristic, real int)
+	// OnLoopSuspected fires when a compaction ran but failed to reduce
+	// the token estimate, a symptom of a summarizer echoing back content
+	// as large as what it was asked to compact.
+	OnLoopSuspected(reason string)
+}
+
+// NoopCompactionObserver implements CompactionObserver with no-op methods.
+// Embed it to implement only the events you care about.
+type NoopCompactionObserver struct{}
+
+func (NoopCompactionObserver) OnEstimate(EstimateEvent)             {}
+func (NoopCompactionObserver) OnCompactionStart(CompactionEvent)    {}
+func (NoopCompactionObserver) OnCompactionEnd(CompactionResult)     {}
+func (NoopCompactionObserver) OnCalibrationSample(string, int, int) {}
+func (NoopCompactionObserver) OnLoopSuspected(string)               {}
+
+// WithObserver wires obs to receive structured telemetry for every
+// agent's BeforeModelCallback/AfterModelCallback invocations. See
+// CompactionObserver.
+func WithObserver(obs CompactionObserver) Option {
+	return func(g *ContextGuard) {
+		g.observer = obs
+	}
+}
+
+// RealTokenObserver is an optional CompactionObserver capability: an
+// observer that wants the real (provider-reported) prompt token count
+// AfterModelCallback observes, keyed by agent and session, rather than
+// only the heuristic estimates OnEstimate carries. PrometheusObserver
+// implements it to maintain its last-known-real-tokens gauge;
+// contextGuard.afterModel checks for it the same way OnCalibrationSample's
+// caller checks for a *thresholdStrategy — a type assertion against the
+// configured observer, not a required method every CompactionObserver must
+// implement.
+type RealTokenObserver interface {
+	OnRealTokens(agent, session, model string, tokens int)
+}
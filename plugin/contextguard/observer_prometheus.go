@@ -0,0 +1,358 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// promHistogramBuckets are the default token-count histogram bucket
+// boundaries for PrometheusObserver's token histograms, covering small
+// sliding-window agents up to 200k-context agents.
+var promHistogramBuckets = []float64{500, 1_000, 2_500, 5_000, 10_000, 25_000, 50_000, 100_000, 200_000}
+
+// promFactorBuckets are the correction-factor histogram bucket boundaries
+// — factors are clamped to [1.0, maxCorrectionFactor] elsewhere in the
+// package, so these only need to resolve within that range.
+var promFactorBuckets = []float64{1.0, 1.25, 1.5, 1.75, 2.0, 2.5, 3.0, 4.0}
+
+// promDurationBuckets are the compaction-duration histogram bucket
+// boundaries, in seconds, covering a fast truncation pass up through a
+// slow multi-chunk hierarchical summarization against a large window.
+var promDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// promHistogram is a minimal Prometheus-compatible cumulative histogram:
+// no external client library is vendored into this module, so this
+// implements just enough of the text exposition format by hand (the same
+// choice session/redis made for its wire protocol rather than pulling in
+// a client library).
+type promHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newPromHistogram(buckets []float64) *promHistogram {
+	return &promHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *promHistogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += v
+	h.count++
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+}
+
+// writeTo appends name's bucket/sum/count lines to sb, with labels (already
+// formatted as `key="value",...` or empty) applied to every line.
+func (h *promHistogram) writeTo(sb *strings.Builder, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	labelPrefix := labels
+	if labelPrefix != "" {
+		labelPrefix += ","
+	}
+	for i, upperBound := range h.buckets {
+		fmt.Fprintf(sb, "%s_bucket{%sle=\"%s\"} %d\n", name, labelPrefix, formatPromFloat(upperBound), h.counts[i])
+	}
+	fmt.Fprintf(sb, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labelPrefix, h.count)
+	fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, labels, formatPromFloat(h.sum))
+	fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func formatPromFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// PrometheusObserver implements CompactionObserver, accumulating metrics
+// in Prometheus' own shapes (histograms for pre/post compaction token
+// counts and correction factor, counters for compactions and overflow
+// events per model, gauges for current-session utilization). WriteTo
+// renders them in the Prometheus text exposition format for an HTTP
+// /metrics handler to serve.
+type PrometheusObserver struct {
+	mu sync.Mutex
+
+	tokensBeforeHist   map[string]*promHistogram // keyed by model
+	tokensAfterHist    map[string]*promHistogram
+	reclaimedHist      map[string]*promHistogram
+	correctionFactor   map[string]*promHistogram // keyed by agent (see OnCalibrationSample)
+	durationHist       map[string]*promHistogram // keyed by model, seconds
+	compactionsByModel map[string]uint64
+	overflowsByModel   map[string]uint64
+	utilizationByAgent map[string]float64 // windowSize > 0 only: heuristicTokens / windowSize
+
+	// Compaction lifecycle counters, keyed by model. Every OnCompactionStart
+	// increments runsStarted; every OnCompactionEnd increments exactly one
+	// of runsSucceeded (reclaimed tokens), runsNoChange (ran, reclaimed
+	// nothing, no error), runsInterrupted (CompactionResult.Interrupted),
+	// or runsFailed (any other error) — the five-way split Thanos/Cortex's
+	// compactor exposes for its own compaction runs.
+	runsStarted     map[string]uint64
+	runsSucceeded   map[string]uint64
+	runsNoChange    map[string]uint64
+	runsInterrupted map[string]uint64
+	runsFailed      map[string]uint64
+
+	// lastRealTokens is the most recent provider-reported prompt token
+	// count per agent+session (see OnRealTokens).
+	lastRealTokens map[agentSessionKey]float64
+}
+
+// agentSessionKey keys PrometheusObserver.lastRealTokens by the
+// (agent, session) pair the contextguard_last_real_tokens gauge is
+// labeled with.
+type agentSessionKey struct {
+	agent   string
+	session string
+}
+
+// NewPrometheusObserver creates an empty PrometheusObserver ready to
+// register with WithObserver.
+func NewPrometheusObserver() *PrometheusObserver {
+	return &PrometheusObserver{
+		tokensBeforeHist:   make(map[string]*promHistogram),
+		tokensAfterHist:    make(map[string]*promHistogram),
+		reclaimedHist:      make(map[string]*promHistogram),
+		correctionFactor:   make(map[string]*promHistogram),
+		durationHist:       make(map[string]*promHistogram),
+		compactionsByModel: make(map[string]uint64),
+		overflowsByModel:   make(map[string]uint64),
+		utilizationByAgent: make(map[string]float64),
+		runsStarted:        make(map[string]uint64),
+		runsSucceeded:      make(map[string]uint64),
+		runsNoChange:       make(map[string]uint64),
+		runsInterrupted:    make(map[string]uint64),
+		runsFailed:         make(map[string]uint64),
+		lastRealTokens:     make(map[agentSessionKey]float64),
+	}
+}
+
+func (p *PrometheusObserver) histFor(m map[string]*promHistogram, key string, buckets []float64) *promHistogram {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := m[key]
+	if !ok {
+		h = newPromHistogram(buckets)
+		m[key] = h
+	}
+	return h
+}
+
+func (p *PrometheusObserver) OnEstimate(e EstimateEvent) {
+	p.histFor(p.tokensBeforeHist, e.Model, promHistogramBuckets).Observe(float64(e.HeuristicTokens))
+	p.histFor(p.correctionFactor, e.Agent, promFactorBuckets).Observe(e.CorrectionFactor)
+
+	if e.Decision == DecisionOverflowRisk {
+		p.mu.Lock()
+		p.overflowsByModel[e.Model]++
+		p.mu.Unlock()
+	}
+
+	if e.WindowSize > 0 {
+		p.mu.Lock()
+		p.utilizationByAgent[e.Agent] = float64(e.HeuristicTokens) / float64(e.WindowSize)
+		p.mu.Unlock()
+	}
+}
+
+func (p *PrometheusObserver) OnCompactionStart(e CompactionEvent) {
+	p.mu.Lock()
+	p.runsStarted[e.Model]++
+	p.mu.Unlock()
+}
+
+func (p *PrometheusObserver) OnCompactionEnd(r CompactionResult) {
+	p.histFor(p.durationHist, r.Model, promDurationBuckets).Observe(r.Duration.Seconds())
+
+	switch {
+	case r.Interrupted:
+		p.mu.Lock()
+		p.runsInterrupted[r.Model]++
+		p.mu.Unlock()
+		return
+	case r.Err != nil:
+		p.mu.Lock()
+		p.runsFailed[r.Model]++
+		p.mu.Unlock()
+		return
+	}
+
+	p.histFor(p.tokensAfterHist, r.Model, promHistogramBuckets).Observe(float64(r.TokensAfter))
+	reclaimed := r.TokensBefore - r.TokensAfter
+	if reclaimed > 0 {
+		p.histFor(p.reclaimedHist, r.Model, promHistogramBuckets).Observe(float64(reclaimed))
+		p.mu.Lock()
+		p.compactionsByModel[r.Model]++
+		p.runsSucceeded[r.Model]++
+		p.mu.Unlock()
+		return
+	}
+
+	p.mu.Lock()
+	p.runsNoChange[r.Model]++
+	p.mu.Unlock()
+}
+
+func (p *PrometheusObserver) OnCalibrationSample(string, int, int) {}
+
+func (p *PrometheusObserver) OnLoopSuspected(string) {}
+
+// OnRealTokens implements RealTokenObserver, maintaining the
+// contextguard_last_real_tokens gauge per agent+session.
+func (p *PrometheusObserver) OnRealTokens(agent, session, model string, tokens int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastRealTokens[agentSessionKey{agent: agent, session: session}] = float64(tokens)
+}
+
+// WriteTo renders every accumulated metric in the Prometheus text
+// exposition format to w.
+func (p *PrometheusObserver) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	sb.WriteString("# HELP contextguard_tokens_before_compaction Estimated token count when BeforeModelCallback ran.\n")
+	sb.WriteString("# TYPE contextguard_tokens_before_compaction histogram\n")
+	p.writeHistByModel(&sb, p.tokensBeforeHist, "contextguard_tokens_before_compaction")
+
+	sb.WriteString("# HELP contextguard_tokens_after_compaction Estimated token count immediately after a successful compaction.\n")
+	sb.WriteString("# TYPE contextguard_tokens_after_compaction histogram\n")
+	p.writeHistByModel(&sb, p.tokensAfterHist, "contextguard_tokens_after_compaction")
+
+	sb.WriteString("# HELP contextguard_tokens_reclaimed Tokens removed by a successful compaction.\n")
+	sb.WriteString("# TYPE contextguard_tokens_reclaimed histogram\n")
+	p.writeHistByModel(&sb, p.reclaimedHist, "contextguard_tokens_reclaimed")
+
+	sb.WriteString("# HELP contextguard_correction_factor Calibration ratio applied to the heuristic token estimate, by agent.\n")
+	sb.WriteString("# TYPE contextguard_correction_factor histogram\n")
+	p.writeHistByLabel(&sb, p.correctionFactor, "contextguard_correction_factor", "agent")
+
+	sb.WriteString("# HELP contextguard_compaction_duration_seconds Wall-clock time a Strategy.Compact call took, by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_duration_seconds histogram\n")
+	p.writeHistByModel(&sb, p.durationHist, "contextguard_compaction_duration_seconds")
+
+	p.mu.Lock()
+	sb.WriteString("# HELP contextguard_compactions_total Compactions that reclaimed at least one token, by model.\n")
+	sb.WriteString("# TYPE contextguard_compactions_total counter\n")
+	writeCounterMap(&sb, "contextguard_compactions_total", "model", p.compactionsByModel)
+
+	sb.WriteString("# HELP contextguard_overflow_events_total BeforeModelCallback invocations flagged as overflow risk, by model.\n")
+	sb.WriteString("# TYPE contextguard_overflow_events_total counter\n")
+	writeCounterMap(&sb, "contextguard_overflow_events_total", "model", p.overflowsByModel)
+
+	sb.WriteString("# HELP contextguard_compaction_runs_started_total Strategy.Compact calls started, by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_runs_started_total counter\n")
+	writeCounterMap(&sb, "contextguard_compaction_runs_started_total", "model", p.runsStarted)
+
+	sb.WriteString("# HELP contextguard_compaction_runs_succeeded_total Compact calls that reclaimed at least one token, by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_runs_succeeded_total counter\n")
+	writeCounterMap(&sb, "contextguard_compaction_runs_succeeded_total", "model", p.runsSucceeded)
+
+	sb.WriteString("# HELP contextguard_compaction_runs_no_change_total Compact calls that returned without error but reclaimed nothing, by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_runs_no_change_total counter\n")
+	writeCounterMap(&sb, "contextguard_compaction_runs_no_change_total", "model", p.runsNoChange)
+
+	sb.WriteString("# HELP contextguard_compaction_runs_interrupted_total Compact calls that ended because the agent's ctx was done (context.Canceled/DeadlineExceeded), by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_runs_interrupted_total counter\n")
+	writeCounterMap(&sb, "contextguard_compaction_runs_interrupted_total", "model", p.runsInterrupted)
+
+	sb.WriteString("# HELP contextguard_compaction_runs_failed_total Compact calls that returned a real (non-interruption) error, by model.\n")
+	sb.WriteString("# TYPE contextguard_compaction_runs_failed_total counter\n")
+	writeCounterMap(&sb, "contextguard_compaction_runs_failed_total", "model", p.runsFailed)
+
+	sb.WriteString("# HELP contextguard_session_utilization_ratio Current heuristic tokens / context window, by agent.\n")
+	sb.WriteString("# TYPE contextguard_session_utilization_ratio gauge\n")
+	for _, agent := range sortedKeysFloat(p.utilizationByAgent) {
+		fmt.Fprintf(&sb, "contextguard_session_utilization_ratio{agent=%q} %s\n", agent, formatPromFloat(p.utilizationByAgent[agent]))
+	}
+
+	sb.WriteString("# HELP contextguard_last_real_tokens Most recent provider-reported prompt token count, by agent and session.\n")
+	sb.WriteString("# TYPE contextguard_last_real_tokens gauge\n")
+	for _, k := range sortedAgentSessionKeys(p.lastRealTokens) {
+		fmt.Fprintf(&sb, "contextguard_last_real_tokens{agent=%q,session=%q} %s\n", k.agent, k.session, formatPromFloat(p.lastRealTokens[k]))
+	}
+	p.mu.Unlock()
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// sortedAgentSessionKeys returns m's keys sorted by (agent, session) for
+// deterministic WriteTo output.
+func sortedAgentSessionKeys(m map[agentSessionKey]float64) []agentSessionKey {
+	keys := make([]agentSessionKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].agent != keys[j].agent {
+			return keys[i].agent < keys[j].agent
+		}
+		return keys[i].session < keys[j].session
+	})
+	return keys
+}
+
+func (p *PrometheusObserver) writeHistByModel(sb *strings.Builder, m map[string]*promHistogram, name string) {
+	p.writeHistByLabel(sb, m, name, "model")
+}
+
+func (p *PrometheusObserver) writeHistByLabel(sb *strings.Builder, m map[string]*promHistogram, name, labelName string) {
+	p.mu.Lock()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	p.mu.Unlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		labels := fmt.Sprintf("%s=%q", labelName, k)
+		m[k].writeTo(sb, name, labels)
+	}
+}
+
+func writeCounterMap(sb *strings.Builder, name, labelName string, m map[string]uint64) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(sb, "%s{%s=%q} %d\n", name, labelName, k, m[k])
+	}
+}
+
+func sortedKeysFloat(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogObserver implements CompactionObserver by emitting one structured
+// slog record per event, at the same logger/level conventions the rest of
+// the package already uses (slog.Info for routine events, slog.Warn for
+// anything indicating drift or risk).
+type SlogObserver struct {
+	Logger *slog.Logger
+}
+
+// NewSlogObserver creates a SlogObserver. A nil logger falls back to
+// slog.Default().
+func NewSlogObserver(logger *slog.Logger) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogObserver{Logger: logger}
+}
+
+func (o *SlogObserver) OnEstimate(e EstimateEvent) {
+	level := slog.LevelInfo
+	if e.Decision == DecisionOverflowRisk {
+		level = slog.LevelWarn
+	}
+	o.Logger.Log(context.Background(), level, "ContextGuard telemetry: estimate",
+		"agent", e.Agent,
+		"model", e.Model,
+		"windowSize", e.WindowSize,
+		"heuristicTokens", e.HeuristicTokens,
+		"correctionFactor", e.CorrectionFactor,
+		"toolDefTokens", e.ToolDefTokens,
+		"inlineDataTokens", e.InlineDataTokens,
+		"messageTokens", e.MessageTokens,
+		"decision", string(e.Decision),
+	)
+}
+
+func (o *SlogObserver) OnCompactionStart(e CompactionEvent) {
+	o.Logger.Info("ContextGuard telemetry: compaction start",
+		"agent", e.Agent,
+		"model", e.Model,
+		"tokensBefore", e.TokensBefore,
+	)
+}
+
+func (o *SlogObserver) OnCompactionEnd(r CompactionResult) {
+	if r.Err != nil {
+		o.Logger.Warn("ContextGuard telemetry: compaction end",
+			"agent", r.Agent,
+			"model", r.Model,
+			"tokensBefore", r.TokensBefore,
+			"tokensAfter", r.TokensAfter,
+			"error", r.Err,
+		)
+		return
+	}
+	o.Logger.Info("ContextGuard telemetry: compaction end",
+		"agent", r.Agent,
+		"model", r.Model,
+		"tokensBefore", r.TokensBefore,
+		"tokensAfter", r.TokensAfter,
+		"tokensReclaimed", r.TokensBefore-r.TokensAfter,
+	)
+}
+
+func (o *SlogObserver) OnCalibrationSample(agentID string, heuristic, real int) {
+	o.Logger.Info("ContextGuard telemetry: calibration sample",
+		"agent", agentID,
+		"heuristic", heuristic,
+		"real", real,
+	)
+}
+
+func (o *SlogObserver) OnLoopSuspected(reason string) {
+	o.Logger.Warn("ContextGuard telemetry: loop suspected", "reason", reason)
+}
@@ -0,0 +1,350 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// ---------------------------------------------------------------------------
+// Tests: recording observer wiring through beforeModel/afterModel
+// ---------------------------------------------------------------------------
+
+type recordingObserver struct {
+	NoopCompactionObserver
+	estimates    []EstimateEvent
+	starts       []CompactionEvent
+	ends         []CompactionResult
+	calibrations int
+	loopSuspects []string
+}
+
+func (o *recordingObserver) OnEstimate(e EstimateEvent)           { o.estimates = append(o.estimates, e) }
+func (o *recordingObserver) OnCompactionStart(e CompactionEvent)  { o.starts = append(o.starts, e) }
+func (o *recordingObserver) OnCompactionEnd(r CompactionResult)   { o.ends = append(o.ends, r) }
+func (o *recordingObserver) OnCalibrationSample(string, int, int) { o.calibrations++ }
+func (o *recordingObserver) OnLoopSuspected(reason string) {
+	o.loopSuspects = append(o.loopSuspects, reason)
+}
+
+func TestBeforeModel_ObserverSeesSkipDecision(t *testing.T) {
+	obs := &recordingObserver{}
+	guard := New(newMockRegistry(), WithObserver(obs))
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"})
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "gpt-4o",
+		Contents: []*genai.Content{textContent("user", "short message")},
+	}
+
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel returned error: %v", err)
+	}
+
+	if len(obs.estimates) != 1 {
+		t.Fatalf("expected 1 OnEstimate call, got %d", len(obs.estimates))
+	}
+	if obs.estimates[0].Decision != DecisionSkip {
+		t.Errorf("decision = %q, want %q", obs.estimates[0].Decision, DecisionSkip)
+	}
+	if len(obs.starts) != 0 || len(obs.ends) != 0 {
+		t.Errorf("compaction should not have run for a short request")
+	}
+}
+
+func TestBeforeModel_ObserverSeesCompactDecision(t *testing.T) {
+	obs := &recordingObserver{}
+	guard := New(newMockRegistry(), WithObserver(obs))
+	guard.Add("agent1", &mockLLM{name: "gpt-4o", response: "summary"}, WithMaxTokens(10))
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "gpt-4o",
+		Contents: makeLargeConversation(50_000),
+	}
+
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel returned error: %v", err)
+	}
+
+	if len(obs.estimates) != 1 {
+		t.Fatalf("expected 1 OnEstimate call, got %d", len(obs.estimates))
+	}
+	if obs.estimates[0].Decision != DecisionCompact {
+		t.Errorf("decision = %q, want %q", obs.estimates[0].Decision, DecisionCompact)
+	}
+	if len(obs.starts) != 1 || len(obs.ends) != 1 {
+		t.Errorf("expected exactly one OnCompactionStart/OnCompactionEnd pair, got %d/%d", len(obs.starts), len(obs.ends))
+	}
+	if obs.ends[0].Err != nil {
+		t.Errorf("unexpected compaction error: %v", obs.ends[0].Err)
+	}
+}
+
+func TestAfterModel_ObserverSeesCalibrationSample(t *testing.T) {
+	obs := &recordingObserver{}
+	registry := newMockRegistry()
+	tokenizers := NewTokenizerRegistry()
+	guard := New(registry, WithObserver(obs))
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"}, WithTokenizerRegistry(tokenizers))
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+	persistLastHeuristic(ctx, 1_000)
+
+	resp := &model.LLMResponse{
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 1_200,
+		},
+	}
+
+	if _, err := g.afterModel(ctx, resp, nil); err != nil {
+		t.Fatalf("afterModel returned error: %v", err)
+	}
+
+	if obs.calibrations != 1 {
+		t.Errorf("calibrations = %d, want 1", obs.calibrations)
+	}
+}
+
+func TestBeforeModel_ObserverSeesInterruptedCompaction(t *testing.T) {
+	obs := &recordingObserver{}
+	guard := New(newMockRegistry(), WithObserver(obs))
+	guard.strategies["agent1"] = &erroringStrategy{err: context.Canceled}
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "gpt-4o",
+		Contents: []*genai.Content{textContent("user", "short message")},
+	}
+
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel returned error: %v", err)
+	}
+
+	if len(obs.ends) != 1 {
+		t.Fatalf("expected 1 OnCompactionEnd call, got %d", len(obs.ends))
+	}
+	if !obs.ends[0].Interrupted {
+		t.Error("expected Interrupted = true for a context.Canceled compaction error")
+	}
+}
+
+func TestBeforeModel_ObserverSeesNonInterruptedFailure(t *testing.T) {
+	obs := &recordingObserver{}
+	guard := New(newMockRegistry(), WithObserver(obs))
+	guard.strategies["agent1"] = &erroringStrategy{err: errors.New("boom")}
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "gpt-4o",
+		Contents: []*genai.Content{textContent("user", "short message")},
+	}
+
+	if _, err := g.beforeModel(ctx, req); err != nil {
+		t.Fatalf("beforeModel returned error: %v", err)
+	}
+
+	if len(obs.ends) != 1 {
+		t.Fatalf("expected 1 OnCompactionEnd call, got %d", len(obs.ends))
+	}
+	if obs.ends[0].Interrupted {
+		t.Error("expected Interrupted = false for a plain compaction error")
+	}
+}
+
+// recordingRealTokenObserver additionally implements RealTokenObserver, so
+// afterModel's type assertion against g.observer finds it.
+type recordingRealTokenObserver struct {
+	recordingObserver
+	agent, session, model string
+	tokens                int
+}
+
+func (o *recordingRealTokenObserver) OnRealTokens(agent, session, model string, tokens int) {
+	o.agent, o.session, o.model, o.tokens = agent, session, model, tokens
+}
+
+func TestAfterModel_CallsRealTokenObserverWhenSupported(t *testing.T) {
+	obs := &recordingRealTokenObserver{}
+	registry := newMockRegistry()
+	guard := New(registry, WithObserver(obs))
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"})
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+
+	resp := &model.LLMResponse{
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 1_200,
+		},
+	}
+
+	if _, err := g.afterModel(ctx, resp, nil); err != nil {
+		t.Fatalf("afterModel returned error: %v", err)
+	}
+
+	if obs.agent != "agent1" || obs.session != "test-session" || obs.tokens != 1_200 {
+		t.Errorf("OnRealTokens got (%q, %q, %d), want (%q, %q, %d)",
+			obs.agent, obs.session, obs.tokens, "agent1", "test-session", 1_200)
+	}
+}
+
+func TestAfterModel_SkipsRealTokenHookWhenObserverDoesNotSupportIt(t *testing.T) {
+	obs := &recordingObserver{}
+	registry := newMockRegistry()
+	guard := New(registry, WithObserver(obs))
+	guard.Add("agent1", &mockLLM{name: "gpt-4o"})
+
+	g := &contextGuard{strategies: guard.strategies, observer: obs}
+	ctx := newMockCallbackContext("agent1")
+
+	resp := &model.LLMResponse{
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 1_200,
+		},
+	}
+
+	if _, err := g.afterModel(ctx, resp, nil); err != nil {
+		t.Fatalf("afterModel returned unexpected error for a non-RealTokenObserver: %v", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Tests: SlogObserver
+// ---------------------------------------------------------------------------
+
+func TestNewSlogObserver_NilLoggerFallsBackToDefault(t *testing.T) {
+	o := NewSlogObserver(nil)
+	if o.Logger == nil {
+		t.Fatal("expected a non-nil default logger")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Tests: PrometheusObserver
+// ---------------------------------------------------------------------------
+
+func TestPrometheusObserver_RendersEstimateAndCompaction(t *testing.T) {
+	p := NewPrometheusObserver()
+
+	p.OnEstimate(EstimateEvent{
+		Agent: "agent1", Model: "gpt-4o", WindowSize: 1_000,
+		HeuristicTokens: 800, CorrectionFactor: 1.3, Decision: DecisionSkip,
+	})
+	p.OnCompactionStart(CompactionEvent{Agent: "agent1", Model: "gpt-4o", TokensBefore: 50_000})
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", TokensBefore: 50_000, TokensAfter: 5_000})
+
+	var sb strings.Builder
+	if _, err := p.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		`contextguard_tokens_before_compaction_count{model="gpt-4o"} 1`,
+		`contextguard_tokens_reclaimed_count{model="gpt-4o"} 1`,
+		`contextguard_compactions_total{model="gpt-4o"} 1`,
+		`contextguard_session_utilization_ratio{agent="agent1"} 0.8`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\nfull output:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrometheusObserver_OverflowRiskIncrementsCounter(t *testing.T) {
+	p := NewPrometheusObserver()
+	p.OnEstimate(EstimateEvent{Agent: "agent1", Model: "gpt-4o", Decision: DecisionOverflowRisk})
+
+	var sb strings.Builder
+	p.WriteTo(&sb)
+
+	if !strings.Contains(sb.String(), `contextguard_overflow_events_total{model="gpt-4o"} 1`) {
+		t.Errorf("expected an overflow event counted, got:\n%s", sb.String())
+	}
+}
+
+func TestPrometheusObserver_FailedCompactionNotCountedAsReclaimed(t *testing.T) {
+	p := NewPrometheusObserver()
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", TokensBefore: 1_000, TokensAfter: 1_000, Err: nil})
+
+	var sb strings.Builder
+	p.WriteTo(&sb)
+
+	if strings.Contains(sb.String(), "contextguard_compactions_total") {
+		t.Errorf("compaction that reclaimed nothing should not be counted, got:\n%s", sb.String())
+	}
+}
+
+func TestPrometheusObserver_CompactionLifecycleCounters(t *testing.T) {
+	p := NewPrometheusObserver()
+
+	p.OnCompactionStart(CompactionEvent{Agent: "agent1", Model: "gpt-4o", TokensBefore: 50_000})
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", TokensBefore: 50_000, TokensAfter: 5_000, Duration: 250 * time.Millisecond})
+
+	p.OnCompactionStart(CompactionEvent{Agent: "agent1", Model: "gpt-4o", TokensBefore: 1_000})
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", TokensBefore: 1_000, TokensAfter: 1_000})
+
+	p.OnCompactionStart(CompactionEvent{Agent: "agent1", Model: "gpt-4o", TokensBefore: 1_000})
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", Err: context.Canceled, Interrupted: true})
+
+	p.OnCompactionStart(CompactionEvent{Agent: "agent1", Model: "gpt-4o", TokensBefore: 1_000})
+	p.OnCompactionEnd(CompactionResult{Agent: "agent1", Model: "gpt-4o", Err: errors.New("boom")})
+
+	var sb strings.Builder
+	if _, err := p.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		`contextguard_compaction_runs_started_total{model="gpt-4o"} 4`,
+		`contextguard_compaction_runs_succeeded_total{model="gpt-4o"} 1`,
+		`contextguard_compaction_runs_no_change_total{model="gpt-4o"} 1`,
+		`contextguard_compaction_runs_interrupted_total{model="gpt-4o"} 1`,
+		`contextguard_compaction_runs_failed_total{model="gpt-4o"} 1`,
+		`contextguard_compaction_duration_seconds_count{model="gpt-4o"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\nfull output:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrometheusObserver_OnRealTokensRendersGaugePerAgentAndSession(t *testing.T) {
+	p := NewPrometheusObserver()
+	p.OnRealTokens("agent1", "session1", "gpt-4o", 1_234)
+
+	var sb strings.Builder
+	p.WriteTo(&sb)
+
+	if !strings.Contains(sb.String(), `contextguard_last_real_tokens{agent="agent1",session="session1"} 1234`) {
+		t.Errorf("expected last-real-tokens gauge, got:\n%s", sb.String())
+	}
+}
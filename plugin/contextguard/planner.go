@@ -0,0 +1,181 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// CompactionPlan is a Planner's answer to "what should this compaction
+// pass do": which contents fold into the summary (Old), which stay
+// verbatim in the next request (Recent), and any facts from Old that
+// MustRetain says the summarizer must not drop even though their source
+// messages are being compacted away. thresholdStrategy only executes the
+// plan — running the summarizer over Old, keeping Recent untouched, and
+// asking the summarizer to preserve MustRetain — it no longer decides the
+// split itself.
+type CompactionPlan struct {
+	Old        []*genai.Content
+	Recent     []*genai.Content
+	MustRetain []string
+}
+
+// Planner decides what a compaction pass should do with req.Contents,
+// separating that decision from how thresholdStrategy executes it
+// (invoking the summarizer LLM, rewriting req.Contents, persisting
+// tokens). recentBudget is the token budget Plan should try to keep in
+// Recent — the same quantity compactPreserveTail already computes from
+// the context window and RecentWindowRatio.
+//
+// Install a custom Planner with SetPlanner/WithPlanner; thresholdStrategy
+// defaults to thresholdPlanner, which reproduces the package's
+// longstanding recency/eviction-based split.
+type Planner interface {
+	Plan(ctx agent.CallbackContext, req *model.LLMRequest, recentBudget int, todos []TodoItem) (CompactionPlan, error)
+}
+
+// thresholdPlanner is the default Planner: the plain recency split
+// (findSplitIndex/findSplitIndexWithCounter), or eviction's
+// relevance-based split when one is configured via SetEvictionStrategy/
+// WithSemanticEviction. This is the logic compactPreserveTail ran inline
+// before Planner existed, moved here unchanged so default behavior
+// doesn't shift for existing callers that never set a Planner.
+type thresholdPlanner struct {
+	eviction EvictionStrategy
+	counter  TokenCounter
+}
+
+// Plan implements Planner.
+func (p *thresholdPlanner) Plan(ctx agent.CallbackContext, req *model.LLMRequest, recentBudget int, todos []TodoItem) (CompactionPlan, error) {
+	var old, recent []*genai.Content
+	if p.eviction != nil {
+		old, recent = p.eviction.Evict(ctx, req.Contents, recentBudget)
+	} else {
+		var splitIdx int
+		if p.counter != nil {
+			splitIdx = findSplitIndexWithCounter(req.Contents, recentBudget, p.counter)
+		} else {
+			splitIdx = findSplitIndex(req.Contents, recentBudget)
+		}
+		old = req.Contents[:splitIdx]
+		recent = req.Contents[splitIdx:]
+	}
+	return CompactionPlan{Old: old, Recent: recent}, nil
+}
+
+// defaultRecencyToolAwareKeepTurns is RecencyToolAwarePlanner's fallback
+// KeepTurns when the caller leaves it unset.
+const defaultRecencyToolAwareKeepTurns = 6
+
+// RecencyToolAwarePlanner always keeps the last KeepTurns Content entries
+// verbatim, plus — for every distinct tool name called further back — the
+// most recent FunctionCall/FunctionResponse pair for that tool, so a
+// stale tool result can't mislead the model after compaction even when
+// the turns around it get folded into the summary. Everything else goes
+// to the summarizer, with the retained-but-dropped tool results listed as
+// CompactionPlan.MustRetain facts so the summary calls them out instead
+// of silently losing them.
+type RecencyToolAwarePlanner struct {
+	// KeepTurns is the number of trailing Content entries kept verbatim
+	// regardless of tool activity. KeepTurns <= 0 uses
+	// defaultRecencyToolAwareKeepTurns.
+	KeepTurns int
+}
+
+// NewRecencyToolAwarePlanner returns a RecencyToolAwarePlanner keeping the
+// last keepTurns Content entries verbatim; keepTurns <= 0 uses the
+// default.
+func NewRecencyToolAwarePlanner(keepTurns int) *RecencyToolAwarePlanner {
+	return &RecencyToolAwarePlanner{KeepTurns: keepTurns}
+}
+
+// Plan implements Planner.
+func (p *RecencyToolAwarePlanner) Plan(ctx agent.CallbackContext, req *model.LLMRequest, recentBudget int, todos []TodoItem) (CompactionPlan, error) {
+	contents := req.Contents
+	keepTurns := p.KeepTurns
+	if keepTurns <= 0 {
+		keepTurns = defaultRecencyToolAwareKeepTurns
+	}
+	if keepTurns >= len(contents) {
+		return CompactionPlan{Recent: append([]*genai.Content(nil), contents...)}, nil
+	}
+
+	splitIdx := safeSplitIndex(contents, len(contents)-keepTurns)
+
+	kept := make(map[int]bool, len(contents)-splitIdx)
+	for i := splitIdx; i < len(contents); i++ {
+		kept[i] = true
+	}
+
+	var mustRetain []string
+	for name, pair := range latestToolPairIndices(contents[:splitIdx]) {
+		kept[pair[0]] = true
+		kept[pair[1]] = true
+		mustRetain = append(mustRetain, fmt.Sprintf("the most recent result from tool %q", name))
+	}
+	sort.Strings(mustRetain)
+
+	old := make([]*genai.Content, 0, len(contents)-len(kept))
+	recent := make([]*genai.Content, 0, len(kept))
+	for i, c := range contents {
+		if kept[i] {
+			recent = append(recent, c)
+		} else {
+			old = append(old, c)
+		}
+	}
+
+	return CompactionPlan{Old: old, Recent: recent, MustRetain: mustRetain}, nil
+}
+
+// latestToolPairIndices maps each distinct tool name appearing in contents
+// to the [callIdx, respIdx] of its most recent FunctionCall/
+// FunctionResponse pair, matching responses to calls FIFO per name the
+// same way toolPairSpans does.
+func latestToolPairIndices(contents []*genai.Content) map[string][2]int {
+	pending := make(map[string][]int)
+	latest := make(map[string][2]int)
+
+	for i, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil {
+				continue
+			}
+			if part.FunctionCall != nil {
+				name := part.FunctionCall.Name
+				pending[name] = append(pending[name], i)
+			}
+			if part.FunctionResponse != nil {
+				name := part.FunctionResponse.Name
+				queue := pending[name]
+				if len(queue) == 0 {
+					continue
+				}
+				latest[name] = [2]int{queue[0], i}
+				pending[name] = queue[1:]
+			}
+		}
+	}
+	return latest
+}
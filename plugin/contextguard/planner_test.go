@@ -0,0 +1,161 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func TestThresholdPlanner_SplitsByRecencyWithoutEvictionOrCounter(t *testing.T) {
+	p := &thresholdPlanner{}
+	req := &model.LLMRequest{Contents: makeConversation(10)}
+
+	plan, err := p.Plan(newMockCallbackContext("agent1"), req, 100, nil)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Old)+len(plan.Recent) != len(req.Contents) {
+		t.Errorf("plan dropped content: old=%d recent=%d want total=%d", len(plan.Old), len(plan.Recent), len(req.Contents))
+	}
+	if len(plan.Recent) == 0 {
+		t.Error("expected a non-empty Recent tail")
+	}
+}
+
+func TestRecencyToolAwarePlanner_KeepsAllWhenShorterThanKeepTurns(t *testing.T) {
+	p := NewRecencyToolAwarePlanner(20)
+	req := &model.LLMRequest{Contents: makeConversation(3)}
+
+	plan, err := p.Plan(newMockCallbackContext("agent1"), req, 100, nil)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Old) != 0 {
+		t.Errorf("expected no Old content when KeepTurns exceeds conversation length, got %d", len(plan.Old))
+	}
+	if len(plan.Recent) != len(req.Contents) {
+		t.Errorf("Recent = %d entries, want all %d", len(plan.Recent), len(req.Contents))
+	}
+}
+
+func TestRecencyToolAwarePlanner_RetainsMostRecentToolPairPerName(t *testing.T) {
+	p := NewRecencyToolAwarePlanner(2)
+	contents := []*genai.Content{
+		textContent("user", "please look something up"),
+		toolCallContent("search"),
+		toolResultContent("search"),
+		textContent("model", "here is what I found"),
+		toolCallContent("search"),
+		toolResultContent("search"),
+		textContent("model", "an updated answer"),
+		textContent("user", "thanks"),
+		textContent("model", "you're welcome"),
+	}
+	req := &model.LLMRequest{Contents: contents}
+
+	plan, err := p.Plan(newMockCallbackContext("agent1"), req, 100, nil)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	foundSecondPair := false
+	for _, c := range plan.Recent {
+		if c == contents[4] || c == contents[5] {
+			foundSecondPair = true
+		}
+	}
+	if !foundSecondPair {
+		t.Error("expected the most recent search tool call/response pair to be kept in Recent")
+	}
+	if len(plan.MustRetain) != 1 {
+		t.Errorf("MustRetain = %v, want exactly one fact for the single distinct tool name", plan.MustRetain)
+	}
+}
+
+func TestRecencyToolAwarePlanner_NoMustRetainWithoutToolActivity(t *testing.T) {
+	p := NewRecencyToolAwarePlanner(2)
+	req := &model.LLMRequest{Contents: makeConversation(10)}
+
+	plan, err := p.Plan(newMockCallbackContext("agent1"), req, 100, nil)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.MustRetain) != 0 {
+		t.Errorf("MustRetain = %v, want empty for a conversation with no tool calls", plan.MustRetain)
+	}
+}
+
+func TestBuildSummarizePrompt_IncludesMustRetainFacts(t *testing.T) {
+	prompt := buildSummarizePrompt(makeConversation(2), "", nil, false, `the most recent result from tool "search"`)
+
+	for _, want := range []string{"[Facts that must be preserved]", `the most recent result from tool "search"`, "MUST explicitly retain"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestBuildSummarizePrompt_OmitsMustRetainSectionWhenEmpty(t *testing.T) {
+	prompt := buildSummarizePrompt(makeConversation(2), "", nil, false)
+
+	if strings.Contains(prompt, "[Facts that must be preserved]") {
+		t.Error("expected no must-retain section when no facts are supplied")
+	}
+}
+
+func TestWithPlanner_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	g := New(registry)
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	planner := NewRecencyToolAwarePlanner(4)
+
+	g.Add("agent1", llm, WithPlanner(planner))
+
+	strategy, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if strategy.planner != planner {
+		t.Fatal("expected the configured Planner to be installed on the strategy")
+	}
+}
+
+func TestThresholdStrategy_CompactUsesInjectedPlanner(t *testing.T) {
+	registry := newMockRegistry()
+	g := New(registry)
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	planner := NewRecencyToolAwarePlanner(2)
+
+	g.Add("agent1", llm, WithPlanner(planner), WithMaxTokens(10))
+
+	strategy := g.strategies["agent1"].(*thresholdStrategy)
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Model:    "small-model",
+		Contents: makeLargeConversation(50_000),
+	}
+
+	if err := strategy.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact returned error: %v", err)
+	}
+	if len(req.Contents) == 0 {
+		t.Fatal("expected Compact to leave at least the injected summary/continuation content")
+	}
+}
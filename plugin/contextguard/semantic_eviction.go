@@ -0,0 +1,305 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+)
+
+// Embedder produces vector embeddings for a batch of texts. It is the
+// pluggable dependency semanticEvictionStrategy uses to score how relevant
+// an older message still is to the conversation's current task.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EvictionStrategy selects which portion of contents should be summarized
+// away ("old") and which should be preserved verbatim ("recent") ahead of
+// a PreserveTail compaction. thresholdStrategy defaults to the plain
+// recency split (findSplitIndex) when none is set; WithSemanticEviction
+// installs an alternative that evicts by relevance instead of age.
+type EvictionStrategy interface {
+	Evict(ctx agent.CallbackContext, contents []*genai.Content, recentBudget int) (old, recent []*genai.Content)
+}
+
+// semanticEvictionStrategy scores each evictable unit (a standalone
+// message, or a FunctionCall/FunctionResponse pair kept together per the
+// same invariant safeSplitIndex enforces) by cosine similarity of its
+// embedding against the most recent user turn. The first keepFirst
+// messages and last keepRecent messages are never evicted regardless of
+// score, and their tokens are charged against recentBudget first; the
+// remaining units are then kept in descending score order for as long as
+// any budget is left, so the last unit kept can take the kept region past
+// recentBudget. Every unit not kept is evicted. Falls back to findSplitIndex's
+// recency split if the embedder errors.
+type semanticEvictionStrategy struct {
+	embedder   Embedder
+	keepRecent int
+	keepFirst  int
+}
+
+// WithSemanticEviction configures agentID's PreserveTail compaction to
+// evict middle messages by relevance to the current task rather than pure
+// recency. Each message (or tool_call/tool_response pair) is embedded and
+// scored by cosine similarity against the most recent user turn; the
+// lowest-scoring ones are summarized away first. keepFirst messages at the
+// start (typically the original task description) and keepRecent messages
+// at the end are always preserved verbatim regardless of score. Falls back
+// to the default recency split if the embedder returns an error. Only used
+// by the threshold and pattern strategies, and only when
+// ThresholdOptions.RetentionMode is PreserveTail.
+func WithSemanticEviction(embedder Embedder, keepRecent int, keepFirst int) AgentOption {
+	return func(c *agentConfig) {
+		c.evictionStrategy = &semanticEvictionStrategy{
+			embedder:   embedder,
+			keepRecent: keepRecent,
+			keepFirst:  keepFirst,
+		}
+	}
+}
+
+// evictionUnit is one message or tool_call/tool_response pair considered as
+// a single indivisible item for semantic scoring and eviction.
+type evictionUnit struct {
+	start, end int // inclusive index range into contents
+	text       string
+	score      float64
+}
+
+// Evict implements EvictionStrategy.
+func (s *semanticEvictionStrategy) Evict(ctx agent.CallbackContext, contents []*genai.Content, recentBudget int) (old, recent []*genai.Content) {
+	keepFirst := max(s.keepFirst, 0)
+	keepRecent := max(s.keepRecent, 0)
+	if keepFirst+keepRecent >= len(contents) {
+		return nil, contents
+	}
+
+	units := buildEvictionUnits(contents, keepFirst, len(contents)-keepRecent)
+	if len(units) == 0 {
+		return nil, contents
+	}
+
+	currentTask := mostRecentUserText(contents)
+	if err := s.scoreUnits(ctx, units, currentTask); err != nil {
+		slog.Warn("ContextGuard [semantic eviction]: embedding failed, falling back to recency split",
+			"agent", ctx.AgentName(),
+			"error", err,
+		)
+		splitIdx := findSplitIndex(contents, recentBudget)
+		return contents[:splitIdx], contents[splitIdx:]
+	}
+
+	sort.SliceStable(units, func(i, j int) bool { return units[i].score > units[j].score })
+
+	budget := recentBudget
+	budget -= estimateContentTokens(contents[:keepFirst])
+	budget -= estimateContentTokens(contents[len(contents)-keepRecent:])
+
+	kept := make(map[int]bool, len(units))
+	for _, u := range units {
+		if budget <= 0 {
+			break
+		}
+		for i := u.start; i <= u.end; i++ {
+			kept[i] = true
+		}
+		budget -= estimateContentTokens(contents[u.start : u.end+1])
+	}
+
+	for i, c := range contents {
+		if i < keepFirst || i >= len(contents)-keepRecent || kept[i] {
+			recent = append(recent, c)
+		} else {
+			old = append(old, c)
+		}
+	}
+	return old, recent
+}
+
+// scoreUnits embeds every not-yet-cached text among the most recent user
+// turn and the units in a single batch call (no call at all when every one
+// is cached), caching each embedding in session state keyed by a stable
+// hash of its text so repeated compactions over the same messages don't
+// re-embed them. It then sets each unit's
+// score to the cosine similarity against the current-task embedding.
+func (s *semanticEvictionStrategy) scoreUnits(ctx agent.CallbackContext, units []*evictionUnit, currentTask string) error {
+	cache := loadEmbeddingCache(ctx)
+
+	var missTexts []string
+	if _, ok := cache[embeddingCacheKey(currentTask)]; !ok {
+		missTexts = append(missTexts, currentTask)
+	}
+	for _, u := range units {
+		if _, ok := cache[embeddingCacheKey(u.text)]; !ok {
+			missTexts = append(missTexts, u.text)
+		}
+	}
+
+	if len(missTexts) > 0 {
+		embeddings, err := s.embedder.Embed(ctx, missTexts)
+		if err != nil {
+			return err
+		}
+		if len(embeddings) != len(missTexts) {
+			return fmt.Errorf("embedder returned %d embeddings for %d texts", len(embeddings), len(missTexts))
+		}
+		for i, text := range missTexts {
+			cache[embeddingCacheKey(text)] = embeddings[i]
+		}
+	}
+	currentTaskEmbedding := cache[embeddingCacheKey(currentTask)]
+
+	for _, u := range units {
+		u.score = cosineSimilarity(currentTaskEmbedding, cache[embeddingCacheKey(u.text)])
+	}
+
+	persistEmbeddingCache(ctx, cache)
+	return nil
+}
+
+// buildEvictionUnits partitions contents[rangeStart:rangeEnd) into
+// evictionUnits, grouping each FunctionCall/FunctionResponse pair spanning
+// the range into a single unit so eviction can never split one in half.
+func buildEvictionUnits(contents []*genai.Content, rangeStart, rangeEnd int) []*evictionUnit {
+	pairEnd := make(map[int]int)
+	for _, span := range toolPairSpans(contents) {
+		if span.callIdx >= rangeStart && span.respIdx < rangeEnd {
+			pairEnd[span.callIdx] = span.respIdx
+		}
+	}
+
+	var units []*evictionUnit
+	for i := rangeStart; i < rangeEnd; i++ {
+		end, isPairStart := pairEnd[i]
+		if !isPairStart {
+			if isInsidePair(pairEnd, i) {
+				continue
+			}
+			end = i
+		}
+		units = append(units, &evictionUnit{
+			start: i,
+			end:   end,
+			text:  contentRangeText(contents[i : end+1]),
+		})
+	}
+	return units
+}
+
+// isInsidePair reports whether idx falls inside (but not at the start of)
+// one of pairEnd's [call, response] spans.
+func isInsidePair(pairEnd map[int]int, idx int) bool {
+	for start, end := range pairEnd {
+		if idx > start && idx <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// mostRecentUserText returns the text of the last user-role Content entry
+// in contents — the conversation's current task, used as the relevance
+// anchor for semantic eviction scoring.
+func mostRecentUserText(contents []*genai.Content) string {
+	for i := len(contents) - 1; i >= 0; i-- {
+		c := contents[i]
+		if c == nil || c.Role != "user" {
+			continue
+		}
+		if text := contentRangeText([]*genai.Content{c}); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// contentRangeText joins the text parts of a contiguous slice of Content
+// entries with newlines, skipping FunctionCall/FunctionResponse parts that
+// don't carry plain text. A single text part is returned unchanged.
+func contentRangeText(contents []*genai.Content) string {
+	var texts []string
+	for _, c := range contents {
+		if c == nil {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part != nil && part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// cosineSimilarity returns the cosine similarity of a and b, or 0 if
+// either is empty or has zero magnitude.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(b) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, magA, magB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		magA += float64(a[i]) * float64(a[i])
+		magB += float64(b[i]) * float64(b[i])
+	}
+	if magA == 0 || magB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(magA) * math.Sqrt(magB))
+}
+
+// embeddingCacheKey returns the hex sha256 of text, used as its stable
+// embedding cache key.
+func embeddingCacheKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadEmbeddingCache reads the per-text-hash embedding cache from session
+// state. Returns an empty (non-nil) map if none has been recorded yet,
+// following loadOversizedCache's precedent.
+func loadEmbeddingCache(ctx agent.CallbackContext) map[string][]float32 {
+	key := stateKeyPrefixEmbeddingCache + ctx.AgentName()
+	val, err := ctx.State().Get(key)
+	if err != nil || val == nil {
+		return make(map[string][]float32)
+	}
+
+	if cache, ok := val.(map[string][]float32); ok {
+		return cache
+	}
+	return make(map[string][]float32)
+}
+
+// persistEmbeddingCache writes the text-hash -> embedding cache to session
+// state. Errors are logged but not propagated.
+func persistEmbeddingCache(ctx agent.CallbackContext, cache map[string][]float32) {
+	key := stateKeyPrefixEmbeddingCache + ctx.AgentName()
+	if err := ctx.State().Set(key, cache); err != nil {
+		slog.Warn("ContextGuard: failed to persist embedding cache", "error", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// stubEmbedder returns a fixed vector per input text, looked up by exact
+// match; any text not in vectors maps to a zero vector so cosine similarity
+// degrades to 0 instead of panicking.
+type stubEmbedder struct {
+	vectors map[string][]float32
+	err     error
+	calls   int
+}
+
+func (e *stubEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		if v, ok := e.vectors[text]; ok {
+			out[i] = v
+		} else {
+			out[i] = []float32{0, 0}
+		}
+	}
+	return out, nil
+}
+
+func TestSemanticEvictionStrategy_EvictsLowestScoringMiddleMessages(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "task: refactor the payment module\n"),
+		textContent("user", "unrelated aside about lunch plans\n"),
+		textContent("user", "payment module update: added retries\n"),
+		textContent("user", "recent follow-up\n"),
+	}
+	embedder := &stubEmbedder{vectors: map[string][]float32{
+		"recent follow-up\n":                     {1, 0},
+		"unrelated aside about lunch plans\n":    {0, 1},
+		"payment module update: added retries\n": {1, 0},
+	}}
+	strategy := &semanticEvictionStrategy{embedder: embedder, keepFirst: 1, keepRecent: 1}
+	ctx := newMockCallbackContext("agent1")
+
+	old, recent := strategy.Evict(ctx, contents, 15)
+
+	if len(old) != 1 || old[0] != contents[1] {
+		t.Fatalf("old should contain only the unrelated aside, got %v", old)
+	}
+	wantRecent := []*genai.Content{contents[0], contents[2], contents[3]}
+	if len(recent) != len(wantRecent) {
+		t.Fatalf("recent = %d entries, want %d", len(recent), len(wantRecent))
+	}
+	for i, c := range wantRecent {
+		if recent[i] != c {
+			t.Errorf("recent[%d] = %v, want %v", i, recent[i], c)
+		}
+	}
+}
+
+func TestSemanticEvictionStrategy_KeepsToolPairsTogether(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "task: investigate the outage\n"),
+		{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "lookup_logs"}}}},
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "lookup_logs"}}}},
+		textContent("user", "recent status update\n"),
+	}
+	embedder := &stubEmbedder{vectors: map[string][]float32{
+		"recent status update\n": {1, 0},
+	}}
+	strategy := &semanticEvictionStrategy{embedder: embedder, keepFirst: 1, keepRecent: 1}
+	ctx := newMockCallbackContext("agent1")
+
+	old, _ := strategy.Evict(ctx, contents, 0)
+
+	if len(old) != 2 || old[0] != contents[1] || old[1] != contents[2] {
+		t.Fatalf("old should evict the call/response pair together, got %v", old)
+	}
+}
+
+func TestSemanticEvictionStrategy_FallsBackToRecencyOnEmbedderError(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "first\n"),
+		textContent("user", "second\n"),
+		textContent("user", "third\n"),
+		textContent("user", "fourth\n"),
+	}
+	embedder := &stubEmbedder{err: errors.New("embedding service unavailable")}
+	strategy := &semanticEvictionStrategy{embedder: embedder, keepFirst: 1, keepRecent: 1}
+	ctx := newMockCallbackContext("agent1")
+
+	old, recent := strategy.Evict(ctx, contents, 5)
+
+	wantOld, wantRecent := contents[:findSplitIndex(contents, 5)], contents[findSplitIndex(contents, 5):]
+	if len(old) != len(wantOld) || len(recent) != len(wantRecent) {
+		t.Errorf("fallback split = (%d, %d) entries, want (%d, %d) matching findSplitIndex",
+			len(old), len(recent), len(wantOld), len(wantRecent))
+	}
+}
+
+func TestSemanticEvictionStrategy_CachesEmbeddingsAcrossCalls(t *testing.T) {
+	contents := []*genai.Content{
+		textContent("user", "task\n"),
+		textContent("user", "middle\n"),
+		textContent("user", "tail\n"),
+	}
+	embedder := &stubEmbedder{vectors: map[string][]float32{
+		"middle\n": {1, 0},
+		"tail\n":   {1, 0},
+	}}
+	strategy := &semanticEvictionStrategy{embedder: embedder, keepFirst: 1, keepRecent: 1}
+	ctx := newMockCallbackContext("agent1")
+
+	strategy.Evict(ctx, contents, 1000)
+	callsAfterFirst := embedder.calls
+	strategy.Evict(ctx, contents, 1000)
+
+	if embedder.calls != callsAfterFirst {
+		t.Errorf("Embed called %d more time(s) on the second pass, want 0 (cache hit)", embedder.calls-callsAfterFirst)
+	}
+}
+
+func TestWithSemanticEviction_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	g := New(registry)
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	embedder := &stubEmbedder{vectors: map[string][]float32{}}
+
+	g.Add("agent1", llm, WithSemanticEviction(embedder, 2, 1))
+
+	strategy, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if strategy.eviction == nil {
+		t.Fatal("expected eviction strategy to be set")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadScenario reads and decodes a Scenario from a JSON file at path. Only
+// JSON is supported — the rest of this module has no vendored YAML
+// dependency, so scenarios recorded from a production deployment should be
+// exported (or hand-authored) as JSON.
+func LoadScenario(path string) (Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("simtest: reading scenario %s: %w", path, err)
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return Scenario{}, fmt.Errorf("simtest: decoding scenario %s: %w", path, err)
+	}
+
+	return scenario, nil
+}
@@ -0,0 +1,354 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simtest replays recorded conversation workloads through a real
+// contextguard.ContextGuard, outside of a live ADK runner, so a scenario
+// captured from (or modeled after) a production deployment can be checked
+// into CI and diffed across contextguard versions.
+//
+// A Scenario is a flat, serializable description of a session: a sequence
+// of turns, each optionally carrying tool calls and inline attachments. Run
+// drives it through the agent's registered Strategy directly (via
+// contextguard.ContextGuard.StrategyFor), growing a genai.Content history
+// exactly like a real BeforeModelCallback would see it, and returns a
+// Report with per-turn token counts plus aggregate counters suitable for
+// asserting compaction behavior didn't regress.
+package simtest
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+
+	"github.com/achetronic/adk-utils-go/plugin/contextguard"
+)
+
+// ToolCall describes one tool invocation within a Turn: a FunctionCall from
+// the model followed by a FunctionResponse of approximately ResponseBytes
+// bytes.
+type ToolCall struct {
+	// Name is the tool name, e.g. "kubectl_get_pods".
+	Name string `json:"name"`
+
+	// ResponseBytes is the size of the synthetic FunctionResponse payload
+	// generated for this call.
+	ResponseBytes int `json:"responseBytes"`
+}
+
+// InlineAttachment describes one inline binary attachment (an image or PDF)
+// on a turn's user message.
+type InlineAttachment struct {
+	// MimeType is the attachment's MIME type, e.g. "image/png".
+	MimeType string `json:"mimeType"`
+
+	// SizeBytes is the size of the synthetic inline payload.
+	SizeBytes int `json:"sizeBytes"`
+}
+
+// Turn is one step of a replayed session: a user message, optionally
+// carrying tool calls and inline attachments.
+type Turn struct {
+	// UserMessage is the text of the user's message this turn, if any.
+	UserMessage string `json:"userMessage"`
+
+	// ToolCalls are tool invocations the model makes in response to this
+	// turn, in order.
+	ToolCalls []ToolCall `json:"toolCalls"`
+
+	// Attachments are inline binary attachments on this turn's user
+	// message, if any.
+	Attachments []InlineAttachment `json:"attachments"`
+
+	// Sequential marks this turn's ToolCalls as a single in-flight chain
+	// (matching thresholdStrategy.SetChainCompactionPolicy's expectations)
+	// rather than independent, separately-answered calls.
+	Sequential bool `json:"sequential"`
+}
+
+// Scenario is a recorded or hand-authored workload trace to replay against
+// a contextguard.ContextGuard.
+type Scenario struct {
+	// AgentID must match an agent registered on the ContextGuard passed to
+	// Run (via ContextGuard.Add).
+	AgentID string `json:"agentID"`
+
+	// Model is the model name Run reports in the synthetic LLMRequest,
+	// used by the agent's Strategy to resolve its context window.
+	Model string `json:"model"`
+
+	// ContextWindow is optional, used only to populate Report.Overflowed
+	// (a turn's post-compaction token estimate exceeding it). Leave zero to
+	// skip overflow detection — Run has no access to the ContextGuard's
+	// own ModelRegistry, so this is the caller's own estimate of the same
+	// number it configured the registry with for Model.
+	ContextWindow int `json:"contextWindow"`
+
+	// Turns is the ordered sequence of turns to replay.
+	Turns []Turn `json:"turns"`
+}
+
+// TurnReport is one turn's outcome within a Report.
+type TurnReport struct {
+	// Turn is the 0-based index into Scenario.Turns.
+	Turn int `json:"turn"`
+
+	// TokensBefore is the scenario's own byte/4 token estimate for the
+	// conversation immediately before this turn's Strategy.Compact call.
+	TokensBefore int `json:"tokensBefore"`
+
+	// TokensAfter is the same estimate immediately after.
+	TokensAfter int `json:"tokensAfter"`
+
+	// Compacted is true if this turn's token estimate dropped, signaling
+	// the strategy rewrote req.Contents.
+	Compacted bool `json:"compacted"`
+}
+
+// Report is the machine-readable outcome of replaying a Scenario, suitable
+// for JSON-encoding and diffing across contextguard versions in CI.
+type Report struct {
+	// Turns is the number of turns replayed.
+	Turns int `json:"turns"`
+
+	// Compactions is the number of turns on which Compacted was true.
+	Compactions int `json:"compactions"`
+
+	// MaxTokensSeen is the highest TokensBefore observed across all turns.
+	MaxTokensSeen int `json:"maxTokensSeen"`
+
+	// Overflowed is true if any turn's TokensAfter still exceeded the
+	// model's context window once Compact returned, i.e. compaction
+	// couldn't bring the conversation back under budget.
+	Overflowed bool `json:"overflowed"`
+
+	// LoopDetected is true if three consecutive compactions in a row all
+	// failed to reduce the token estimate, suggesting the strategy is
+	// stuck repeatedly summarizing without making progress.
+	LoopDetected bool `json:"loopDetected"`
+
+	// PerTurn holds one TurnReport per replayed turn, in order.
+	PerTurn []TurnReport `json:"perTurn"`
+}
+
+// Run replays scenario against guard's registered strategy for
+// scenario.AgentID, returning a Report. It drives the agent's real Strategy
+// (looked up via guard.StrategyFor) the same way a BeforeModelCallback
+// would, using a minimal in-memory agent.CallbackContext — no ADK runner or
+// live LLM call is required.
+func Run(guard *contextguard.ContextGuard, scenario Scenario) (Report, error) {
+	strategy, ok := guard.StrategyFor(scenario.AgentID)
+	if !ok {
+		return Report{}, fmt.Errorf("simtest: no strategy registered for agent %q", scenario.AgentID)
+	}
+
+	ctx := newFakeCallbackContext(scenario.AgentID)
+	var contents []*genai.Content
+
+	report := Report{Turns: len(scenario.Turns)}
+
+	for i, turn := range scenario.Turns {
+		contents = append(contents, userTurnContent(turn))
+		for _, call := range turn.ToolCalls {
+			contents = append(contents, toolCallContent(call))
+		}
+
+		req := &model.LLMRequest{Model: scenario.Model, Contents: contents}
+
+		tokensBefore := estimateTokens(req)
+		if tokensBefore > report.MaxTokensSeen {
+			report.MaxTokensSeen = tokensBefore
+		}
+
+		if err := strategy.Compact(ctx, req); err != nil {
+			return report, fmt.Errorf("simtest: turn %d: %w", i, err)
+		}
+		contents = req.Contents
+
+		tokensAfter := estimateTokens(req)
+		compacted := tokensAfter < tokensBefore
+		if compacted {
+			report.Compactions++
+		}
+		if scenario.ContextWindow > 0 && tokensAfter > scenario.ContextWindow {
+			report.Overflowed = true
+		}
+
+		report.PerTurn = append(report.PerTurn, TurnReport{
+			Turn:         i,
+			TokensBefore: tokensBefore,
+			TokensAfter:  tokensAfter,
+			Compacted:    compacted,
+		})
+	}
+
+	for i := 0; i+2 < len(report.PerTurn); i++ {
+		a, b, c := report.PerTurn[i], report.PerTurn[i+1], report.PerTurn[i+2]
+		if a.Compacted && b.Compacted && c.Compacted &&
+			a.TokensAfter <= b.TokensAfter && b.TokensAfter <= c.TokensAfter {
+			report.LoopDetected = true
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// userTurnContent builds the user-role genai.Content for one turn: its
+// message text plus any inline attachments, rendered as synthetic
+// zero-filled bytes of the requested size.
+func userTurnContent(turn Turn) *genai.Content {
+	parts := make([]*genai.Part, 0, 1+len(turn.Attachments))
+	if turn.UserMessage != "" {
+		parts = append(parts, &genai.Part{Text: turn.UserMessage})
+	}
+	for _, att := range turn.Attachments {
+		parts = append(parts, &genai.Part{
+			InlineData: &genai.Blob{
+				MIMEType: att.MimeType,
+				Data:     make([]byte, att.SizeBytes),
+			},
+		})
+	}
+	return &genai.Content{Role: "user", Parts: parts}
+}
+
+// toolCallContent builds the [model:FunctionCall, user:FunctionResponse]
+// pair for one ToolCall, as a single Content per role matching the shape
+// detectToolChain/reduceToolChain expect in the threshold strategy.
+func toolCallContent(call ToolCall) *genai.Content {
+	return &genai.Content{
+		Role: "user",
+		Parts: []*genai.Part{{
+			FunctionResponse: &genai.FunctionResponse{
+				Name:     call.Name,
+				Response: map[string]any{"result": fmt.Sprintf("%0*d", call.ResponseBytes, 0)},
+			},
+		}},
+	}
+}
+
+// estimateTokens is a standalone byte/4 heuristic, independent of
+// contextguard's own unexported estimator, since Report is meant to be a
+// stable, portable measure for CI comparisons rather than a mirror of
+// whatever internal calibration a given contextguard version happens to
+// use.
+func estimateTokens(req *model.LLMRequest) int {
+	total := 0
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		for _, p := range c.Parts {
+			if p == nil {
+				continue
+			}
+			total += len(p.Text)
+			if p.FunctionResponse != nil {
+				total += len(fmt.Sprintf("%v", p.FunctionResponse.Response))
+			}
+			if p.FunctionCall != nil {
+				total += len(fmt.Sprintf("%v", p.FunctionCall.Args))
+			}
+			if p.InlineData != nil {
+				total += len(p.InlineData.Data)
+			}
+		}
+	}
+	return total / 4
+}
+
+// fakeState is a minimal in-memory session.State backing fakeCallbackContext.
+type fakeState struct {
+	data map[string]any
+}
+
+func newFakeState() *fakeState {
+	return &fakeState{data: make(map[string]any)}
+}
+
+func (s *fakeState) Get(key string) (any, error) {
+	v, ok := s.data[key]
+	if !ok {
+		return nil, fmt.Errorf("simtest: key not found: %s", key)
+	}
+	return v, nil
+}
+
+func (s *fakeState) Set(key string, val any) error {
+	s.data[key] = val
+	return nil
+}
+
+func (s *fakeState) All() iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		for k, v := range s.data {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// fakeArtifacts is a no-op agent.Artifacts backing fakeCallbackContext;
+// scenario replay has no use for artifact storage.
+type fakeArtifacts struct{}
+
+func (a *fakeArtifacts) Save(_ context.Context, _ string, _ *genai.Part) (*artifact.SaveResponse, error) {
+	return nil, nil
+}
+func (a *fakeArtifacts) List(_ context.Context) (*artifact.ListResponse, error) {
+	return nil, nil
+}
+func (a *fakeArtifacts) Load(_ context.Context, _ string) (*artifact.LoadResponse, error) {
+	return nil, nil
+}
+func (a *fakeArtifacts) LoadVersion(_ context.Context, _ string, _ int) (*artifact.LoadResponse, error) {
+	return nil, nil
+}
+
+// fakeCallbackContext is a minimal agent.CallbackContext for driving a
+// Strategy's Compact method directly, without a live ADK runner or session.
+type fakeCallbackContext struct {
+	context.Context
+	agentName    string
+	invocationID string
+	state        *fakeState
+}
+
+func newFakeCallbackContext(agentName string) *fakeCallbackContext {
+	return &fakeCallbackContext{
+		Context:      context.Background(),
+		agentName:    agentName,
+		invocationID: "simtest-run",
+		state:        newFakeState(),
+	}
+}
+
+func (c *fakeCallbackContext) UserContent() *genai.Content          { return nil }
+func (c *fakeCallbackContext) InvocationID() string                 { return c.invocationID }
+func (c *fakeCallbackContext) AgentName() string                    { return c.agentName }
+func (c *fakeCallbackContext) ReadonlyState() session.ReadonlyState { return c.state }
+func (c *fakeCallbackContext) UserID() string                       { return "simtest-user" }
+func (c *fakeCallbackContext) AppName() string                      { return "simtest" }
+func (c *fakeCallbackContext) SessionID() string                    { return "simtest-session" }
+func (c *fakeCallbackContext) Branch() string                       { return "" }
+func (c *fakeCallbackContext) Artifacts() agent.Artifacts           { return &fakeArtifacts{} }
+func (c *fakeCallbackContext) State() session.State                 { return c.state }
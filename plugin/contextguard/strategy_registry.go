@@ -0,0 +1,87 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"sync"
+
+	"google.golang.org/adk/model"
+)
+
+// StrategyConfig is passed to a factory registered with RegisterStrategy.
+// It carries the same registry and LLM every built-in strategy is
+// constructed with, plus a free-form Options map for whatever the custom
+// strategy needs — there's no shared option-typing across third-party
+// strategies the way there is for the built-ins' AgentOptions.
+type StrategyConfig struct {
+	// Registry is the ModelRegistry passed to New, for looking up the
+	// target model's context window and max output tokens.
+	Registry ModelRegistry
+
+	// LLM is the agent's own model, the same one the built-in strategies
+	// use for summarization unless SetSummarizer/SetSummarizationPool
+	// overrides it.
+	LLM model.LLM
+
+	// Options carries whatever free-form configuration the factory needs,
+	// set via WithStrategyOptions. Never populated by Add itself.
+	Options map[string]any
+}
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]func(StrategyConfig) (Strategy, error){}
+)
+
+// RegisterStrategy associates name with a factory that builds a Strategy,
+// so Add(agentID, llm, WithStrategy(name)) can select it without the
+// package needing to know about it ahead of time. This is how downstream
+// users ship semantic-similarity-based compaction, tool-call-aware
+// compaction, or org-specific redaction passes without forking the module.
+// Safe for concurrent use; typically called from an init function or
+// before any agent starts handling traffic. Registering under a name that
+// collides with a built-in strategy (e.g. "threshold") has no effect —
+// built-ins are always resolved first.
+func RegisterStrategy(name string, factory func(StrategyConfig) (Strategy, error)) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = factory
+}
+
+// lookupStrategy returns the factory registered for name, if any.
+func lookupStrategy(name string) (func(StrategyConfig) (Strategy, error), bool) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	factory, ok := strategies[name]
+	return factory, ok
+}
+
+// WithStrategy selects strategy by name: one of the built-in Strategy*
+// constants, or a name previously passed to RegisterStrategy. Unknown
+// names that weren't registered fall back to the threshold strategy, the
+// same as leaving strategy unset.
+func WithStrategy(name string) AgentOption {
+	return func(c *agentConfig) {
+		c.strategy = name
+	}
+}
+
+// WithStrategyOptions sets the Options a custom strategy's factory
+// receives via StrategyConfig. Ignored by every built-in strategy.
+func WithStrategyOptions(options map[string]any) AgentOption {
+	return func(c *agentConfig) {
+		c.strategyOptions = options
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// stubStrategy is a minimal Strategy used to exercise RegisterStrategy
+// without depending on any of the built-in strategies.
+type stubStrategy struct {
+	name string
+}
+
+func (s *stubStrategy) Name() string { return s.name }
+func (s *stubStrategy) Compact(agent.CallbackContext, *model.LLMRequest) error {
+	return nil
+}
+
+func TestRegisterStrategy_SelectedByAdd(t *testing.T) {
+	RegisterStrategy("test-custom-strategy", func(cfg StrategyConfig) (Strategy, error) {
+		if cfg.Registry == nil {
+			t.Error("expected non-nil Registry in StrategyConfig")
+		}
+		if cfg.LLM == nil {
+			t.Error("expected non-nil LLM in StrategyConfig")
+		}
+		return &stubStrategy{name: "test-custom-strategy"}, nil
+	})
+
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithStrategy("test-custom-strategy"))
+
+	got, ok := guard.strategies["agent1"].(*stubStrategy)
+	if !ok {
+		t.Fatalf("expected *stubStrategy, got %T", guard.strategies["agent1"])
+	}
+	if got.Name() != "test-custom-strategy" {
+		t.Errorf("Name() = %q, want %q", got.Name(), "test-custom-strategy")
+	}
+}
+
+func TestRegisterStrategy_OptionsForwarded(t *testing.T) {
+	var gotOptions map[string]any
+	RegisterStrategy("test-custom-strategy-options", func(cfg StrategyConfig) (Strategy, error) {
+		gotOptions = cfg.Options
+		return &stubStrategy{name: "test-custom-strategy-options"}, nil
+	})
+
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	opts := map[string]any{"threshold": 0.9}
+	guard.Add("agent1", llm, WithStrategy("test-custom-strategy-options"), WithStrategyOptions(opts))
+
+	if gotOptions["threshold"] != 0.9 {
+		t.Errorf("Options[\"threshold\"] = %v, want 0.9", gotOptions["threshold"])
+	}
+}
+
+func TestRegisterStrategy_FactoryErrorFallsBackToThreshold(t *testing.T) {
+	RegisterStrategy("test-custom-strategy-erroring", func(cfg StrategyConfig) (Strategy, error) {
+		return nil, errors.New("boom")
+	})
+
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithStrategy("test-custom-strategy-erroring"))
+
+	if _, ok := guard.strategies["agent1"].(*thresholdStrategy); !ok {
+		t.Fatalf("expected fallback to *thresholdStrategy, got %T", guard.strategies["agent1"])
+	}
+}
+
+func TestWithStrategy_UnregisteredNameFallsBackToThreshold(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	guard.Add("agent1", llm, WithStrategy("never-registered-strategy"))
+
+	if _, ok := guard.strategies["agent1"].(*thresholdStrategy); !ok {
+		t.Fatalf("expected fallback to *thresholdStrategy, got %T", guard.strategies["agent1"])
+	}
+}
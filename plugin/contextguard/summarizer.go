@@ -0,0 +1,83 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// Summarizer abstracts how thresholdStrategy turns evicted conversation
+// contents into a summary, so a caller can swap in an alternative to the
+// package's default single-shot summarizeStreaming call. See
+// MapReduceSummarizer and WithSummarizer.
+type Summarizer interface {
+	Summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem) (string, error)
+}
+
+// MapReduceSummarizer is a Summarizer that never risks a single summarizer
+// call overflowing its own context window: contents are partitioned into
+// ChunkTokens-sized chunks (never splitting a FunctionCall/FunctionResponse
+// pair), each chunk is summarized independently (the "map" phase, up to
+// PoolSize calls in flight at once), and the resulting partial summaries —
+// plus previousSummary, carried forward as an extra input — are folded down
+// to TargetTokens by repeated "reduce" passes, recursing for as many passes
+// as it takes to fit.
+//
+// This is the same mechanism thresholdStrategy already falls back to
+// internally for a single oversized turn (see hierarchicalCompact); what
+// MapReduceSummarizer adds is making it a caller-selectable Summarizer for
+// every compaction, with its own chunk size, target budget, and prompt
+// templates, via SetSummarizer/WithSummarizer — independent of (and instead
+// of) the package's default single-shot summarizer.
+type MapReduceSummarizer struct {
+	// ChunkTokens is the estimated-token size at which a chunk handed to a
+	// single map-phase summarizer call is closed (see partitionByTokenBudget).
+	// <= 0 selects defaultChunkTokenBudget.
+	ChunkTokens int
+
+	// TargetTokens is the combined token budget the reduce phase folds
+	// partial summaries down to. <= 0 falls back to the bufferTokens passed
+	// to Summarize.
+	TargetTokens int
+
+	// PoolSize bounds how many map or reduce calls run concurrently. <= 0
+	// selects defaultHierarchicalPoolSize.
+	PoolSize int
+
+	// MapPromptTemplate, when non-empty, replaces summarizeSystemPrompt as
+	// the system instruction for every map-phase call, letting a caller ask
+	// for e.g. a more mechanical, less narrative per-chunk summary than the
+	// reduce phase's final pass.
+	MapPromptTemplate string
+
+	// ReducePromptTemplate, when non-empty, replaces summarizeSystemPrompt as
+	// the system instruction for every reduce-phase call.
+	ReducePromptTemplate string
+}
+
+// Summarize implements Summarizer.
+func (m *MapReduceSummarizer) Summarize(ctx context.Context, llm model.LLM, contents []*genai.Content, previousSummary string, bufferTokens int, todos []TodoItem) (string, error) {
+	targetTokens := m.TargetTokens
+	if targetTokens <= 0 {
+		targetTokens = int(float64(bufferTokens) * 0.50)
+	}
+
+	return hierarchicalCompactWithTemplates(ctx, llm, contents, previousSummary, todos,
+		m.ChunkTokens, targetTokens, m.PoolSize, m.MapPromptTemplate, m.ReducePromptTemplate)
+}
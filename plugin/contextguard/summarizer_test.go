@@ -0,0 +1,178 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/adk/model"
+)
+
+// recordingLLM wraps mockLLM's fixed-response behavior while recording every
+// request's system instruction and user prompt text, so a test can assert
+// which prompt template a given call used.
+type recordingLLM struct {
+	mockLLM
+	mu            sync.Mutex
+	systemPrompts []string
+	userPrompts   []string
+}
+
+func (r *recordingLLM) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	r.mu.Lock()
+	if req.Config != nil && req.Config.SystemInstruction != nil && len(req.Config.SystemInstruction.Parts) > 0 {
+		r.systemPrompts = append(r.systemPrompts, req.Config.SystemInstruction.Parts[0].Text)
+	}
+	if len(req.Contents) > 0 && req.Contents[0] != nil && len(req.Contents[0].Parts) > 0 {
+		r.userPrompts = append(r.userPrompts, req.Contents[0].Parts[0].Text)
+	}
+	r.mu.Unlock()
+	return r.mockLLM.GenerateContent(ctx, req, stream)
+}
+
+func TestMapReduceSummarizer_ProducesASingleCondensedSummary(t *testing.T) {
+	llm := &mockLLM{name: "sim-model", response: "condensed partial summary"}
+	contents := kubeAgentConversation(30)
+
+	m := &MapReduceSummarizer{ChunkTokens: 2_000, TargetTokens: 200, PoolSize: 4}
+
+	summary, err := m.Summarize(context.Background(), llm, contents, "", 4_000, nil)
+	if err != nil {
+		t.Fatalf("Summarize error: %v", err)
+	}
+	if summary == "" {
+		t.Fatal("Summarize returned an empty summary")
+	}
+}
+
+func TestMapReduceSummarizer_CarriesPreviousSummaryForward(t *testing.T) {
+	llm := &mockLLM{name: "sim-model", response: "existing context plus new developments"}
+	contents := kubeAgentConversation(20)
+
+	m := &MapReduceSummarizer{ChunkTokens: 2_000, TargetTokens: 50, PoolSize: 4}
+
+	summary, err := m.Summarize(context.Background(), llm, contents, "previous summary text", 4_000, nil)
+	if err != nil {
+		t.Fatalf("Summarize error: %v", err)
+	}
+	if summary == "" {
+		t.Fatal("Summarize returned an empty summary")
+	}
+}
+
+func TestMapReduceSummarizer_UsesCustomPromptTemplatesPerPhase(t *testing.T) {
+	llm := &recordingLLM{mockLLM: mockLLM{name: "sim-model", response: "partial"}}
+	contents := kubeAgentConversation(30)
+
+	m := &MapReduceSummarizer{
+		ChunkTokens:          2_000,
+		TargetTokens:         50,
+		PoolSize:             4,
+		MapPromptTemplate:    "MAP_PHASE_MARKER: extract only facts.",
+		ReducePromptTemplate: "REDUCE_PHASE_MARKER: merge facts concisely.",
+	}
+
+	if _, err := m.Summarize(context.Background(), llm, contents, "", 4_000, nil); err != nil {
+		t.Fatalf("Summarize error: %v", err)
+	}
+
+	var sawMap, sawReduce bool
+	for _, p := range llm.systemPrompts {
+		if strings.Contains(p, "MAP_PHASE_MARKER") {
+			sawMap = true
+		}
+		if strings.Contains(p, "REDUCE_PHASE_MARKER") {
+			sawReduce = true
+		}
+	}
+	if !sawMap {
+		t.Error("no map-phase call used MapPromptTemplate")
+	}
+	if !sawReduce {
+		t.Error("no reduce-phase call used ReducePromptTemplate")
+	}
+}
+
+func TestMapReduceSummarizer_EmptyTemplatesUseDefaultSystemPrompt(t *testing.T) {
+	llm := &recordingLLM{mockLLM: mockLLM{name: "sim-model", response: "partial"}}
+	contents := kubeAgentConversation(30)
+
+	m := &MapReduceSummarizer{ChunkTokens: 2_000, TargetTokens: 50, PoolSize: 4}
+
+	if _, err := m.Summarize(context.Background(), llm, contents, "", 4_000, nil); err != nil {
+		t.Fatalf("Summarize error: %v", err)
+	}
+
+	for _, p := range llm.systemPrompts {
+		if !strings.Contains(p, summarizeSystemPrompt) {
+			t.Errorf("call used a non-default system prompt without a template configured: %q", p)
+		}
+	}
+}
+
+func TestWithSummarizer_RegistersOnThresholdStrategy(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	g := New(registry)
+	summarizer := &MapReduceSummarizer{ChunkTokens: 1_000, TargetTokens: 100}
+
+	g.Add("agent1", llm, WithSummarizer(summarizer))
+
+	ts, ok := g.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", g.strategies["agent1"])
+	}
+	if ts.summarizer != Summarizer(summarizer) {
+		t.Errorf("summarizer = %v, want the configured MapReduceSummarizer", ts.summarizer)
+	}
+}
+
+func TestThresholdStrategy_SetSummarizerRoutesCompactThroughIt(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"sim-model": 12_000},
+		maxTokens:      map[string]int{"sim-model": 4096},
+	}
+	llm := &mockLLM{name: "sim-model", response: "mapped and reduced summary"}
+
+	ts := newThresholdStrategy(registry, llm, 0)
+	ts.SetSummarizer(&MapReduceSummarizer{ChunkTokens: 1_000, TargetTokens: 200, PoolSize: 4})
+	ctx := newMockCallbackContext("sim-agent")
+
+	contents := kubeAgentConversation(50)
+	req := &model.LLMRequest{Model: "sim-model", Contents: copyContents(contents)}
+
+	if err := ts.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+
+	found := false
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		for _, p := range c.Parts {
+			if p != nil && strings.Contains(p.Text, "Previous conversation summary") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("Compact did not inject a summary produced via the configured Summarizer")
+	}
+}
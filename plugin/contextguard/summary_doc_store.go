@@ -0,0 +1,195 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SummaryDocStore persists SummaryDocs outside of session state, keyed by a
+// short opaque ref string rather than the (agentName, sessionID) pair
+// itself — so session state only ever has to carry the ref
+// (stateKeyPrefixSummaryRef), not the whole summary, and an unrelated agent
+// that's handed the ref (e.g. a supervisor reading a sub-agent's summary)
+// can dereference it without needing that agent's own session state. This
+// is distinct from SummaryStore: SummaryStore snapshots thresholdStrategy's
+// calibration counters alongside a flat summary string for cold-start
+// recovery, while SummaryDocStore holds the structured SummaryDoc
+// (WithStructuredSummary) that session state would otherwise store inline.
+type SummaryDocStore interface {
+	// Put stores doc and returns the ref Get can later retrieve it by.
+	Put(ctx context.Context, agentName, sessionID string, doc SummaryDoc) (ref string, err error)
+	Get(ctx context.Context, ref string) (SummaryDoc, error)
+}
+
+// MemorySummaryDocStore is the default SummaryDocStore: an in-process map
+// guarded by a mutex, keyed the same way MemorySummaryStore keys Snapshots.
+// It provides no cross-process durability — use FileSummaryDocStore or
+// BlobSummaryDocStore for that.
+type MemorySummaryDocStore struct {
+	mu   sync.Mutex
+	data map[string]SummaryDoc
+}
+
+// NewMemorySummaryDocStore creates an empty MemorySummaryDocStore.
+func NewMemorySummaryDocStore() *MemorySummaryDocStore {
+	return &MemorySummaryDocStore{data: make(map[string]SummaryDoc)}
+}
+
+// Put stores doc under a ref derived from (sessionID, agentName), replacing
+// any previous doc for the same pair.
+func (s *MemorySummaryDocStore) Put(_ context.Context, agentName, sessionID string, doc SummaryDoc) (string, error) {
+	ref := summaryStoreKey(sessionID, agentName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[ref] = doc
+	return ref, nil
+}
+
+// Get returns the doc stored under ref, or ErrSnapshotNotFound if none exists.
+func (s *MemorySummaryDocStore) Get(_ context.Context, ref string) (SummaryDoc, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.data[ref]
+	if !ok {
+		return SummaryDoc{}, ErrSnapshotNotFound
+	}
+	return doc, nil
+}
+
+// FileSummaryDocStore implements SummaryDocStore as one JSON file per
+// (sessionID, agentName) pair under Dir, the same single-node durability
+// model FileSummaryStore provides for Snapshots.
+type FileSummaryDocStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewFileSummaryDocStore creates a FileSummaryDocStore rooted at dir,
+// creating the directory (and any missing parents) if it doesn't already
+// exist.
+func NewFileSummaryDocStore(dir string) (*FileSummaryDocStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("contextguard: failed to create summary doc store dir: %w", err)
+	}
+	return &FileSummaryDocStore{Dir: dir}, nil
+}
+
+// path returns the on-disk path a ref maps to.
+func (s *FileSummaryDocStore) path(ref string) string {
+	return filepath.Join(s.Dir, sanitizeStoreKey(ref)+".json")
+}
+
+// Put writes doc to its JSON file and returns the ref it was stored under.
+func (s *FileSummaryDocStore) Put(_ context.Context, agentName, sessionID string, doc SummaryDoc) (string, error) {
+	ref := summaryStoreKey(sessionID, agentName)
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("contextguard: failed to encode summary doc: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.WriteFile(s.path(ref), data, 0o644); err != nil {
+		return "", fmt.Errorf("contextguard: failed to write summary doc: %w", err)
+	}
+	return ref, nil
+}
+
+// Get reads and decodes the JSON doc file for ref, returning
+// ErrSnapshotNotFound if it doesn't exist.
+func (s *FileSummaryDocStore) Get(_ context.Context, ref string) (SummaryDoc, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return SummaryDoc{}, ErrSnapshotNotFound
+		}
+		return SummaryDoc{}, fmt.Errorf("contextguard: failed to read summary doc: %w", err)
+	}
+
+	var doc SummaryDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return SummaryDoc{}, fmt.Errorf("contextguard: failed to decode summary doc: %w", err)
+	}
+	return doc, nil
+}
+
+// BlobClient is the minimal capability a caller's object-storage SDK client
+// must expose for BlobSummaryDocStore to persist SummaryDocs there. No
+// S3/GCS SDK is vendored in this repo (same reasoning as
+// tools/memory.AttributeSchema's hand-rolled validator) — wrap whatever
+// client is already in use (aws-sdk-go-v2's s3.Client,
+// cloud.google.com/go/storage.Client, ...) to satisfy this.
+type BlobClient interface {
+	PutObject(ctx context.Context, key string, data []byte) error
+	GetObject(ctx context.Context, key string) ([]byte, error)
+}
+
+// BlobSummaryDocStore implements SummaryDocStore against any BlobClient —
+// an S3 or GCS bucket in production — storing one JSON object per
+// (sessionID, agentName) ref under Prefix.
+type BlobSummaryDocStore struct {
+	Client BlobClient
+
+	// Prefix is prepended to every object key, e.g. "contextguard/summaries/".
+	// Empty stores objects at the bucket root.
+	Prefix string
+}
+
+// Put marshals doc to JSON and writes it via Client.PutObject, returning the
+// ref it was stored under.
+func (s *BlobSummaryDocStore) Put(ctx context.Context, agentName, sessionID string, doc SummaryDoc) (string, error) {
+	ref := summaryStoreKey(sessionID, agentName)
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("contextguard: failed to encode summary doc: %w", err)
+	}
+	if err := s.Client.PutObject(ctx, s.key(ref), data); err != nil {
+		return "", fmt.Errorf("contextguard: failed to put summary doc: %w", err)
+	}
+	return ref, nil
+}
+
+// Get fetches and decodes the JSON object for ref via Client.GetObject.
+func (s *BlobSummaryDocStore) Get(ctx context.Context, ref string) (SummaryDoc, error) {
+	data, err := s.Client.GetObject(ctx, s.key(ref))
+	if err != nil {
+		return SummaryDoc{}, fmt.Errorf("contextguard: failed to get summary doc: %w", err)
+	}
+
+	var doc SummaryDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return SummaryDoc{}, fmt.Errorf("contextguard: failed to decode summary doc: %w", err)
+	}
+	return doc, nil
+}
+
+// key returns ref's full object key, with Prefix applied and any
+// path-unsafe characters replaced (refs are built from caller-supplied
+// session IDs and agent names, which aren't guaranteed to be key-safe).
+func (s *BlobSummaryDocStore) key(ref string) string {
+	return s.Prefix + sanitizeStoreKey(ref)
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testSummaryDocStores exercises every SummaryDocStore implementation whose
+// Get returns ErrSnapshotNotFound on a miss, so a new backend only needs to
+// be added to this slice to get the same coverage. BlobSummaryDocStore is
+// exercised separately below: its "not found" semantics depend entirely on
+// the caller-supplied BlobClient, which has no such contract in this repo.
+func testSummaryDocStores(t *testing.T) []SummaryDocStore {
+	t.Helper()
+	fileStore, err := NewFileSummaryDocStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSummaryDocStore: %v", err)
+	}
+	return []SummaryDocStore{
+		NewMemorySummaryDocStore(),
+		fileStore,
+	}
+}
+
+func TestSummaryDocStore_GetMissingReturnsNotFound(t *testing.T) {
+	for _, store := range testSummaryDocStores(t) {
+		if _, err := store.Get(context.Background(), "sess-1/agent-1"); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("%T: Get on empty store = %v, want ErrSnapshotNotFound", store, err)
+		}
+	}
+}
+
+func TestSummaryDocStore_PutThenGetRoundTrips(t *testing.T) {
+	for _, store := range testSummaryDocStores(t) {
+		want := SummaryDoc{
+			CurrentState: "reviewing the PR",
+			KeyFacts:     []Fact{{Label: "repo", Detail: "adk-utils-go"}},
+			NextSteps:    []Step{{Description: "rerun the failing test"}},
+		}
+		ref, err := store.Put(context.Background(), "agent-1", "sess-1", want)
+		if err != nil {
+			t.Fatalf("%T: Put: %v", store, err)
+		}
+		if ref == "" {
+			t.Fatalf("%T: Put returned an empty ref", store)
+		}
+		got, err := store.Get(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("%T: Get: %v", store, err)
+		}
+		if got.CurrentState != want.CurrentState || len(got.KeyFacts) != 1 || got.KeyFacts[0].Detail != "adk-utils-go" {
+			t.Errorf("%T: Get = %+v, want %+v", store, got, want)
+		}
+	}
+}
+
+func TestSummaryDocStore_RefIsStableAcrossPuts(t *testing.T) {
+	for _, store := range testSummaryDocStores(t) {
+		ref1, err := store.Put(context.Background(), "agent-1", "sess-1", SummaryDoc{CurrentState: "first"})
+		if err != nil {
+			t.Fatalf("%T: Put: %v", store, err)
+		}
+		ref2, err := store.Put(context.Background(), "agent-1", "sess-1", SummaryDoc{CurrentState: "second"})
+		if err != nil {
+			t.Fatalf("%T: Put: %v", store, err)
+		}
+		if ref1 != ref2 {
+			t.Errorf("%T: ref changed across Puts for the same (agentName, sessionID): %q vs %q", store, ref1, ref2)
+		}
+		got, err := store.Get(context.Background(), ref2)
+		if err != nil {
+			t.Fatalf("%T: Get: %v", store, err)
+		}
+		if got.CurrentState != "second" {
+			t.Errorf("%T: Get = %+v, want the latest Put to win", store, got)
+		}
+	}
+}
+
+// fakeBlobClient is an in-process stand-in for a real object-storage SDK
+// client, satisfying BlobClient for tests since none is vendored in this repo.
+type fakeBlobClient struct {
+	objects map[string][]byte
+}
+
+func newFakeBlobClient() *fakeBlobClient {
+	return &fakeBlobClient{objects: make(map[string][]byte)}
+}
+
+func (c *fakeBlobClient) PutObject(_ context.Context, key string, data []byte) error {
+	c.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (c *fakeBlobClient) GetObject(_ context.Context, key string) ([]byte, error) {
+	data, ok := c.objects[key]
+	if !ok {
+		return nil, errors.New("fakeBlobClient: object not found")
+	}
+	return data, nil
+}
+
+func TestBlobSummaryDocStore_PutThenGetRoundTrips(t *testing.T) {
+	store := &BlobSummaryDocStore{Client: newFakeBlobClient(), Prefix: "contextguard/summaries/"}
+
+	want := SummaryDoc{CurrentState: "reviewing the PR"}
+	ref, err := store.Put(context.Background(), "agent-1", "sess-1", want)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, err := store.Get(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.CurrentState != want.CurrentState {
+		t.Errorf("Get = %+v, want %+v", got, want)
+	}
+}
+
+func TestBlobSummaryDocStore_AppliesPrefixToObjectKey(t *testing.T) {
+	client := newFakeBlobClient()
+	store := &BlobSummaryDocStore{Client: client, Prefix: "contextguard/summaries/"}
+
+	ref, err := store.Put(context.Background(), "agent-1", "sess-1", SummaryDoc{CurrentState: "x"})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, ok := client.objects[store.key(ref)]; !ok {
+		t.Errorf("Put did not write under the prefixed key %q, got keys %v", store.key(ref), client.objects)
+	}
+}
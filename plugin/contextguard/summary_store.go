@@ -0,0 +1,186 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrSnapshotNotFound is returned by SummaryStore.Get when no snapshot has
+// been persisted yet for a (sessionID, agentName) pair.
+var ErrSnapshotNotFound = errors.New("contextguard: no summary snapshot found")
+
+// Snapshot is the subset of compaction state that must survive a process
+// restart or move to a different replica: the running summary and the
+// calibration counters thresholdStrategy otherwise keeps only in
+// agent.CallbackContext's per-request session state (see loadSummary,
+// loadContentsAtCompaction, loadRealTokens, loadLastHeuristic).
+type Snapshot struct {
+	Summary              string
+	ContentsAtCompaction int
+	RealTokens           int
+	LastHeuristic        int
+}
+
+// SummaryStore persists compaction Snapshots outside of session state, so a
+// horizontally-scaled deployment doesn't lose its running summary whenever
+// the replica handling a session changes. Get returns ErrSnapshotNotFound
+// (not a zero Snapshot and nil error) when nothing has been stored yet, so
+// thresholdStrategy can distinguish "cold start" from "empty summary on
+// purpose" the same way loadSummary's ctx.State().Get miss does today.
+type SummaryStore interface {
+	Get(ctx context.Context, sessionID, agentName string) (Snapshot, error)
+	Put(ctx context.Context, sessionID, agentName string, snap Snapshot) error
+	Delete(ctx context.Context, sessionID, agentName string) error
+}
+
+// summaryStoreKey joins sessionID and agentName into a single map/file key.
+// A session's summary is always agent-scoped, matching stateKeyPrefixSummary
+// + ctx.AgentName()'s per-agent keying of session state.
+func summaryStoreKey(sessionID, agentName string) string {
+	return sessionID + "/" + agentName
+}
+
+// MemorySummaryStore is the default SummaryStore: an in-process map guarded
+// by a mutex. It provides no cross-process durability — use FileSummaryStore
+// or a custom SummaryStore backed by etcd/Redis for that — but lets
+// WithSummaryStore be exercised, and tests written, without any external
+// dependency.
+type MemorySummaryStore struct {
+	mu   sync.Mutex
+	data map[string]Snapshot
+}
+
+// NewMemorySummaryStore creates an empty MemorySummaryStore.
+func NewMemorySummaryStore() *MemorySummaryStore {
+	return &MemorySummaryStore{data: make(map[string]Snapshot)}
+}
+
+// Get returns the stored Snapshot, or ErrSnapshotNotFound if none exists.
+func (s *MemorySummaryStore) Get(ctx context.Context, sessionID, agentName string) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.data[summaryStoreKey(sessionID, agentName)]
+	if !ok {
+		return Snapshot{}, ErrSnapshotNotFound
+	}
+	return snap, nil
+}
+
+// Put stores snap, replacing any previous snapshot for the same session/agent.
+func (s *MemorySummaryStore) Put(ctx context.Context, sessionID, agentName string, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[summaryStoreKey(sessionID, agentName)] = snap
+	return nil
+}
+
+// Delete removes the stored snapshot, if any.
+func (s *MemorySummaryStore) Delete(ctx context.Context, sessionID, agentName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, summaryStoreKey(sessionID, agentName))
+	return nil
+}
+
+// FileSummaryStore implements SummaryStore as one JSON file per
+// (sessionID, agentName) pair under Dir, so a single-node deployment's
+// compaction state survives a process restart without an external KV
+// dependency. It is not safe for concurrent writers across processes — use a
+// shared-filesystem-aware SummaryStore (or the etcd/Redis backend a caller
+// provides) when running more than one replica against the same Dir.
+type FileSummaryStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewFileSummaryStore creates a FileSummaryStore rooted at dir, creating the
+// directory (and any missing parents) if it doesn't already exist.
+func NewFileSummaryStore(dir string) (*FileSummaryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("contextguard: failed to create summary store dir: %w", err)
+	}
+	return &FileSummaryStore{Dir: dir}, nil
+}
+
+// path returns the on-disk path for a (sessionID, agentName) pair. Both are
+// sanitized to a single path-safe token, since session IDs and agent names
+// are caller-supplied and may not be filesystem-safe as-is.
+func (s *FileSummaryStore) path(sessionID, agentName string) string {
+	return filepath.Join(s.Dir, sanitizeStoreKey(sessionID)+"__"+sanitizeStoreKey(agentName)+".json")
+}
+
+// sanitizeStoreKey replaces path-unsafe characters in a caller-supplied
+// session ID or agent name with "_", so it can be used as a single token in
+// a filesystem path or object-storage key. Shared by FileSummaryStore,
+// FileSummaryDocStore, and BlobSummaryDocStore.
+func sanitizeStoreKey(v string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(v)
+}
+
+// Get reads and decodes the JSON snapshot file, returning ErrSnapshotNotFound
+// if it doesn't exist.
+func (s *FileSummaryStore) Get(ctx context.Context, sessionID, agentName string) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(sessionID, agentName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Snapshot{}, ErrSnapshotNotFound
+		}
+		return Snapshot{}, fmt.Errorf("contextguard: failed to read summary snapshot: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("contextguard: failed to decode summary snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// Put writes snap to its JSON file, overwriting any previous contents.
+func (s *FileSummaryStore) Put(ctx context.Context, sessionID, agentName string, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("contextguard: failed to encode summary snapshot: %w", err)
+	}
+	if err := os.WriteFile(s.path(sessionID, agentName), data, 0o644); err != nil {
+		return fmt.Errorf("contextguard: failed to write summary snapshot: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the snapshot file, if any. A missing file is not an error.
+func (s *FileSummaryStore) Delete(ctx context.Context, sessionID, agentName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(sessionID, agentName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("contextguard: failed to delete summary snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// testSummaryStores exercises every SummaryStore implementation the package
+// ships with identical behavior expectations, so a new backend only needs to
+// be added to this slice to get the same coverage.
+func testSummaryStores(t *testing.T) []SummaryStore {
+	t.Helper()
+	fileStore, err := NewFileSummaryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSummaryStore: %v", err)
+	}
+	return []SummaryStore{
+		NewMemorySummaryStore(),
+		fileStore,
+	}
+}
+
+func TestSummaryStore_GetMissingReturnsNotFound(t *testing.T) {
+	for _, store := range testSummaryStores(t) {
+		_, err := store.Get(context.Background(), "sess-1", "agent-1")
+		if !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("%T: Get on empty store = %v, want ErrSnapshotNotFound", store, err)
+		}
+	}
+}
+
+func TestSummaryStore_PutThenGetRoundTrips(t *testing.T) {
+	for _, store := range testSummaryStores(t) {
+		want := Snapshot{
+			Summary:              "the conversation covered X and Y",
+			ContentsAtCompaction: 42,
+			RealTokens:           1000,
+			LastHeuristic:        900,
+		}
+		if err := store.Put(context.Background(), "sess-1", "agent-1", want); err != nil {
+			t.Fatalf("%T: Put: %v", store, err)
+		}
+		got, err := store.Get(context.Background(), "sess-1", "agent-1")
+		if err != nil {
+			t.Fatalf("%T: Get: %v", store, err)
+		}
+		if got != want {
+			t.Errorf("%T: Get = %+v, want %+v", store, got, want)
+		}
+	}
+}
+
+func TestSummaryStore_ScopedByAgentName(t *testing.T) {
+	for _, store := range testSummaryStores(t) {
+		a := Snapshot{Summary: "agent-a summary"}
+		b := Snapshot{Summary: "agent-b summary"}
+		if err := store.Put(context.Background(), "sess-1", "agent-a", a); err != nil {
+			t.Fatalf("%T: Put a: %v", store, err)
+		}
+		if err := store.Put(context.Background(), "sess-1", "agent-b", b); err != nil {
+			t.Fatalf("%T: Put b: %v", store, err)
+		}
+		got, err := store.Get(context.Background(), "sess-1", "agent-a")
+		if err != nil {
+			t.Fatalf("%T: Get a: %v", store, err)
+		}
+		if got.Summary != a.Summary {
+			t.Errorf("%T: agent-a snapshot leaked agent-b's summary: got %q", store, got.Summary)
+		}
+	}
+}
+
+func TestSummaryStore_Delete(t *testing.T) {
+	for _, store := range testSummaryStores(t) {
+		if err := store.Put(context.Background(), "sess-1", "agent-1", Snapshot{Summary: "s"}); err != nil {
+			t.Fatalf("%T: Put: %v", store, err)
+		}
+		if err := store.Delete(context.Background(), "sess-1", "agent-1"); err != nil {
+			t.Fatalf("%T: Delete: %v", store, err)
+		}
+		if _, err := store.Get(context.Background(), "sess-1", "agent-1"); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("%T: Get after Delete = %v, want ErrSnapshotNotFound", store, err)
+		}
+		// Deleting again should be a no-op, not an error.
+		if err := store.Delete(context.Background(), "sess-1", "agent-1"); err != nil {
+			t.Errorf("%T: Delete on already-deleted key: %v", store, err)
+		}
+	}
+}
+
+// TestThresholdStrategy_SummaryStoreColdStart verifies that a fresh
+// thresholdStrategy with no session state of its own (simulating a replica
+// that has never seen this session) picks up an existing summary from a
+// pre-populated SummaryStore instead of starting from an empty conversation.
+func TestThresholdStrategy_SummaryStoreColdStart(t *testing.T) {
+	registry := &mockRegistry{
+		contextWindows: map[string]int{"test-model": 8_000},
+		maxTokens:      map[string]int{"test-model": 4096},
+	}
+	llm := &mockLLM{name: "test-model", response: "Summary: ..."}
+
+	store := NewMemorySummaryStore()
+	if err := store.Put(context.Background(), "stress-session", "test-agent", Snapshot{
+		Summary:              "preexisting summary from another replica",
+		ContentsAtCompaction: 3,
+	}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	strategy := newThresholdStrategy(registry, llm, 0)
+	strategy.SetSummaryStore(store)
+
+	ctx := newMockCallbackContext("test-agent")
+	ctx.sessionID = "stress-session"
+
+	req := &model.LLMRequest{
+		Model: "test-model",
+		Contents: []*genai.Content{
+			{Role: "user", Parts: []*genai.Part{{Text: "hello"}}},
+		},
+	}
+
+	if err := strategy.Compact(ctx, req); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	if len(req.Contents) == 0 || req.Contents[0].Parts[0].Text == "" {
+		t.Fatal("expected the cold-start summary to be injected into req.Contents")
+	}
+	found := false
+	for _, p := range req.Contents[0].Parts {
+		if p != nil && strings.Contains(p.Text, "preexisting summary from another replica") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("req.Contents[0] = %+v, want it to contain the store's preexisting summary", req.Contents[0])
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// TokenBudget breaks estimateTokens's total down by component, so a caller
+// can tell which part of a request is actually driving a compaction
+// decision — e.g. a handful of short messages next to a persistently
+// attached set of MCP tool schemas that dominate the window on their own.
+// Total always equals estimateTokens(req); the fields just partition it.
+type TokenBudget struct {
+	ContentTokens           int
+	SystemInstructionTokens int
+	ToolTokens              int
+	InlineDataTokens        int
+	Total                   int
+}
+
+// EstimateTokenBudget returns a per-component token estimate for req, using
+// the same heuristics as estimateTokens. ContentTokens and
+// SystemInstructionTokens cover Text/FunctionCall/FunctionResponse parts;
+// InlineDataTokens is broken out separately since attachments (images,
+// audio, documents) are priced by a different, MIME-aware rate than text.
+func EstimateTokenBudget(req *model.LLMRequest) TokenBudget {
+	var budget TokenBudget
+
+	for _, content := range req.Contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			budget.ContentTokens += estimatePartTokensExcludingInlineData(part)
+			budget.InlineDataTokens += estimateInlineDataTokens(part)
+		}
+	}
+
+	if req.Config != nil {
+		if req.Config.SystemInstruction != nil {
+			for _, part := range req.Config.SystemInstruction.Parts {
+				budget.SystemInstructionTokens += estimatePartTokensExcludingInlineData(part)
+				budget.InlineDataTokens += estimateInlineDataTokens(part)
+			}
+		}
+		budget.ToolTokens = estimateToolTokens(req.Config.Tools)
+	}
+
+	budget.Total = budget.ContentTokens + budget.SystemInstructionTokens + budget.ToolTokens + budget.InlineDataTokens
+	return budget
+}
+
+// estimatePartTokensExcludingInlineData is estimatePartTokens minus its
+// InlineData contribution, so EstimateTokenBudget can report InlineData
+// separately without double-counting or duplicating the Text/FunctionCall/
+// FunctionResponse logic.
+func estimatePartTokensExcludingInlineData(part *genai.Part) int {
+	if part == nil {
+		return 0
+	}
+	total := estimatePartTokens(part)
+	total -= estimateInlineDataTokens(part)
+	return total
+}
+
+// estimateInlineDataTokens returns estimatePartTokens's InlineData
+// contribution alone.
+func estimateInlineDataTokens(part *genai.Part) int {
+	if part == nil || part.InlineData == nil {
+		return 0
+	}
+	return len(part.InlineData.MIMEType)/4 + len(part.InlineData.Data)/inlineDataBytesPerToken(part.InlineData.MIMEType)
+}
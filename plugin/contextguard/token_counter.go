@@ -0,0 +1,163 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"google.golang.org/genai"
+)
+
+// TokenCounter estimates token counts at text/Contents granularity, for
+// call sites like findSplitIndex that only ever need to count a string or a
+// slice of Contents rather than a whole *model.LLMRequest (that's
+// Tokenizer's job; see WithTokenizerRegistry). The default implementation
+// matches estimateContentTokens's ~4-chars-per-token heuristic; set a more
+// accurate one with WithTokenCounter when split-boundary decisions close to
+// the threshold need to be reliable for code, JSON tool payloads, or
+// non-Latin scripts, where the heuristic drifts most.
+type TokenCounter interface {
+	// CountText returns the estimated token count for a single string.
+	CountText(text string) int
+
+	// CountContents returns the estimated token count for a slice of
+	// Content entries, covering Text, FunctionCall, FunctionResponse, and
+	// InlineData parts the same way estimateContentTokens does.
+	CountContents(contents []*genai.Content) int
+}
+
+// heuristicTokenCounter is the default TokenCounter: the same ~4
+// chars-per-token approximation the package has always used, so enabling
+// the TokenCounter extension point changes nothing until a caller opts
+// into a more accurate one via WithTokenCounter.
+type heuristicTokenCounter struct{}
+
+func (heuristicTokenCounter) CountText(text string) int {
+	return len(text) / 4
+}
+
+func (heuristicTokenCounter) CountContents(contents []*genai.Content) int {
+	return estimateContentTokens(contents)
+}
+
+// tiktokenTokenCounter is a TokenCounter backed by a real BPE encoder (see
+// TiktokenEncodeFunc) for Text parts, for OpenAI models. Non-Text parts
+// (FunctionCall args, FunctionResponse payloads, InlineData) have no
+// BPE-countable text of their own, so they still fall back to the
+// heuristic, same as tiktokenTokenizer.
+type tiktokenTokenCounter struct {
+	encoding string
+	encode   TiktokenEncodeFunc
+}
+
+// NewTiktokenTokenCounter creates a TokenCounter that counts text via
+// encode under the given tiktoken encoding name (e.g. "o200k_base" for
+// gpt-4o/o1, "cl100k_base" for earlier gpt-4/gpt-3.5 models). Text that
+// fails to encode falls back to the heuristic for that call alone.
+func NewTiktokenTokenCounter(encoding string, encode TiktokenEncodeFunc) TokenCounter {
+	return tiktokenTokenCounter{encoding: encoding, encode: encode}
+}
+
+func (c tiktokenTokenCounter) CountText(text string) int {
+	if c.encode == nil || text == "" {
+		return heuristicTokenCounter{}.CountText(text)
+	}
+	n, err := c.encode(c.encoding, text)
+	if err != nil {
+		return heuristicTokenCounter{}.CountText(text)
+	}
+	return n
+}
+
+func (c tiktokenTokenCounter) CountContents(contents []*genai.Content) int {
+	total := 0
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part == nil {
+				continue
+			}
+			if part.Text != "" {
+				total += c.CountText(part.Text)
+				continue
+			}
+			total += estimatePartTokens(part)
+		}
+	}
+	return total
+}
+
+// anthropicRatioTokenCounter approximates Claude's tokenizer as a fixed
+// chars-per-token ratio, the same approximation claudeTokenizer uses for
+// Tokenizer. This package carries no dependency on Anthropic's SDK, so an
+// exact BPE count requires wiring in that SDK's own counter the same way
+// TiktokenEncodeFunc wires in tiktoken-go's.
+type anthropicRatioTokenCounter struct{}
+
+// anthropicCharsPerToken matches claudeTokenizer's calibrated ratio.
+const anthropicCharsPerToken = 3.6
+
+// NewAnthropicTokenCounter creates a TokenCounter approximating Claude's
+// tokenizer at the package's calibrated chars-per-token ratio.
+func NewAnthropicTokenCounter() TokenCounter {
+	return anthropicRatioTokenCounter{}
+}
+
+func (anthropicRatioTokenCounter) CountText(text string) int {
+	return int(float64(len(text)) / anthropicCharsPerToken)
+}
+
+func (c anthropicRatioTokenCounter) CountContents(contents []*genai.Content) int {
+	total := 0
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part == nil {
+				continue
+			}
+			if part.Text != "" {
+				total += c.CountText(part.Text)
+				continue
+			}
+			total += estimatePartTokens(part)
+		}
+	}
+	return total
+}
+
+// findSplitIndexWithCounter is findSplitIndex routed through counter
+// instead of the package's fixed estimatePartTokens heuristic, for callers
+// that opted into a more accurate TokenCounter via WithTokenCounter.
+func findSplitIndexWithCounter(contents []*genai.Content, recentBudget int, counter TokenCounter) int {
+	tokens := 0
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i] == nil {
+			continue
+		}
+		tokens += counter.CountContents(contents[i : i+1])
+		if tokens >= recentBudget {
+			if i < len(contents)-2 {
+				return safeSplitIndex(contents, i+1)
+			}
+			return safeSplitIndex(contents, len(contents)-2)
+		}
+	}
+	if len(contents) > 2 {
+		return safeSplitIndex(contents, len(contents)/2)
+	}
+	return safeSplitIndex(contents, 1)
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHeuristicTokenCounter_MatchesEstimateContentTokens(t *testing.T) {
+	contents := kubeAgentConversation(5)
+	counter := heuristicTokenCounter{}
+
+	if got, want := counter.CountContents(contents), estimateContentTokens(contents); got != want {
+		t.Errorf("CountContents() = %d, want %d (estimateContentTokens)", got, want)
+	}
+	if got, want := counter.CountText("a sixteen char!!"), len("a sixteen char!!")/4; got != want {
+		t.Errorf("CountText() = %d, want %d", got, want)
+	}
+}
+
+func TestTiktokenTokenCounter_UsesEncodeFunc(t *testing.T) {
+	counter := NewTiktokenTokenCounter("o200k_base", func(encoding, text string) (int, error) {
+		if encoding != "o200k_base" {
+			t.Errorf("encoding = %q, want o200k_base", encoding)
+		}
+		return 7, nil
+	})
+
+	if got := counter.CountText("whatever"); got != 7 {
+		t.Errorf("CountText() = %d, want 7", got)
+	}
+}
+
+func TestTiktokenTokenCounter_FallsBackToHeuristicOnEncodeError(t *testing.T) {
+	counter := NewTiktokenTokenCounter("o200k_base", func(encoding, text string) (int, error) {
+		return 0, errors.New("boom")
+	})
+
+	text := "some sample text here"
+	if got, want := counter.CountText(text), len(text)/4; got != want {
+		t.Errorf("CountText() = %d, want %d (heuristic fallback)", got, want)
+	}
+}
+
+func TestAnthropicTokenCounter_UsesCalibratedRatio(t *testing.T) {
+	counter := NewAnthropicTokenCounter()
+	text := "a string that is long enough to matter"
+	if got, want := counter.CountText(text), int(float64(len(text))/anthropicCharsPerToken); got != want {
+		t.Errorf("CountText() = %d, want %d", got, want)
+	}
+}
+
+func TestFindSplitIndexWithCounter_MatchesFindSplitIndexForHeuristicCounter(t *testing.T) {
+	contents := kubeAgentConversation(10)
+	recentBudget := 200
+
+	got := findSplitIndexWithCounter(contents, recentBudget, heuristicTokenCounter{})
+	want := findSplitIndex(contents, recentBudget)
+	if got != want {
+		t.Errorf("findSplitIndexWithCounter() = %d, want %d (findSplitIndex with heuristic counter)", got, want)
+	}
+}
+
+func TestWithTokenCounter_RegistersOnThresholdStrategy(t *testing.T) {
+	guard := New(newMockRegistry())
+	llm := &mockLLM{name: "gpt-4o"}
+	counter := NewAnthropicTokenCounter()
+	guard.Add("agent1", llm, WithTokenCounter(counter))
+
+	ts, ok := guard.strategies["agent1"].(*thresholdStrategy)
+	if !ok {
+		t.Fatalf("expected *thresholdStrategy, got %T", guard.strategies["agent1"])
+	}
+	if ts.counter == nil {
+		t.Error("expected counter to be set")
+	}
+}
+
+var _ TokenCounter = heuristicTokenCounter{}
+var _ TokenCounter = tiktokenTokenCounter{}
+var _ TokenCounter = anthropicRatioTokenCounter{}
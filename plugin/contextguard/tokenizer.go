@@ -0,0 +1,470 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// Tokenizer estimates the token count of an LLM request for a specific
+// model family. Plugged into ContextGuard via WithTokenizerRegistry so
+// beforeModel's compaction decision uses a provider-aware estimate instead
+// of the one-size-fits-all len/4 heuristic in estimateTokens, which the
+// stress tests show can drift 2-4x from real prompt tokens depending on
+// provider and language.
+type Tokenizer interface {
+	// CountTokens returns the estimated token count for req (contents,
+	// system instruction, and tool declarations).
+	CountTokens(req *model.LLMRequest) int
+}
+
+// ExactTokenizer is an optional capability a Tokenizer can implement to
+// declare that its CountTokens is a real provider-native count (e.g.
+// NewTiktokenTokenizer, NewVertexTokenizer) rather than a character-ratio
+// approximation. thresholdStrategy.estimateTotalTokens skips ratioTracker
+// calibration entirely for these — there's no systematic approximation
+// error left to correct for, so applying a learned correction factor on
+// top would only reintroduce drift.
+type ExactTokenizer interface {
+	Tokenizer
+	Exact() bool
+}
+
+// isExactTokenizer reports whether tk is an ExactTokenizer that currently
+// claims exactness.
+func isExactTokenizer(tk Tokenizer) bool {
+	exact, ok := tk.(ExactTokenizer)
+	return ok && exact.Exact()
+}
+
+// ContentTokenizer is an optional Tokenizer capability for counting a
+// single Content in isolation, without the caller building a throwaway
+// *model.LLMRequest around it. charRatioTokenizer, tiktokenTokenizer, and
+// sentencePieceTokenizer all implement it directly; countContent falls back
+// to CountTokens for any Tokenizer that doesn't.
+type ContentTokenizer interface {
+	Tokenizer
+	CountContent(c *genai.Content) int
+}
+
+// countContent returns tk.CountContent(c) if tk implements ContentTokenizer,
+// or else wraps c in a single-content *model.LLMRequest and calls
+// tk.CountTokens, so callers (e.g. a Strategy choosing per-content eviction
+// order) can count one Content regardless of which Tokenizer is configured.
+func countContent(tk Tokenizer, c *genai.Content) int {
+	if ct, ok := tk.(ContentTokenizer); ok {
+		return ct.CountContent(c)
+	}
+	if c == nil {
+		return 0
+	}
+	return tk.CountTokens(&model.LLMRequest{Contents: []*genai.Content{c}})
+}
+
+// charRatioTokenizer estimates tokens as total request characters divided
+// by CharsPerToken. This is still a heuristic, not a real BPE
+// implementation, but CharsPerToken lets each provider preset tune its own
+// ratio instead of sharing estimateTokens's single global 4-chars-per-token
+// constant. ratioTracker's online calibration closes the remaining gap
+// against each provider's real reported token counts.
+type charRatioTokenizer struct {
+	CharsPerToken float64
+}
+
+func (t charRatioTokenizer) CountTokens(req *model.LLMRequest) int {
+	chars := requestChars(req)
+	charsPerToken := t.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4.0
+	}
+	return int(float64(chars) / charsPerToken)
+}
+
+// CountContent estimates the token count of a single Content using the same
+// character-ratio heuristic CountTokens applies to a whole request.
+func (t charRatioTokenizer) CountContent(c *genai.Content) int {
+	if c == nil {
+		return 0
+	}
+	charsPerToken := t.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4.0
+	}
+	return int(float64(partsChars(c.Parts)) / charsPerToken)
+}
+
+// requestChars returns the total character count across req's contents,
+// system instruction, and tool declarations. Kept separate from
+// estimateTokens's per-field /4 rounding so a Tokenizer can apply its own
+// provider-specific ratio to the same character total.
+func requestChars(req *model.LLMRequest) int {
+	chars := 0
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		chars += partsChars(c.Parts)
+	}
+	if req.Config != nil {
+		if req.Config.SystemInstruction != nil {
+			chars += partsChars(req.Config.SystemInstruction.Parts)
+		}
+		chars += toolChars(req.Config.Tools)
+	}
+	return chars
+}
+
+// partsChars mirrors estimatePartTokens's field coverage (Text,
+// FunctionCall, FunctionResponse, InlineData) but returns raw characters
+// instead of a pre-divided token count.
+func partsChars(parts []*genai.Part) int {
+	chars := 0
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		chars += len(part.Text)
+		if part.FunctionCall != nil {
+			chars += len(part.FunctionCall.Name)
+			for k, v := range part.FunctionCall.Args {
+				chars += len(k)
+				chars += len(fmt.Sprintf("%v", v))
+			}
+		}
+		if part.FunctionResponse != nil {
+			chars += len(part.FunctionResponse.Name)
+			chars += len(fmt.Sprintf("%v", part.FunctionResponse.Response))
+		}
+		if part.InlineData != nil {
+			chars += len(part.InlineData.MIMEType)
+			chars += len(part.InlineData.Data)
+		}
+	}
+	return chars
+}
+
+// toolChars mirrors estimateToolTokens's field coverage but returns raw
+// characters instead of a pre-divided token count.
+func toolChars(tools []*genai.Tool) int {
+	chars := 0
+	for _, tool := range tools {
+		if tool == nil {
+			continue
+		}
+		for _, fd := range tool.FunctionDeclarations {
+			if fd == nil {
+				continue
+			}
+			chars += len(fd.Name)
+			chars += len(fd.Description)
+			if fd.ParametersJsonSchema != nil {
+				if data, err := json.Marshal(fd.ParametersJsonSchema); err == nil {
+					chars += len(data)
+				}
+			} else if fd.Parameters != nil {
+				if data, err := json.Marshal(fd.Parameters); err == nil {
+					chars += len(data)
+				}
+			}
+		}
+	}
+	return chars
+}
+
+// Built-in tokenizer presets. These are calibrated approximations, not
+// exact BPE implementations — the online ratioTracker (see
+// WithTokenizerRegistry) closes the remaining gap against each provider's
+// real reported token counts as a session progresses.
+var (
+	// openAITokenizer approximates tiktoken's cl100k_base/o200k_base
+	// encodings, which average close to 4 characters per token for
+	// English text.
+	openAITokenizer Tokenizer = charRatioTokenizer{CharsPerToken: 4.0}
+
+	// claudeTokenizer approximates Anthropic's tokenizer, which tends to
+	// run slightly denser than OpenAI's for the same English text.
+	claudeTokenizer Tokenizer = charRatioTokenizer{CharsPerToken: 3.6}
+
+	// geminiTokenizer approximates Gemini's SentencePiece-based tokenizer.
+	geminiTokenizer Tokenizer = charRatioTokenizer{CharsPerToken: 4.2}
+)
+
+// TokenizerRegistry resolves a Tokenizer by model name prefix, so
+// ContextGuard can pick the right provider-specific estimate (OpenAI vs
+// Claude vs Gemini) without callers hardcoding it per agent. Mirrors the
+// lookup-by-model-ID shape of ModelRegistry.
+type TokenizerRegistry struct {
+	mu       sync.RWMutex
+	entries  []tokenizerEntry
+	fallback Tokenizer
+
+	// inlineCosts, when set, makes Resolve wrap the resolved Tokenizer so
+	// its InlineData contribution uses per-model image/PDF pricing
+	// instead of the byte-ratio heuristic. See SetInlineCostRegistry.
+	inlineCosts *InlineCostRegistry
+}
+
+type tokenizerEntry struct {
+	prefix    string
+	tokenizer Tokenizer
+}
+
+// NewTokenizerRegistry creates a registry pre-populated with presets for
+// OpenAI (gpt-, o1-, o3-, o4-), Anthropic (claude-), and Google (gemini-)
+// model names. Register can add or override presets.
+func NewTokenizerRegistry() *TokenizerRegistry {
+	r := &TokenizerRegistry{fallback: charRatioTokenizer{CharsPerToken: 4.0}}
+	r.Register("gpt-", openAITokenizer)
+	r.Register("o1-", openAITokenizer)
+	r.Register("o3-", openAITokenizer)
+	r.Register("o4-", openAITokenizer)
+	r.Register("claude-", claudeTokenizer)
+	r.Register("gemini-", geminiTokenizer)
+	return r
+}
+
+// Register associates a model name prefix with a Tokenizer. On a Resolve
+// conflict between two registered prefixes, the longer (more specific) one
+// wins.
+func (r *TokenizerRegistry) Register(modelPrefix string, tokenizer Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, tokenizerEntry{prefix: modelPrefix, tokenizer: tokenizer})
+}
+
+// SetInlineCostRegistry makes Resolve price InlineData attachments
+// (images, PDFs) using costs's per-model rules instead of the default
+// byte-ratio heuristic, for every model this registry subsequently
+// resolves.
+func (r *TokenizerRegistry) SetInlineCostRegistry(costs *InlineCostRegistry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inlineCosts = costs
+}
+
+// Resolve returns the Tokenizer registered for the longest matching prefix
+// of modelID, or the registry's fallback (a generic 4-chars-per-token
+// estimate) if nothing matches. If SetInlineCostRegistry has been called,
+// the returned Tokenizer also prices InlineData attachments using modelID's
+// resolved InlineCostFunc.
+func (r *TokenizerRegistry) Resolve(modelID string) Tokenizer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best tokenizerEntry
+	for _, e := range r.entries {
+		if strings.HasPrefix(modelID, e.prefix) && len(e.prefix) > len(best.prefix) {
+			best = e
+		}
+	}
+	tokenizer := r.fallback
+	if best.tokenizer != nil {
+		tokenizer = best.tokenizer
+	}
+	if r.inlineCosts != nil {
+		return imageAwareTokenizer{base: tokenizer, costs: r.inlineCosts, model: modelID}
+	}
+	return tokenizer
+}
+
+// tokenizerProvider is an optional ModelRegistry capability: a registry that
+// can resolve its own per-model TokenizerRegistry, the same way it already
+// resolves context windows and max tokens. CrushRegistry.Tokenizers
+// implements it. ContextGuard.Add checks for it when an agent isn't given
+// its own WithTokenizerRegistry/WithTokenizer override, so one registry
+// supplies both a model's limits and its tokenizer.
+type tokenizerProvider interface {
+	Tokenizers() *TokenizerRegistry
+}
+
+// resolveTokenizerRegistry returns explicit, if non-nil, or else the
+// TokenizerRegistry registry supplies via the tokenizerProvider capability —
+// nil if neither is available, meaning the agent falls back to the plain
+// len/4 heuristic.
+func resolveTokenizerRegistry(registry ModelRegistry, explicit *TokenizerRegistry) *TokenizerRegistry {
+	if explicit != nil {
+		return explicit
+	}
+	if tp, ok := registry.(tokenizerProvider); ok {
+		return tp.Tokenizers()
+	}
+	return nil
+}
+
+// ratioTracker maintains a per-key exponentially-weighted token ratio
+// (observed real tokens / raw Tokenizer estimate), used to correct a
+// Tokenizer's estimate toward each agent's actual model behavior over time
+// instead of relying on a single last-call correction. Keyed by agent name
+// rather than model name directly, since that's the granularity at which
+// ContextGuard observes real token counts (one model per agent in
+// practice); see contextGuard.afterModel.
+//
+// It also keeps a bounded ring buffer of recent samples per key so Ratio
+// can optionally return a high percentile of the observed distribution
+// instead of the EWMA average — see SetCalibrationQuantile. Bimodal
+// sessions (mostly plain text with occasional JSON-heavy tool responses)
+// average out to a value that underestimates the worst turns; a p90/p95
+// keeps headroom for them instead.
+type ratioTracker struct {
+	mu      sync.Mutex
+	ratios  map[string]float64
+	samples map[string][]float64
+
+	// quantile selects the high-percentile calibration mode when > 0 (see
+	// SetCalibrationQuantile). Zero keeps the original EWMA-only behavior.
+	quantile float64
+}
+
+func newRatioTracker() *ratioTracker {
+	return &ratioTracker{
+		ratios:  make(map[string]float64),
+		samples: make(map[string][]float64),
+	}
+}
+
+// ratioEWMAAlpha weights each new observation against the running ratio.
+const ratioEWMAAlpha = 0.3
+
+// ratioSampleCapacity bounds how many recent per-key samples are kept for
+// quantile calibration. 200 is enough to resolve a p90/p99 without
+// unbounded growth across a long-running session.
+const ratioSampleCapacity = 200
+
+// SetCalibrationQuantile switches Ratio from its default EWMA average to
+// the given percentile (e.g. 0.9 for p90) of each key's recent sample
+// distribution, computed over the last ratioSampleCapacity observations.
+// Pass 0 to go back to the EWMA average. q is clamped to [0, 1].
+func (t *ratioTracker) SetCalibrationQuantile(q float64) {
+	if q < 0 {
+		q = 0
+	}
+	if q > 1 {
+		q = 1
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.quantile = q
+}
+
+// Observe records a new (heuristic, real) sample for key, updating its
+// exponentially-weighted ratio and appending to its sample ring buffer.
+// Ignored if heuristic <= 0. Samples are clamped to [1.0,
+// maxCorrectionFactor], same as tokenCount's single-call correction, since
+// a heuristic should never overestimate tokens by design.
+func (t *ratioTracker) Observe(key string, heuristic, real int) {
+	if heuristic <= 0 {
+		return
+	}
+	sample := float64(real) / float64(heuristic)
+	if sample < 1.0 {
+		sample = 1.0
+	}
+	if sample > maxCorrectionFactor {
+		sample = maxCorrectionFactor
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, ok := t.ratios[key]
+	if !ok {
+		t.ratios[key] = sample
+	} else {
+		t.ratios[key] = (1-ratioEWMAAlpha)*current + ratioEWMAAlpha*sample
+	}
+
+	buf := append(t.samples[key], sample)
+	if len(buf) > ratioSampleCapacity {
+		buf = buf[len(buf)-ratioSampleCapacity:]
+	}
+	t.samples[key] = buf
+}
+
+// Ratio returns the calibration ratio for key: the EWMA average by
+// default, or the configured high percentile of key's recent sample
+// distribution once SetCalibrationQuantile has been called with a
+// non-zero value. Defaults to defaultHeuristicCorrectionFactor if no
+// samples have been observed yet.
+func (t *ratioTracker) Ratio(key string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.quantile > 0 {
+		if samples, ok := t.samples[key]; ok && len(samples) > 0 {
+			sorted := append([]float64(nil), samples...)
+			sort.Float64s(sorted)
+			return quantileOf(sorted, t.quantile)
+		}
+		return defaultHeuristicCorrectionFactor
+	}
+
+	if r, ok := t.ratios[key]; ok {
+		return r
+	}
+	return defaultHeuristicCorrectionFactor
+}
+
+// RatioDistribution summarizes the shape of key's recent sample
+// distribution, for tests and debugging to assert calibration behaves as
+// expected under bimodal or skewed workloads.
+type RatioDistribution struct {
+	Min, P50, P90, P99, Max float64
+}
+
+// Distribution returns summary statistics over key's current sample ring
+// buffer. ok is false if no samples have been recorded for key yet.
+func (t *ratioTracker) Distribution(key string) (dist RatioDistribution, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples, exists := t.samples[key]
+	if !exists || len(samples) == 0 {
+		return RatioDistribution{}, false
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	return RatioDistribution{
+		Min: sorted[0],
+		P50: quantileOf(sorted, 0.50),
+		P90: quantileOf(sorted, 0.90),
+		P99: quantileOf(sorted, 0.99),
+		Max: sorted[len(sorted)-1],
+	}, true
+}
+
+// quantileOf returns the value at percentile p (0-1) of a pre-sorted
+// slice, using nearest-rank indexing. Mirrors percentile's int-slice
+// variant in compaction_strategy_adaptive.go for float64 samples.
+func quantileOf(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)-1))
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
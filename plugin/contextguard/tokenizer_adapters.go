@@ -0,0 +1,427 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// lastCallCache memoizes a single Tokenizer.CountTokens result against the
+// exact *model.LLMRequest and Contents length that produced it. ADK retries
+// the same LLM call (transient provider errors, rate limiting) by invoking
+// BeforeModelCallback again on the identical request object before
+// compaction has touched it, so this single-slot cache is enough to skip
+// re-tokenizing on that path; any strategy that actually shrinks
+// req.Contents between attempts changes the length and correctly misses.
+type lastCallCache struct {
+	mu       sync.Mutex
+	req      *model.LLMRequest
+	contentN int
+	count    int
+}
+
+// countTokens returns tk.CountTokens(req), reusing the last cached result
+// if req and its Contents length match the previous call.
+func (c *lastCallCache) countTokens(tk Tokenizer, req *model.LLMRequest) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.req == req && c.contentN == len(req.Contents) {
+		return c.count
+	}
+
+	c.count = tk.CountTokens(req)
+	c.req = req
+	c.contentN = len(req.Contents)
+	return c.count
+}
+
+// TiktokenEncodeFunc counts the tokens a tiktoken-go encoding would produce
+// for text. This package carries no third-party dependencies beyond
+// google.golang.org/adk and google.golang.org/genai, so NewTiktokenTokenizer
+// takes this function rather than importing tiktoken-go directly — wire in
+// tiktoken-go's own encoder (e.g. `len(enc.Encode(text, nil, nil))` for the
+// encoding named by encoding) from a module that already depends on it.
+type TiktokenEncodeFunc func(encoding, text string) (int, error)
+
+// tiktokenTokenizer is a Tokenizer backed by a real BPE encoder (see
+// TiktokenEncodeFunc) for Text parts, instead of charRatioTokenizer's
+// chars-per-token heuristic. Non-Text parts (FunctionCall args,
+// FunctionResponse payloads, InlineData) and tool declarations have no
+// BPE-countable text of their own, so they still fall back to the same
+// heuristic charRatioTokenizer uses.
+type tiktokenTokenizer struct {
+	encoding string
+	encode   TiktokenEncodeFunc
+}
+
+// NewTiktokenTokenizer creates a Tokenizer that counts every Text part via
+// encode under the given tiktoken encoding name (e.g. "o200k_base" for
+// gpt-4o/o1, "cl100k_base" for earlier gpt-4/gpt-3.5 models). A part that
+// fails to encode falls back to charRatioTokenizer's estimate for that part
+// alone, so one bad call doesn't invalidate the whole request's count.
+func NewTiktokenTokenizer(encoding string, encode TiktokenEncodeFunc) Tokenizer {
+	return tiktokenTokenizer{encoding: encoding, encode: encode}
+}
+
+func (t tiktokenTokenizer) CountTokens(req *model.LLMRequest) int {
+	if t.encode == nil {
+		return charRatioTokenizer{CharsPerToken: 4.0}.CountTokens(req)
+	}
+
+	total := 0
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		total += t.countParts(c.Parts)
+	}
+	if req.Config != nil {
+		if req.Config.SystemInstruction != nil {
+			total += t.countParts(req.Config.SystemInstruction.Parts)
+		}
+		total += estimateToolTokens(req.Config.Tools)
+	}
+	return total
+}
+
+// Exact reports whether t was configured with a real encode function — if
+// so, its text counts are a real BPE encoding rather than a heuristic, even
+// though non-text fields still fall back to charRatioTokenizer's estimate.
+func (t tiktokenTokenizer) Exact() bool {
+	return t.encode != nil
+}
+
+// CountContent applies the same per-part counting CountTokens uses to a
+// single Content, so callers don't need to wrap it in a throwaway
+// *model.LLMRequest first. See ContentTokenizer.
+func (t tiktokenTokenizer) CountContent(c *genai.Content) int {
+	if c == nil {
+		return 0
+	}
+	if t.encode == nil {
+		return charRatioTokenizer{CharsPerToken: 4.0}.CountContent(c)
+	}
+	return t.countParts(c.Parts)
+}
+
+// countParts applies encode to every Text part, plus FunctionCall.Args and
+// FunctionResponse.Response serialized the same way partsChars sums their
+// characters (see functionPayloadText), so tool-call turns get real BPE
+// counts instead of the char-ratio heuristic too. InlineData has no
+// encodable text of its own and still falls back to that heuristic.
+func (t tiktokenTokenizer) countParts(parts []*genai.Part) int {
+	total := 0
+	var nonText []*genai.Part
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		if text := functionPayloadText(part); text != "" {
+			total += t.encodeOrFallback(text)
+			continue
+		}
+		if part.Text == "" {
+			nonText = append(nonText, part)
+			continue
+		}
+		total += t.encodeOrFallback(part.Text)
+	}
+	total += partsChars(nonText) / 4
+	return total
+}
+
+// encodeOrFallback returns encode(t.encoding, text), or the char-ratio
+// heuristic for text if encoding fails.
+func (t tiktokenTokenizer) encodeOrFallback(text string) int {
+	n, err := t.encode(t.encoding, text)
+	if err != nil {
+		return len(text) / 4
+	}
+	return n
+}
+
+// functionPayloadText serializes a FunctionCall's Name and Args, or a
+// FunctionResponse's Name and Response, into the same text
+// partsChars sums the characters of — letting a real BPE encoder count
+// tool-call turns instead of falling back to the char-ratio heuristic
+// applied to every other non-text field. Returns "" for a part that is
+// neither, so the caller can tell whether to fall back to its own handling.
+func functionPayloadText(part *genai.Part) string {
+	var b strings.Builder
+	switch {
+	case part.FunctionCall != nil:
+		b.WriteString(part.FunctionCall.Name)
+		for k, v := range part.FunctionCall.Args {
+			b.WriteString(k)
+			fmt.Fprintf(&b, "%v", v)
+		}
+	case part.FunctionResponse != nil:
+		b.WriteString(part.FunctionResponse.Name)
+		fmt.Fprintf(&b, "%v", part.FunctionResponse.Response)
+	default:
+		return ""
+	}
+	return b.String()
+}
+
+// VertexTokenizerConfig configures a Tokenizer backed by Vertex AI's
+// countTokens RPC.
+type VertexTokenizerConfig struct {
+	// ProjectID and Location identify the Vertex AI endpoint
+	// (https://{Location}-aiplatform.googleapis.com).
+	ProjectID string
+	Location  string
+
+	// Model is the publisher model resource name, e.g. "gemini-1.5-pro".
+	Model string
+
+	// AccessToken is sent as a Bearer token. Vertex AI has no API-key-only
+	// auth path the way Consul/etcd's plain KV APIs do (see session/consul,
+	// session/etcd), so the caller must supply a short-lived OAuth2 token
+	// themselves and refresh it as needed.
+	AccessToken string
+
+	// HTTPClient, if set, replaces the default http.Client used for every
+	// request.
+	HTTPClient *http.Client
+
+	// Endpoint, if set, replaces the default
+	// https://{Location}-aiplatform.googleapis.com base URL — mainly for
+	// pointing at a test server.
+	Endpoint string
+}
+
+// vertexTokenizer is a Tokenizer that calls Vertex AI's countTokens RPC
+// (https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/count-tokens)
+// for an exact, provider-native token count, using only net/http and
+// encoding/json the way session/consul and session/etcd call their
+// backends' plain HTTP APIs. Falls back to charRatioTokenizer's heuristic
+// on any request error, the same way TokenizerRegistry.Resolve falls back
+// to a heuristic when no tokenizer matches a model.
+type vertexTokenizer struct {
+	cfg    VertexTokenizerConfig
+	client *http.Client
+}
+
+// NewVertexTokenizer creates a Tokenizer backed by Vertex AI's countTokens
+// RPC.
+func NewVertexTokenizer(cfg VertexTokenizerConfig) Tokenizer {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &vertexTokenizer{cfg: cfg, client: client}
+}
+
+func (t *vertexTokenizer) CountTokens(req *model.LLMRequest) int {
+	n, err := t.countTokens(context.Background(), req)
+	if err != nil {
+		return charRatioTokenizer{CharsPerToken: 4.0}.CountTokens(req)
+	}
+	return n
+}
+
+// Exact reports true: a successful CountTokens call is Vertex AI's own
+// reported count. A failed call already falls back to the heuristic above,
+// so this capability declaration doesn't need a per-call guard.
+func (t *vertexTokenizer) Exact() bool {
+	return true
+}
+
+type vertexCountTokensRequest struct {
+	Contents []vertexContent `json:"contents"`
+}
+
+type vertexContent struct {
+	Role  string       `json:"role"`
+	Parts []vertexPart `json:"parts"`
+}
+
+type vertexPart struct {
+	Text string `json:"text,omitempty"`
+}
+
+type vertexCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
+// countTokens sends req's Text content to Vertex AI's countTokens
+// endpoint. Non-Text parts (FunctionCall/FunctionResponse/InlineData) and
+// tool declarations aren't part of Vertex's countTokens request schema, so
+// they're omitted; CountTokens's heuristic fallback is the path that
+// covers requests dominated by those instead.
+func (t *vertexTokenizer) countTokens(ctx context.Context, req *model.LLMRequest) (int, error) {
+	body := vertexCountTokensRequest{}
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		vc := vertexContent{Role: c.Role}
+		for _, part := range c.Parts {
+			if part != nil && part.Text != "" {
+				vc.Parts = append(vc.Parts, vertexPart{Text: part.Text})
+			}
+		}
+		if len(vc.Parts) > 0 {
+			body.Contents = append(body.Contents, vc)
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("contextguard: marshaling vertex countTokens request: %w", err)
+	}
+
+	base := t.cfg.Endpoint
+	if base == "" {
+		base = fmt.Sprintf("https://%s-aiplatform.googleapis.com", t.cfg.Location)
+	}
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/google/models/%s:countTokens",
+		base, t.cfg.ProjectID, t.cfg.Location, t.cfg.Model)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("contextguard: building vertex countTokens request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if t.cfg.AccessToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+t.cfg.AccessToken)
+	}
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("contextguard: calling vertex countTokens: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("contextguard: vertex countTokens returned status %d", resp.StatusCode)
+	}
+
+	var out vertexCountTokensResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("contextguard: decoding vertex countTokens response: %w", err)
+	}
+	return out.TotalTokens, nil
+}
+
+// SentencePieceEncodeFunc counts the tokens a SentencePiece encoder (the
+// family Gemini's tokenizer belongs to) would produce for text. Passed in
+// rather than importing a SentencePiece implementation directly, for the
+// same dependency-free reason TiktokenEncodeFunc is — wire in a real
+// encoder (e.g. a loaded .model file's EncodeAsIds) from a module that
+// already depends on one.
+type SentencePieceEncodeFunc func(text string) (int, error)
+
+// sentencePieceTokenizer is a Tokenizer backed by a real SentencePiece
+// encoder (see SentencePieceEncodeFunc) for Text parts and FunctionCall/
+// FunctionResponse payloads, instead of charRatioTokenizer's chars-per-token
+// heuristic. InlineData still falls back to that heuristic, same as
+// tiktokenTokenizer.
+type sentencePieceTokenizer struct {
+	encode SentencePieceEncodeFunc
+}
+
+// NewSentencePieceTokenizer creates a Tokenizer that counts every Text
+// part, plus FunctionCall.Args and FunctionResponse.Response, via encode. A
+// part that fails to encode falls back to charRatioTokenizer's estimate for
+// that part alone, so one bad call doesn't invalidate the whole request's
+// count.
+func NewSentencePieceTokenizer(encode SentencePieceEncodeFunc) Tokenizer {
+	return sentencePieceTokenizer{encode: encode}
+}
+
+func (t sentencePieceTokenizer) CountTokens(req *model.LLMRequest) int {
+	if t.encode == nil {
+		return charRatioTokenizer{CharsPerToken: 4.2}.CountTokens(req)
+	}
+	total := 0
+	for _, c := range req.Contents {
+		if c == nil {
+			continue
+		}
+		total += t.countParts(c.Parts)
+	}
+	if req.Config != nil {
+		if req.Config.SystemInstruction != nil {
+			total += t.countParts(req.Config.SystemInstruction.Parts)
+		}
+		total += estimateToolTokens(req.Config.Tools)
+	}
+	return total
+}
+
+// Exact reports whether t was configured with a real encode function — see
+// tiktokenTokenizer.Exact, which this mirrors.
+func (t sentencePieceTokenizer) Exact() bool {
+	return t.encode != nil
+}
+
+// CountContent applies the same per-part counting CountTokens uses to a
+// single Content. See ContentTokenizer.
+func (t sentencePieceTokenizer) CountContent(c *genai.Content) int {
+	if c == nil {
+		return 0
+	}
+	if t.encode == nil {
+		return charRatioTokenizer{CharsPerToken: 4.2}.CountContent(c)
+	}
+	return t.countParts(c.Parts)
+}
+
+// countParts mirrors tiktokenTokenizer.countParts, routing Text parts and
+// serialized FunctionCall/FunctionResponse payloads through encode and
+// falling back to the char-ratio heuristic for everything else.
+func (t sentencePieceTokenizer) countParts(parts []*genai.Part) int {
+	total := 0
+	var nonText []*genai.Part
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		if text := functionPayloadText(part); text != "" {
+			total += t.encodeOrFallback(text)
+			continue
+		}
+		if part.Text == "" {
+			nonText = append(nonText, part)
+			continue
+		}
+		total += t.encodeOrFallback(part.Text)
+	}
+	total += partsChars(nonText) / 4
+	return total
+}
+
+// encodeOrFallback returns encode(text), or the char-ratio heuristic for
+// text if encoding fails.
+func (t sentencePieceTokenizer) encodeOrFallback(text string) int {
+	n, err := t.encode(text)
+	if err != nil {
+		return len(text) / 4
+	}
+	return n
+}
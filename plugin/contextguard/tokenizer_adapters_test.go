@@ -0,0 +1,309 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+// countingTokenizer counts CountTokens invocations so lastCallCache's
+// memoization can be verified without a real Tokenizer backend.
+type countingTokenizer struct {
+	calls int
+	value int
+}
+
+func (c *countingTokenizer) CountTokens(req *model.LLMRequest) int {
+	c.calls++
+	return c.value
+}
+
+func TestLastCallCache_ReusesResultForSameRequestAndLength(t *testing.T) {
+	tk := &countingTokenizer{value: 42}
+	var cache lastCallCache
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+
+	got1 := cache.countTokens(tk, req)
+	got2 := cache.countTokens(tk, req)
+
+	if got1 != 42 || got2 != 42 {
+		t.Fatalf("countTokens = %d, %d, want 42, 42", got1, got2)
+	}
+	if tk.calls != 1 {
+		t.Errorf("tk.calls = %d, want 1 (second call should hit the cache)", tk.calls)
+	}
+}
+
+func TestLastCallCache_MissesOnDifferentRequest(t *testing.T) {
+	tk := &countingTokenizer{value: 42}
+	var cache lastCallCache
+
+	req1 := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	req2 := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "bye")}}
+
+	cache.countTokens(tk, req1)
+	cache.countTokens(tk, req2)
+
+	if tk.calls != 2 {
+		t.Errorf("tk.calls = %d, want 2 (a different *model.LLMRequest must miss the cache)", tk.calls)
+	}
+}
+
+func TestLastCallCache_MissesWhenContentsLengthChanges(t *testing.T) {
+	tk := &countingTokenizer{value: 42}
+	var cache lastCallCache
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	cache.countTokens(tk, req)
+
+	req.Contents = append(req.Contents, textContent("model", "hello"))
+	cache.countTokens(tk, req)
+
+	if tk.calls != 2 {
+		t.Errorf("tk.calls = %d, want 2 (shrinking/growing Contents on the same request must miss)", tk.calls)
+	}
+}
+
+func TestNewTiktokenTokenizer_EncodesTextPartsAndFallsBackOnError(t *testing.T) {
+	encode := func(encoding, text string) (int, error) {
+		if encoding != "o200k_base" {
+			return 0, errors.New("unknown encoding")
+		}
+		if text == "fail" {
+			return 0, errors.New("boom")
+		}
+		return len(strings.Fields(text)), nil
+	}
+	tk := NewTiktokenTokenizer("o200k_base", encode)
+
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{
+			textContent("user", "four little words here"),
+		},
+	}
+	if got := tk.CountTokens(req); got != 4 {
+		t.Errorf("CountTokens() = %d, want 4", got)
+	}
+
+	failing := &model.LLMRequest{
+		Contents: []*genai.Content{textContent("user", "fail")},
+	}
+	if got := tk.CountTokens(failing); got != len("fail")/4 {
+		t.Errorf("CountTokens() on a failing encode = %d, want %d (heuristic fallback)", got, len("fail")/4)
+	}
+}
+
+func TestNewTiktokenTokenizer_NilEncodeFallsBackToHeuristic(t *testing.T) {
+	tk := NewTiktokenTokenizer("o200k_base", nil)
+	req := &model.LLMRequest{
+		Contents: []*genai.Content{textContent("user", strings.Repeat("a", 400))},
+	}
+	if got := tk.CountTokens(req); got != 100 {
+		t.Errorf("CountTokens() with nil encode = %d, want 100 (len/4 heuristic)", got)
+	}
+}
+
+func TestNewVertexTokenizer_CountsFromResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"totalTokens": 17}`))
+	}))
+	defer server.Close()
+
+	tk := NewVertexTokenizer(VertexTokenizerConfig{
+		ProjectID: "proj", Location: "us-central1", Model: "gemini-1.5-pro",
+		Endpoint: server.URL,
+	})
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "hi")}}
+	if got := tk.CountTokens(req); got != 17 {
+		t.Errorf("CountTokens() = %d, want 17", got)
+	}
+}
+
+func TestNewTiktokenTokenizer_ExactReflectsWhetherEncodeIsConfigured(t *testing.T) {
+	withEncode := NewTiktokenTokenizer("o200k_base", func(string, string) (int, error) { return 0, nil })
+	if !isExactTokenizer(withEncode) {
+		t.Error("isExactTokenizer() = false for a tiktoken tokenizer with a real encode func, want true")
+	}
+
+	withoutEncode := NewTiktokenTokenizer("o200k_base", nil)
+	if isExactTokenizer(withoutEncode) {
+		t.Error("isExactTokenizer() = true for a tiktoken tokenizer with nil encode, want false (heuristic fallback only)")
+	}
+}
+
+func TestNewVertexTokenizer_IsExact(t *testing.T) {
+	tk := NewVertexTokenizer(VertexTokenizerConfig{ProjectID: "proj", Location: "us-central1", Model: "gemini-1.5-pro"})
+	if !isExactTokenizer(tk) {
+		t.Error("isExactTokenizer() = false for a Vertex tokenizer, want true")
+	}
+}
+
+func TestThresholdStrategy_EstimateTotalTokens_SkipsRatioCalibrationForExactTokenizer(t *testing.T) {
+	registry := newMockRegistry()
+	llm := &mockLLM{name: "small-model", response: "summary"}
+	strategy := newThresholdStrategy(registry, llm, 8_000)
+
+	exact := &countingTokenizer{value: 100}
+	exactTk := exactCountingTokenizer{countingTokenizer: exact}
+	tokenizers := NewTokenizerRegistry()
+	tokenizers.Register("small-model", exactTk)
+	strategy.tokenizer = tokenizers
+	strategy.ratios = newRatioTracker()
+	strategy.ratios.Observe("agent1", 100, 500) // would 5x an uncalibrated heuristic
+
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{Model: "small-model", Contents: []*genai.Content{textContent("user", "hi")}}
+
+	if got := strategy.estimateTotalTokens(ctx, req); got != 100 {
+		t.Errorf("estimateTotalTokens() = %d, want 100 (exact tokenizer's raw count, no ratio applied)", got)
+	}
+}
+
+// exactCountingTokenizer adapts countingTokenizer to ExactTokenizer so it
+// can stand in for a provider-native tokenizer in tests.
+type exactCountingTokenizer struct {
+	*countingTokenizer
+}
+
+func (exactCountingTokenizer) Exact() bool { return true }
+
+func TestNewTiktokenTokenizer_EncodesFunctionCallArgsAndFunctionResponse(t *testing.T) {
+	encode := func(encoding, text string) (int, error) {
+		return len(strings.Fields(text)), nil
+	}
+	tk := NewTiktokenTokenizer("o200k_base", encode)
+
+	call := &genai.Content{Role: "model", Parts: []*genai.Part{
+		{FunctionCall: &genai.FunctionCall{Name: "get weather", Args: map[string]any{"city": "sunny san francisco"}}},
+	}}
+	resp := &genai.Content{Role: "user", Parts: []*genai.Part{
+		{FunctionResponse: &genai.FunctionResponse{Name: "get weather", Response: map[string]any{"forecast": "clear skies ahead"}}},
+	}}
+
+	req := &model.LLMRequest{Contents: []*genai.Content{call, resp}}
+	got := tk.CountTokens(req)
+	want := len(strings.Fields(functionPayloadText(call.Parts[0]))) + len(strings.Fields(functionPayloadText(resp.Parts[0])))
+	if got != want {
+		t.Errorf("CountTokens() = %d, want %d (FunctionCall.Args/FunctionResponse.Response routed through encode)", got, want)
+	}
+	if got == 0 {
+		t.Error("CountTokens() = 0, want a non-zero count for non-empty FunctionCall/FunctionResponse payloads")
+	}
+}
+
+func TestNewTiktokenTokenizer_CountContentMatchesCountTokensForSingleContent(t *testing.T) {
+	encode := func(encoding, text string) (int, error) {
+		return len(strings.Fields(text)), nil
+	}
+	tk := NewTiktokenTokenizer("o200k_base", encode)
+	c := textContent("user", "four little words here")
+
+	want := tk.CountTokens(&model.LLMRequest{Contents: []*genai.Content{c}})
+	got := tk.(ContentTokenizer).CountContent(c)
+	if got != want {
+		t.Errorf("CountContent() = %d, want %d (CountTokens on a single-content request)", got, want)
+	}
+}
+
+func TestCharRatioTokenizer_CountContentMatchesCountTokensForSingleContent(t *testing.T) {
+	tk := charRatioTokenizer{CharsPerToken: 4.0}
+	c := textContent("user", strings.Repeat("a", 400))
+
+	want := tk.CountTokens(&model.LLMRequest{Contents: []*genai.Content{c}})
+	if got := tk.CountContent(c); got != want {
+		t.Errorf("CountContent() = %d, want %d", got, want)
+	}
+}
+
+func TestCountContent_FallsBackForTokenizerWithoutContentTokenizer(t *testing.T) {
+	tk := &countingTokenizer{value: 7}
+	c := textContent("user", "hi")
+
+	if got := countContent(tk, c); got != 7 {
+		t.Errorf("countContent() = %d, want 7 (falls back to CountTokens on a single-content request)", got)
+	}
+	if tk.calls != 1 {
+		t.Errorf("tk.calls = %d, want 1", tk.calls)
+	}
+}
+
+func TestNewSentencePieceTokenizer_EncodesTextAndFallsBackOnError(t *testing.T) {
+	encode := func(text string) (int, error) {
+		if text == "fail" {
+			return 0, errors.New("boom")
+		}
+		return len(strings.Fields(text)), nil
+	}
+	tk := NewSentencePieceTokenizer(encode)
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "four little words here")}}
+	if got := tk.CountTokens(req); got != 4 {
+		t.Errorf("CountTokens() = %d, want 4", got)
+	}
+
+	failing := &model.LLMRequest{Contents: []*genai.Content{textContent("user", "fail")}}
+	if got := tk.CountTokens(failing); got != len("fail")/4 {
+		t.Errorf("CountTokens() on a failing encode = %d, want %d (heuristic fallback)", got, len("fail")/4)
+	}
+}
+
+func TestNewSentencePieceTokenizer_NilEncodeFallsBackToHeuristic(t *testing.T) {
+	tk := NewSentencePieceTokenizer(nil)
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", strings.Repeat("a", 420))}}
+	want := charRatioTokenizer{CharsPerToken: 4.2}.CountTokens(req)
+	if got := tk.CountTokens(req); got != want {
+		t.Errorf("CountTokens() with nil encode = %d, want %d (4.2 chars/token heuristic)", got, want)
+	}
+}
+
+func TestNewSentencePieceTokenizer_ExactReflectsWhetherEncodeIsConfigured(t *testing.T) {
+	withEncode := NewSentencePieceTokenizer(func(string) (int, error) { return 0, nil })
+	if !isExactTokenizer(withEncode) {
+		t.Error("isExactTokenizer() = false for a SentencePiece tokenizer with a real encode func, want true")
+	}
+
+	withoutEncode := NewSentencePieceTokenizer(nil)
+	if isExactTokenizer(withoutEncode) {
+		t.Error("isExactTokenizer() = true for a SentencePiece tokenizer with nil encode, want false")
+	}
+}
+
+func TestNewVertexTokenizer_FallsBackToHeuristicOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	tk := NewVertexTokenizer(VertexTokenizerConfig{
+		ProjectID: "proj", Location: "us-central1", Model: "gemini-1.5-pro",
+		Endpoint: server.URL,
+	})
+
+	req := &model.LLMRequest{Contents: []*genai.Content{textContent("user", strings.Repeat("a", 400))}}
+	if got := tk.CountTokens(req); got != 100 {
+		t.Errorf("CountTokens() on server error = %d, want 100 (heuristic fallback)", got)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import "testing"
+
+func TestRatioTracker_DefaultIsEWMA(t *testing.T) {
+	rt := newRatioTracker()
+	rt.Observe("agent", 100, 100)
+	rt.Observe("agent", 100, 300)
+
+	got := rt.Ratio("agent")
+	if got <= 1.0 || got >= 3.0 {
+		t.Errorf("Ratio() = %.3f, want an EWMA blend strictly between the two samples", got)
+	}
+}
+
+func TestRatioTracker_QuantileModePicksHighPercentile(t *testing.T) {
+	rt := newRatioTracker()
+	rt.SetCalibrationQuantile(0.9)
+
+	// Mostly plain-text turns near ratio 1.2, with occasional JSON-heavy
+	// tool responses near ratio 3.0 — a bimodal distribution an average
+	// would under-correct for.
+	for i := 0; i < 18; i++ {
+		rt.Observe("agent", 100, 120)
+	}
+	for i := 0; i < 2; i++ {
+		rt.Observe("agent", 100, 300)
+	}
+
+	got := rt.Ratio("agent")
+	if got < 1.5 {
+		t.Errorf("Ratio() at p90 = %.3f, want it pulled toward the high-ratio tail", got)
+	}
+}
+
+func TestRatioTracker_QuantileClampedToUnitInterval(t *testing.T) {
+	rt := newRatioTracker()
+	rt.SetCalibrationQuantile(2.0)
+	rt.Observe("agent", 100, 150)
+
+	if got := rt.Ratio("agent"); got != 1.5 {
+		t.Errorf("Ratio() with out-of-range quantile = %.3f, want 1.5 (clamped to p100 = max)", got)
+	}
+}
+
+func TestRatioTracker_DistributionReportsSummaryStats(t *testing.T) {
+	rt := newRatioTracker()
+	if _, ok := rt.Distribution("agent"); ok {
+		t.Fatal("Distribution() on an unobserved key should report ok=false")
+	}
+
+	rt.Observe("agent", 100, 100)
+	rt.Observe("agent", 100, 200)
+	rt.Observe("agent", 100, 400)
+
+	dist, ok := rt.Distribution("agent")
+	if !ok {
+		t.Fatal("Distribution() should report ok=true after observations")
+	}
+	if dist.Min != 1.0 || dist.Max != 4.0 {
+		t.Errorf("Distribution() = %+v, want Min=1.0 Max=4.0", dist)
+	}
+}
+
+func TestRatioTracker_SampleRingBufferBounded(t *testing.T) {
+	rt := newRatioTracker()
+	for i := 0; i < ratioSampleCapacity+50; i++ {
+		rt.Observe("agent", 100, 100)
+	}
+
+	if got := len(rt.samples["agent"]); got != ratioSampleCapacity {
+		t.Errorf("sample buffer length = %d, want capped at %d", got, ratioSampleCapacity)
+	}
+}
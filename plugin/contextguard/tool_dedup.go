@@ -0,0 +1,126 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/genai"
+)
+
+// dedupMarkerKey flags a FunctionResponse.Response map as already deduped,
+// so a response that was already replaced with a {deduped_ref, ...} stub in
+// an earlier BeforeModelCallback invocation doesn't get hashed and deduped
+// against itself.
+const dedupMarkerKey = "_contextguard_deduped"
+
+// DedupNormalizerFunc normalizes a rendered FunctionResponse payload before
+// hashing, so two responses that differ only in volatile fields (a
+// Kubernetes resourceVersion, a Prometheus sample timestamp) still hash
+// identically. Passed to WithDedupNormalizer; nil selects
+// defaultDedupNormalizer.
+type DedupNormalizerFunc func([]byte) []byte
+
+// dedupWhitespaceRE collapses runs of whitespace so that formatting-only
+// differences (a map printed with different key ordering or spacing)
+// don't defeat the hash.
+var dedupWhitespaceRE = regexp.MustCompile(`\s+`)
+
+// dedupTimestampRE matches RFC 3339 timestamps, the most common volatile
+// field in tool output (Kubernetes status fields, Prometheus sample times,
+// log lines), so two otherwise-identical responses taken seconds apart
+// still dedup.
+var dedupTimestampRE = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?`)
+
+// defaultDedupNormalizer strips RFC 3339 timestamps and collapses
+// whitespace before hashing. Tool-specific concerns (a kubectl
+// resourceVersion field, a SQL query's randomly-ordered row set) are not
+// handled here — callers with those concerns should supply their own
+// normalizer via WithDedupNormalizer.
+func defaultDedupNormalizer(b []byte) []byte {
+	b = dedupTimestampRE.ReplaceAll(b, []byte("<ts>"))
+	b = dedupWhitespaceRE.ReplaceAll(b, []byte(" "))
+	return b
+}
+
+// dedupHash renders name and response the same way capToolResponse does and
+// returns the hex sha256 of the normalized result.
+func dedupHash(name string, response map[string]any, normalizer DedupNormalizerFunc) string {
+	if normalizer == nil {
+		normalizer = defaultDedupNormalizer
+	}
+	rendered := fmt.Sprintf("%s:%v", name, response)
+	sum := sha256.Sum256(normalizer([]byte(rendered)))
+	return hex.EncodeToString(sum[:])
+}
+
+// dedupToolResponses walks contents in order, hashing every FunctionResponse
+// payload (via dedupHash) and comparing it against hashes already seen —
+// both earlier in contents and in previous BeforeModelCallback invocations,
+// via loadDedupHashes/persistDedupHashes — so dedup coverage survives across
+// compaction rounds even after the original occurrence has been summarized
+// away. The first occurrence of a given hash is left untouched; every
+// later one is replaced with {"deduped_ref": hash, "first_seen_turn": N},
+// where N is the Content index (within this call's contents) at which the
+// hash was first observed this call, or its previously-recorded index if
+// the hash was already known. Unlike reduceToolResponses, this runs over
+// the entire conversation including the most recent turn: deduping an
+// exact repeat of already-seen data loses nothing the model hasn't already
+// seen, unlike shape-based sampling. Returns how many responses were
+// deduped.
+func dedupToolResponses(ctx agent.CallbackContext, contents []*genai.Content, normalizer DedupNormalizerFunc) int {
+	seen := loadDedupHashes(ctx)
+
+	deduped := 0
+	for i, c := range contents {
+		if c == nil || c.Role != "user" {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			response := part.FunctionResponse.Response
+			if response == nil {
+				continue
+			}
+			if already, _ := response[dedupMarkerKey].(bool); already {
+				continue
+			}
+
+			hash := dedupHash(part.FunctionResponse.Name, response, normalizer)
+
+			firstSeen, ok := seen[hash]
+			if !ok {
+				seen[hash] = i
+				continue
+			}
+
+			part.FunctionResponse.Response = map[string]any{
+				"deduped_ref":     hash,
+				"first_seen_turn": firstSeen,
+				dedupMarkerKey:    true,
+			}
+			deduped++
+		}
+	}
+
+	persistDedupHashes(ctx, seen)
+	return deduped
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func kubectlGetContent(output string) *genai.Content {
+	return &genai.Content{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+		Name:     "kubectl_get_pods",
+		Response: map[string]any{"result": output},
+	}}}}
+}
+
+func TestDedupToolResponses_KeepsFirstDedupsRepeats(t *testing.T) {
+	contents := []*genai.Content{
+		kubectlGetContent("pod-a Running\npod-b Running"),
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+		kubectlGetContent("pod-a Running\npod-b Running"),
+		kubectlGetContent("pod-a Running\npod-b Running"),
+	}
+
+	ctx := newMockCallbackContext("dedup-agent")
+	deduped := dedupToolResponses(ctx, contents, nil)
+
+	if deduped != 2 {
+		t.Fatalf("deduped = %d, want 2", deduped)
+	}
+	if _, marked := contents[0].Parts[0].FunctionResponse.Response[dedupMarkerKey]; marked {
+		t.Error("the first occurrence should have been left untouched")
+	}
+	for _, i := range []int{2, 3} {
+		resp := contents[i].Parts[0].FunctionResponse.Response
+		if resp[dedupMarkerKey] != true {
+			t.Errorf("contents[%d] should have been marked deduped", i)
+		}
+		if resp["first_seen_turn"] != 0 {
+			t.Errorf("contents[%d] first_seen_turn = %v, want 0", i, resp["first_seen_turn"])
+		}
+	}
+}
+
+func TestDedupToolResponses_IgnoresTimestampOnlyDifferences(t *testing.T) {
+	contents := []*genai.Content{
+		kubectlGetContent("pod-a started at 2024-01-01T00:00:00Z"),
+		kubectlGetContent("pod-a started at 2024-01-01T00:05:12Z"),
+	}
+
+	if deduped := dedupToolResponses(newMockCallbackContext("dedup-agent"), contents, nil); deduped != 1 {
+		t.Fatalf("deduped = %d, want 1 (timestamps should normalize away)", deduped)
+	}
+}
+
+func TestDedupToolResponses_DistinctPayloadsNotDeduped(t *testing.T) {
+	contents := []*genai.Content{
+		kubectlGetContent("pod-a Running"),
+		kubectlGetContent("pod-b Running"),
+	}
+
+	if deduped := dedupToolResponses(newMockCallbackContext("dedup-agent"), contents, nil); deduped != 0 {
+		t.Errorf("deduped = %d, want 0 for distinct payloads", deduped)
+	}
+}
+
+func TestDedupToolResponses_SurvivesAcrossCalls(t *testing.T) {
+	ctx := newMockCallbackContext("dedup-agent")
+
+	first := []*genai.Content{kubectlGetContent("pod-a Running")}
+	if deduped := dedupToolResponses(ctx, first, nil); deduped != 0 {
+		t.Fatalf("deduped = %d, want 0 on first call", deduped)
+	}
+
+	second := []*genai.Content{kubectlGetContent("pod-a Running")}
+	if deduped := dedupToolResponses(ctx, second, nil); deduped != 1 {
+		t.Fatalf("deduped = %d, want 1 on a later call with the same hash recorded in state", deduped)
+	}
+}
+
+func TestDedupToolResponses_CustomNormalizer(t *testing.T) {
+	stripDigits := func(b []byte) []byte {
+		out := make([]byte, 0, len(b))
+		for _, c := range b {
+			if c < '0' || c > '9' {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+
+	contents := []*genai.Content{
+		kubectlGetContent("pod resourceVersion=111"),
+		kubectlGetContent("pod resourceVersion=222"),
+	}
+
+	if deduped := dedupToolResponses(newMockCallbackContext("dedup-agent"), contents, stripDigits); deduped != 1 {
+		t.Errorf("deduped = %d, want 1 with a digit-stripping normalizer", deduped)
+	}
+}
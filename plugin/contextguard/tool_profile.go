@@ -0,0 +1,64 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"log/slog"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+)
+
+// ToolFilter narrows down the tool declarations a BeforeModelCallback sends
+// to the model, e.g. to drop MCP tools that weren't used in the last N
+// turns once compaction has summarized those turns away. Returns the tools
+// to keep; the result replaces req.Config.Tools.
+type ToolFilter func(tools []*genai.Tool) []*genai.Tool
+
+// toolProfile pairs a ToolFilter with a name, for logging which profile
+// pruned what.
+type toolProfile struct {
+	name   string
+	filter ToolFilter
+}
+
+// apply runs p's filter against req.Config.Tools in place. No-ops if req
+// carries no tool declarations, or if the filter doesn't change the count —
+// estimateToolTokens already shows how much these declarations cost, so a
+// no-op skips logging noise for agents whose profile rarely trims anything.
+func (p *toolProfile) apply(ctx agent.CallbackContext, req *model.LLMRequest) {
+	if req.Config == nil || len(req.Config.Tools) == 0 {
+		return
+	}
+
+	before := req.Config.Tools
+	tokensBefore := estimateToolTokens(before)
+
+	after := p.filter(before)
+	if len(after) == len(before) {
+		return
+	}
+
+	req.Config.Tools = after
+	slog.Info("ContextGuard: tool profile pruned tool declarations",
+		"agent", ctx.AgentName(),
+		"profile", p.name,
+		"toolsBefore", len(before),
+		"toolsAfter", len(after),
+		"tokensSaved", tokensBefore-estimateToolTokens(after),
+	)
+}
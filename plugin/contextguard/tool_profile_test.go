@@ -0,0 +1,106 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+
+	"google.golang.org/adk/model"
+)
+
+func toolNamed(name string) *genai.Tool {
+	return &genai.Tool{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: name}}}
+}
+
+func TestToolProfile_ApplyPrunesTools(t *testing.T) {
+	profile := &toolProfile{
+		name: "post-summary",
+		filter: func(tools []*genai.Tool) []*genai.Tool {
+			var kept []*genai.Tool
+			for _, t := range tools {
+				if t.FunctionDeclarations[0].Name != "stale_tool" {
+					kept = append(kept, t)
+				}
+			}
+			return kept
+		},
+	}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			Tools: []*genai.Tool{toolNamed("stale_tool"), toolNamed("kept_tool")},
+		},
+	}
+
+	profile.apply(ctx, req)
+
+	if len(req.Config.Tools) != 1 {
+		t.Fatalf("req.Config.Tools = %d entries, want 1", len(req.Config.Tools))
+	}
+	if req.Config.Tools[0].FunctionDeclarations[0].Name != "kept_tool" {
+		t.Errorf("surviving tool = %q, want %q", req.Config.Tools[0].FunctionDeclarations[0].Name, "kept_tool")
+	}
+}
+
+func TestToolProfile_ApplyNoopWhenFilterKeepsEverything(t *testing.T) {
+	profile := &toolProfile{
+		name:   "noop",
+		filter: func(tools []*genai.Tool) []*genai.Tool { return tools },
+	}
+	ctx := newMockCallbackContext("agent1")
+	original := []*genai.Tool{toolNamed("a"), toolNamed("b")}
+	req := &model.LLMRequest{Config: &genai.GenerateContentConfig{Tools: original}}
+
+	profile.apply(ctx, req)
+
+	if len(req.Config.Tools) != 2 {
+		t.Errorf("req.Config.Tools = %d entries, want unchanged at 2", len(req.Config.Tools))
+	}
+}
+
+func TestToolProfile_ApplyNoopWithoutConfig(t *testing.T) {
+	profile := &toolProfile{
+		name:   "noop",
+		filter: func(tools []*genai.Tool) []*genai.Tool { return nil },
+	}
+	ctx := newMockCallbackContext("agent1")
+	req := &model.LLMRequest{}
+
+	profile.apply(ctx, req)
+
+	if req.Config != nil {
+		t.Error("req.Config should remain nil when there are no tools to filter")
+	}
+}
+
+func TestWithToolProfile_RegistersPerAgent(t *testing.T) {
+	registry := newMockRegistry()
+	g := New(registry)
+	llm := &mockLLM{name: "small-model", response: "summary"}
+
+	g.Add("agent1", llm, WithToolProfile("post-summary", func(tools []*genai.Tool) []*genai.Tool {
+		return tools[:0]
+	}))
+
+	profile, ok := g.toolProfiles["agent1"]
+	if !ok {
+		t.Fatal("expected a tool profile registered for agent1")
+	}
+	if profile.name != "post-summary" {
+		t.Errorf("profile.name = %q, want %q", profile.name, "post-summary")
+	}
+}
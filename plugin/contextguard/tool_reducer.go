@@ -0,0 +1,410 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// toolReducerSampleHead and toolReducerSampleTail bound how many
+	// elements of a reduced list/array payload (kubectl items, Prometheus
+	// series, SQL rows, ...) survive verbatim — the first few and the last
+	// few, with everything in between replaced by a count.
+	toolReducerSampleHead = 3
+	toolReducerSampleTail = 2
+
+	// toolReducerMarkerKey flags a FunctionResponse.Response map as already
+	// reduced, so re-running the reducer pass on a conversation that's
+	// already been reduced doesn't try to re-reduce (and shrink further)
+	// its own output. Mirrors patternClusterMarkerKey/chainStubMarkerKey.
+	toolReducerMarkerKey = "_contextguard_tool_reduced"
+
+	// defaultToolReducerRecentKeep is how many of the most recent Content
+	// entries the reducer pass leaves completely untouched, matching
+	// defaultPatternRecentKeep's rationale: the tail the model is actively
+	// reasoning from should never be rewritten out from under it.
+	defaultToolReducerRecentKeep = 4
+)
+
+// ToolReducer shrinks one FunctionResponse payload down to a small
+// representative sample, for tool responses whose bulk is repetition
+// (near-identical list items, timeseries samples, row dumps) rather than
+// information density. Reduce returns the reduced response and true if it
+// recognized the payload's shape, or (nil, false) if it doesn't apply —
+// the caller tries the next reducer in that case, so a reducer never needs
+// to know whether it's the only one that might match.
+type ToolReducer interface {
+	Reduce(response map[string]any) (map[string]any, bool)
+}
+
+var (
+	toolReducersMu sync.RWMutex
+	toolReducers   = map[string]ToolReducer{}
+)
+
+// RegisterToolReducer associates a ToolReducer with a specific tool name
+// (matched against FunctionResponse.Name), taking priority over the
+// built-in shape-sniffing reducers for that name. Safe for concurrent use;
+// typically called from an init function or before any agent starts
+// handling traffic.
+func RegisterToolReducer(name string, r ToolReducer) {
+	toolReducersMu.Lock()
+	defer toolReducersMu.Unlock()
+	toolReducers[name] = r
+}
+
+// lookupToolReducer returns the reducer registered for name, if any.
+func lookupToolReducer(name string) (ToolReducer, bool) {
+	toolReducersMu.RLock()
+	defer toolReducersMu.RUnlock()
+	r, ok := toolReducers[name]
+	return r, ok
+}
+
+// builtinToolReducers are tried in order, by payload shape, whenever no
+// reducer was registered by name for a given tool — most real deployments
+// call these tools under many different names (kubectl_get, k8s_list_pods,
+// run_sql, query_db, ...), so shape-sniffing is what actually makes the
+// built-ins useful out of the box.
+var builtinToolReducers = []ToolReducer{
+	kubectlItemsReducer{},
+	kubectlDescribeReducer{},
+	prometheusRangeReducer{},
+	sqlRowsReducer{},
+}
+
+// reduceToolResponse reduces a single FunctionResponse payload: a reducer
+// registered for name is tried first, then each built-in in order. Returns
+// (nil, false) if response is nil, already reduced, or no reducer
+// recognizes its shape.
+func reduceToolResponse(name string, response map[string]any) (map[string]any, bool) {
+	if response == nil {
+		return nil, false
+	}
+	if already, _ := response[toolReducerMarkerKey].(bool); already {
+		return nil, false
+	}
+	if r, ok := lookupToolReducer(name); ok {
+		return r.Reduce(response)
+	}
+	for _, r := range builtinToolReducers {
+		if out, ok := r.Reduce(response); ok {
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+// reduceToolResponses runs reduceToolResponse over every user-role
+// FunctionResponse part in contents older than the most recent recentKeep
+// entries, replacing the payload in place where a reducer recognized it.
+// Returns how many responses were reduced.
+func reduceToolResponses(contents []*genai.Content, recentKeep int) int {
+	boundary := len(contents) - recentKeep
+	if boundary <= 0 {
+		return 0
+	}
+	boundary = safeSplitIndex(contents, boundary)
+
+	reduced := 0
+	for i := 0; i < boundary; i++ {
+		c := contents[i]
+		if c == nil || c.Role != "user" {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			out, ok := reduceToolResponse(part.FunctionResponse.Name, part.FunctionResponse.Response)
+			if !ok {
+				continue
+			}
+			part.FunctionResponse.Response = out
+			reduced++
+		}
+	}
+	return reduced
+}
+
+// sampleIndices returns the indices of n that should survive in a
+// head/tail sample: the first toolReducerSampleHead and the last
+// toolReducerSampleTail, without overlap.
+func sampleIndices(n int) []int {
+	head := min(toolReducerSampleHead, n)
+	var idx []int
+	for i := 0; i < head; i++ {
+		idx = append(idx, i)
+	}
+	tailStart := n - toolReducerSampleTail
+	if tailStart < head {
+		tailStart = head
+	}
+	for i := tailStart; i < n; i++ {
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// kubectlItemsReducer recognizes the shape kubectl produces for `get -o
+// json` on a list resource: a top-level "items" array of objects each
+// carrying "metadata"/"status". It keeps a head/tail sample of
+// {name, namespace, phase} plus the full set of keys observed across all
+// items (the "schema"), dropping the repeated boilerplate (labels,
+// annotations, managedFields, ...) that dominates the response's bytes.
+type kubectlItemsReducer struct{}
+
+func (kubectlItemsReducer) Reduce(response map[string]any) (map[string]any, bool) {
+	items, ok := response["items"].([]any)
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+
+	keySet := map[string]bool{}
+	summarizeItem := func(item any) map[string]any {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return map[string]any{"raw": item}
+		}
+		for k := range m {
+			keySet[k] = true
+		}
+		out := map[string]any{}
+		if meta, ok := m["metadata"].(map[string]any); ok {
+			out["name"] = meta["name"]
+			if ns, ok := meta["namespace"]; ok {
+				out["namespace"] = ns
+			}
+		}
+		if status, ok := m["status"].(map[string]any); ok {
+			if phase, ok := status["phase"]; ok {
+				out["phase"] = phase
+			}
+		}
+		return out
+	}
+
+	sample := make([]any, 0, toolReducerSampleHead+toolReducerSampleTail)
+	for _, i := range sampleIndices(len(items)) {
+		sample = append(sample, summarizeItem(items[i]))
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return map[string]any{
+		"kind":               response["kind"],
+		"itemCount":          len(items),
+		"schema":             keys,
+		"sample":             sample,
+		toolReducerMarkerKey: true,
+	}, true
+}
+
+// describeEventLineRE matches one line of a `kubectl describe`'s "Events:"
+// table: Type, Reason, Age, From, and a free-text Message.
+var describeEventLineRE = regexp.MustCompile(`^\s*(\w+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(.*)$`)
+
+// kubectlDescribeReducer recognizes kubectl-describe's free-text output by
+// the presence of an "Events:" section, and collapses repeated event lines
+// (e.g. dozens of "Pulling image" entries during a crash loop) into one
+// record per distinct Reason with an occurrence count and the most recent
+// message, leaving the header (everything before "Events:") untouched since
+// that's usually the dense, non-repetitive part a triage step needs.
+type kubectlDescribeReducer struct{}
+
+func (kubectlDescribeReducer) Reduce(response map[string]any) (map[string]any, bool) {
+	key, text := findDescribeText(response)
+	if key == "" {
+		return nil, false
+	}
+
+	header, eventLines := splitDescribeEvents(text)
+	if len(eventLines) == 0 {
+		return nil, false
+	}
+
+	reducedEvents := summarizeDescribeEvents(eventLines)
+
+	out := make(map[string]any, len(response)+1)
+	for k, v := range response {
+		out[k] = v
+	}
+	out[key] = header + "\nEvents:\n" + strings.Join(reducedEvents, "\n")
+	out[toolReducerMarkerKey] = true
+	return out, true
+}
+
+// findDescribeText looks for a string-valued field that contains a
+// kubectl-describe "Events:" section, returning its key and content, or
+// ("", "") if none is found.
+func findDescribeText(response map[string]any) (key string, text string) {
+	for _, k := range []string{"output", "stdout", "text", "result"} {
+		if s, ok := response[k].(string); ok && strings.Contains(s, "\nEvents:") {
+			return k, s
+		}
+	}
+	return "", ""
+}
+
+// splitDescribeEvents splits text at its "Events:" section, returning
+// everything before it (the header, kept verbatim) and the individual
+// event table rows after the "Type Reason Age From Message" header/divider
+// lines.
+func splitDescribeEvents(text string) (header string, eventLines []string) {
+	idx := strings.Index(text, "\nEvents:")
+	if idx < 0 {
+		return text, nil
+	}
+	header = text[:idx]
+
+	for _, line := range strings.Split(text[idx+len("\nEvents:"):], "\n") {
+		if describeEventLineRE.MatchString(line) {
+			eventLines = append(eventLines, line)
+		}
+	}
+	return header, eventLines
+}
+
+// summarizeDescribeEvents groups event lines by Reason and renders one
+// record per group: the reason, how many times it occurred, and the most
+// recent line as a sample.
+func summarizeDescribeEvents(lines []string) []string {
+	type reasonGroup struct {
+		count  int
+		sample string
+	}
+	order := make([]string, 0)
+	groups := make(map[string]*reasonGroup)
+
+	for _, line := range lines {
+		m := describeEventLineRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		reason := m[2]
+		g, ok := groups[reason]
+		if !ok {
+			g = &reasonGroup{}
+			groups[reason] = g
+			order = append(order, reason)
+		}
+		g.count++
+		g.sample = line
+	}
+
+	rendered := make([]string, 0, len(order))
+	for _, reason := range order {
+		g := groups[reason]
+		rendered = append(rendered, fmt.Sprintf("%s  (occurrences=%d)", strings.TrimSpace(g.sample), g.count))
+	}
+	return rendered
+}
+
+// prometheusRangeReducer recognizes a Prometheus query API response by its
+// "data.result" array of timeseries, each carrying "metric" labels and
+// either a single "value" (instant query) or a "values" array (range
+// query). It keeps a head/tail sample of series with just their labels and
+// first/last sample, plus the total series count — the bulk of a range
+// query's bytes is usually the middle of long "values" arrays that a triage
+// step rarely needs point-by-point.
+type prometheusRangeReducer struct{}
+
+func (prometheusRangeReducer) Reduce(response map[string]any) (map[string]any, bool) {
+	data, ok := response["data"].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	result, ok := data["result"].([]any)
+	if !ok || len(result) == 0 {
+		return nil, false
+	}
+
+	sample := make([]any, 0, toolReducerSampleHead+toolReducerSampleTail)
+	for _, i := range sampleIndices(len(result)) {
+		series, ok := result[i].(map[string]any)
+		if !ok {
+			continue
+		}
+		entry := map[string]any{"metric": series["metric"]}
+		switch {
+		case series["values"] != nil:
+			values, _ := series["values"].([]any)
+			entry["sampleCount"] = len(values)
+			if len(values) > 0 {
+				entry["firstSample"] = values[0]
+				entry["lastSample"] = values[len(values)-1]
+			}
+		case series["value"] != nil:
+			entry["value"] = series["value"]
+		}
+		sample = append(sample, entry)
+	}
+
+	return map[string]any{
+		"resultType":         data["resultType"],
+		"seriesCount":        len(result),
+		"sample":             sample,
+		toolReducerMarkerKey: true,
+	}, true
+}
+
+// sqlRowsReducer recognizes a SQL tool response shaped as a "rows" array of
+// column->value objects. It keeps the column set (from the first row) and
+// a head/tail sample of rows plus the total row count, dropping the bulk of
+// a large result set while keeping enough to show the data's shape.
+type sqlRowsReducer struct{}
+
+func (sqlRowsReducer) Reduce(response map[string]any) (map[string]any, bool) {
+	rows, ok := response["rows"].([]any)
+	if !ok || len(rows) == 0 {
+		return nil, false
+	}
+
+	var columns []string
+	if first, ok := rows[0].(map[string]any); ok {
+		columns = make([]string, 0, len(first))
+		for k := range first {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+
+	sample := make([]any, 0, toolReducerSampleHead+toolReducerSampleTail)
+	for _, i := range sampleIndices(len(rows)) {
+		sample = append(sample, rows[i])
+	}
+
+	out := map[string]any{
+		"columns":            columns,
+		"rowCount":           len(rows),
+		"sample":             sample,
+		toolReducerMarkerKey: true,
+	}
+	if cols, ok := response["columns"]; ok {
+		out["columns"] = cols
+	}
+	return out, true
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func kubectlItemsPayload(n int) map[string]any {
+	items := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, map[string]any{
+			"metadata": map[string]any{"name": "pod-x", "namespace": "default"},
+			"status":   map[string]any{"phase": "Running"},
+		})
+	}
+	return map[string]any{"kind": "PodList", "items": items}
+}
+
+func TestKubectlItemsReducer_ReducesLargeList(t *testing.T) {
+	out, ok := kubectlItemsReducer{}.Reduce(kubectlItemsPayload(50))
+	if !ok {
+		t.Fatal("Reduce = false, want true for a well-shaped items list")
+	}
+	if out["itemCount"] != 50 {
+		t.Errorf("itemCount = %v, want 50", out["itemCount"])
+	}
+	sample, _ := out["sample"].([]any)
+	if len(sample) != toolReducerSampleHead+toolReducerSampleTail {
+		t.Errorf("sample len = %d, want %d", len(sample), toolReducerSampleHead+toolReducerSampleTail)
+	}
+	if out[toolReducerMarkerKey] != true {
+		t.Error("marker key not set on reduced output")
+	}
+}
+
+func TestKubectlItemsReducer_IgnoresNonMatchingShape(t *testing.T) {
+	_, ok := kubectlItemsReducer{}.Reduce(map[string]any{"foo": "bar"})
+	if ok {
+		t.Error("Reduce = true for a response with no items array, want false")
+	}
+}
+
+func TestKubectlDescribeReducer_CollapsesRepeatedEvents(t *testing.T) {
+	text := "Name: my-pod\nNamespace: default\n" +
+		"Events:\n" +
+		"  Type    Reason   Age   From      Message\n" +
+		"  ----    ------   ----  ----      -------\n" +
+		"  Normal  Pulled   5m    kubelet   Container image already present\n" +
+		"  Normal  Pulled   4m    kubelet   Container image already present\n" +
+		"  Normal  Pulled   3m    kubelet   Container image already present\n" +
+		"  Warning BackOff  1m    kubelet   Back-off restarting failed container\n"
+
+	out, ok := kubectlDescribeReducer{}.Reduce(map[string]any{"output": text})
+	if !ok {
+		t.Fatal("Reduce = false, want true for describe output with an Events section")
+	}
+	reduced, _ := out["output"].(string)
+	if !strings.Contains(reduced, "occurrences=3") {
+		t.Errorf("reduced output = %q, want it to report 3 occurrences of Pulled", reduced)
+	}
+	if !strings.Contains(reduced, "Name: my-pod") {
+		t.Error("reduced output dropped the header section")
+	}
+}
+
+func TestPrometheusRangeReducer_SamplesSeries(t *testing.T) {
+	result := make([]any, 0, 20)
+	for i := 0; i < 20; i++ {
+		result = append(result, map[string]any{
+			"metric": map[string]any{"instance": "host-1"},
+			"values": []any{[]any{1000, "1"}, []any{1010, "2"}, []any{1020, "3"}},
+		})
+	}
+	response := map[string]any{
+		"data": map[string]any{"resultType": "matrix", "result": result},
+	}
+
+	out, ok := prometheusRangeReducer{}.Reduce(response)
+	if !ok {
+		t.Fatal("Reduce = false, want true for a matrix response")
+	}
+	if out["seriesCount"] != 20 {
+		t.Errorf("seriesCount = %v, want 20", out["seriesCount"])
+	}
+}
+
+func TestSQLRowsReducer_SamplesRows(t *testing.T) {
+	rows := make([]any, 0, 100)
+	for i := 0; i < 100; i++ {
+		rows = append(rows, map[string]any{"id": i, "name": "row"})
+	}
+	out, ok := sqlRowsReducer{}.Reduce(map[string]any{"rows": rows})
+	if !ok {
+		t.Fatal("Reduce = false, want true for a rows array")
+	}
+	if out["rowCount"] != 100 {
+		t.Errorf("rowCount = %v, want 100", out["rowCount"])
+	}
+	sample, _ := out["sample"].([]any)
+	if len(sample) != toolReducerSampleHead+toolReducerSampleTail {
+		t.Errorf("sample len = %d, want %d", len(sample), toolReducerSampleHead+toolReducerSampleTail)
+	}
+}
+
+func TestRegisterToolReducer_TakesPriorityOverBuiltins(t *testing.T) {
+	RegisterToolReducer("custom_tool_9_1", customStubReducer{})
+	defer func() {
+		toolReducersMu.Lock()
+		delete(toolReducers, "custom_tool_9_1")
+		toolReducersMu.Unlock()
+	}()
+
+	out, ok := reduceToolResponse("custom_tool_9_1", map[string]any{"items": []any{1, 2, 3}})
+	if !ok {
+		t.Fatal("reduceToolResponse = false, want true")
+	}
+	if out["stub"] != true {
+		t.Errorf("expected the registered reducer to run instead of the kubectl built-in, got %+v", out)
+	}
+}
+
+type customStubReducer struct{}
+
+func (customStubReducer) Reduce(map[string]any) (map[string]any, bool) {
+	return map[string]any{"stub": true, toolReducerMarkerKey: true}, true
+}
+
+func TestReduceToolResponses_SkipsRecentTail(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name: "kubectl_get", Response: kubectlItemsPayload(50),
+		}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name: "kubectl_get", Response: kubectlItemsPayload(50),
+		}}}},
+	}
+
+	reduced := reduceToolResponses(contents, 2)
+
+	if reduced != 1 {
+		t.Fatalf("reduced = %d, want 1 (only the entry before the recent-keep window)", reduced)
+	}
+	if contents[0].Parts[0].FunctionResponse.Response[toolReducerMarkerKey] != true {
+		t.Error("the old response should have been reduced")
+	}
+	if _, marked := contents[2].Parts[0].FunctionResponse.Response[toolReducerMarkerKey]; marked {
+		t.Error("the recent response should have been left untouched")
+	}
+}
+
+func TestReduceToolResponses_SkipsAlreadyReduced(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name:     "kubectl_get",
+			Response: map[string]any{"sample": []any{}, toolReducerMarkerKey: true},
+		}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+	}
+
+	if reduced := reduceToolResponses(contents, 1); reduced != 0 {
+		t.Errorf("reduced = %d, want 0 for an already-reduced response", reduced)
+	}
+}
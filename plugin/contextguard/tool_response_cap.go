@@ -0,0 +1,140 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"google.golang.org/genai"
+)
+
+// capCharsPerToken converts a ResponseCapPolicy token limit into a byte
+// budget, matching the len/4 heuristic estimateContentTokens uses
+// elsewhere in the package.
+const capCharsPerToken = 4
+
+// toolResponseCapMarkerKey flags a FunctionResponse.Response map as already
+// capped, so a response that's still over its cap after a previous
+// BeforeModelCallback invocation (e.g. the policy was tightened) doesn't
+// get capped a second time against its own already-truncated text.
+const toolResponseCapMarkerKey = "_contextguard_response_capped"
+
+// toolResponseCapShaChars is how many hex characters of the rendered
+// response's sha256 survive into the truncation marker — enough to let a
+// human or a log correlate two truncations of the same underlying payload
+// without printing a full 64-character digest.
+const toolResponseCapShaChars = 8
+
+// ResponseCapPolicy maps a tool name (as it appears in
+// FunctionResponse.Name) to the maximum number of tokens its response may
+// occupy. The key "*" sets the default cap for any tool with no specific
+// entry. A tool with no matching key (and no "*" entry) is left uncapped.
+type ResponseCapPolicy map[string]int
+
+// capFor returns the token cap that applies to name, and whether one was
+// found (an exact match on name, falling back to the "*" wildcard).
+func (p ResponseCapPolicy) capFor(name string) (int, bool) {
+	if p == nil {
+		return 0, false
+	}
+	if n, ok := p[name]; ok {
+		return n, true
+	}
+	if n, ok := p["*"]; ok {
+		return n, true
+	}
+	return 0, false
+}
+
+// capToolResponse enforces policy's token cap for name against response,
+// replacing the middle of its rendered form with a stable marker
+// (`…[truncated N tokens; sha=xxxxxxxx]…`) while preserving a head and tail
+// slice, so the model still sees the payload's schema and its terminal
+// output. Returns (nil, false) if response is nil, already capped, has no
+// applicable cap, or is already within it.
+func capToolResponse(name string, response map[string]any, policy ResponseCapPolicy) (map[string]any, bool) {
+	if response == nil {
+		return nil, false
+	}
+	if already, _ := response[toolResponseCapMarkerKey].(bool); already {
+		return nil, false
+	}
+	capTokens, ok := policy.capFor(name)
+	if !ok || capTokens <= 0 {
+		return nil, false
+	}
+
+	rendered := fmt.Sprintf("%v", response)
+	capChars := capTokens * capCharsPerToken
+	if len(rendered) <= capChars {
+		return nil, false
+	}
+
+	// Keep more of the head than the tail: the head carries the payload's
+	// schema/structure, which matters more for a model re-deriving what the
+	// tool returned than an equal split would preserve.
+	headChars := capChars * 6 / 10
+	tailChars := capChars - headChars
+	head := rendered[:headChars]
+	tail := rendered[len(rendered)-tailChars:]
+	droppedTokens := (len(rendered) - headChars - tailChars) / capCharsPerToken
+
+	sum := sha256.Sum256([]byte(rendered))
+	marker := fmt.Sprintf("…[truncated %d tokens; sha=%s]…",
+		droppedTokens, hex.EncodeToString(sum[:])[:toolResponseCapShaChars])
+
+	return map[string]any{
+		"result":                 head + marker + tail,
+		toolResponseCapMarkerKey: true,
+	}, true
+}
+
+// capToolResponses applies capToolResponse to every FunctionResponse part
+// in contents, replacing any payload over policy's cap in place. Unlike
+// reduceToolResponses and the other compaction passes, this runs over the
+// entire conversation including the most recent turn — a single
+// over-sized tool response should never be allowed to reach the
+// summarizer or the model regardless of how recently it arrived. Because
+// it only ever rewrites a Part's FunctionResponse.Response in place, it
+// can never move content across a Content boundary, so it can't interact
+// badly with safeSplitIndex/findSplitIndex: those only ever split the
+// Contents slice between whole entries, never inside one. Returns how many
+// responses were capped.
+func capToolResponses(contents []*genai.Content, policy ResponseCapPolicy) int {
+	if len(policy) == 0 {
+		return 0
+	}
+
+	capped := 0
+	for _, c := range contents {
+		if c == nil || c.Role != "user" {
+			continue
+		}
+		for _, part := range c.Parts {
+			if part == nil || part.FunctionResponse == nil {
+				continue
+			}
+			out, ok := capToolResponse(part.FunctionResponse.Name, part.FunctionResponse.Response, policy)
+			if !ok {
+				continue
+			}
+			part.FunctionResponse.Response = out
+			capped++
+		}
+	}
+	return capped
+}
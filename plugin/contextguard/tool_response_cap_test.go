@@ -0,0 +1,118 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contextguard
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestCapToolResponse_TruncatesOversizedPayload(t *testing.T) {
+	policy := ResponseCapPolicy{"kubectl_get_logs": 10}
+	response := map[string]any{"result": strings.Repeat("x", 1000)}
+
+	out, ok := capToolResponse("kubectl_get_logs", response, policy)
+	if !ok {
+		t.Fatal("capToolResponse = false, want true for a response over its cap")
+	}
+	result, _ := out["result"].(string)
+	if !strings.Contains(result, "truncated") || !strings.Contains(result, "sha=") {
+		t.Errorf("result = %q, want a truncation marker with a sha", result)
+	}
+	if out[toolResponseCapMarkerKey] != true {
+		t.Error("marker key not set on capped output")
+	}
+}
+
+func TestCapToolResponse_UsesWildcardDefault(t *testing.T) {
+	policy := ResponseCapPolicy{"*": 10}
+	response := map[string]any{"result": strings.Repeat("y", 1000)}
+
+	_, ok := capToolResponse("unregistered_tool", response, policy)
+	if !ok {
+		t.Fatal("capToolResponse = false, want true when falling back to the \"*\" wildcard")
+	}
+}
+
+func TestCapToolResponse_LeavesSmallResponsesUntouched(t *testing.T) {
+	policy := ResponseCapPolicy{"kubectl_get_logs": 10_000}
+	response := map[string]any{"result": "short"}
+
+	_, ok := capToolResponse("kubectl_get_logs", response, policy)
+	if ok {
+		t.Error("capToolResponse = true for a response already within its cap, want false")
+	}
+}
+
+func TestCapToolResponse_NoApplicableCapIsNoop(t *testing.T) {
+	policy := ResponseCapPolicy{"other_tool": 10}
+	response := map[string]any{"result": strings.Repeat("z", 1000)}
+
+	_, ok := capToolResponse("kubectl_get_logs", response, policy)
+	if ok {
+		t.Error("capToolResponse = true with no matching cap or wildcard, want false")
+	}
+}
+
+func TestCapToolResponse_SkipsAlreadyCapped(t *testing.T) {
+	policy := ResponseCapPolicy{"kubectl_get_logs": 10}
+	response := map[string]any{"result": strings.Repeat("x", 1000), toolResponseCapMarkerKey: true}
+
+	_, ok := capToolResponse("kubectl_get_logs", response, policy)
+	if ok {
+		t.Error("capToolResponse = true for an already-capped response, want false")
+	}
+}
+
+func TestCapToolResponses_AppliesToEntireConversationIncludingRecent(t *testing.T) {
+	policy := ResponseCapPolicy{"*": 10}
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name: "tool_a", Response: map[string]any{"result": strings.Repeat("a", 1000)},
+		}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "ok"}}},
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name: "tool_b", Response: map[string]any{"result": strings.Repeat("b", 1000)},
+		}}}},
+	}
+
+	capped := capToolResponses(contents, policy)
+
+	if capped != 2 {
+		t.Fatalf("capped = %d, want 2 (the cap applies even to the most recent turn)", capped)
+	}
+	for i, c := range contents {
+		if c.Role != "user" {
+			continue
+		}
+		if c.Parts[0].FunctionResponse.Response[toolResponseCapMarkerKey] != true {
+			t.Errorf("contents[%d] was not capped", i)
+		}
+	}
+}
+
+func TestCapToolResponses_EmptyPolicyIsNoop(t *testing.T) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+			Name: "tool_a", Response: map[string]any{"result": strings.Repeat("a", 1000)},
+		}}}},
+	}
+
+	if capped := capToolResponses(contents, nil); capped != 0 {
+		t.Errorf("capped = %d, want 0 with an empty policy", capped)
+	}
+}
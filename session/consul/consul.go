@@ -0,0 +1,223 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consul implements store.Backend on top of Consul's KV HTTP API
+// (https://developer.hashicorp.com/consul/api-docs/kv), using only
+// net/http and encoding/json. Consul's KV store is a plain HTTP/JSON API
+// with a built-in check-and-set parameter (?cas=<ModifyIndex>), so a
+// dedicated client library isn't required to implement Backend against it.
+package consul
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/achetronic/adk-utils-go/session/store"
+)
+
+// Config configures a Backend.
+type Config struct {
+	// Addr is the Consul HTTP API address, e.g. "http://localhost:8500".
+	Addr string
+	// Token is the Consul ACL token sent as the X-Consul-Token header, if set.
+	Token string
+	// HTTPClient, if set, replaces the default http.Client used for every
+	// request. Useful for custom timeouts or TLS configuration.
+	HTTPClient *http.Client
+}
+
+// Backend implements store.Backend against a Consul agent's KV HTTP API.
+type Backend struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// New creates a Backend talking to the Consul agent at cfg.Addr.
+func New(cfg Config) (*Backend, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("consul: Addr is required")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Backend{
+		addr:   strings.TrimRight(cfg.Addr, "/"),
+		token:  cfg.Token,
+		client: client,
+	}, nil
+}
+
+// kvEntry is a single element of the JSON array Consul's GET /v1/kv/<key>
+// returns.
+type kvEntry struct {
+	Value       string `json:"Value"`
+	ModifyIndex int64  `json:"ModifyIndex"`
+}
+
+func (b *Backend) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := b.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if b.token != "" {
+		req.Header.Set("X-Consul-Token", b.token)
+	}
+	return req, nil
+}
+
+// Get returns the raw value stored at key and its ModifyIndex as version, or
+// store.ErrNotFound if Consul reports no entry for it (a 404 response).
+func (b *Backend) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, "/v1/kv/"+key, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: GET %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, store.ErrNotFound
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: reading GET %s response: %w", key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul: GET %s: unexpected status %d: %s", key, resp.StatusCode, body)
+	}
+
+	var entries []kvEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, 0, fmt.Errorf("consul: decoding GET %s response: %w", key, err)
+	}
+	if len(entries) == 0 {
+		return nil, 0, store.ErrNotFound
+	}
+
+	value, err := base64.StdEncoding.DecodeString(entries[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: decoding value of %s: %w", key, err)
+	}
+	return value, entries[0].ModifyIndex, nil
+}
+
+// CompareAndSwap writes value to key via Consul's ?cas=<ModifyIndex>
+// parameter, which only succeeds if key's current ModifyIndex still matches.
+// expectedVersion of 0 means "key must not exist yet", matching Consul's own
+// convention for cas=0.
+func (b *Backend) CompareAndSwap(ctx context.Context, key string, expectedVersion int64, value []byte) error {
+	query := url.Values{"cas": []string{fmt.Sprintf("%d", expectedVersion)}}
+	req, err := b.newRequest(ctx, http.MethodPut, "/v1/kv/"+key, query, strings.NewReader(string(value)))
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul: PUT %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("consul: reading PUT %s response: %w", key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul: PUT %s: unexpected status %d: %s", key, resp.StatusCode, body)
+	}
+
+	// A CAS failure is reported as a 200 response with body "false", not an
+	// HTTP error status.
+	if strings.TrimSpace(string(body)) != "true" {
+		return store.ErrVersionMismatch
+	}
+	return nil
+}
+
+// Delete removes key. Deleting an absent key is not an error, matching
+// Consul's own DELETE semantics.
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	req, err := b.newRequest(ctx, http.MethodDelete, "/v1/kv/"+key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul: DELETE %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul: DELETE %s: unexpected status %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// List returns every key stored under prefix via Consul's ?keys parameter.
+func (b *Backend) List(ctx context.Context, prefix string) ([]string, error) {
+	query := url.Values{"keys": []string{""}}
+	req, err := b.newRequest(ctx, http.MethodGet, "/v1/kv/"+prefix, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul: LIST %s: %w", prefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("consul: reading LIST %s response: %w", prefix, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul: LIST %s: unexpected status %d: %s", prefix, resp.StatusCode, body)
+	}
+
+	var keys []string
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("consul: decoding LIST %s response: %w", prefix, err)
+	}
+	return keys, nil
+}
+
+// Close is a no-op: Backend holds no connections beyond a plain
+// *http.Client, which needs no explicit shutdown.
+func (b *Backend) Close() error {
+	return nil
+}
+
+var _ store.Backend = (*Backend)(nil)
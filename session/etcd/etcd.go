@@ -0,0 +1,234 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etcd implements store.Backend on top of etcd v3's JSON
+// grpc-gateway HTTP API (/v3/kv/...), using only net/http, encoding/json,
+// and encoding/base64. etcd's gateway mirrors the gRPC KV service as plain
+// JSON-over-HTTP with base64-encoded keys/values, so a dedicated etcd
+// client library isn't required to implement Backend against it.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/achetronic/adk-utils-go/session/store"
+)
+
+// Config configures a Backend.
+type Config struct {
+	// Addr is the etcd grpc-gateway HTTP address, e.g. "http://localhost:2379".
+	Addr string
+	// Username and Password authenticate against etcd's auth API, if set.
+	Username string
+	Password string
+	// HTTPClient, if set, replaces the default http.Client used for every
+	// request. Useful for custom timeouts or TLS configuration.
+	HTTPClient *http.Client
+}
+
+// Backend implements store.Backend against etcd v3's grpc-gateway JSON API.
+type Backend struct {
+	addr     string
+	username string
+	password string
+	client   *http.Client
+}
+
+// New creates a Backend talking to the etcd gateway at cfg.Addr.
+func New(cfg Config) (*Backend, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("etcd: Addr is required")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Backend{
+		addr:     strings.TrimRight(cfg.Addr, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   client,
+	}, nil
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// postJSON POSTs body (already JSON-marshaled) to path and decodes the JSON
+// response into out.
+func (b *Backend) postJSON(ctx context.Context, path string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("etcd: marshaling request for %s: %w", path, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("etcd: POST %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("etcd: reading %s response: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd: %s: unexpected status %d: %s", path, resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("etcd: decoding %s response: %w", path, err)
+	}
+	return nil
+}
+
+// kvPair mirrors the "kvs" entries of an etcd gateway /v3/kv/range response.
+type kvPair struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+type rangeResponse struct {
+	Kvs []kvPair `json:"kvs"`
+}
+
+// Get returns the raw value stored at key and its mod_revision as version,
+// or store.ErrNotFound if etcd's range response has no matching entry.
+func (b *Backend) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	var resp rangeResponse
+	if err := b.postJSON(ctx, "/v3/kv/range", map[string]string{"key": b64(key)}, &resp); err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, store.ErrNotFound
+	}
+
+	value, err := base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("etcd: decoding value of %s: %w", key, err)
+	}
+
+	var version int64
+	if _, err := fmt.Sscanf(resp.Kvs[0].ModRevision, "%d", &version); err != nil {
+		return nil, 0, fmt.Errorf("etcd: parsing mod_revision of %s: %w", key, err)
+	}
+	return value, version, nil
+}
+
+// txnResponse is the JSON shape of an etcd gateway /v3/kv/txn response.
+type txnResponse struct {
+	Succeeded bool `json:"succeeded"`
+}
+
+// CompareAndSwap writes value to key inside a transaction that compares
+// key's mod_revision against expectedVersion, matching RedisSessionService's
+// version-gated write via a different primitive (etcd's native MVCC
+// revision instead of a Lua script). expectedVersion of 0 compares
+// mod_revision = 0, which is etcd's own convention for "key does not exist".
+func (b *Backend) CompareAndSwap(ctx context.Context, key string, expectedVersion int64, value []byte) error {
+	txn := map[string]any{
+		"compare": []map[string]any{{
+			"target":       "MOD",
+			"key":          b64(key),
+			"mod_revision": fmt.Sprintf("%d", expectedVersion),
+		}},
+		"success": []map[string]any{{
+			"request_put": map[string]string{
+				"key":   b64(key),
+				"value": base64.StdEncoding.EncodeToString(value),
+			},
+		}},
+	}
+
+	var resp txnResponse
+	if err := b.postJSON(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return store.ErrVersionMismatch
+	}
+	return nil
+}
+
+// Delete removes key. Deleting an absent key is not an error, matching
+// etcd's own deleterange semantics.
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	return b.postJSON(ctx, "/v3/kv/deleterange", map[string]string{"key": b64(key)}, nil)
+}
+
+// List returns every key stored under prefix, using etcd's range-end-based
+// prefix scan (range_end = prefix with its last byte incremented).
+func (b *Backend) List(ctx context.Context, prefix string) ([]string, error) {
+	var resp rangeResponse
+	body := map[string]any{
+		"key":       b64(prefix),
+		"range_end": b64(prefixRangeEnd(prefix)),
+		"keys_only": true,
+	}
+	if err := b.postJSON(ctx, "/v3/kv/range", body, &resp); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("etcd: decoding key in LIST %s: %w", prefix, err)
+		}
+		keys = append(keys, string(key))
+	}
+	return keys, nil
+}
+
+// prefixRangeEnd computes etcd's conventional range_end for a prefix scan:
+// prefix with its last byte incremented, so [prefix, rangeEnd) covers every
+// key starting with prefix.
+func prefixRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "" // all 0xff bytes: no upper bound
+}
+
+// Close is a no-op: Backend holds no connections beyond a plain
+// *http.Client, which needs no explicit shutdown.
+func (b *Backend) Close() error {
+	return nil
+}
+
+var _ store.Backend = (*Backend)(nil)
@@ -0,0 +1,127 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/achetronic/adk-utils-go/session/store"
+	"github.com/achetronic/adk-utils-go/session/store/storetest"
+)
+
+const testEtcdAddr = "http://localhost:2379"
+
+func newTestBackend(t *testing.T) store.Backend {
+	t.Helper()
+	backend, err := New(Config{Addr: testEtcdAddr})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+func uniqueKey(t *testing.T) string {
+	t.Helper()
+	return fmt.Sprintf("adk-utils-go-test/%d", time.Now().UnixNano())
+}
+
+func TestGetMissingKeyReturnsErrNotFound(t *testing.T) {
+	backend := newTestBackend(t)
+	_, _, err := backend.Get(context.Background(), uniqueKey(t))
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCompareAndSwapCreatesAndUpdates(t *testing.T) {
+	backend := newTestBackend(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+
+	if err := backend.CompareAndSwap(ctx, key, 0, []byte("v1")); err != nil {
+		t.Fatalf("CompareAndSwap(create): %v", err)
+	}
+
+	value, version, err := backend.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value) != "v1" {
+		t.Errorf("value = %q, want v1", value)
+	}
+
+	if err := backend.CompareAndSwap(ctx, key, version, []byte("v2")); err != nil {
+		t.Fatalf("CompareAndSwap(update): %v", err)
+	}
+
+	value, _, err = backend.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get after update: %v", err)
+	}
+	if string(value) != "v2" {
+		t.Errorf("value after update = %q, want v2", value)
+	}
+}
+
+func TestCompareAndSwapDetectsVersionMismatch(t *testing.T) {
+	backend := newTestBackend(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+
+	if err := backend.CompareAndSwap(ctx, key, 0, []byte("v1")); err != nil {
+		t.Fatalf("CompareAndSwap(create): %v", err)
+	}
+
+	err := backend.CompareAndSwap(ctx, key, 0, []byte("v2"))
+	if !errors.Is(err, store.ErrVersionMismatch) {
+		t.Errorf("CompareAndSwap with stale expectedVersion = %v, want ErrVersionMismatch", err)
+	}
+}
+
+func TestDeleteAndList(t *testing.T) {
+	backend := newTestBackend(t)
+	ctx := context.Background()
+	prefix := uniqueKey(t) + "/"
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := backend.CompareAndSwap(ctx, prefix+id, 0, []byte(id)); err != nil {
+			t.Fatalf("CompareAndSwap(%s): %v", id, err)
+		}
+	}
+
+	keys, err := backend.List(ctx, prefix)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("List returned %d keys, want 3", len(keys))
+	}
+
+	if err := backend.Delete(ctx, prefix+"a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := backend.Get(ctx, prefix+"a"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreSessionServiceConformance(t *testing.T) {
+	storetest.Run(t, newTestBackend)
+}
@@ -0,0 +1,326 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+// Embedder produces a vector embedding for a piece of text. It's used to
+// populate the optional RediSearch VECTOR field so SearchEvents can perform
+// KNN semantic recall alongside keyword and time-range filtering.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+const (
+	searchIndexName    = "adk_events_idx"
+	searchKeyPrefix    = "event:"
+	defaultSearchLimit = 20
+	defaultSearchKNN   = 10
+)
+
+// SearchQuery filters RedisSessionService.SearchEvents.
+type SearchQuery struct {
+	AppName   string
+	UserID    string
+	SessionID string // optional: restrict the search to one session
+
+	// Text performs a RediSearch full-text match against the event's text.
+	Text string
+	// Author filters by the TAG author field (e.g. "user", "model").
+	Author string
+	// After and Before filter by event timestamp (inclusive). A zero value
+	// leaves that bound unrestricted.
+	After  time.Time
+	Before time.Time
+
+	// QueryVector, if set, switches the query to KNN semantic recall over
+	// the vector field (requires an Embedder to have been configured so the
+	// index has vectors to search).
+	QueryVector []float32
+	// K is the number of nearest neighbours to return for a vector query.
+	// Defaults to 10.
+	K int
+
+	// Limit caps the number of results. Defaults to 20.
+	Limit int
+}
+
+// eventDocKey returns the RediSearch HASH document key for a single event,
+// matching the index's "event:" key prefix.
+func eventDocKey(appName, userID, sessionID, eventID string) string {
+	return fmt.Sprintf("%s%s:%s:%s:%s", searchKeyPrefix, appName, userID, sessionID, eventID)
+}
+
+// ensureSearchIndex issues FT.CREATE for the event search index, tolerating
+// "Index already exists" so it's safe to call on every NewRedisSessionService
+// startup. vectorDim <= 0 omits the vector field (keyword/time-range search
+// only, no semantic recall).
+func (s *RedisSessionService) ensureSearchIndex(ctx context.Context, vectorDim int) error {
+	args := []any{
+		"FT.CREATE", searchIndexName,
+		"ON", "HASH",
+		"PREFIX", "1", searchKeyPrefix,
+		"SCHEMA",
+		"app_name", "TAG",
+		"user_id", "TAG",
+		"session_id", "TAG",
+		"timestamp", "NUMERIC", "SORTABLE",
+		"author", "TAG",
+		"text", "TEXT",
+		"event_json", "TEXT", "NOINDEX",
+	}
+	if vectorDim > 0 {
+		args = append(args,
+			"vector", "VECTOR", "HNSW", "6",
+			"TYPE", "FLOAT32",
+			"DIM", strconv.Itoa(vectorDim),
+			"DISTANCE_METRIC", "COSINE",
+		)
+	}
+
+	if err := s.client.Do(ctx, args...).Err(); err != nil {
+		if strings.Contains(err.Error(), "Index already exists") {
+			return nil
+		}
+		return fmt.Errorf("failed to create RediSearch index: %w", err)
+	}
+	return nil
+}
+
+// indexEvent mirrors evt into the RediSearch HASH document so SearchEvents
+// can find it by keyword, time range, or (with an Embedder configured) KNN
+// semantic similarity. Failures are logged and otherwise ignored: search is
+// a best-effort recall layer on top of the authoritative event list in
+// eventsKey, not a source of truth.
+func (s *RedisSessionService) indexEvent(ctx context.Context, appName, userID, sessionID string, evt *session.Event, eventJSON []byte) {
+	text := eventText(evt)
+
+	fields := map[string]any{
+		"app_name":   appName,
+		"user_id":    userID,
+		"session_id": sessionID,
+		"timestamp":  evt.Timestamp.Unix(),
+		"author":     evt.Author,
+		"text":       text,
+		"event_json": string(eventJSON),
+	}
+
+	if s.embedder != nil && text != "" {
+		vec, err := s.embedder.Embed(ctx, text)
+		if err != nil {
+			slog.Warn("RedisSessionService: failed to embed event for search index", "error", err)
+		} else {
+			fields["vector"] = encodeVector(vec)
+		}
+	}
+
+	key := eventDocKey(appName, userID, sessionID, evt.ID)
+	if err := s.client.HSet(ctx, key, fields).Err(); err != nil {
+		slog.Warn("RedisSessionService: failed to index event", "error", err)
+		return
+	}
+	s.client.Expire(ctx, key, s.ttl)
+}
+
+// eventText extracts a flat string to index from an event's content parts,
+// concatenating any text parts. Returns "" for events with no text (e.g.
+// pure function calls/responses), which also skips embedding.
+func eventText(evt *session.Event) string {
+	if evt.Content == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range evt.Content.Parts {
+		if part.Text != "" {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
+// encodeVector packs a []float32 into the little-endian byte blob RediSearch
+// expects for a VECTOR field value (or a KNN query parameter).
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, f := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+// tagEscaper escapes the RediSearch TAG special characters so arbitrary
+// app/user/session/author values can be embedded in a query safely.
+var tagEscaper = strings.NewReplacer(
+	",", "\\,", ".", "\\.", "<", "\\<", ">", "\\>", "{", "\\{", "}", "\\}",
+	"[", "\\[", "]", "\\]", "\"", "\\\"", "'", "\\'", ":", "\\:", ";", "\\;",
+	"!", "\\!", "@", "\\@", "#", "\\#", "$", "\\$", "%", "\\%", "^", "\\^",
+	"&", "\\&", "*", "\\*", "(", "\\(", ")", "\\)", "-", "\\-", "+", "\\+",
+	"=", "\\=", "~", "\\~", "|", "\\|", " ", "\\ ",
+)
+
+// textEscaper escapes RediSearch query-syntax metacharacters for an
+// unstructured TEXT field match, the same punctuation set tagEscaper
+// escapes but without touching whitespace, so a multi-word Text value
+// still does an AND-of-terms keyword match instead of becoming one
+// escaped phrase. Without this, a crafted Text value could close the
+// "@text:(...)" group and append a clause of its own (e.g.
+// ") | (@app_name:*") that defeats the app/user/session scoping clauses
+// built alongside it.
+var textEscaper = strings.NewReplacer(
+	",", "\\,", ".", "\\.", "<", "\\<", ">", "\\>", "{", "\\{", "}", "\\}",
+	"[", "\\[", "]", "\\]", "\"", "\\\"", "'", "\\'", ":", "\\:", ";", "\\;",
+	"!", "\\!", "@", "\\@", "#", "\\#", "$", "\\$", "%", "\\%", "^", "\\^",
+	"&", "\\&", "*", "\\*", "(", "\\(", ")", "\\)", "-", "\\-", "+", "\\+",
+	"=", "\\=", "~", "\\~", "|", "\\|",
+)
+
+// SearchEvents queries the RediSearch event index configured via
+// RedisSessionServiceConfig.EnableSearch, combining keyword/TAG/time-range
+// filters with optional KNN semantic recall when QueryVector is set.
+func (s *RedisSessionService) SearchEvents(ctx context.Context, q SearchQuery) ([]*session.Event, error) {
+	if !s.searchEnabled {
+		return nil, fmt.Errorf("search is not enabled on this RedisSessionService")
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	var clauses []string
+	if q.AppName != "" {
+		clauses = append(clauses, fmt.Sprintf("@app_name:{%s}", tagEscaper.Replace(q.AppName)))
+	}
+	if q.UserID != "" {
+		clauses = append(clauses, fmt.Sprintf("@user_id:{%s}", tagEscaper.Replace(q.UserID)))
+	}
+	if q.SessionID != "" {
+		clauses = append(clauses, fmt.Sprintf("@session_id:{%s}", tagEscaper.Replace(q.SessionID)))
+	}
+	if q.Author != "" {
+		clauses = append(clauses, fmt.Sprintf("@author:{%s}", tagEscaper.Replace(q.Author)))
+	}
+	if q.Text != "" {
+		clauses = append(clauses, fmt.Sprintf("@text:(%s)", textEscaper.Replace(q.Text)))
+	}
+	if !q.After.IsZero() || !q.Before.IsZero() {
+		from, to := "-inf", "+inf"
+		if !q.After.IsZero() {
+			from = strconv.FormatInt(q.After.Unix(), 10)
+		}
+		if !q.Before.IsZero() {
+			to = strconv.FormatInt(q.Before.Unix(), 10)
+		}
+		clauses = append(clauses, fmt.Sprintf("@timestamp:[%s %s]", from, to))
+	}
+
+	base := strings.Join(clauses, " ")
+	if base == "" {
+		base = "*"
+	}
+
+	var args []any
+	if len(q.QueryVector) > 0 {
+		k := q.K
+		if k <= 0 {
+			k = defaultSearchKNN
+		}
+		args = []any{
+			"FT.SEARCH", searchIndexName,
+			fmt.Sprintf("(%s)=>[KNN %d @vector $vec AS vector_score]", base, k),
+			"PARAMS", "2", "vec", encodeVector(q.QueryVector),
+			"SORTBY", "vector_score",
+			"DIALECT", "2",
+			"LIMIT", "0", strconv.Itoa(limit),
+		}
+	} else {
+		args = []any{
+			"FT.SEARCH", searchIndexName, base,
+			"SORTBY", "timestamp", "DESC",
+			"LIMIT", "0", strconv.Itoa(limit),
+		}
+	}
+
+	reply, err := s.client.Do(ctx, args...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("FT.SEARCH failed: %w", err)
+	}
+
+	return parseSearchReply(reply), nil
+}
+
+// parseSearchReply decodes a raw FT.SEARCH reply ([count, docKey, fields,
+// docKey, fields, ...]) back into events by reading each document's
+// event_json field.
+func parseSearchReply(reply any) []*session.Event {
+	arr, ok := reply.([]any)
+	if !ok || len(arr) < 2 {
+		return nil
+	}
+
+	var events []*session.Event
+	for i := 1; i+1 < len(arr); i += 2 {
+		fields, ok := arr[i+1].([]any)
+		if !ok {
+			continue
+		}
+		for j := 0; j+1 < len(fields); j += 2 {
+			name, _ := fields[j].(string)
+			if name != "event_json" {
+				continue
+			}
+			raw, _ := fields[j+1].(string)
+			var evt session.Event
+			if err := json.Unmarshal([]byte(raw), &evt); err == nil {
+				events = append(events, &evt)
+			}
+		}
+	}
+	return events
+}
+
+// collectSearchDocKeys reads a session's event list and returns the
+// RediSearch document key for each event, so Delete can clean them up
+// alongside the session and events keys.
+func (s *RedisSessionService) collectSearchDocKeys(ctx context.Context, appName, userID, sessionID, eventsKey string) []string {
+	eventData, err := s.client.LRange(ctx, eventsKey, 0, -1).Result()
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(eventData))
+	for _, ed := range eventData {
+		var evt session.Event
+		if err := json.Unmarshal([]byte(ed), &evt); err != nil {
+			continue
+		}
+		keys = append(keys, eventDocKey(appName, userID, sessionID, evt.ID))
+	}
+	return keys
+}
@@ -0,0 +1,197 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+func setupSearchTestService(t *testing.T) *RedisSessionService {
+	t.Helper()
+	svc, err := NewRedisSessionService(RedisSessionServiceConfig{
+		Addr:         testRedisAddr,
+		TTL:          5 * time.Minute,
+		EnableSearch: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Redis session service: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func textEvent(id, author, text string) *session.Event {
+	return &session.Event{
+		ID:      id,
+		Author:  author,
+		Content: &genai.Content{Role: author, Parts: []*genai.Part{{Text: text}}},
+	}
+}
+
+func TestSearchEventsKeywordMatchIsScopedToSession(t *testing.T) {
+	svc := setupSearchTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	other, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-2"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if err := svc.AppendEvent(ctx, resp.Session, textEvent("evt-1", "user", "the quick brown fox")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if err := svc.AppendEvent(ctx, other.Session, textEvent("evt-2", "user", "the quick brown fox")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	// RediSearch indexing is asynchronous relative to HSET.
+	time.Sleep(200 * time.Millisecond)
+
+	events, err := svc.SearchEvents(ctx, SearchQuery{
+		AppName: app, UserID: "user-1", SessionID: resp.Session.ID(),
+		Text: "quick fox",
+	})
+	if err != nil {
+		t.Fatalf("SearchEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != "evt-1" {
+		t.Fatalf("expected only evt-1, got %+v", events)
+	}
+}
+
+func TestSearchEventsTimeRangeFilter(t *testing.T) {
+	svc := setupSearchTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// AppendEvent stamps evt.Timestamp with time.Now() itself, and the
+	// indexed "timestamp" field has one-second (Unix) resolution, so the
+	// two events need over a second between them to land in distinguishable
+	// buckets for the After filter below to tell them apart.
+	if err := svc.AppendEvent(ctx, resp.Session, textEvent("evt-old", "user", "ancient history")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+	if err := svc.AppendEvent(ctx, resp.Session, textEvent("evt-new", "user", "recent news")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	events, err := svc.SearchEvents(ctx, SearchQuery{
+		AppName: app, UserID: "user-1", SessionID: resp.Session.ID(),
+		After: cutoff,
+	})
+	if err != nil {
+		t.Fatalf("SearchEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != "evt-new" {
+		t.Fatalf("expected only evt-new, got %+v", events)
+	}
+}
+
+// TestSearchEventsTextCannotEscapeScopingClauses guards against the text
+// query's full-text group being broken out of: a Text value crafted to
+// close the "@text:(...)" group and append an unscoped clause of its own
+// must not be able to surface another tenant's events.
+func TestSearchEventsTextCannotEscapeScopingClauses(t *testing.T) {
+	svc := setupSearchTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	victim, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "victim"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	attacker, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "attacker"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if err := svc.AppendEvent(ctx, victim.Session, textEvent("evt-secret", "user", "the victim's secret plan")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if err := svc.AppendEvent(ctx, attacker.Session, textEvent("evt-decoy", "user", "nothing interesting here")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	events, err := svc.SearchEvents(ctx, SearchQuery{
+		AppName: app, UserID: "attacker", SessionID: attacker.Session.ID(),
+		Text: ") | (@app_name:*",
+	})
+	if err != nil {
+		t.Fatalf("SearchEvents failed: %v", err)
+	}
+	for _, evt := range events {
+		if evt.ID == "evt-secret" {
+			t.Fatalf("attacker-scoped query leaked victim's event: %+v", events)
+		}
+	}
+}
+
+func TestTextEscaperNeutralizesQuerySyntax(t *testing.T) {
+	escaped := textEscaper.Replace(") | (@app_name:*")
+	if strings.ContainsAny(escaped, ")|@*") {
+		t.Fatalf("expected query metacharacters to be escaped, got %q", escaped)
+	}
+	// Whitespace must survive unescaped so multi-word text still matches as
+	// an AND of terms instead of becoming one literal phrase.
+	if got := textEscaper.Replace("quick fox"); got != "quick fox" {
+		t.Fatalf("expected whitespace left untouched, got %q", got)
+	}
+}
+
+func TestParseSearchReply(t *testing.T) {
+	reply := []any{
+		int64(1),
+		"event:app:user:sess:evt-1",
+		[]any{"text", "hello", "event_json", `{"id":"evt-1","author":"user"}`},
+	}
+	events := parseSearchReply(reply)
+	if len(events) != 1 || events[0].ID != "evt-1" {
+		t.Fatalf("expected one decoded event with ID evt-1, got %+v", events)
+	}
+}
+
+func TestParseSearchReplyIgnoresMalformedEntries(t *testing.T) {
+	reply := []any{int64(0)}
+	if events := parseSearchReply(reply); events != nil {
+		t.Fatalf("expected no events for an empty reply, got %+v", events)
+	}
+
+	if events := parseSearchReply("not a reply"); events != nil {
+		t.Fatalf("expected nil for a malformed reply, got %+v", events)
+	}
+}
@@ -16,29 +16,137 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"iter"
+	"log/slog"
+	"math/rand"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/adk/session"
 )
 
+// RedisMode selects the Redis deployment topology a RedisSessionService
+// connects to.
+type RedisMode string
+
+const (
+	// ModeStandalone connects to a single Redis node via Addr (or the first
+	// entry of Addrs). This is the default.
+	ModeStandalone RedisMode = "standalone"
+	// ModeSentinel connects through Redis Sentinel for automatic failover.
+	// Addrs holds the Sentinel addresses and MasterName selects the monitored
+	// master.
+	ModeSentinel RedisMode = "sentinel"
+	// ModeCluster connects to a Redis Cluster. Addrs holds the seed nodes.
+	ModeCluster RedisMode = "cluster"
+)
+
+// RenewPolicy selects when a session's Redis TTL is pushed back out.
+type RenewPolicy string
+
+const (
+	// RenewOnWrite refreshes the TTL on every write (Create, AppendEvent, any
+	// state Set) by setting it alongside the value, the behaviour
+	// RedisSessionService has always had. This is the default.
+	RenewOnWrite RenewPolicy = "on_write"
+	// RenewOnGet refreshes the TTL on every write and additionally on every
+	// Get, so a session that's only being read (no new events) still stays
+	// alive for as long as something keeps fetching it.
+	RenewOnGet RenewPolicy = "on_get"
+	// RenewManual disables automatic TTL refresh entirely (writes use
+	// KEEPTTL instead of EX): the TTL only moves when Renew is called
+	// explicitly, or by the AutoRenew background refresher.
+	RenewManual RenewPolicy = "manual"
+)
+
+// invalidationTier identifies which state tier an invalidation message
+// refers to, so a receiving node drops the right keys from the right scope.
+type invalidationTier string
+
+const (
+	tierApp     invalidationTier = "app"
+	tierUser    invalidationTier = "user"
+	tierSession invalidationTier = "session"
+)
+
+// defaultInvalidationChannel is the Redis pub/sub channel used for
+// cross-node cache invalidation when WithInvalidationChannel isn't set.
+const defaultInvalidationChannel = "adk:invalidate"
+
+// invalidationMessage is published on the invalidation channel whenever a
+// redisState.Set or RedisSessionService.AppendEvent call changes state, so
+// other nodes holding the same session in memory can drop their stale copy.
+type invalidationMessage struct {
+	AppName     string            `json:"app_name"`
+	UserID      string            `json:"user_id"`
+	SessionID   string            `json:"session_id"`
+	ChangedKeys []string         `json:"changed_keys"`
+	Tier        invalidationTier `json:"tier"`
+}
+
+// Option configures optional RedisSessionService behavior.
+type Option func(*RedisSessionService)
+
+// WithInvalidationChannel overrides the Redis pub/sub channel used for
+// cross-node cache invalidation (default "adk:invalidate"). All instances
+// sharing a Redis deployment must agree on the channel name.
+func WithInvalidationChannel(name string) Option {
+	return func(s *RedisSessionService) {
+		s.invalidationChannel = name
+	}
+}
+
 // RedisSessionService implements session.Service using Redis as the backend.
 type RedisSessionService struct {
-	client      *redis.Client
-	ttl         time.Duration
-	appStateTTL time.Duration
+	client       redis.UniversalClient
+	ttl          time.Duration
+	appStateTTL  time.Duration
 	userStateTTL time.Duration
+	clusterMode  bool
+
+	invalidationChannel string
+	states              sync.Map // session key (string) -> *redisState
+	subCancel           context.CancelFunc
+	subDone             chan struct{}
+
+	renewPolicy   RenewPolicy
+	renewInterval time.Duration
+	renewCancel   context.CancelFunc
+	renewDone     chan struct{}
+
+	maxEvents               int
+	maxEventsBytes          int
+	compactKeepRecentEvents int
+
+	searchEnabled bool
+	embedder      Embedder
 }
 
 // RedisSessionServiceConfig holds configuration for RedisSessionService.
 type RedisSessionServiceConfig struct {
-	// Addr is the Redis server address (e.g., "localhost:6379")
+	// Addr is the Redis server address (e.g., "localhost:6379"). Ignored if
+	// Addrs is set or Client is provided.
 	Addr string
+	// Addrs holds multiple node addresses, used for Mode=sentinel (Sentinel
+	// addresses) and Mode=cluster (seed nodes).
+	Addrs []string
+	// Mode selects the deployment topology: standalone (default), sentinel,
+	// or cluster.
+	Mode RedisMode
+	// MasterName is the Sentinel-monitored master name. Required when
+	// Mode=sentinel.
+	MasterName string
+	// SentinelPassword authenticates against the Sentinel nodes themselves,
+	// as opposed to Password which authenticates against the data nodes.
+	SentinelPassword string
 	// Password for Redis authentication (optional)
 	Password string
 	// DB is the Redis database number
@@ -53,15 +161,128 @@ type RedisSessionServiceConfig struct {
 	// Defaults to 0 (no expiration), matching the canonical ADK behaviour
 	// where user state outlives individual sessions.
 	UserStateTTL time.Duration
+
+	// RenewPolicy selects when a session's TTL is pushed back out. Defaults
+	// to RenewOnWrite.
+	RenewPolicy RenewPolicy
+	// AutoRenew starts a background goroutine that periodically refreshes
+	// the TTL of every session this RedisSessionService currently holds a
+	// cached redisState for (i.e. every session fetched via Create/Get since
+	// this service started), keeping them alive for as long as the service
+	// itself is running. Stops when Close is called.
+	AutoRenew bool
+	// RenewInterval is how often the AutoRenew refresher runs. Defaults to
+	// half the TTL, so a session survives at least one missed tick.
+	RenewInterval time.Duration
+
+	// MaxEvents and MaxEventsBytes enable automatic compaction inside
+	// AppendEvent once a session's event list grows past either threshold
+	// (event count, or total serialized size in bytes). Zero, the default
+	// for both, disables automatic compaction; Compact can still be called
+	// manually regardless of these settings.
+	MaxEvents      int
+	MaxEventsBytes int
+	// CompactKeepRecentEvents is how many of the newest events a triggered
+	// compaction leaves in the list. Defaults to half of MaxEvents, or 50
+	// if only MaxEventsBytes is set, so a session doesn't immediately
+	// re-trigger compaction on its very next append.
+	CompactKeepRecentEvents int
+
+	// Client lets callers inject a pre-built redis.UniversalClient (e.g. one
+	// already wired up with a custom dialer or SSH tunnel), bypassing Addr/
+	// Addrs/Mode/TLS/pool settings below entirely.
+	Client redis.UniversalClient
+
+	// TLSConfig, if set, is forwarded as-is to the underlying redis.Options/
+	// FailoverOptions/ClusterOptions, enabling TLS. InsecureSkipVerify and
+	// the CACertPEM/ClientCertPEM/ClientKeyPEM fields below are a convenience
+	// for the common case and are ignored if TLSConfig is already set.
+	TLSConfig *tls.Config
+	// InsecureSkipVerify disables server certificate verification. Only
+	// takes effect when TLSConfig is nil and at least one of the PEM fields
+	// or this flag is set.
+	InsecureSkipVerify bool
+	// CACertPEM, if set, is added to the TLS config's root CA pool.
+	CACertPEM []byte
+	// ClientCertPEM and ClientKeyPEM, if both set, are loaded as a client
+	// certificate for mutual TLS.
+	ClientCertPEM []byte
+	ClientKeyPEM  []byte
+
+	// PoolSize is the maximum number of socket connections (default: go-redis
+	// default, 10 per CPU).
+	PoolSize int
+	// MinIdleConns is the minimum number of idle connections kept open.
+	MinIdleConns int
+	// MaxRetries is the maximum number of retries for a command before
+	// giving up (default: go-redis default, 3).
+	MaxRetries int
+	// DialTimeout, ReadTimeout, WriteTimeout, and PoolTimeout tune the
+	// corresponding redis.Options timeouts. Zero uses the go-redis default.
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolTimeout  time.Duration
+
+	// EnableSearch mirrors every appended event into a RediSearch index
+	// (FT.CREATE on HASH documents keyed "event:<app>:<user>:<sess>:<id>"),
+	// turning the service into a keyword/time-range/semantic recall backend
+	// in addition to plain session storage. Requires a Redis deployment with
+	// the RediSearch module loaded.
+	EnableSearch bool
+	// Embedder, if set alongside EnableSearch, populates a VECTOR field on
+	// each indexed event so SearchEvents can perform KNN semantic recall.
+	// Without it, the index supports keyword/TAG/time-range search only.
+	Embedder Embedder
+	// VectorDim is the embedding dimensionality for the VECTOR field.
+	// Required (and only used) when Embedder is set.
+	VectorDim int
 }
 
-// NewRedisSessionService creates a new Redis-backed session service.
-func NewRedisSessionService(cfg RedisSessionServiceConfig) (*RedisSessionService, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+// buildTLSConfig resolves cfg's TLS fields into a single *tls.Config, or nil
+// if TLS wasn't requested.
+func buildTLSConfig(cfg RedisSessionServiceConfig) (*tls.Config, error) {
+	if cfg.TLSConfig != nil {
+		return cfg.TLSConfig, nil
+	}
+	if !cfg.InsecureSkipVerify && len(cfg.CACertPEM) == 0 && len(cfg.ClientCertPEM) == 0 {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	if len(cfg.CACertPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.CACertPEM) {
+			return nil, fmt.Errorf("failed to parse CA certificate PEM")
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if len(cfg.ClientCertPEM) > 0 && len(cfg.ClientKeyPEM) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCertPEM, cfg.ClientKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// NewRedisSessionService creates a new Redis-backed session service. It also
+// starts a background goroutine that subscribes to the invalidation channel
+// (see WithInvalidationChannel) and drops stale keys from any locally cached
+// redisState when another node reports a change. Call Close to stop it.
+func NewRedisSessionService(cfg RedisSessionServiceConfig, opts ...Option) (*RedisSessionService, error) {
+	client := cfg.Client
+	if client == nil {
+		var err error
+		client, err = newUniversalClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -75,25 +296,258 @@ func NewRedisSessionService(cfg RedisSessionServiceConfig) (*RedisSessionService
 		ttl = 24 * time.Hour
 	}
 
-	return &RedisSessionService{
-		client:       client,
-		ttl:          ttl,
-		appStateTTL:  cfg.AppStateTTL,
-		userStateTTL: cfg.UserStateTTL,
-	}, nil
+	renewPolicy := cfg.RenewPolicy
+	if renewPolicy == "" {
+		renewPolicy = RenewOnWrite
+	}
+	renewInterval := cfg.RenewInterval
+	if renewInterval == 0 {
+		renewInterval = ttl / 2
+	}
+
+	compactKeepRecentEvents := cfg.CompactKeepRecentEvents
+	if compactKeepRecentEvents <= 0 {
+		if cfg.MaxEvents > 0 {
+			compactKeepRecentEvents = cfg.MaxEvents / 2
+		} else {
+			compactKeepRecentEvents = 50
+		}
+	}
+
+	s := &RedisSessionService{
+		client:                  client,
+		ttl:                     ttl,
+		appStateTTL:             cfg.AppStateTTL,
+		userStateTTL:            cfg.UserStateTTL,
+		clusterMode:             cfg.Mode == ModeCluster,
+		invalidationChannel:     defaultInvalidationChannel,
+		renewPolicy:             renewPolicy,
+		renewInterval:           renewInterval,
+		maxEvents:               cfg.MaxEvents,
+		maxEventsBytes:          cfg.MaxEventsBytes,
+		compactKeepRecentEvents: compactKeepRecentEvents,
+		searchEnabled:           cfg.EnableSearch,
+		embedder:                cfg.Embedder,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.startInvalidationSubscriber()
+
+	if cfg.AutoRenew {
+		s.startAutoRenewer()
+	}
+
+	if s.searchEnabled {
+		if err := s.ensureSearchIndex(ctx, cfg.VectorDim); err != nil {
+			slog.Warn("RedisSessionService: failed to ensure search index, SearchEvents will error until it exists", "error", err)
+		}
+	}
+
+	return s, nil
+}
+
+// startAutoRenewer starts a background goroutine that refreshes the TTL of
+// every session this service currently holds a cached redisState for (see
+// s.states, populated by trackState), every renewInterval. Unlike Renew,
+// which targets one session a caller names explicitly, this keeps alive
+// every session still referenced in-process without the caller having to
+// track session IDs itself.
+func (s *RedisSessionService) startAutoRenewer() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.renewCancel = cancel
+	s.renewDone = make(chan struct{})
+
+	go func() {
+		defer close(s.renewDone)
+
+		ticker := time.NewTicker(s.renewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.states.Range(func(_, value any) bool {
+					st := value.(*redisState)
+					if err := s.Renew(ctx, &RenewRequest{AppName: st.appName, UserID: st.userID, SessionID: st.sessionID}); err != nil {
+						slog.Warn("RedisSessionService: auto-renew failed", "session", st.sessionID, "error", err)
+					}
+					return true
+				})
+			}
+		}
+	}()
+}
+
+// trackState registers st so future invalidation messages for its session
+// key can reach it. Superseded entries (e.g. Get called again for the same
+// session) simply overwrite the previous one; the old *redisState is left to
+// be garbage collected once nothing else references it.
+func (s *RedisSessionService) trackState(key string, st *redisState) {
+	s.states.Store(key, st)
+}
+
+// publishInvalidation notifies other nodes that changedKeys in the given
+// tier changed for (appName, userID, sessionID). Publish failures are
+// logged and otherwise ignored: invalidation is a best-effort optimization,
+// not a correctness guarantee, since every read still goes to Redis for
+// HASH-backed tiers and session state is reloaded via Get/Create.
+func (s *RedisSessionService) publishInvalidation(ctx context.Context, appName, userID, sessionID string, changedKeys []string, tier invalidationTier) {
+	msg := invalidationMessage{
+		AppName:     appName,
+		UserID:      userID,
+		SessionID:   sessionID,
+		ChangedKeys: changedKeys,
+		Tier:        tier,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Warn("RedisSessionService: failed to marshal invalidation message", "error", err)
+		return
+	}
+	if err := s.client.Publish(ctx, s.invalidationChannel, data).Err(); err != nil {
+		slog.Warn("RedisSessionService: failed to publish invalidation message", "error", err)
+	}
+}
+
+// startInvalidationSubscriber subscribes to the invalidation channel and, for
+// each message naming a session this node has cached locally, drops the
+// affected keys from that redisState so the next Get sees fresh data instead
+// of a stale local copy left over from before another node's write.
+func (s *RedisSessionService) startInvalidationSubscriber() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.subCancel = cancel
+	s.subDone = make(chan struct{})
+
+	pubsub := s.client.Subscribe(ctx, s.invalidationChannel)
+
+	go func() {
+		defer close(s.subDone)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var inv invalidationMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+					slog.Warn("RedisSessionService: failed to unmarshal invalidation message", "error", err)
+					continue
+				}
+				key := s.sessionKey(inv.AppName, inv.UserID, inv.SessionID)
+				if v, ok := s.states.Load(key); ok {
+					v.(*redisState).invalidate(inv.ChangedKeys)
+				}
+			}
+		}
+	}()
+}
+
+// newUniversalClient builds the concrete redis client for cfg.Mode: a plain
+// client for standalone, a failover client for sentinel, or a cluster client
+// for cluster. All three satisfy redis.UniversalClient, so the rest of the
+// service never needs to know which one it's talking to.
+func newUniversalClient(cfg RedisSessionServiceConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
+	switch cfg.Mode {
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+			MaxRetries:       cfg.MaxRetries,
+			DialTimeout:      cfg.DialTimeout,
+			ReadTimeout:      cfg.ReadTimeout,
+			WriteTimeout:     cfg.WriteTimeout,
+			PoolTimeout:      cfg.PoolTimeout,
+		}), nil
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Password:     cfg.Password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			MaxRetries:   cfg.MaxRetries,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolTimeout:  cfg.PoolTimeout,
+		}), nil
+	default:
+		addr := cfg.Addr
+		if addr == "" && len(cfg.Addrs) > 0 {
+			addr = cfg.Addrs[0]
+		}
+		return redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			MaxRetries:   cfg.MaxRetries,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolTimeout:  cfg.PoolTimeout,
+		}), nil
+	}
+}
+
+// Key helpers. In cluster mode, the (appName, userID) scope is wrapped in a
+// Redis hash tag ("{app:user}") so a session's key, events list, and index
+// set always land on the same cluster slot, keeping pipelines atomic.
+func (s *RedisSessionService) keyScope(appName, userID string) string {
+	if s.clusterMode {
+		return fmt.Sprintf("{%s:%s}", appName, userID)
+	}
+	return fmt.Sprintf("%s:%s", appName, userID)
 }
 
-// Key helpers
 func (s *RedisSessionService) sessionKey(appName, userID, sessionID string) string {
-	return fmt.Sprintf("session:%s:%s:%s", appName, userID, sessionID)
+	return fmt.Sprintf("session:%s:%s", s.keyScope(appName, userID), sessionID)
 }
 
 func (s *RedisSessionService) sessionsIndexKey(appName, userID string) string {
-	return fmt.Sprintf("sessions:%s:%s", appName, userID)
+	return fmt.Sprintf("sessions:%s", s.keyScope(appName, userID))
 }
 
 func (s *RedisSessionService) eventsKey(appName, userID, sessionID string) string {
-	return fmt.Sprintf("events:%s:%s:%s", appName, userID, sessionID)
+	return fmt.Sprintf("events:%s:%s", s.keyScope(appName, userID), sessionID)
+}
+
+// Watch's pub/sub channels are named independently of the data keys above:
+// a session's watchSessionChannel happens to format identically to its
+// sessionKey, but Redis channels and keys live in separate namespaces, so
+// the two never collide.
+func (s *RedisSessionService) watchSessionChannel(appName, userID, sessionID string) string {
+	return fmt.Sprintf("session:%s:%s:%s", appName, userID, sessionID)
+}
+
+func (s *RedisSessionService) watchUserChannel(appName, userID string) string {
+	return fmt.Sprintf("user:%s:%s", appName, userID)
+}
+
+func (s *RedisSessionService) watchAppChannel(appName string) string {
+	return fmt.Sprintf("app:%s", appName)
 }
 
 func (s *RedisSessionService) appStateKey(appName string) string {
@@ -104,6 +558,334 @@ func (s *RedisSessionService) userStateKey(appName, userID string) string {
 	return fmt.Sprintf("userstate:%s:%s", appName, userID)
 }
 
+// sessionCASScript atomically merges a session-state delta into the stored
+// storableSession, bumping Version and LastUpdateTime, and (when ARGV[5] is
+// non-empty) pipelines an event RPUSH plus TTL refresh of the events list and
+// sessions index into the same atomic step. It replaces the previous
+// GET -> json.Unmarshal -> mutate -> SET pattern, which silently lost
+// concurrent writers' StateDeltas.
+//
+// KEYS: 1=session key, 2=events key, 3=sessions index key
+// ARGV: 1=expected version ("-1" skips the check), 2=JSON state delta,
+//
+//	3=new last_update_time (RFC3339Nano), 4=TTL seconds, 5=JSON event
+//	(empty string to skip the event/TTL pipelining), 6=renew ("1" to set
+//	EX on every touched key, "0" to SET/RPUSH with KEEPTTL instead, for
+//	RenewManual)
+//
+// Returns {status, version} where status is 1 (applied), 0 (version
+// mismatch, version holds the current value to retry with), or -1 (session
+// not found).
+var sessionCASScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+  return {-1, 0}
+end
+
+local storable = cjson.decode(raw)
+local current = storable.version or 0
+local expected = tonumber(ARGV[1])
+if expected >= 0 and current ~= expected then
+  return {0, current}
+end
+
+local delta = cjson.decode(ARGV[2])
+if storable.state == nil or storable.state == cjson.null then
+  storable.state = {}
+end
+for k, v in pairs(delta) do
+  storable.state[k] = v
+end
+storable.last_update_time = ARGV[3]
+storable.version = current + 1
+
+local renew = ARGV[6] == '1'
+if renew then
+  redis.call('SET', KEYS[1], cjson.encode(storable), 'EX', ARGV[4])
+else
+  redis.call('SET', KEYS[1], cjson.encode(storable), 'KEEPTTL')
+end
+
+if ARGV[5] ~= '' then
+  redis.call('RPUSH', KEYS[2], ARGV[5])
+  if renew then
+    redis.call('EXPIRE', KEYS[2], ARGV[4])
+    redis.call('EXPIRE', KEYS[3], ARGV[4])
+  end
+end
+
+return {1, storable.version}
+`)
+
+const (
+	casMaxAttempts = 5
+	casJitterMs    = 20
+)
+
+// ErrConflict is returned by AppendEventWithVersion when expectedVersion no
+// longer matches the session's current version — another writer updated it
+// first. AppendEvent, by contrast, never returns ErrConflict: it reads the
+// current version itself and lets runSessionCAS retry internally, so a
+// caller using AppendEvent never has to handle a conflict at all.
+// AppendEventWithVersion exists for callers that need to detect the
+// conflict themselves — e.g. to re-derive their event from the now-current
+// state before retrying — instead of having this package retry blindly on
+// their behalf.
+var ErrConflict = errors.New("session: version conflict")
+
+// runSessionCASOnce runs sessionCASScript exactly once: no retry on version
+// mismatch. Returns ErrConflict (wrapping the current version isn't
+// possible through a sentinel, so callers that need it should inspect the
+// returned version, which is always the session's current version whether
+// the CAS applied or conflicted) when the script reports a mismatch.
+// eventJSON may be nil to skip the event/TTL pipelining (used by
+// persistSessionState). renew is false only under RenewManual, where writes
+// must not push the TTL back out themselves.
+func (s *RedisSessionService) runSessionCASOnce(ctx context.Context, sessionKey, eventsKey, indexKey string, expectedVersion int64, delta map[string]any, eventJSON []byte, renew bool) (int64, error) {
+	deltaJSON, err := json.Marshal(delta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal state delta: %w", err)
+	}
+
+	renewArg := "0"
+	if renew {
+		renewArg = "1"
+	}
+
+	result, err := sessionCASScript.Run(ctx, s.client, []string{sessionKey, eventsKey, indexKey},
+		expectedVersion, string(deltaJSON), time.Now().Format(time.RFC3339Nano), int64(s.ttl.Seconds()), string(eventJSON), renewArg,
+	).Result()
+	if err != nil {
+		return 0, fmt.Errorf("session CAS script failed: %w", err)
+	}
+
+	values, ok := result.([]any)
+	if !ok || len(values) != 2 {
+		return 0, fmt.Errorf("session CAS script returned unexpected result: %v", result)
+	}
+	status, _ := values[0].(int64)
+	version, _ := values[1].(int64)
+
+	switch status {
+	case 1:
+		return version, nil
+	case -1:
+		return 0, fmt.Errorf("session not found: %s", sessionKey)
+	default:
+		return version, ErrConflict
+	}
+}
+
+// runSessionCAS runs sessionCASScript with bounded retries: on a version
+// mismatch it retries immediately with the current version the script
+// reported, jittered to avoid a thundering herd of retrying writers.
+func (s *RedisSessionService) runSessionCAS(ctx context.Context, sessionKey, eventsKey, indexKey string, expectedVersion int64, delta map[string]any, eventJSON []byte, renew bool) (int64, error) {
+	for attempt := 0; attempt < casMaxAttempts; attempt++ {
+		version, err := s.runSessionCASOnce(ctx, sessionKey, eventsKey, indexKey, expectedVersion, delta, eventJSON, renew)
+		if err == nil {
+			return version, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return 0, err
+		}
+		expectedVersion = version
+		time.Sleep(time.Duration(rand.Intn(casJitterMs)+1) * time.Millisecond)
+	}
+
+	return 0, fmt.Errorf("session CAS script: exceeded %d attempts due to concurrent writers on %s", casMaxAttempts, sessionKey)
+}
+
+// ErrSnapshotOnly is returned by Get when req.After asks for events at or
+// before a session's compaction boundary (storableSession.CompactedBefore):
+// those events were folded into State and trimmed by Compact, so they no
+// longer exist individually. The session's current state is still fully
+// available via a Get without After/NumRecentEvents.
+var ErrSnapshotOnly = errors.New("session: requested events predate the compaction snapshot boundary")
+
+// compactionScript atomically trims the oldest ARGV[2] events off KEYS[2]
+// and records the compaction boundary on KEYS[1], gated by the same
+// version check sessionCASScript uses. Because storableSession.State is
+// already kept fully up to date by every AppendEvent (it isn't derived
+// from the event list), compaction itself never needs to replay or
+// recompute state — it only needs to trim the list and remember how far it
+// trimmed, so Get can tell callers which After values it can no longer
+// satisfy from individual events.
+//
+// KEYS: 1=session key, 2=events key
+// ARGV: 1=expected version ("-1" skips the check), 2=number of oldest
+//
+//	events to trim, 3=compaction boundary timestamp (RFC3339Nano),
+//	4=new last_update_time (RFC3339Nano)
+//
+// Returns {status, version, trimmed} where status is 1 (applied), 0
+// (version mismatch, version holds the current value to retry with), or -1
+// (session not found).
+var compactionScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+  return {-1, 0, 0}
+end
+
+local storable = cjson.decode(raw)
+local current = storable.version or 0
+local expected = tonumber(ARGV[1])
+if expected >= 0 and current ~= expected then
+  return {0, current, 0}
+end
+
+local cut = tonumber(ARGV[2])
+local len = redis.call('LLEN', KEYS[2])
+if cut > len then
+  cut = len
+end
+
+if cut > 0 then
+  redis.call('LTRIM', KEYS[2], cut, -1)
+  storable.compacted_before = ARGV[3]
+end
+
+storable.last_update_time = ARGV[4]
+storable.version = current + 1
+redis.call('SET', KEYS[1], cjson.encode(storable), 'KEEPTTL')
+
+return {1, storable.version, cut}
+`)
+
+// CompactRequest identifies a session to compact and how many of its
+// newest events to leave untouched.
+type CompactRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	// KeepRecentEvents is how many of the newest events to leave in the
+	// list; everything older is folded into the snapshot and trimmed.
+	// Zero trims the entire list.
+	KeepRecentEvents int
+}
+
+// CompactResponse reports the outcome of a Compact call.
+type CompactResponse struct {
+	// EventsCompacted is how many events were trimmed from the list.
+	EventsCompacted int
+	// CompactedBefore is the new compaction boundary, or the zero time if
+	// EventsCompacted is 0. See storableSession.CompactedBefore.
+	CompactedBefore time.Time
+}
+
+// Compact folds a session's oldest events into its existing state snapshot
+// by trimming them from the events list, once more than req.KeepRecentEvents
+// remain. It doesn't need to merge any state itself — storableSession.State
+// already reflects every event's StateDelta by the time AppendEvent
+// returns — so compaction is just bookkeeping: trim the list, and record
+// where the cut happened so Get can reject an After request that can no
+// longer be satisfied from the remaining events. Safe to call concurrently
+// with AppendEvent: both go through the same version-gated CAS pattern, so
+// a race simply surfaces as ErrConflict for the caller to retry.
+func (s *RedisSessionService) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
+	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
+
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("session not found: %s", req.SessionID)
+		}
+		return nil, fmt.Errorf("failed to get session for compaction: %w", err)
+	}
+	var storable storableSession
+	if err := json.Unmarshal(data, &storable); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	eventData, err := s.client.LRange(ctx, eventsKey, 0, -1).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get events for compaction: %w", err)
+	}
+
+	keep := req.KeepRecentEvents
+	if keep < 0 {
+		keep = 0
+	}
+	cut := len(eventData) - keep
+	if cut <= 0 {
+		return &CompactResponse{}, nil
+	}
+
+	var boundaryEvt session.Event
+	if err := json.Unmarshal([]byte(eventData[cut-1]), &boundaryEvt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event being compacted: %w", err)
+	}
+
+	result, err := compactionScript.Run(ctx, s.client, []string{key, eventsKey},
+		storable.Version, cut, boundaryEvt.Timestamp.Format(time.RFC3339Nano), time.Now().Format(time.RFC3339Nano),
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("compaction script failed: %w", err)
+	}
+	values, ok := result.([]any)
+	if !ok || len(values) != 3 {
+		return nil, fmt.Errorf("compaction script returned unexpected result: %v", result)
+	}
+	status, _ := values[0].(int64)
+	trimmed, _ := values[2].(int64)
+
+	switch status {
+	case -1:
+		return nil, fmt.Errorf("session not found: %s", req.SessionID)
+	case 0:
+		return nil, ErrConflict
+	}
+
+	return &CompactResponse{EventsCompacted: int(trimmed), CompactedBefore: boundaryEvt.Timestamp}, nil
+}
+
+// maybeAutoCompact triggers Compact once a session's event list grows past
+// s.maxEvents or s.maxEventsBytes, called from AppendEvent/
+// AppendEventWithVersion after a successful append. A failure here is
+// logged and otherwise ignored, the same best-effort treatment this file
+// gives invalidation publishing and renew-on-get: a missed compaction just
+// means the list stays a bit longer, not a correctness issue.
+func (s *RedisSessionService) maybeAutoCompact(ctx context.Context, appName, userID, sessionID string) {
+	if s.maxEvents <= 0 && s.maxEventsBytes <= 0 {
+		return
+	}
+	eventsKey := s.eventsKey(appName, userID, sessionID)
+
+	trigger := false
+	if s.maxEvents > 0 {
+		n, err := s.client.LLen(ctx, eventsKey).Result()
+		if err != nil {
+			slog.Warn("RedisSessionService: auto-compaction LLEN failed", "session", sessionID, "error", err)
+			return
+		}
+		trigger = n > int64(s.maxEvents)
+	}
+	if !trigger && s.maxEventsBytes > 0 {
+		items, err := s.client.LRange(ctx, eventsKey, 0, -1).Result()
+		if err != nil {
+			slog.Warn("RedisSessionService: auto-compaction LRANGE failed", "session", sessionID, "error", err)
+			return
+		}
+		total := 0
+		for _, item := range items {
+			total += len(item)
+		}
+		trigger = total > s.maxEventsBytes
+	}
+	if !trigger {
+		return
+	}
+
+	if _, err := s.Compact(ctx, &CompactRequest{
+		AppName:          appName,
+		UserID:           userID,
+		SessionID:        sessionID,
+		KeepRecentEvents: s.compactKeepRecentEvents,
+	}); err != nil {
+		slog.Warn("RedisSessionService: automatic compaction failed", "session", sessionID, "error", err)
+	}
+}
+
 // Create creates a new session. It returns an error if a session with the
 // same ID already exists, matching the canonical ADK behaviour.
 func (s *RedisSessionService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
@@ -129,7 +911,7 @@ func (s *RedisSessionService) Create(ctx context.Context, req *session.CreateReq
 		id:             sessionID,
 		appName:        req.AppName,
 		userID:         req.UserID,
-		state:          newRedisState(mergedState, s.client, key, s.ttl, s, req.AppName, req.UserID),
+		state:          newRedisState(mergedState, s.client, key, s.ttl, s, req.AppName, req.UserID, sessionID),
 		events:         newRedisEvents(nil, s.client, eventsKey),
 		lastUpdateTime: time.Now(),
 	}
@@ -177,6 +959,10 @@ func (s *RedisSessionService) Get(ctx context.Context, req *session.GetRequest)
 		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
+	if !req.After.IsZero() && !storable.CompactedBefore.IsZero() && !req.After.After(storable.CompactedBefore) {
+		return nil, ErrSnapshotOnly
+	}
+
 	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
 	eventData, err := s.client.LRange(ctx, eventsKey, 0, -1).Result()
 	if err != nil && !errors.Is(err, redis.Nil) {
@@ -215,7 +1001,7 @@ func (s *RedisSessionService) Get(ctx context.Context, req *session.GetRequest)
 		id:             storable.ID,
 		appName:        storable.AppName,
 		userID:         storable.UserID,
-		state:          newRedisState(mergedState, s.client, key, s.ttl, s, req.AppName, req.UserID),
+		state:          newRedisState(mergedState, s.client, key, s.ttl, s, req.AppName, req.UserID, req.SessionID),
 		lastUpdateTime: storable.LastUpdateTime,
 	}
 	if filtered {
@@ -224,9 +1010,220 @@ func (s *RedisSessionService) Get(ctx context.Context, req *session.GetRequest)
 		sess.events = newRedisEvents(events, s.client, eventsKey)
 	}
 
+	if s.renewPolicy == RenewOnGet {
+		if err := s.Renew(ctx, &RenewRequest{AppName: req.AppName, UserID: req.UserID, SessionID: req.SessionID}); err != nil {
+			slog.Warn("RedisSessionService: renew-on-get failed", "session", req.SessionID, "error", err)
+		}
+	}
+
 	return &session.GetResponse{Session: sess}, nil
 }
 
+// RenewRequest identifies the session RedisSessionService.Renew should
+// refresh the TTL of.
+type RenewRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+}
+
+// Renew pushes a session's TTL back out to the full configured TTL without a
+// read/write cycle: its own key, its events list, and its entry in the
+// sessions index all get EXPIRE refreshed in one pipeline. Long-running
+// agent runs that don't otherwise write to the session often enough to
+// benefit from RenewOnWrite can call this directly, and it's what the
+// AutoRenew background refresher calls on every tracked session.
+func (s *RedisSessionService) Renew(ctx context.Context, req *RenewRequest) error {
+	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
+	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
+	indexKey := s.sessionsIndexKey(req.AppName, req.UserID)
+
+	pipe := s.client.Pipeline()
+	pipe.Expire(ctx, key, s.ttl)
+	pipe.Expire(ctx, eventsKey, s.ttl)
+	pipe.Expire(ctx, indexKey, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to renew session %s: %w", req.SessionID, err)
+	}
+	return nil
+}
+
+// WatchEventKind distinguishes the two kinds of notification Watch
+// delivers.
+type WatchEventKind string
+
+const (
+	// WatchEventAppended means a new session.Event was appended to the
+	// watched session.
+	WatchEventAppended WatchEventKind = "event_appended"
+	// WatchEventStateChanged means one or more keys in a watched tier
+	// changed, carried alongside WatchEventAppended's own session-tier
+	// delta so user/app-tier changes triggered by the same AppendEvent are
+	// also visible to subscribers only watching those tiers.
+	WatchEventStateChanged WatchEventKind = "state_changed"
+)
+
+// WatchEvent is a single notification delivered on the channel Watch
+// returns.
+type WatchEvent struct {
+	Kind        WatchEventKind
+	AppName     string
+	UserID      string
+	SessionID   string
+	Tier        invalidationTier
+	Event       *session.Event // set only when Kind == WatchEventAppended
+	ChangedKeys []string       // set only when Kind == WatchEventStateChanged
+}
+
+// watchMessage is the JSON wire format published on Watch's pub/sub
+// channels.
+type watchMessage struct {
+	Kind        WatchEventKind   `json:"kind"`
+	AppName     string           `json:"app_name"`
+	UserID      string           `json:"user_id"`
+	SessionID   string           `json:"session_id"`
+	Tier        invalidationTier `json:"tier"`
+	Event       *session.Event   `json:"event,omitempty"`
+	ChangedKeys []string         `json:"changed_keys,omitempty"`
+}
+
+// WatchRequest identifies the session Watch should stream notifications
+// for, plus an optional replay window of past events to deliver before
+// live notifications begin.
+type WatchRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	// NumRecentEvents, if > 0, replays the session's last N events (the
+	// same semantics as GetRequest.NumRecentEvents) before switching to
+	// live notifications.
+	NumRecentEvents int
+	// After, if non-zero, replays events with Timestamp >= After instead of
+	// NumRecentEvents.
+	After time.Time
+}
+
+// publishWatchEvent publishes msg on channel for Watch subscribers. Like
+// publishInvalidation, publish failures are logged and otherwise ignored:
+// Watch is a best-effort streaming convenience built on Pub/Sub, not a
+// durable delivery guarantee — a subscriber that's disconnected when a
+// message is published has simply missed it, the same tradeoff Redis
+// Pub/Sub makes everywhere else in this file.
+func (s *RedisSessionService) publishWatchEvent(ctx context.Context, channel string, msg watchMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Warn("RedisSessionService: failed to marshal watch message", "error", err)
+		return
+	}
+	if err := s.client.Publish(ctx, channel, data).Err(); err != nil {
+		slog.Warn("RedisSessionService: failed to publish watch message", "error", err)
+	}
+}
+
+// Watch subscribes to AppendEvent notifications and state-tier changes for
+// a session, across every RedisSessionService instance sharing the same
+// Redis deployment — e.g. a UI process tailing a session another worker
+// process is appending events to. Unlike startInvalidationSubscriber's
+// single shared invalidation channel that every node filters locally,
+// Watch subscribes to channels scoped to just the session, its user tier,
+// and its app tier, so a subscriber only ever receives traffic relevant to
+// what it's watching. If req.NumRecentEvents or req.After is set, matching
+// past events are replayed on the returned channel before live
+// notifications begin. The channel is closed once ctx is cancelled;
+// callers don't need to do anything else to unsubscribe.
+//
+// Subscribe happens before the replay window is fetched, not after, so
+// there's no gap in which an event appended between the two could be
+// missed entirely: an event published while the replay Get is in flight is
+// both included in replay (Get reads whatever's in Redis at the time it
+// runs) and queued live by the subscription, so the live copy is dropped
+// by matching its ID against the replayed events' instead — not by
+// timestamp, which two events can share at the clock resolution used here.
+func (s *RedisSessionService) Watch(ctx context.Context, req *WatchRequest) (<-chan WatchEvent, error) {
+	pubsub := s.client.Subscribe(ctx,
+		s.watchSessionChannel(req.AppName, req.UserID, req.SessionID),
+		s.watchUserChannel(req.AppName, req.UserID),
+		s.watchAppChannel(req.AppName),
+	)
+
+	var replay []*session.Event
+	replayedIDs := map[string]bool{}
+	if req.NumRecentEvents > 0 || !req.After.IsZero() {
+		getResp, err := s.Get(ctx, &session.GetRequest{
+			AppName:         req.AppName,
+			UserID:          req.UserID,
+			SessionID:       req.SessionID,
+			NumRecentEvents: req.NumRecentEvents,
+			After:           req.After,
+		})
+		if err != nil {
+			pubsub.Close()
+			return nil, fmt.Errorf("failed to load replay window: %w", err)
+		}
+		for evt := range getResp.Session.Events().All() {
+			replay = append(replay, evt)
+			replayedIDs[evt.ID] = true
+		}
+	}
+
+	out := make(chan WatchEvent, 16)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		for _, evt := range replay {
+			select {
+			case out <- WatchEvent{
+				Kind:      WatchEventAppended,
+				AppName:   req.AppName,
+				UserID:    req.UserID,
+				SessionID: req.SessionID,
+				Tier:      tierSession,
+				Event:     evt,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var wm watchMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &wm); err != nil {
+					slog.Warn("RedisSessionService: failed to unmarshal watch message", "error", err)
+					continue
+				}
+				if wm.Kind == WatchEventAppended && wm.Event != nil && replayedIDs[wm.Event.ID] {
+					// Already delivered as part of replay above.
+					continue
+				}
+				select {
+				case out <- WatchEvent{
+					Kind:        wm.Kind,
+					AppName:     wm.AppName,
+					UserID:      wm.UserID,
+					SessionID:   wm.SessionID,
+					Tier:        wm.Tier,
+					Event:       wm.Event,
+					ChangedKeys: wm.ChangedKeys,
+				}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
 // List returns all sessions for a user.
 func (s *RedisSessionService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
 	indexKey := s.sessionsIndexKey(req.AppName, req.UserID)
@@ -252,16 +1249,153 @@ func (s *RedisSessionService) List(ctx context.Context, req *session.ListRequest
 	return &session.ListResponse{Sessions: sessions}, nil
 }
 
+// ListPageRequest configures RedisSessionService.ListPage, a SCAN-based
+// alternative to List for users with many sessions. List materializes the
+// entire SMEMBERS index and issues one Get per session, which is O(N)
+// round-trips and unbounded memory; ListPage scans the index in bounded
+// batches and fetches each page with a single MGET.
+type ListPageRequest struct {
+	AppName string
+	UserID  string
+	// PageSize hints the SSCAN COUNT. Fewer than PageSize sessions may still
+	// come back on a given call (that's how Redis's cursor-based SCAN
+	// family works) — callers must keep calling with NextCursor until it's
+	// empty, not stop after one page. Defaults to 100.
+	PageSize int
+	// Cursor resumes a previous ListPage call. Empty starts from the beginning.
+	Cursor string
+	// IncludeEvents loads each session's event history (LRange) when true.
+	// Defaults to false, since ListPage is meant for lightweight enumeration.
+	IncludeEvents bool
+	// IncludeState merges app- and user-scoped state (one HGETALL per tier,
+	// shared across the whole page) into each session's state when true.
+	// Defaults to false.
+	IncludeState bool
+}
+
+// ListPageResponse is the result of a single ListPage call. NextCursor is
+// empty once the scan has covered the whole index.
+type ListPageResponse struct {
+	Sessions   []session.Session
+	NextCursor string
+}
+
+// ListPage returns one SCAN-based page of a user's sessions. See
+// ListPageRequest for the available trade-offs.
+func (s *RedisSessionService) ListPage(ctx context.Context, req ListPageRequest) (*ListPageResponse, error) {
+	indexKey := s.sessionsIndexKey(req.AppName, req.UserID)
+
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	var cursor uint64
+	if req.Cursor != "" {
+		parsed, err := strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q: %w", req.Cursor, err)
+		}
+		cursor = parsed
+	}
+
+	sessionIDs, nextCursor, err := s.client.SScan(ctx, indexKey, cursor, "", int64(pageSize)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sessions index: %w", err)
+	}
+	if len(sessionIDs) == 0 {
+		return &ListPageResponse{NextCursor: cursorString(nextCursor)}, nil
+	}
+
+	keys := make([]string, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		keys[i] = s.sessionKey(req.AppName, req.UserID, sessionID)
+	}
+
+	raw, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch-get sessions: %w", err)
+	}
+
+	var appState, userState map[string]any
+	if req.IncludeState {
+		appState = s.loadAppState(ctx, req.AppName)
+		userState = s.loadUserState(ctx, req.AppName, req.UserID)
+	}
+
+	sessions := make([]session.Session, 0, len(raw))
+	for i, v := range raw {
+		blob, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		var storable storableSession
+		if err := json.Unmarshal([]byte(blob), &storable); err != nil {
+			continue
+		}
+
+		mergedState := storable.State
+		if req.IncludeState {
+			mergedState = mergeStates(appState, userState, storable.State)
+		}
+
+		sess := &redisSession{
+			id:             storable.ID,
+			appName:        storable.AppName,
+			userID:         storable.UserID,
+			state:          newRedisState(mergedState, s.client, keys[i], s.ttl, s, req.AppName, req.UserID, storable.ID),
+			lastUpdateTime: storable.LastUpdateTime,
+		}
+
+		var events []*session.Event
+		if req.IncludeEvents {
+			eventsKey := s.eventsKey(req.AppName, req.UserID, storable.ID)
+			eventData, err := s.client.LRange(ctx, eventsKey, 0, -1).Result()
+			if err == nil {
+				for _, ed := range eventData {
+					var evt session.Event
+					if err := json.Unmarshal([]byte(ed), &evt); err == nil {
+						events = append(events, &evt)
+					}
+				}
+			}
+		}
+		sess.events = newFilteredRedisEvents(events)
+
+		sessions = append(sessions, sess)
+	}
+
+	return &ListPageResponse{Sessions: sessions, NextCursor: cursorString(nextCursor)}, nil
+}
+
+// cursorString renders a SCAN cursor as the opaque string ListPageResponse
+// exposes, with 0 (scan complete) collapsed to empty.
+func cursorString(cursor uint64) string {
+	if cursor == 0 {
+		return ""
+	}
+	return strconv.FormatUint(cursor, 10)
+}
+
 // Delete removes a session.
 func (s *RedisSessionService) Delete(ctx context.Context, req *session.DeleteRequest) error {
 	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
 	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
 	indexKey := s.sessionsIndexKey(req.AppName, req.UserID)
 
+	var searchKeys []string
+	if s.searchEnabled {
+		searchKeys = s.collectSearchDocKeys(ctx, req.AppName, req.UserID, req.SessionID, eventsKey)
+	}
+
 	pipe := s.client.Pipeline()
 	pipe.Del(ctx, key)
 	pipe.Del(ctx, eventsKey)
 	pipe.SRem(ctx, indexKey, req.SessionID)
+	for _, searchKey := range searchKeys {
+		pipe.Del(ctx, searchKey)
+	}
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
@@ -285,31 +1419,25 @@ func (s *RedisSessionService) AppendEvent(ctx context.Context, sess session.Sess
 
 	trimTempStateDelta(evt)
 
-	data, err := json.Marshal(evt)
+	eventData, err := json.Marshal(evt)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
+	key := s.sessionKey(sess.AppName(), sess.UserID(), sess.ID())
 	eventsKey := s.eventsKey(sess.AppName(), sess.UserID(), sess.ID())
-	if err := s.client.RPush(ctx, eventsKey, data).Err(); err != nil {
-		return fmt.Errorf("failed to append event: %w", err)
-	}
-	s.client.Expire(ctx, eventsKey, s.ttl)
+	indexKey := s.sessionsIndexKey(sess.AppName(), sess.UserID())
 
-	key := s.sessionKey(sess.AppName(), sess.UserID(), sess.ID())
 	sessData, err := s.client.Get(ctx, key).Bytes()
 	if err != nil {
 		return fmt.Errorf("failed to get session for update: %w", err)
 	}
-
 	var storable storableSession
 	if err := json.Unmarshal(sessData, &storable); err != nil {
 		return fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
-	if storable.State == nil {
-		storable.State = make(map[string]any)
-	}
+	sessionDeltaAll := make(map[string]any)
 
 	state := sess.State()
 	if state != nil {
@@ -317,31 +1445,206 @@ func (s *RedisSessionService) AppendEvent(ctx context.Context, sess session.Sess
 			_, _, sessionOnly := extractSingleKey(k, v)
 			if sessionOnly != nil {
 				for sk, sv := range sessionOnly {
-					storable.State[sk] = sv
+					sessionDeltaAll[sk] = sv
 				}
 			}
 		}
 	}
 
+	var appKeys, userKeys, sessionKeys []string
 	if len(evt.Actions.StateDelta) > 0 {
 		appDelta, userDelta, sessionDelta := extractStateDeltas(evt.Actions.StateDelta)
 		s.updateAppState(ctx, sess.AppName(), appDelta)
 		s.updateUserState(ctx, sess.AppName(), sess.UserID(), userDelta)
 		for k, v := range sessionDelta {
-			storable.State[k] = v
+			sessionDeltaAll[k] = v
+		}
+		for k := range appDelta {
+			appKeys = append(appKeys, session.KeyPrefixApp+k)
 		}
+		for k := range userDelta {
+			userKeys = append(userKeys, session.KeyPrefixUser+k)
+		}
+	}
+	for k := range sessionDeltaAll {
+		sessionKeys = append(sessionKeys, k)
+	}
+
+	// The event RPUSH and the index/events TTL refresh are pipelined inside
+	// the script alongside the state merge, so a failed CAS attempt never
+	// leaves a dangling event with no corresponding state update.
+	if _, err := s.runSessionCAS(ctx, key, eventsKey, indexKey, storable.Version, sessionDeltaAll, eventData, s.renewPolicy != RenewManual); err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+
+	if s.searchEnabled {
+		s.indexEvent(ctx, sess.AppName(), sess.UserID(), sess.ID(), evt, eventData)
 	}
 
-	storable.LastUpdateTime = time.Now()
-	updatedData, err := json.Marshal(storable)
+	if len(appKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), appKeys, tierApp)
+	}
+	if len(userKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), userKeys, tierUser)
+	}
+	if len(sessionKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), sessionKeys, tierSession)
+	}
+
+	// Watch subscribers: the appended event itself always goes out on the
+	// session channel; app/user-tier deltas it also produced go out on
+	// those tiers' own channels for subscribers watching only that tier.
+	s.publishWatchEvent(ctx, s.watchSessionChannel(sess.AppName(), sess.UserID(), sess.ID()), watchMessage{
+		Kind:      WatchEventAppended,
+		AppName:   sess.AppName(),
+		UserID:    sess.UserID(),
+		SessionID: sess.ID(),
+		Tier:      tierSession,
+		Event:     evt,
+	})
+	if len(appKeys) > 0 {
+		s.publishWatchEvent(ctx, s.watchAppChannel(sess.AppName()), watchMessage{
+			Kind:        WatchEventStateChanged,
+			AppName:     sess.AppName(),
+			UserID:      sess.UserID(),
+			SessionID:   sess.ID(),
+			Tier:        tierApp,
+			ChangedKeys: appKeys,
+		})
+	}
+	if len(userKeys) > 0 {
+		s.publishWatchEvent(ctx, s.watchUserChannel(sess.AppName(), sess.UserID()), watchMessage{
+			Kind:        WatchEventStateChanged,
+			AppName:     sess.AppName(),
+			UserID:      sess.UserID(),
+			SessionID:   sess.ID(),
+			Tier:        tierUser,
+			ChangedKeys: userKeys,
+		})
+	}
+
+	s.maybeAutoCompact(ctx, sess.AppName(), sess.UserID(), sess.ID())
+
+	return nil
+}
+
+// AppendEventWithVersion appends evt only if the session's currently stored
+// version still equals expectedVersion, returning ErrConflict otherwise
+// instead of retrying the way AppendEvent does. Unlike AppendEvent, which
+// applies app/user-tier updates unconditionally before attempting the
+// session-tier CAS, AppendEventWithVersion checks the CAS first and only
+// applies tier updates once it succeeds, so a conflict leaves every tier of
+// state untouched. Callers should reread the session (to get its current
+// version) and retry on ErrConflict.
+func (s *RedisSessionService) AppendEventWithVersion(ctx context.Context, sess session.Session, evt *session.Event, expectedVersion int64) error {
+	if evt.Partial {
+		return nil
+	}
+
+	evt.Timestamp = time.Now()
+	if evt.ID == "" {
+		evt.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	trimTempStateDelta(evt)
+
+	eventData, err := json.Marshal(evt)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated session: %w", err)
+		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	if err := s.client.Set(ctx, key, updatedData, s.ttl).Err(); err != nil {
-		return fmt.Errorf("failed to update session: %w", err)
+	key := s.sessionKey(sess.AppName(), sess.UserID(), sess.ID())
+	eventsKey := s.eventsKey(sess.AppName(), sess.UserID(), sess.ID())
+	indexKey := s.sessionsIndexKey(sess.AppName(), sess.UserID())
+
+	sessionDeltaAll := make(map[string]any)
+	state := sess.State()
+	if state != nil {
+		for k, v := range state.All() {
+			_, _, sessionOnly := extractSingleKey(k, v)
+			for sk, sv := range sessionOnly {
+				sessionDeltaAll[sk] = sv
+			}
+		}
 	}
 
+	var appDelta, userDelta, sessionDelta map[string]any
+	if len(evt.Actions.StateDelta) > 0 {
+		appDelta, userDelta, sessionDelta = extractStateDeltas(evt.Actions.StateDelta)
+		for k, v := range sessionDelta {
+			sessionDeltaAll[k] = v
+		}
+	}
+
+	if _, err := s.runSessionCASOnce(ctx, key, eventsKey, indexKey, expectedVersion, sessionDeltaAll, eventData, s.renewPolicy != RenewManual); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return ErrConflict
+		}
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+
+	var appKeys, userKeys, sessionKeys []string
+	if len(appDelta) > 0 {
+		s.updateAppState(ctx, sess.AppName(), appDelta)
+		for k := range appDelta {
+			appKeys = append(appKeys, session.KeyPrefixApp+k)
+		}
+	}
+	if len(userDelta) > 0 {
+		s.updateUserState(ctx, sess.AppName(), sess.UserID(), userDelta)
+		for k := range userDelta {
+			userKeys = append(userKeys, session.KeyPrefixUser+k)
+		}
+	}
+	for k := range sessionDeltaAll {
+		sessionKeys = append(sessionKeys, k)
+	}
+
+	if s.searchEnabled {
+		s.indexEvent(ctx, sess.AppName(), sess.UserID(), sess.ID(), evt, eventData)
+	}
+
+	if len(appKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), appKeys, tierApp)
+	}
+	if len(userKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), userKeys, tierUser)
+	}
+	if len(sessionKeys) > 0 {
+		s.publishInvalidation(ctx, sess.AppName(), sess.UserID(), sess.ID(), sessionKeys, tierSession)
+	}
+
+	s.publishWatchEvent(ctx, s.watchSessionChannel(sess.AppName(), sess.UserID(), sess.ID()), watchMessage{
+		Kind:      WatchEventAppended,
+		AppName:   sess.AppName(),
+		UserID:    sess.UserID(),
+		SessionID: sess.ID(),
+		Tier:      tierSession,
+		Event:     evt,
+	})
+	if len(appKeys) > 0 {
+		s.publishWatchEvent(ctx, s.watchAppChannel(sess.AppName()), watchMessage{
+			Kind:        WatchEventStateChanged,
+			AppName:     sess.AppName(),
+			UserID:      sess.UserID(),
+			SessionID:   sess.ID(),
+			Tier:        tierApp,
+			ChangedKeys: appKeys,
+		})
+	}
+	if len(userKeys) > 0 {
+		s.publishWatchEvent(ctx, s.watchUserChannel(sess.AppName(), sess.UserID()), watchMessage{
+			Kind:        WatchEventStateChanged,
+			AppName:     sess.AppName(),
+			UserID:      sess.UserID(),
+			SessionID:   sess.ID(),
+			Tier:        tierUser,
+			ChangedKeys: userKeys,
+		})
+	}
+
+	s.maybeAutoCompact(ctx, sess.AppName(), sess.UserID(), sess.ID())
+
 	return nil
 }
 
@@ -498,8 +1801,17 @@ func trimTempStateDelta(evt *session.Event) {
 	evt.Actions.StateDelta = filtered
 }
 
-// Close closes the Redis connection.
+// Close stops the invalidation subscriber and the AutoRenew refresher (if
+// running), then closes the Redis connection.
 func (s *RedisSessionService) Close() error {
+	if s.subCancel != nil {
+		s.subCancel()
+		<-s.subDone
+	}
+	if s.renewCancel != nil {
+		s.renewCancel()
+		<-s.renewDone
+	}
 	return s.client.Close()
 }
 
@@ -511,6 +1823,16 @@ type storableSession struct {
 	UserID         string         `json:"user_id"`
 	State          map[string]any `json:"state"`
 	LastUpdateTime time.Time      `json:"last_update_time"`
+	// Version is bumped by sessionCASScript on every successful update. It
+	// lets AppendEvent and persistSessionState detect and retry concurrent
+	// writers instead of silently overwriting each other's StateDelta.
+	Version int64 `json:"version"`
+	// CompactedBefore is the zero time until Compact trims events from this
+	// session's event list. Once set, it's the timestamp of the newest
+	// event folded into State and removed from the list: a Get request
+	// with After at or before CompactedBefore can no longer be satisfied
+	// from individual events and returns ErrSnapshotOnly instead.
+	CompactedBefore time.Time `json:"compacted_before,omitempty"`
 }
 
 // redisSession implements session.Session.
@@ -550,32 +1872,39 @@ func (s *redisSession) toStorable() storableSession {
 // It holds the merged (all tiers) state in memory and routes writes to the
 // correct Redis key based on the key prefix.
 type redisState struct {
-	data    map[string]any
-	client  *redis.Client
-	key     string
-	ttl     time.Duration
-	service *RedisSessionService
-	appName string
-	userID  string
+	mu        sync.Mutex
+	data      map[string]any
+	client    redis.UniversalClient
+	key       string
+	ttl       time.Duration
+	service   *RedisSessionService
+	appName   string
+	userID    string
+	sessionID string
 }
 
-func newRedisState(initial map[string]any, client *redis.Client, key string, ttl time.Duration, service *RedisSessionService, appName, userID string) *redisState {
+func newRedisState(initial map[string]any, client redis.UniversalClient, key string, ttl time.Duration, service *RedisSessionService, appName, userID, sessionID string) *redisState {
 	data := make(map[string]any)
 	for k, v := range initial {
 		data[k] = v
 	}
-	return &redisState{
-		data:    data,
-		client:  client,
-		key:     key,
-		ttl:     ttl,
-		service: service,
-		appName: appName,
-		userID:  userID,
-	}
+	st := &redisState{
+		data:      data,
+		client:    client,
+		key:       key,
+		ttl:       ttl,
+		service:   service,
+		appName:   appName,
+		userID:    userID,
+		sessionID: sessionID,
+	}
+	service.trackState(key, st)
+	return st
 }
 
 func (s *redisState) Get(key string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	v, ok := s.data[key]
 	if !ok {
 		return nil, session.ErrStateKeyNotExist
@@ -584,7 +1913,9 @@ func (s *redisState) Get(key string) (any, error) {
 }
 
 func (s *redisState) Set(key string, value any) error {
+	s.mu.Lock()
 	s.data[key] = value
+	s.mu.Unlock()
 
 	ctx := context.Background()
 
@@ -600,6 +1931,7 @@ func (s *redisState) Set(key string, value any) error {
 		} else {
 			s.client.Persist(ctx, appKey)
 		}
+		s.service.publishInvalidation(ctx, s.appName, s.userID, s.sessionID, []string{key}, tierApp)
 		return nil
 	}
 
@@ -615,6 +1947,7 @@ func (s *redisState) Set(key string, value any) error {
 		} else {
 			s.client.Persist(ctx, userKey)
 		}
+		s.service.publishInvalidation(ctx, s.appName, s.userID, s.sessionID, []string{key}, tierUser)
 		return nil
 	}
 
@@ -622,9 +1955,27 @@ func (s *redisState) Set(key string, value any) error {
 		return nil
 	}
 
-	return s.persistSessionState()
+	if err := s.persistSessionState(); err != nil {
+		return err
+	}
+	s.service.publishInvalidation(ctx, s.appName, s.userID, s.sessionID, []string{key}, tierSession)
+	return nil
+}
+
+// invalidate drops changedKeys from the local cache, forcing the next Get to
+// observe whatever another node wrote to Redis (via a subsequent reload of
+// the owning session), instead of silently serving stale local data.
+func (s *redisState) invalidate(changedKeys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range changedKeys {
+		delete(s.data, key)
+	}
 }
 
+// persistSessionState merges the session-scoped (non-prefixed) entries of
+// s.data into the stored session via sessionCASScript, retrying on version
+// mismatch instead of overwriting a concurrent writer's state.
 func (s *redisState) persistSessionState() error {
 	ctx := context.Background()
 
@@ -641,20 +1992,16 @@ func (s *redisState) persistSessionState() error {
 		return fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
-	storable.State = make(map[string]any)
+	delta := make(map[string]any)
+	s.mu.Lock()
 	for k, v := range s.data {
 		if !strings.HasPrefix(k, session.KeyPrefixApp) && !strings.HasPrefix(k, session.KeyPrefixUser) && !strings.HasPrefix(k, session.KeyPrefixTemp) {
-			storable.State[k] = v
+			delta[k] = v
 		}
 	}
-	storable.LastUpdateTime = time.Now()
+	s.mu.Unlock()
 
-	updatedData, err := json.Marshal(storable)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated session: %w", err)
-	}
-
-	if err := s.client.Set(ctx, s.key, updatedData, s.ttl).Err(); err != nil {
+	if _, err := s.service.runSessionCAS(ctx, s.key, "", "", storable.Version, delta, nil, s.service.renewPolicy != RenewManual); err != nil {
 		return fmt.Errorf("failed to persist state: %w", err)
 	}
 
@@ -662,8 +2009,15 @@ func (s *redisState) persistSessionState() error {
 }
 
 func (s *redisState) All() iter.Seq2[string, any] {
+	s.mu.Lock()
+	snapshot := make(map[string]any, len(s.data))
+	for k, v := range s.data {
+		snapshot[k] = v
+	}
+	s.mu.Unlock()
+
 	return func(yield func(string, any) bool) {
-		for k, v := range s.data {
+		for k, v := range snapshot {
 			if !yield(k, v) {
 				return
 			}
@@ -676,13 +2030,13 @@ func (s *redisState) All() iter.Seq2[string, any] {
 // after Get applied NumRecentEvents / After filters) and loadFromRedis returns
 // it directly without re-fetching.
 type redisEvents struct {
-	client   *redis.Client
+	client   redis.UniversalClient
 	key      string
 	cached   []*session.Event
 	filtered bool
 }
 
-func newRedisEvents(events []*session.Event, client *redis.Client, key string) *redisEvents {
+func newRedisEvents(events []*session.Event, client redis.UniversalClient, key string) *redisEvents {
 	if events == nil {
 		events = make([]*session.Event, 0)
 	}
@@ -16,7 +16,9 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -831,3 +833,387 @@ func TestListMergesStateTiers(t *testing.T) {
 	}
 	t.Logf("✓ ListMergesStateTiers: all listed sessions see app:global")
 }
+
+func TestRenewExtendsTTL(t *testing.T) {
+	svc, err := NewRedisSessionService(RedisSessionServiceConfig{
+		Addr:        testRedisAddr,
+		TTL:         2 * time.Second,
+		RenewPolicy: RenewManual,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Redis session service: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+
+	if err := svc.Renew(ctx, &RenewRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()}); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+
+	ttl, err := svc.client.TTL(ctx, svc.sessionKey(app, "user-1", resp.Session.ID())).Result()
+	if err != nil {
+		t.Fatalf("TTL failed: %v", err)
+	}
+	if ttl < 1500*time.Millisecond {
+		t.Errorf("TTL after Renew = %v, want close to the full 2s TTL", ttl)
+	}
+}
+
+func TestRenewManualPreservesExpiryAcrossWrites(t *testing.T) {
+	svc, err := NewRedisSessionService(RedisSessionServiceConfig{
+		Addr:        testRedisAddr,
+		TTL:         10 * time.Second,
+		RenewPolicy: RenewManual,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Redis session service: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	key := svc.sessionKey(app, "user-1", resp.Session.ID())
+
+	time.Sleep(1200 * time.Millisecond)
+	ttlBefore, err := svc.client.TTL(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("TTL before append failed: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if err := svc.AppendEvent(ctx, getResp.Session, &session.Event{
+		ID:      "evt-1",
+		Author:  "user",
+		Actions: session.EventActions{StateDelta: map[string]any{"counter": float64(1)}},
+	}); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	ttlAfter, err := svc.client.TTL(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("TTL after append failed: %v", err)
+	}
+	if ttlAfter > ttlBefore {
+		t.Errorf("TTL after RenewManual write = %v, want <= pre-write TTL %v (KEEPTTL)", ttlAfter, ttlBefore)
+	}
+}
+
+func TestAutoRenewShutdownIsRaceFree(t *testing.T) {
+	svc, err := NewRedisSessionService(RedisSessionServiceConfig{
+		Addr:          testRedisAddr,
+		TTL:           10 * time.Second,
+		AutoRenew:     true,
+		RenewInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Redis session service: %v", err)
+	}
+
+	ctx := context.Background()
+	app := uniquePrefix(t)
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Give the refresher a couple of ticks against a live session before
+	// shutting it down, so Close races against an in-flight Renew.
+	time.Sleep(120 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		svc.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return: AutoRenew refresher shutdown is stuck")
+	}
+}
+
+func TestWatchObservesAppendFromAnotherClient(t *testing.T) {
+	writer := setupTestService(t)
+	reader := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := writer.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := reader.Watch(watchCtx, &WatchRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	// Subscribe is asynchronous: give the SUBSCRIBE command time to land
+	// before the writer publishes, or the notification would be missed.
+	time.Sleep(200 * time.Millisecond)
+
+	if err := writer.AppendEvent(ctx, resp.Session, &session.Event{
+		ID:      "evt-1",
+		Author:  "user",
+		Actions: session.EventActions{StateDelta: map[string]any{"step": float64(1)}},
+	}); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	select {
+	case watchEvt, ok := <-events:
+		if !ok {
+			t.Fatal("Watch channel closed before delivering the appended event")
+		}
+		if watchEvt.Kind != WatchEventAppended {
+			t.Errorf("Kind = %v, want WatchEventAppended", watchEvt.Kind)
+		}
+		if watchEvt.Event == nil || watchEvt.Event.ID != "evt-1" {
+			t.Errorf("Event = %+v, want ID evt-1", watchEvt.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not observe AppendEvent notification from another client")
+	}
+}
+
+func TestWatchReplaysPastEvents(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := svc.AppendEvent(ctx, resp.Session, &session.Event{ID: "evt-1", Author: "user"}); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := svc.Watch(watchCtx, &WatchRequest{
+		AppName:         app,
+		UserID:          "user-1",
+		SessionID:       resp.Session.ID(),
+		NumRecentEvents: 10,
+	})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	select {
+	case watchEvt, ok := <-events:
+		if !ok {
+			t.Fatal("Watch channel closed before replaying the past event")
+		}
+		if watchEvt.Event == nil || watchEvt.Event.ID != "evt-1" {
+			t.Errorf("replayed Event = %+v, want ID evt-1", watchEvt.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive replayed event")
+	}
+}
+
+func TestConcurrentAppendEventLosesNoEvents(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	const numAppenders = 20
+	var wg sync.WaitGroup
+	wg.Add(numAppenders)
+	for i := 0; i < numAppenders; i++ {
+		go func(i int) {
+			defer wg.Done()
+			evt := &session.Event{
+				ID:     fmt.Sprintf("evt-%d", i),
+				Author: "user",
+				Actions: session.EventActions{
+					StateDelta: map[string]any{fmt.Sprintf("key-%d", i): float64(i)},
+				},
+			}
+			if err := svc.AppendEvent(ctx, resp.Session, evt); err != nil {
+				t.Errorf("AppendEvent(%d) failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Session.Events().Len() != numAppenders {
+		t.Errorf("Events().Len() = %d, want %d: concurrent appenders lost events", got.Session.Events().Len(), numAppenders)
+	}
+	for i := 0; i < numAppenders; i++ {
+		v, err := got.Session.State().Get(fmt.Sprintf("key-%d", i))
+		if err != nil || v != float64(i) {
+			t.Errorf("State().Get(key-%d) = %v, %v, want %d, nil: concurrent state delta clobbered", i, v, err, i)
+		}
+	}
+}
+
+func TestAppendEventWithVersionConflict(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{
+		AppName: app,
+		UserID:  "user-1",
+		State:   map[string]any{"counter": float64(1)},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// A second writer bumps the session's version first.
+	if err := svc.AppendEvent(ctx, resp.Session, &session.Event{ID: "evt-other", Author: "user"}); err != nil {
+		t.Fatalf("AppendEvent (other writer) failed: %v", err)
+	}
+
+	err = svc.AppendEventWithVersion(ctx, resp.Session, &session.Event{
+		ID:     "evt-stale",
+		Author: "user",
+		Actions: session.EventActions{
+			StateDelta: map[string]any{"counter": float64(99)},
+		},
+	}, 0 /* resp.Session's version before the other writer's append */)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("AppendEventWithVersion(stale) = %v, want ErrConflict", err)
+	}
+
+	got, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Session.Events().Len() != 1 {
+		t.Errorf("Events().Len() = %d, want 1: conflicting append should not have been recorded", got.Session.Events().Len())
+	}
+	v, err := got.Session.State().Get("counter")
+	if err != nil || v != float64(1) {
+		t.Errorf("State().Get(counter) = %v, %v, want 1, nil: conflicting append should not have mutated state", v, err)
+	}
+}
+
+func TestCompactPreservesObservableState(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		evt := &session.Event{
+			ID:     fmt.Sprintf("evt-%d", i),
+			Author: "user",
+			Actions: session.EventActions{
+				StateDelta: map[string]any{fmt.Sprintf("key-%d", i): float64(i)},
+			},
+		}
+		if err := svc.AppendEvent(ctx, resp.Session, evt); err != nil {
+			t.Fatalf("AppendEvent(%d) failed: %v", i, err)
+		}
+	}
+
+	before, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get (before compaction) failed: %v", err)
+	}
+
+	compactResp, err := svc.Compact(ctx, &CompactRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID(), KeepRecentEvents: 3})
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if compactResp.EventsCompacted != 7 {
+		t.Errorf("EventsCompacted = %d, want 7", compactResp.EventsCompacted)
+	}
+
+	after, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get (after compaction) failed: %v", err)
+	}
+
+	if after.Session.Events().Len() != 3 {
+		t.Errorf("Events().Len() after compaction = %d, want 3", after.Session.Events().Len())
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		wantVal, wantErr := before.Session.State().Get(key)
+		gotVal, gotErr := after.Session.State().Get(key)
+		if wantErr != gotErr || wantVal != gotVal {
+			t.Errorf("State().Get(%s) after compaction = %v, %v, want %v, %v (unchanged)", key, gotVal, gotErr, wantVal, wantErr)
+		}
+	}
+}
+
+func TestGetAfterCompactionBoundaryReturnsErrSnapshotOnly(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	resp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	var timestamps []time.Time
+	for i := 0; i < 5; i++ {
+		if err := svc.AppendEvent(ctx, resp.Session, &session.Event{ID: fmt.Sprintf("evt-%d", i), Author: "user"}); err != nil {
+			t.Fatalf("AppendEvent(%d) failed: %v", i, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	for i := 0; i < got.Session.Events().Len(); i++ {
+		timestamps = append(timestamps, got.Session.Events().At(i).Timestamp)
+	}
+
+	if _, err := svc.Compact(ctx, &CompactRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID(), KeepRecentEvents: 2}); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// timestamps[2] is the last compacted event (5 events, keep 2 -> trim
+	// the first 3, indices 0..2), so it's at or before the boundary.
+	if _, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID(), After: timestamps[2]}); !errors.Is(err, ErrSnapshotOnly) {
+		t.Errorf("Get(After: compacted boundary) = %v, want ErrSnapshotOnly", err)
+	}
+
+	// A cutoff after the boundary, among the events compaction kept, is
+	// still satisfiable from the remaining events.
+	if _, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user-1", SessionID: resp.Session.ID(), After: timestamps[3]}); err != nil {
+		t.Errorf("Get(After: kept event) failed: %v, want nil", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// retryCAS reads key, hands its current value/version to mutate, and writes
+// mutate's result back with CompareAndSwap, retrying on ErrVersionMismatch
+// up to casMaxAttempts times with a small jitter between attempts. This is
+// the generic, single-key equivalent of RedisSessionService's
+// sessionCASScript retry loop (runSessionCAS): every StoreSessionService
+// read-modify-write (session state merge, event append, app/user state
+// merge) goes through it instead of a bare Get-then-Put.
+func retryCAS(ctx context.Context, backend Backend, key string, mutate func(current []byte, version int64, exists bool) ([]byte, error)) error {
+	for attempt := 0; attempt < casMaxAttempts; attempt++ {
+		current, version, err := backend.Get(ctx, key)
+		exists := true
+		switch {
+		case errors.Is(err, ErrNotFound):
+			exists = false
+			version = 0
+		case err != nil:
+			return fmt.Errorf("store: failed to read %s: %w", key, err)
+		}
+
+		next, err := mutate(current, version, exists)
+		if err != nil {
+			return err
+		}
+
+		err = backend.CompareAndSwap(ctx, key, version, next)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrVersionMismatch) {
+			return fmt.Errorf("store: failed to write %s: %w", key, err)
+		}
+		time.Sleep(time.Duration(rand.Intn(casJitterMs)+1) * time.Millisecond)
+	}
+
+	return fmt.Errorf("store: retryCAS exceeded %d attempts due to concurrent writers on %s", casMaxAttempts, key)
+}
@@ -0,0 +1,690 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+// StoreSessionServiceConfig holds configuration for StoreSessionService.
+type StoreSessionServiceConfig struct {
+	// Backend is the durable key/value store sessions are persisted to.
+	Backend Backend
+}
+
+// StoreSessionService implements session.Service on top of any Backend.
+// Unlike RedisSessionService, which pipelines a session's state merge, event
+// append, and TTL refresh into a single Lua script, StoreSessionService has
+// only single-key compare-and-swap to work with, so a session's state and
+// its event list are two independently CAS'd keys (see AppendEvent). Callers
+// needing atomic multi-key updates across replicas should prefer
+// session/redis; StoreSessionService targets backends (Consul, etcd) whose
+// native KV APIs don't offer a Lua-equivalent scripting hook.
+type StoreSessionService struct {
+	backend Backend
+}
+
+// NewStoreSessionService creates a new Backend-agnostic session service.
+func NewStoreSessionService(cfg StoreSessionServiceConfig) (*StoreSessionService, error) {
+	if cfg.Backend == nil {
+		return nil, fmt.Errorf("store: Backend is required")
+	}
+	return &StoreSessionService{backend: cfg.Backend}, nil
+}
+
+// Key helpers. Sessions are namespaced "session/<app>/<user>/<id>" so List
+// can enumerate a user's sessions with a single Backend.List prefix scan,
+// instead of RedisSessionService's separate SADD/SMEMBERS sessions index —
+// Consul and etcd are hierarchical KV stores, so prefix listing is already a
+// primitive both provide natively.
+func (s *StoreSessionService) sessionPrefix(appName, userID string) string {
+	return fmt.Sprintf("session/%s/%s/", appName, userID)
+}
+
+func (s *StoreSessionService) sessionKey(appName, userID, sessionID string) string {
+	return s.sessionPrefix(appName, userID) + sessionID
+}
+
+func (s *StoreSessionService) eventsKey(appName, userID, sessionID string) string {
+	return fmt.Sprintf("events/%s/%s/%s", appName, userID, sessionID)
+}
+
+func (s *StoreSessionService) appStateKey(appName string) string {
+	return fmt.Sprintf("appstate/%s", appName)
+}
+
+func (s *StoreSessionService) userStateKey(appName, userID string) string {
+	return fmt.Sprintf("userstate/%s/%s", appName, userID)
+}
+
+// Create creates a new session. It returns an error if a session with the
+// same ID already exists, matching RedisSessionService's behaviour.
+func (s *StoreSessionService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	key := s.sessionKey(req.AppName, req.UserID, sessionID)
+	if _, _, err := s.backend.Get(ctx, key); err == nil {
+		return nil, fmt.Errorf("session %s already exists", sessionID)
+	}
+
+	appDelta, userDelta, sessionDelta := extractStateDeltas(req.State)
+
+	appState, err := s.updateAppState(ctx, req.AppName, appDelta)
+	if err != nil {
+		return nil, err
+	}
+	userState, err := s.updateUserState(ctx, req.AppName, req.UserID, userDelta)
+	if err != nil {
+		return nil, err
+	}
+	mergedState := mergeStates(appState, userState, sessionDelta)
+
+	lastUpdateTime := time.Now()
+	storable := storableSession{
+		ID:             sessionID,
+		AppName:        req.AppName,
+		UserID:         req.UserID,
+		State:          sessionDelta,
+		LastUpdateTime: lastUpdateTime,
+	}
+	data, err := json.Marshal(storable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := s.backend.CompareAndSwap(ctx, key, 0, data); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+
+	sess := &storeSession{
+		id:             sessionID,
+		appName:        req.AppName,
+		userID:         req.UserID,
+		state:          newStoreState(mergedState, s, req.AppName, req.UserID, sessionID),
+		events:         newStoreEvents(nil, s, s.eventsKey(req.AppName, req.UserID, sessionID)),
+		lastUpdateTime: lastUpdateTime,
+	}
+	return &session.CreateResponse{Session: sess}, nil
+}
+
+// Get retrieves a session by ID.
+func (s *StoreSessionService) Get(ctx context.Context, req *session.GetRequest) (*session.GetResponse, error) {
+	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
+
+	data, _, err := s.backend.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %s", req.SessionID)
+	}
+
+	var storable storableSession
+	if err := json.Unmarshal(data, &storable); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	events := s.loadEvents(ctx, req.AppName, req.UserID, req.SessionID)
+
+	if req.NumRecentEvents > 0 && len(events) > req.NumRecentEvents {
+		events = events[len(events)-req.NumRecentEvents:]
+	}
+	if !req.After.IsZero() {
+		var filtered []*session.Event
+		for _, evt := range events {
+			if !evt.Timestamp.Before(req.After) {
+				filtered = append(filtered, evt)
+			}
+		}
+		events = filtered
+	}
+
+	appState, err := s.loadAppState(ctx, req.AppName)
+	if err != nil {
+		return nil, err
+	}
+	userState, err := s.loadUserState(ctx, req.AppName, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	mergedState := mergeStates(appState, userState, storable.State)
+
+	filtered := req.NumRecentEvents > 0 || !req.After.IsZero()
+
+	sess := &storeSession{
+		id:             storable.ID,
+		appName:        storable.AppName,
+		userID:         storable.UserID,
+		state:          newStoreState(mergedState, s, req.AppName, req.UserID, req.SessionID),
+		lastUpdateTime: storable.LastUpdateTime,
+	}
+	if filtered {
+		sess.events = newFilteredStoreEvents(events)
+	} else {
+		sess.events = newStoreEvents(events, s, s.eventsKey(req.AppName, req.UserID, req.SessionID))
+	}
+
+	return &session.GetResponse{Session: sess}, nil
+}
+
+// RenewRequest identifies a session whose backend keys should have their
+// expiry pushed out by TTL, mirroring RedisSessionService.RenewRequest.
+type RenewRequest struct {
+	AppName   string
+	UserID    string
+	SessionID string
+	TTL       time.Duration
+}
+
+// Renew extends the expiry of a session's backend keys by req.TTL, for
+// Backends that implement Lease. Unlike RedisSessionService, which always
+// has a configured session TTL to fall back on, StoreSessionService's
+// Backend interface has no notion of expiry at all, so callers must supply
+// the TTL explicitly. Returns ErrLeaseUnsupported if the configured Backend
+// doesn't implement Lease.
+func (s *StoreSessionService) Renew(ctx context.Context, req *RenewRequest) error {
+	lease, ok := s.backend.(Lease)
+	if !ok {
+		return ErrLeaseUnsupported
+	}
+
+	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
+	if err := lease.Renew(ctx, key, req.TTL); err != nil {
+		return fmt.Errorf("store: renewing %s: %w", key, err)
+	}
+
+	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
+	if err := lease.Renew(ctx, eventsKey, req.TTL); err != nil {
+		return fmt.Errorf("store: renewing %s: %w", eventsKey, err)
+	}
+	return nil
+}
+
+// List returns all sessions for a user.
+func (s *StoreSessionService) List(ctx context.Context, req *session.ListRequest) (*session.ListResponse, error) {
+	prefix := s.sessionPrefix(req.AppName, req.UserID)
+	keys, err := s.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var sessions []session.Session
+	for _, key := range keys {
+		sessionID := strings.TrimPrefix(key, prefix)
+		resp, err := s.Get(ctx, &session.GetRequest{
+			AppName:   req.AppName,
+			UserID:    req.UserID,
+			SessionID: sessionID,
+		})
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, resp.Session)
+	}
+
+	return &session.ListResponse{Sessions: sessions}, nil
+}
+
+// Delete removes a session.
+func (s *StoreSessionService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	key := s.sessionKey(req.AppName, req.UserID, req.SessionID)
+	eventsKey := s.eventsKey(req.AppName, req.UserID, req.SessionID)
+
+	if err := s.backend.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if err := s.backend.Delete(ctx, eventsKey); err != nil {
+		return fmt.Errorf("failed to delete session events: %w", err)
+	}
+	return nil
+}
+
+// AppendEvent appends an event to a session and applies its StateDelta to
+// the persisted session state, matching the behaviour of RedisSessionService
+// and the canonical ADK session services. The session-state merge and the
+// event-list append are two separate retryCAS calls (Backend exposes no
+// multi-key transaction), so a crash between them can leave an event
+// recorded without its StateDelta applied, or vice versa — a narrower
+// atomicity guarantee than RedisSessionService's single Lua script.
+func (s *StoreSessionService) AppendEvent(ctx context.Context, sess session.Session, evt *session.Event) error {
+	if evt.Partial {
+		return nil
+	}
+
+	evt.Timestamp = time.Now()
+	if evt.ID == "" {
+		evt.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	trimTempStateDelta(evt)
+
+	sessionDeltaAll := make(map[string]any)
+
+	state := sess.State()
+	if state != nil {
+		for k, v := range state.All() {
+			_, _, sessionOnly := extractSingleKey(k, v)
+			if sessionOnly != nil {
+				for sk, sv := range sessionOnly {
+					sessionDeltaAll[sk] = sv
+				}
+			}
+		}
+	}
+
+	if len(evt.Actions.StateDelta) > 0 {
+		appDelta, userDelta, sessionDelta := extractStateDeltas(evt.Actions.StateDelta)
+		if _, err := s.updateAppState(ctx, sess.AppName(), appDelta); err != nil {
+			return err
+		}
+		if _, err := s.updateUserState(ctx, sess.AppName(), sess.UserID(), userDelta); err != nil {
+			return err
+		}
+		for k, v := range sessionDelta {
+			sessionDeltaAll[k] = v
+		}
+	}
+
+	key := s.sessionKey(sess.AppName(), sess.UserID(), sess.ID())
+	if len(sessionDeltaAll) > 0 {
+		if err := s.mergeSessionState(ctx, key, sessionDeltaAll); err != nil {
+			return fmt.Errorf("failed to persist state: %w", err)
+		}
+	}
+
+	eventsKey := s.eventsKey(sess.AppName(), sess.UserID(), sess.ID())
+	if err := s.appendEventRecord(ctx, eventsKey, evt); err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+
+	return nil
+}
+
+// mergeSessionState merges delta into the stored session's State field and
+// bumps LastUpdateTime, retrying on concurrent writers via retryCAS.
+func (s *StoreSessionService) mergeSessionState(ctx context.Context, key string, delta map[string]any) error {
+	return retryCAS(ctx, s.backend, key, func(current []byte, version int64, exists bool) ([]byte, error) {
+		var storable storableSession
+		if exists {
+			if err := json.Unmarshal(current, &storable); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+			}
+		}
+		if storable.State == nil {
+			storable.State = make(map[string]any)
+		}
+		for k, v := range delta {
+			storable.State[k] = v
+		}
+		storable.LastUpdateTime = time.Now()
+		return json.Marshal(storable)
+	})
+}
+
+// appendEventRecord appends evt to the JSON array stored at eventsKey,
+// retrying on concurrent writers via retryCAS.
+func (s *StoreSessionService) appendEventRecord(ctx context.Context, eventsKey string, evt *session.Event) error {
+	return retryCAS(ctx, s.backend, eventsKey, func(current []byte, version int64, exists bool) ([]byte, error) {
+		var events []*session.Event
+		if exists {
+			if err := json.Unmarshal(current, &events); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+			}
+		}
+		events = append(events, evt)
+		return json.Marshal(events)
+	})
+}
+
+// loadEvents loads the full event history for a session, returning nil if
+// none has been recorded yet.
+func (s *StoreSessionService) loadEvents(ctx context.Context, appName, userID, sessionID string) []*session.Event {
+	data, _, err := s.backend.Get(ctx, s.eventsKey(appName, userID, sessionID))
+	if err != nil {
+		return nil
+	}
+	var events []*session.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil
+	}
+	return events
+}
+
+// updateAppState merges delta into app-scoped state and returns the full
+// resulting app state.
+func (s *StoreSessionService) updateAppState(ctx context.Context, appName string, delta map[string]any) (map[string]any, error) {
+	if len(delta) == 0 {
+		return s.loadAppState(ctx, appName)
+	}
+	if err := s.mergeTierState(ctx, s.appStateKey(appName), delta); err != nil {
+		return nil, fmt.Errorf("failed to update app state: %w", err)
+	}
+	return s.loadAppState(ctx, appName)
+}
+
+// updateUserState merges delta into user-scoped state and returns the full
+// resulting user state.
+func (s *StoreSessionService) updateUserState(ctx context.Context, appName, userID string, delta map[string]any) (map[string]any, error) {
+	if len(delta) == 0 {
+		return s.loadUserState(ctx, appName, userID)
+	}
+	if err := s.mergeTierState(ctx, s.userStateKey(appName, userID), delta); err != nil {
+		return nil, fmt.Errorf("failed to update user state: %w", err)
+	}
+	return s.loadUserState(ctx, appName, userID)
+}
+
+// mergeTierState merges delta into the map[string]any JSON blob stored at
+// key, retrying on concurrent writers via retryCAS.
+func (s *StoreSessionService) mergeTierState(ctx context.Context, key string, delta map[string]any) error {
+	return retryCAS(ctx, s.backend, key, func(current []byte, version int64, exists bool) ([]byte, error) {
+		state := make(map[string]any)
+		if exists {
+			if err := json.Unmarshal(current, &state); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal state: %w", err)
+			}
+		}
+		for k, v := range delta {
+			state[k] = v
+		}
+		return json.Marshal(state)
+	})
+}
+
+func (s *StoreSessionService) loadAppState(ctx context.Context, appName string) (map[string]any, error) {
+	return s.loadTierState(ctx, s.appStateKey(appName))
+}
+
+func (s *StoreSessionService) loadUserState(ctx context.Context, appName, userID string) (map[string]any, error) {
+	return s.loadTierState(ctx, s.userStateKey(appName, userID))
+}
+
+func (s *StoreSessionService) loadTierState(ctx context.Context, key string) (map[string]any, error) {
+	data, _, err := s.backend.Get(ctx, key)
+	if err != nil {
+		return make(map[string]any), nil
+	}
+	state := make(map[string]any)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state at %s: %w", key, err)
+	}
+	return state, nil
+}
+
+// Close releases the underlying Backend.
+func (s *StoreSessionService) Close() error {
+	return s.backend.Close()
+}
+
+// storableSession is the JSON-serializable representation of a session.
+// State only contains session-scoped keys (no app: or user: prefixed keys).
+type storableSession struct {
+	ID             string         `json:"id"`
+	AppName        string         `json:"app_name"`
+	UserID         string         `json:"user_id"`
+	State          map[string]any `json:"state"`
+	LastUpdateTime time.Time      `json:"last_update_time"`
+}
+
+// extractStateDeltas splits a flat state map into three separate maps based
+// on key prefixes, mirroring RedisSessionService's helper of the same name
+// and google.golang.org/adk/internal/sessionutils.ExtractStateDeltas. Keys
+// with the "temp:" prefix are discarded.
+func extractStateDeltas(delta map[string]any) (appDelta, userDelta, sessionDelta map[string]any) {
+	appDelta = make(map[string]any)
+	userDelta = make(map[string]any)
+	sessionDelta = make(map[string]any)
+
+	if delta == nil {
+		return appDelta, userDelta, sessionDelta
+	}
+
+	for key, value := range delta {
+		if cleanKey, found := strings.CutPrefix(key, session.KeyPrefixApp); found {
+			appDelta[cleanKey] = value
+		} else if cleanKey, found := strings.CutPrefix(key, session.KeyPrefixUser); found {
+			userDelta[cleanKey] = value
+		} else if !strings.HasPrefix(key, session.KeyPrefixTemp) {
+			sessionDelta[key] = value
+		}
+	}
+	return appDelta, userDelta, sessionDelta
+}
+
+// extractSingleKey classifies a single key-value pair into its state tier.
+// Returns non-nil maps only for the tier the key belongs to. Used when
+// syncing in-memory session state back to the storable (session-scoped
+// only).
+func extractSingleKey(key string, value any) (app, user, sessionOnly map[string]any) {
+	if strings.HasPrefix(key, session.KeyPrefixApp) || strings.HasPrefix(key, session.KeyPrefixUser) || strings.HasPrefix(key, session.KeyPrefixTemp) {
+		return nil, nil, nil
+	}
+	return nil, nil, map[string]any{key: value}
+}
+
+// mergeStates combines app, user, and session state maps into a single flat
+// map, re-adding the appropriate prefixes, mirroring RedisSessionService's
+// helper of the same name.
+func mergeStates(appState, userState, sessionState map[string]any) map[string]any {
+	totalSize := len(appState) + len(userState) + len(sessionState)
+	merged := make(map[string]any, totalSize)
+
+	for k, v := range sessionState {
+		merged[k] = v
+	}
+	for k, v := range appState {
+		merged[session.KeyPrefixApp+k] = v
+	}
+	for k, v := range userState {
+		merged[session.KeyPrefixUser+k] = v
+	}
+	return merged
+}
+
+// trimTempStateDelta removes keys with the "temp:" prefix from the event's
+// StateDelta. These keys are meant to be ephemeral (live only for the
+// current invocation) and must not be persisted, matching the ADK's
+// trimTempDeltaState and RedisSessionService's helper of the same name.
+func trimTempStateDelta(evt *session.Event) {
+	if len(evt.Actions.StateDelta) == 0 {
+		return
+	}
+	filtered := make(map[string]any, len(evt.Actions.StateDelta))
+	for k, v := range evt.Actions.StateDelta {
+		if !strings.HasPrefix(k, session.KeyPrefixTemp) {
+			filtered[k] = v
+		}
+	}
+	evt.Actions.StateDelta = filtered
+}
+
+// storeSession implements session.Session.
+type storeSession struct {
+	id             string
+	appName        string
+	userID         string
+	state          *storeState
+	events         *storeEvents
+	lastUpdateTime time.Time
+}
+
+func (s *storeSession) ID() string                { return s.id }
+func (s *storeSession) AppName() string           { return s.appName }
+func (s *storeSession) UserID() string            { return s.userID }
+func (s *storeSession) State() session.State      { return s.state }
+func (s *storeSession) Events() session.Events    { return s.events }
+func (s *storeSession) LastUpdateTime() time.Time { return s.lastUpdateTime }
+
+// storeState implements session.State, routing writes to the correct
+// Backend key based on the key's tier prefix, mirroring redisState.
+type storeState struct {
+	mu        sync.Mutex
+	data      map[string]any
+	service   *StoreSessionService
+	appName   string
+	userID    string
+	sessionID string
+}
+
+func newStoreState(initial map[string]any, service *StoreSessionService, appName, userID, sessionID string) *storeState {
+	data := make(map[string]any)
+	for k, v := range initial {
+		data[k] = v
+	}
+	return &storeState{
+		data:      data,
+		service:   service,
+		appName:   appName,
+		userID:    userID,
+		sessionID: sessionID,
+	}
+}
+
+func (s *storeState) Get(key string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return nil, session.ErrStateKeyNotExist
+	}
+	return v, nil
+}
+
+func (s *storeState) Set(key string, value any) error {
+	s.mu.Lock()
+	s.data[key] = value
+	s.mu.Unlock()
+
+	ctx := context.Background()
+
+	if cleanKey, found := strings.CutPrefix(key, session.KeyPrefixApp); found {
+		_, err := s.service.updateAppState(ctx, s.appName, map[string]any{cleanKey: value})
+		return err
+	}
+
+	if cleanKey, found := strings.CutPrefix(key, session.KeyPrefixUser); found {
+		_, err := s.service.updateUserState(ctx, s.appName, s.userID, map[string]any{cleanKey: value})
+		return err
+	}
+
+	if strings.HasPrefix(key, session.KeyPrefixTemp) {
+		return nil
+	}
+
+	sessionKey := s.service.sessionKey(s.appName, s.userID, s.sessionID)
+	return s.service.mergeSessionState(ctx, sessionKey, map[string]any{key: value})
+}
+
+func (s *storeState) All() iter.Seq2[string, any] {
+	s.mu.Lock()
+	snapshot := make(map[string]any, len(s.data))
+	for k, v := range s.data {
+		snapshot[k] = v
+	}
+	s.mu.Unlock()
+
+	return func(yield func(string, any) bool) {
+		for k, v := range snapshot {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// storeEvents implements session.Events with live Backend reads. When
+// filtered is true, the cached slice is the authoritative source (e.g.
+// after Get applied NumRecentEvents / After filters) and loadFromBackend
+// returns it directly without re-fetching, mirroring redisEvents.
+type storeEvents struct {
+	service  *StoreSessionService
+	key      string
+	cached   []*session.Event
+	filtered bool
+}
+
+func newStoreEvents(events []*session.Event, service *StoreSessionService, key string) *storeEvents {
+	if events == nil {
+		events = make([]*session.Event, 0)
+	}
+	return &storeEvents{
+		service: service,
+		key:     key,
+		cached:  events,
+	}
+}
+
+func newFilteredStoreEvents(events []*session.Event) *storeEvents {
+	if events == nil {
+		events = make([]*session.Event, 0)
+	}
+	return &storeEvents{
+		cached:   events,
+		filtered: true,
+	}
+}
+
+func (e *storeEvents) loadFromBackend() []*session.Event {
+	if e.filtered || e.service == nil || e.key == "" {
+		return e.cached
+	}
+
+	data, _, err := e.service.backend.Get(context.Background(), e.key)
+	if err != nil {
+		return e.cached
+	}
+
+	var events []*session.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return e.cached
+	}
+	return events
+}
+
+func (e *storeEvents) All() iter.Seq[*session.Event] {
+	events := e.loadFromBackend()
+	return func(yield func(*session.Event) bool) {
+		for _, evt := range events {
+			if !yield(evt) {
+				return
+			}
+		}
+	}
+}
+
+func (e *storeEvents) Len() int {
+	return len(e.loadFromBackend())
+}
+
+func (e *storeEvents) At(i int) *session.Event {
+	events := e.loadFromBackend()
+	if i < 0 || i >= len(events) {
+		return nil
+	}
+	return events[i]
+}
+
+// Ensure interfaces are implemented
+var _ session.Service = (*StoreSessionService)(nil)
+var _ session.Session = (*storeSession)(nil)
+var _ session.State = (*storeState)(nil)
+var _ session.Events = (*storeEvents)(nil)
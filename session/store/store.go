@@ -0,0 +1,99 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store extracts the storage contract RedisSessionService
+// implements (google.golang.org/adk/session.Service, with tiered app:/
+// user:/temp: state routing) into a backend-agnostic Backend interface, so
+// the same StoreSessionService can sit on top of any key/value system that
+// supports a read-modify-write compare-and-swap, not just Redis. Backends
+// under session/consul and session/etcd implement Backend against their
+// respective HTTP APIs. RedisSessionService itself predates this package
+// and keeps its Lua-script-based implementation, which gets atomic
+// multi-key pipelining Backend's single-key contract can't express.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Backend.Get when key doesn't exist.
+var ErrNotFound = errors.New("store: key not found")
+
+// ErrVersionMismatch is returned by Backend.CompareAndSwap when
+// expectedVersion no longer matches key's current version — another writer
+// updated it first.
+var ErrVersionMismatch = errors.New("store: version mismatch")
+
+// Backend is the minimal durable key/value contract StoreSessionService
+// needs to provide full session.Service semantics: tiered state routing,
+// partial-event skip, temp: key drop, and NumRecentEvents/After event
+// filtering all live in StoreSessionService itself, layered on top of
+// plain versioned reads, writes, and prefix listing.
+type Backend interface {
+	// Get returns the raw value stored at key and its current version, or
+	// ErrNotFound if key doesn't exist. version is backend-specific
+	// (Consul's ModifyIndex, etcd's mod_revision) and is only meaningful
+	// as the expectedVersion argument of a later CompareAndSwap on the
+	// same key.
+	Get(ctx context.Context, key string) (value []byte, version int64, err error)
+
+	// CompareAndSwap writes value to key only if key's current version
+	// equals expectedVersion, or key doesn't exist yet and expectedVersion
+	// is 0. Returns ErrVersionMismatch otherwise, so callers can reread and
+	// retry the same way RedisSessionService's sessionCASScript reports a
+	// version mismatch for its caller to retry.
+	CompareAndSwap(ctx context.Context, key string, expectedVersion int64, value []byte) error
+
+	// Delete removes key. Deleting an absent key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns every key stored under prefix, in no particular order.
+	// StoreSessionService uses this to enumerate a user's sessions
+	// directly from the session key namespace instead of maintaining a
+	// separate index set the way RedisSessionService's sessions index
+	// does — prefix listing is a primitive every KV store worth building a
+	// Backend for already provides natively.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Close releases any connections or background goroutines held by the
+	// backend.
+	Close() error
+}
+
+// casMaxAttempts and casJitterMs bound and space out CompareAndSwap retries
+// in retryCAS, mirroring RedisSessionService's casMaxAttempts/casJitterMs
+// constants for the same reason: bound the retry loop, and avoid a
+// thundering herd of retrying writers all waking up at once.
+const (
+	casMaxAttempts = 5
+	casJitterMs    = 20
+)
+
+// Lease is an optional capability a Backend may implement to support TTL
+// renewal of a key without a full read/write cycle, mirroring
+// RedisSessionService.Renew. Backends with no natural notion of per-key
+// expiry (a plain Consul KV entry, for instance) can simply not implement
+// it: StoreSessionService.Renew reports ErrLeaseUnsupported for any Backend
+// that doesn't.
+type Lease interface {
+	// Renew pushes key's expiry out to ttl from now. Renewing a key with no
+	// expiry set is a no-op, not an error.
+	Renew(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// ErrLeaseUnsupported is returned by StoreSessionService.Renew when the
+// configured Backend doesn't implement Lease.
+var ErrLeaseUnsupported = errors.New("store: backend does not support lease renewal")
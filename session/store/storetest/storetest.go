@@ -0,0 +1,386 @@
+// Copyright 2025 achetronic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storetest is a parameterized conformance suite for store.Backend
+// implementations. Each backend package (session/consul, session/etcd)
+// calls storetest.Run from its own test file with a factory that builds a
+// fresh Backend against a real local instance of that backend, the same
+// convention session/redis's tests use against a real local Redis.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+
+	adkstore "github.com/achetronic/adk-utils-go/session/store"
+)
+
+// Run exercises newBackend against the full StoreSessionService behavior
+// contract: tiered state routing, partial-event skip, temp: key drop, and
+// NumRecentEvents/After event filtering. newBackend must return a Backend
+// backed by a fresh, empty namespace for every call, so subtests don't see
+// each other's data.
+func Run(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newBackend) })
+	t.Run("CreateDuplicate", func(t *testing.T) { testCreateDuplicate(t, newBackend) })
+	t.Run("List", func(t *testing.T) { testList(t, newBackend) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newBackend) })
+	t.Run("AppendEvent", func(t *testing.T) { testAppendEvent(t, newBackend) })
+	t.Run("AppendEventPartialIgnored", func(t *testing.T) { testAppendEventPartialIgnored(t, newBackend) })
+	t.Run("TempStateNotPersisted", func(t *testing.T) { testTempStateNotPersisted(t, newBackend) })
+	t.Run("AppStateTierSharedAcrossSessions", func(t *testing.T) { testAppStateTierSharedAcrossSessions(t, newBackend) })
+	t.Run("UserStateTierIsolatedBetweenUsers", func(t *testing.T) { testUserStateTierIsolatedBetweenUsers(t, newBackend) })
+	t.Run("SessionStateTierIsolated", func(t *testing.T) { testSessionStateTierIsolated(t, newBackend) })
+	t.Run("GetNumRecentEvents", func(t *testing.T) { testGetNumRecentEvents(t, newBackend) })
+	t.Run("GetAfterTimestamp", func(t *testing.T) { testGetAfterTimestamp(t, newBackend) })
+	t.Run("RenewWithoutLease", func(t *testing.T) { testRenewWithoutLease(t, newBackend) })
+}
+
+func newService(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) *adkstore.StoreSessionService {
+	t.Helper()
+	svc, err := adkstore.NewStoreSessionService(adkstore.StoreSessionServiceConfig{Backend: newBackend(t)})
+	if err != nil {
+		t.Fatalf("NewStoreSessionService: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func uniquePrefix(t *testing.T) string {
+	t.Helper()
+	return fmt.Sprintf("test_%d", time.Now().UnixNano())
+}
+
+func testCreateAndGet(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{
+		AppName: app,
+		UserID:  "user1",
+		State:   map[string]any{"foo": "bar"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{
+		AppName:   app,
+		UserID:    "user1",
+		SessionID: createResp.Session.ID(),
+	})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	v, err := getResp.Session.State().Get("foo")
+	if err != nil || v != "bar" {
+		t.Errorf("State().Get(foo) = %v, %v, want bar, nil", v, err)
+	}
+}
+
+func testCreateDuplicate(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", SessionID: "s1"}); err != nil {
+		t.Fatalf("first Create: %v", err)
+	}
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", SessionID: "s1"}); err == nil {
+		t.Error("second Create with same SessionID = nil error, want error")
+	}
+}
+
+func testList(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", SessionID: id}); err != nil {
+			t.Fatalf("Create(%s): %v", id, err)
+		}
+	}
+
+	listResp, err := svc.List(ctx, &session.ListRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listResp.Sessions) != 3 {
+		t.Errorf("List returned %d sessions, want 3", len(listResp.Sessions))
+	}
+}
+
+func testDelete(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := svc.Delete(ctx, &session.DeleteRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID()}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID()}); err == nil {
+		t.Error("Get after Delete = nil error, want error")
+	}
+}
+
+func testAppendEvent(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	evt := &session.Event{
+		ID:      "inv1",
+		Author:  "user",
+		Actions: session.EventActions{StateDelta: map[string]any{"counter": 1}},
+	}
+	if err := svc.AppendEvent(ctx, createResp.Session, evt); err != nil {
+		t.Fatalf("AppendEvent: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if getResp.Session.Events().Len() != 1 {
+		t.Errorf("Events().Len() = %d, want 1", getResp.Session.Events().Len())
+	}
+	if v, _ := getResp.Session.State().Get("counter"); v != float64(1) {
+		t.Errorf("State().Get(counter) = %v, want 1 (as float64 after JSON round-trip)", v)
+	}
+}
+
+func testAppendEventPartialIgnored(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := svc.AppendEvent(ctx, createResp.Session, &session.Event{LLMResponse: model.LLMResponse{Partial: true}}); err != nil {
+		t.Fatalf("AppendEvent(partial): %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if getResp.Session.Events().Len() != 0 {
+		t.Errorf("Events().Len() after partial event = %d, want 0", getResp.Session.Events().Len())
+	}
+}
+
+func testTempStateNotPersisted(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	evt := &session.Event{
+		Actions: session.EventActions{StateDelta: map[string]any{
+			session.KeyPrefixTemp + "scratch": "gone",
+			"kept":                            "stays",
+		}},
+	}
+	if err := svc.AppendEvent(ctx, createResp.Session, evt); err != nil {
+		t.Fatalf("AppendEvent: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := getResp.Session.State().Get(session.KeyPrefixTemp + "scratch"); err == nil {
+		t.Error("temp: key survived a reload, want it dropped")
+	}
+	if v, _ := getResp.Session.State().Get("kept"); v != "stays" {
+		t.Errorf("State().Get(kept) = %v, want stays", v)
+	}
+}
+
+func testAppStateTierSharedAcrossSessions(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", State: map[string]any{session.KeyPrefixApp + "shared": "v1"}}); err != nil {
+		t.Fatalf("Create s1: %v", err)
+	}
+	s2, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user2"})
+	if err != nil {
+		t.Fatalf("Create s2: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user2", SessionID: s2.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get s2: %v", err)
+	}
+	if v, _ := getResp.Session.State().Get(session.KeyPrefixApp + "shared"); v != "v1" {
+		t.Errorf("app-scoped state on a different user's session = %v, want v1", v)
+	}
+}
+
+func testUserStateTierIsolatedBetweenUsers(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", State: map[string]any{session.KeyPrefixUser + "pref": "dark-mode"}}); err != nil {
+		t.Fatalf("Create user1 session: %v", err)
+	}
+	s2, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user2"})
+	if err != nil {
+		t.Fatalf("Create user2 session: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user2", SessionID: s2.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := getResp.Session.State().Get(session.KeyPrefixUser + "pref"); err == nil {
+		t.Error("user2 saw user1's user-scoped state, want isolated")
+	}
+}
+
+func testSessionStateTierIsolated(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	if _, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1", State: map[string]any{"only_in_s1": true}}); err != nil {
+		t.Fatalf("Create s1: %v", err)
+	}
+	s2, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create s2: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: s2.Session.ID()})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := getResp.Session.State().Get("only_in_s1"); err == nil {
+		t.Error("s2 saw s1's session-scoped state, want isolated")
+	}
+}
+
+func testGetNumRecentEvents(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		evt := &session.Event{ID: fmt.Sprintf("inv%d", i)}
+		if err := svc.AppendEvent(ctx, createResp.Session, evt); err != nil {
+			t.Fatalf("AppendEvent %d: %v", i, err)
+		}
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID(), NumRecentEvents: 2})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if getResp.Session.Events().Len() != 2 {
+		t.Errorf("Events().Len() with NumRecentEvents=2 = %d, want 2", getResp.Session.Events().Len())
+	}
+	if getResp.Session.Events().At(1).ID != "inv4" {
+		t.Errorf("last recent event = %q, want inv4", getResp.Session.Events().At(1).ID)
+	}
+}
+
+func testGetAfterTimestamp(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.AppendEvent(ctx, createResp.Session, &session.Event{ID: "before"}); err != nil {
+		t.Fatalf("AppendEvent: %v", err)
+	}
+
+	cutoff := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	if err := svc.AppendEvent(ctx, createResp.Session, &session.Event{ID: "after"}); err != nil {
+		t.Fatalf("AppendEvent: %v", err)
+	}
+
+	getResp, err := svc.Get(ctx, &session.GetRequest{AppName: app, UserID: "user1", SessionID: createResp.Session.ID(), After: cutoff})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if getResp.Session.Events().Len() != 1 || getResp.Session.Events().At(0).ID != "after" {
+		t.Errorf("Events after cutoff = len %d, want 1 event named \"after\"", getResp.Session.Events().Len())
+	}
+}
+
+// testRenewWithoutLease covers the common case across this suite's current
+// backends (Consul, etcd): neither implements store.Lease, so Renew must
+// report store.ErrLeaseUnsupported rather than silently doing nothing. A
+// future Lease-capable Backend would need its own dedicated TTL-extension
+// test alongside its Backend-specific test file, the way session/redis
+// tests RedisSessionService.Renew directly.
+func testRenewWithoutLease(t *testing.T, newBackend func(t *testing.T) adkstore.Backend) {
+	svc := newService(t, newBackend)
+	ctx := context.Background()
+	app := uniquePrefix(t)
+
+	createResp, err := svc.Create(ctx, &session.CreateRequest{AppName: app, UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	err = svc.Renew(ctx, &adkstore.RenewRequest{
+		AppName:   app,
+		UserID:    "user1",
+		SessionID: createResp.Session.ID(),
+		TTL:       time.Minute,
+	})
+	if !errors.Is(err, adkstore.ErrLeaseUnsupported) {
+		t.Errorf("Renew on a non-Lease Backend = %v, want ErrLeaseUnsupported", err)
+	}
+}
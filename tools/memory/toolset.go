@@ -16,8 +16,10 @@ package memory
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"iter"
+	"reflect"
 	"time"
 
 	"google.golang.org/adk/agent"
@@ -36,10 +38,108 @@ type MemoryService interface {
 	Search(ctx context.Context, req *memory.SearchRequest) (*memory.SearchResponse, error)
 }
 
+// Deleter is an optional capability a MemoryService implementation can
+// provide to support the forget_memory tool. It's a separate interface,
+// not a method on MemoryService itself, because not every backend can
+// remove a single memory in isolation — some only ever ingest whole
+// sessions (see AddSession) and have no notion of deleting one entry out
+// of one.
+type Deleter interface {
+	DeleteMemory(ctx context.Context, appName, userID, memoryID string) error
+}
+
+// AttributeSchema describes the Attributes a structured memory entry of
+// one Kind must satisfy (see SaveArgs), checked by saveToMemory before the
+// entry is persisted. This is intentionally minimal rather than a full
+// JSON Schema implementation — no such library is vendored in this repo —
+// covering what the built-in Kinds in DefaultMemorySchemas actually need:
+// required keys and a basic type check.
+type AttributeSchema struct {
+	// Required lists attribute keys that must be present.
+	Required []string
+	// Types optionally constrains the type of named attributes, once
+	// decoded from JSON: "string", "number", "bool", "array", or "object".
+	Types map[string]string
+}
+
+// Validate reports an error if attrs is missing a Required key or has a
+// value whose type doesn't match Types.
+func (s AttributeSchema) Validate(attrs map[string]any) error {
+	for _, key := range s.Required {
+		if _, ok := attrs[key]; !ok {
+			return fmt.Errorf("missing required attribute %q", key)
+		}
+	}
+	for key, wantType := range s.Types {
+		val, ok := attrs[key]
+		if !ok {
+			continue
+		}
+		if !jsonValueHasType(val, wantType) {
+			return fmt.Errorf("attribute %q must be of type %s", key, wantType)
+		}
+	}
+	return nil
+}
+
+// jsonValueHasType reports whether val — as decoded by encoding/json into
+// an any — matches wantType.
+func jsonValueHasType(val any, wantType string) bool {
+	switch wantType {
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "bool":
+		_, ok := val.(bool)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+// DefaultMemorySchemas returns AttributeSchemas for the common memory
+// Kinds this package anticipates — preference, fact, reminder, and
+// contact — for a caller to pass to ToolsetConfig.Schemas as-is, or copy
+// and adapt for their own Kinds.
+func DefaultMemorySchemas() map[string]AttributeSchema {
+	return map[string]AttributeSchema{
+		"preference": {Required: []string{"topic"}, Types: map[string]string{"topic": "string"}},
+		"fact":       {Required: []string{"subject"}, Types: map[string]string{"subject": "string"}},
+		"reminder":   {Required: []string{"due"}, Types: map[string]string{"due": "string"}},
+		"contact":    {Required: []string{"name"}, Types: map[string]string{"name": "string"}},
+	}
+}
+
+// StructuredEntry is the JSON payload persisted as an event's Content text
+// for a save_to_memory call that supplies Kind, Attributes, TTL, or
+// Confidence — as opposed to the plain free-form text stored for calls
+// that don't. searchMemory parses it back out of the stored text to
+// support Kind/Attributes filtering and expiry, in addition to whatever
+// semantic matching the MemoryService itself does.
+type StructuredEntry struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind,omitempty"`
+	Content    string         `json:"content"`
+	Category   string         `json:"category,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Confidence float64        `json:"confidence,omitempty"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+}
+
 // Toolset provides tools for the agent to interact with long-term memory.
 type Toolset struct {
 	memoryService MemoryService
 	appName       string
+	schemas       map[string]AttributeSchema
 	tools         []tool.Tool
 }
 
@@ -49,6 +149,10 @@ type ToolsetConfig struct {
 	MemoryService MemoryService
 	// AppName is used to scope memory operations
 	AppName string
+	// Schemas validates the Attributes of a structured save_to_memory call
+	// (see SaveArgs), keyed by Kind. A Kind with no entry here is accepted
+	// unvalidated. See DefaultMemorySchemas for a ready-made starting set.
+	Schemas map[string]AttributeSchema
 }
 
 // NewToolset creates a new toolset for memory operations.
@@ -63,6 +167,7 @@ func NewToolset(cfg ToolsetConfig) (*Toolset, error) {
 	ts := &Toolset{
 		memoryService: cfg.MemoryService,
 		appName:       cfg.AppName,
+		schemas:       cfg.Schemas,
 	}
 
 	// Create search tool
@@ -89,7 +194,19 @@ func NewToolset(cfg ToolsetConfig) (*Toolset, error) {
 		return nil, fmt.Errorf("failed to create save_to_memory tool: %w", err)
 	}
 
-	ts.tools = []tool.Tool{searchTool, saveTool}
+	// Create forget tool
+	forgetTool, err := functiontool.New(
+		functiontool.Config{
+			Name:        "forget_memory",
+			Description: "Remove a previously saved memory by ID. Use this when the user asks you to forget something, or a saved memory turns out to be wrong or stale. The ID comes from a prior search_memory result.",
+		},
+		ts.forgetMemory,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forget_memory tool: %w", err)
+	}
+
+	ts.tools = []tool.Tool{searchTool, saveTool, forgetTool}
 
 	return ts, nil
 }
@@ -108,6 +225,14 @@ func (ts *Toolset) Tools(ctx agent.ReadonlyContext) ([]tool.Tool, error) {
 type SearchArgs struct {
 	// Query is the search query to find relevant memories
 	Query string `json:"query"`
+	// Kind optionally restricts results to structured memories saved with
+	// this exact Kind (see SaveArgs). Memories saved without a Kind never
+	// match a non-empty Kind filter.
+	Kind string `json:"kind,omitempty"`
+	// Attributes optionally restricts results to structured memories whose
+	// Attributes contain every key/value pair given here. Memories saved
+	// without Attributes never match a non-empty Attributes filter.
+	Attributes map[string]any `json:"attributes,omitempty"`
 }
 
 // SearchResult is the result of the search_memory tool.
@@ -120,12 +245,19 @@ type SearchResult struct {
 
 // Entry represents a single memory entry returned by search.
 type Entry struct {
+	// ID identifies this memory for a later forget_memory call. Only set
+	// for structured memories (see SaveArgs); empty for plain free-form ones.
+	ID string `json:"id,omitempty"`
 	// Text is the content of the memory
 	Text string `json:"text"`
 	// Author is who created this memory (user or agent)
 	Author string `json:"author"`
 	// Timestamp is when this memory was created
 	Timestamp string `json:"timestamp"`
+	// Kind is the structured memory's Kind, if any (see SaveArgs).
+	Kind string `json:"kind,omitempty"`
+	// Attributes is the structured memory's Attributes, if any.
+	Attributes map[string]any `json:"attributes,omitempty"`
 }
 
 // searchMemory searches the long-term memory.
@@ -151,11 +283,32 @@ func (ts *Toolset) searchMemory(ctx tool.Context, args SearchArgs) (SearchResult
 		if mem.Content != nil && len(mem.Content.Parts) > 0 {
 			text = mem.Content.Parts[0].Text
 		}
-		entries = append(entries, Entry{
+
+		entry := Entry{
 			Text:      text,
 			Author:    mem.Author,
 			Timestamp: mem.Timestamp.Format("2006-01-02 15:04:05"),
-		})
+		}
+
+		var structured StructuredEntry
+		if json.Unmarshal([]byte(text), &structured) == nil && structured.ID != "" {
+			if structured.ExpiresAt != nil && structured.ExpiresAt.Before(time.Now()) {
+				continue
+			}
+			entry.ID = structured.ID
+			entry.Text = structured.Content
+			entry.Kind = structured.Kind
+			entry.Attributes = structured.Attributes
+		}
+
+		if args.Kind != "" && entry.Kind != args.Kind {
+			continue
+		}
+		if !attributesMatch(entry.Attributes, args.Attributes) {
+			continue
+		}
+
+		entries = append(entries, entry)
 	}
 
 	return SearchResult{
@@ -164,12 +317,39 @@ func (ts *Toolset) searchMemory(ctx tool.Context, args SearchArgs) (SearchResult
 	}, nil
 }
 
+// attributesMatch reports whether have contains every key/value pair in
+// want. An empty want always matches, including against a nil have.
+func attributesMatch(have, want map[string]any) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for key, wantVal := range want {
+		haveVal, ok := have[key]
+		if !ok || !reflect.DeepEqual(haveVal, wantVal) {
+			return false
+		}
+	}
+	return true
+}
+
 // SaveArgs are the arguments for the save_to_memory tool.
 type SaveArgs struct {
 	// Content is the information to save to memory
 	Content string `json:"content"`
 	// Category is an optional category for the memory (e.g., 'preference', 'fact', 'reminder')
 	Category string `json:"category,omitempty"`
+	// Kind, if set, makes this a structured memory: it's validated against
+	// ToolsetConfig.Schemas[Kind] (when present) and returned from
+	// search_memory with an ID, Kind, and Attributes instead of plain text.
+	Kind string `json:"kind,omitempty"`
+	// Attributes holds structured key/value data for a Kind memory, checked
+	// against ToolsetConfig.Schemas[Kind] before saving.
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// TTL, if set, is a duration string (e.g. "24h", "30m") parsed with
+	// time.ParseDuration; search_memory skips the entry once it expires.
+	TTL string `json:"ttl,omitempty"`
+	// Confidence is an optional 0-1 score the caller assigns this memory.
+	Confidence float64 `json:"confidence,omitempty"`
 }
 
 // SaveResult is the result of the save_to_memory tool.
@@ -189,15 +369,65 @@ func (ts *Toolset) saveToMemory(ctx tool.Context, args SaveArgs) (SaveResult, er
 		}, nil
 	}
 
+	if schema, ok := ts.schemas[args.Kind]; ok {
+		if err := schema.Validate(args.Attributes); err != nil {
+			return SaveResult{
+				Success: false,
+				Message: fmt.Sprintf("invalid attributes for kind %q: %v", args.Kind, err),
+			}, nil
+		}
+	}
+
+	var expiresAt *time.Time
+	if args.TTL != "" {
+		d, err := time.ParseDuration(args.TTL)
+		if err != nil {
+			return SaveResult{
+				Success: false,
+				Message: fmt.Sprintf("invalid ttl %q: %v", args.TTL, err),
+			}, nil
+		}
+		exp := time.Now().Add(d)
+		expiresAt = &exp
+	}
+
 	userID := ctx.UserID()
+	structured := args.Kind != "" || len(args.Attributes) > 0 || args.TTL != "" || args.Confidence != 0
+
+	// Computed once and shared between StructuredEntry.ID and the session ID
+	// AddSession stores under, so forget_memory's DeleteMemory call (keyed on
+	// the session ID) can find the memory search_memory reported this ID for.
+	id := fmt.Sprintf("memory-%d", time.Now().UnixNano())
+
+	var text string
+	if structured {
+		payload, err := json.Marshal(StructuredEntry{
+			ID:         id,
+			Kind:       args.Kind,
+			Content:    args.Content,
+			Category:   args.Category,
+			Attributes: args.Attributes,
+			Confidence: args.Confidence,
+			ExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			return SaveResult{
+				Success: false,
+				Message: fmt.Sprintf("failed to encode structured memory: %v", err),
+			}, nil
+		}
+		text = string(payload)
+	}
 
 	// Create a minimal session with just this memory entry
 	memorySession := &singleEntrySession{
-		id:       fmt.Sprintf("memory-%d", time.Now().UnixNano()),
-		appName:  ts.appName,
-		userID:   userID,
-		content:  args.Content,
-		category: args.Category,
+		id:         id,
+		appName:    ts.appName,
+		userID:     userID,
+		content:    args.Content,
+		category:   args.Category,
+		structured: structured,
+		rawText:    text,
 	}
 
 	err := ts.memoryService.AddSession(ctx, memorySession)
@@ -214,6 +444,51 @@ func (ts *Toolset) saveToMemory(ctx tool.Context, args SaveArgs) (SaveResult, er
 	}, nil
 }
 
+// ForgetArgs are the arguments for the forget_memory tool.
+type ForgetArgs struct {
+	// ID identifies the memory to remove, as returned in a search_memory Entry.
+	ID string `json:"id"`
+}
+
+// ForgetResult is the result of the forget_memory tool.
+type ForgetResult struct {
+	// Success indicates if the memory was removed
+	Success bool `json:"success"`
+	// Message provides additional information
+	Message string `json:"message"`
+}
+
+// forgetMemory removes a previously saved memory by ID, if the configured
+// MemoryService supports deleting individual memories (see Deleter).
+func (ts *Toolset) forgetMemory(ctx tool.Context, args ForgetArgs) (ForgetResult, error) {
+	if args.ID == "" {
+		return ForgetResult{
+			Success: false,
+			Message: "id cannot be empty",
+		}, nil
+	}
+
+	deleter, ok := ts.memoryService.(Deleter)
+	if !ok {
+		return ForgetResult{
+			Success: false,
+			Message: "memory backend does not support deleting individual memories",
+		}, nil
+	}
+
+	if err := deleter.DeleteMemory(ctx, ts.appName, ctx.UserID(), args.ID); err != nil {
+		return ForgetResult{
+			Success: false,
+			Message: fmt.Sprintf("failed to forget memory: %v", err),
+		}, nil
+	}
+
+	return ForgetResult{
+		Success: true,
+		Message: "Memory forgotten successfully",
+	}, nil
+}
+
 // Ensure interface is implemented
 var _ tool.Toolset = (*Toolset)(nil)
 
@@ -224,6 +499,11 @@ type singleEntrySession struct {
 	userID   string
 	content  string
 	category string
+	// structured indicates rawText already holds a serialized StructuredEntry
+	// (see saveToMemory), so createEvent must store it verbatim instead of
+	// applying the plain-text category-prefix convention.
+	structured bool
+	rawText    string
 }
 
 func (s *singleEntrySession) ID() string                { return s.id }
@@ -234,15 +514,19 @@ func (s *singleEntrySession) LastUpdateTime() time.Time { return time.Now() }
 
 func (s *singleEntrySession) Events() session.Events {
 	return &singleEntryEvents{
-		content:  s.content,
-		category: s.category,
+		content:    s.content,
+		category:   s.category,
+		structured: s.structured,
+		rawText:    s.rawText,
 	}
 }
 
 // singleEntryEvents provides a single event containing the memory content.
 type singleEntryEvents struct {
-	content  string
-	category string
+	content    string
+	category   string
+	structured bool
+	rawText    string
 }
 
 func (e *singleEntryEvents) All() iter.Seq[*session.Event] {
@@ -264,7 +548,9 @@ func (e *singleEntryEvents) At(i int) *session.Event {
 
 func (e *singleEntryEvents) createEvent() *session.Event {
 	text := e.content
-	if e.category != "" {
+	if e.structured {
+		text = e.rawText
+	} else if e.category != "" {
 		text = "[" + e.category + "] " + text
 	}
 	return &session.Event{